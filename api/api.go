@@ -4,8 +4,10 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"strconv"
 
 	"github.com/git-lfs/git-lfs/config"
@@ -30,6 +32,15 @@ func BatchSingle(cfg *config.Configuration, inobj *ObjectResource, operation str
 
 // Batch calls the batch API and returns object results
 func Batch(cfg *config.Configuration, objects []*ObjectResource, operation string, transferAdapters []string) (objs []*ObjectResource, transferAdapter string, e error) {
+	return BatchRoute(context.Background(), cfg, nil, objects, operation, transferAdapters)
+}
+
+// BatchRoute calls the batch API of the LFS server to which objects sent along
+// the given storage route go, asking for the route's storage class, and returns
+// object results. A nil route sends them as Batch does. The request is
+// cancelled once ctx is done, and the context's error returned, without trying
+// the server's mirrors.
+func BatchRoute(ctx context.Context, cfg *config.Configuration, route *config.StorageRoute, objects []*ObjectResource, operation string, transferAdapters []string) (objs []*ObjectResource, transferAdapter string, e error) {
 	if len(objects) == 0 {
 		return nil, "", nil
 	}
@@ -41,37 +52,58 @@ func Batch(cfg *config.Configuration, objects []*ObjectResource, operation strin
 	}
 
 	o := &batchRequest{Operation: operation, Objects: objects, TransferAdapterNames: transferAdapters}
+	if route != nil {
+		o.StorageClass = route.Class
+	}
 	by, err := json.Marshal(o)
 	if err != nil {
 		return nil, "", errors.Wrap(err, "batch request")
 	}
 
-	req, err := NewBatchRequest(cfg, operation)
+	endpoint := cfg.StorageEndpoint(route, operation)
+	req, err := newBatchRequest(cfg, endpoint, operation)
 	if err != nil {
 		return nil, "", errors.Wrap(err, "batch request")
 	}
+	req = req.WithContext(ctx)
 
 	req.Header.Set("Content-Type", MediaType)
 	req.Header.Set("Content-Length", strconv.Itoa(len(by)))
 	req.ContentLength = int64(len(by))
 	req.Body = tools.NewReadSeekCloserWrapper(bytes.NewReader(by))
 
-	tracerx.Printf("api: batch %d files", len(objects))
+	if route != nil {
+		tracerx.Printf("api: batch %d files for storage route %s", len(objects), route.Name)
+	} else {
+		tracerx.Printf("api: batch %d files", len(objects))
+	}
 
-	res, bresp, err := DoBatchRequest(cfg, req)
+	res, bresp, err := doBatchRequest(cfg, req, cfg.EndpointAccess(endpoint) != "none")
 
 	if err != nil {
+		if cerr := ctx.Err(); cerr != nil {
+			return nil, "", cerr
+		}
+
 		if res == nil {
 			return nil, "", errors.NewRetriableError(err)
 		}
 
 		if res.StatusCode == 0 {
+			// If the server couldn't be reached, try its next
+			// mirror, if there is one.
+			if isUnreachable(err) && (route == nil || len(route.Url) == 0) && cfg.FailOver(operation) {
+				return BatchRoute(ctx, cfg, route, objects, operation, transferAdapters)
+			}
 			return nil, "", errors.NewRetriableError(err)
 		}
 
 		if errors.IsAuthError(err) {
-			httputil.SetAuthType(cfg, req, res)
-			return Batch(cfg, objects, operation, transferAdapters)
+			// Record the access of the endpoint the request was
+			// made to, which may be a mirror, or a route's
+			// server, rather than the operation's.
+			cfg.SetEndpointAccess(endpoint, httputil.GetAuthType(res))
+			return BatchRoute(ctx, cfg, route, objects, operation, transferAdapters)
 		}
 
 		tracerx.Printf("api error: %s", err)
@@ -85,3 +117,22 @@ func Batch(cfg *config.Configuration, objects []*ObjectResource, operation strin
 
 	return bresp.Objects, bresp.TransferAdapterName, nil
 }
+
+// isUnreachable returns whether err was caused by a failure to connect to or
+// communicate with the server, rather than by its response.
+func isUnreachable(err error) bool {
+	for err != nil {
+		if _, ok := err.(net.Error); ok {
+			return true
+		}
+
+		c, ok := err.(interface {
+			Cause() error
+		})
+		if !ok || c.Cause() == err {
+			return false
+		}
+		err = c.Cause()
+	}
+	return false
+}
@@ -29,6 +29,9 @@ type Client struct {
 	// Locks is the LockService used to interact with the Git LFS file-
 	// locking API.
 	Locks LockService
+	// Existence is the ExistenceService used to interact with the Git LFS
+	// object existence filter API.
+	Existence ExistenceService
 
 	// lifecycle is the lifecycle used by all requests through this client.
 	lifecycle Lifecycle
@@ -1,6 +1,7 @@
 package api_test
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -401,3 +402,28 @@ func SetupTestCredentialsFunc() {
 func RestoreCredentialsFunc() {
 	auth.SetCredentialsFunc(origCredentialsFunc)
 }
+
+func TestDownloadWithDoneContext(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/media/objects/batch", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected batch request")
+		w.WriteHeader(500)
+	})
+
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.url": server.URL + "/media",
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := api.BatchRoute(ctx, cfg, nil, []*api.ObjectResource{{Oid: "oid"}}, "download", []string{"basic"})
+	if err != context.Canceled {
+		t.Fatalf("Expected: %v\nGot: %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// ExistenceService is an API service which encapsulates the Git LFS object
+// existence filter API.
+type ExistenceService struct{}
+
+// Filter generates a *RequestSchema that is used to preform the "get existence
+// filter" API method.
+//
+// Servers which offer it respond with a Bloom filter of the OIDs of every
+// object they have, which clients may consult instead of asking whether the
+// server has a particular object. Servers which don't respond with an error,
+// such as a 404.
+func (s *ExistenceService) Filter() (*RequestSchema, *ExistenceFilter) {
+	var resp ExistenceFilter
+
+	return &RequestSchema{
+		Method:    "GET",
+		Path:      "/objects/filter",
+		Operation: UploadOperation,
+		Into:      &resp,
+	}, &resp
+}
+
+// ExistenceFilter is a Bloom filter of the OIDs of the objects a server has.
+//
+// An OID is in the filter if each of Hashes bits is set. The bits are found by
+// double hashing: with h1 and h2 the first and second 8 bytes of the OID as
+// big-endian integers, the i'th bit is (h1 + i*h2) mod Bits, for i from 0 to
+// Hashes-1. Bit n of the filter is the bit (1 << (n mod 8)) of its byte n/8.
+type ExistenceFilter struct {
+	// Hashes is the number of bits set for each OID.
+	Hashes int `json:"hashes"`
+	// Bits is the number of bits in the filter.
+	Bits uint64 `json:"bits"`
+	// Filter holds the bits of the filter, encoded as base64.
+	Filter []byte `json:"filter"`
+}
+
+// Valid returns whether the filter is well-formed.
+func (f *ExistenceFilter) Valid() bool {
+	return f.Hashes > 0 && f.Bits > 0 && uint64(len(f.Filter))*8 >= f.Bits
+}
+
+// NewExistenceFilter returns an empty filter of the given number of bits, in
+// which each OID sets the given number of them.
+func NewExistenceFilter(bits uint64, hashes int) *ExistenceFilter {
+	return &ExistenceFilter{
+		Hashes: hashes,
+		Bits:   bits,
+		Filter: make([]byte, (bits+7)/8),
+	}
+}
+
+// Contains returns whether the object with the given OID is probably in the
+// filter. If it returns false, the object is certainly not in the filter; if
+// it returns true, the object may still not be, with a probability depending
+// on the size of the filter.
+func (f *ExistenceFilter) Contains(oid string) bool {
+	positions, ok := f.positions(oid)
+	if !ok {
+		return false
+	}
+
+	for _, n := range positions {
+		if f.Filter[n/8]&(1<<(n%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Add adds the object with the given OID to the filter.
+func (f *ExistenceFilter) Add(oid string) {
+	positions, _ := f.positions(oid)
+	for _, n := range positions {
+		f.Filter[n/8] |= 1 << (n % 8)
+	}
+}
+
+// positions returns the bits of the filter for the given OID, and whether the
+// filter and OID are valid.
+func (f *ExistenceFilter) positions(oid string) ([]uint64, bool) {
+	if !f.Valid() {
+		return nil, false
+	}
+
+	b, err := hex.DecodeString(oid)
+	if err != nil || len(b) < 16 {
+		return nil, false
+	}
+
+	h1 := binary.BigEndian.Uint64(b[0:8])
+	h2 := binary.BigEndian.Uint64(b[8:16])
+
+	positions := make([]uint64, f.Hashes)
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % f.Bits
+	}
+	return positions, true
+}
@@ -0,0 +1,49 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/git-lfs/git-lfs/api"
+	"github.com/stretchr/testify/assert"
+)
+
+var ExistenceService api.ExistenceService
+
+func TestGettingTheExistenceFilter(t *testing.T) {
+	got, body := ExistenceService.Filter()
+
+	AssertRequestSchema(t, &api.RequestSchema{
+		Method:    "GET",
+		Path:      "/objects/filter",
+		Operation: api.UploadOperation,
+		Into:      body,
+	}, got)
+}
+
+func TestExistenceFilterContainsAddedOids(t *testing.T) {
+	added := "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+	other := "c0ffee0c0ffee0c0ffee0c0ffee0c0ffee0c0ffee0c0ffee0c0ffee0c0ffee00"
+
+	f := api.NewExistenceFilter(1024, 4)
+	assert.False(t, f.Contains(added))
+
+	f.Add(added)
+	assert.True(t, f.Contains(added))
+	assert.False(t, f.Contains(other))
+}
+
+func TestExistenceFilterWithInvalidOid(t *testing.T) {
+	f := api.NewExistenceFilter(1024, 4)
+	f.Add("not-an-oid")
+
+	assert.False(t, f.Contains("not-an-oid"))
+}
+
+func TestInvalidExistenceFilterContainsNothing(t *testing.T) {
+	oid := "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+
+	f := &api.ExistenceFilter{Hashes: 4, Bits: 1024, Filter: make([]byte, 8)}
+	assert.False(t, f.Valid())
+	f.Add(oid)
+	assert.False(t, f.Contains(oid))
+}
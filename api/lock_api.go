@@ -54,6 +54,10 @@ func (s *LockService) Lock(req *LockRequest) (*RequestSchema, *LockResponse) {
 //
 // In the successful case, one or more locks will be returned as a part of the
 // response.
+//
+// Like the other lock methods, searches are sent to the push endpoint, since
+// the endpoint for fetching, such as one given by "lfs.pullurl", may be a
+// read-only mirror which knows nothing of locks.
 func (s *LockService) Search(req *LockSearchRequest) (*RequestSchema, *LockList) {
 	var resp LockList
 
@@ -73,12 +77,35 @@ func (s *LockService) Search(req *LockSearchRequest) (*RequestSchema, *LockList)
 	return &RequestSchema{
 		Method:    "GET",
 		Path:      "/locks",
-		Operation: DownloadOperation,
+		Operation: UploadOperation,
 		Query:     query,
 		Into:      &resp,
 	}, &resp
 }
 
+// SearchVerifiable generates a *RequestSchema that is used to preform the
+// "list locks for verification" API method.
+//
+// Unlike Search, the server separates the locks held by the committer given in
+// the LockVerifiableRequest, in the Ours field of the response, from those held
+// by everyone else, in the Theirs field. The response is paginated in the same
+// way as Search, by sending the NextCursor of one response as the Cursor of
+// the next request.
+//
+// If the server was unable to process the request, then the Err field will be
+// populated in the response.
+func (s *LockService) SearchVerifiable(req *LockVerifiableRequest) (*RequestSchema, *LockVerifiableList) {
+	var resp LockVerifiableList
+
+	return &RequestSchema{
+		Method:    "POST",
+		Path:      "/locks/verify",
+		Operation: UploadOperation,
+		Body:      req,
+		Into:      &resp,
+	}, &resp
+}
+
 // Unlock generates a *RequestSchema that is used to preform the "unlock" API
 // method, against a particular lock potentially with --force.
 //
@@ -124,6 +151,10 @@ type Lock struct {
 	// the server can either a) not send this field, or b) send the
 	// zero-value of time.Time.
 	UnlockedAt time.Time `json:"unlocked_at,omitempty"`
+	// ExpiresAt is an optional parameter that represents the instant in
+	// time that the server will release the lock, if it was requested with
+	// an expiry, and is nil otherwise.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 // Active returns whether or not the given lock is still active against the file
@@ -157,6 +188,10 @@ type LockRequest struct {
 	LatestRemoteCommit string `json:"latest_remote_commit"`
 	// Committer is the individual that wishes to obtain the lock.
 	Committer Committer `json:"committer"`
+	// ExpiresIn is an optional number of seconds after which the server
+	// should release the lock. Servers which don't support expiry ignore
+	// it, and return a Lock without an ExpiresAt.
+	ExpiresIn int `json:"expires_in,omitempty"`
 }
 
 // LockResponse encapsulates the information sent over the API in response to
@@ -245,3 +280,32 @@ type LockList struct {
 	// of nil will be passed here.
 	Err string `json:"error,omitempty"`
 }
+
+// LockVerifiableRequest encapsulates the request sent to the server when the
+// client would like a list of locks, separated into those held by the
+// committer and those held by others.
+type LockVerifiableRequest struct {
+	// Committer is the user whose locks are returned in the Ours field of
+	// the response.
+	Committer Committer `json:"committer"`
+	// Cursor is an optional field used to tell the server which lock was
+	// seen last, if scanning through multiple pages of results.
+	Cursor string `json:"cursor,omitempty"`
+	// Limit is the maximum number of locks to return in a single page.
+	Limit int `json:"limit,omitempty"`
+}
+
+// LockVerifiableList encapsulates a set of Locks, separated by who holds them.
+type LockVerifiableList struct {
+	// Ours is the set of locks held by the committer given in the
+	// LockVerifiableRequest.
+	Ours []Lock `json:"ours"`
+	// Theirs is the set of locks held by anyone else.
+	Theirs []Lock `json:"theirs"`
+	// NextCursor returns the Id of the Lock the client should update its
+	// cursor to, if there are multiple pages of results.
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Err populates any error that was encountered while listing the
+	// locks.
+	Err string `json:"error,omitempty"`
+}
@@ -1,11 +1,14 @@
 package api_test
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/git-lfs/git-lfs/api"
 	"github.com/git-lfs/git-lfs/api/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var LockService api.LockService
@@ -37,7 +40,7 @@ func TestLockSearchWithFilters(t *testing.T) {
 			"path":   "/path/to/file",
 		},
 		Path:      "/locks",
-		Operation: api.DownloadOperation,
+		Operation: api.UploadOperation,
 		Into:      body,
 	}, got)
 }
@@ -53,7 +56,7 @@ func TestLockSearchWithNextCursor(t *testing.T) {
 			"cursor": "some-lock-id",
 		},
 		Path:      "/locks",
-		Operation: api.DownloadOperation,
+		Operation: api.UploadOperation,
 		Into:      body,
 	}, got)
 }
@@ -69,7 +72,24 @@ func TestLockSearchWithLimit(t *testing.T) {
 			"limit": "20",
 		},
 		Path:      "/locks",
-		Operation: api.DownloadOperation,
+		Operation: api.UploadOperation,
+		Into:      body,
+	}, got)
+}
+
+func TestLockSearchVerifiable(t *testing.T) {
+	req := &api.LockVerifiableRequest{
+		Committer: api.NewCommitter("Jane Doe", "jane@example.com"),
+		Cursor:    "some-lock-id",
+		Limit:     20,
+	}
+	got, body := LockService.SearchVerifiable(req)
+
+	AssertRequestSchema(t, &api.RequestSchema{
+		Method:    "POST",
+		Path:      "/locks/verify",
+		Operation: api.UploadOperation,
+		Body:      req,
 		Into:      body,
 	}, got)
 }
@@ -100,6 +120,35 @@ func TestLockRequest(t *testing.T) {
 	})
 }
 
+func TestLockRequestWithExpiry(t *testing.T) {
+	schema.Validate(t, schema.LockRequestSchema, &api.LockRequest{
+		Path:               "/path/to/lock",
+		LatestRemoteCommit: "deadbeef",
+		Committer: api.Committer{
+			Name:  "Jane Doe",
+			Email: "jane@example.com",
+		},
+		ExpiresIn: 8 * 60 * 60,
+	})
+}
+
+func TestLockResponseWithExpiringLock(t *testing.T) {
+	expiresAt := time.Now().Add(8 * time.Hour)
+
+	schema.Validate(t, schema.LockResponseSchema, &api.LockResponse{
+		Lock: &api.Lock{
+			Id:   "some-lock-id",
+			Path: "/lock/path",
+			Committer: api.Committer{
+				Name:  "Jane Doe",
+				Email: "jane@example.com",
+			},
+			LockedAt:  time.Now(),
+			ExpiresAt: &expiresAt,
+		},
+	})
+}
+
 func TestLockResponseWithLockedLock(t *testing.T) {
 	schema.Validate(t, schema.LockResponseSchema, &api.LockResponse{
 		Lock: &api.Lock{
@@ -218,3 +267,43 @@ func TestLockListWithErrorAndLocks(t *testing.T) {
 		Err: "this isn't possible!",
 	})
 }
+
+func TestLockVerifiableListWithLocks(t *testing.T) {
+	schema.Validate(t, schema.LockVerifiableListSchema, &api.LockVerifiableList{
+		Ours: []api.Lock{
+			api.Lock{Id: "foo"},
+		},
+		Theirs: []api.Lock{
+			api.Lock{Id: "bar"},
+		},
+		NextCursor: "baz",
+	})
+}
+
+func TestLockVerifiableListWithNoResults(t *testing.T) {
+	schema.Validate(t, schema.LockVerifiableListSchema, &api.LockVerifiableList{
+		Ours:   []api.Lock{},
+		Theirs: []api.Lock{},
+	})
+}
+
+func TestLockVerifiableListWithError(t *testing.T) {
+	schema.Validate(t, schema.LockVerifiableListSchema, &api.LockVerifiableList{
+		Err: "some error",
+	})
+}
+
+func TestLockVerifiableListWithErrorAndLocks(t *testing.T) {
+	schema.Refute(t, schema.LockVerifiableListSchema, &api.LockVerifiableList{
+		Ours: []api.Lock{
+			api.Lock{Id: "foo"},
+		},
+		Err: "this isn't possible!",
+	})
+}
+
+func TestLockWithoutExpiryOmitsExpiresAt(t *testing.T) {
+	by, err := json.Marshal(&api.Lock{Id: "some-lock-id", LockedAt: time.Now()})
+	require.Nil(t, err)
+	assert.NotContains(t, string(by), "expires_at")
+}
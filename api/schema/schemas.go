@@ -16,9 +16,10 @@
 package schema
 
 const (
-	LockListSchema       = "lock_list_schema.json"
-	LockRequestSchema    = "lock_request_schema.json"
-	LockResponseSchema   = "lock_response_schema.json"
-	UnlockRequestSchema  = "unlock_request_schema.json"
-	UnlockResponseSchema = "unlock_response_schema.json"
+	LockListSchema           = "lock_list_schema.json"
+	LockRequestSchema        = "lock_request_schema.json"
+	LockResponseSchema       = "lock_response_schema.json"
+	LockVerifiableListSchema = "lock_verifiable_list_schema.json"
+	UnlockRequestSchema      = "unlock_request_schema.json"
+	UnlockResponseSchema     = "unlock_response_schema.json"
 )
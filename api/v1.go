@@ -21,6 +21,7 @@ type batchRequest struct {
 	TransferAdapterNames []string          `json:"transfers,omitempty"`
 	Operation            string            `json:"operation"`
 	Objects              []*ObjectResource `json:"objects"`
+	StorageClass         string            `json:"storage_class,omitempty"`
 }
 type batchResponse struct {
 	TransferAdapterName string            `json:"transfer"`
@@ -32,7 +33,11 @@ type batchResponse struct {
 // re-run. When the repo is marked as having private access, credentials will
 // be retrieved.
 func DoBatchRequest(cfg *config.Configuration, req *http.Request) (*http.Response, *batchResponse, error) {
-	res, err := DoRequest(req, cfg.PrivateAccess(auth.GetOperationForRequest(req)))
+	return doBatchRequest(cfg, req, cfg.PrivateAccess(auth.GetOperationForRequest(req)))
+}
+
+func doBatchRequest(cfg *config.Configuration, req *http.Request, useCreds bool) (*http.Response, *batchResponse, error) {
+	res, err := DoRequest(cfg, req, useCreds)
 
 	if err != nil {
 		if res != nil && res.StatusCode == 401 {
@@ -51,13 +56,13 @@ func DoBatchRequest(cfg *config.Configuration, req *http.Request) (*http.Respons
 	return res, resp, err
 }
 
-// DoRequest runs a request to the LFS API, without parsing the response
-// body. If the API returns a 401, the repo will be marked as having private
-// access and the request will be re-run. When the repo is marked as having
-// private access, credentials will be retrieved.
-func DoRequest(req *http.Request, useCreds bool) (*http.Response, error) {
+// DoRequest runs a request to the LFS API with the given configuration,
+// without parsing the response body. If the API returns a 401, the repo will be
+// marked as having private access and the request will be re-run. When the
+// repo is marked as having private access, credentials will be retrieved.
+func DoRequest(cfg *config.Configuration, req *http.Request, useCreds bool) (*http.Response, error) {
 	via := make([]*http.Request, 0, 4)
-	return httputil.DoHttpRequestWithRedirects(config.Config, req, via, useCreds)
+	return httputil.DoHttpRequestWithRedirects(cfg, req, via, useCreds)
 }
 
 func NewRequest(cfg *config.Configuration, method, oid string) (*http.Request, error) {
@@ -97,7 +102,11 @@ func NewRequest(cfg *config.Configuration, method, oid string) (*http.Request, e
 }
 
 func NewBatchRequest(cfg *config.Configuration, operation string) (*http.Request, error) {
-	res, endpoint, err := auth.SshAuthenticate(cfg, operation, "")
+	return newBatchRequest(cfg, cfg.Endpoint(operation), operation)
+}
+
+func newBatchRequest(cfg *config.Configuration, endpoint config.Endpoint, operation string) (*http.Request, error) {
+	res, endpoint, err := auth.SshAuthenticateEndpoint(cfg, endpoint, operation, "")
 	if err != nil {
 		tracerx.Printf("ssh: %s with %s failed, error: %s, message: %s",
 			operation, endpoint.SshUserAndHost, err.Error(), res.Message,
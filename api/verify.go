@@ -6,10 +6,12 @@ import (
 	"io"
 	"io/ioutil"
 	"strconv"
+	"time"
 
 	"github.com/git-lfs/git-lfs/config"
 	"github.com/git-lfs/git-lfs/errors"
 	"github.com/git-lfs/git-lfs/httputil"
+	"github.com/git-lfs/git-lfs/tools"
 )
 
 // VerifyUpload calls the "verify" API link relation on obj if it exists
@@ -33,7 +35,8 @@ func VerifyUpload(cfg *config.Configuration, obj *ObjectResource) error {
 	req.Header.Set("Content-Length", strconv.Itoa(len(by)))
 	req.ContentLength = int64(len(by))
 	req.Body = ioutil.NopCloser(bytes.NewReader(by))
-	res, err := DoRequest(req, true)
+	defer tools.TracePerformanceSince(time.Now(), "verify: %s", obj.Oid)
+	res, err := DoRequest(cfg, req, true)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/rubyist/tracerx"
+)
+
+// credentialCache holds the credentials filled by 'git credential fill' in
+// this process, so that a command making thousands of requests to a host asks
+// the credential helper for them once, rather than once per request.
+type credentialCache struct {
+	mu       sync.Mutex
+	creds    map[string]Creds
+	approved map[string]bool
+}
+
+func newCredentialCache() *credentialCache {
+	return &credentialCache{
+		creds:    make(map[string]Creds),
+		approved: make(map[string]bool),
+	}
+}
+
+// Get returns the credentials filled for input, if there are any.
+func (c *credentialCache) Get(input Creds) (Creds, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	creds, ok := c.creds[credCacheKey(input)]
+	return creds, ok
+}
+
+// Set records that creds were filled for input.
+func (c *credentialCache) Set(input, creds Creds) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.creds[credCacheKey(input)] = creds
+}
+
+// Approve records that the server accepted creds, returning whether it hadn't
+// already, so that the credential helper is only told about them once.
+func (c *credentialCache) Approve(creds Creds) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := credCacheKey(creds) + "\x00" + creds["password"]
+	if c.approved[key] {
+		return false
+	}
+	c.approved[key] = true
+	return true
+}
+
+// Reject forgets creds, so that they're filled again the next time they're
+// needed.
+func (c *credentialCache) Reject(creds Creds) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, cached := range c.creds {
+		if sameCreds(cached, creds) {
+			delete(c.creds, key)
+		}
+	}
+	delete(c.approved, credCacheKey(creds)+"\x00"+creds["password"])
+}
+
+func credCacheKey(c Creds) string {
+	return strings.Join([]string{c["protocol"], c["host"], c["path"], c["username"]}, "\x00")
+}
+
+func sameCreds(a, b Creds) bool {
+	return credCacheKey(a) == credCacheKey(b) && a["password"] == b["password"]
+}
+
+var credCache = newCredentialCache()
+
+// fillCachedCreds fills the credentials for input from the cache of this
+// process, or from Git's credential-cache daemon if lfs.credentialcachetimeout
+// is set, before asking 'git credential fill'.
+func fillCachedCreds(cfg *config.Configuration, input Creds) (Creds, error) {
+	if !cfg.CacheCredentials() {
+		return execCreds(cfg, input, "fill")
+	}
+
+	if creds, ok := credCache.Get(input); ok {
+		return creds, nil
+	}
+
+	if timeout := cfg.CredentialCacheTimeout(); timeout > 0 {
+		if creds := execCredentialCacheDaemon(timeout, input, "get"); len(creds["password"]) > 0 {
+			tracerx.Printf("creds: filled from credential-cache daemon")
+			credCache.Set(input, creds)
+			return creds, nil
+		}
+	}
+
+	creds, err := execCreds(cfg, input, "fill")
+	if err == nil && len(creds) > 0 {
+		credCache.Set(input, creds)
+	}
+	return creds, err
+}
+
+// approveCachedCreds tells the credential helper that creds were accepted, the
+// first time they are in this process.
+func approveCachedCreds(cfg *config.Configuration, creds Creds) {
+	if !cfg.CacheCredentials() {
+		execCreds(cfg, creds, "approve")
+		return
+	}
+
+	if !credCache.Approve(creds) {
+		return
+	}
+
+	if timeout := cfg.CredentialCacheTimeout(); timeout > 0 {
+		execCredentialCacheDaemon(timeout, creds, "store")
+	}
+	execCreds(cfg, creds, "approve")
+}
+
+// rejectCachedCreds forgets creds, and tells the credential helper that they
+// were rejected.
+func rejectCachedCreds(cfg *config.Configuration, creds Creds) {
+	if cfg.CacheCredentials() {
+		credCache.Reject(creds)
+
+		if timeout := cfg.CredentialCacheTimeout(); timeout > 0 {
+			execCredentialCacheDaemon(timeout, creds, "erase")
+		}
+	}
+	execCreds(cfg, creds, "reject")
+}
+
+// execCredentialCacheDaemon runs "git credential-cache" to get, store or erase
+// the credentials for input in its memory-backed daemon, which keeps them for
+// timeout seconds. This lets later invocations of Git LFS reuse credentials
+// without asking the credential helper again. Errors, for example where the
+// daemon isn't supported, are traced and otherwise ignored.
+func execCredentialCacheDaemon(timeout int, input Creds, op string) Creds {
+	output := new(bytes.Buffer)
+	cmd := exec.Command("git", "credential-cache", fmt.Sprintf("--timeout=%d", timeout), op)
+	cmd.Stdin = input.Buffer()
+	cmd.Stdout = output
+	// As in execCredsCommand, stderr isn't hooked up, since the daemon
+	// doesn't close it.
+
+	if err := cmd.Run(); err != nil {
+		tracerx.Printf("creds: 'git credential-cache %s' error: %s", op, err)
+		return nil
+	}
+
+	if op != "get" {
+		return nil
+	}
+
+	creds := make(Creds)
+	for _, line := range strings.Split(output.String(), "\n") {
+		pieces := strings.SplitN(line, "=", 2)
+		if len(pieces) < 2 || len(pieces[1]) < 1 {
+			continue
+		}
+		creds[pieces[0]] = pieces[1]
+	}
+	if len(creds) == 0 {
+		return nil
+	}
+
+	for key, value := range input {
+		if _, ok := creds[key]; !ok {
+			creds[key] = value
+		}
+	}
+	return creds
+}
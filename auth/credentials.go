@@ -50,7 +50,13 @@ func GetCreds(cfg *config.Configuration, req *http.Request) (Creds, error) {
 
 func getCredURLForAPI(cfg *config.Configuration, req *http.Request) (*url.URL, error) {
 	operation := GetOperationForRequest(req)
-	apiUrl, err := url.Parse(cfg.Endpoint(operation).Url)
+	endpoint := cfg.Endpoint(operation)
+	rawurl := endpoint.Url
+	if endpoint.IsWebdav() {
+		// requests are made to the share's http(s):// URL
+		rawurl = endpoint.WebdavUrl()
+	}
+	apiUrl, err := url.Parse(rawurl)
 	if err != nil {
 		return nil, err
 	}
@@ -135,9 +141,11 @@ func fillCredentials(cfg *config.Configuration, req *http.Request, u *url.URL) (
 	input := Creds{"protocol": u.Scheme, "host": u.Host, "path": path}
 	if u.User != nil && u.User.Username() != "" {
 		input["username"] = u.User.Username()
+	} else if username, ok := credentialUsername(cfg, req, u); ok {
+		input["username"] = username
 	}
 
-	creds, err := execCreds(cfg, input, "fill")
+	creds, err := fillCachedCreds(cfg, input)
 	if creds == nil || len(creds) < 1 {
 		errmsg := fmt.Sprintf("Git credentials for %s not found", u)
 		if err != nil {
@@ -158,6 +166,40 @@ func fillCredentials(cfg *config.Configuration, req *http.Request, u *url.URL) (
 	return creds, err
 }
 
+// credentialUsername returns the username given by "credential.<url>.username"
+// for the current remote's repository path on the host of u, or failing that for
+// u itself. This lets different accounts be used for different repositories on
+// the same host, wherever their LFS requests are made.
+func credentialUsername(cfg *config.Configuration, req *http.Request, u *url.URL) (string, bool) {
+	if path, ok := repositoryPath(cfg, GetOperationForRequest(req)); ok {
+		repoUrl := *u
+		repoUrl.Path = path
+		if username, ok := cfg.URLConfig("credential", "username", &repoUrl); ok {
+			return username, true
+		}
+	}
+
+	return cfg.URLConfig("credential", "username", u)
+}
+
+// repositoryPath returns the path of the current remote's URL, which may be
+// an HTTP or SSH URL, or an SCP-like "[user@]host:path".
+func repositoryPath(cfg *config.Configuration, operation string) (string, bool) {
+	if len(cfg.CurrentRemote) == 0 {
+		return "", false
+	}
+
+	rawurl := cfg.GitRemoteUrl(cfg.CurrentRemote, operation == "upload")
+	if u, err := url.Parse(rawurl); err == nil && len(u.Scheme) > 0 {
+		return u.Path, true
+	}
+
+	if i := strings.Index(rawurl, ":"); i > 1 && !strings.Contains(rawurl[:i], "/") {
+		return "/" + strings.TrimPrefix(rawurl[i+1:], "/"), true
+	}
+	return "", false
+}
+
 func SaveCredentials(cfg *config.Configuration, creds Creds, res *http.Response) {
 	if creds == nil {
 		return
@@ -165,10 +207,10 @@ func SaveCredentials(cfg *config.Configuration, creds Creds, res *http.Response)
 
 	switch res.StatusCode {
 	case 401, 403:
-		execCreds(cfg, creds, "reject")
+		rejectCachedCreds(cfg, creds)
 	default:
 		if res.StatusCode < 300 {
-			execCreds(cfg, creds, "approve")
+			approveCachedCreds(cfg, creds)
 		}
 	}
 }
@@ -192,6 +234,9 @@ func (c Creds) Buffer() *bytes.Buffer {
 type CredentialFunc func(*config.Configuration, Creds, string) (Creds, error)
 
 func execCredsCommand(cfg *config.Configuration, input Creds, subCommand string) (Creds, error) {
+	tracerx.Printf("creds: git credential %s (%q, %q, %q)", subCommand,
+		input["protocol"], input["host"], input["path"])
+
 	output := new(bytes.Buffer)
 	cmd := exec.Command("git", "credential", subCommand)
 	cmd.Stdin = input.Buffer()
@@ -273,10 +318,12 @@ func GetCredentialsFunc() CredentialFunc {
 }
 
 // SetCredentialsFunc overrides the default credentials function (which is to call git)
+// and empties the cache of credentials it filled.
 // Returns the previous credentials func
 func SetCredentialsFunc(f CredentialFunc) CredentialFunc {
 	oldf := execCreds
 	execCreds = f
+	credCache = newCredentialCache()
 	return oldf
 }
 
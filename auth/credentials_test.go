@@ -106,6 +106,55 @@ func TestGetCredentialsForApi(t *testing.T) {
 			Username: "user",
 			Password: "monkey",
 		},
+		{
+			Desc:          "username for repository path",
+			CurrentRemote: "origin",
+			Config: map[string]string{
+				"lfs.url":           "https://git-server.com/lfs",
+				"remote.origin.url": "https://git-server.com/work/repo.git",
+				"credential.https://git-server.com/work.username": "work-user",
+				"credential.https://git-server.com/me.username":   "my-user",
+			},
+			Method:   "GET",
+			Href:     "https://git-server.com/storage/foo",
+			Protocol: "https",
+			Host:     "git-server.com",
+			Username: "work-user",
+			Password: "monkey",
+		},
+		{
+			Desc:          "username for ssh repository path on lfs host",
+			CurrentRemote: "origin",
+			Config: map[string]string{
+				"lfs.url":           "https://lfs-server.com",
+				"remote.origin.url": "ssh://git@git-server.com/me/repo.git",
+				"credential.https://lfs-server.com/work.username": "work-user",
+				"credential.https://lfs-server.com/me.username":   "my-user",
+			},
+			Method:   "GET",
+			Href:     "https://lfs-server.com/objects/foo",
+			Protocol: "https",
+			Host:     "lfs-server.com",
+			Username: "my-user",
+			Password: "monkey",
+		},
+		{
+			Desc:          "username for request url",
+			CurrentRemote: "origin",
+			Config: map[string]string{
+				"lfs.url":           "https://git-server.com",
+				"remote.origin.url": "https://git-server.com/other/repo.git",
+				"credential.https://git-server.com/work.username": "work-user",
+				"credential.https://storage.com/bucket.username":  "bucket-user",
+			},
+			Method:   "GET",
+			Href:     "https://storage.com/bucket/foo",
+			Protocol: "https",
+			Host:     "storage.com",
+			Path:     "bucket/foo",
+			Username: "bucket-user",
+			Password: "monkey",
+		},
 		{
 			Desc:     "?token query",
 			Config:   map[string]string{"lfs.url": "https://git-server.com"},
@@ -116,6 +165,73 @@ func TestGetCredentialsForApi(t *testing.T) {
 	})
 }
 
+func TestGetCredentialsCachesFilledCredentials(t *testing.T) {
+	calls := make(map[string]int)
+	defer SetCredentialsFunc(SetCredentialsFunc(func(cfg *config.Configuration, input Creds, subCommand string) (Creds, error) {
+		calls[subCommand]++
+		return TestCredentialsFunc(cfg, input, subCommand)
+	}))
+
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{"lfs.url": "https://git-server.com"},
+	})
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "https://git-server.com/foo", nil)
+		creds, err := GetCreds(cfg, req)
+		if err != nil {
+			t.Fatalf("GetCreds: %s", err)
+		}
+		if req.Header.Get("Authorization") == "" {
+			t.Errorf("expected an Authorization header for request %d", i)
+		}
+		SaveCredentials(cfg, creds, &http.Response{StatusCode: 200})
+	}
+
+	if calls["fill"] != 1 || calls["approve"] != 1 {
+		t.Errorf("expected 1 fill and 1 approve, got %v", calls)
+	}
+
+	req, _ := http.NewRequest("GET", "https://git-server.com/foo", nil)
+	creds, _ := GetCreds(cfg, req)
+	SaveCredentials(cfg, creds, &http.Response{StatusCode: 401})
+
+	req, _ = http.NewRequest("GET", "https://git-server.com/foo", nil)
+	GetCreds(cfg, req)
+
+	if calls["reject"] != 1 || calls["fill"] != 2 {
+		t.Errorf("expected rejected credentials to be filled again, got %v", calls)
+	}
+}
+
+func TestGetCredentialsWithoutCache(t *testing.T) {
+	calls := make(map[string]int)
+	defer SetCredentialsFunc(SetCredentialsFunc(func(cfg *config.Configuration, input Creds, subCommand string) (Creds, error) {
+		calls[subCommand]++
+		return TestCredentialsFunc(cfg, input, subCommand)
+	}))
+
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.url":              "https://git-server.com",
+			"lfs.cachecredentials": "false",
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "https://git-server.com/foo", nil)
+		creds, err := GetCreds(cfg, req)
+		if err != nil {
+			t.Fatalf("GetCreds: %s", err)
+		}
+		SaveCredentials(cfg, creds, &http.Response{StatusCode: 200})
+	}
+
+	if calls["fill"] != 3 || calls["approve"] != 3 {
+		t.Errorf("expected 3 fills and 3 approves, got %v", calls)
+	}
+}
+
 type fakeNetrc struct{}
 
 func (n *fakeNetrc) FindMachine(host string) *netrc.Machine {
@@ -4,9 +4,15 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"github.com/git-lfs/git-lfs/config"
 	"github.com/rubyist/tracerx"
@@ -17,95 +23,282 @@ type SshAuthResponse struct {
 	Href      string            `json:"href"`
 	Header    map[string]string `json:"header"`
 	ExpiresAt string            `json:"expires_at"`
+	ExpiresIn int               `json:"expires_in"`
+
+	// receivedAt is the time at which the response was received, from
+	// which ExpiresIn is counted.
+	receivedAt time.Time
 }
 
+// sshAuthExpiryMargin is how long before a response expires that it stops being
+// reused, so that it is still valid for the requests it is used for.
+const sshAuthExpiryMargin = 5 * time.Second
+
+// expired returns whether the response expires before the given time. Responses
+// without an expiry never do.
+func (r *SshAuthResponse) expired(at time.Time) bool {
+	if len(r.ExpiresAt) > 0 {
+		if expiresAt, err := time.Parse(time.RFC3339, r.ExpiresAt); err == nil && expiresAt.Before(at) {
+			return true
+		}
+	}
+	if r.ExpiresIn > 0 {
+		return r.receivedAt.Add(time.Duration(r.ExpiresIn) * time.Second).Before(at)
+	}
+	return false
+}
+
+var (
+	// sshAuthCache holds the responses of successful git-lfs-authenticate
+	// commands, so that they're reused until they expire instead of running
+	// ssh for every request.
+	sshAuthCache = make(map[string]SshAuthResponse)
+	sshAuthMu    sync.Mutex
+)
+
 func SshAuthenticate(cfg *config.Configuration, operation, oid string) (SshAuthResponse, config.Endpoint, error) {
+	return SshAuthenticateEndpoint(cfg, cfg.Endpoint(operation), operation, oid)
+}
+
+// SshAuthenticateEndpoint is like SshAuthenticate, but authenticates with the
+// given endpoint rather than the one configured for the operation.
+func SshAuthenticateEndpoint(cfg *config.Configuration, endpoint config.Endpoint, operation, oid string) (SshAuthResponse, config.Endpoint, error) {
 	// This is only used as a fallback where the Git URL is SSH but server doesn't support a full SSH binary protocol
 	// and therefore we derive a HTTPS endpoint for binaries instead; but check authentication here via SSH
 
-	endpoint := cfg.Endpoint(operation)
 	res := SshAuthResponse{}
-	if len(endpoint.SshUserAndHost) == 0 {
+	if len(endpoint.SshUserAndHost) == 0 || endpoint.IsRsync() {
 		return res, endpoint, nil
 	}
 
-	tracerx.Printf("ssh: %s git-lfs-authenticate %s %s %s",
-		endpoint.SshUserAndHost, endpoint.SshPath, operation, oid)
-
 	exe, args := sshGetExeAndArgs(cfg, endpoint)
 	args = append(args,
 		fmt.Sprintf("git-lfs-authenticate %s %s %s", endpoint.SshPath, operation, oid))
 
+	key := strings.Join(append([]string{exe}, args...), "\x00")
+
+	sshAuthMu.Lock()
+	cached, ok := sshAuthCache[key]
+	sshAuthMu.Unlock()
+	if ok && !cached.expired(time.Now().Add(sshAuthExpiryMargin)) {
+		tracerx.Printf("ssh: reusing git-lfs-authenticate response for %s %s %s %s",
+			endpoint.SshUserAndHost, endpoint.SshPath, operation, oid)
+		return cached, endpoint, nil
+	}
+
+	tracerx.Printf("ssh: %s git-lfs-authenticate %s %s %s",
+		endpoint.SshUserAndHost, endpoint.SshPath, operation, oid)
+
 	cmd := exec.Command(exe, args...)
 
-	// Save stdout and stderr in separate buffers
-	var outbuf, errbuf bytes.Buffer
+	// Save stdout and stderr separately. stderr goes to a file rather than
+	// a pipe, since a connection master started by the command to be
+	// shared with later ones may keep it open after the command exits,
+	// and Wait would wait for it to be closed.
+	errfile, err := ioutil.TempFile("", "git-lfs-ssh")
+	if err != nil {
+		return res, endpoint, err
+	}
+	defer os.Remove(errfile.Name())
+	defer errfile.Close()
+
+	var outbuf bytes.Buffer
 	cmd.Stdout = &outbuf
-	cmd.Stderr = &errbuf
+	cmd.Stderr = errfile
 
 	// Execute command
-	err := cmd.Start()
+	err = cmd.Start()
 	if err == nil {
 		err = cmd.Wait()
 	}
 
 	// Processing result
 	if err != nil {
-		res.Message = strings.TrimSpace(errbuf.String())
+		errbuf, _ := ioutil.ReadFile(errfile.Name())
+		res.Message = strings.TrimSpace(string(errbuf))
 	} else {
 		err = json.Unmarshal(outbuf.Bytes(), &res)
 	}
 
+	if err == nil {
+		res.receivedAt = time.Now()
+		sshAuthMu.Lock()
+		sshAuthCache[key] = res
+		sshAuthMu.Unlock()
+	}
+
 	return res, endpoint, err
 }
 
-// Return the executable name for ssh on this machine and the base args
-// Base args includes port settings, user/host, everything pre the command to execute
-func sshGetExeAndArgs(cfg *config.Configuration, endpoint config.Endpoint) (exe string, baseargs []string) {
-	if len(endpoint.SshUserAndHost) == 0 {
-		return "", nil
+// sshVariant returns the kind of ssh command being run, which determines the
+// arguments it is given: "ssh" for OpenSSH, "plink" or "putty" for PuTTY's
+// plink, "tortoiseplink" for TortoisePlink, or "simple" for a command which
+// only takes the host. It is given by GIT_SSH_VARIANT, the current remote's
+// lfssshvariant, or ssh.variant, and otherwise guessed from the command's name,
+// in which case it is empty for commands other than those above.
+func sshVariant(cfg *config.Configuration, ssh string) string {
+	variant, ok := cfg.Os.Get("GIT_SSH_VARIANT")
+	if !ok && len(cfg.CurrentRemote) > 0 {
+		variant, ok = cfg.Git.Get("remote." + cfg.CurrentRemote + ".lfssshvariant")
+	}
+	if !ok {
+		variant, ok = cfg.Git.Get("ssh.variant")
+	}
+
+	variant = strings.ToLower(variant)
+	if ok && variant != "auto" {
+		return variant
 	}
 
-	isPlink := false
-	isTortoise := false
+	basessh := filepath.Base(ssh)
+	// Strip extension for easier comparison
+	if ext := filepath.Ext(basessh); len(ext) > 0 {
+		basessh = basessh[:len(basessh)-len(ext)]
+	}
+
+	for _, known := range []string{"ssh", "plink", "tortoiseplink"} {
+		if strings.EqualFold(basessh, known) {
+			return known
+		}
+	}
+	return ""
+}
 
-	ssh, _ := cfg.Os.Get("GIT_SSH")
+// sshCommand returns the ssh command to run and its arguments. The command is
+// given by GIT_SSH_COMMAND, the current remote's lfssshcommand, core.sshCommand
+// or GIT_SSH, in that order, or is "ssh". All but GIT_SSH may include
+// arguments, such as the identity file of a deploy key, which may be quoted.
+func sshCommand(cfg *config.Configuration) (string, []string) {
 	sshCmd, _ := cfg.Os.Get("GIT_SSH_COMMAND")
-	cmdArgs := strings.Fields(sshCmd)
-	if len(cmdArgs) > 0 {
-		ssh = cmdArgs[0]
-		cmdArgs = cmdArgs[1:]
+	if len(sshCmd) == 0 && len(cfg.CurrentRemote) > 0 {
+		sshCmd, _ = cfg.Git.Get("remote." + cfg.CurrentRemote + ".lfssshcommand")
+	}
+	if len(sshCmd) == 0 {
+		sshCmd, _ = cfg.Git.Get("core.sshcommand")
 	}
 
-	if ssh == "" {
-		ssh = "ssh"
-	} else {
-		basessh := filepath.Base(ssh)
-		// Strip extension for easier comparison
-		if ext := filepath.Ext(basessh); len(ext) > 0 {
-			basessh = basessh[:len(basessh)-len(ext)]
+	if cmdArgs := splitSshCommand(sshCmd); len(cmdArgs) > 0 {
+		return cmdArgs[0], cmdArgs[1:]
+	}
+
+	if ssh, _ := cfg.Os.Get("GIT_SSH"); len(ssh) > 0 {
+		return ssh, nil
+	}
+	return "ssh", nil
+}
+
+// splitSshCommand splits a command into its arguments at whitespace, except
+// within single or double quotes, which are removed. Within double quotes, or
+// outside of quotes, a backslash escapes the next character.
+func splitSshCommand(command string) []string {
+	var args []string
+	var arg []rune
+	var inArg bool
+	var quote rune
+	var escaped bool
+
+	for _, r := range command {
+		switch {
+		case escaped:
+			arg = append(arg, r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg = append(arg, r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, string(arg))
+				arg = arg[:0]
+				inArg = false
+			}
+		default:
+			arg = append(arg, r)
+			inArg = true
 		}
-		isPlink = strings.EqualFold(basessh, "plink")
-		isTortoise = strings.EqualFold(basessh, "tortoiseplink")
 	}
 
+	if inArg {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+// sshMultiplexArgs returns the arguments which make OpenSSH share a connection
+// to each host between git-lfs-authenticate commands, which is kept open for a
+// minute after the last of them, or nil unless lfs.ssh.automultiplex is true
+// and multiplexing is supported.
+func sshMultiplexArgs(cfg *config.Configuration) []string {
+	if runtime.GOOS == "windows" || !cfg.Git.Bool("lfs.ssh.automultiplex", false) {
+		return nil
+	}
+
+	// the sockets are kept in a directory only the user can access, which
+	// is short enough for the length limit on socket paths.
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("git-lfs-%d", os.Getuid()))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		tracerx.Printf("ssh: unable to multiplex connections: %s", err)
+		return nil
+	}
+
+	return []string{
+		"-oControlMaster=auto",
+		"-oControlPath=" + filepath.Join(dir, "ssh-%C"),
+		"-oControlPersist=60s",
+	}
+}
+
+// SshTransportCommand returns the ssh executable and the arguments to connect
+// to the given endpoint's host with, but without the host itself, for programs
+// such as rsync which run ssh themselves, appending the host and command.
+func SshTransportCommand(cfg *config.Configuration, endpoint config.Endpoint) (exe string, args []string) {
+	exe, args = sshGetExeAndArgs(cfg, endpoint)
+	if len(args) > 0 {
+		args = args[:len(args)-1]
+	}
+	return exe, args
+}
+
+// Return the executable name for ssh on this machine and the base args
+// Base args includes port settings, user/host, everything pre the command to execute
+func sshGetExeAndArgs(cfg *config.Configuration, endpoint config.Endpoint) (exe string, baseargs []string) {
+	if len(endpoint.SshUserAndHost) == 0 {
+		return "", nil
+	}
+
+	ssh, cmdArgs := sshCommand(cfg)
+	variant := sshVariant(cfg, ssh)
+
 	args := make([]string, 0, 4+len(cmdArgs))
 	if len(cmdArgs) > 0 {
 		args = append(args, cmdArgs...)
 	}
 
-	if isTortoise {
+	switch variant {
+	case "ssh":
+		args = append(args, sshMultiplexArgs(cfg)...)
+	case "tortoiseplink":
 		// TortoisePlink requires the -batch argument to behave like ssh/plink
 		args = append(args, "-batch")
 	}
 
 	if len(endpoint.SshPort) > 0 {
-		if isPlink || isTortoise {
-			args = append(args, "-P")
-		} else {
-			args = append(args, "-p")
+		switch variant {
+		case "plink", "putty", "tortoiseplink":
+			args = append(args, "-P", endpoint.SshPort)
+		case "simple":
+			tracerx.Printf("ssh: %s doesn't support setting the port, ignoring %s", ssh, endpoint.SshPort)
+		default:
+			args = append(args, "-p", endpoint.SshPort)
 		}
-		args = append(args, endpoint.SshPort)
 	}
 	args = append(args, endpoint.SshUserAndHost)
 
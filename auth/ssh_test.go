@@ -1,8 +1,12 @@
 package auth
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/git-lfs/git-lfs/config"
 	"github.com/stretchr/testify/assert"
@@ -14,6 +18,9 @@ func TestSSHGetExeAndArgsSsh(t *testing.T) {
 			"GIT_SSH_COMMAND": "",
 			"GIT_SSH":         "",
 		},
+		Git: map[string]string{
+			"lfs.ssh.automultiplex": "false",
+		},
 	})
 
 	endpoint := cfg.Endpoint("download")
@@ -30,6 +37,9 @@ func TestSSHGetExeAndArgsSshCustomPort(t *testing.T) {
 			"GIT_SSH_COMMAND": "",
 			"GIT_SSH":         "",
 		},
+		Git: map[string]string{
+			"lfs.ssh.automultiplex": "false",
+		},
 	})
 
 	endpoint := cfg.Endpoint("download")
@@ -231,3 +241,212 @@ func TestSSHGetExeAndArgsTortoisePlinkCommandCustomPort(t *testing.T) {
 	assert.Equal(t, plink, exe)
 	assert.Equal(t, []string{"-batch", "-P", "8888", "user@foo.com"}, args)
 }
+
+func TestSSHGetExeAndArgsSshMultiplex(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ssh connections aren't multiplexed on windows")
+	}
+
+	cfg := config.NewFrom(config.Values{
+		Os: map[string]string{
+			"GIT_SSH_COMMAND": "",
+			"GIT_SSH":         "",
+		},
+		Git: map[string]string{
+			"lfs.ssh.automultiplex": "true",
+		},
+	})
+
+	endpoint := cfg.Endpoint("download")
+	endpoint.SshUserAndHost = "user@foo.com"
+	endpoint.SshPort = "8888"
+
+	exe, args := sshGetExeAndArgs(cfg, endpoint)
+	assert.Equal(t, "ssh", exe)
+	if assert.Len(t, args, 6) {
+		assert.Equal(t, "-oControlMaster=auto", args[0])
+		assert.Contains(t, args[1], "-oControlPath=")
+		assert.Equal(t, "-oControlPersist=60s", args[2])
+		assert.Equal(t, []string{"-p", "8888", "user@foo.com"}, args[3:])
+	}
+}
+
+func TestSSHGetExeAndArgsSshNoMultiplexByDefault(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Os: map[string]string{
+			"GIT_SSH_COMMAND": "",
+			"GIT_SSH":         "",
+		},
+	})
+
+	endpoint := cfg.Endpoint("download")
+	endpoint.SshUserAndHost = "user@foo.com"
+
+	_, args := sshGetExeAndArgs(cfg, endpoint)
+	assert.Equal(t, []string{"user@foo.com"}, args)
+}
+
+func TestSshAuthenticateDoesNotWaitForStderrOfBackgroundProcesses(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script as the ssh command")
+	}
+
+	dir, err := ioutil.TempDir("", "git-lfs-ssh-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// like a connection master kept open by ControlPersist, the
+	// background process keeps stderr open after the command exits.
+	ssh := filepath.Join(dir, "ssh")
+	assert.Nil(t, ioutil.WriteFile(ssh, []byte("#!/bin/sh\n"+
+		"sleep 5 < /dev/null > /dev/null &\n"+
+		"echo '{\"href\": \"https://foo.com/lfs\"}'\n"), 0755))
+
+	cfg := config.NewFrom(config.Values{
+		Os: map[string]string{
+			"GIT_SSH_COMMAND": "",
+			"GIT_SSH":         ssh,
+		},
+	})
+
+	endpoint := cfg.Endpoint("download")
+	endpoint.SshUserAndHost = "user@stderr.example.com"
+
+	start := time.Now()
+	res, _, err := SshAuthenticateEndpoint(cfg, endpoint, "download", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://foo.com/lfs", res.Href)
+	assert.True(t, time.Since(start) < 4*time.Second, "waited for the background process")
+}
+
+func TestSSHGetExeAndArgsCoreSshCommand(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Os: map[string]string{
+			"GIT_SSH_COMMAND": "",
+			"GIT_SSH":         "bad",
+		},
+		Git: map[string]string{
+			"core.sshcommand":       `ssh -i "/home/joe bloggs/.ssh/deploy key" -o 'IdentitiesOnly yes'`,
+			"lfs.ssh.automultiplex": "false",
+		},
+	})
+
+	endpoint := cfg.Endpoint("download")
+	endpoint.SshUserAndHost = "user@foo.com"
+	endpoint.SshPort = "8888"
+
+	exe, args := sshGetExeAndArgs(cfg, endpoint)
+	assert.Equal(t, "ssh", exe)
+	assert.Equal(t, []string{"-i", "/home/joe bloggs/.ssh/deploy key", "-o", "IdentitiesOnly yes", "-p", "8888", "user@foo.com"}, args)
+}
+
+func TestSSHGetExeAndArgsRemoteSshCommandPrecedence(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Os: map[string]string{
+			"GIT_SSH_COMMAND": "",
+			"GIT_SSH":         "bad",
+		},
+		Git: map[string]string{
+			"core.sshcommand":             "bad",
+			"remote.origin.lfssshcommand": "sshcmd -i key",
+		},
+	})
+
+	cfg.CurrentRemote = "origin"
+
+	endpoint := cfg.Endpoint("download")
+	endpoint.SshUserAndHost = "user@foo.com"
+
+	exe, args := sshGetExeAndArgs(cfg, endpoint)
+	assert.Equal(t, "sshcmd", exe)
+	assert.Equal(t, []string{"-i", "key", "user@foo.com"}, args)
+}
+
+func TestSSHGetExeAndArgsRemoteSshVariant(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Os: map[string]string{
+			"GIT_SSH_COMMAND": "",
+			"GIT_SSH":         "sshcmd",
+		},
+		Git: map[string]string{
+			"ssh.variant":                 "simple",
+			"remote.origin.lfssshvariant": "putty",
+		},
+	})
+
+	cfg.CurrentRemote = "origin"
+
+	endpoint := cfg.Endpoint("download")
+	endpoint.SshUserAndHost = "user@foo.com"
+	endpoint.SshPort = "8888"
+
+	exe, args := sshGetExeAndArgs(cfg, endpoint)
+	assert.Equal(t, "sshcmd", exe)
+	assert.Equal(t, []string{"-P", "8888", "user@foo.com"}, args)
+}
+
+func TestSSHGetExeAndArgsSimpleVariant(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Os: map[string]string{
+			"GIT_SSH_COMMAND": "",
+			"GIT_SSH":         "ssh",
+		},
+		Git: map[string]string{
+			"ssh.variant": "simple",
+		},
+	})
+
+	endpoint := cfg.Endpoint("download")
+	endpoint.SshUserAndHost = "user@foo.com"
+	endpoint.SshPort = "8888"
+
+	exe, args := sshGetExeAndArgs(cfg, endpoint)
+	assert.Equal(t, "ssh", exe)
+	assert.Equal(t, []string{"user@foo.com"}, args)
+}
+
+func TestSSHGetExeAndArgsSshVariantEnvPrecedence(t *testing.T) {
+	plink := filepath.Join("Users", "joebloggs", "bin", "plink")
+
+	cfg := config.NewFrom(config.Values{
+		Os: map[string]string{
+			"GIT_SSH_COMMAND": "",
+			"GIT_SSH":         plink,
+			"GIT_SSH_VARIANT": "tortoiseplink",
+		},
+		Git: map[string]string{
+			"ssh.variant": "simple",
+		},
+	})
+
+	endpoint := cfg.Endpoint("download")
+	endpoint.SshUserAndHost = "user@foo.com"
+	endpoint.SshPort = "8888"
+
+	exe, args := sshGetExeAndArgs(cfg, endpoint)
+	assert.Equal(t, plink, exe)
+	assert.Equal(t, []string{"-batch", "-P", "8888", "user@foo.com"}, args)
+}
+
+func TestSplitSshCommand(t *testing.T) {
+	for command, expected := range map[string][]string{
+		"":                         nil,
+		"ssh":                      {"ssh"},
+		"  ssh  -v ":               {"ssh", "-v"},
+		`ssh -i "a b" -o 'c "d"'`:  {"ssh", "-i", "a b", "-o", `c "d"`},
+		`ssh -i a\ b ""`:           {"ssh", "-i", "a b", ""},
+		`"C:\\Program Files\\ssh"`: {`C:\Program Files\ssh`},
+	} {
+		assert.Equal(t, expected, splitSshCommand(command), "command: %q", command)
+	}
+}
+
+func TestSSHAuthResponseExpired(t *testing.T) {
+	now := time.Now()
+
+	assert.False(t, (&SshAuthResponse{}).expired(now))
+	assert.False(t, (&SshAuthResponse{ExpiresIn: 60, receivedAt: now}).expired(now.Add(time.Minute-time.Second)))
+	assert.True(t, (&SshAuthResponse{ExpiresIn: 60, receivedAt: now}).expired(now.Add(time.Minute+time.Second)))
+	assert.False(t, (&SshAuthResponse{ExpiresAt: now.Add(time.Hour).Format(time.RFC3339)}).expired(now))
+	assert.True(t, (&SshAuthResponse{ExpiresAt: now.Add(-time.Hour).Format(time.RFC3339)}).expired(now))
+}
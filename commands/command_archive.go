@@ -0,0 +1,257 @@
+package commands
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/filepathfilter"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/spf13/cobra"
+)
+
+var (
+	archiveFormatArg string
+	archiveOutputArg string
+	archivePrefixArg string
+)
+
+// archiveCommand writes an archive of a tree, like 'git archive', in which the
+// files tracked by Git LFS contain their objects' contents instead of
+// pointers. Objects which aren't local are downloaded first.
+func archiveCommand(cmd *cobra.Command, args []string) error {
+	if err := requireGitVersion(); err != nil {
+		return err
+	}
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return errorf("Usage: git lfs archive [--format=<fmt>] [-o <file>] [--prefix=<prefix>] <tree-ish> [<path>...]")
+	}
+
+	format := archiveFormat()
+	if format != "tar" && format != "tgz" && format != "zip" {
+		return errorf("archive: unknown format %q; expected tar, tgz or zip", format)
+	}
+
+	paths, err := rootedPaths(args[1:])
+	if err != nil {
+		return err
+	}
+	filter := filepathfilter.New(paths, nil)
+
+	pointers, err := pointersToFetchForRef(args[0], filter)
+	if err != nil {
+		return errorf("archive: could not scan %s for Git LFS files: %s", args[0], err)
+	}
+	ok, err := fetchAndReportToChan(pointers, filter, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errorf("archive: could not download every Git LFS object in %s", args[0])
+	}
+
+	byName := make(map[string]*lfs.WrappedPointer, len(pointers))
+	for _, p := range pointers {
+		byName[archivePrefixArg+p.Name] = p
+	}
+
+	out := io.Writer(os.Stdout)
+	if len(archiveOutputArg) > 0 {
+		f, err := os.Create(archiveOutputArg)
+		if err != nil {
+			return errorf("archive: %s", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	// the smudge filter is disabled so that git archive writes pointers,
+	// which are then replaced here.
+	gitArgs := []string{
+		"-c", "filter.lfs.smudge=", "-c", "filter.lfs.process=", "-c", "filter.lfs.required=false",
+		"archive", "--format=tar", "--prefix=" + archivePrefixArg, args[0], "--",
+	}
+	gitArchive := subprocess.ExecCommand("git", append(gitArgs, paths...)...)
+	gitArchive.Dir = config.LocalWorkingDir
+	gitArchive.Stderr = os.Stderr
+	stdout, err := gitArchive.StdoutPipe()
+	if err != nil {
+		return errorf("archive: %s", err)
+	}
+	if err := gitArchive.Start(); err != nil {
+		return errorf("archive: %s", err)
+	}
+
+	switch format {
+	case "tar":
+		err = rewriteTar(tar.NewWriter(out), stdout, byName)
+	case "tgz":
+		gz := gzip.NewWriter(out)
+		err = rewriteTar(tar.NewWriter(gz), stdout, byName)
+		if cerr := gz.Close(); err == nil {
+			err = cerr
+		}
+	case "zip":
+		err = tarToZip(zip.NewWriter(out), stdout, byName)
+	}
+
+	if err != nil {
+		// nothing will read the rest of the archive, which git
+		// archive would block writing.
+		gitArchive.Process.Kill()
+	} else {
+		// the end of the tar stream may be followed by padding.
+		_, err = io.Copy(ioutil.Discard, stdout)
+	}
+	if werr := gitArchive.Wait(); err == nil {
+		err = werr
+	}
+	if err != nil {
+		return errorf("archive: %s", err)
+	}
+
+	return nil
+}
+
+// archiveFormat returns the format given by --format, or guessed from the
+// extension of the output file as git archive does, or "tar".
+func archiveFormat() string {
+	if len(archiveFormatArg) > 0 {
+		if archiveFormatArg == "tar.gz" {
+			return "tgz"
+		}
+		return archiveFormatArg
+	}
+
+	switch {
+	case strings.HasSuffix(archiveOutputArg, ".zip"):
+		return "zip"
+	case strings.HasSuffix(archiveOutputArg, ".tar.gz"), strings.HasSuffix(archiveOutputArg, ".tgz"):
+		return "tgz"
+	}
+	return "tar"
+}
+
+// archiveEntry returns the contents of the given tar entry, replacing it with
+// the contents of its Git LFS object if it is one of the given pointers, along
+// with its size.
+func archiveEntry(hdr *tar.Header, r io.Reader, pointers map[string]*lfs.WrappedPointer) (io.ReadCloser, int64, error) {
+	p, ok := pointers[hdr.Name]
+	if !ok || hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+		return noopCloser{r}, hdr.Size, nil
+	}
+
+	f, err := lfs.OpenLocalObject(p.Oid)
+	if err != nil {
+		return nil, 0, err
+	}
+	return f, p.Size, nil
+}
+
+// rewriteTar copies the tar archive in r to tw, replacing pointers with the
+// contents of their objects.
+func rewriteTar(tw *tar.Writer, r io.Reader, pointers map[string]*lfs.WrappedPointer) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		contents, size, err := archiveEntry(hdr, tr, pointers)
+		if err != nil {
+			return err
+		}
+
+		hdr.Size = size
+		if err := tw.WriteHeader(hdr); err != nil {
+			contents.Close()
+			return err
+		}
+		_, err = io.Copy(tw, contents)
+		contents.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// tarToZip writes the tar archive in r to zw as a zip archive, replacing
+// pointers with the contents of their objects.
+func tarToZip(zw *zip.Writer, r io.Reader, pointers map[string]*lfs.WrappedPointer) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		var contents io.ReadCloser
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			if contents, hdr.Size, err = archiveEntry(hdr, tr, pointers); err != nil {
+				return err
+			}
+		case tar.TypeDir:
+		case tar.TypeSymlink:
+			contents = noopCloser{strings.NewReader(hdr.Linkname)}
+		default:
+			// e.g. the pax header git archive writes with the
+			// commit's SHA-1.
+			continue
+		}
+
+		zh, err := zip.FileInfoHeader(hdr.FileInfo())
+		if err != nil {
+			return err
+		}
+		zh.Name = hdr.Name
+		if hdr.Typeflag == tar.TypeDir {
+			zh.Name = strings.TrimSuffix(zh.Name, "/") + "/"
+		} else {
+			zh.Method = zip.Deflate
+		}
+
+		w, err := zw.CreateHeader(zh)
+		if err != nil {
+			return err
+		}
+		if contents != nil {
+			_, err = io.Copy(w, contents)
+			contents.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+type noopCloser struct {
+	io.Reader
+}
+
+func (noopCloser) Close() error { return nil }
+
+func init() {
+	RegisterCommand("archive", archiveCommand, func(cmd *cobra.Command) {
+		cmd.Flags().StringVar(&archiveFormatArg, "format", "", "The format of the archive: tar, tgz or zip")
+		cmd.Flags().StringVarP(&archiveOutputArg, "output", "o", "", "Write the archive to this file instead of stdout")
+		cmd.Flags().StringVar(&archivePrefixArg, "prefix", "", "Prepend this to the path of each file in the archive")
+	})
+}
@@ -0,0 +1,192 @@
+package commands
+
+import (
+	"sort"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/tq"
+	"github.com/rubyist/tracerx"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditAbove       = "1m"
+	auditSkipRemotes bool
+)
+
+// auditCommand scans the history reachable from the given refs, or from every
+// ref, for files which should be stored with Git LFS but aren't, pointers which
+// don't decode, and pointers whose objects no remote has, and reports how to
+// fix each.
+func auditCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	above, err := config.ParseSize(auditAbove)
+	if err != nil {
+		return errorf("Invalid size for --above: %s", err)
+	}
+
+	var large, malformed []*lfs.HistoryBlob
+	var pointers []*lfs.WrappedPointer
+	err = lfs.ScanHistoryBlobs(args, func(b *lfs.HistoryBlob) {
+		switch {
+		case b.Pointer != nil:
+			pointers = append(pointers, &lfs.WrappedPointer{Sha1: b.Sha1, Name: b.Name, Pointer: b.Pointer})
+		case b.PointerErr != nil:
+			malformed = append(malformed, b)
+		case b.Size >= above:
+			large = append(large, b)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	var missing []*lfs.WrappedPointer
+	if !auditSkipRemotes {
+		if missing, err = auditMissingObjects(pointers); err != nil {
+			return err
+		}
+	}
+
+	if len(large)+len(malformed)+len(missing) == 0 {
+		Print("Git LFS audit OK")
+		return nil
+	}
+
+	if len(large) > 0 {
+		sort.Sort(auditBlobsBySize(large))
+
+		Print("Large files not stored with Git LFS:\n")
+		for _, b := range large {
+			Print("\t%s (%s, blob %s)", b.Name, humanizeBytes(b.Size), b.Sha1[:7])
+		}
+		Print("\nConvert them to pointers with `git lfs migrate import --include=<path>`, which rewrites history.\n")
+	}
+
+	if len(malformed) > 0 {
+		Print("Malformed Git LFS pointers:\n")
+		for _, b := range malformed {
+			Print("\t%s (blob %s): %s", b.Name, b.Sha1[:7], b.PointerErr)
+		}
+		Print("\nThese are checked out as they are; fix them by committing the files' contents again.\n")
+	}
+
+	if len(missing) > 0 {
+		Print("Git LFS objects missing from every remote:\n")
+		for _, p := range missing {
+			if lfs.ObjectExistsOfSize(p.Oid, p.Size) {
+				Print("\t%s (%s), present locally", p.Name, p.Oid)
+			} else {
+				Print("\t%s (%s)", p.Name, p.Oid)
+			}
+		}
+		Print("\nPush those present locally with `git lfs push --object-id <remote> <oid>`; the others are lost unless another clone has them.\n")
+	}
+
+	Print("Git LFS audit: %d large file(s), %d malformed pointer(s), %d object(s) missing from every remote", len(large), len(malformed), len(missing))
+	return codeErrorf(1, "")
+}
+
+// auditMissingObjects asks the Git LFS server of each remote which of the
+// given pointers' objects it has, and returns the pointers whose objects none
+// of them has. A remote whose server can't be asked doesn't count; if none can,
+// no pointers are returned.
+func auditMissingObjects(pointers []*lfs.WrappedPointer) ([]*lfs.WrappedPointer, error) {
+	if len(pointers) == 0 {
+		return nil, nil
+	}
+
+	remotes, err := git.RemoteList()
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool)
+	checked := 0
+	for _, remote := range remotes {
+		cfg.CurrentRemote = remote
+
+		q := newDownloadCheckQueue()
+		watch := q.Watch()
+
+		var oids []string
+		done := make(chan struct{})
+		go func() {
+			for oid := range watch {
+				oids = append(oids, oid)
+			}
+			close(done)
+		}()
+
+		queued := make(map[string]bool, len(pointers))
+		for _, p := range pointers {
+			if found[p.Oid] || queued[p.Oid] {
+				continue
+			}
+			queued[p.Oid] = true
+			q.Add(downloadTransfer(p))
+		}
+		q.Wait()
+		<-done
+
+		// The server answers that it doesn't have an object with an
+		// error for it; any other error means it couldn't be asked.
+		var failed error
+		for _, err := range q.Errors() {
+			tracerx.Printf("audit: %s: %s", remote, err)
+			if terr, ok := err.(*tq.TransferError); !ok || terr.StatusCode != 404 {
+				failed = err
+			}
+		}
+		if failed != nil {
+			Error("Warning: could not check the objects on %s: %s", remote, failed)
+			continue
+		}
+
+		checked++
+		for _, oid := range oids {
+			found[oid] = true
+		}
+	}
+
+	if checked == 0 {
+		return nil, nil
+	}
+
+	var missing []*lfs.WrappedPointer
+	reported := make(map[string]bool)
+	for _, p := range pointers {
+		if found[p.Oid] || reported[p.Oid] {
+			continue
+		}
+		reported[p.Oid] = true
+		missing = append(missing, p)
+	}
+	sort.Sort(auditPointersByName(missing))
+	return missing, nil
+}
+
+// auditBlobsBySize sorts blobs from the largest to the smallest.
+type auditBlobsBySize []*lfs.HistoryBlob
+
+func (b auditBlobsBySize) Len() int           { return len(b) }
+func (b auditBlobsBySize) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b auditBlobsBySize) Less(i, j int) bool { return b[i].Size > b[j].Size }
+
+type auditPointersByName []*lfs.WrappedPointer
+
+func (p auditPointersByName) Len() int           { return len(p) }
+func (p auditPointersByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p auditPointersByName) Less(i, j int) bool { return p[i].Name < p[j].Name }
+
+func init() {
+	RegisterCommand("audit", auditCommand, func(cmd *cobra.Command) {
+		cmd.Flags().StringVar(&auditAbove, "above", auditAbove, "Report files not stored with Git LFS of at least this size")
+		cmd.Flags().BoolVar(&auditSkipRemotes, "skip-remotes", false, "Don't check which objects the remotes have")
+	})
+}
@@ -0,0 +1,133 @@
+package commands
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/spf13/cobra"
+)
+
+// blameObjectCommand reports, for each object given by its oid or a prefix of
+// it, who cleaned it as its pointers' provenance keys record, and the commits
+// which added it, so that the growth of a repository can be traced to them.
+func blameObjectCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return errorf("Usage: git lfs blame-object <oid>...")
+	}
+
+	// blobs holds the blobs of the pointers to each object given, keyed by
+	// its full oid.
+	blobs := make(map[string][]*lfs.HistoryBlob)
+	err := lfs.ScanHistoryBlobs(nil, func(b *lfs.HistoryBlob) {
+		if b.Pointer == nil {
+			return
+		}
+		for _, arg := range args {
+			if strings.HasPrefix(b.Pointer.Oid, strings.ToLower(arg)) {
+				blobs[b.Pointer.Oid] = append(blobs[b.Pointer.Oid], b)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	var oids []string
+	failed := false
+	for _, arg := range args {
+		var matched []string
+		for oid := range blobs {
+			if strings.HasPrefix(oid, strings.ToLower(arg)) {
+				matched = append(matched, oid)
+			}
+		}
+
+		switch len(matched) {
+		case 0:
+			Error("%s: no pointer to this object in any commit", arg)
+			failed = true
+		case 1:
+			oids = append(oids, matched[0])
+		default:
+			Error("%s: ambiguous, matches %d objects", arg, len(matched))
+			failed = true
+		}
+	}
+
+	wanted := make(map[string]bool)
+	for _, oid := range oids {
+		for _, b := range blobs[oid] {
+			wanted[b.Sha1] = true
+		}
+	}
+
+	commits, err := git.BlobCommits(wanted)
+	if err != nil {
+		return err
+	}
+
+	for i, oid := range oids {
+		if i > 0 {
+			Print("")
+		}
+		if err := blameObject(oid, blobs[oid], commits); err != nil {
+			return err
+		}
+	}
+
+	if failed {
+		return codeErrorf(1, "")
+	}
+
+	return nil
+}
+
+// blameObject prints the provenance of the object with the given oid, as its
+// pointers' blobs record it, and the commits among the given ones which set a
+// file to one of them, oldest first.
+func blameObject(oid string, blobs []*lfs.HistoryBlob, commits []*git.BlobCommit) error {
+	Print("Object %s (%s)", oid, humanizeBytes(blobs[0].Pointer.Size))
+
+	described := make(map[string]bool)
+	var provenances []string
+	shas := make(map[string]bool, len(blobs))
+	for _, b := range blobs {
+		shas[b.Sha1] = true
+		if p := b.Pointer.Provenance; len(p) > 0 && !described[p.String()] {
+			described[p.String()] = true
+			provenances = append(provenances, p.String())
+		}
+	}
+	sort.Strings(provenances)
+	for _, p := range provenances {
+		Print("\t%s", p)
+	}
+
+	verb := "introduced"
+	for _, c := range commits {
+		if !shas[c.Blob] {
+			continue
+		}
+
+		summary, err := git.GetCommitSummary(c.Sha)
+		if err != nil {
+			return err
+		}
+		Print("\t%s in %s by %s <%s> on %s: %s (%s)", verb, summary.ShortSha,
+			summary.AuthorName, summary.AuthorEmail,
+			summary.AuthorDate.Format("2006-01-02 15:04:05 -0700"),
+			c.Path, summary.Subject)
+		verb = "also added"
+	}
+	return nil
+}
+
+func init() {
+	RegisterCommand("blame-object", blameObjectCommand, nil)
+}
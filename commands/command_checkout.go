@@ -1,24 +1,57 @@
 package commands
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/errors"
 	"github.com/git-lfs/git-lfs/filepathfilter"
 	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/git/githistory"
 	"github.com/git-lfs/git-lfs/lfs"
-	"github.com/git-lfs/git-lfs/progress"
+	"github.com/git-lfs/git-lfs/subprocess"
 	"github.com/spf13/cobra"
 )
 
-func checkoutCommand(cmd *cobra.Command, args []string) {
-	requireInRepo()
+var (
+	checkoutTo     string
+	checkoutBase   bool
+	checkoutOurs   bool
+	checkoutTheirs bool
+	checkoutStdin  bool
+)
+
+func checkoutCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	if len(checkoutTo) > 0 || checkoutBase || checkoutOurs || checkoutTheirs {
+		return checkoutConflict(args)
+	}
+	if checkoutStdin {
+		if len(args) > 0 {
+			return errorf("checkout: --stdin can't be combined with paths")
+		}
+		return checkoutFromStdin(os.Stdin, os.Stdout)
+	}
+
 	ref, err := git.CurrentRef()
 	if err != nil {
-		Panic(err, "Could not checkout")
+		return loggedErrorf(err, "Could not checkout")
 	}
 
 	var totalBytes int64
-	meter := progress.NewMeter(progress.WithOSEnv(cfg.Os))
-	singleCheckout := newSingleCheckout()
-	chgitscanner := lfs.NewGitScanner(func(p *lfs.WrappedPointer, err error) {
+	meter := buildProgressMeter(false)
+	singleCheckout, err := newSingleCheckout()
+	if err != nil {
+		return err
+	}
+	chgitscanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
 		if err != nil {
 			LoggedError(err, "Scanner error")
 			return
@@ -36,34 +69,174 @@ func checkoutCommand(cmd *cobra.Command, args []string) {
 		meter.FinishTransfer(p.Name)
 	})
 
-	chgitscanner.Filter = filepathfilter.New(rootedPaths(args), nil)
+	paths, err := rootedPaths(args)
+	if err != nil {
+		return err
+	}
+
+	filter := filepathfilter.New(paths, nil)
+	chgitscanner.Filter = filter
 
 	if err := chgitscanner.ScanTree(ref.Sha); err != nil {
-		ExitWithError(err)
+		return err
 	}
 
 	meter.Start()
 	chgitscanner.Close()
 	meter.Finish()
 	singleCheckout.Close()
+
+	// Files which aren't pointers where Git LFS expects them can't be
+	// checked out, so say how to fix them.
+	warnDivergentIndexFiles(filter)
+
+	return singleCheckout.failures.err()
+}
+
+// checkoutFromStdin checks out the files whose paths are read from r, each
+// ending with a NUL byte, one at a time, writing what was done with each to w
+// as soon as it has been, as "<result> <path>" followed by a NUL byte. The
+// result is one of those of singleCheckout.Run(), or "untracked" if the path
+// isn't a Git LFS file in the current ref. This lets tools check out files as
+// they're needed, without running a command for each.
+func checkoutFromStdin(r io.Reader, w io.Writer) error {
+	ref, err := git.CurrentRef()
+	if err != nil {
+		return loggedErrorf(err, "Could not checkout")
+	}
+
+	pointers := make(map[string]*lfs.WrappedPointer)
+	gitscanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
+		if err != nil {
+			LoggedError(err, "Scanner error")
+			return
+		}
+		pointers[p.Name] = p
+	})
+	if err := gitscanner.ScanTree(ref.Sha); err != nil {
+		return err
+	}
+	gitscanner.Close()
+
+	pathConverter, err := lfs.NewCurrentToRepoPathConverter()
+	if err != nil {
+		return loggedErrorf(err, "Could not checkout")
+	}
+
+	singleCheckout, err := newSingleCheckout()
+	if err != nil {
+		return err
+	}
+	paths := bufio.NewReader(r)
+	for {
+		path, err := paths.ReadString(0)
+		if err != nil && err != io.EOF {
+			singleCheckout.Close()
+			return err
+		}
+		if path = strings.TrimSuffix(path, "\x00"); len(path) > 0 {
+			result := "untracked"
+			if p, ok := pointers[filepath.ToSlash(pathConverter.Convert(path))]; ok {
+				result = string(singleCheckout.Run(p))
+			}
+			fmt.Fprintf(w, "%s %s\x00", result, path)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	singleCheckout.Close()
+
+	return singleCheckout.failures.err()
+}
+
+// checkoutConflict writes the contents of one side of a file which is in
+// conflict to the path given by --to, so that it can be compared or merged with
+// other tools. The contents of Git LFS objects are written, downloading them if
+// necessary, rather than their pointers.
+func checkoutConflict(args []string) error {
+	stage := 0
+	for i, set := range []bool{checkoutBase, checkoutOurs, checkoutTheirs} {
+		if !set {
+			continue
+		}
+		if stage != 0 {
+			return errorf("checkout: only one of --base, --ours or --theirs may be given")
+		}
+		stage = i + 1
+	}
+
+	if stage == 0 || len(checkoutTo) == 0 || len(args) != 1 {
+		return errorf("Usage: git lfs checkout --to <path> {--base|--ours|--theirs} <conflicted file>")
+	}
+
+	paths, err := rootedPaths(args)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.ToSlash(paths[0])
+	oid, err := subprocess.SimpleExec("git", "rev-parse", "--verify", "-q", fmt.Sprintf(":%d:%s", stage, name))
+	if err != nil || len(oid) == 0 {
+		return errorf("checkout: %q has no %s version; is it in conflict?", args[0], conflictStageNames[stage])
+	}
+
+	return checkoutBlobTo(oid, checkoutTo)
+}
+
+// conflictStageNames are the names of the stages of a file in conflict in the
+// index, by number.
+var conflictStageNames = []string{"", "base", "ours", "theirs"}
+
+// checkoutBlobTo writes the contents of the given blob to path: the Git LFS
+// object it points to, or the blob itself if it isn't a pointer.
+func checkoutBlobTo(oid, path string) error {
+	p, err := decodeBlobPointer(oid)
+	if err == nil {
+		return lfs.PointerSmudgeToFile(path, p, true, TransferManifest(), nil)
+	} else if !errors.IsNotAPointerError(err) {
+		return err
+	}
+
+	blob, err := githistory.ReadBlob(oid)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, blob)
+	return err
 }
 
 // Parameters are filters
 // firstly convert any pathspecs to the root of the repo, in case this is being
 // executed in a sub-folder
-func rootedPaths(args []string) []string {
+func rootedPaths(args []string) ([]string, error) {
 	pathConverter, err := lfs.NewCurrentToRepoPathConverter()
 	if err != nil {
-		Panic(err, "Could not checkout")
+		return nil, loggedErrorf(err, "Could not checkout")
 	}
 
 	rootedpaths := make([]string, 0, len(args))
 	for _, arg := range args {
 		rootedpaths = append(rootedpaths, pathConverter.Convert(arg))
 	}
-	return rootedpaths
+	return rootedpaths, nil
 }
 
 func init() {
-	RegisterCommand("checkout", checkoutCommand, nil)
+	RegisterCommand("checkout", checkoutCommand, func(cmd *cobra.Command) {
+		cmd.Flags().StringVar(&checkoutTo, "to", "", "Write the given side of a conflicted file to this path")
+		cmd.Flags().BoolVar(&checkoutBase, "base", false, "Write the merge base of a conflicted file")
+		cmd.Flags().BoolVar(&checkoutOurs, "ours", false, "Write our side of a conflicted file")
+		cmd.Flags().BoolVar(&checkoutTheirs, "theirs", false, "Write their side of a conflicted file")
+		cmd.Flags().BoolVar(&checkoutStdin, "stdin", false, "Check out the NUL-delimited paths read from stdin, reporting each on stdout")
+		cmd.Flags().IntVarP(&jobsArg, "jobs", "j", 0, "Transfer this many objects at once, overriding lfs.concurrenttransfers")
+	})
 }
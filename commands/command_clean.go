@@ -6,15 +6,15 @@ import (
 
 	"github.com/git-lfs/git-lfs/errors"
 	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/localstorage"
 	"github.com/git-lfs/git-lfs/progress"
 	"github.com/spf13/cobra"
 )
 
 // clean cleans an object read from the given `io.Reader`, "from", and writes
 // out a corresponding pointer to the `io.Writer`, "to". If there were any
-// errors encountered along the way, they will be returned immediately if the
-// error is non-fatal, otherwise they will halt using the built in
-// `commands.Panic`.
+// errors encountered along the way, they are returned immediately; those which
+// should end the filter are `*exitCodeError`s.
 //
 // If the object read from "from" is _already_ a clean pointer, then it will be
 // written out verbatim to "to", without trying to make it a pointer again.
@@ -51,40 +51,61 @@ func clean(to io.Writer, from io.Reader, fileName string) error {
 		// If the contents read from the working directory was _already_
 		// a pointer, we'll get a `CleanPointerError`, with the context
 		// containing the bytes that we should write back out to Git.
+		// Pointers which had to be normalized to be read are written
+		// in their canonical form instead.
+		if ptr, ok := errors.GetContext(err, "pointer").(*lfs.Pointer); ok && ptr != nil && len(ptr.Normalized) > 0 {
+			_, err = ptr.Encode(to)
+			return err
+		}
 
 		_, err = to.Write(errors.GetContext(err, "bytes").([]byte))
 		return err
 	}
 
 	if err != nil {
-		Panic(err, "Error cleaning asset.")
+		return loggedErrorf(err, "Error cleaning asset.")
 	}
 
 	tmpfile := cleaned.Filename
 	mediafile, err := lfs.LocalMediaPath(cleaned.Oid)
 	if err != nil {
-		Panic(err, "Unable to get local media path.")
+		return loggedErrorf(err, "Unable to get local media path.")
 	}
 
 	if stat, _ := os.Stat(mediafile); stat != nil {
 		if stat.Size() != cleaned.Size && len(cleaned.Pointer.Extensions) == 0 {
-			Exit("Files don't match:\n%s\n%s", mediafile, tmpfile)
+			return errorf("Files don't match:\n%s\n%s", mediafile, tmpfile)
 		}
 		Debug("%s exists", mediafile)
+	} else if lfs.ObjectExistsOfSize(cleaned.Oid, cleaned.Size) {
+		Debug("%s exists as chunks or compressed", cleaned.Oid)
 	} else {
 		if err := os.Rename(tmpfile, mediafile); err != nil {
-			Panic(err, "Unable to move %s to %s\n", tmpfile, mediafile)
+			return loggedErrorf(err, "Unable to move %s to %s\n", tmpfile, mediafile)
+		}
+		if err := localstorage.ProtectObject(mediafile); err != nil {
+			return loggedErrorf(err, "Unable to make %s read-only\n", mediafile)
 		}
 
 		Debug("Writing %s", mediafile)
 	}
 
+	if cfg.ChunkStore() {
+		if err := lfs.MoveToChunkStore(cleaned.Oid); err != nil {
+			return loggedErrorf(err, "Unable to store %s as chunks\n", mediafile)
+		}
+	} else if err := localstorage.CompressObject(cfg, cleaned.Oid, fileName); err != nil && err != localstorage.ErrZstdNotFound {
+		Error("Unable to compress %s, storing it uncompressed: %v", fileName, err)
+	}
+
 	_, err = lfs.EncodePointer(to, cleaned.Pointer)
 	return err
 }
 
-func cleanCommand(cmd *cobra.Command, args []string) {
-	requireStdin("This command should be run by the Git 'clean' filter")
+func cleanCommand(cmd *cobra.Command, args []string) error {
+	if err := requireStdin("This command should be run by the Git 'clean' filter"); err != nil {
+		return err
+	}
 	lfs.InstallHooks(false)
 
 	var fileName string
@@ -93,8 +114,15 @@ func cleanCommand(cmd *cobra.Command, args []string) {
 	}
 
 	if err := clean(os.Stdout, os.Stdin, fileName); err != nil {
+		// the failures which used to end the filter exit with an
+		// error, while others are only reported.
+		if _, ok := err.(*exitCodeError); ok {
+			return err
+		}
 		Error(err.Error())
 	}
+
+	return nil
 }
 
 func init() {
@@ -9,6 +9,7 @@ import (
 	"github.com/git-lfs/git-lfs/localstorage"
 	"github.com/git-lfs/git-lfs/subprocess"
 
+	"github.com/git-lfs/git-lfs/config"
 	"github.com/git-lfs/git-lfs/git"
 	"github.com/git-lfs/git-lfs/tools"
 	"github.com/spf13/cobra"
@@ -18,19 +19,25 @@ var (
 	cloneFlags git.CloneFlags
 )
 
-func cloneCommand(cmd *cobra.Command, args []string) {
-	requireGitVersion()
+func cloneCommand(cmd *cobra.Command, args []string) error {
+	if err := requireGitVersion(); err != nil {
+		return err
+	}
+
+	// git clone is as quiet or verbose as Git LFS
+	cloneFlags.Quiet = isQuiet()
+	cloneFlags.Verbose = isVerbose()
 
 	// We pass all args to git clone
 	err := git.CloneWithoutFilters(cloneFlags, args)
 	if err != nil {
-		Exit("Error(s) during clone:\n%v", err)
+		return errorf("Error(s) during clone:\n%v", err)
 	}
 
 	// now execute pull (need to be inside dir)
 	cwd, err := os.Getwd()
 	if err != nil {
-		Exit("Unable to derive current working dir: %v", err)
+		return errorf("Unable to derive current working dir: %v", err)
 	}
 
 	// Either the last argument was a relative or local dir, or we have to
@@ -44,13 +51,20 @@ func cloneCommand(cmd *cobra.Command, args []string) {
 		}
 		clonedir, _ = filepath.Abs(base)
 		if !tools.DirExists(clonedir) {
-			Exit("Unable to find clone dir at %q", clonedir)
+			return errorf("Unable to find clone dir at %q", clonedir)
 		}
 	}
 
+	// The reference repository may be given relative to the current
+	// directory
+	reference := cloneFlags.Reference
+	if len(reference) > 0 {
+		reference, _ = filepath.Abs(reference)
+	}
+
 	err = os.Chdir(clonedir)
 	if err != nil {
-		Exit("Unable to change directory to clone dir %q: %v", clonedir, err)
+		return errorf("Unable to change directory to clone dir %q: %v", clonedir, err)
 	}
 
 	// Make sure we pop back to dir we started in at the end
@@ -58,28 +72,46 @@ func cloneCommand(cmd *cobra.Command, args []string) {
 
 	// Also need to derive dirs now
 	localstorage.ResolveDirs()
-	requireInRepo()
+	if err := requireInRepo(); err != nil {
+		return err
+	}
 
 	// Now just call pull with default args
-	// Support --origin option to clone
+	// Support --origin option to clone, and clone.defaultRemoteName, which
+	// git clone names the remote after otherwise
 	if len(cloneFlags.Origin) > 0 {
 		cfg.CurrentRemote = cloneFlags.Origin
+	} else if name := git.Config.Find("clone.defaultRemoteName"); len(name) > 0 {
+		cfg.CurrentRemote = name
 	} else {
 		cfg.CurrentRemote = "origin"
 	}
 
+	// Objects are taken from the reference repository before any are
+	// downloaded. With --dissociate, git clone has removed the alternates
+	// they'd be found by otherwise.
+	if len(reference) > 0 && len(config.LocalReferenceDir) == 0 {
+		config.LocalReferenceDir = config.ReferenceObjectDir(reference)
+	}
+
 	includeArg, excludeArg := getIncludeExcludeArgs(cmd)
 	filter := buildFilepathFilter(cfg, includeArg, excludeArg)
 	if cloneFlags.NoCheckout || cloneFlags.Bare {
 		// If --no-checkout or --bare then we shouldn't check out, just fetch instead
-		fetchRef("HEAD", filter)
+		if _, err := fetchRef("HEAD", filter); err != nil {
+			return err
+		}
 	} else {
-		pull(filter)
+		if err := pull(filter); err != nil {
+			return err
+		}
 		err := postCloneSubmodules(args)
 		if err != nil {
-			Exit("Error performing 'git lfs pull' for submodules: %v", err)
+			return errorf("Error performing 'git lfs pull' for submodules: %v", err)
 		}
 	}
+
+	return nil
 }
 
 func postCloneSubmodules(args []string) error {
@@ -114,7 +146,6 @@ func init() {
 		cmd.Flags().BoolVarP(&cloneFlags.Local, "local", "l", false, "See 'git clone --help'")
 		cmd.Flags().BoolVarP(&cloneFlags.Shared, "shared", "s", false, "See 'git clone --help'")
 		cmd.Flags().BoolVarP(&cloneFlags.NoHardlinks, "no-hardlinks", "", false, "See 'git clone --help'")
-		cmd.Flags().BoolVarP(&cloneFlags.Quiet, "quiet", "q", false, "See 'git clone --help'")
 		cmd.Flags().BoolVarP(&cloneFlags.NoCheckout, "no-checkout", "n", false, "See 'git clone --help'")
 		cmd.Flags().BoolVarP(&cloneFlags.Progress, "progress", "", false, "See 'git clone --help'")
 		cmd.Flags().BoolVarP(&cloneFlags.Bare, "bare", "", false, "See 'git clone --help'")
@@ -131,7 +162,6 @@ func init() {
 		cmd.Flags().StringVarP(&cloneFlags.Config, "config", "c", "", "See 'git clone --help'")
 		cmd.Flags().BoolVarP(&cloneFlags.SingleBranch, "single-branch", "", false, "See 'git clone --help'")
 		cmd.Flags().BoolVarP(&cloneFlags.NoSingleBranch, "no-single-branch", "", false, "See 'git clone --help'")
-		cmd.Flags().BoolVarP(&cloneFlags.Verbose, "verbose", "", false, "See 'git clone --help'")
 		cmd.Flags().BoolVarP(&cloneFlags.Ipv4, "ipv4", "", false, "See 'git clone --help'")
 		cmd.Flags().BoolVarP(&cloneFlags.Ipv6, "ipv6", "", false, "See 'git clone --help'")
 
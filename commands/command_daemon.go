@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	daemonSocketArg string
+)
+
+// daemonCommand answers the requests of editors and other tools on a local
+// socket, to check out files, downloading their objects on demand, to ask
+// whether objects are local, and to download objects ahead of time, until it's
+// interrupted.
+func daemonCommand(cmd *cobra.Command, args []string) error {
+	if err := requireGitVersion(); err != nil {
+		return err
+	}
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	if config.LocalWorkingDir == "" {
+		Print("This operation must be run in a work tree.")
+		return codeErrorf(128, "")
+	}
+
+	path := daemonSocketArg
+	if len(path) == 0 {
+		path = daemonSocketPath()
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	// A socket left behind by a daemon which didn't exit cleanly is
+	// replaced, but not one a running daemon answers on.
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return errorf("git lfs daemon is already running on %s", path)
+	}
+	os.Remove(path)
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return errorf("Cannot listen on %s: %s", path, err)
+	}
+
+	// The socket is created with the permissions the umask leaves, which
+	// would let other users on the machine check out files and download
+	// objects with this user's credentials, so it's made private to the
+	// user before any request is served.
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return errorf("Cannot restrict access to %s: %s", path, err)
+	}
+
+	// Requests name paths relative to the root of the working copy.
+	if err := os.Chdir(config.LocalWorkingDir); err != nil {
+		return err
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		l.Close()
+	}()
+
+	Print("Serving Git LFS requests on %s", path)
+	new(lfsDaemon).Serve(l)
+
+	return nil
+}
+
+// daemonSocketPath returns the path of the socket "git lfs daemon" listens on
+// by default.
+func daemonSocketPath() string {
+	return filepath.Join(config.LocalGitDir, "lfs", "daemon.sock")
+}
+
+func init() {
+	RegisterCommand("daemon", daemonCommand, func(cmd *cobra.Command) {
+		cmd.Flags().StringVarP(&daemonSocketArg, "socket", "s", "", "Listen on the given socket instead of .git/lfs/daemon.sock")
+	})
+}
@@ -0,0 +1,292 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffTextconv bool
+)
+
+// objectSummary describes a version of a file tracked by Git LFS for diffs.
+type objectSummary struct {
+	Oid  string
+	Size int64
+	// Details are the lines given by the inspectors for the file's
+	// contents, or nil if they aren't available locally.
+	Details []string
+}
+
+// diffInspector returns lines describing the contents of the given file, such
+// as the dimensions of an image, or nil if it doesn't know how to describe it.
+// The name is the file's path in the repository, which may be empty.
+type diffInspector func(name, path string) ([]string, error)
+
+// diffCommand summarises versions of files tracked by Git LFS for 'git diff',
+// instead of comparing their pointers. With --textconv it is run as a textconv
+// filter, given a single version of a file. Otherwise it is run as a diff
+// command, given both versions in the same arguments as GIT_EXTERNAL_DIFF.
+func diffCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	if diffTextconv {
+		if len(args) != 1 {
+			return errorf("Usage: git lfs diff --textconv <file>")
+		}
+
+		summary, err := summarizeObject(args[0], args[0])
+		if err != nil {
+			return err
+		}
+		printSummary(os.Stdout, "", summary)
+		return nil
+	}
+
+	// <path> <old-file> <old-hex> <old-mode> <new-file> <new-hex> <new-mode>,
+	// followed by the new path and rename details for renames.
+	if len(args) != 7 && len(args) != 9 {
+		return errorf("Usage: git lfs diff <path> <old-file> <old-hex> <old-mode> <new-file> <new-hex> <new-mode>")
+	}
+
+	oldName, newName := args[0], args[0]
+	if len(args) == 9 {
+		newName = args[7]
+	}
+
+	oldSummary, err := summarizeObject(oldName, args[1])
+	if err != nil {
+		return err
+	}
+	newSummary, err := summarizeObject(newName, args[4])
+	if err != nil {
+		return err
+	}
+
+	printDiff(os.Stdout, oldName, newName, oldSummary, newSummary)
+
+	return nil
+}
+
+// summarizeObject summarises the file at path, which either contains a pointer
+// or the contents of a file tracked by Git LFS. The contents of an object are
+// only needed by the inspectors, so they are downloaded if lfs.diffdownload is
+// set, and the results of the inspectors are cached by OID.
+func summarizeObject(name, path string) (*objectSummary, error) {
+	if path == os.DevNull {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, maxPointerSize+1)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	var summary *objectSummary
+	contentsPath := path
+	if p, perr := lfs.DecodePointer(bytes.NewReader(head[:n])); perr == nil {
+		summary = &objectSummary{Oid: p.Oid, Size: p.Size}
+		if contentsPath, err = localObjectContents(name, p); err != nil {
+			return nil, err
+		}
+	} else {
+		hasher := tools.NewHashingReader(io.MultiReader(bytes.NewReader(head[:n]), f))
+		size, err := io.Copy(ioutil.Discard, hasher)
+		if err != nil {
+			return nil, err
+		}
+		summary = &objectSummary{Oid: hasher.Hash(), Size: size}
+	}
+
+	if len(contentsPath) > 0 {
+		summary.Details = inspectObject(name, summary.Oid, contentsPath)
+	}
+	return summary, nil
+}
+
+// localObjectContents returns the path of the contents of the given pointer's
+// object in the local store, downloading it if lfs.diffdownload is set, or an
+// empty string if it isn't local.
+func localObjectContents(name string, p *lfs.Pointer) (string, error) {
+	mediafile, err := lfs.LocalMediaPath(p.Oid)
+	if err != nil {
+		return "", err
+	}
+
+	if !lfs.ObjectExistsOfSize(p.Oid, p.Size) {
+		if !cfg.Git.Bool("lfs.diffdownload", false) {
+			return "", nil
+		}
+		if err := lfs.PointerSmudge(ioutil.Discard, p, name, true, TransferManifest(), nil); err != nil {
+			return "", errors.Wrap(err, "diff")
+		}
+	}
+	if err := lfs.EnsureWholeObject(p.Oid, p.Size); err != nil {
+		return "", errors.Wrap(err, "diff")
+	}
+	return mediafile, nil
+}
+
+// inspectObject runs the inspectors for the file with the given name on its
+// contents, which have the given OID. Since the contents of an OID never
+// change, the results are cached, keyed by the OID and the inspectors used.
+func inspectObject(name, oid, path string) []string {
+	inspectors, key := diffInspectorsFor(name)
+
+	cacheKey := sha256.Sum256([]byte(oid + "\x00" + key))
+	cachePath := filepath.Join(config.LocalGitStorageDir, "lfs", "cache", "diff", hex.EncodeToString(cacheKey[:]))
+	if cached, err := ioutil.ReadFile(cachePath); err == nil {
+		return splitDetails(string(cached))
+	}
+
+	details := make([]string, 0)
+	for _, inspector := range inspectors {
+		lines, err := inspector(name, path)
+		if err != nil {
+			tracerx.Printf("diff: unable to inspect %s: %s", path, err)
+			continue
+		}
+		details = append(details, lines...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+		ioutil.WriteFile(cachePath, []byte(strings.Join(details, "\n")), 0644)
+	}
+	return details
+}
+
+// diffInspectorsFor returns the inspectors for a file with the given name, and
+// a key which changes whenever they do: the built-in ones, and the command in
+// lfs.inspector.<extension>, if there is one.
+func diffInspectorsFor(name string) ([]diffInspector, string) {
+	inspectors := []diffInspector{inspectImage}
+	key := "image"
+
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	if len(ext) == 0 {
+		return inspectors, key
+	}
+
+	if command, ok := cfg.Git.Get("lfs.inspector." + ext); ok && len(command) > 0 {
+		inspectors = append(inspectors, commandInspector(command))
+		key += "\x00" + command
+	}
+	return inspectors, key
+}
+
+// inspectImage describes the format and dimensions of GIF, JPEG and PNG images,
+// reading only as much of the file as their headers.
+func inspectImage(name, path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	conf, format, err := image.DecodeConfig(f)
+	if err != nil {
+		// not an image that can be decoded.
+		return nil, nil
+	}
+	return []string{
+		fmt.Sprintf("format %s", format),
+		fmt.Sprintf("dimensions %dx%d", conf.Width, conf.Height),
+	}, nil
+}
+
+// commandInspector returns an inspector which runs the given shell command,
+// with "%f" replaced by the path of the file's contents, and returns the lines
+// it prints.
+func commandInspector(command string) diffInspector {
+	return func(name, path string) ([]string, error) {
+		cmd := subprocess.ExecCommand("sh", "-c", strings.Replace(command, "%f", shellQuote(path), -1))
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, err
+		}
+		return splitDetails(string(out)), nil
+	}
+}
+
+func splitDetails(s string) []string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimRight(line, "\r"); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func printSummary(w io.Writer, prefix string, s *objectSummary) {
+	if s == nil {
+		return
+	}
+
+	fmt.Fprintf(w, "%soid sha256:%s\n", prefix, s.Oid)
+	fmt.Fprintf(w, "%ssize %d (%s)\n", prefix, s.Size, humanizeBytes(s.Size))
+	if s.Details == nil {
+		fmt.Fprintf(w, "%s(contents not downloaded)\n", prefix)
+	}
+	for _, line := range s.Details {
+		fmt.Fprintf(w, "%s%s\n", prefix, line)
+	}
+}
+
+// printDiff writes a diff of the summaries of the old and new versions of a
+// file, followed by the change in its size.
+func printDiff(w io.Writer, oldName, newName string, oldSummary, newSummary *objectSummary) {
+	fmt.Fprintf(w, "diff --git-lfs a/%s b/%s\n", oldName, newName)
+	printSummary(w, "-", oldSummary)
+	printSummary(w, "+", newSummary)
+
+	var oldSize, newSize int64
+	if oldSummary != nil {
+		oldSize = oldSummary.Size
+	}
+	if newSummary != nil {
+		newSize = newSummary.Size
+	}
+
+	delta := newSize - oldSize
+	sign := "+"
+	if delta < 0 {
+		sign = "-"
+		delta = -delta
+	}
+	fmt.Fprintf(w, " size %s%s\n", sign, humanizeBytes(delta))
+}
+
+func init() {
+	RegisterCommand("diff", diffCommand, func(cmd *cobra.Command) {
+		cmd.Flags().BoolVar(&diffTextconv, "textconv", false, "Summarise a single version of a file, as a textconv filter")
+	})
+}
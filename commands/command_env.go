@@ -1,13 +1,16 @@
 package commands
 
 import (
+	"os"
+	"strings"
+
 	"github.com/git-lfs/git-lfs/config"
 	"github.com/git-lfs/git-lfs/git"
 	"github.com/git-lfs/git-lfs/lfs"
 	"github.com/spf13/cobra"
 )
 
-func envCommand(cmd *cobra.Command, args []string) {
+func envCommand(cmd *cobra.Command, args []string) error {
 	config.ShowConfigWarnings = true
 	endpoint := cfg.Endpoint("download")
 
@@ -39,10 +42,19 @@ func envCommand(cmd *cobra.Command, args []string) {
 		Print(env)
 	}
 
+	for _, env := range os.Environ() {
+		name := strings.SplitN(env, "=", 2)[0]
+		if key, ok := config.EnvOverrideKey(name); ok {
+			Print("%s overrides git config %s", name, key)
+		}
+	}
+
 	for _, key := range []string{"filter.lfs.process", "filter.lfs.smudge", "filter.lfs.clean"} {
 		value, _ := cfg.Git.Get(key)
 		Print("git config %s = %q", key, value)
 	}
+
+	return nil
 }
 
 func init() {
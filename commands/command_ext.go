@@ -2,26 +2,31 @@ package commands
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/git-lfs/git-lfs/config"
 	"github.com/spf13/cobra"
 )
 
-func extCommand(cmd *cobra.Command, args []string) {
+func extCommand(cmd *cobra.Command, args []string) error {
 	printAllExts()
+
+	return nil
 }
 
-func extListCommand(cmd *cobra.Command, args []string) {
+func extListCommand(cmd *cobra.Command, args []string) error {
 	n := len(args)
 	if n == 0 {
 		printAllExts()
-		return
+		return nil
 	}
 
 	for _, key := range args {
 		ext := cfg.Extensions()[key]
 		printExt(ext)
 	}
+
+	return nil
 }
 
 func printAllExts() {
@@ -40,6 +45,12 @@ func printExt(ext config.Extension) {
 	Print("    clean = %s", ext.Clean)
 	Print("    smudge = %s", ext.Smudge)
 	Print("    priority = %d", ext.Priority)
+	if len(ext.Patterns) > 0 {
+		Print("    pattern = %s", strings.Join(ext.Patterns, ","))
+	}
+	if ext.Optional {
+		Print("    optional = true")
+	}
 }
 
 func init() {
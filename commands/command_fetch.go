@@ -2,6 +2,7 @@ package commands
 
 import (
 	"fmt"
+	"io/ioutil"
 	"time"
 
 	"github.com/git-lfs/git-lfs/filepathfilter"
@@ -14,9 +15,23 @@ import (
 )
 
 var (
-	fetchRecentArg bool
-	fetchAllArg    bool
-	fetchPruneArg  bool
+	fetchRecentArg   bool
+	fetchAllArg      bool
+	fetchPruneArg    bool
+	fetchManifestArg string
+	fetchURLsOnlyArg bool
+	fetchRetryArg    bool
+
+	// fetchedPointers collects the pointers fetched for --output-manifest.
+	fetchedPointers *fetchManifest
+	// fetchedURLs collects the download URLs of objects for --urls-only.
+	fetchedURLs *fetchURLManifest
+	// fetchFailures collects the failures of every fetch, to choose the
+	// code to exit with.
+	fetchFailures transferFailures
+	// fetchFailedPointers collects the pointers whose objects failed to
+	// download, for the retry file.
+	fetchFailedPointers fetchRetries
 )
 
 func getIncludeExcludeArgs(cmd *cobra.Command) (include, exclude *string) {
@@ -32,15 +47,18 @@ func getIncludeExcludeArgs(cmd *cobra.Command) (include, exclude *string) {
 	return
 }
 
-func fetchCommand(cmd *cobra.Command, args []string) {
-	requireInRepo()
+func fetchCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+	recoverTempObjects()
 
 	var refs []*git.Ref
 
 	if len(args) > 0 {
 		// Remote is first arg
 		if err := git.ValidateRemote(args[0]); err != nil {
-			Exit("Invalid remote name %q", args[0])
+			return errorf("Invalid remote name %q", args[0])
 		}
 		cfg.CurrentRemote = args[0]
 	} else {
@@ -50,34 +68,59 @@ func fetchCommand(cmd *cobra.Command, args []string) {
 	if len(args) > 1 {
 		resolvedrefs, err := git.ResolveRefs(args[1:])
 		if err != nil {
-			Panic(err, "Invalid ref argument: %v", args[1:])
+			return loggedErrorf(err, "Invalid ref argument: %v", args[1:])
 		}
 		refs = resolvedrefs
-	} else if !fetchAllArg {
+	} else if !fetchAllArg && !fetchRetryArg {
 		ref, err := git.CurrentRef()
 		if err != nil {
-			Panic(err, "Could not fetch")
+			return loggedErrorf(err, "Could not fetch")
 		}
 		refs = []*git.Ref{ref}
 	}
 
+	if fetchRetryArg && (fetchAllArg || fetchRecentArg || len(args) > 1 || cmd.Flag("include").Changed || cmd.Flag("exclude").Changed) {
+		return errorf("Cannot combine --retry-failed with --all, --recent, --include, --exclude or ref arguments")
+	}
+
+	if fetchURLsOnlyArg {
+		if fetchPruneArg {
+			return errorf("Cannot combine --urls-only with --prune")
+		}
+		// Without a file to write the URLs to, they're the only output.
+		if len(fetchManifestArg) == 0 {
+			OutputWriter = ioutil.Discard
+		}
+		fetchedURLs = newFetchURLManifest()
+	} else if len(fetchManifestArg) > 0 {
+		fetchedPointers = &fetchManifest{}
+	}
+
 	success := true
-	gitscanner := lfs.NewGitScanner(nil)
+	gitscanner := newGitScanner(nil)
 	defer gitscanner.Close()
 
 	include, exclude := getIncludeExcludeArgs(cmd)
 
-	if fetchAllArg {
+	var err error
+	if fetchRetryArg {
+		if success, err = fetchRetryFailed(); err != nil {
+			return err
+		}
+
+	} else if fetchAllArg {
 		if fetchRecentArg || len(args) > 1 {
-			Exit("Cannot combine --all with ref arguments or --recent")
+			return errorf("Cannot combine --all with ref arguments or --recent")
 		}
 		if include != nil || exclude != nil {
-			Exit("Cannot combine --all with --include or --exclude")
+			return errorf("Cannot combine --all with --include or --exclude")
 		}
 		if len(cfg.FetchIncludePaths()) > 0 || len(cfg.FetchExcludePaths()) > 0 {
 			Print("Ignoring global include / exclude paths to fulfil --all")
 		}
-		success = fetchAll()
+		if success, err = fetchAll(); err != nil {
+			return err
+		}
 
 	} else { // !all
 		filter := buildFilepathFilter(cfg, include, exclude)
@@ -85,32 +128,64 @@ func fetchCommand(cmd *cobra.Command, args []string) {
 		// Fetch refs sequentially per arg order; duplicates in later refs will be ignored
 		for _, ref := range refs {
 			Print("Fetching %v", ref.Name)
-			s := fetchRef(ref.Sha, filter)
+			cfg.CurrentRef = ref.Refspec()
+			s, err := fetchRef(ref.Sha, filter)
+			if err != nil {
+				return err
+			}
 			success = success && s
 		}
 
 		if fetchRecentArg || cfg.FetchPruneConfig().FetchRecentAlways {
-			s := fetchRecent(refs, filter)
+			s, err := fetchRecent(refs, filter)
+			if err != nil {
+				return err
+			}
 			success = success && s
 		}
 	}
 
+	if fetchedPointers != nil {
+		if err := fetchedPointers.Write(fetchManifestArg); err != nil {
+			return err
+		}
+	}
+	if fetchedURLs != nil {
+		if err := fetchedURLs.Write(fetchManifestArg); err != nil {
+			return err
+		}
+	}
+
+	if fetchedURLs == nil {
+		if err := fetchFailedPointers.Write(fetchRetryPath(), cfg.CurrentRemote); err != nil {
+			Error("Could not write the retry file: %s", err)
+		}
+	}
+
 	if fetchPruneArg {
 		fetchconf := cfg.FetchPruneConfig()
 		verify := fetchconf.PruneVerifyRemoteAlways
 		// no dry-run or verbose options in fetch, assume false
-		prune(fetchconf, verify, false, false)
+		if err := prune(fetchconf, verify, true, false, false); err != nil {
+			return err
+		}
 	}
 
 	if !success {
-		Exit("Warning: errors occurred")
+		Error("Warning: errors occurred")
+		if err := fetchFailures.err(); err != nil {
+			return err
+		}
+		return codeErrorf(exitError, "")
 	}
+
+	return nil
 }
 
 func pointersToFetchForRef(ref string, filter *filepathfilter.Filter) ([]*lfs.WrappedPointer, error) {
 	var pointers []*lfs.WrappedPointer
 	var multiErr error
-	tempgitscanner := lfs.NewGitScanner(func(p *lfs.WrappedPointer, err error) {
+	tempgitscanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
 		if err != nil {
 			if multiErr != nil {
 				multiErr = fmt.Errorf("%v\n%v", multiErr, err)
@@ -134,22 +209,25 @@ func pointersToFetchForRef(ref string, filter *filepathfilter.Filter) ([]*lfs.Wr
 }
 
 // Fetch all binaries for a given ref (that we don't have already)
-func fetchRef(ref string, filter *filepathfilter.Filter) bool {
+func fetchRef(ref string, filter *filepathfilter.Filter) (bool, error) {
 	pointers, err := pointersToFetchForRef(ref, filter)
 	if err != nil {
-		Panic(err, "Could not scan for Git LFS files")
+		return false, loggedErrorf(err, "Could not scan for Git LFS files")
 	}
 	return fetchAndReportToChan(pointers, filter, nil)
 }
 
 // Fetch all previous versions of objects from since to ref (not including final state at ref)
 // So this will fetch all the '-' sides of the diff from since to ref
-func fetchPreviousVersions(ref string, since time.Time, filter *filepathfilter.Filter) bool {
+func fetchPreviousVersions(ref string, since time.Time, filter *filepathfilter.Filter) (bool, error) {
 	var pointers []*lfs.WrappedPointer
+	var scanErr error
 
-	tempgitscanner := lfs.NewGitScanner(func(p *lfs.WrappedPointer, err error) {
+	tempgitscanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
 		if err != nil {
-			Panic(err, "Could not scan for Git LFS previous versions")
+			if scanErr == nil {
+				scanErr = err
+			}
 			return
 		}
 
@@ -159,26 +237,30 @@ func fetchPreviousVersions(ref string, since time.Time, filter *filepathfilter.F
 	tempgitscanner.Filter = filter
 
 	if err := tempgitscanner.ScanPreviousVersions(ref, since, nil); err != nil {
-		ExitWithError(err)
+		tempgitscanner.Close()
+		return false, err
 	}
 
 	tempgitscanner.Close()
+	if scanErr != nil {
+		return false, loggedErrorf(scanErr, "Could not scan for Git LFS previous versions")
+	}
 	return fetchAndReportToChan(pointers, filter, nil)
 }
 
 // Fetch recent objects based on config
-func fetchRecent(alreadyFetchedRefs []*git.Ref, filter *filepathfilter.Filter) bool {
+func fetchRecent(alreadyFetchedRefs []*git.Ref, filter *filepathfilter.Filter) (bool, error) {
 	fetchconf := cfg.FetchPruneConfig()
 
 	if fetchconf.FetchRecentRefsDays == 0 && fetchconf.FetchRecentCommitsDays == 0 {
-		return true
+		return true, nil
 	}
 
 	ok := true
 	// Make a list of what unique commits we've already fetched for to avoid duplicating work
-	uniqueRefShas := make(map[string]string, len(alreadyFetchedRefs))
+	uniqueRefShas := make(map[string]*git.Ref, len(alreadyFetchedRefs))
 	for _, ref := range alreadyFetchedRefs {
-		uniqueRefShas[ref.Sha] = ref.Name
+		uniqueRefShas[ref.Sha] = ref
 	}
 	// First find any other recent refs
 	if fetchconf.FetchRecentRefsDays > 0 {
@@ -186,48 +268,59 @@ func fetchRecent(alreadyFetchedRefs []*git.Ref, filter *filepathfilter.Filter) b
 		refsSince := time.Now().AddDate(0, 0, -fetchconf.FetchRecentRefsDays)
 		refs, err := git.RecentBranches(refsSince, fetchconf.FetchRecentRefsIncludeRemotes, cfg.CurrentRemote)
 		if err != nil {
-			Panic(err, "Could not scan for recent refs")
+			return false, loggedErrorf(err, "Could not scan for recent refs")
 		}
 		for _, ref := range refs {
 			// Don't fetch for the same SHA twice
-			if prevRefName, ok := uniqueRefShas[ref.Sha]; ok {
-				if ref.Name != prevRefName {
-					tracerx.Printf("Skipping fetch for %v, already fetched via %v", ref.Name, prevRefName)
+			if prevRef, ok := uniqueRefShas[ref.Sha]; ok {
+				if ref.Name != prevRef.Name {
+					tracerx.Printf("Skipping fetch for %v, already fetched via %v", ref.Name, prevRef.Name)
 				}
 			} else {
-				uniqueRefShas[ref.Sha] = ref.Name
+				uniqueRefShas[ref.Sha] = ref
 				Print("Fetching %v", ref.Name)
-				k := fetchRef(ref.Sha, filter)
+				cfg.CurrentRef = ref.Refspec()
+				k, err := fetchRef(ref.Sha, filter)
+				if err != nil {
+					return false, err
+				}
 				ok = ok && k
 			}
 		}
 	}
 	// For every unique commit we've fetched, check recent commits too
 	if fetchconf.FetchRecentCommitsDays > 0 {
-		for commit, refName := range uniqueRefShas {
+		for commit, ref := range uniqueRefShas {
 			// We measure from the last commit at the ref
 			summ, err := git.GetCommitSummary(commit)
 			if err != nil {
-				Error("Couldn't scan commits at %v: %v", refName, err)
+				Error("Couldn't scan commits at %v: %v", ref.Name, err)
 				continue
 			}
-			Print("Fetching changes within %v days of %v", fetchconf.FetchRecentCommitsDays, refName)
+			Print("Fetching changes within %v days of %v", fetchconf.FetchRecentCommitsDays, ref.Name)
+			cfg.CurrentRef = ref.Refspec()
 			commitsSince := summ.CommitDate.AddDate(0, 0, -fetchconf.FetchRecentCommitsDays)
-			k := fetchPreviousVersions(commit, commitsSince, filter)
+			k, err := fetchPreviousVersions(commit, commitsSince, filter)
+			if err != nil {
+				return false, err
+			}
 			ok = ok && k
 		}
 
 	}
-	return ok
+	return ok, nil
 }
 
-func fetchAll() bool {
-	pointers := scanAll()
+func fetchAll() (bool, error) {
+	pointers, err := scanAll()
+	if err != nil {
+		return false, err
+	}
 	Print("Fetching objects...")
 	return fetchAndReportToChan(pointers, nil, nil)
 }
 
-func scanAll() []*lfs.WrappedPointer {
+func scanAll() ([]*lfs.WrappedPointer, error) {
 	// This could be a long process so use the chan version & report progress
 	Print("Scanning for all objects ever referenced...")
 	spinner := progress.NewSpinner()
@@ -236,7 +329,7 @@ func scanAll() []*lfs.WrappedPointer {
 	// use temp gitscanner to collect pointers
 	var pointers []*lfs.WrappedPointer
 	var multiErr error
-	tempgitscanner := lfs.NewGitScanner(func(p *lfs.WrappedPointer, err error) {
+	tempgitscanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
 		if err != nil {
 			if multiErr != nil {
 				multiErr = fmt.Errorf("%v\n%v", multiErr, err)
@@ -252,34 +345,44 @@ func scanAll() []*lfs.WrappedPointer {
 	})
 
 	if err := tempgitscanner.ScanAll(nil); err != nil {
-		Panic(err, "Could not scan for Git LFS files")
+		tempgitscanner.Close()
+		return nil, loggedErrorf(err, "Could not scan for Git LFS files")
 	}
 
 	tempgitscanner.Close()
 
 	if multiErr != nil {
-		Panic(multiErr, "Could not scan for Git LFS files")
+		return nil, loggedErrorf(multiErr, "Could not scan for Git LFS files")
 	}
 
 	spinner.Finish(OutputWriter, fmt.Sprintf("%d objects found", numObjs))
-	return pointers
+	return pointers, nil
 }
 
 // Fetch and report completion of each OID to a channel (optional, pass nil to skip)
-// Returns true if all completed with no errors, false if errors were written to stderr/log
-func fetchAndReportToChan(allpointers []*lfs.WrappedPointer, filter *filepathfilter.Filter, out chan<- *lfs.WrappedPointer) bool {
+// Returns true if all completed with no errors, false if errors were written to stderr/log,
+// or an error if there's no remote to fetch from.
+func fetchAndReportToChan(allpointers []*lfs.WrappedPointer, filter *filepathfilter.Filter, out chan<- *lfs.WrappedPointer) (bool, error) {
 	// Lazily initialize the current remote.
 	if len(cfg.CurrentRemote) == 0 {
 		// Actively find the default remote, don't just assume origin
 		defaultRemote, err := git.DefaultRemote()
 		if err != nil {
-			Exit("No default remote")
+			return false, errorf("No default remote")
 		}
 		cfg.CurrentRemote = defaultRemote
 	}
 
+	if fetchedURLs != nil {
+		return fetchedURLs.Resolve(allpointers), nil
+	}
+
+	if fetchedPointers != nil {
+		fetchedPointers.Add(allpointers)
+	}
+
 	ready, pointers, meter := readyAndMissingPointers(allpointers, filter)
-	q := newDownloadQueue(tq.WithProgress(meter))
+	q := newDownloadQueue(tq.WithProgress(meter), newTransferJournal(tq.Download))
 
 	if out != nil {
 		// If we already have it, or it won't be fetched
@@ -318,16 +421,18 @@ func fetchAndReportToChan(allpointers []*lfs.WrappedPointer, filter *filepathfil
 		q.Add(downloadTransfer(p))
 	}
 
-	processQueue := time.Now()
 	q.Wait()
-	tracerx.PerformanceSince("process queue", processQueue)
 
 	ok := true
 	for _, err := range q.Errors() {
 		ok = false
 		FullError(err)
 	}
-	return ok
+	fetchFailures.addQueue(q, len(pointers))
+	if !ok {
+		fetchFailedPointers.AddMissing(allpointers)
+	}
+	return ok, nil
 }
 
 func readyAndMissingPointers(allpointers []*lfs.WrappedPointer, filter *filepathfilter.Filter) ([]*lfs.WrappedPointer, []*lfs.WrappedPointer, *progress.ProgressMeter) {
@@ -365,5 +470,10 @@ func init() {
 		cmd.Flags().BoolVarP(&fetchRecentArg, "recent", "r", false, "Fetch recent refs & commits")
 		cmd.Flags().BoolVarP(&fetchAllArg, "all", "a", false, "Fetch all LFS files ever referenced")
 		cmd.Flags().BoolVarP(&fetchPruneArg, "prune", "p", false, "After fetching, prune old data")
+		cmd.Flags().StringVarP(&fetchManifestArg, "output-manifest", "", "", "Write a manifest of the fetched objects to a file")
+		cmd.Flags().BoolVarP(&fetchURLsOnlyArg, "urls-only", "", false, "Write the download URLs of the objects instead of fetching them")
+		cmd.Flags().BoolVarP(&fetchRetryArg, "retry-failed", "", false, "Fetch only the objects which failed to download last time")
+		cmd.Flags().IntVarP(&jobsArg, "jobs", "j", 0, "Transfer this many objects at once, overriding lfs.concurrenttransfers")
+		addTimeoutFlag(cmd)
 	})
 }
@@ -30,17 +30,20 @@ const (
 // in the working tree.
 var filterSmudgeSkip bool
 
-func filterCommand(cmd *cobra.Command, args []string) {
-	requireStdin("This command should be run by the Git filter process")
+func filterCommand(cmd *cobra.Command, args []string) error {
+	if err := requireStdin("This command should be run by the Git filter process"); err != nil {
+		return err
+	}
 	lfs.InstallHooks(false)
+	startAutoMaintenance()
 
 	s := git.NewFilterProcessScanner(os.Stdin, os.Stdout)
 
 	if err := s.Init(); err != nil {
-		ExitWithError(err)
+		return err
 	}
 	if err := s.NegotiateCapabilities(); err != nil {
-		ExitWithError(err)
+		return err
 	}
 
 	skip := filterSmudgeSkip || cfg.Os.Bool("GIT_LFS_SKIP_SMUDGE", false)
@@ -64,7 +67,7 @@ func filterCommand(cmd *cobra.Command, args []string) {
 			w = git.NewPktlineWriter(os.Stdout, smudgeFilterBufferCapacity)
 			err = smudge(w, req.Payload, req.Header["pathname"], skip, filter)
 		default:
-			ExitWithError(fmt.Errorf("Unknown command %q", req.Header["command"]))
+			return fmt.Errorf("Unknown command %q", req.Header["command"])
 		}
 
 		if errors.IsNotAPointerError(err) {
@@ -72,6 +75,13 @@ func filterCommand(cmd *cobra.Command, args []string) {
 			err = nil
 		}
 
+		// Errors that carry an exit code can't be reported for a single
+		// file, so they end the process, just as they do for the
+		// standalone clean and smudge commands.
+		if _, fatal := err.(*exitCodeError); fatal {
+			return err
+		}
+
 		var status string
 		if ferr := w.Flush(); ferr != nil {
 			status = statusFromErr(ferr)
@@ -90,8 +100,10 @@ func filterCommand(cmd *cobra.Command, args []string) {
 	}
 
 	if err := s.Err(); err != nil && err != io.EOF {
-		ExitWithError(err)
+		return err
 	}
+
+	return nil
 }
 
 // statusFromErr returns the status code that should be sent over the filter
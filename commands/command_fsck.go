@@ -10,6 +10,8 @@ import (
 	"github.com/git-lfs/git-lfs/config"
 	"github.com/git-lfs/git-lfs/git"
 	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/localstorage"
+	"github.com/git-lfs/git-lfs/tools"
 	"github.com/spf13/cobra"
 )
 
@@ -23,62 +25,115 @@ var (
 //
 // NOTE(zeroshirts): Ideally git would have hooks for fsck such that we could
 // chain a lfs-fsck, but I don't think it does.
-func fsckCommand(cmd *cobra.Command, args []string) {
+func fsckCommand(cmd *cobra.Command, args []string) error {
 	lfs.InstallHooks(false)
-	requireInRepo()
+	if err := requireInRepo(); err != nil {
+		return err
+	}
 
 	ref, err := git.CurrentRef()
 	if err != nil {
-		ExitWithError(err)
+		return err
 	}
 
-	var corruptOids []string
-	gitscanner := lfs.NewGitScanner(func(p *lfs.WrappedPointer, err error) {
+	var corruptOids, writableOids []string
+	var checkErr error
+	gitscanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
+		if checkErr != nil {
+			return
+		}
+
 		if err == nil {
 			var pointerOk bool
 			pointerOk, err = fsckPointer(p.Name, p.Oid)
 			if !pointerOk {
 				corruptOids = append(corruptOids, p.Oid)
+			} else if !fsckPermissions(p.Name, p.Oid) {
+				writableOids = append(writableOids, p.Oid)
 			}
 		}
 
 		if err != nil {
-			Panic(err, "Error checking Git LFS files")
+			checkErr = err
 		}
 	})
 
 	if err := gitscanner.ScanRefWithDeleted(ref.Sha, nil); err != nil {
-		ExitWithError(err)
+		return err
 	}
 
 	if err := gitscanner.ScanIndex("HEAD", nil); err != nil {
-		ExitWithError(err)
+		return err
 	}
 
 	gitscanner.Close()
+	if checkErr != nil {
+		return loggedErrorf(checkErr, "Error checking Git LFS files")
+	}
 
-	if len(corruptOids) == 0 {
+	if len(corruptOids) == 0 && len(writableOids) == 0 {
 		Print("Git LFS fsck OK")
-		return
+		return nil
 	}
 
 	if fsckDryRun {
-		return
+		return nil
+	}
+
+	if len(writableOids) > 0 {
+		Print("Making writable objects read-only")
+	}
+
+	for _, oid := range writableOids {
+		if err := localstorage.ProtectObject(lfs.LocalMediaPathReadOnly(oid)); err != nil {
+			return err
+		}
+	}
+
+	if len(corruptOids) == 0 {
+		return nil
+	}
+
+	if err := removeCorruptObjects(corruptOids); err != nil {
+		return err
 	}
 
+	return nil
+}
+
+// removeCorruptObjects moves the given corrupt objects to .git/lfs/bad, or
+// forgets them if they're stored as chunks or compressed, so that they're
+// downloaded again.
+func removeCorruptObjects(oids []string) error {
 	badDir := filepath.Join(config.LocalGitStorageDir, "lfs", "bad")
 	Print("Moving corrupt objects to %s", badDir)
 
 	if err := os.MkdirAll(badDir, 0755); err != nil {
-		ExitWithError(err)
+		return err
 	}
 
-	for _, oid := range corruptOids {
+	for _, oid := range oids {
+		if _, chunked := lfs.ChunkedObjectSize(oid); chunked && !tools.FileExists(lfs.LocalMediaPathReadOnly(oid)) {
+			// Forget objects stored as chunks, so that they're
+			// downloaded again; their chunks may be shared.
+			if err := localstorage.Chunks().Remove(oid); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, compressed := lfs.CompressedObjectSize(oid); compressed && !tools.FileExists(lfs.LocalMediaPathReadOnly(oid)) {
+			if err := localstorage.Compressed().Remove(oid); err != nil {
+				return err
+			}
+			continue
+		}
+
 		badFile := filepath.Join(badDir, oid)
 		if err := os.Rename(lfs.LocalMediaPathReadOnly(oid), badFile); err != nil {
-			ExitWithError(err)
+			return err
 		}
 	}
+	return nil
 }
 
 func fsckPointer(name, oid string) (bool, error) {
@@ -86,7 +141,19 @@ func fsckPointer(name, oid string) (bool, error) {
 
 	Debug("Examining %v (%v)", name, path)
 
-	f, err := os.Open(path)
+	// Objects stored as chunks or compressed are checked as they're
+	// reassembled or decompressed, with an error if their contents don't
+	// add up to the object.
+	var f io.ReadCloser
+	_, chunked := lfs.ChunkedObjectSize(oid)
+	_, compressed := lfs.CompressedObjectSize(oid)
+	stored := chunked || compressed
+	file, err := os.Open(path)
+	if err == nil {
+		f, stored = file, false
+	} else if stored && os.IsNotExist(err) {
+		f, err = lfs.OpenLocalObject(oid)
+	}
 	if pErr, pOk := err.(*os.PathError); pOk {
 		Print("Object %s (%s) could not be checked: %s", name, oid, pErr.Err)
 		return false, nil
@@ -100,6 +167,10 @@ func fsckPointer(name, oid string) (bool, error) {
 	_, err = io.Copy(oidHash, f)
 	f.Close()
 	if err != nil {
+		if stored {
+			Print("Object %s (%s) is corrupt", name, oid)
+			return false, nil
+		}
 		return false, err
 	}
 
@@ -112,6 +183,18 @@ func fsckPointer(name, oid string) (bool, error) {
 	return false, nil
 }
 
+// fsckPermissions returns whether the object with the given oid is read-only,
+// as objects are, so that it can't be modified through hard links to it.
+func fsckPermissions(name, oid string) bool {
+	stat, err := os.Stat(lfs.LocalMediaPathReadOnly(oid))
+	if err != nil || localstorage.IsProtected(stat) {
+		return true
+	}
+
+	Print("Object %s (%s) is writable", name, oid)
+	return false
+}
+
 func init() {
 	RegisterCommand("fsck", fsckCommand, func(cmd *cobra.Command) {
 		cmd.Flags().BoolVarP(&fsckDryRun, "dry-run", "d", false, "List corrupt objects without deleting them.")
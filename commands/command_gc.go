@@ -0,0 +1,252 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/localstorage"
+	"github.com/git-lfs/git-lfs/tq"
+	"github.com/rubyist/tracerx"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcAutoArg    bool
+	gcDryRunArg  bool
+	gcNoPruneArg bool
+)
+
+// gcCommand tidies up the local Git LFS storage in one go: it prunes old
+// objects, deletes abandoned temporary files and transfer journals, makes
+// writable objects read-only again and compresses or chunks objects stored
+// whole if lfs.storagecompression or lfs.chunkstore are set. With --auto it
+// does nothing if it has run within lfs.autogcintervaldays, so that it can be
+// run from Git's pre-auto-gc hook.
+func gcCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	discardOutputIfQuiet()
+
+	stamp := gcStampPath()
+	if gcAutoArg && !gcDue(stamp, cfg.AutoGCIntervalDays()) {
+		tracerx.Printf("gc: skipping, last run within %d day(s)", cfg.AutoGCIntervalDays())
+		return nil
+	}
+
+	if !gcNoPruneArg {
+		fetchPruneConfig := cfg.FetchPruneConfig()
+		if err := prune(fetchPruneConfig, fetchPruneConfig.PruneVerifyRemoteAlways, true, gcDryRunArg, isVerbose()); err != nil {
+			return err
+		}
+	}
+
+	gcTempFiles(gcDryRunArg)
+	gcJournals(gcDryRunArg)
+	gcPermissions(gcDryRunArg)
+	gcCompress(gcDryRunArg)
+
+	if !gcDryRunArg {
+		if err := touchFile(stamp); err != nil {
+			LoggedError(err, "Could not record the time of this run: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// gcStampPath returns the path of the file whose modification time is when
+// "git lfs gc" last ran.
+func gcStampPath() string {
+	return filepath.Join(config.LocalGitStorageDir, "lfs", "gc.last")
+}
+
+// gcDue returns whether "git lfs gc --auto" should run, as it hasn't run within
+// the given number of days.
+func gcDue(stamp string, days int) bool {
+	stat, err := os.Stat(stamp)
+	if err != nil {
+		return true
+	}
+	return time.Since(stat.ModTime()) >= time.Duration(days)*24*time.Hour
+}
+
+// touchFile creates the file at the given path, or updates its modification
+// time if it exists.
+func touchFile(path string) error {
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, nil, 0644)
+}
+
+// gcTempFiles deletes the temporary files of abandoned downloads, and those
+// left in the object, chunk and compressed stores by interrupted writes.
+func gcTempFiles(dryRun bool) {
+	count, size, err := localstorage.Objects().ClearStaleTempObjects(dryRun)
+	if err != nil && !os.IsNotExist(err) {
+		LoggedError(err, "Could not delete temporary files: %v", err)
+	}
+
+	dirs := []string{
+		localstorage.Objects().RootDir,
+		localstorage.Chunks().RootDir,
+		localstorage.Compressed().RootDir,
+	}
+	orphaned, orphanedSize, err := localstorage.ClearOrphanedTempFiles(dirs, time.Hour, dryRun)
+	if err != nil {
+		LoggedError(err, "Could not delete temporary files: %v", err)
+	}
+
+	count += orphaned
+	size += orphanedSize
+	if count == 0 {
+		return
+	}
+	if dryRun {
+		Print("%d temporary files would be deleted (%v)", count, humanizeBytes(size))
+	} else {
+		Print("Deleted %d temporary files (%v)", count, humanizeBytes(size))
+	}
+}
+
+// gcJournals deletes the journals of interrupted transfers which
+// "git lfs resume" has nothing left to do for: downloads whose objects are all
+// stored locally, and uploads whose objects are no longer stored locally.
+func gcJournals(dryRun bool) {
+	for _, dir := range []tq.Direction{tq.Upload, tq.Download} {
+		path := transferJournalPath(dir)
+		state, err := tq.ReadJournal(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				LoggedError(err, "Could not read %s journal: %v", dir, err)
+			}
+			continue
+		}
+
+		var pending int
+		for _, e := range state.Pending() {
+			if lfs.ObjectExistsOfSize(e.Oid, e.Size) == (dir == tq.Upload) {
+				pending++
+			}
+		}
+
+		if pending > 0 {
+			Print("%d objects still to %s, see `git lfs resume`", pending, dir)
+			continue
+		}
+		if dryRun {
+			Print("The finished %s journal would be deleted", dir)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			LoggedError(err, "Could not delete %s journal: %v", dir, err)
+			continue
+		}
+		Print("Deleted the finished %s journal", dir)
+	}
+}
+
+// gcPermissions makes the objects stored whole which are writable read-only
+// again, as git-lfs-fsck(1) does for those it checks.
+func gcPermissions(dryRun bool) {
+	var count int
+	for f := range lfs.ScanObjectsChan() {
+		path := lfs.LocalMediaPathReadOnly(f.Oid)
+		stat, err := os.Stat(path)
+		if err != nil || localstorage.IsProtected(stat) {
+			continue
+		}
+
+		if !dryRun {
+			if err := localstorage.ProtectObject(path); err != nil {
+				LoggedError(err, "Could not make %v read-only: %v", f.Oid, err)
+				continue
+			}
+		}
+		count++
+	}
+
+	if count == 0 {
+		return
+	}
+	if dryRun {
+		Print("%d writable objects would be made read-only", count)
+	} else {
+		Print("Made %d writable objects read-only", count)
+	}
+}
+
+// gcCompress compresses the objects stored whole if lfs.storagecompression is
+// set, skipping those whose files in the current checkout are excluded from it
+// by their extensions. Objects stored whole are moved to the chunk store by
+// prune if lfs.chunkstore is set instead.
+func gcCompress(dryRun bool) {
+	if cfg.StorageCompression() == config.StorageCompressionNone || cfg.ChunkStore() {
+		return
+	}
+
+	names := make(map[string]string)
+	if ref, err := git.CurrentRef(); err == nil {
+		gitscanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
+			if err == nil {
+				names[p.Oid] = p.Name
+			}
+		})
+		if err := gitscanner.ScanTree(ref.Sha); err != nil {
+			tracerx.Printf("gc: unable to scan the current checkout: %v", err)
+		}
+		gitscanner.Close()
+	}
+
+	var count int
+	var saved int64
+	for f := range lfs.ScanObjectsChan() {
+		if cfg.StorageCompressionExcluded(names[f.Oid]) {
+			continue
+		}
+		if dryRun {
+			count++
+			continue
+		}
+
+		if err := localstorage.CompressObject(cfg, f.Oid, names[f.Oid]); err == localstorage.ErrZstdNotFound {
+			return
+		} else if err != nil {
+			LoggedError(err, "Could not compress %v: %v", f.Oid, err)
+			continue
+		}
+		if stat, err := localstorage.Compressed().Stat(f.Oid); err == nil {
+			count++
+			saved += f.Size - stat.Size()
+		}
+	}
+
+	if count == 0 {
+		return
+	}
+	if dryRun {
+		Print("%d objects would be compressed", count)
+	} else {
+		Print("Compressed %d objects, saving %v", count, humanizeBytes(saved))
+	}
+}
+
+func init() {
+	RegisterCommand("gc", gcCommand, func(cmd *cobra.Command) {
+		cmd.Flags().BoolVar(&gcAutoArg, "auto", false, "Do nothing if run within lfs.autogcintervaldays")
+		cmd.Flags().BoolVarP(&gcDryRunArg, "dry-run", "d", false, "Don't change anything, just report")
+		cmd.Flags().BoolVar(&gcNoPruneArg, "no-prune", false, "Don't prune old objects")
+	})
+}
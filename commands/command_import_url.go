@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/httputil"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importURLAddFlag   bool
+	importURLForceFlag bool
+)
+
+// importURLCommand stores the contents of a URL, or of a local file, directly
+// in the Git LFS object store and writes a pointer to them at the given path in
+// the working copy, so that large build artifacts never have to be copied into
+// the working copy in full. The path is tracked with Git LFS first, if it isn't
+// already.
+func importURLCommand(cmd *cobra.Command, args []string) error {
+	if err := requireGitVersion(); err != nil {
+		return err
+	}
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	if config.LocalWorkingDir == "" {
+		Print("This operation must be run in a work tree.")
+		return codeErrorf(128, "")
+	}
+
+	if len(args) != 2 {
+		return errorf("Usage: git lfs import-url [--add] [--force] <url|path> <path>")
+	}
+	source, target := args[0], args[1]
+
+	abspath, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	relpath, err := filepath.Rel(config.LocalWorkingDir, abspath)
+	if err != nil || relpath == "." || strings.HasPrefix(relpath, ".."+string(filepath.Separator)) || relpath == ".." {
+		return errorf("%q is outside of the git working directory %q.", target, config.LocalWorkingDir)
+	}
+	name := filepath.ToSlash(relpath)
+
+	if forbidden := blocklistItem(name); forbidden != "" {
+		return errorf("Cannot import to %s: Git LFS does not track files matching %s.", target, forbidden)
+	}
+	if _, err := os.Lstat(abspath); err == nil && !importURLForceFlag {
+		return errorf("%s already exists, use --force to overwrite it.", target)
+	}
+
+	lfs.InstallHooks(false)
+
+	from, err := openImportSource(source)
+	if err != nil {
+		return errors.Wrapf(err, "Could not read %s", source)
+	}
+	defer from.Close()
+
+	var buf bytes.Buffer
+	if err := clean(&buf, from, name); err != nil {
+		return errors.Wrapf(err, "Could not import %s", source)
+	}
+	ptr, err := lfs.DecodePointer(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return errors.Wrapf(err, "Could not import %s", source)
+	}
+
+	if err := writeImportedPointer(abspath, buf.Bytes()); err != nil {
+		return errors.Wrapf(err, "Could not write %s", target)
+	}
+
+	attributesPath := filepath.Join(config.LocalWorkingDir, ".gitattributes")
+	tracked, err := trackImportedPath(attributesPath, name)
+	if err != nil {
+		return errors.Wrapf(err, "Could not track %s", name)
+	}
+	if tracked {
+		Print("Tracking %s", name)
+	}
+
+	if importURLAddFlag {
+		paths := []string{abspath}
+		if _, err := os.Stat(attributesPath); err == nil {
+			paths = append(paths, attributesPath)
+		}
+		if _, err := subprocess.SimpleExec("git", append([]string{"add", "--"}, paths...)...); err != nil {
+			return errors.Wrapf(err, "Could not add %s", target)
+		}
+	}
+
+	Print("Imported %s (%s) as %s", source, humanizeBytes(ptr.Size), target)
+
+	return nil
+}
+
+// openImportSource opens the given http(s) or file URL, or local path, for
+// reading.
+func openImportSource(source string) (io.ReadCloser, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return os.Open(source)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		req, err := httputil.NewHttpRequest("GET", source, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := httputil.DoHttpRequest(cfg, req, false)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != 200 {
+			res.Body.Close()
+			return nil, errors.Errorf("unexpected response: %s", res.Status)
+		}
+		return res.Body, nil
+	case "file":
+		return os.Open(u.Path)
+	default:
+		return os.Open(source)
+	}
+}
+
+// writeImportedPointer writes the given pointer data to the file at abspath by
+// way of a temporary file in the same directory, so that an existing file is
+// only replaced once the pointer has been written in full.
+func writeImportedPointer(abspath string, data []byte) error {
+	dir := filepath.Dir(abspath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".git-lfs-import")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), abspath)
+}
+
+// trackImportedPath appends a line tracking the given slash-separated path to
+// the root .gitattributes file, unless the path is tracked with Git LFS
+// already, and returns whether it did.
+func trackImportedPath(attributesPath, name string) (bool, error) {
+	macros := lfs.LocalAttributeMacros()
+	if lfs.LocalAttributeMatcher().TracksWithLFS(name) {
+		return false, nil
+	}
+
+	addTrailingLinebreak := needsTrailingLinebreak(attributesPath)
+	attributesFile, err := os.OpenFile(attributesPath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0660)
+	if err != nil {
+		return false, err
+	}
+	defer attributesFile.Close()
+
+	if addTrailingLinebreak {
+		if _, err := attributesFile.WriteString("\n"); err != nil {
+			return false, err
+		}
+	}
+
+	encoded := strings.Replace(name, " ", "[[:space:]]", -1)
+	if _, err := attributesFile.WriteString(fmt.Sprintf("%s %s\n", encoded, trackAttributes(macros))); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func init() {
+	RegisterCommand("import-url", importURLCommand, func(cmd *cobra.Command) {
+		cmd.Flags().BoolVarP(&importURLAddFlag, "add", "a", false, "stage the pointer and the root .gitattributes with 'git add'")
+		cmd.Flags().BoolVarP(&importURLForceFlag, "force", "f", false, "overwrite the file at the target path")
+	})
+}
@@ -2,24 +2,33 @@ package commands
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/git-lfs/git-lfs/git"
 	"github.com/git-lfs/git-lfs/lfs"
 	"github.com/git-lfs/git-lfs/localstorage"
 	"github.com/spf13/cobra"
 )
 
 var (
-	forceInstall      = false
-	localInstall      = false
-	systemInstall     = false
-	skipSmudgeInstall = false
+	forceInstall       = false
+	localInstall       = false
+	systemInstall      = false
+	skipSmudgeInstall  = false
+	maintenanceInstall = false
+	templateInstall    = false
 )
 
-func installCommand(cmd *cobra.Command, args []string) {
-	requireGitVersion()
+func installCommand(cmd *cobra.Command, args []string) error {
+	if err := requireGitVersion(); err != nil {
+		return err
+	}
 
-	if localInstall {
-		requireInRepo()
+	if localInstall || maintenanceInstall {
+		if err := requireInRepo(); err != nil {
+			return err
+		}
 	}
 
 	if systemInstall && os.Geteuid() != 0 {
@@ -27,7 +36,14 @@ func installCommand(cmd *cobra.Command, args []string) {
 	}
 
 	if localInstall && systemInstall {
-		Exit("Only one of --local and --system options can be specified.")
+		return errorf("Only one of --local and --system options can be specified.")
+	}
+
+	if templateInstall {
+		if localInstall || maintenanceInstall {
+			return errorf("--template can't be used with --local or --maintenance")
+		}
+		return installTemplateCommand()
 	}
 
 	opt := lfs.InstallOptions{Force: forceInstall, Local: localInstall, System: systemInstall}
@@ -38,20 +54,89 @@ func installCommand(cmd *cobra.Command, args []string) {
 
 	if err := lfs.InstallFilters(opt, skipSmudgeInstall); err != nil {
 		Error(err.Error())
-		Exit("Run `git lfs install --force` to reset git config.")
+		return errorf("Run `git lfs install --force` to reset git config.")
 	}
 
 	if localInstall || lfs.InRepo() {
 		localstorage.InitStorageOrFail()
-		installHooksCommand(cmd, args)
+		if err := installHooksCommand(cmd, args); err != nil {
+			return err
+		}
+	}
+
+	if maintenanceInstall {
+		if err := startMaintenance(); err != nil {
+			return err
+		}
 	}
 
 	Print("Git LFS initialized.")
+
+	return nil
 }
 
-func installHooksCommand(cmd *cobra.Command, args []string) {
+// installTemplateCommand installs the Git LFS filters and hooks into the
+// template directory named by init.templateDir, in the system config with
+// --system or else the global config, so that each repository Git creates or
+// clones from then on is set up for Git LFS. If the global config names none,
+// ~/.git-template is created and named.
+func installTemplateCommand() error {
+	dir, err := installTemplateDir()
+	if err != nil {
+		return err
+	}
+
+	opt := lfs.InstallOptions{Force: forceInstall}
+	if skipSmudgeInstall {
+		// assume the user is changing their smudge mode, so enable force implicitly
+		opt.Force = true
+	}
+
+	if err := lfs.InstallTemplate(dir, opt, skipSmudgeInstall); err != nil {
+		Error(err.Error())
+		return errorf("Run `git lfs install --template --force` to reset the template.")
+	}
+
+	Print("Git LFS initialized in template directory %s.", dir)
+	return nil
+}
+
+// installTemplateDir returns the template directory named by init.templateDir,
+// with a leading "~/" expanded as Git does.
+func installTemplateDir() (string, error) {
+	var dir string
+	if systemInstall {
+		dir = git.Config.FindSystem("init.templatedir")
+		if len(dir) == 0 {
+			return "", errorf("init.templateDir isn't set in the system Git config.")
+		}
+	} else {
+		dir = git.Config.FindGlobal("init.templatedir")
+	}
+
+	home, _ := cfg.Os.Get("HOME")
+	if len(dir) == 0 {
+		if len(home) == 0 {
+			return "", errorf("init.templateDir isn't set, and HOME is unknown.")
+		}
+		dir = filepath.Join(home, ".git-template")
+		if _, err := git.Config.SetGlobal("init.templatedir", dir); err != nil {
+			return "", err
+		}
+		Print("Set init.templateDir to %s.", dir)
+	} else if strings.HasPrefix(dir, "~/") && len(home) > 0 {
+		dir = filepath.Join(home, dir[2:])
+	}
+	return dir, nil
+}
+
+func installHooksCommand(cmd *cobra.Command, args []string) error {
 	updateForce = forceInstall
-	updateCommand(cmd, args)
+	if err := updateCommand(cmd, args); err != nil {
+		return err
+	}
+
+	return nil
 }
 
 func init() {
@@ -60,6 +145,8 @@ func init() {
 		cmd.Flags().BoolVarP(&localInstall, "local", "l", false, "Set the Git LFS config for the local Git repository only.")
 		cmd.Flags().BoolVarP(&systemInstall, "system", "", false, "Set the Git LFS config in system-wide scope.")
 		cmd.Flags().BoolVarP(&skipSmudgeInstall, "skip-smudge", "s", false, "Skip automatic downloading of objects on clone or pull.")
+		cmd.Flags().BoolVarP(&maintenanceInstall, "maintenance", "", false, "Run Git LFS maintenance tasks for this repository on a schedule.")
+		cmd.Flags().BoolVarP(&templateInstall, "template", "", false, "Set up the Git template directory, so that new repositories use Git LFS.")
 		cmd.AddCommand(NewCommand("hooks", installHooksCommand))
 		cmd.PreRun = setupLocalStorage
 	})
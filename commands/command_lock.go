@@ -6,27 +6,39 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/git-lfs/git-lfs/git"
 	"github.com/git-lfs/git-lfs/locking"
+	"github.com/git-lfs/git-lfs/tools"
 	"github.com/spf13/cobra"
 )
 
 var (
 	lockRemote     string
 	lockRemoteHelp = "specify which remote to use when interacting with locks"
+	// lockExpiresIn is how long the server should hold the lock for, such
+	// as "8h" or "2d", if it supports expiry.
+	lockExpiresIn string
 )
 
-func lockCommand(cmd *cobra.Command, args []string) {
+func lockCommand(cmd *cobra.Command, args []string) error {
 
 	if len(args) == 0 {
 		Print("Usage: git lfs lock <path>")
-		return
+		return nil
 	}
 
 	path, err := lockPath(args[0])
 	if err != nil {
-		Exit(err.Error())
+		return errorf("%s", err)
+	}
+
+	var expiresIn time.Duration
+	if len(lockExpiresIn) > 0 {
+		if expiresIn, err = tools.ParseDuration(lockExpiresIn); err != nil || expiresIn <= 0 {
+			return errorf("Invalid --expires-in %q: expected a duration such as \"8h\" or \"2d\"", lockExpiresIn)
+		}
 	}
 
 	if len(lockRemote) > 0 {
@@ -35,22 +47,31 @@ func lockCommand(cmd *cobra.Command, args []string) {
 
 	lockClient, err := locking.NewClient(cfg)
 	if err != nil {
-		Exit("Unable to create lock system: %v", err.Error())
+		return errorf("Unable to create lock system: %v", err.Error())
 	}
 	defer lockClient.Close()
-	lock, err := lockClient.LockFile(path)
+	lock, err := lockClient.LockFileExpiring(path, expiresIn)
 	if err != nil {
-		Exit("Lock failed: %v", err)
+		return errorf("Lock failed: %v", err)
+	}
+
+	if expiresIn > 0 && lock.ExpiresAt == nil {
+		Error("Warning: the server doesn't support lock expiry, so the lock on '%s' won't expire", args[0])
 	}
 
 	if locksCmdFlags.JSON {
 		if err := json.NewEncoder(os.Stdout).Encode(lock); err != nil {
 			Error(err.Error())
 		}
-		return
+		return nil
 	}
 
 	Print("\n'%s' was locked (%s)", args[0], lock.Id)
+	if lock.ExpiresAt != nil {
+		Print("The lock expires at %s.", lock.ExpiresAt.Local().Format(time.RFC1123))
+	}
+
+	return nil
 }
 
 // lockPaths relativizes the given filepath such that it is relative to the root
@@ -100,5 +121,6 @@ func init() {
 	RegisterCommand("lock", lockCommand, func(cmd *cobra.Command) {
 		cmd.Flags().StringVarP(&lockRemote, "remote", "r", cfg.CurrentRemote, lockRemoteHelp)
 		cmd.Flags().BoolVarP(&locksCmdFlags.JSON, "json", "", false, "print output in json")
+		cmd.Flags().StringVarP(&lockExpiresIn, "expires-in", "", "", "ask the server to release the lock after a duration, such as \"8h\" or \"2d\"")
 	})
 }
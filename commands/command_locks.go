@@ -2,9 +2,15 @@ package commands
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/git-lfs/git-lfs/git"
 	"github.com/git-lfs/git-lfs/locking"
+	"github.com/git-lfs/git-lfs/tools"
 
 	"github.com/spf13/cobra"
 )
@@ -13,10 +19,22 @@ var (
 	locksCmdFlags = new(locksFlags)
 )
 
-func locksCommand(cmd *cobra.Command, args []string) {
+func locksCommand(cmd *cobra.Command, args []string) error {
 	filters, err := locksCmdFlags.Filters()
 	if err != nil {
-		Exit("Error building filters: %v", err)
+		return errorf("Error building filters: %v", err)
+	}
+
+	if locksCmdFlags.Verify && locksCmdFlags.Local {
+		return errorf("--verify and --local can't be used together")
+	}
+
+	if !locksCmdFlags.Stale && (len(locksCmdFlags.OlderThan) > 0 || locksCmdFlags.Unlock || locksCmdFlags.Force) {
+		return errorf("--older-than, --unlock and --force can only be used with --stale")
+	}
+
+	if locksCmdFlags.Stale && (locksCmdFlags.Local || locksCmdFlags.Verify) {
+		return errorf("--stale can't be used with --local or --verify")
 	}
 
 	if len(lockRemote) > 0 {
@@ -24,9 +42,18 @@ func locksCommand(cmd *cobra.Command, args []string) {
 	}
 	lockClient, err := locking.NewClient(cfg)
 	if err != nil {
-		Exit("Unable to create lock system: %v", err.Error())
+		return errorf("Unable to create lock system: %v", err.Error())
 	}
 	defer lockClient.Close()
+
+	if locksCmdFlags.Verify {
+		return verifyLocks(lockClient, filters)
+	}
+
+	if locksCmdFlags.Stale {
+		return staleLocks(lockClient, filters)
+	}
+
 	var lockCount int
 	locks, err := lockClient.SearchLocks(filters, locksCmdFlags.Limit, locksCmdFlags.Local)
 	// Print any we got before exiting
@@ -35,18 +62,130 @@ func locksCommand(cmd *cobra.Command, args []string) {
 		if err := json.NewEncoder(os.Stdout).Encode(locks); err != nil {
 			Error(err.Error())
 		}
-		return
+	} else {
+		for _, lock := range locks {
+			Print("%s\t%s <%s>", lock.Path, lock.Name, lock.Email)
+			lockCount++
+		}
 	}
 
-	for _, lock := range locks {
-		Print("%s\t%s <%s>", lock.Path, lock.Name, lock.Email)
-		lockCount++
+	if err != nil {
+		return errorf("Error while retrieving locks: %v", err)
+	}
+
+	if !locksCmdFlags.JSON {
+		Print("\n%d lock(s) matched query.", lockCount)
+	}
+
+	return nil
+}
+
+// verifyLocks lists the locks matching filters, separating those held by the
+// current committer from those held by others. Locks of the former are marked
+// with an "O" in the text output, and are given as "ours", rather than
+// "theirs", in the JSON output.
+func verifyLocks(lockClient *locking.Client, filters map[string]string) error {
+	ours, theirs, err := lockClient.VerifiableLocks(filters, locksCmdFlags.Limit)
+
+	if locksCmdFlags.JSON {
+		if err := json.NewEncoder(os.Stdout).Encode(struct {
+			Ours   []locking.Lock `json:"ours"`
+			Theirs []locking.Lock `json:"theirs"`
+		}{ours, theirs}); err != nil {
+			Error(err.Error())
+		}
+	} else {
+		for _, lock := range ours {
+			Print("O %s\t%s <%s>", lock.Path, lock.Name, lock.Email)
+		}
+		for _, lock := range theirs {
+			Print("  %s\t%s <%s>", lock.Path, lock.Name, lock.Email)
+		}
 	}
 
 	if err != nil {
-		Exit("Error while retrieving locks: %v", err)
+		return errorf("Error while retrieving locks: %v", err)
+	}
+
+	if !locksCmdFlags.JSON {
+		Print("\n%d lock(s) matched query, %d of them yours.", len(ours)+len(theirs), len(ours))
+	}
+	return nil
+}
+
+// staleLocks lists the locks matching filters which have expired, or were
+// taken longer ago than --older-than, and so have likely been abandoned. With
+// --unlock, it unlocks them, including those held by others with --force.
+func staleLocks(lockClient *locking.Client, filters map[string]string) error {
+	var cutoff time.Time
+	now := time.Now()
+	if len(locksCmdFlags.OlderThan) > 0 {
+		age, err := tools.ParseDuration(locksCmdFlags.OlderThan)
+		if err != nil {
+			return errorf("Invalid --older-than %q: expected a duration such as \"30d\" or \"12h\"", locksCmdFlags.OlderThan)
+		}
+		cutoff = now.Add(-age)
+	}
+
+	locks, err := lockClient.SearchLocks(filters, 0, false)
+	if err != nil {
+		return errorf("Error while retrieving locks: %v", err)
+	}
+
+	stale := make([]locking.Lock, 0, len(locks))
+	for _, lock := range locks {
+		if lock.Stale(now, cutoff) {
+			stale = append(stale, lock)
+		}
+		if locksCmdFlags.Limit > 0 && len(stale) >= locksCmdFlags.Limit {
+			break
+		}
+	}
+
+	if locksCmdFlags.JSON && !locksCmdFlags.Unlock {
+		if err := json.NewEncoder(os.Stdout).Encode(stale); err != nil {
+			Error(err.Error())
+		}
+		return nil
+	}
+
+	for _, lock := range stale {
+		if lock.Expired(now) {
+			Print("%s\t%s <%s>\texpired %s", lock.Path, lock.Name, lock.Email, lock.ExpiresAt.Local().Format(time.RFC1123))
+		} else {
+			Print("%s\t%s <%s>\tlocked %s", lock.Path, lock.Name, lock.Email, lock.LockedAt.Local().Format(time.RFC1123))
+		}
+	}
+
+	if !locksCmdFlags.Unlock {
+		Print("\n%d stale lock(s) matched query.", len(stale))
+		return nil
+	}
+
+	_, email := cfg.CurrentCommitter()
+	var unlocked, skipped, failed int
+	for _, lock := range stale {
+		if lock.Email != email && !locksCmdFlags.Force {
+			skipped++
+			continue
+		}
+
+		if err := lockClient.UnlockFileById(lock.Id, locksCmdFlags.Force); err != nil {
+			Error("Unable to unlock %s (%s): %v", lock.Path, lock.Id, err)
+			failed++
+			continue
+		}
+		unlocked++
+	}
+
+	Print("\nUnlocked %d stale lock(s).", unlocked)
+	if skipped > 0 {
+		Print("Skipped %d stale lock(s) held by others: use --force to unlock them.", skipped)
+	}
+	if failed > 0 {
+		return errorf("Failed to unlock %d stale lock(s).", failed)
 	}
-	Print("\n%d lock(s) matched query.", lockCount)
+	return nil
 }
 
 // locksFlags wraps up and holds all of the flags that can be given to the
@@ -55,6 +194,9 @@ type locksFlags struct {
 	// Path is an optional filter parameter to filter against the lock's
 	// path
 	Path string
+	// PathPrefix is an optional filter parameter to filter against the
+	// start of the lock's path, such as a directory
+	PathPrefix string
 	// Id is an optional filter parameter used to filtere against the lock's
 	// ID.
 	Id string
@@ -66,6 +208,18 @@ type locksFlags struct {
 	Local bool
 	// JSON is an optional parameter to output data in json format.
 	JSON bool
+	// Verify separates the locks held by the current committer from those
+	// held by others
+	Verify bool
+	// Stale limits the locks listed to those which have expired, or were
+	// taken longer ago than OlderThan
+	Stale bool
+	// OlderThan is the age, such as "30d", beyond which locks are stale
+	OlderThan string
+	// Unlock unlocks the stale locks which are listed
+	Unlock bool
+	// Force allows Unlock to break the locks of other users
+	Force bool
 }
 
 // Filters produces a filter based on locksFlags instance.
@@ -80,6 +234,14 @@ func (l *locksFlags) Filters() (map[string]string, error) {
 
 		filters["path"] = path
 	}
+	if l.PathPrefix != "" {
+		prefix, err := lockPathPrefix(l.PathPrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		filters["path_prefix"] = prefix
+	}
 	if l.Id != "" {
 		filters["id"] = l.Id
 	}
@@ -87,6 +249,39 @@ func (l *locksFlags) Filters() (map[string]string, error) {
 	return filters, nil
 }
 
+// lockPathPrefix returns the given prefix of paths, relative to the working
+// directory, relative to the root of the repository instead. Unlike lockPath,
+// nothing need exist at the prefix, and a trailing slash is kept, so that
+// "dir/" matches the files in "dir", but not those in "dir2".
+func lockPathPrefix(prefix string) (string, error) {
+	repo, err := git.RootDir()
+	if err != nil {
+		return "", err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(repo, filepath.Join(wd, prefix))
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("lfs: %s is outside repository", prefix)
+	}
+
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		rel = ""
+	}
+	if strings.HasSuffix(prefix, "/") && len(rel) > 0 {
+		rel += "/"
+	}
+	return rel, nil
+}
+
 func init() {
 	if !isCommandEnabled(cfg, "locks") {
 		return
@@ -95,9 +290,15 @@ func init() {
 	RegisterCommand("locks", locksCommand, func(cmd *cobra.Command) {
 		cmd.Flags().StringVarP(&lockRemote, "remote", "r", cfg.CurrentRemote, lockRemoteHelp)
 		cmd.Flags().StringVarP(&locksCmdFlags.Path, "path", "p", "", "filter locks results matching a particular path")
+		cmd.Flags().StringVarP(&locksCmdFlags.PathPrefix, "path-prefix", "", "", "filter locks results with paths starting with a prefix, such as a directory")
 		cmd.Flags().StringVarP(&locksCmdFlags.Id, "id", "i", "", "filter locks results matching a particular ID")
 		cmd.Flags().IntVarP(&locksCmdFlags.Limit, "limit", "l", 0, "optional limit for number of results to return")
 		cmd.Flags().BoolVarP(&locksCmdFlags.Local, "local", "", false, "only list cached local record of own locks")
 		cmd.Flags().BoolVarP(&locksCmdFlags.JSON, "json", "", false, "print output in json")
+		cmd.Flags().BoolVarP(&locksCmdFlags.Verify, "verify", "", false, "separate your locks from those of others")
+		cmd.Flags().BoolVarP(&locksCmdFlags.Stale, "stale", "", false, "only list locks which have expired, or are older than --older-than")
+		cmd.Flags().StringVarP(&locksCmdFlags.OlderThan, "older-than", "", "", "with --stale, the age beyond which locks are stale, such as \"30d\"")
+		cmd.Flags().BoolVarP(&locksCmdFlags.Unlock, "unlock", "", false, "with --stale, unlock the stale locks")
+		cmd.Flags().BoolVarP(&locksCmdFlags.Force, "force", "f", false, "with --stale --unlock, also break the stale locks of other users")
 	})
 }
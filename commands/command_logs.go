@@ -10,52 +10,61 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func logsCommand(cmd *cobra.Command, args []string) {
+func logsCommand(cmd *cobra.Command, args []string) error {
 	for _, path := range sortedLogs() {
 		Print(path)
 	}
+
+	return nil
 }
 
-func logsLastCommand(cmd *cobra.Command, args []string) {
+func logsLastCommand(cmd *cobra.Command, args []string) error {
 	logs := sortedLogs()
 	if len(logs) < 1 {
 		Print("No logs to show")
-		return
+		return nil
+	}
+
+	if err := logsShowCommand(cmd, logs[len(logs)-1:]); err != nil {
+		return err
 	}
 
-	logsShowCommand(cmd, logs[len(logs)-1:])
+	return nil
 }
 
-func logsShowCommand(cmd *cobra.Command, args []string) {
+func logsShowCommand(cmd *cobra.Command, args []string) error {
 	if len(args) == 0 {
 		Print("Supply a log name.")
-		return
+		return nil
 	}
 
 	name := args[0]
 	by, err := ioutil.ReadFile(filepath.Join(config.LocalLogDir, name))
 	if err != nil {
-		Exit("Error reading log: %s", name)
+		return errorf("Error reading log: %s", name)
 	}
 
 	Debug("Reading log: %s", name)
 	os.Stdout.Write(by)
+
+	return nil
 }
 
-func logsClearCommand(cmd *cobra.Command, args []string) {
+func logsClearCommand(cmd *cobra.Command, args []string) error {
 	err := os.RemoveAll(config.LocalLogDir)
 	if err != nil {
-		Panic(err, "Error clearing %s", config.LocalLogDir)
+		return loggedErrorf(err, "Error clearing %s", config.LocalLogDir)
 	}
 
 	Print("Cleared %s", config.LocalLogDir)
+
+	return nil
 }
 
-func logsBoomtownCommand(cmd *cobra.Command, args []string) {
+func logsBoomtownCommand(cmd *cobra.Command, args []string) error {
 	Debug("Debug message")
 	err := errors.Wrapf(errors.New("Inner error message!"), "Error")
-	Panic(err, "Welcome to Boomtown")
-	Debug("Never seen")
+	return loggedErrorf(err, "Welcome to Boomtown")
 }
 
 func sortedLogs() []string {
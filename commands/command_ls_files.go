@@ -12,8 +12,10 @@ var (
 	longOIDs = false
 )
 
-func lsFilesCommand(cmd *cobra.Command, args []string) {
-	requireInRepo()
+func lsFilesCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
 
 	var ref string
 
@@ -22,7 +24,7 @@ func lsFilesCommand(cmd *cobra.Command, args []string) {
 	} else {
 		fullref, err := git.CurrentRef()
 		if err != nil {
-			Exit(err.Error())
+			return errorf("%s", err)
 		}
 		ref = fullref.Sha
 	}
@@ -32,9 +34,12 @@ func lsFilesCommand(cmd *cobra.Command, args []string) {
 		showOidLen = 64
 	}
 
-	gitscanner := lfs.NewGitScanner(func(p *lfs.WrappedPointer, err error) {
+	var scanErr error
+	gitscanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
 		if err != nil {
-			Exit("Could not scan for Git LFS tree: %s", err)
+			if scanErr == nil {
+				scanErr = err
+			}
 			return
 		}
 
@@ -43,8 +48,13 @@ func lsFilesCommand(cmd *cobra.Command, args []string) {
 	defer gitscanner.Close()
 
 	if err := gitscanner.ScanTree(ref); err != nil {
-		Exit("Could not scan for Git LFS tree: %s", err)
+		return errorf("Could not scan for Git LFS tree: %s", err)
+	}
+	if scanErr != nil {
+		return errorf("Could not scan for Git LFS tree: %s", scanErr)
 	}
+
+	return nil
 }
 
 func lsFilesMarker(p *lfs.WrappedPointer) string {
@@ -0,0 +1,483 @@
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/localstorage"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// maintenanceRepoKey is the multi-valued global config key in which "git
+	// maintenance register" lists the repositories it maintains, whose Git
+	// LFS maintenance tasks run when due.
+	maintenanceRepoKey = "maintenance.repo"
+)
+
+var (
+	maintenanceTaskArgs    []string
+	maintenanceScheduleArg string
+	maintenanceAutoArg     bool
+)
+
+// maintenanceTask is a housekeeping task run by "git lfs maintenance run",
+// which runs on the given schedule unless configured otherwise.
+type maintenanceTask struct {
+	name     string
+	schedule string
+	run      func() bool
+}
+
+var maintenanceTasks = []*maintenanceTask{
+	{"prefetch", config.MaintenanceHourly, maintenancePrefetch},
+	{"prune", config.MaintenanceDaily, maintenancePrune},
+	{"verify", config.MaintenanceWeekly, maintenanceVerify},
+}
+
+// maintenanceFrequency orders the schedules from the least to the most
+// frequent, so that the tasks run for a schedule are those at least as frequent.
+var maintenanceFrequency = map[string]int{
+	config.MaintenanceWeekly: 1,
+	config.MaintenanceDaily:  2,
+	config.MaintenanceHourly: 3,
+}
+
+// maintenanceInterval is how long after it last ran a task on each schedule is
+// due to run again with --auto.
+var maintenanceInterval = map[string]time.Duration{
+	config.MaintenanceWeekly: 7 * 24 * time.Hour,
+	config.MaintenanceDaily:  24 * time.Hour,
+	config.MaintenanceHourly: time.Hour,
+}
+
+func maintenanceCommand(cmd *cobra.Command, args []string) error {
+	cmd.Help()
+
+	return nil
+}
+
+// maintenanceRunCommand runs the given tasks, or those which are enabled and
+// due on the given schedule or, with --auto, since they last ran, or all the
+// enabled ones. Registered repositories run it with --auto in the background.
+func maintenanceRunCommand(cmd *cobra.Command, args []string) error {
+	if err := requireGitVersion(); err != nil {
+		return err
+	}
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	discardOutputIfQuiet()
+
+	if len(maintenanceScheduleArg) > 0 && maintenanceFrequency[maintenanceScheduleArg] == 0 {
+		return errorf("Invalid schedule %q, expected hourly, daily or weekly", maintenanceScheduleArg)
+	}
+
+	tasks, err := maintenanceTasksToRun(maintenanceTaskArgs, maintenanceScheduleArg, maintenanceAutoArg)
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	unlock, ok := lockMaintenance()
+	if !ok {
+		tracerx.Printf("maintenance: skipping, as another run is in progress")
+		return nil
+	}
+	defer unlock()
+
+	var failed []string
+	for _, task := range tasks {
+		tracerx.Printf("maintenance: running the %s task", task.name)
+		ok := task.run()
+		markMaintenanceTaskRun(task)
+		if !ok {
+			failed = append(failed, task.name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return errorf("Maintenance tasks failed: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// maintenanceTasksToRun returns the tasks with the given names, or if none are
+// given, the enabled tasks which are due on the given schedule, and if auto is
+// set, since they last ran, or all the enabled tasks if neither is given.
+func maintenanceTasksToRun(names []string, schedule string, auto bool) ([]*maintenanceTask, error) {
+	var tasks []*maintenanceTask
+	if len(names) > 0 {
+		for _, name := range names {
+			task := findMaintenanceTask(name)
+			if task == nil {
+				return nil, errorf("Unknown maintenance task %q", name)
+			}
+			tasks = append(tasks, task)
+		}
+		return tasks, nil
+	}
+
+	for _, task := range maintenanceTasks {
+		if !cfg.MaintenanceTaskEnabled(task.name) {
+			continue
+		}
+		taskSchedule := cfg.MaintenanceTaskSchedule(task.name, task.schedule)
+		if len(schedule) > 0 && maintenanceFrequency[taskSchedule] < maintenanceFrequency[schedule] {
+			continue
+		}
+		if auto && !maintenanceTaskDue(task, taskSchedule) {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func findMaintenanceTask(name string) *maintenanceTask {
+	for _, task := range maintenanceTasks {
+		if task.name == name {
+			return task
+		}
+	}
+	return nil
+}
+
+// maintenanceTaskStamp returns the path of the file whose modification time is
+// when the given task last ran.
+func maintenanceTaskStamp(task *maintenanceTask) string {
+	return filepath.Join(config.LocalGitStorageDir, "lfs", "maintenance", task.name)
+}
+
+// maintenanceTaskDue returns whether the given task, which runs on the given
+// schedule, hasn't run within its interval.
+func maintenanceTaskDue(task *maintenanceTask, schedule string) bool {
+	stat, err := os.Stat(maintenanceTaskStamp(task))
+	if err != nil {
+		return true
+	}
+	return time.Since(stat.ModTime()) >= maintenanceInterval[schedule]
+}
+
+// markMaintenanceTaskRun records that the given task has just run, whether it
+// succeeded or not, so that a failing task isn't retried by every command.
+func markMaintenanceTaskRun(task *maintenanceTask) {
+	path := maintenanceTaskStamp(task)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		tracerx.Printf("maintenance: could not record the %s task: %s", task.name, err)
+		return
+	}
+	if err := ioutil.WriteFile(path, []byte(time.Now().Format(time.RFC3339)+"\n"), 0644); err != nil {
+		tracerx.Printf("maintenance: could not record the %s task: %s", task.name, err)
+	}
+}
+
+// lockMaintenance creates .git/lfs/maintenance.lock, so that a run which takes
+// longer than an hour isn't overlapped by the next one. It returns false if the
+// lock is held already, unless it is so old that the run holding it must have
+// died.
+func lockMaintenance() (func(), bool) {
+	path := filepath.Join(config.LocalGitStorageDir, "lfs", "maintenance.lock")
+	if stat, err := os.Stat(path); err == nil && time.Since(stat.ModTime()) > 24*time.Hour {
+		os.Remove(path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, false
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, false
+	}
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	f.Close()
+
+	return func() { os.Remove(path) }, true
+}
+
+// maintenancePrefetch downloads the objects of the recent commits on the
+// default remote, as "git lfs prefetch" does, so that they're local by the time
+// they're checked out. It does nothing in repositories without remotes, or if
+// lfs.offline is set.
+func maintenancePrefetch() bool {
+	if cfg.Offline() {
+		tracerx.Printf("maintenance: not prefetching, as Git LFS is offline")
+		return true
+	}
+
+	remote, err := git.DefaultRemote()
+	if err != nil {
+		tracerx.Printf("maintenance: not prefetching: %v", err)
+		return true
+	}
+	return prefetchOnce(remote, buildFilepathFilter(cfg, nil, nil), nil)
+}
+
+// maintenancePrune deletes old objects, as "git lfs prune" does.
+func maintenancePrune() bool {
+	fetchPruneConfig := cfg.FetchPruneConfig()
+	if err := prune(fetchPruneConfig, fetchPruneConfig.PruneVerifyRemoteAlways, true, false, false); err != nil {
+		printCommandError(err)
+		return false
+	}
+	return true
+}
+
+// maintenanceVerify checks the contents of every local object, whether stored
+// whole, as chunks or compressed, and removes the corrupt ones as "git lfs
+// fsck" does, so that they're downloaded again.
+func maintenanceVerify() bool {
+	var count int
+	var corrupt []string
+	seen := tools.NewStringSet()
+
+	verify := func(oid string) {
+		if !seen.Add(oid) {
+			return
+		}
+		count++
+		if !verifyLocalObject(oid) {
+			Print("Object %s is corrupt", oid)
+			corrupt = append(corrupt, oid)
+		}
+	}
+
+	for f := range lfs.ScanObjectsChan() {
+		verify(f.Oid)
+	}
+	for _, f := range append(localstorage.Chunks().Objects(), localstorage.Compressed().Objects()...) {
+		verify(f.Oid)
+	}
+
+	if len(corrupt) == 0 {
+		Print("Verified %d objects", count)
+		return true
+	}
+
+	if err := removeCorruptObjects(corrupt); err != nil {
+		LoggedError(err, "Could not remove corrupt objects: %v", err)
+		return false
+	}
+	return true
+}
+
+// verifyLocalObject returns whether the local object with the given OID has
+// the contents it should. Objects which can no longer be opened, as they have
+// been pruned since they were listed, are taken to be fine.
+func verifyLocalObject(oid string) bool {
+	f, err := lfs.OpenLocalObject(oid)
+	if err != nil {
+		tracerx.Printf("maintenance: unable to verify %s: %v", oid, err)
+		return true
+	}
+	defer f.Close()
+
+	oidHash := sha256.New()
+	if _, err := io.Copy(oidHash, f); err != nil {
+		return false
+	}
+	return hex.EncodeToString(oidHash.Sum(nil)) == oid
+}
+
+// maintenanceRegisterCommand adds the current repository to those whose
+// maintenance tasks run when due.
+func maintenanceRegisterCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+	if err := requireMaintenanceGitVersion(); err != nil {
+		return err
+	}
+	return registerMaintenance()
+}
+
+// maintenanceUnregisterCommand removes the current repository from those
+// whose maintenance tasks run when due.
+func maintenanceUnregisterCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+	if err := requireMaintenanceGitVersion(); err != nil {
+		return err
+	}
+	registered, err := unregisterMaintenance()
+	if err != nil {
+		return err
+	}
+	if !registered {
+		Print("%s isn't registered for Git LFS maintenance", maintenanceRepoPath())
+	}
+
+	return nil
+}
+
+// maintenanceStartCommand registers the current repository and has Git
+// schedule its background maintenance, as "git maintenance start" does.
+func maintenanceStartCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+	return startMaintenance()
+}
+
+// maintenanceStopCommand has Git remove its maintenance schedule, as "git
+// maintenance stop" does, leaving the repositories registered.
+func maintenanceStopCommand(cmd *cobra.Command, args []string) error {
+	if err := requireMaintenanceGitVersion(); err != nil {
+		return err
+	}
+	if err := gitMaintenance("stop"); err != nil {
+		return err
+	}
+	Print("Git maintenance schedule removed.")
+
+	return nil
+}
+
+// startMaintenance registers the current repository and has Git schedule its
+// background maintenance, as "git lfs maintenance start" and "git lfs install
+// --maintenance" do.
+func startMaintenance() error {
+	if err := requireMaintenanceGitVersion(); err != nil {
+		return err
+	}
+
+	registered := maintenanceRegistered()
+	if err := gitMaintenance("start"); err != nil {
+		return err
+	}
+	if !registered {
+		Print("Registered %s for Git LFS maintenance.", maintenanceRepoPath())
+	}
+	Print("Git LFS maintenance scheduled: prefetch hourly, prune daily and verify weekly, unless configured otherwise.")
+	return nil
+}
+
+func requireMaintenanceGitVersion() error {
+	if !git.Config.IsGitVersionAtLeast("2.29.0") {
+		return errorf("Git LFS maintenance requires git version >= 2.29.0, for `git maintenance`.")
+	}
+	return nil
+}
+
+// gitMaintenance runs "git maintenance" with the given args, which maintains
+// maintenance.repo and the schedules of the system's own scheduler, so that
+// Git LFS never edits them itself.
+func gitMaintenance(args ...string) error {
+	cmd := subprocess.ExecCommand("git", append([]string{"maintenance"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "git maintenance %s: %s", strings.Join(args, " "), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// maintenanceRepoPath returns the path by which Git registers the current
+// repository: that of its working tree, or of the repository itself if bare,
+// with any symbolic links resolved.
+func maintenanceRepoPath() string {
+	path := config.LocalWorkingDir
+	if len(path) == 0 {
+		path = config.LocalGitDir
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	return path
+}
+
+// maintenanceRegistered returns whether the current repository is listed in
+// maintenance.repo.
+func maintenanceRegistered() bool {
+	path := maintenanceRepoPath()
+	for _, repo := range git.Config.FindAllGlobal(maintenanceRepoKey) {
+		if repo == path {
+			return true
+		}
+	}
+	return false
+}
+
+func registerMaintenance() error {
+	if maintenanceRegistered() {
+		return nil
+	}
+
+	if err := gitMaintenance("register"); err != nil {
+		return err
+	}
+	Print("Registered %s for Git LFS maintenance.", maintenanceRepoPath())
+	return nil
+}
+
+// unregisterMaintenance removes the current repository from those whose
+// maintenance tasks run when due, returning false if it wasn't registered.
+func unregisterMaintenance() (bool, error) {
+	if !maintenanceRegistered() {
+		return false, nil
+	}
+
+	if err := gitMaintenance("unregister"); err != nil {
+		return false, err
+	}
+	Print("Unregistered %s from Git LFS maintenance.", maintenanceRepoPath())
+	return true, nil
+}
+
+// startAutoMaintenance runs "git lfs maintenance run --auto" in the
+// background if the current repository is registered and any of its enabled
+// tasks is due, as Git runs its own automatic maintenance after commands which
+// change the repository. Git's schedule can't run the Git LFS tasks, so they
+// run when the repository is next used instead.
+func startAutoMaintenance() {
+	if !maintenanceRegistered() {
+		return
+	}
+
+	tasks, err := maintenanceTasksToRun(nil, "", true)
+	if err != nil || len(tasks) == 0 {
+		return
+	}
+
+	pid, logPath, err := startBackgroundCommand("maintenance.log", "maintenance", "run", "--auto", "--quiet")
+	if err != nil {
+		tracerx.Printf("maintenance: could not start in the background: %s", err)
+		return
+	}
+	tracerx.Printf("maintenance: running the due tasks in the background (pid %d), logging to %s", pid, logPath)
+}
+
+func init() {
+	RegisterCommand("maintenance", maintenanceCommand, func(cmd *cobra.Command) {
+		run := NewCommand("run", maintenanceRunCommand)
+		run.Flags().StringSliceVar(&maintenanceTaskArgs, "task", nil, "Run the given tasks: prefetch, prune or verify")
+		run.Flags().StringVar(&maintenanceScheduleArg, "schedule", "", "Run the enabled tasks due hourly, daily or weekly")
+		run.Flags().BoolVar(&maintenanceAutoArg, "auto", false, "Run the enabled tasks which haven't run within their schedule")
+
+		cmd.AddCommand(run)
+		cmd.AddCommand(NewCommand("register", maintenanceRegisterCommand))
+		cmd.AddCommand(NewCommand("unregister", maintenanceUnregisterCommand))
+		cmd.AddCommand(NewCommand("start", maintenanceStartCommand))
+		cmd.AddCommand(NewCommand("stop", maintenanceStopCommand))
+	})
+}
@@ -0,0 +1,326 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/locking"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mergeDriverAncestor   string
+	mergeDriverCurrent    string
+	mergeDriverOther      string
+	mergeDriverOutput     string
+	mergeDriverPath       string
+	mergeDriverStrategy   string
+	mergeDriverProgram    string
+	mergeDriverMarkerSize int
+)
+
+// mergeDriverCommand resolves a conflict in a file tracked by Git LFS when Git
+// runs it as the file's merge driver. The files Git gives it contain pointers;
+// either one of them is chosen according to the strategy, or the contents they
+// point to are given to an external program to merge. Otherwise, the pointers
+// are merged as text, leaving the usual conflict markers.
+func mergeDriverCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	if len(mergeDriverAncestor) == 0 || len(mergeDriverCurrent) == 0 || len(mergeDriverOther) == 0 {
+		return errorf("merge-driver: --ancestor, --current and --other are required")
+	}
+	if len(mergeDriverOutput) == 0 {
+		mergeDriverOutput = mergeDriverCurrent
+	}
+
+	if len(mergeDriverProgram) == 0 {
+		mergeDriverProgram, _ = cfg.Git.Get("lfs.mergeprogram")
+	}
+
+	strategy := mergeDriverStrategy
+	if len(strategy) == 0 {
+		strategy, _ = cfg.Git.Get("lfs.mergestrategy")
+	}
+	if len(strategy) == 0 {
+		if len(mergeDriverProgram) > 0 {
+			strategy = "program"
+		} else {
+			strategy = "conflict"
+		}
+	}
+
+	var resolved string
+	var err error
+	switch strategy {
+	case "ours":
+		resolved = mergeDriverCurrent
+	case "theirs":
+		resolved = mergeDriverOther
+	case "newest":
+		resolved, err = mergeNewest()
+	case "locked-wins":
+		resolved, err = mergeLockedWins()
+	case "program":
+		if len(mergeDriverProgram) == 0 {
+			return errorf("merge-driver: the program strategy needs --program or lfs.mergeprogram")
+		}
+		err = mergeWithProgram()
+		resolved = mergeDriverOutput
+	case "conflict":
+	default:
+		return errorf("merge-driver: unknown strategy %q", strategy)
+	}
+
+	if err != nil {
+		Error("merge-driver: %s: %s", mergeDriverDisplayPath(), err)
+		resolved = ""
+	}
+
+	if len(resolved) == 0 {
+		if err := mergeDriverConflict(); err != nil {
+			return err
+		}
+		return codeErrorf(1, "")
+	}
+
+	if resolved != mergeDriverOutput {
+		if err := copyFile(resolved, mergeDriverOutput); err != nil {
+			return errorf("merge-driver: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// mergeNewest returns the side which was changed by the most recent commit, as
+// long as Git gave the file's path with --path.
+func mergeNewest() (string, error) {
+	if len(mergeDriverPath) == 0 {
+		return "", errors.New("the newest strategy needs the file's path, given with --path %P")
+	}
+
+	theirsRef := mergeOtherRef()
+	if len(theirsRef) == 0 {
+		return "", errors.New("could not find the commit being merged")
+	}
+
+	ours, err := lastChangedAt("HEAD", mergeDriverPath)
+	if err != nil {
+		return "", err
+	}
+	theirs, err := lastChangedAt(theirsRef, mergeDriverPath)
+	if err != nil {
+		return "", err
+	}
+
+	if theirs > ours {
+		return mergeDriverOther, nil
+	}
+	return mergeDriverCurrent, nil
+}
+
+// mergeOtherRef returns the commit being merged, rebased or picked onto HEAD,
+// or an empty string if there isn't one. While merging, Git sets
+// "GITHEAD_<sha>" in the environment for each of the commits being merged; the
+// refs below are only written once a merge stops.
+func mergeOtherRef() string {
+	head, _ := subprocess.SimpleExec("git", "rev-parse", "-q", "HEAD")
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, "GITHEAD_") {
+			continue
+		}
+
+		sha := strings.SplitN(strings.TrimPrefix(env, "GITHEAD_"), "=", 2)[0]
+		if sha != head {
+			return sha
+		}
+	}
+
+	for _, ref := range []string{"MERGE_HEAD", "REBASE_HEAD", "CHERRY_PICK_HEAD"} {
+		if _, err := subprocess.SimpleExec("git", "rev-parse", "--verify", "-q", ref); err == nil {
+			return ref
+		}
+	}
+	return ""
+}
+
+// lastChangedAt returns the committer timestamp of the last commit reachable
+// from ref which changed the given path.
+func lastChangedAt(ref, path string) (int64, error) {
+	out, err := subprocess.SimpleExec("git", "log", "-1", "--format=%ct", ref, "--", path)
+	if err != nil {
+		return 0, err
+	}
+	if len(out) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(out, 10, 64)
+}
+
+// mergeLockedWins returns our side if we hold the file's lock, or theirs if
+// somebody else does.
+func mergeLockedWins() (string, error) {
+	if len(mergeDriverPath) == 0 {
+		return "", errors.New("the locked-wins strategy needs the file's path, given with --path %P")
+	}
+
+	client, err := locking.NewClient(cfg)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	filter := map[string]string{"path": mergeDriverPath}
+
+	// the local cache only holds the locks that we own.
+	ours, err := client.SearchLocks(filter, 1, true)
+	if err != nil {
+		return "", err
+	}
+	if len(ours) > 0 {
+		return mergeDriverCurrent, nil
+	}
+
+	locks, err := client.SearchLocks(filter, 1, false)
+	if err != nil {
+		return "", err
+	}
+	if len(locks) > 0 {
+		return mergeDriverOther, nil
+	}
+	return "", errors.New("the file is not locked")
+}
+
+// mergeWithProgram writes the contents of each side to temporary files, and
+// runs the merge program with them, replacing "%A", "%O" and "%B" with the
+// current, ancestor and other files and "%D" with the file it should write its
+// result to. If it succeeds, the result is stored as a Git LFS object and its
+// pointer written to the output.
+func mergeWithProgram() error {
+	tmpdir, err := ioutil.TempDir(lfs.TempDir(), "merge")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	ext := filepath.Ext(mergeDriverPath)
+	files := make(map[string]string)
+	for _, side := range []struct{ name, placeholder, path string }{
+		{"ancestor", "%O", mergeDriverAncestor},
+		{"current", "%A", mergeDriverCurrent},
+		{"other", "%B", mergeDriverOther},
+	} {
+		dest := filepath.Join(tmpdir, side.name+ext)
+		if err := materializeMergeFile(side.path, dest); err != nil {
+			return errors.Wrap(err, side.name)
+		}
+		files[side.placeholder] = dest
+	}
+	files["%D"] = filepath.Join(tmpdir, "result"+ext)
+	files["%P"] = mergeDriverPath
+
+	// The placeholders are replaced in a single pass, so that a path
+	// containing one, such as "50%D.psd", isn't replaced in turn.
+	var replacements []string
+	for _, placeholder := range []string{"%O", "%A", "%B", "%D", "%P"} {
+		replacements = append(replacements, placeholder, shellQuote(files[placeholder]))
+	}
+	command := strings.NewReplacer(replacements...).Replace(mergeDriverProgram)
+
+	program := subprocess.ExecCommand("sh", "-c", command)
+	program.Stdin = os.Stdin
+	program.Stdout = os.Stderr
+	program.Stderr = os.Stderr
+	if err := program.Run(); err != nil {
+		return errors.Wrap(err, "merge program")
+	}
+
+	result, err := os.Open(files["%D"])
+	if err != nil {
+		return errors.Wrap(err, "merge program result")
+	}
+	defer result.Close()
+
+	var pointer bytes.Buffer
+	if err := clean(&pointer, result, files["%D"]); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(mergeDriverOutput, pointer.Bytes(), 0644)
+}
+
+// materializeMergeFile writes the contents of the Git LFS object that the
+// pointer in the file at src points to to dest, downloading it if necessary.
+// Files which aren't pointers are copied as they are.
+func materializeMergeFile(src, dest string) error {
+	p, err := lfs.DecodePointerFromFile(src)
+	if err == nil {
+		return lfs.PointerSmudgeToFile(dest, p, true, TransferManifest(), nil)
+	} else if !errors.IsNotAPointerError(err) {
+		return err
+	}
+	return copyFile(src, dest)
+}
+
+// mergeDriverConflict merges the pointers in the current and other files as
+// text into the output, leaving conflict markers, as Git would have done
+// without the merge driver.
+func mergeDriverConflict() error {
+	output := mergeDriverCurrent
+	if mergeDriverOutput != mergeDriverCurrent {
+		if err := copyFile(mergeDriverCurrent, mergeDriverOutput); err != nil {
+			return errorf("merge-driver: %s", err)
+		}
+		output = mergeDriverOutput
+	}
+
+	// git merge-file exits with the number of conflicts, so its
+	// error is expected.
+	subprocess.SimpleExec("git", "merge-file",
+		"--marker-size", strconv.Itoa(mergeDriverMarkerSize),
+		"-L", "ours", "-L", "base", "-L", "theirs",
+		output, mergeDriverAncestor, mergeDriverOther)
+	return nil
+}
+
+func mergeDriverDisplayPath() string {
+	if len(mergeDriverPath) > 0 {
+		return mergeDriverPath
+	}
+	return mergeDriverCurrent
+}
+
+func copyFile(src, dest string) error {
+	by, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dest, by, 0644)
+}
+
+// shellQuote quotes s to be passed as a single argument to sh.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func init() {
+	RegisterCommand("merge-driver", mergeDriverCommand, func(cmd *cobra.Command) {
+		cmd.Flags().StringVar(&mergeDriverAncestor, "ancestor", "", "The file containing the merge base version (%O)")
+		cmd.Flags().StringVar(&mergeDriverCurrent, "current", "", "The file containing our version (%A)")
+		cmd.Flags().StringVar(&mergeDriverOther, "other", "", "The file containing their version (%B)")
+		cmd.Flags().StringVar(&mergeDriverOutput, "output", "", "The file to write the result to (default: --current)")
+		cmd.Flags().StringVar(&mergeDriverPath, "path", "", "The path of the file being merged (%P)")
+		cmd.Flags().StringVarP(&mergeDriverStrategy, "strategy", "s", "", "How to resolve the conflict: conflict, ours, theirs, newest, locked-wins or program")
+		cmd.Flags().StringVarP(&mergeDriverProgram, "program", "p", "", "A program to merge the contents of each side with")
+		cmd.Flags().IntVar(&mergeDriverMarkerSize, "marker-size", 7, "The length of conflict markers (%L)")
+	})
+}
@@ -0,0 +1,304 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"path/filepath"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/filepathfilter"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/git/githistory"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateFixup      bool
+	migrateIncludeArg string
+	migrateExcludeArg string
+)
+
+func migrateCommand(cmd *cobra.Command, args []string) error {
+	cmd.Usage()
+
+	return nil
+}
+
+// migrateImportCommand converts files committed to the current branch, but
+// not yet pushed, into Git LFS pointers.
+func migrateImportCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	if migrateFixup && (len(migrateIncludeArg) > 0 || len(migrateExcludeArg) > 0) {
+		return errorf("migrate import: --fixup cannot be combined with --include or --exclude")
+	}
+	if !migrateFixup && len(migrateIncludeArg) == 0 {
+		return errorf("migrate import: one of --fixup or --include is required")
+	}
+
+	ref, err := git.CurrentRef()
+	if err != nil {
+		return errorf("migrate import: could not resolve HEAD: %s", err)
+	}
+	if ref.Type != git.RefTypeLocalBranch {
+		return errorf("migrate import: HEAD must be a branch, not a detached commit")
+	}
+
+	var tracked func(name string) bool
+	if migrateFixup {
+		// The branch tip's attributes are used for every commit, so
+		// that files committed before they were tracked are converted
+		// too.
+		attributes, err := lfsTrackedAttributes(ref.Sha)
+		if err != nil {
+			return errorf("migrate import: could not read .gitattributes: %s", err)
+		}
+		if attributes == nil {
+			Print("migrate import: no files are tracked by Git LFS in .gitattributes")
+			return nil
+		}
+		tracked = attributes.TracksWithLFS
+	} else {
+		filter := filepathfilter.New(tools.CleanPaths(migrateIncludeArg, ","), tools.CleanPaths(migrateExcludeArg, ","))
+		tracked = func(name string) bool {
+			return filter.Allows(filepath.FromSlash(name))
+		}
+	}
+
+	if err := requireMigratableWorkingCopy(tracked); err != nil {
+		return err
+	}
+
+	var converted int
+	pointers := make(map[string]string)
+
+	rewriter := githistory.NewRewriter()
+	err = rewriter.Rewrite(&githistory.RewriteOptions{
+		Include: []string{ref.Sha},
+		Exclude: unpushedExclusions(),
+		BlobFn: func(c *githistory.Commit, entry *githistory.TreeEntry) (string, error) {
+			if !trackedByFilter(tracked, entry.Path) {
+				return entry.Oid, nil
+			}
+
+			if oid, ok := pointers[entry.Oid]; ok {
+				return oid, nil
+			}
+
+			oid, err := migrateBlob(entry)
+			if err != nil {
+				return "", err
+			}
+			if oid != entry.Oid {
+				Debug("migrate: %s %s -> %s", entry.Path, entry.Oid, oid)
+				converted++
+			}
+
+			pointers[entry.Oid] = oid
+			return oid, nil
+		},
+	})
+	if err != nil {
+		return errorf("migrate import: %s", err)
+	}
+
+	newSha := rewriter.Rewritten(ref.Sha)
+	if newSha == ref.Sha {
+		Print("migrate import: nothing to convert on %s", ref.Name)
+		return nil
+	}
+
+	if _, err := subprocess.SimpleExec("git", "update-ref", "-m", "git lfs migrate import", "refs/heads/"+ref.Name, newSha, ref.Sha); err != nil {
+		return errorf("migrate import: could not update %s: %s", ref.Name, err)
+	}
+
+	// The working copy was clean, so it's safe to check out the rewritten
+	// commit over it: only the converted files will change in the index.
+	if _, err := subprocess.SimpleExec("git", "reset", "--hard", "-q", newSha); err != nil {
+		return errorf("migrate import: could not check out %s: %s", newSha, err)
+	}
+
+	Print("migrate import: converted %d file(s) on %s (%s -> %s)", converted, ref.Name, ref.Sha[0:7], newSha[0:7])
+
+	return nil
+}
+
+// requireMigratableWorkingCopy fails unless the working copy is clean, since it
+// is checked out again once the branch has been rewritten. Files which only
+// appear to be modified because they are now tracked by Git LFS, and will be
+// converted, are allowed.
+func requireMigratableWorkingCopy(tracked func(name string) bool) error {
+	changes, err := git.WorkingCopyChanges()
+	if err != nil {
+		return errorf("migrate import: could not check working copy: %s", err)
+	}
+
+	for name, status := range changes {
+		if status == " M" && tracked(name) && !modifiedWithoutFilters(name) {
+			continue
+		}
+
+		return errorf("migrate import: working copy has uncommitted changes, commit or stash them first")
+	}
+	return nil
+}
+
+// modifiedWithoutFilters returns whether the given file, relative to the root
+// of the repository, differs from HEAD when its contents are hashed as they are
+// rather than through its clean filter.
+func modifiedWithoutFilters(name string) bool {
+	blob, err := subprocess.SimpleExec("git", "rev-parse", "HEAD:"+name)
+	if err != nil {
+		return true
+	}
+
+	oid, err := subprocess.SimpleExec("git", "hash-object", "--no-filters", filepath.Join(config.LocalWorkingDir, name))
+	if err != nil {
+		return true
+	}
+	return oid != blob
+}
+
+// unpushedExclusions returns the revisions whose history should not be
+// rewritten: the upstream of the current branch if it has one, otherwise
+// everything which has been pushed to any remote.
+func unpushedExclusions() []string {
+	if upstream, err := git.RemoteRefNameForCurrentBranch(); err == nil {
+		if _, err := git.ResolveRef(upstream); err == nil {
+			return []string{upstream}
+		}
+	}
+	return []string{"--remotes"}
+}
+
+// migrateBlob cleans the contents of the given blob into the local object
+// store, and returns the SHA-1 of a blob containing its pointer. Blobs that are
+// already pointers are left as they are.
+func migrateBlob(entry *githistory.TreeEntry) (string, error) {
+	blob, err := githistory.ReadBlob(entry.Oid)
+	if err != nil {
+		return "", err
+	}
+	defer blob.Close()
+
+	var pointer bytes.Buffer
+	if err := clean(&pointer, blob, entry.Path); err != nil {
+		return "", err
+	}
+
+	return githistory.WriteBlob(&pointer)
+}
+
+// lfsTrackedAttributes returns a matcher of the .gitattributes files in the
+// given commit, or nil if none of them track files with Git LFS.
+func lfsTrackedAttributes(sha string) (*lfs.AttributeMatcher, error) {
+	entries, err := githistory.LsTree(sha)
+	if err != nil {
+		return nil, err
+	}
+
+	// attribute macros may only be defined in the root .gitattributes
+	macros := lfs.NewAttributeMacroSet()
+	for _, entry := range entries {
+		if entry.Path == ".gitattributes" {
+			if err := readAttributeMacros(macros, entry); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var lines []*lfs.AttributesLine
+	tracks := false
+	for _, entry := range entries {
+		if path.Base(entry.Path) != ".gitattributes" {
+			continue
+		}
+
+		l, err := attributesBlobLines(entry)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range l {
+			tracks = tracks || macros.TracksWithLFS(line.Attrs)
+		}
+		lines = append(lines, l...)
+	}
+
+	if !tracks {
+		return nil, nil
+	}
+	return lfs.NewAttributeMatcher(lines, macros, false), nil
+}
+
+// trackedByFilter returns whether the file at the given slash-separated path
+// is selected by tracked, other than .gitattributes files themselves.
+func trackedByFilter(tracked func(name string) bool, name string) bool {
+	return path.Base(name) != ".gitattributes" && tracked(name)
+}
+
+// attributesBlobLines returns the lines of the given .gitattributes blob which
+// give patterns attributes, in the same way as lfs.ReadAttributesLines.
+func attributesBlobLines(entry *githistory.TreeEntry) ([]*lfs.AttributesLine, error) {
+	blob, err := githistory.ReadBlob(entry.Oid)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	dir := path.Dir(entry.Path)
+	if dir == "." {
+		dir = ""
+	}
+
+	var lines []*lfs.AttributesLine
+	scanner := bufio.NewScanner(blob)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		if pattern, attrs, ok := lfs.ParseAttributesLine(scanner.Text()); ok {
+			lines = append(lines, &lfs.AttributesLine{
+				Source: entry.Path, LineNo: lineNo, Dir: dir,
+				Pattern: pattern, Attrs: attrs,
+			})
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// readAttributeMacros adds the attribute macros defined in the given
+// .gitattributes blob to macros.
+func readAttributeMacros(macros lfs.AttributeMacroSet, entry *githistory.TreeEntry) error {
+	blob, err := githistory.ReadBlob(entry.Oid)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	return macros.Read(blob)
+}
+
+func init() {
+	RegisterCommand("migrate", migrateCommand, func(cmd *cobra.Command) {
+		importCmd := NewCommand("import", migrateImportCommand)
+		importCmd.Flags().BoolVar(&migrateFixup, "fixup", false, "Convert files which .gitattributes says should be tracked by Git LFS.")
+		importCmd.Flags().StringVarP(&migrateIncludeArg, "include", "I", "", "Include a list of paths")
+		importCmd.Flags().StringVarP(&migrateExcludeArg, "exclude", "X", "", "Exclude a list of paths")
+		importCmd.SetUsageFunc(func(*cobra.Command) error {
+			printHelp("migrate")
+			return nil
+		})
+		cmd.AddCommand(importCmd)
+
+		remoteCmd := NewCommand("remote", migrateRemoteCommand)
+		remoteCmd.Flags().StringVarP(&migrateRemoteName, "remote", "r", "", "Remote whose Git LFS server to migrate from")
+		remoteCmd.SetUsageFunc(func(*cobra.Command) error {
+			printHelp("migrate")
+			return nil
+		})
+		cmd.AddCommand(remoteCmd)
+	})
+}
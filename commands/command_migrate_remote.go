@@ -0,0 +1,205 @@
+package commands
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/git-lfs/git-lfs/tq"
+	"github.com/rubyist/tracerx"
+	"github.com/spf13/cobra"
+)
+
+var migrateRemoteName string
+
+// migrateRemoteCommand moves every object referenced by any ref from the Git
+// LFS server of a remote to the one at the given URL, and, once the new server
+// has them all, configures the remote to use it.
+func migrateRemoteCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	if len(args) != 1 {
+		Print("Usage: git lfs migrate remote [--remote=<name>] <url>")
+		return nil
+	}
+
+	remote := migrateRemoteName
+	if len(remote) == 0 {
+		var err error
+		if remote, err = git.DefaultRemote(); err != nil {
+			return errorf("migrate remote: no default remote")
+		}
+	}
+	if err := git.ValidateRemote(remote); err != nil {
+		return errorf("migrate remote: invalid remote name %q", remote)
+	}
+	cfg.CurrentRemote = remote
+
+	oldUrls := tools.NewStringSet()
+	oldUrls.Add(cfg.Endpoint("download").Url)
+	oldUrls.Add(cfg.Endpoint("upload").Url)
+	newEndpoint := config.NewEndpointWithConfig(args[0], cfg)
+	if oldUrls.Contains(newEndpoint.Url) && len(oldUrls) == 1 {
+		Print("migrate remote: %s already uses %s", remote, newEndpoint.Url)
+		return nil
+	}
+
+	pointers, err := scanAll()
+	if err != nil {
+		return err
+	}
+	ok, err := fetchAndReportToChan(pointers, nil, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errorf("migrate remote: could not fetch every object from %s; nothing was changed", cfg.Endpoint("download").Url)
+	}
+
+	cfg.SetManualEndpoint(newEndpoint)
+
+	Print("Uploading objects to %s...", newEndpoint.Url)
+	ctx := newUploadContext(false)
+	if err := uploadPointers(ctx, pointers); err != nil {
+		return err
+	}
+	ctx.summary.Print(false)
+
+	missing, err := migrateRemoteMissing(pointers)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		for _, oid := range missing {
+			Error("migrate remote: %s is missing from %s", oid, newEndpoint.Url)
+		}
+		return errorf("migrate remote: %d object(s) are missing from %s; nothing was changed", len(missing), newEndpoint.Url)
+	}
+
+	changed, err := migrateRemoteConfig(remote, oldUrls, newEndpoint.Url)
+	if err != nil {
+		return errorf("migrate remote: could not configure %s: %s", remote, err)
+	}
+	for _, c := range changed {
+		Print("migrate remote: set %s", c)
+	}
+	Print("migrate remote: %s now uses %s", remote, newEndpoint.Url)
+
+	return nil
+}
+
+// migrateRemoteMissing asks the Git LFS server of the current endpoint which of
+// the given pointers' objects it has, and returns the oids of those it doesn't.
+// It fails if the server can't be asked.
+func migrateRemoteMissing(pointers []*lfs.WrappedPointer) ([]string, error) {
+	q := newDownloadCheckQueue()
+	watch := q.Watch()
+
+	found := tools.NewStringSet()
+	done := make(chan struct{})
+	go func() {
+		for oid := range watch {
+			found.Add(oid)
+		}
+		close(done)
+	}()
+
+	queued := tools.NewStringSet()
+	for _, p := range pointers {
+		if queued.Add(p.Oid) {
+			q.Add(downloadTransfer(p))
+		}
+	}
+	q.Wait()
+	<-done
+
+	// The server answers that it doesn't have an object with an error for
+	// it; any other error means it couldn't be asked.
+	for _, err := range q.Errors() {
+		tracerx.Printf("migrate remote: %s", err)
+		if terr, ok := err.(*tq.TransferError); !ok || terr.StatusCode != 404 {
+			return nil, errorf("migrate remote: could not check the objects on the new server: %s", err)
+		}
+	}
+
+	var missing []string
+	for oid := range queued {
+		if !found.Contains(oid) {
+			missing = append(missing, oid)
+		}
+	}
+	return missing, nil
+}
+
+// migrateRemoteConfig replaces the endpoints which are set to any of the old
+// URLs, in .lfsconfig and the repository's config, with the new URL, and
+// returns the settings it changed. If none are set, remote.<remote>.lfsurl is
+// set in the repository's config.
+func migrateRemoteConfig(remote string, oldUrls tools.StringSet, newUrl string) ([]string, error) {
+	files := []string{filepath.Join(config.LocalGitDir, "config")}
+	if lfsconfig := filepath.Join(config.LocalWorkingDir, ".lfsconfig"); tools.FileExists(lfsconfig) {
+		files = append([]string{lfsconfig}, files...)
+	}
+
+	var changed []string
+	for _, file := range files {
+		lines, err := subprocess.SimpleExec("git", "config", "-l", "-f", file)
+		if err != nil {
+			return changed, err
+		}
+
+		for _, line := range strings.Split(lines, "\n") {
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 || !isEndpointKey(remote, parts[0]) {
+				continue
+			}
+			if !oldUrls.Contains(parts[1]) && !oldUrls.Contains(config.NewEndpointWithConfig(parts[1], cfg).Url) {
+				continue
+			}
+
+			if _, err := git.Config.SetLocal(file, parts[0], newUrl); err != nil {
+				return changed, err
+			}
+			changed = append(changed, migrateRemoteSetting(file, parts[0], newUrl))
+		}
+	}
+
+	if len(changed) > 0 {
+		return changed, nil
+	}
+
+	key := "remote." + remote + ".lfsurl"
+	if _, err := git.Config.SetLocal(files[len(files)-1], key, newUrl); err != nil {
+		return nil, err
+	}
+	return []string{migrateRemoteSetting(files[len(files)-1], key, newUrl)}, nil
+}
+
+// migrateRemoteSetting describes the setting of the given key in the given file,
+// as "key=value (in .lfsconfig)".
+func migrateRemoteSetting(file, key, value string) string {
+	name := filepath.Base(file)
+	if name == "config" {
+		name = ".git/config"
+	}
+	return key + "=" + value + " (in " + name + ")"
+}
+
+// isEndpointKey returns whether k is a config key which sets the endpoint of
+// the given remote: lfs.url, lfs.pushurl, lfs.pullurl, their "lfs.<ref>."
+// forms, or remote.<remote>.lfsurl, lfspushurl or lfspullurl.
+func isEndpointKey(remote, k string) bool {
+	switch k {
+	case "lfs.url", "lfs.pushurl", "lfs.pullurl",
+		"remote." + remote + ".lfsurl", "remote." + remote + ".lfspushurl", "remote." + remote + ".lfspullurl":
+		return true
+	}
+	return strings.HasPrefix(k, "lfs.refs/") &&
+		(strings.HasSuffix(k, ".url") || strings.HasSuffix(k, ".pushurl") || strings.HasSuffix(k, ".pullurl"))
+}
@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/tq"
+	"github.com/spf13/cobra"
+)
+
+var (
+	peersPortArg int
+)
+
+// peersCommand lists the peers in the local network which serve objects to
+// this repository's clients, as downloads would find them.
+func peersCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	peers, err := tq.DiscoverPeers(cfg.PeerPort(), cfg.PeerAddresses(), cfg.PeerSecret(), cfg.PeerDiscoveryTimeout())
+	if err != nil {
+		return errorf("Cannot look for peers: %s", err)
+	}
+	if len(peers) == 0 {
+		Print("No peers found")
+		return nil
+	}
+	for _, peer := range peers {
+		Print(peer)
+	}
+
+	return nil
+}
+
+// peersServeCommand serves the objects stored in this repository to the peers
+// in the local network sharing its secret, until it's interrupted.
+func peersServeCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	server, err := tq.NewPeerServer(cfg.PeerSecret(), lfs.OpenLocalObject)
+	if err != nil {
+		return errorf("Cannot serve peers: %s", err)
+	}
+
+	port := cfg.PeerPort()
+	if peersPortArg > 0 {
+		port = peersPortArg
+	}
+	addr := net.JoinHostPort("", strconv.Itoa(port))
+
+	probes, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return errorf("Cannot listen for peers on UDP port %d: %s", port, err)
+	}
+	defer probes.Close()
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errorf("Cannot serve peers on TCP port %d: %s", port, err)
+	}
+	defer l.Close()
+
+	Print("Serving Git LFS objects to peers on port %d", port)
+	if err := server.Serve(probes, l); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func init() {
+	RegisterCommand("peers", peersCommand, func(cmd *cobra.Command) {
+		serve := NewCommand("serve", peersServeCommand)
+		serve.Flags().IntVarP(&peersPortArg, "port", "p", 0, "Serve peers on the given port instead of lfs.peers.port")
+
+		cmd.AddCommand(serve)
+	})
+}
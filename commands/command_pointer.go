@@ -18,9 +18,17 @@ var (
 	pointerFile    string
 	pointerCompare string
 	pointerStdin   bool
+	pointerFix     bool
 )
 
-func pointerCommand(cmd *cobra.Command, args []string) {
+func pointerCommand(cmd *cobra.Command, args []string) error {
+	if pointerFix {
+		if len(pointerFile) > 0 || len(pointerCompare) > 0 || pointerStdin {
+			return codeErrorf(1, "Cannot combine --fix with --file, --pointer or --stdin.")
+		}
+		return fixPointers(args)
+	}
+
 	comparing := false
 	something := false
 	buildOid := ""
@@ -34,8 +42,7 @@ func pointerCommand(cmd *cobra.Command, args []string) {
 		something = true
 		buildFile, err := os.Open(pointerFile)
 		if err != nil {
-			Error(err.Error())
-			os.Exit(1)
+			return codeErrorf(1, "%s", err)
 		}
 
 		oidHash := sha256.New()
@@ -43,8 +50,7 @@ func pointerCommand(cmd *cobra.Command, args []string) {
 		buildFile.Close()
 
 		if err != nil {
-			Error(err.Error())
-			os.Exit(1)
+			return codeErrorf(1, "%s", err)
 		}
 
 		ptr := lfs.NewPointer(hex.EncodeToString(oidHash.Sum(nil)), size, nil)
@@ -53,7 +59,10 @@ func pointerCommand(cmd *cobra.Command, args []string) {
 		lfs.EncodePointer(io.MultiWriter(os.Stdout, buf), ptr)
 
 		if comparing {
-			buildOid = gitHashObject(buf.Bytes())
+			buildOid, err = gitHashObject(buf.Bytes())
+			if err != nil {
+				return err
+			}
 			fmt.Fprintf(os.Stderr, "\nGit blob OID: %s\n\n", buildOid)
 		}
 	} else {
@@ -64,8 +73,7 @@ func pointerCommand(cmd *cobra.Command, args []string) {
 		something = true
 		compFile, err := pointerReader()
 		if err != nil {
-			Error(err.Error())
-			os.Exit(1)
+			return codeErrorf(1, "%s", err)
 		}
 
 		buf := &bytes.Buffer{}
@@ -80,26 +88,29 @@ func pointerCommand(cmd *cobra.Command, args []string) {
 		fmt.Fprintf(os.Stderr, "Pointer from %s\n\n", pointerName)
 
 		if err != nil {
-			Error(err.Error())
-			os.Exit(1)
+			return codeErrorf(1, "%s", err)
 		}
 
 		fmt.Fprintf(os.Stderr, buf.String())
 		if comparing {
-			compareOid = gitHashObject(buf.Bytes())
+			compareOid, err = gitHashObject(buf.Bytes())
+			if err != nil {
+				return err
+			}
 			fmt.Fprintf(os.Stderr, "\nGit blob OID: %s\n", compareOid)
 		}
 	}
 
 	if comparing && buildOid != compareOid {
 		fmt.Fprintf(os.Stderr, "\nPointers do not match\n")
-		os.Exit(1)
+		return codeErrorf(1, "")
 	}
 
 	if !something {
-		Error("Nothing to do!")
-		os.Exit(1)
+		return codeErrorf(1, "Nothing to do!")
 	}
+
+	return nil
 }
 
 func pointerReader() (io.ReadCloser, error) {
@@ -111,21 +122,22 @@ func pointerReader() (io.ReadCloser, error) {
 		return os.Open(pointerCompare)
 	}
 
-	requireStdin("The --stdin flag expects a pointer file from STDIN.")
+	if err := requireStdin("The --stdin flag expects a pointer file from STDIN."); err != nil {
+		return nil, err
+	}
 
 	return os.Stdin, nil
 }
 
-func gitHashObject(by []byte) string {
+func gitHashObject(by []byte) (string, error) {
 	cmd := exec.Command("git", "hash-object", "--stdin")
 	cmd.Stdin = bytes.NewReader(by)
 	out, err := cmd.Output()
 	if err != nil {
-		Error("Error building Git blob OID: %s", err)
-		os.Exit(1)
+		return "", codeErrorf(1, "Error building Git blob OID: %s", err)
 	}
 
-	return string(bytes.TrimSpace(out))
+	return string(bytes.TrimSpace(out)), nil
 }
 
 func init() {
@@ -133,5 +145,14 @@ func init() {
 		cmd.Flags().StringVarP(&pointerFile, "file", "f", "", "Path to a local file to generate the pointer from.")
 		cmd.Flags().StringVarP(&pointerCompare, "pointer", "p", "", "Path to a local file containing a pointer built by another Git LFS implementation.")
 		cmd.Flags().BoolVarP(&pointerStdin, "stdin", "", false, "Read a pointer built by another Git LFS implementation through STDIN.")
+		cmd.Flags().BoolVarP(&pointerFix, "fix", "", false, "Rewrite staged pointers which aren't in their canonical form.")
+
+		verifyTreeCmd := NewCommand("verify-tree", verifyTreeCommand)
+		verifyTreeCmd.Flags().BoolVarP(&verifyTreeSkipServer, "no-server-check", "", false, "Don't check that the Git LFS server has the objects.")
+		verifyTreeCmd.SetUsageFunc(func(*cobra.Command) error {
+			printHelp("pointer")
+			return nil
+		})
+		cmd.AddCommand(verifyTreeCmd)
 	})
 }
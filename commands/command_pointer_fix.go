@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/filepathfilter"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/git/githistory"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/subprocess"
+)
+
+// fixPointers rewrites the pointers staged in the index which aren't in their
+// canonical form, such as those with CRLF line endings, a byte order mark or
+// keys out of order, so that the fix can be committed. Files in the working
+// copy which hold such a pointer, rather than the object's contents, are
+// rewritten too. Only the files under the given paths are fixed, if any are
+// given.
+func fixPointers(paths []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	var filter *filepathfilter.Filter
+	if len(paths) > 0 {
+		include := make([]string, 0, len(paths))
+		for _, p := range paths {
+			include = append(include, repoRelativePath(p))
+		}
+		filter = filepathfilter.New(include, nil)
+	}
+
+	entries, err := git.IndexEntries()
+	if err != nil {
+		return err
+	}
+
+	fixed := 0
+	for _, entry := range entries {
+		if !entry.IsRegular() || !filter.Allows(entry.Path) {
+			continue
+		}
+
+		data, err := readPointerBlob(entry.Sha1)
+		if err != nil {
+			continue
+		}
+		p, err := lfs.DecodePointer(bytes.NewReader(data))
+		if err != nil || len(p.Normalized) == 0 {
+			continue
+		}
+
+		if err := fixPointer(entry, data, p); err != nil {
+			return errorf("Could not fix the pointer in %s: %s", entry.Path, err)
+		}
+		Print("Fixed %s, which had %s", entry.Path, strings.Join(p.Normalized, " and "))
+		fixed++
+	}
+
+	if fixed == 0 {
+		Print("No pointers to fix")
+		return nil
+	}
+	Print("Fixed %d pointer(s); commit them to store the fixes", fixed)
+	return nil
+}
+
+// fixPointer stages the canonical form of the given pointer, which was decoded
+// from the given data in the given index entry, in place of that data, and
+// writes it to the working copy if the file there holds the same data.
+func fixPointer(entry *git.BlobEntry, data []byte, p *lfs.Pointer) error {
+	canonical := p.Encoded()
+	sha, err := githistory.WriteBlob(strings.NewReader(canonical))
+	if err != nil {
+		return err
+	}
+
+	if _, err := subprocess.SimpleExec("git", "update-index", "--cacheinfo", entry.Mode, sha, entry.Path); err != nil {
+		return err
+	}
+
+	path := filepath.Join(config.LocalWorkingDir, entry.Path)
+	fi, err := os.Stat(path)
+	if err != nil || fi.Size() != int64(len(data)) {
+		return nil
+	}
+	if contents, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(contents, data) {
+		return nil
+	}
+	return ioutil.WriteFile(path, []byte(canonical), fi.Mode())
+}
+
+// repoRelativePath returns the given path, relative to the current directory,
+// relative to the root of the working copy instead.
+func repoRelativePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(config.LocalWorkingDir, abs)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
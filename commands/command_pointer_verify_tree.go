@@ -0,0 +1,228 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/git/githistory"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/rubyist/tracerx"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// maxPointerSize is the size above which a blob can't be a pointer.
+	maxPointerSize = 1024
+)
+
+var (
+	verifyTreeSkipServer = false
+)
+
+// verifyTreeCommand checks that every file tracked by Git LFS which is added
+// or modified in the given ranges of commits is a valid pointer, and that the
+// server has the object it points to. With no arguments, the ranges are read
+// from stdin in the format given to a pre-receive hook.
+func verifyTreeCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	var ranges [][]string
+	if len(args) > 0 {
+		for _, arg := range args {
+			ranges = append(ranges, []string{arg})
+		}
+	} else {
+		if err := requireStdin("verify-tree expects '<old> <new> <ref>' lines from a pre-receive hook on STDIN, or ranges as arguments."); err != nil {
+			return err
+		}
+
+		var err error
+		if ranges, err = readPreReceiveRanges(os.Stdin); err != nil {
+			return errorf("Error reading STDIN: %s", err)
+		}
+	}
+
+	var pointers []*lfs.WrappedPointer
+	invalid := 0
+	seen := make(map[string]bool)
+
+	for _, rng := range ranges {
+		include, exclude := rng, []string(nil)
+		if len(rng) > 1 {
+			include, exclude = rng[:1], rng[1:]
+		}
+
+		commits, err := githistory.RevList(include, exclude)
+		if err != nil {
+			return errorf("Could not list commits in %s: %s", strings.Join(rng, " "), err)
+		}
+
+		for _, c := range commits {
+			if seen[c.Sha] {
+				continue
+			}
+			seen[c.Sha] = true
+
+			ps, bad, err := verifyCommitPointers(c)
+			if err != nil {
+				return errorf("Could not verify commit %s: %s", c.Sha, err)
+			}
+			pointers = append(pointers, ps...)
+			invalid += bad
+		}
+	}
+
+	missing := 0
+	if !verifyTreeSkipServer {
+		missing = verifyPointersUploaded(pointers)
+	}
+
+	if invalid+missing > 0 {
+		return codeErrorf(1, "Git LFS: %d invalid pointer(s), %d object(s) missing from the Git LFS server", invalid, missing)
+	}
+
+	return nil
+}
+
+// readPreReceiveRanges parses the "<old> <new> <ref>" lines a pre-receive hook
+// is given into arguments for git rev-list selecting the commits being pushed.
+// Deleted refs are skipped, and for new refs every commit which isn't already
+// reachable from an existing ref is included.
+func readPreReceiveRanges(r io.Reader) ([][]string, error) {
+	var ranges [][]string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		// refs being created or deleted have the zero object as their
+		// old or new sha
+		oldSha, newSha := fields[0], fields[1]
+		switch {
+		case git.IsZeroObjectID(newSha):
+			continue
+		case git.IsZeroObjectID(oldSha):
+			ranges = append(ranges, []string{newSha, "--all"})
+		default:
+			ranges = append(ranges, []string{newSha, oldSha})
+		}
+	}
+	return ranges, scanner.Err()
+}
+
+// verifyCommitPointers checks each file changed by the given commit which the
+// commit's .gitattributes say is tracked by Git LFS. It returns the valid
+// pointers, and the number of files which were not valid pointers.
+func verifyCommitPointers(c *githistory.Commit) ([]*lfs.WrappedPointer, int, error) {
+	attributes, err := lfsTrackedAttributes(c.Sha)
+	if err != nil || attributes == nil {
+		return nil, 0, err
+	}
+
+	entries, err := githistory.DiffTree(c)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var pointers []*lfs.WrappedPointer
+	invalid := 0
+	for _, entry := range entries {
+		if !trackedByFilter(attributes.TracksWithLFS, entry.Path) {
+			continue
+		}
+
+		p, err := decodeBlobPointer(entry.Oid)
+		if err != nil {
+			Error("%s %s: not a valid Git LFS pointer: %s", c.Sha[0:7], entry.Path, err)
+			invalid++
+			continue
+		}
+
+		pointers = append(pointers, &lfs.WrappedPointer{Name: entry.Path, Pointer: p})
+	}
+	return pointers, invalid, nil
+}
+
+// decodeBlobPointer decodes the pointer in the blob with the given SHA-1,
+// without reading any more of it than a pointer could contain.
+func decodeBlobPointer(oid string) (*lfs.Pointer, error) {
+	data, err := readPointerBlob(oid)
+	if err != nil {
+		return nil, err
+	}
+	return lfs.DecodePointer(bytes.NewReader(data))
+}
+
+// readPointerBlob returns the contents of the blob with the given SHA-1, or a
+// NotAPointerError if it's too large to be a pointer.
+func readPointerBlob(oid string) ([]byte, error) {
+	blob, err := githistory.ReadBlob(oid)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(blob, maxPointerSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPointerSize {
+		return nil, errors.NewNotAPointerError(fmt.Errorf("blob is larger than %d bytes", maxPointerSize))
+	}
+	return data, nil
+}
+
+// verifyPointersUploaded asks the Git LFS server whether it has the objects for
+// the given pointers, reporting and returning the number of those it doesn't.
+func verifyPointersUploaded(pointers []*lfs.WrappedPointer) int {
+	if len(pointers) == 0 {
+		return 0
+	}
+
+	q := newDownloadCheckQueue()
+	watch := q.Watch()
+
+	found := make(map[string]bool)
+	done := make(chan struct{})
+	go func() {
+		for oid := range watch {
+			found[oid] = true
+		}
+		close(done)
+	}()
+
+	for _, p := range pointers {
+		q.Add(downloadTransfer(p))
+	}
+	q.Wait()
+	<-done
+
+	for _, err := range q.Errors() {
+		tracerx.Printf("verify-tree: %s", err)
+	}
+
+	missing := 0
+	reported := make(map[string]bool)
+	for _, p := range pointers {
+		if found[p.Oid] || reported[p.Oid] {
+			continue
+		}
+		reported[p.Oid] = true
+
+		Error("%s (%s): object missing from the Git LFS server", p.Name, p.Oid)
+		missing++
+	}
+	return missing
+}
@@ -0,0 +1,156 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/rubyist/tracerx"
+	"github.com/spf13/cobra"
+)
+
+var postCommitBackground = false
+
+// postCommitCommand is run through Git's post-commit hook, which is installed
+// when lfs.autopush is set. It starts 'git lfs post-commit --background' to
+// upload the Git LFS objects of the new commit to the current branch's remote,
+// so that the eventual 'git push' only has git objects to send.
+//
+// Only one autopush runs in a repository at once. If one is already running,
+// the new commit is queued for it to push once it's done, rather than another
+// being started to scan the same commits.
+//
+// Nothing is uploaded if lfs.autopush has since been unset, if Git LFS is
+// offline or pushing later, or if the repository has no such remote.
+func postCommitCommand(cmd *cobra.Command, args []string) error {
+	if postCommitBackground {
+		return autopushCommand()
+	}
+
+	if _, _, ok := autopushTarget(); !ok {
+		return nil
+	}
+
+	if pid, running := runningPid(autopushPidPath()); running {
+		queueAutopush(pid)
+		return nil
+	}
+
+	pid, logPath, err := startBackgroundCommand("autopush.log", "post-commit", "--background")
+	if err != nil {
+		Error("Could not upload Git LFS objects in the background: %s", err)
+		return nil
+	}
+	tracerx.Printf("post-commit: pushing in the background (pid %d), logging to %s", pid, logPath)
+
+	return nil
+}
+
+// autopushCommand pushes the current branch to its remote with 'git lfs push',
+// holding the autopush pid file's lock, and pushes it again for as long as
+// commits are queued while it does.
+func autopushCommand() error {
+	for {
+		pidFile, pid, err := lockPidFile(autopushPidPath())
+		if err != nil {
+			return errorf("Could not record autopush process: %s", err)
+		}
+		if pidFile == nil {
+			queueAutopush(pid)
+			return nil
+		}
+
+		for autopushOnce() {
+		}
+		pidFile.Close()
+
+		// a commit may have been queued after the last push, but before
+		// the lock was released, so it's pushed now rather than with the
+		// next commit.
+		if !autopushQueued() {
+			return nil
+		}
+	}
+}
+
+// autopushOnce pushes the current branch to its remote, and returns whether
+// another commit was queued to be pushed while it did.
+func autopushOnce() bool {
+	os.Remove(autopushQueuePath())
+
+	remote, ref, ok := autopushTarget()
+	if !ok {
+		return false
+	}
+
+	exe, err := lfsExecutable()
+	if err != nil {
+		Error("Could not upload Git LFS objects: %s", err)
+		return false
+	}
+
+	cmd := subprocess.ExecCommand(exe, "push", remote, ref.Name)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		Error("Could not upload Git LFS objects of %s to %s: %s", ref.Name, remote, err)
+	}
+
+	return autopushQueued()
+}
+
+// autopushTarget returns the remote and the ref to push the Git LFS objects of
+// a new commit to, and whether they should be pushed at all.
+func autopushTarget() (string, *git.Ref, bool) {
+	if !cfg.AutoPush() || cfg.Offline() || cfg.PushLater() {
+		return "", nil, false
+	}
+
+	remote, err := git.RemoteForCurrentBranch()
+	if err != nil || len(remote) == 0 {
+		remote = cfg.CurrentRemote
+	}
+	if err := git.ValidateRemote(remote); err != nil {
+		tracerx.Printf("post-commit: not pushing to %q: %s", remote, err)
+		return "", nil, false
+	}
+
+	ref, err := git.CurrentRef()
+	if err != nil {
+		tracerx.Printf("post-commit: not pushing: %s", err)
+		return "", nil, false
+	}
+	return remote, ref, true
+}
+
+// queueAutopush leaves the running autopush of the given pid to push the new
+// commit once it's done.
+func queueAutopush(pid int) {
+	if err := ioutil.WriteFile(autopushQueuePath(), nil, 0644); err != nil {
+		Error("Could not queue Git LFS objects to be uploaded: %s", err)
+		return
+	}
+	tracerx.Printf("post-commit: already pushing in the background (pid %d), queued", pid)
+}
+
+func autopushQueued() bool {
+	_, err := os.Stat(autopushQueuePath())
+	return err == nil
+}
+
+func autopushPidPath() string {
+	return filepath.Join(config.LocalGitDir, "lfs", "autopush.pid")
+}
+
+func autopushQueuePath() string {
+	return filepath.Join(config.LocalGitDir, "lfs", "autopush.queued")
+}
+
+func init() {
+	RegisterCommand("post-commit", postCommitCommand, func(cmd *cobra.Command) {
+		cmd.Flags().BoolVarP(&postCommitBackground, "background", "", false, "Push the current branch, and any commits queued while doing so")
+	})
+}
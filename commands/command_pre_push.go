@@ -13,8 +13,7 @@ import (
 )
 
 var (
-	prePushDryRun       = false
-	prePushDeleteBranch = strings.Repeat("0", 40)
+	prePushDryRun = false
 )
 
 // prePushCommand is run through Git's pre-push hook. The pre-push hook passes
@@ -39,30 +38,35 @@ var (
 //
 // In the case of deleting a branch, no attempts to push Git LFS objects will be
 // made.
-func prePushCommand(cmd *cobra.Command, args []string) {
+func prePushCommand(cmd *cobra.Command, args []string) error {
 	if len(args) == 0 {
 		Print("This should be run through Git's pre-push hook.  Run `git lfs update` to install it.")
-		os.Exit(1)
+		return codeErrorf(1, "")
 	}
 
-	requireGitVersion()
+	if err := requireGitVersion(); err != nil {
+		return err
+	}
 
 	// Remote is first arg
 	if err := git.ValidateRemote(args[0]); err != nil {
-		Exit("Invalid remote name %q", args[0])
+		return errorf("Invalid remote name %q", args[0])
 	}
 
 	cfg.CurrentRemote = args[0]
 	ctx := newUploadContext(prePushDryRun)
+	ctx.Later = cfg.PushLater()
 
-	gitscanner := lfs.NewGitScanner(nil)
+	gitscanner := newGitScanner(nil)
 	if err := gitscanner.RemoteForPush(cfg.CurrentRemote); err != nil {
-		ExitWithError(err)
+		return err
 	}
 
 	defer gitscanner.Close()
 
-	// We can be passed multiple lines of refs
+	// We can be passed multiple lines of refs, which are read up front so
+	// that the progress of each can be shown along with that of them all.
+	var lines []string
 	scanner := bufio.NewScanner(os.Stdin)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
@@ -73,18 +77,35 @@ func prePushCommand(cmd *cobra.Command, args []string) {
 
 		tracerx.Printf("pre-push: %s", line)
 
-		left, _ := decodeRefs(line)
-		if left == prePushDeleteBranch {
+		// refs being deleted have the zero object as their local sha
+		if left, _ := decodeRefs(line); git.IsZeroObjectID(left) {
 			continue
 		}
+		lines = append(lines, line)
+	}
 
-		pointers, err := scanLeftOrAll(gitscanner, left)
-		if err != nil {
+	ctx.startRefs(len(lines))
+	for _, line := range lines {
+		left, _ := decodeRefs(line)
+
+		// objects are pushed to the endpoint of the remote ref, which
+		// may be overridden with "lfs.<ref>.url".
+		cfg.CurrentRef = decodeRemoteRef(line)
+		warnDivergentPushedFiles(decodeLocalRef(line), left)
+
+		ctx.startRef(decodeLocalRef(line))
+		pointers, errc := scanLeftOrAll(gitscanner, left, false)
+		if err := uploadPointerStream(ctx, pointers); err != nil {
+			return err
+		}
+		if err := <-errc; err != nil {
 			Print("Error scanning for Git LFS files in %q", left)
-			ExitWithError(err)
+			return err
 		}
-		uploadPointers(ctx, pointers)
 	}
+	ctx.finishRefs()
+
+	return nil
 }
 
 func scanLeft(g *lfs.GitScanner, ref string) ([]*lfs.WrappedPointer, error) {
@@ -127,6 +148,22 @@ func decodeRefs(input string) (string, string) {
 	return left, right
 }
 
+// decodeLocalRef returns the name of the local ref being pushed, from the line
+// read from the pre-push hook's stdin.
+func decodeLocalRef(input string) string {
+	return strings.Split(strings.TrimSpace(input), " ")[0]
+}
+
+// decodeRemoteRef returns the name of the remote ref being updated, from the
+// line read from the pre-push hook's stdin.
+func decodeRemoteRef(input string) string {
+	refs := strings.Split(strings.TrimSpace(input), " ")
+	if len(refs) > 2 {
+		return refs[2]
+	}
+	return ""
+}
+
 func init() {
 	RegisterCommand("pre-push", prePushCommand, func(cmd *cobra.Command) {
 		cmd.Flags().BoolVarP(&prePushDryRun, "dry-run", "d", false, "Do everything except actually send the updates")
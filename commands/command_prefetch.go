@@ -0,0 +1,278 @@
+package commands
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/filepathfilter"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// prefetchStartTimeout is how long --daemon waits for the background
+	// process to record itself in the pid file.
+	prefetchStartTimeout = 10 * time.Second
+	// prefetchStopTimeout is how long --stop waits for the background
+	// process to stop once it has been signalled.
+	prefetchStopTimeout = 30 * time.Second
+)
+
+var (
+	prefetchDaemonArg   bool
+	prefetchWatchArg    bool
+	prefetchStopArg     bool
+	prefetchIntervalArg int
+)
+
+// prefetchCommand fetches new commits from a remote, and then downloads the
+// Git LFS objects of the remote-tracking branches they updated, so that a later
+// pull or checkout doesn't have to. With --watch it does so repeatedly, and
+// with --daemon it does so repeatedly in the background.
+func prefetchCommand(cmd *cobra.Command, args []string) error {
+	if err := requireGitVersion(); err != nil {
+		return err
+	}
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	if prefetchStopArg {
+		return stopPrefetchDaemon()
+	}
+
+	remote, err := prefetchRemote(args)
+	if err != nil {
+		return err
+	}
+	interval := prefetchInterval()
+
+	if prefetchDaemonArg {
+		return startPrefetchDaemon(remote, interval)
+	}
+
+	filter := buildFilepathFilter(cfg, nil, nil)
+	if !prefetchWatchArg {
+		if !prefetchOnce(remote, filter, nil) {
+			return errorf("Warning: errors occurred")
+		}
+		return nil
+	}
+
+	pidFile, pid, err := lockPidFile(prefetchPidPath())
+	if err != nil {
+		return errorf("Could not record prefetch process: %s", err)
+	}
+	if pidFile == nil {
+		return errorf("git lfs prefetch is already running in the background (pid %d)", pid)
+	}
+	defer pidFile.Close()
+
+	// A service manager stops the process with SIGTERM, which, like an
+	// interrupt, ends the loop below, so that the pid file is removed.
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM)
+	defer signal.Stop(term)
+	go func() {
+		if _, ok := <-term; ok {
+			Interrupt()
+		}
+	}()
+
+	ctx := commandContext()
+	seen := make(map[string]string)
+	for {
+		prefetchOnce(remote, filter, seen)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// prefetchRemote returns the remote named by the arguments, or the default
+// remote.
+func prefetchRemote(args []string) (string, error) {
+	if len(args) > 0 {
+		if err := git.ValidateRemote(args[0]); err != nil {
+			return "", errorf("Invalid remote name %q", args[0])
+		}
+		return args[0], nil
+	}
+
+	remote, err := git.DefaultRemote()
+	if err != nil {
+		return "", errorf("No default remote: %s", err)
+	}
+	return remote, nil
+}
+
+// prefetchInterval returns how long to wait between checks of the remote:
+// --interval if given, otherwise lfs.prefetchinterval, in seconds.
+func prefetchInterval() time.Duration {
+	secs := prefetchIntervalArg
+	if secs <= 0 {
+		secs = cfg.Git.Int("lfs.prefetchinterval", 300)
+	}
+	if secs <= 0 {
+		secs = 300
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// prefetchOnce runs 'git fetch' for the given remote, and downloads the objects
+// of each of its remote-tracking branches whose tip has changed since it was
+// recorded in seen. seen may be nil to download the objects of all of them. It
+// returns whether every step succeeded.
+func prefetchOnce(remote string, filter *filepathfilter.Filter, seen map[string]string) bool {
+	cfg.CurrentRemote = remote
+
+	fetch := subprocess.ExecCommand("git", "fetch", "--quiet", remote)
+	fetch.Stdout = os.Stderr
+	fetch.Stderr = os.Stderr
+	if err := fetch.Run(); err != nil {
+		Error("prefetch: git fetch %s: %s", remote, err)
+		return false
+	}
+
+	refs, err := git.CachedRemoteRefs(remote)
+	if err != nil {
+		Error("prefetch: could not list refs for %s: %s", remote, err)
+		return false
+	}
+
+	ok := true
+	fetched := make(map[string]bool)
+	for _, ref := range refs {
+		if seen != nil && seen[ref.Name] == ref.Sha {
+			continue
+		}
+
+		if !fetched[ref.Sha] {
+			Print("Prefetching %s/%s", remote, ref.Name)
+			fetched[ref.Sha] = true
+			cfg.CurrentRef = "refs/heads/" + ref.Name
+			fetchedRef, err := fetchRef(ref.Sha, filter)
+			if err != nil {
+				printCommandError(err)
+			}
+			ok = fetchedRef && ok
+		}
+
+		if seen != nil {
+			seen[ref.Name] = ref.Sha
+		}
+	}
+	return ok
+}
+
+// startPrefetchDaemon runs 'git lfs prefetch --watch' in the background, with
+// its output logged to .git/lfs/prefetch.log, and waits for it to record itself
+// in the pid file.
+func startPrefetchDaemon(remote string, interval time.Duration) error {
+	if pid, running := runningPid(prefetchPidPath()); running {
+		return errorf("git lfs prefetch is already running in the background (pid %d)", pid)
+	}
+
+	logPath := filepath.Join(config.LocalGitDir, "lfs", "prefetch.log")
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return errorf("Could not create %s: %s", filepath.Dir(logPath), err)
+	}
+
+	log, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return errorf("Could not open %s: %s", logPath, err)
+	}
+	defer log.Close()
+
+	exe, err := exec.LookPath(os.Args[0])
+	if err == nil {
+		exe, err = filepath.Abs(exe)
+	}
+	if err != nil {
+		return errorf("Could not find git-lfs executable: %s", err)
+	}
+
+	daemon := subprocess.ExecCommand(exe, "prefetch", "--watch",
+		"--interval", strconv.Itoa(int(interval/time.Second)), remote)
+	daemon.Dir = config.LocalWorkingDir
+	daemon.Stdout = log
+	daemon.Stderr = log
+	daemon.SysProcAttr = daemonSysProcAttr()
+
+	if err := daemon.Start(); err != nil {
+		return errorf("Could not start git lfs prefetch in the background: %s", err)
+	}
+	pid := daemon.Process.Pid
+
+	// The pid file is read rather than its lock checked, which could
+	// stop the process taking the lock.
+	exited := make(chan struct{})
+	go func() {
+		daemon.Wait()
+		close(exited)
+	}()
+	for start := time.Now(); time.Since(start) < prefetchStartTimeout; {
+		if recorded, _ := readPid(prefetchPidPath()); recorded == pid {
+			break
+		}
+
+		select {
+		case <-exited:
+			return errorf("git lfs prefetch stopped in the background, see %s", logPath)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	Print("Prefetching from %s every %s in the background (pid %d), logging to %s", remote, interval, pid, logPath)
+	return nil
+}
+
+// stopPrefetchDaemon stops the background prefetch process, if there is one,
+// and waits for it to remove its pid file. The process is only signalled
+// while it holds the pid file's lock, so that another one which has since
+// been given its pid isn't.
+func stopPrefetchDaemon() error {
+	path := prefetchPidPath()
+	pid, running := runningPid(path)
+	if !running {
+		Print("git lfs prefetch is not running in the background")
+		return nil
+	}
+
+	if err := terminateProcess(pid); err != nil {
+		return errorf("Could not stop git lfs prefetch (pid %d): %s", pid, err)
+	}
+
+	for start := time.Now(); time.Since(start) < prefetchStopTimeout; {
+		if _, running := runningPid(path); !running {
+			Print("Stopped git lfs prefetch (pid %d)", pid)
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return errorf("git lfs prefetch (pid %d) did not stop within %s", pid, prefetchStopTimeout)
+}
+
+func prefetchPidPath() string {
+	return filepath.Join(config.LocalGitDir, "lfs", "prefetch.pid")
+}
+
+func init() {
+	RegisterCommand("prefetch", prefetchCommand, func(cmd *cobra.Command) {
+		cmd.Flags().BoolVarP(&prefetchDaemonArg, "daemon", "d", false, "Keep prefetching in the background")
+		cmd.Flags().BoolVarP(&prefetchWatchArg, "watch", "w", false, "Keep prefetching in the foreground")
+		cmd.Flags().BoolVar(&prefetchStopArg, "stop", false, "Stop prefetching in the background")
+		cmd.Flags().IntVarP(&prefetchIntervalArg, "interval", "i", 0, "Seconds to wait between checks of the remote")
+		addTimeoutFlag(cmd)
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -20,21 +21,25 @@ import (
 
 var (
 	pruneDryRunArg      bool
-	pruneVerboseArg     bool
 	pruneVerifyArg      bool
 	pruneDoNotVerifyArg bool
+	pruneNoSafetyArg    bool
+	pruneOlderThanArg   int
 )
 
-func pruneCommand(cmd *cobra.Command, args []string) {
+func pruneCommand(cmd *cobra.Command, args []string) error {
 	// Guts of this must be re-usable from fetch --prune so just parse & dispatch
 	if pruneVerifyArg && pruneDoNotVerifyArg {
-		Exit("Cannot specify both --verify-remote and --no-verify-remote")
+		return errorf("Cannot specify both --verify-remote and --no-verify-remote")
 	}
 
 	fetchPruneConfig := cfg.FetchPruneConfig()
 	verify := !pruneDoNotVerifyArg &&
 		(fetchPruneConfig.PruneVerifyRemoteAlways || pruneVerifyArg)
-	prune(fetchPruneConfig, verify, pruneDryRunArg, pruneVerboseArg)
+	if pruneOlderThanArg < 0 {
+		return errorf("Invalid --objects-older-than: %d", pruneOlderThanArg)
+	}
+	return prune(fetchPruneConfig, verify, !pruneNoSafetyArg, pruneDryRunArg, isVerbose())
 }
 
 type PruneProgressType int
@@ -52,9 +57,10 @@ type PruneProgress struct {
 }
 type PruneProgressChan chan PruneProgress
 
-func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, dryRun, verbose bool) {
+func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, safetyCheck, dryRun, verbose bool) (err error) {
 	localObjects := make([]localstorage.Object, 0, 100)
 	retainedObjects := tools.NewStringSetWithCapacity(100)
+	recentObjects := tools.NewStringSetWithCapacity(100)
 	var reachableObjects tools.StringSet
 	var taskwait sync.WaitGroup
 
@@ -65,6 +71,9 @@ func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, dryRun, verbo
 	if verifyRemote {
 		taskwait.Add(1) // 5
 	}
+	if safetyCheck {
+		taskwait.Add(1) // 6
+	}
 
 	progressChan := make(PruneProgressChan, 100)
 
@@ -79,12 +88,18 @@ func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, dryRun, verbo
 	go pruneTaskGetLocalObjects(&localObjects, progressChan, &taskwait)
 
 	// Now find files to be retained from many sources
+	// Objects kept only because they're in recent refs or commits go to
+	// recentChan, as they may be evicted to stay under lfs.storagelimit
 	retainChan := make(chan string, 100)
+	recentChan := make(chan string, 100)
 
-	gitscanner := lfs.NewGitScanner(nil)
-	go pruneTaskGetRetainedCurrentAndRecentRefs(gitscanner, fetchPruneConfig, retainChan, errorChan, &taskwait)
+	gitscanner := newGitScanner(nil)
+	go pruneTaskGetRetainedCurrentAndRecentRefs(gitscanner, fetchPruneConfig, retainChan, recentChan, errorChan, &taskwait)
 	go pruneTaskGetRetainedUnpushed(gitscanner, fetchPruneConfig, retainChan, errorChan, &taskwait)
 	go pruneTaskGetRetainedWorktree(gitscanner, retainChan, errorChan, &taskwait)
+	if safetyCheck {
+		go pruneTaskGetRetainedInProgress(gitscanner, retainChan, errorChan, &taskwait)
+	}
 	if verifyRemote {
 		reachableObjects = tools.NewStringSetWithCapacity(100)
 		go pruneTaskGetReachableObjects(gitscanner, &reachableObjects, errorChan, &taskwait)
@@ -93,7 +108,7 @@ func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, dryRun, verbo
 	// Now collect all the retained objects, on separate wait
 	var retainwait sync.WaitGroup
 	retainwait.Add(1)
-	go pruneTaskCollectRetained(&retainedObjects, retainChan, progressChan, &retainwait)
+	go pruneTaskCollectRetained(&retainedObjects, &recentObjects, retainChan, recentChan, progressChan, &retainwait)
 
 	// Report progress
 	var progresswait sync.WaitGroup
@@ -103,13 +118,17 @@ func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, dryRun, verbo
 	taskwait.Wait() // wait for subtasks
 	gitscanner.Close()
 	close(retainChan) // triggers retain collector to end now all tasks have
+	close(recentChan)
 	retainwait.Wait() // make sure all retained objects added
 
 	close(errorChan) // triggers error collector to end now all tasks have
 	errorwait.Wait() // make sure all errors have been processed
-	pruneCheckErrors(taskErrors)
+	if err := pruneCheckErrors(taskErrors); err != nil {
+		return err
+	}
 
-	prunableObjects := make([]string, 0, len(localObjects)/2)
+	selectedObjects := pruneSelectObjects(localObjects, retainedObjects, recentObjects, pruneOlderThanArg, cfg.StorageLimit())
+	prunableObjects := make([]string, 0, len(selectedObjects))
 
 	// Build list of prunables (also queue for verify at same time if applicable)
 	var verifyQueue *tq.TransferQueue
@@ -138,22 +157,20 @@ func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, dryRun, verbo
 		}()
 	}
 
-	for _, file := range localObjects {
-		if !retainedObjects.Contains(file.Oid) {
-			prunableObjects = append(prunableObjects, file.Oid)
-			totalSize += file.Size
-			if verbose {
-				// Save up verbose output for the end, spinner still going
-				verboseOutput.WriteString(fmt.Sprintf(" * %v (%v)\n", file.Oid, humanizeBytes(file.Size)))
-			}
+	for _, file := range selectedObjects {
+		prunableObjects = append(prunableObjects, file.Oid)
+		totalSize += file.Size
+		if verbose {
+			// Save up verbose output for the end, spinner still going
+			verboseOutput.WriteString(fmt.Sprintf(" * %v (%v)\n", file.Oid, humanizeBytes(file.Size)))
+		}
 
-			if verifyRemote {
-				tracerx.Printf("VERIFYING: %v", file.Oid)
+		if verifyRemote {
+			tracerx.Printf("VERIFYING: %v", file.Oid)
 
-				verifyQueue.Add(downloadTransfer(&lfs.WrappedPointer{
-					Pointer: lfs.NewPointer(file.Oid, file.Size, nil),
-				}))
-			}
+			verifyQueue.Add(downloadTransfer(&lfs.WrappedPointer{
+				Pointer: lfs.NewPointer(file.Oid, file.Size, nil),
+			}))
 		}
 	}
 
@@ -162,15 +179,25 @@ func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, dryRun, verbo
 		verifywait.Wait()
 		close(progressChan) // after verify (uses spinner) but before check
 		progresswait.Wait()
-		pruneCheckVerified(prunableObjects, reachableObjects, verifiedObjects)
+		if err := pruneCheckVerified(prunableObjects, reachableObjects, verifiedObjects); err != nil {
+			return err
+		}
 	} else {
 		close(progressChan)
 		progresswait.Wait()
 	}
 
+	if !dryRun {
+		defer func() {
+			if cerr := pruneChunks(localObjects, prunableObjects); err == nil {
+				err = cerr
+			}
+		}()
+	}
+
 	if len(prunableObjects) == 0 {
 		Print("Nothing to prune")
-		return
+		return nil
 	}
 	if dryRun {
 		Print("%d files would be pruned (%v)", len(prunableObjects), humanizeBytes(totalSize))
@@ -182,12 +209,128 @@ func prune(fetchPruneConfig config.FetchPruneConfig, verifyRemote, dryRun, verbo
 		if verbose {
 			Print(verboseOutput.String())
 		}
-		pruneDeleteFiles(prunableObjects)
+		if err := pruneDeleteFiles(prunableObjects); err != nil {
+			return err
+		}
+		if err := pruneAccessTimes(prunableObjects); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pruneSelectObjects returns the local objects to prune. By default these are
+// the objects which aren't retained at all. With --objects-older-than, they're
+// instead those not used within that many days, other than objects needed for
+// HEAD, other worktrees, unpushed or in-progress work; objects only in recent
+// refs & commits are treated like any other. If the objects left would still
+// take up more than the given storage limit, the least recently used of those
+// only in recent refs & commits are pruned too.
+func pruneSelectObjects(localObjects []localstorage.Object, retainedObjects, recentObjects tools.StringSet, olderThanDays int, storageLimit int64) []localstorage.Object {
+	var lastUsed map[string]time.Time
+	if olderThanDays > 0 || storageLimit > 0 {
+		lastUsed = pruneLastUsed(localObjects)
+	}
+	cutoff := time.Now().AddDate(0, 0, -olderThanDays)
+
+	var prunable, evictable []localstorage.Object
+	var keptSize int64
+	for _, file := range localObjects {
+		var prune bool
+		switch {
+		case retainedObjects.Contains(file.Oid):
+			prune = false
+		case olderThanDays > 0:
+			prune = lastUsed[file.Oid].Before(cutoff)
+		default:
+			prune = !recentObjects.Contains(file.Oid)
+		}
+
+		if prune {
+			prunable = append(prunable, file)
+			continue
+		}
+
+		keptSize += file.Size
+		if !retainedObjects.Contains(file.Oid) {
+			evictable = append(evictable, file)
+		}
+	}
+
+	if storageLimit <= 0 || keptSize <= storageLimit {
+		return prunable
+	}
+
+	tracerx.Printf("PRUNE: %d bytes retained, evicting objects in recent refs to stay under lfs.storagelimit of %d", keptSize, storageLimit)
+	sort.Sort(&pruneObjectsByLastUsed{evictable, lastUsed})
+	for _, file := range evictable {
+		if keptSize <= storageLimit {
+			break
+		}
+		prunable = append(prunable, file)
+		keptSize -= file.Size
+		tracerx.Printf("EVICT: %v, last used %v", file.Oid, lastUsed[file.Oid])
 	}
 
+	if keptSize > storageLimit {
+		Print("Objects needed for HEAD, worktrees and unpushed work take up %v, more than lfs.storagelimit (%v)", humanizeBytes(keptSize), humanizeBytes(storageLimit))
+	}
+	return prunable
+}
+
+// pruneLastUsed returns when each of the local objects was last used to write a
+// working tree file according to the access log, or was added to the store if
+// it hasn't been since.
+func pruneLastUsed(localObjects []localstorage.Object) map[string]time.Time {
+	lastUsed, err := localstorage.AccessTimes()
+	if err != nil {
+		LoggedError(err, "Could not read object access times: %v", err)
+		lastUsed = make(map[string]time.Time)
+	}
+
+	for _, file := range localObjects {
+		if _, ok := lastUsed[file.Oid]; ok {
+			continue
+		}
+		if stat, err := os.Stat(lfs.LocalMediaPathReadOnly(file.Oid)); err == nil {
+			lastUsed[file.Oid] = stat.ModTime()
+		} else if stat, err := localstorage.Chunks().Stat(file.Oid); err == nil {
+			lastUsed[file.Oid] = stat.ModTime()
+		} else if stat, err := localstorage.Compressed().Stat(file.Oid); err == nil {
+			lastUsed[file.Oid] = stat.ModTime()
+		}
+	}
+	return lastUsed
+}
+
+// pruneObjectsByLastUsed sorts objects from the least to the most recently
+// used.
+type pruneObjectsByLastUsed struct {
+	objects  []localstorage.Object
+	lastUsed map[string]time.Time
 }
 
-func pruneCheckVerified(prunableObjects []string, reachableObjects, verifiedObjects tools.StringSet) {
+func (s *pruneObjectsByLastUsed) Len() int { return len(s.objects) }
+
+func (s *pruneObjectsByLastUsed) Less(i, j int) bool {
+	return s.lastUsed[s.objects[i].Oid].Before(s.lastUsed[s.objects[j].Oid])
+}
+
+func (s *pruneObjectsByLastUsed) Swap(i, j int) {
+	s.objects[i], s.objects[j] = s.objects[j], s.objects[i]
+}
+
+// pruneAccessTimes drops the pruned objects from the access log, compacting it.
+func pruneAccessTimes(prunedObjects []string) error {
+	if err := localstorage.ForgetAccess(prunedObjects); err != nil {
+		LoggedError(err, "Could not update object access times: %v", err)
+		return errorf("Prune failed, see errors above")
+	}
+	return nil
+}
+
+func pruneCheckVerified(prunableObjects []string, reachableObjects, verifiedObjects tools.StringSet) error {
 	// There's no issue if an object is not reachable and missing, only if reachable & missing
 	var problems bytes.Buffer
 	for _, oid := range prunableObjects {
@@ -206,17 +349,19 @@ func pruneCheckVerified(prunableObjects []string, reachableObjects, verifiedObje
 	// deleted but that's incorrect; bad state has occurred somehow, might need
 	// push --all to resolve
 	if problems.Len() > 0 {
-		Exit("Abort: these objects to be pruned are missing on remote:\n%v", problems.String())
+		return errorf("Abort: these objects to be pruned are missing on remote:\n%v", problems.String())
 	}
+	return nil
 }
 
-func pruneCheckErrors(taskErrors []error) {
+func pruneCheckErrors(taskErrors []error) error {
 	if len(taskErrors) > 0 {
 		for _, err := range taskErrors {
 			LoggedError(err, "Prune error: %v", err)
 		}
-		Exit("Prune sub-tasks failed, cannot continue")
+		return errorf("Prune sub-tasks failed, cannot continue")
 	}
+	return nil
 }
 
 func pruneTaskDisplayProgress(progressChan PruneProgressChan, waitg *sync.WaitGroup) {
@@ -245,13 +390,31 @@ func pruneTaskDisplayProgress(progressChan PruneProgressChan, waitg *sync.WaitGr
 	spinner.Finish(OutputWriter, msg)
 }
 
-func pruneTaskCollectRetained(outRetainedObjects *tools.StringSet, retainChan chan string,
+func pruneTaskCollectRetained(outRetainedObjects, outRecentObjects *tools.StringSet, retainChan, recentChan chan string,
 	progressChan PruneProgressChan, retainwait *sync.WaitGroup) {
 
 	defer retainwait.Done()
 
-	for oid := range retainChan {
-		if outRetainedObjects.Add(oid) {
+	seen := tools.NewStringSetWithCapacity(100)
+	for retainChan != nil || recentChan != nil {
+		var oid string
+		var ok bool
+		select {
+		case oid, ok = <-retainChan:
+			if !ok {
+				retainChan = nil
+				continue
+			}
+			outRetainedObjects.Add(oid)
+		case oid, ok = <-recentChan:
+			if !ok {
+				recentChan = nil
+				continue
+			}
+			outRecentObjects.Add(oid)
+		}
+
+		if seen.Add(oid) {
 			progressChan <- PruneProgress{PruneProgressTypeRetain, 1}
 		}
 	}
@@ -266,7 +429,7 @@ func pruneTaskCollectErrors(outtaskErrors *[]error, errorChan chan error, errorw
 	}
 }
 
-func pruneDeleteFiles(prunableObjects []string) {
+func pruneDeleteFiles(prunableObjects []string) error {
 	spinner := progress.NewSpinner()
 	var problems bytes.Buffer
 	// In case we fail to delete some
@@ -278,29 +441,95 @@ func pruneDeleteFiles(prunableObjects []string) {
 			problems.WriteString(fmt.Sprintf("Unable to find media path for %v: %v\n", oid, err))
 			continue
 		}
+		_, chunked := lfs.ChunkedObjectSize(oid)
+		_, compressed := lfs.CompressedObjectSize(oid)
 		err = os.Remove(mediaFile)
-		if err != nil {
+		if err != nil && !((chunked || compressed) && os.IsNotExist(err)) {
 			problems.WriteString(fmt.Sprintf("Failed to remove file %v: %v\n", mediaFile, err))
 			continue
 		}
+		if chunked {
+			if err := localstorage.Chunks().Remove(oid); err != nil {
+				problems.WriteString(fmt.Sprintf("Failed to remove chunked object %v: %v\n", oid, err))
+				continue
+			}
+		}
+		if compressed {
+			if err := localstorage.Compressed().Remove(oid); err != nil {
+				problems.WriteString(fmt.Sprintf("Failed to remove compressed object %v: %v\n", oid, err))
+				continue
+			}
+		}
 		deletedFiles++
 	}
 	spinner.Finish(OutputWriter, fmt.Sprintf("Deleted %d files", deletedFiles))
 	if problems.Len() > 0 {
 		LoggedError(fmt.Errorf("Failed to delete some files"), problems.String())
-		Exit("Prune failed, see errors above")
+		return errorf("Prune failed, see errors above")
 	}
+	return nil
+}
+
+// pruneChunks moves the objects kept whole to the chunk store if lfs.chunkstore
+// is set, such as those downloaded by transfer adapters which don't know about
+// chunks, and then deletes the chunks which no object is made up of any more.
+// It returns an error if any of this failed.
+func pruneChunks(localObjects []localstorage.Object, prunedObjects []string) error {
+	var failed bool
+	if cfg.ChunkStore() {
+		pruned := tools.NewStringSetFromSlice(prunedObjects)
+		var moved int
+		for _, file := range localObjects {
+			if pruned.Contains(file.Oid) || !tools.FileExists(lfs.LocalMediaPathReadOnly(file.Oid)) {
+				continue
+			}
+			if err := lfs.MoveToChunkStore(file.Oid); err != nil {
+				LoggedError(err, "Could not move %v to the chunk store: %v", file.Oid, err)
+				failed = true
+				continue
+			}
+			moved++
+		}
+		if moved > 0 {
+			Print("Moved %d files to the chunk store", moved)
+		}
+	}
+
+	count, size, err := localstorage.Chunks().PruneChunks()
+	if err != nil {
+		LoggedError(err, "Could not delete unused chunks: %v", err)
+		return errorf("Prune failed, see errors above")
+	}
+	if count > 0 {
+		Print("Deleted %d unused chunks (%v)", count, humanizeBytes(size))
+	}
+	if failed {
+		return errorf("Prune failed, see errors above")
+	}
+	return nil
 }
 
 // Background task, must call waitg.Done() once at end
 func pruneTaskGetLocalObjects(outLocalObjects *[]localstorage.Object, progChan PruneProgressChan, waitg *sync.WaitGroup) {
 	defer waitg.Done()
 
+	seen := tools.NewStringSet()
 	localObjectsChan := lfs.ScanObjectsChan()
 	for f := range localObjectsChan {
+		seen.Add(f.Oid)
 		*outLocalObjects = append(*outLocalObjects, f)
 		progChan <- PruneProgress{PruneProgressTypeLocal, 1}
 	}
+
+	// Objects stored as chunks or compressed, unless they're stored whole
+	// too
+	stored := append(localstorage.Chunks().Objects(), localstorage.Compressed().Objects()...)
+	for _, f := range stored {
+		if seen.Add(f.Oid) {
+			*outLocalObjects = append(*outLocalObjects, f)
+			progChan <- PruneProgress{PruneProgressTypeLocal, 1}
+		}
+	}
 }
 
 // Background task, must call waitg.Done() once at end
@@ -343,7 +572,7 @@ func pruneTaskGetPreviousVersionsOfRef(gitscanner *lfs.GitScanner, ref string, s
 }
 
 // Background task, must call waitg.Done() once at end
-func pruneTaskGetRetainedCurrentAndRecentRefs(gitscanner *lfs.GitScanner, fetchconf config.FetchPruneConfig, retainChan chan string, errorChan chan error, waitg *sync.WaitGroup) {
+func pruneTaskGetRetainedCurrentAndRecentRefs(gitscanner *lfs.GitScanner, fetchconf config.FetchPruneConfig, retainChan, recentChan chan string, errorChan chan error, waitg *sync.WaitGroup) {
 	defer waitg.Done()
 
 	// We actually increment the waitg in this func since we kick off sub-goroutines
@@ -367,13 +596,14 @@ func pruneTaskGetRetainedCurrentAndRecentRefs(gitscanner *lfs.GitScanner, fetchc
 		// Keep all recent refs including any recent remote branches
 		refs, err := git.RecentBranches(refsSince, fetchconf.FetchRecentRefsIncludeRemotes, "")
 		if err != nil {
-			Panic(err, "Could not scan for recent refs")
+			errorChan <- fmt.Errorf("Could not scan for recent refs: %v", err)
+			return
 		}
 		for _, ref := range refs {
 			if commits.Add(ref.Sha) {
 				// A new commit
 				waitg.Add(1)
-				go pruneTaskGetRetainedAtRef(gitscanner, ref.Sha, retainChan, errorChan, waitg)
+				go pruneTaskGetRetainedAtRef(gitscanner, ref.Sha, recentChan, errorChan, waitg)
 			}
 		}
 	}
@@ -391,7 +621,7 @@ func pruneTaskGetRetainedCurrentAndRecentRefs(gitscanner *lfs.GitScanner, fetchc
 			}
 			commitsSince := summ.CommitDate.AddDate(0, 0, -pruneCommitDays)
 			waitg.Add(1)
-			go pruneTaskGetPreviousVersionsOfRef(gitscanner, commit, commitsSince, retainChan, errorChan, waitg)
+			go pruneTaskGetPreviousVersionsOfRef(gitscanner, commit, commitsSince, recentChan, errorChan, waitg)
 		}
 	}
 }
@@ -446,6 +676,62 @@ func pruneTaskGetRetainedWorktree(gitscanner *lfs.GitScanner, retainChan chan st
 	}
 }
 
+// Background task, must call waitg.Done() once at end
+func pruneTaskGetRetainedInProgress(gitscanner *lfs.GitScanner, retainChan chan string, errorChan chan error, waitg *sync.WaitGroup) {
+	defer waitg.Done()
+
+	// Retain work which isn't reachable from any branch yet but which the
+	// user may still want back: stash entries, commits being merged,
+	// cherry-picked etc, and anything staged in any worktree's index
+	stashRefs, err := git.StashRefs()
+	if err != nil {
+		errorChan <- err
+		return
+	}
+	inProgressRefs, err := git.GetAllWorkTreeInProgressRefs(config.LocalGitStorageDir)
+	if err != nil {
+		errorChan <- err
+		return
+	}
+
+	commits := tools.NewStringSet()
+	for _, ref := range append(stashRefs, inProgressRefs...) {
+		if commits.Add(ref.Sha) {
+			waitg.Add(1)
+			go pruneTaskGetRetainedAtRef(gitscanner, ref.Sha, retainChan, errorChan, waitg)
+		}
+	}
+
+	indexFiles, err := git.GetAllWorkTreeIndexFiles(config.LocalGitStorageDir)
+	if err != nil {
+		errorChan <- err
+		return
+	}
+	for _, indexFile := range indexFiles {
+		waitg.Add(1)
+		go pruneTaskGetRetainedIndex(gitscanner, indexFile, retainChan, errorChan, waitg)
+	}
+}
+
+// Background task, must call waitg.Done() once at end
+func pruneTaskGetRetainedIndex(gitscanner *lfs.GitScanner, indexFile string, retainChan chan string, errorChan chan error, waitg *sync.WaitGroup) {
+	defer waitg.Done()
+
+	err := gitscanner.ScanIndexFile(indexFile, func(p *lfs.WrappedPointer, err error) {
+		if err != nil {
+			errorChan <- err
+			return
+		}
+
+		retainChan <- p.Oid
+		tracerx.Printf("RETAIN: %v via index %v", p.Oid, indexFile)
+	})
+
+	if err != nil {
+		errorChan <- err
+	}
+}
+
 // Background task, must call waitg.Done() once at end
 func pruneTaskGetReachableObjects(gitscanner *lfs.GitScanner, outObjectSet *tools.StringSet, errorChan chan error, waitg *sync.WaitGroup) {
 	defer waitg.Done()
@@ -466,8 +752,9 @@ func pruneTaskGetReachableObjects(gitscanner *lfs.GitScanner, outObjectSet *tool
 func init() {
 	RegisterCommand("prune", pruneCommand, func(cmd *cobra.Command) {
 		cmd.Flags().BoolVarP(&pruneDryRunArg, "dry-run", "d", false, "Don't delete anything, just report")
-		cmd.Flags().BoolVarP(&pruneVerboseArg, "verbose", "v", false, "Print full details of what is/would be deleted")
 		cmd.Flags().BoolVarP(&pruneVerifyArg, "verify-remote", "c", false, "Verify that remote has LFS files before deleting")
 		cmd.Flags().BoolVar(&pruneDoNotVerifyArg, "no-verify-remote", false, "Override lfs.pruneverifyremotealways and don't verify")
+		cmd.Flags().BoolVar(&pruneNoSafetyArg, "no-safety-check", false, "Don't retain objects only referenced by stashes, in-progress merges or worktree indexes")
+		cmd.Flags().IntVar(&pruneOlderThanArg, "objects-older-than", 0, "Prune objects not used in this many days, unless needed for HEAD, worktrees or unpushed work")
 	})
 }
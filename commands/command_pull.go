@@ -1,54 +1,73 @@
 package commands
 
 import (
-	"fmt"
 	"sync"
-	"time"
 
 	"github.com/git-lfs/git-lfs/filepathfilter"
 	"github.com/git-lfs/git-lfs/git"
 	"github.com/git-lfs/git-lfs/lfs"
-	"github.com/git-lfs/git-lfs/progress"
 	"github.com/git-lfs/git-lfs/tq"
 	"github.com/rubyist/tracerx"
 	"github.com/spf13/cobra"
 )
 
-func pullCommand(cmd *cobra.Command, args []string) {
-	requireGitVersion()
-	requireInRepo()
+// pullCheckFirst is whether --fast-forward-only-check was given, to check that
+// every object can be downloaded before the working copy is touched.
+var pullCheckFirst bool
+
+func pullCommand(cmd *cobra.Command, args []string) error {
+	if err := requireGitVersion(); err != nil {
+		return err
+	}
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+	recoverTempObjects()
 
 	if len(args) > 0 {
 		// Remote is first arg
 		if err := git.ValidateRemote(args[0]); err != nil {
-			Panic(err, fmt.Sprintf("Invalid remote name '%v'", args[0]))
+			return loggedErrorf(err, "Invalid remote name '%v'", args[0])
 		}
 		cfg.CurrentRemote = args[0]
 	} else {
 		// Actively find the default remote, don't just assume origin
 		defaultRemote, err := git.DefaultRemote()
 		if err != nil {
-			Panic(err, "No default remote")
+			return loggedErrorf(err, "No default remote")
 		}
 		cfg.CurrentRemote = defaultRemote
 	}
 
 	includeArg, excludeArg := getIncludeExcludeArgs(cmd)
 	filter := buildFilepathFilter(cfg, includeArg, excludeArg)
-	pull(filter)
+	if pullCheckFirst {
+		if err := checkPullable(filter); err != nil {
+			return err
+		}
+	}
+	return pull(filter)
 }
 
-func pull(filter *filepathfilter.Filter) {
+// pull downloads the objects of the current ref allowed by the filter, and
+// checks out their files. If any object couldn't be downloaded or checked out,
+// it returns an error which exits with the code transferFailures chooses.
+func pull(filter *filepathfilter.Filter) error {
 	ref, err := git.CurrentRef()
 	if err != nil {
-		Panic(err, "Could not pull")
+		return loggedErrorf(err, "Could not pull")
+	}
+
+	singleCheckout, err := newSingleCheckout()
+	if err != nil {
+		return err
 	}
 
 	pointers := newPointerMap()
-	meter := progress.NewMeter(progress.WithOSEnv(cfg.Os))
-	singleCheckout := newSingleCheckout()
-	q := newDownloadQueue(tq.WithProgress(meter))
-	gitscanner := lfs.NewGitScanner(func(p *lfs.WrappedPointer, err error) {
+	meter := buildProgressMeter(false)
+	queued := 0
+	q := newDownloadQueue(tq.WithProgress(meter), newTransferJournal(tq.Download))
+	gitscanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
 		if err != nil {
 			LoggedError(err, "Scanner error")
 			return
@@ -70,6 +89,7 @@ func pull(filter *filepathfilter.Filter) {
 		tracerx.Printf("fetch %v [%v]", p.Name, p.Oid)
 		pointers.Add(p)
 		q.Add(downloadTransfer(p))
+		queued++
 	})
 
 	gitscanner.Filter = filter
@@ -87,22 +107,96 @@ func pull(filter *filepathfilter.Filter) {
 		wg.Done()
 	}()
 
-	processQueue := time.Now()
-	if err := gitscanner.ScanTree(ref.Sha); err != nil {
-		ExitWithError(err)
-	}
+	scanErr := gitscanner.ScanTree(ref.Sha)
 
 	meter.Start()
 	gitscanner.Close()
 	q.Wait()
 	wg.Wait()
-	tracerx.PerformanceSince("process queue", processQueue)
 
 	singleCheckout.Close()
+	if scanErr != nil {
+		return scanErr
+	}
 
 	for _, err := range q.Errors() {
 		FullError(err)
 	}
+	var retries fetchRetries
+	if len(q.Errors()) > 0 {
+		retries.AddMissing(pointers.Remaining())
+	}
+	if err := retries.Write(fetchRetryPath(), cfg.CurrentRemote); err != nil {
+		Error("Could not write the retry file: %s", err)
+	}
+
+	// the files of objects which couldn't be downloaded are left as
+	// lfs.missingobjectpolicy says, but the pull still fails
+	if len(q.Errors()) > 0 {
+		singleCheckout.LeaveMissing(pointers.Remaining())
+	}
+
+	var failures transferFailures
+	failures.addQueue(q, queued)
+	if err := failures.err(); err != nil {
+		return err
+	}
+	return singleCheckout.failures.err()
+}
+
+// checkPullable asks the server whether it has the objects of the current ref
+// allowed by the filter which aren't stored locally, without downloading them
+// or changing the working copy. If it doesn't have them all, it returns an
+// error which exits with the code transferFailures chooses.
+func checkPullable(filter *filepathfilter.Filter) error {
+	ref, err := git.CurrentRef()
+	if err != nil {
+		return loggedErrorf(err, "Could not pull")
+	}
+
+	pointers := newPointerMap()
+	queued := 0
+	q := newDownloadCheckQueue()
+	gitscanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
+		if err != nil {
+			LoggedError(err, "Scanner error")
+			return
+		}
+
+		if pointers.Seen(p) {
+			return
+		}
+		pointers.Add(p)
+
+		lfs.LinkOrCopyFromReference(p.Oid, p.Size)
+		if lfs.ObjectExistsOfSize(p.Oid, p.Size) {
+			return
+		}
+
+		tracerx.Printf("check %v [%v]", p.Name, p.Oid)
+		q.Add(downloadTransfer(p))
+		queued++
+	})
+	gitscanner.Filter = filter
+
+	if err := gitscanner.ScanTree(ref.Sha); err != nil {
+		gitscanner.Close()
+		return err
+	}
+	gitscanner.Close()
+	q.Wait()
+
+	errs := q.Errors()
+	for _, err := range errs {
+		FullError(err)
+	}
+	if len(errs) > 0 {
+		Error("Not pulling: %d of %d objects can't be downloaded, so the working copy was left as it was", len(errs), queued)
+	}
+
+	var failures transferFailures
+	failures.addQueue(q, queued)
+	return failures.err()
 }
 
 // tracks LFS objects being downloaded, according to their unique OIDs.
@@ -139,9 +233,24 @@ func (m *pointerMap) All(oid string) []*lfs.WrappedPointer {
 	return pointers
 }
 
+// Remaining returns the pointers whose objects haven't been downloaded, once
+// the queue is done.
+func (m *pointerMap) Remaining() []*lfs.WrappedPointer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pointers []*lfs.WrappedPointer
+	for _, plist := range m.pointers {
+		pointers = append(pointers, plist...)
+	}
+	return pointers
+}
+
 func init() {
 	RegisterCommand("pull", pullCommand, func(cmd *cobra.Command) {
 		cmd.Flags().StringVarP(&includeArg, "include", "I", "", "Include a list of paths")
 		cmd.Flags().StringVarP(&excludeArg, "exclude", "X", "", "Exclude a list of paths")
+		cmd.Flags().IntVarP(&jobsArg, "jobs", "j", 0, "Transfer this many objects at once, overriding lfs.concurrenttransfers")
+		cmd.Flags().BoolVarP(&pullCheckFirst, "fast-forward-only-check", "", false, "Check that every object can be downloaded before changing the working copy")
+		addTimeoutFlag(cmd)
 	})
 }
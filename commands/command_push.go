@@ -1,8 +1,13 @@
 package commands
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/git-lfs/git-lfs/git"
 	"github.com/git-lfs/git-lfs/lfs"
@@ -14,144 +19,475 @@ var (
 	pushDryRun    = false
 	pushObjectIDs = false
 	pushAll       = false
+	pushBranches  = false
+	pushTags      = false
 	useStdin      = false
+	pushExitCode  = false
+	pushQueued    = false
+	pushLater     = false
+
+	pushFlushQueue = false
+	pushBackground = false
+
+	// pushObjectIDsFile is a file to read the oids to push with --object-id
+	// from, or "-" for stdin, as with --stdin.
+	pushObjectIDsFile = ""
 
 	// shares some global vars and functions with command_pre_push.go
 )
 
-func uploadsBetweenRefAndRemote(ctx *uploadContext, refnames []string) {
+// pushNothingExitCode is the exit code of 'git lfs push --exit-code' when
+// there was nothing to upload. Errors exit with 2, as other commands do.
+const pushNothingExitCode = 3
+
+// objectIDRE matches the oids given to 'git lfs push --object-id' on stdin or
+// in a file.
+var objectIDRE = regexp.MustCompile(`\A[0-9a-fA-F]{64}\z`)
+
+func uploadsBetweenRefAndRemote(ctx *uploadContext, refnames []string) error {
 	tracerx.Printf("Upload refs %v to remote %v", refnames, cfg.CurrentRemote)
 
-	gitscanner := lfs.NewGitScanner(nil)
+	gitscanner := newGitScanner(nil)
 	if err := gitscanner.RemoteForPush(cfg.CurrentRemote); err != nil {
-		ExitWithError(err)
+		return err
 	}
 	defer gitscanner.Close()
 
-	refs, err := refsByNames(refnames)
+	refs, err := pushRefsByRefspecs(refnames)
 	if err != nil {
 		Error(err.Error())
-		Exit("Error getting local refs.")
+		return errorf("Error getting local refs.")
 	}
 
+	// when pushing every ref, objects which are reachable from the
+	// remote's refs are skipped, as they would be without --all.
+	all := pushAll && len(refnames) > 0
+
+	ctx.startRefs(len(refs))
 	for _, ref := range refs {
-		pointers, err := scanLeftOrAll(gitscanner, ref.Name)
-		if err != nil {
-			Print("Error scanning for Git LFS files in the %q ref", ref.Name)
-			ExitWithError(err)
+		// objects are pushed to the endpoint of the remote ref, which
+		// may be overridden with "lfs.<ref>.url".
+		cfg.CurrentRef = ref.remote
+		warnDivergentPushedFiles(ref.local.Name, ref.local.Sha)
+		ctx.startRef(ref.local.Name)
+		pointers, errc := scanLeftOrAll(gitscanner, ref.local.Sha, all)
+		if err := uploadPointerStream(ctx, pointers); err != nil {
+			return err
+		}
+		if err := <-errc; err != nil {
+			Print("Error scanning for Git LFS files in the %q ref", ref.local.Name)
+			return err
 		}
-		uploadPointers(ctx, pointers)
 	}
+	ctx.finishRefs()
+	return nil
 }
 
-func scanLeftOrAll(g *lfs.GitScanner, ref string) ([]*lfs.WrappedPointer, error) {
-	var pointers []*lfs.WrappedPointer
-	var multiErr error
-	cb := func(p *lfs.WrappedPointer, err error) {
-		if err != nil {
-			if multiErr != nil {
-				multiErr = fmt.Errorf("%v\n%v", multiErr, err)
-			} else {
-				multiErr = err
+// scanBufferSize is the most pointers scanLeftOrAll finds ahead of those
+// being uploaded.
+const scanBufferSize = 1000
+
+// scanLeftOrAll sends the pointers in the commits reachable from ref which the
+// remote doesn't have, or in every commit reachable from it if all is true, to
+// the returned channel as they're found, and closes it once the scan is done.
+// The scan waits while the channel's buffer is full, so that the pointers of a
+// large history are never all held in memory at once. The scan's error, if
+// any, is then sent to the returned error channel, which must only be read
+// once the pointers have been.
+func scanLeftOrAll(g *lfs.GitScanner, ref string, all bool) (<-chan *lfs.WrappedPointer, <-chan error) {
+	pointers := make(chan *lfs.WrappedPointer, scanBufferSize)
+	errc := make(chan error, 1)
+
+	go func() {
+		var multiErr error
+		cb := func(p *lfs.WrappedPointer, err error) {
+			if err != nil {
+				if multiErr != nil {
+					multiErr = fmt.Errorf("%v\n%v", multiErr, err)
+				} else {
+					multiErr = err
+				}
+				return
 			}
-			return
+
+			pointers <- p
 		}
 
+		err := func() error {
+			if all {
+				if err := g.ScanRefWithDeleted(ref, cb); err != nil {
+					return err
+				}
+			}
+			if err := g.ScanLeftToRemote(ref, cb); err != nil {
+				return err
+			}
+			return multiErr
+		}()
+
+		close(pointers)
+		errc <- err
+	}()
+
+	return pointers, errc
+}
+
+// uploadsWithObjectIDs uploads the objects with the given oids, each optionally
+// given as "<oid>:<size>", and those read by readObjectIDs from each of the
+// given readers. The sizes of the objects stored locally are looked up where
+// none are given, so that the batch request carries them, as servers which
+// check them require. It fails if an object isn't stored locally and its size
+// isn't given, or if the size given doesn't match the local object's.
+func uploadsWithObjectIDs(ctx *uploadContext, oids []string, readers ...io.Reader) error {
+	pointers := make([]*lfs.WrappedPointer, 0, len(oids))
+	for _, oid := range oids {
+		p, err := parseObjectID(oid)
+		if err != nil {
+			return errorf("Invalid object ID %q: %s", oid, err)
+		}
 		pointers = append(pointers, p)
 	}
+	for _, r := range readers {
+		read, err := readObjectIDs(r)
+		if err != nil {
+			return errorf("Could not read object IDs: %s", err)
+		}
+		pointers = append(pointers, read...)
+	}
 
-	if pushAll {
-		if err := g.ScanRefWithDeleted(ref, cb); err != nil {
-			return pointers, err
+	unknown := 0
+	for _, p := range pointers {
+		size, ok := lfs.LocalObjectSize(p.Oid)
+		switch {
+		case ok && p.Size == 0:
+			p.Size = size
+		case ok && p.Size != size:
+			return errorf("Size %d given for %s, but the local object is %d bytes", p.Size, p.Oid, size)
+		case !ok && p.Size == 0:
+			Error("%s is not stored locally, so its size is unknown; give it as <oid>:<size>", p.Oid)
+			unknown++
 		}
 	}
-	if err := g.ScanLeftToRemote(ref, cb); err != nil {
-		return pointers, err
+	if unknown > 0 {
+		return codeErrorf(exitMissingObject, "")
 	}
-	return pointers, multiErr
+
+	return uploadPointers(ctx, pointers)
 }
 
-func uploadsWithObjectIDs(ctx *uploadContext, oids []string) {
-	pointers := make([]*lfs.WrappedPointer, len(oids))
-	for idx, oid := range oids {
-		pointers[idx] = &lfs.WrappedPointer{Pointer: &lfs.Pointer{Oid: oid}}
+// readObjectIDs reads the oids of objects to push from r, one per line, each
+// optionally followed by whitespace or ":" and the object's size. Blank lines,
+// and lines starting with "#", are skipped.
+func readObjectIDs(r io.Reader) ([]*lfs.WrappedPointer, error) {
+	var pointers []*lfs.WrappedPointer
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p, err := parseObjectID(strings.Join(strings.Fields(line), ":"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		pointers = append(pointers, p)
 	}
-	uploadPointers(ctx, pointers)
+	return pointers, scanner.Err()
+}
+
+// parseObjectID parses an oid given to 'git lfs push --object-id', optionally
+// followed by ":" and the object's size, as "<oid>[:<size>]".
+func parseObjectID(s string) (*lfs.WrappedPointer, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 2 || !objectIDRE.MatchString(parts[0]) {
+		return nil, fmt.Errorf("expected \"<oid>[:<size>]\", got %q", s)
+	}
+
+	p := &lfs.WrappedPointer{Pointer: &lfs.Pointer{Oid: strings.ToLower(parts[0])}}
+	if len(parts) == 2 {
+		size, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid size %q", parts[1])
+		}
+		p.Size = size
+	}
+	return p, nil
+}
+
+// pushRef is a ref given to "git lfs push": the local ref or commit whose
+// objects are pushed, and the full name of the remote ref it is pushed to, or
+// "" if there is none, as when pushing a commit by its SHA-1.
+type pushRef struct {
+	local  *git.Ref
+	remote string
 }
 
-func refsByNames(refnames []string) ([]*git.Ref, error) {
+// pushRefsByRefspecs resolves the refspecs given to "git lfs push" as "git
+// push" does:
+//
+//   - "<src>:<dst>" pushes src to dst, which is qualified as src is unless it is
+//     a full ref name, such as "refs/heads/master"
+//   - "<src>" pushes src to the remote ref of the same name
+//   - "HEAD" is the current branch
+//   - "tag <name>" is the same as "refs/tags/<name>:refs/tags/<name>"
+//   - "refs/heads/release/*:refs/heads/r/*" pushes every matching local ref,
+//     as described by pushRefsByPattern
+//
+// A leading "+" is ignored, and deletions such as ":<dst>" push nothing. The
+// local branches are pushed first if --branches is given, and the local tags
+// if --tags is, or every local ref if --all is given without refspecs.
+func pushRefsByRefspecs(refspecs []string) ([]*pushRef, error) {
 	localrefs, err := git.LocalRefs()
 	if err != nil {
 		return nil, err
 	}
 
-	if pushAll && len(refnames) == 0 {
-		return localrefs, nil
+	var refs []*pushRef
+	selectAll := pushAll && len(refspecs) == 0 && !pushBranches && !pushTags
+	for _, ref := range localrefs {
+		if selectAll ||
+			(pushBranches && ref.Type == git.RefTypeLocalBranch) ||
+			(pushTags && ref.Type == git.RefTypeLocalTag) {
+			refs = append(refs, &pushRef{local: ref, remote: ref.Refspec()})
+		}
 	}
 
-	reflookup := make(map[string]*git.Ref, len(localrefs))
-	for _, ref := range localrefs {
-		reflookup[ref.Name] = ref
+	for i := 0; i < len(refspecs); i++ {
+		refspec := strings.TrimPrefix(refspecs[i], "+")
+		if refspec == "tag" {
+			if i+1 >= len(refspecs) {
+				return nil, fmt.Errorf("tag shorthand without <tag>")
+			}
+			i++
+			refspec = "refs/tags/" + refspecs[i]
+		}
+
+		src, dst := refspec, ""
+		if idx := strings.Index(refspec, ":"); idx >= 0 {
+			src, dst = refspec[:idx], refspec[idx+1:]
+		}
+		if len(src) == 0 {
+			tracerx.Printf("push: nothing to upload for deletion %q", refspec)
+			continue
+		}
+
+		if strings.Contains(src, "*") {
+			matched, err := pushRefsByPattern(src, dst, localrefs)
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, matched...)
+			continue
+		}
+
+		local, err := resolvePushSource(src, localrefs)
+		if err != nil {
+			return nil, err
+		}
+
+		remote, err := resolvePushDestination(local, dst)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, &pushRef{local: local, remote: remote})
 	}
 
-	refs := make([]*git.Ref, len(refnames))
-	for i, name := range refnames {
-		if ref, ok := reflookup[name]; ok {
-			refs[i] = ref
-		} else {
-			refs[i] = &git.Ref{Name: name, Type: git.RefTypeOther, Sha: name}
+	return refs, nil
+}
+
+// pushRefsByPattern returns the local branches and tags whose full names
+// match the given pattern, whose "*" matches any part of a name, including
+// slashes. Each is pushed to the remote ref of the same name, or to the given
+// destination pattern with its "*" replaced by the part of the name matched.
+func pushRefsByPattern(src, dst string, localrefs []*git.Ref) ([]*pushRef, error) {
+	if strings.Count(src, "*") > 1 || (len(dst) > 0 && strings.Count(dst, "*") != 1) {
+		return nil, fmt.Errorf("invalid refspec pattern %q: it must have a single * on both sides", src+":"+dst)
+	}
+
+	var refs []*pushRef
+	for _, ref := range localrefs {
+		match, ok := matchRefPattern(src, ref.Refspec())
+		if !ok {
+			continue
+		}
+
+		remote := ref.Refspec()
+		if len(dst) > 0 {
+			var err error
+			remote, err = resolvePushDestination(ref, strings.Replace(dst, "*", match, 1))
+			if err != nil {
+				return nil, err
+			}
 		}
+		refs = append(refs, &pushRef{local: ref, remote: remote})
 	}
 
+	if len(refs) == 0 {
+		tracerx.Printf("push: no refs match %q", src)
+	}
 	return refs, nil
 }
 
+// matchRefPattern returns the part of the given full ref name matched by the
+// "*" in the given pattern, and whether the name matches it.
+func matchRefPattern(pattern, name string) (string, bool) {
+	idx := strings.Index(pattern, "*")
+	prefix, suffix := pattern[:idx], pattern[idx+1:]
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	return name[len(prefix) : len(name)-len(suffix)], true
+}
+
+// resolvePushSource returns the local branch or tag with the given full or
+// short name, or failing that the commit the name resolves to, such as that of
+// HEAD or a SHA-1. It returns an error if the name is both a branch and a tag,
+// as "git push" does.
+func resolvePushSource(src string, localrefs []*git.Ref) (*git.Ref, error) {
+	var matches []*git.Ref
+	for _, ref := range localrefs {
+		if ref.Refspec() == src {
+			return ref, nil
+		}
+		if ref.Name == src {
+			matches = append(matches, ref)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return git.ResolveRef(src)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("src refspec %s matches more than one", src)
+	}
+}
+
+// resolvePushDestination returns the full name of the remote ref the given
+// local ref is pushed to: that of the given destination if it is one already,
+// or the destination qualified as a branch or tag as the local ref is. Without
+// a destination, local branches and tags are pushed to the remote refs of the
+// same name, and commits to none.
+func resolvePushDestination(local *git.Ref, dst string) (string, error) {
+	if len(dst) == 0 {
+		switch local.Type {
+		case git.RefTypeHEAD, git.RefTypeOther:
+			return "", nil
+		}
+		return local.Refspec(), nil
+	}
+
+	if strings.HasPrefix(dst, "refs/") {
+		return dst, nil
+	}
+
+	switch local.Type {
+	case git.RefTypeLocalBranch:
+		return "refs/heads/" + dst, nil
+	case git.RefTypeLocalTag:
+		return "refs/tags/" + dst, nil
+	}
+	return "", fmt.Errorf("the destination %q is not a full ref name, starting with \"refs/\"", dst)
+}
+
 // pushCommand pushes local objects to a Git LFS server.  It takes two
 // arguments:
 //
-//   `<remote> <remote ref>`
+//   `<remote> <refspec>...`
 //
 // Remote must be a remote name, not a URL
 //
 // pushCommand calculates the git objects to send by looking comparing the range
 // of commits between the local and remote git servers.
-func pushCommand(cmd *cobra.Command, args []string) {
+func pushCommand(cmd *cobra.Command, args []string) error {
+	if pushFlushQueue {
+		return pushQueuedObjects(args)
+	}
+
 	if len(args) == 0 {
 		Print("Specify a remote and a remote branch name (`git lfs push origin master`)")
-		os.Exit(1)
+		return codeErrorf(1, "")
 	}
 
-	requireGitVersion()
+	if err := requireGitVersion(); err != nil {
+		return err
+	}
 
 	// Remote is first arg
 	if err := git.ValidateRemote(args[0]); err != nil {
-		Exit("Invalid remote name %q", args[0])
+		return errorf("Invalid remote name %q", args[0])
 	}
 
 	cfg.CurrentRemote = args[0]
+	if pushQueued {
+		return pushQueuedObjects(args[:1])
+	}
+
 	ctx := newUploadContext(pushDryRun)
+	ctx.Later = pushLater || cfg.PushLater()
+
+	if pushObjectIDs || useStdin || len(pushObjectIDsFile) > 0 {
+		var readers []io.Reader
+		if useStdin || pushObjectIDsFile == "-" {
+			readers = append(readers, os.Stdin)
+		}
+		if len(pushObjectIDsFile) > 0 && pushObjectIDsFile != "-" {
+			f, err := os.Open(pushObjectIDsFile)
+			if err != nil {
+				return errorf("Could not read object IDs: %s", err)
+			}
+			defer f.Close()
+			readers = append(readers, f)
+		}
 
-	if pushObjectIDs {
-		if len(args) < 2 {
+		if len(args) < 2 && len(readers) == 0 {
 			Print("Usage: git lfs push --object-id <remote> <lfs-object-id> [lfs-object-id] ...")
-			return
+			return nil
 		}
 
-		uploadsWithObjectIDs(ctx, args[1:])
+		if err := uploadsWithObjectIDs(ctx, args[1:], readers...); err != nil {
+			return err
+		}
 	} else {
 		if len(args) < 1 {
 			Print("Usage: git lfs push --dry-run <remote> [ref]")
-			return
+			return nil
+		}
+
+		if err := uploadsBetweenRefAndRemote(ctx, args[1:]); err != nil {
+			return err
 		}
+	}
 
-		uploadsBetweenRefAndRemote(ctx, args[1:])
+	// the last line of JSON progress already totals the push.
+	if format, _ := cfg.Os.Get("GIT_LFS_PROGRESS_FORMAT"); strings.ToLower(format) != "json" {
+		ctx.summary.Print(pushDryRun)
+	}
+	if pushExitCode && ctx.summary.Files == 0 {
+		return codeErrorf(pushNothingExitCode, "")
 	}
+
+	return nil
 }
 
 func init() {
 	RegisterCommand("push", pushCommand, func(cmd *cobra.Command) {
 		cmd.Flags().BoolVarP(&pushDryRun, "dry-run", "d", false, "Do everything except actually send the updates")
 		cmd.Flags().BoolVarP(&pushObjectIDs, "object-id", "o", false, "Push LFS object ID(s)")
+		cmd.Flags().BoolVarP(&useStdin, "stdin", "", false, "Push the LFS object IDs read from stdin, one per line")
+		cmd.Flags().StringVarP(&pushObjectIDsFile, "object-id-file", "", "", "Push the LFS object IDs read from this file, one per line")
 		cmd.Flags().BoolVarP(&pushAll, "all", "a", false, "Push all objects for the current ref to the remote.")
+		cmd.Flags().BoolVarP(&pushBranches, "branches", "", false, "Push the objects of every local branch")
+		cmd.Flags().BoolVarP(&pushTags, "tags", "", false, "Push the objects of every local tag")
+		cmd.Flags().BoolVarP(&pushExitCode, "exit-code", "", false, "Exit with 3 if there was nothing to upload")
+		cmd.Flags().BoolVarP(&pushQueued, "queued", "", false, "Push the objects queued to be pushed to the remote")
+		cmd.Flags().BoolVarP(&pushLater, "later", "", false, "Queue the objects to be pushed later with --flush-queue")
+		cmd.Flags().BoolVarP(&pushFlushQueue, "flush-queue", "", false, "Push the objects queued to be pushed to the remote, or to every remote")
+		cmd.Flags().BoolVarP(&pushBackground, "background", "", false, "With --flush-queue, push the queued objects in the background")
+		cmd.Flags().IntVarP(&jobsArg, "jobs", "j", 0, "Transfer this many objects at once, overriding lfs.concurrenttransfers")
+		addTimeoutFlag(cmd)
 	})
 }
@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"github.com/git-lfs/git-lfs/filepathfilter"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/spf13/cobra"
+)
+
+var (
+	renormalizeDryRun bool
+)
+
+// renormalizeCommand repairs the files, in the given paths or the whole tree,
+// which are staged or held in the working tree in another form than Git LFS
+// keeps them in: files tracked by Git LFS which are staged as their contents
+// are staged again through the clean filter, and those which are pointers in
+// the working tree are checked out.
+func renormalizeCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	paths, err := rootedPaths(args)
+	if err != nil {
+		return err
+	}
+
+	files, err := lfs.DivergentIndexFiles(filepathfilter.New(paths, nil))
+	if err != nil {
+		return err
+	}
+
+	var staged []string
+	var pointers []*lfs.WrappedPointer
+	for _, f := range files {
+		switch f.Divergence {
+		case lfs.DivergentContent:
+			Print("Renormalizing %s", f.Name)
+			staged = append(staged, f.Name)
+		case lfs.DivergentPointerFile:
+			Print("Checking out %s", f.Name)
+			pointers = append(pointers, &lfs.WrappedPointer{Name: f.Name, Mode: f.Mode, Pointer: f.Pointer})
+		default:
+			Error("Warning: %s", divergenceAdvice(f))
+		}
+	}
+
+	if renormalizeDryRun || len(staged)+len(pointers) == 0 {
+		return nil
+	}
+
+	if len(staged) > 0 {
+		if err := renormalizeContents(staged); err != nil {
+			return err
+		}
+	}
+
+	if len(pointers) > 0 {
+		singleCheckout, err := newSingleCheckout()
+		if err != nil {
+			return err
+		}
+		for _, p := range pointers {
+			singleCheckout.Run(p)
+		}
+		singleCheckout.Close()
+	}
+
+	return nil
+}
+
+// renormalizeContents stages the given files, relative to the root of the
+// repository, again through the clean filter, so that those tracked by Git LFS
+// are staged as pointers.
+func renormalizeContents(names []string) error {
+	if !git.Config.IsGitVersionAtLeast("2.16.0") {
+		return errorf("Renormalizing files requires git version >= 2.16.0, for `git add --renormalize`.")
+	}
+
+	root, err := git.RootDir()
+	if err != nil {
+		return err
+	}
+
+	addArgs := append([]string{"add", "--renormalize", "--"}, names...)
+	addCmd := subprocess.ExecCommand("git", addArgs...)
+	addCmd.Dir = root
+	if out, err := addCmd.CombinedOutput(); err != nil {
+		return errorf("Error renormalizing files: %s\n%s", err, out)
+	}
+	return nil
+}
+
+func init() {
+	RegisterCommand("renormalize", renormalizeCommand, func(cmd *cobra.Command) {
+		cmd.Flags().BoolVarP(&renormalizeDryRun, "dry-run", "d", false, "Show the files which would be repaired, without repairing them")
+	})
+}
@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/git-lfs/git-lfs/tq"
+	"github.com/spf13/cobra"
+)
+
+var (
+	resumeDryRun = false
+)
+
+// resumeCommand finishes the uploads and downloads recorded in the journals of
+// transfer queues which were interrupted, or which had failures.
+func resumeCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+	recoverTempObjects()
+
+	resumed := false
+	ok := true
+	for _, dir := range []tq.Direction{tq.Upload, tq.Download} {
+		path := transferJournalPath(dir)
+
+		state, err := tq.ReadJournal(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errorf("Could not read %s journal: %s", dir, err)
+		}
+
+		pending := state.Pending()
+		if len(pending) == 0 {
+			os.Remove(path)
+			continue
+		}
+
+		resumed = true
+		transferred, err := resumeTransfers(path, state, pending)
+		if err != nil {
+			return err
+		}
+		if !transferred {
+			ok = false
+		}
+	}
+
+	if !resumed {
+		Print("Nothing to resume.")
+	}
+	if !ok {
+		return codeErrorf(2, "")
+	}
+
+	return nil
+}
+
+// resumeTransfers queues the pending objects from the given journal state, with
+// the remotes they were to be transferred to or from, and returns whether they
+// were all transferred.
+func resumeTransfers(path string, state *tq.JournalState, pending []*tq.JournalEntry) (bool, error) {
+	if resumeDryRun {
+		for _, e := range pending {
+			if e.Committed > 0 {
+				Print("%s %s => %s (%s of %s committed)", state.Direction, e.Oid, e.Name, humanizeBytes(e.Committed), humanizeBytes(e.Size))
+			} else {
+				Print("%s %s => %s", state.Direction, e.Oid, e.Name)
+			}
+		}
+		return true, nil
+	}
+
+	var remotes []string
+	byRemote := make(map[string][]*tq.JournalEntry)
+	for _, e := range pending {
+		if _, ok := byRemote[e.Remote]; !ok {
+			remotes = append(remotes, e.Remote)
+		}
+		byRemote[e.Remote] = append(byRemote[e.Remote], e)
+	}
+
+	ok := true
+	for _, remote := range remotes {
+		transferred, err := resumeTransfersWith(path, state.Direction, remote, byRemote[remote])
+		if err != nil {
+			return false, err
+		}
+		if !transferred {
+			ok = false
+		}
+	}
+	return ok, nil
+}
+
+// resumeTransfersWith queues the given pending objects from the journal at
+// path to be transferred in the given direction to or from the given remote,
+// and returns whether they were all transferred.
+func resumeTransfersWith(path string, dir tq.Direction, remote string, pending []*tq.JournalEntry) (bool, error) {
+	Print("Resuming %s of %d object(s) with %s", dir, len(pending), remote)
+
+	cfg.CurrentRemote = remote
+	j, err := tq.CreateJournal(path, dir, remote)
+	if err != nil {
+		return false, errorf("Could not resume %s journal: %s", dir, err)
+	}
+
+	meter := buildProgressMeter(false)
+	options := []tq.Option{tq.WithProgress(meter), tq.WithJournal(j)}
+
+	var q *tq.TransferQueue
+	if dir == tq.Upload {
+		q = newUploadQueue(options...)
+	} else {
+		q = newDownloadQueue(options...)
+	}
+
+	for _, e := range pending {
+		meter.Add(e.Size)
+		q.Add(e.Name, e.Path, e.Oid, e.Size)
+	}
+
+	q.Wait()
+
+	for _, err := range q.Errors() {
+		FullError(err)
+	}
+	return len(q.Errors()) == 0, nil
+}
+
+func init() {
+	RegisterCommand("resume", resumeCommand, func(cmd *cobra.Command) {
+		cmd.Flags().BoolVarP(&resumeDryRun, "dry-run", "d", false, "List the objects that would be transferred, without transferring them.")
+	})
+}
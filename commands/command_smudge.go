@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
+	"github.com/git-lfs/git-lfs/config"
 	"github.com/git-lfs/git-lfs/errors"
 	"github.com/git-lfs/git-lfs/filepathfilter"
 	"github.com/git-lfs/git-lfs/lfs"
@@ -20,13 +22,14 @@ var (
 // smudge smudges the given `*lfs.Pointer`, "ptr", and writes its objects
 // contents to the `io.Writer`, "to".
 //
-// If the smudged object did not "pass" the include and exclude filterset, it
-// will not be downloaded, and the object will remain a pointer on disk, as if
-// the smudge filter had not been applied at all.
+// If the smudged object did not "pass" the include and exclude filterset, or
+// Git LFS is offline, it will not be downloaded, and the object will remain a
+// pointer on disk, as if the smudge filter had not been applied at all. If it
+// couldn't be downloaded, it's left as lfs.missingobjectpolicy says.
 //
-// Any errors encountered along the way will be returned immediately if they
-// were non-fatal, otherwise execution will halt and the process will be
-// terminated by using the `commands.Panic()` func.
+// Any errors encountered along the way will be returned immediately. Fatal
+// errors are returned as an *exitCodeError, which callers should pass back to
+// the command runner so that the process exits with its code.
 func smudge(to io.Writer, from io.Reader, filename string, skip bool, filter *filepathfilter.Filter) error {
 	ptr, pbuf, perr := lfs.DecodeFrom(from)
 	if perr != nil {
@@ -39,13 +42,17 @@ func smudge(to io.Writer, from io.Reader, filename string, skip bool, filter *fi
 		))
 	}
 
+	if len(ptr.Normalized) > 0 {
+		Error("Warning: %s: Git LFS pointer has %s; run `git lfs pointer --fix` to rewrite it", filename, strings.Join(ptr.Normalized, " and "))
+	}
+
 	lfs.LinkOrCopyFromReference(ptr.Oid, ptr.Size)
 	cb, file, err := lfs.CopyCallbackFile("smudge", filename, 1, 1)
 	if err != nil {
 		return err
 	}
 
-	download := !skip
+	download := !skip && !cfg.Offline()
 	if download {
 		download = filter.Allows(filename)
 	}
@@ -56,21 +63,28 @@ func smudge(to io.Writer, from io.Reader, filename string, skip bool, filter *fi
 	}
 
 	if err != nil {
-		ptr.Encode(to)
 		// Download declined error is ok to skip if we weren't requesting download
-		if !(errors.IsDownloadDeclinedError(err) && !download) {
-			LoggedError(err, "Error downloading object: %s (%s)", filename, ptr.Oid)
-			if !cfg.SkipDownloadErrors() {
-				os.Exit(2)
-			}
+		if errors.IsDownloadDeclinedError(err) && !download {
+			ptr.Encode(to)
+			return nil
+		}
+
+		LoggedError(err, "Error downloading object: %s (%s)", filename, ptr.Oid)
+		// Git writes the file, so a placeholder is left as a pointer,
+		// but can't be marked as one
+		ptr.Encode(to)
+		if cfg.MissingObjectPolicy() == config.MissingObjectFail {
+			return codeErrorf(2, "")
 		}
 	}
 
 	return nil
 }
 
-func smudgeCommand(cmd *cobra.Command, args []string) {
-	requireStdin("This command should be run by the Git 'smudge' filter")
+func smudgeCommand(cmd *cobra.Command, args []string) error {
+	if err := requireStdin("This command should be run by the Git 'smudge' filter"); err != nil {
+		return err
+	}
 	lfs.InstallHooks(false)
 
 	if !smudgeSkip && cfg.Os.Bool("GIT_LFS_SKIP_SMUDGE", false) {
@@ -81,10 +95,14 @@ func smudgeCommand(cmd *cobra.Command, args []string) {
 	if err := smudge(os.Stdout, os.Stdin, smudgeFilename(args), smudgeSkip, filter); err != nil {
 		if errors.IsNotAPointerError(err) {
 			fmt.Fprintln(os.Stderr, err.Error())
+		} else if _, fatal := err.(*exitCodeError); fatal {
+			return err
 		} else {
 			Error(err.Error())
 		}
 	}
+
+	return nil
 }
 
 func smudgeFilename(args []string) string {
@@ -2,58 +2,107 @@ package commands
 
 import (
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 
+	"github.com/git-lfs/git-lfs/api"
 	"github.com/git-lfs/git-lfs/git"
 	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/git-lfs/git-lfs/tq"
 	"github.com/spf13/cobra"
 )
 
 var (
-	porcelain = false
+	porcelain   = false
+	checkServer = false
 )
 
-func statusCommand(cmd *cobra.Command, args []string) {
-	requireInRepo()
+// statusBatchSize is the most objects --check-server asks the server about in
+// one batch request.
+const statusBatchSize = 100
+
+func statusCommand(cmd *cobra.Command, args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	if porcelain && checkServer {
+		return errorf("--check-server can't be used with --porcelain")
+	}
 
 	// tolerate errors getting ref so this works before first commit
 	ref, _ := git.CurrentRef()
 
 	scanIndexAt := "HEAD"
 	if ref == nil {
-		scanIndexAt = git.RefBeforeFirstCommit
+		scanIndexAt = git.EmptyTree()
 	}
 
 	if porcelain {
-		porcelainStagedPointers(scanIndexAt)
-		return
+		return porcelainStagedPointers(scanIndexAt)
 	}
 
-	statusScanRefRange(ref)
+	remoteRef, unpushedPointers, err := statusScanRefRange(ref)
+	if err != nil {
+		return err
+	}
 
-	Print("\nGit LFS objects to be committed:\n")
+	pathConverter, err := lfs.NewRepoToCurrentPathConverter()
+	if err != nil {
+		return err
+	}
 
-	var unstagedPointers []*lfs.WrappedPointer
-	indexScanner := lfs.NewGitScanner(func(p *lfs.WrappedPointer, err error) {
+	var stagedPointers, unstagedPointers []*lfs.WrappedPointer
+	var scanErr error
+	indexScanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
 		if err != nil {
-			ExitWithError(err)
+			if scanErr == nil {
+				scanErr = err
+			}
+			return
+		}
+		if statusUnmodified(p, pathConverter) {
 			return
 		}
 
-		switch p.Status {
-		case "R", "C":
-			Print("\t%s -> %s (%s)", p.SrcName, p.Name, humanizeBytes(p.Size))
-		case "M":
+		if p.Status == "M" {
 			unstagedPointers = append(unstagedPointers, p)
-		default:
-			Print("\t%s (%s)", p.Name, humanizeBytes(p.Size))
+		} else {
+			stagedPointers = append(stagedPointers, p)
 		}
 	})
 
 	if err := indexScanner.ScanIndex(scanIndexAt, nil); err != nil {
-		ExitWithError(err)
+		return err
 	}
 
 	indexScanner.Close()
+	if scanErr != nil {
+		return scanErr
+	}
+
+	var onServer map[string]bool
+	if checkServer {
+		onServer = statusCheckServer(unpushedPointers, stagedPointers)
+	}
+
+	if remoteRef != nil {
+		Print("Git LFS objects to be pushed to %s:\n", remoteRef.Name)
+		for _, p := range unpushedPointers {
+			Print("\t%s (%s)", p.Name, statusObjectDetails(p, onServer))
+		}
+	}
+
+	Print("\nGit LFS objects to be committed:\n")
+	for _, p := range stagedPointers {
+		switch p.Status {
+		case "R", "C":
+			Print("\t%s -> %s (%s)", p.SrcName, p.Name, statusObjectDetails(p, onServer))
+		default:
+			Print("\t%s (%s)", p.Name, statusObjectDetails(p, onServer))
+		}
+	}
 
 	Print("\nGit LFS objects not staged for commit:\n")
 	for _, p := range unstagedPointers {
@@ -62,42 +111,204 @@ func statusCommand(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if onServer != nil {
+		statusUploadSummary(onServer, unpushedPointers, stagedPointers)
+	}
+
+	if err := statusDivergentFiles(); err != nil {
+		return err
+	}
+	statusQueuedPushes()
+
 	Print("")
+
+	return nil
 }
 
-func statusScanRefRange(ref *git.Ref) {
-	if ref == nil {
+// statusDivergentFiles lists the files which are staged, or held in the working
+// tree, in another form than Git LFS keeps them in, with how to fix them, if
+// there are any.
+func statusDivergentFiles() error {
+	files, err := lfs.DivergentChangedFiles(nil)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	Print("\nGit LFS files which need fixing:\n")
+	for _, f := range files {
+		Print("\t%s", divergenceAdvice(f))
+	}
+	return nil
+}
+
+// statusQueuedPushes lists the objects queued to be pushed to each remote while
+// Git LFS was offline, if there are any.
+func statusQueuedPushes() {
+	files, err := ioutil.ReadDir(pushQueueDir())
+	if err != nil {
 		return
 	}
 
+	for _, file := range files {
+		state, err := tq.ReadJournal(filepath.Join(pushQueueDir(), file.Name()))
+		if err != nil {
+			continue
+		}
+
+		pending := state.Pending()
+		if len(pending) == 0 {
+			continue
+		}
+
+		Print("\nGit LFS objects queued to be pushed to %s:\n", state.Remote)
+		for _, e := range pending {
+			Print("\t%s (%s)", e.Name, humanizeBytes(e.Size))
+		}
+	}
+}
+
+// statusScanRefRange returns the remote ref the given branch tracks, and the
+// pointers in its commits which the remote ref doesn't have, or nil if it
+// doesn't track one.
+func statusScanRefRange(ref *git.Ref) (*git.Ref, []*lfs.WrappedPointer, error) {
+	if ref == nil {
+		return nil, nil, nil
+	}
+
 	Print("On branch %s", ref.Name)
 
 	remoteRef, err := git.CurrentRemoteRef()
 	if err != nil {
-		return
+		return nil, nil, nil
 	}
 
-	gitscanner := lfs.NewGitScanner(func(p *lfs.WrappedPointer, err error) {
+	var pointers []*lfs.WrappedPointer
+	var scanErr error
+	gitscanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
 		if err != nil {
-			Panic(err, "Could not scan for Git LFS objects")
+			if scanErr == nil {
+				scanErr = err
+			}
 			return
 		}
 
-		Print("\t%s (%s)", p.Name, humanizeBytes(p.Size))
+		pointers = append(pointers, p)
 	})
 	defer gitscanner.Close()
 
-	Print("Git LFS objects to be pushed to %s:\n", remoteRef.Name)
 	if err := gitscanner.ScanRefRange(ref.Sha, "^"+remoteRef.Sha, nil); err != nil {
-		Panic(err, "Could not scan for Git LFS objects")
+		return nil, nil, loggedErrorf(err, "Could not scan for Git LFS objects")
+	}
+	if scanErr != nil {
+		return nil, nil, loggedErrorf(scanErr, "Could not scan for Git LFS objects")
 	}
 
+	return remoteRef, pointers, nil
 }
 
-func porcelainStagedPointers(ref string) {
-	gitscanner := lfs.NewGitScanner(func(p *lfs.WrappedPointer, err error) {
+// statusCheckServer asks the server which of the objects of the given pointers
+// it already has, in one batch request for every statusBatchSize objects. It
+// returns nil if the server couldn't be asked.
+func statusCheckServer(pointerLists ...[]*lfs.WrappedPointer) map[string]bool {
+	if cfg.Offline() {
+		Error("Not checking the server for Git LFS objects while offline")
+		return nil
+	}
+
+	seen := tools.NewStringSet()
+	var objects []*api.ObjectResource
+	for _, pointers := range pointerLists {
+		for _, p := range pointers {
+			if seen.Add(p.Oid) {
+				objects = append(objects, &api.ObjectResource{Oid: p.Oid, Size: p.Size})
+			}
+		}
+	}
+
+	onServer := make(map[string]bool, len(objects))
+	for start := 0; start < len(objects); start += statusBatchSize {
+		end := tools.MinInt(start+statusBatchSize, len(objects))
+		objs, _, err := api.Batch(cfg, objects[start:end], "download", nil)
 		if err != nil {
-			ExitWithError(err)
+			Error("Could not check the server for Git LFS objects: %s", err)
+			return nil
+		}
+
+		for _, o := range objs {
+			if _, ok := o.Rel("download"); ok && o.Error == nil {
+				onServer[o.Oid] = true
+			}
+		}
+	}
+	return onServer
+}
+
+// statusObjectDetails returns the size of the object of the given pointer, and
+// whether the server has it if it was asked.
+func statusObjectDetails(p *lfs.WrappedPointer, onServer map[string]bool) string {
+	size := humanizeBytes(p.Size)
+	switch {
+	case onServer == nil:
+		return size
+	case onServer[p.Oid]:
+		return size + ", on the server"
+	default:
+		return size + ", to upload"
+	}
+}
+
+// statusUploadSummary prints how many of the objects of the given pointers
+// pushing would upload, and how many the server already has.
+func statusUploadSummary(onServer map[string]bool, pointerLists ...[]*lfs.WrappedPointer) {
+	var uploadFiles, serverFiles int
+	var uploadBytes, serverBytes int64
+
+	seen := tools.NewStringSet()
+	for _, pointers := range pointerLists {
+		for _, p := range pointers {
+			if !seen.Add(p.Oid) {
+				continue
+			}
+			if onServer[p.Oid] {
+				serverFiles++
+				serverBytes += p.Size
+			} else {
+				uploadFiles++
+				uploadBytes += p.Size
+			}
+		}
+	}
+
+	Print("\n%d files to upload (%s), %d files already on the server (%s)",
+		uploadFiles, humanizeBytes(uploadBytes), serverFiles, humanizeBytes(serverBytes))
+}
+
+// statusUnmodified returns whether the given pointer is of a file which Git
+// reports as modified in the working tree only because its stat info changed,
+// as the checksum database has it still holding the object it had in HEAD.
+func statusUnmodified(p *lfs.WrappedPointer, pathConverter lfs.PathConverter) bool {
+	return p.Status == "M" && worktreeFileHolds(p.Name, pathConverter.Convert(p.Name), p.Oid)
+}
+
+func porcelainStagedPointers(ref string) error {
+	pathConverter, err := lfs.NewRepoToCurrentPathConverter()
+	if err != nil {
+		return err
+	}
+
+	var scanErr error
+	gitscanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
+		if err != nil {
+			if scanErr == nil {
+				scanErr = err
+			}
+			return
+		}
+		if statusUnmodified(p, pathConverter) {
+			return
 		}
 
 		switch p.Status {
@@ -112,8 +323,9 @@ func porcelainStagedPointers(ref string) {
 	defer gitscanner.Close()
 
 	if err := gitscanner.ScanIndex(ref, nil); err != nil {
-		ExitWithError(err)
+		return err
 	}
+	return scanErr
 }
 
 var byteUnits = []string{"B", "KB", "MB", "GB", "TB"}
@@ -139,5 +351,6 @@ func humanizeBytes(bytes int64) string {
 func init() {
 	RegisterCommand("status", statusCommand, func(cmd *cobra.Command) {
 		cmd.Flags().BoolVarP(&porcelain, "porcelain", "p", false, "Give the output in an easy-to-parse format for scripts.")
+		cmd.Flags().BoolVarP(&checkServer, "check-server", "", false, "Show which objects the server already has.")
 	})
 }
@@ -1,20 +1,19 @@
 package commands
 
 import (
-	"bufio"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/rubyist/tracerx"
-
 	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/filepathfilter"
 	"github.com/git-lfs/git-lfs/git"
 	"github.com/git-lfs/git-lfs/lfs"
-	"github.com/git-lfs/git-lfs/tools"
 	"github.com/spf13/cobra"
 )
 
@@ -23,39 +22,75 @@ var (
 		".git", ".lfs",
 	}
 
-	trackVerboseLoggingFlag bool
-	trackDryRunFlag         bool
+	trackDryRunFlag      bool
+	trackLockableFlag    bool
+	trackMacrosFlag      bool
+	trackLintFlag        bool
+	trackRenormalizeFlag bool
+	trackSizeReportFlag  bool
+	trackAboveFlag       = "1m"
 )
 
-func trackCommand(cmd *cobra.Command, args []string) {
-	requireGitVersion()
+func trackCommand(cmd *cobra.Command, args []string) error {
+	if err := requireGitVersion(); err != nil {
+		return err
+	}
 
 	if config.LocalGitDir == "" {
 		Print("Not a git repository.")
-		os.Exit(128)
+		return codeErrorf(128, "")
 	}
 
 	if config.LocalWorkingDir == "" {
 		Print("This operation must be run in a work tree.")
-		os.Exit(128)
+		return codeErrorf(128, "")
+	}
+
+	ignoreCase := cfg.Git.Bool("core.ignorecase", false)
+
+	if trackLintFlag {
+		problems, err := lintAttributes(ignoreCase)
+		if err != nil {
+			return err
+		}
+		for _, problem := range problems {
+			Print(problem)
+		}
+		if len(problems) > 0 {
+			return codeErrorf(1, "")
+		}
+		return nil
+	}
+
+	if trackSizeReportFlag {
+		return reportFilenameSizes(ignoreCase)
 	}
 
 	lfs.InstallHooks(false)
+
+	if trackMacrosFlag {
+		if err := useAttributeMacros(); err != nil {
+			return err
+		}
+	}
+
 	knownPatterns := findPatterns()
+	lines, _ := lfs.ReadAttributesLines()
+	macros := lfs.LocalAttributeMacros()
 
 	if len(args) == 0 {
 		Print("Listing tracked patterns")
 		for _, t := range knownPatterns {
 			Print("    %s (%s)", t.Pattern, t.Source)
 		}
-		return
+		return nil
 	}
 
 	addTrailingLinebreak := needsTrailingLinebreak(".gitattributes")
 	attributesFile, err := os.OpenFile(".gitattributes", os.O_RDWR|os.O_APPEND|os.O_CREATE, 0660)
 	if err != nil {
 		Print("Error opening .gitattributes file")
-		return
+		return nil
 	}
 	defer attributesFile.Close()
 
@@ -65,22 +100,46 @@ func trackCommand(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	attrs := trackAttributes(macros)
+
 	wd, _ := os.Getwd()
 	relpath, err := filepath.Rel(config.LocalWorkingDir, wd)
 	if err != nil {
-		Exit("Current directory %q outside of git working directory %q.", wd, config.LocalWorkingDir)
+		return errorf("Current directory %q outside of git working directory %q.", wd, config.LocalWorkingDir)
 	}
 
+	var matched []string
+
 ArgsLoop:
 	for _, unsanitizedPattern := range args {
 		pattern := cleanRootPath(unsanitizedPattern)
 		for _, known := range knownPatterns {
 			if known.Pattern == filepath.Join(relpath, pattern) {
 				Print("%s already supported", pattern)
+				if trackRenormalizeFlag {
+					gittracked, err := git.GetTrackedFiles(pattern)
+					if err != nil {
+						return errorf("Error getting tracked files for %q: %s", pattern, err)
+					}
+					matched = append(matched, gittracked...)
+				}
 				continue ArgsLoop
 			}
 		}
 
+		if reason := unsupportedPattern(pattern); len(reason) > 0 {
+			Print("Pattern %s cannot be tracked: %s", pattern, reason)
+			continue
+		}
+
+		added := &lfs.AttributesLine{Dir: filepath.ToSlash(relpath), Pattern: pattern}
+		if added.Dir == "." {
+			added.Dir = ""
+		}
+		for _, warning := range trackPatternWarnings(added, lines, macros, ignoreCase) {
+			Print(warning)
+		}
+
 		// Make sure any existing git tracked files have their timestamp updated
 		// so they will now show as modifed
 		// note this is relative to current dir which is how we write .gitattributes
@@ -90,15 +149,15 @@ ArgsLoop:
 		// Since all `git-lfs track` calls are relative to the root of
 		// the repository, the leading slash is simply removed for its
 		// implicit counterpart.
-		if trackVerboseLoggingFlag {
+		if isVerbose() {
 			Print("Searching for files matching pattern: %s", pattern)
 		}
 		gittracked, err := git.GetTrackedFiles(pattern)
 		if err != nil {
-			Exit("Error getting tracked files for %q: %s", pattern, err)
+			return errorf("Error getting tracked files for %q: %s", pattern, err)
 		}
 
-		if trackVerboseLoggingFlag {
+		if isVerbose() {
 			Print("Found %d files previously added to Git matching pattern: %s", len(gittracked), pattern)
 		}
 
@@ -116,16 +175,17 @@ ArgsLoop:
 
 		if !trackDryRunFlag {
 			encodedArg := strings.Replace(pattern, " ", "[[:space:]]", -1)
-			_, err := attributesFile.WriteString(fmt.Sprintf("%s filter=lfs diff=lfs merge=lfs -text\n", encodedArg))
+			_, err := attributesFile.WriteString(fmt.Sprintf("%s %s\n", encodedArg, attrs))
 			if err != nil {
 				Print("Error adding pattern %s", pattern)
 				continue
 			}
 		}
 		Print("Tracking %s", pattern)
+		matched = append(matched, gittracked...)
 
 		for _, f := range gittracked {
-			if trackVerboseLoggingFlag || trackDryRunFlag {
+			if isVerbose() || trackDryRunFlag {
 				Print("Git LFS: touching %s", f)
 			}
 
@@ -139,6 +199,56 @@ ArgsLoop:
 			}
 		}
 	}
+
+	if !trackDryRunFlag {
+		paths, err := rootedPaths(matched)
+		if err != nil {
+			return err
+		}
+		return renormalizeTrackedFiles(paths)
+	}
+
+	return nil
+}
+
+// renormalizeTrackedFiles stages the given files, which the patterns just
+// tracked match, again through the clean filter if they're staged as their
+// contents, when --renormalize is given, or otherwise tells how to, so that
+// they don't stay in Git as their contents.
+func renormalizeTrackedFiles(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	files, err := lfs.DivergentIndexFiles(filepathfilter.New(paths, nil))
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		wanted[p] = true
+	}
+
+	var contents []string
+	for _, f := range files {
+		if f.Divergence == lfs.DivergentContent && wanted[f.Name] {
+			contents = append(contents, f.Name)
+		}
+	}
+	if len(contents) == 0 {
+		return nil
+	}
+
+	if !trackRenormalizeFlag {
+		Print("%d file(s) matching the tracked patterns are staged as their contents rather than pointers; run `git lfs track --renormalize`, or `git lfs renormalize`, to stage them as pointers", len(contents))
+		return nil
+	}
+
+	for _, name := range contents {
+		Print("Renormalizing %s", name)
+	}
+	return renormalizeContents(contents)
 }
 
 type mediaPattern struct {
@@ -146,56 +256,108 @@ type mediaPattern struct {
 	Source  string
 }
 
-func findPatterns() []mediaPattern {
-	var patterns []mediaPattern
+// trackAttributes returns the attributes which "git lfs track" gives new
+// patterns: the "lfs" or "lfs-lockable" macro, if it is defined, or otherwise
+// the attributes it stands for.
+func trackAttributes(macros lfs.AttributeMacroSet) string {
+	if trackLockableFlag {
+		if macros.Defines(lfs.LFSLockableMacro) && macros.Defines(lfs.LFSMacro) {
+			return lfs.LFSLockableMacro.Name
+		}
+		return "filter=lfs diff=lfs merge=lfs -text lockable"
+	}
 
-	for _, path := range findAttributeFiles() {
-		attributes, err := os.Open(path)
-		if err != nil {
+	if macros.Defines(lfs.LFSMacro) {
+		return lfs.LFSMacro.Name
+	}
+	return "filter=lfs diff=lfs merge=lfs -text"
+}
+
+// useAttributeMacros defines Git LFS's attribute macros at the top of the root
+// .gitattributes file, unless they are already, and rewrites the lines of each
+// .gitattributes file which set the same attributes as one of them to use it
+// instead.
+func useAttributeMacros() error {
+	root := filepath.Join(config.LocalWorkingDir, ".gitattributes")
+	macros := lfs.LocalAttributeMacros()
+
+	var definitions []string
+	for _, m := range lfs.AttributeMacros {
+		if macros.Defines(m) {
+			continue
+		}
+		if _, ok := macros[m.Name]; ok {
+			Print("Attribute macro %s is already defined differently, not using it", m.Name)
 			continue
 		}
 
-		scanner := bufio.NewScanner(attributes)
+		Print("Defining attribute macro %s", m.Name)
+		macros.Define(m.Definition())
+		definitions = append(definitions, m.Definition())
+	}
 
-		for scanner.Scan() {
-			line := scanner.Text()
-			if strings.Contains(line, "filter=lfs") {
-				fields := strings.Fields(line)
-				relfile, _ := filepath.Rel(config.LocalWorkingDir, path)
-				pattern := fields[0]
-				if reldir := filepath.Dir(relfile); len(reldir) > 0 {
-					pattern = filepath.Join(reldir, pattern)
-				}
+	if len(definitions) > 0 && !trackDryRunFlag {
+		data, err := ioutil.ReadFile(root)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
 
-				patterns = append(patterns, mediaPattern{Pattern: pattern, Source: relfile})
-			}
+		data = append([]byte(strings.Join(definitions, "\n")+"\n"), data...)
+		if err := ioutil.WriteFile(root, data, 0644); err != nil {
+			return err
 		}
 	}
 
-	return patterns
-}
+	for _, path := range lfs.AttributesFiles() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
 
-func findAttributeFiles() []string {
-	var paths []string
+		relfile, _ := filepath.Rel(config.LocalWorkingDir, path)
+		changed := false
 
-	repoAttributes := filepath.Join(config.LocalGitDir, "info", "attributes")
-	if info, err := os.Stat(repoAttributes); err == nil && !info.IsDir() {
-		paths = append(paths, repoAttributes)
-	}
+		lines := strings.Split(string(data), "\n")
+		for i, line := range lines {
+			pattern, attrs, ok := lfs.ParseAttributesLine(line)
+			if !ok || !macros.TracksWithLFS(attrs) {
+				continue
+			}
 
-	tools.FastWalkGitRepo(config.LocalWorkingDir, func(parentDir string, info os.FileInfo, err error) {
-		if err != nil {
-			tracerx.Printf("Error finding .gitattributes: %v", err)
-			return
+			shortened := macros.Shorten(attrs, lfs.AttributeMacros)
+			if strings.Join(shortened, " ") == strings.Join(attrs, " ") {
+				continue
+			}
+
+			Print("Using attribute macro %s for %s (%s)", shortened[0], pattern, relfile)
+			lines[i] = pattern + " " + strings.Join(shortened, " ")
+			changed = true
+		}
+
+		if changed && !trackDryRunFlag {
+			if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+				return err
+			}
 		}
+	}
+	return nil
+}
+
+func findPatterns() []mediaPattern {
+	var patterns []mediaPattern
 
-		if info.IsDir() || info.Name() != ".gitattributes" {
-			return
+	lines, _ := lfs.ReadAttributesLines()
+	macros := lfs.LocalAttributeMacros()
+	for _, l := range lines {
+		if macros.TracksWithLFS(l.Attrs) {
+			patterns = append(patterns, mediaPattern{
+				Pattern: filepath.FromSlash(path.Join(l.Dir, l.Pattern)),
+				Source:  filepath.FromSlash(l.Source),
+			})
 		}
-		paths = append(paths, filepath.Join(parentDir, info.Name()))
-	})
+	}
 
-	return paths
+	return patterns
 }
 
 func needsTrailingLinebreak(filename string) bool {
@@ -236,7 +398,12 @@ func blocklistItem(name string) string {
 
 func init() {
 	RegisterCommand("track", trackCommand, func(cmd *cobra.Command) {
-		cmd.Flags().BoolVarP(&trackVerboseLoggingFlag, "verbose", "v", false, "log which files are being tracked and modified")
 		cmd.Flags().BoolVarP(&trackDryRunFlag, "dry-run", "d", false, "preview results of running `git lfs track`")
+		cmd.Flags().BoolVarP(&trackLockableFlag, "lockable", "l", false, "make the paths 'lockable'")
+		cmd.Flags().BoolVarP(&trackMacrosFlag, "macros", "", false, "use attribute macros in .gitattributes")
+		cmd.Flags().BoolVarP(&trackLintFlag, "lint", "", false, "check .gitattributes for patterns which do not work as intended")
+		cmd.Flags().BoolVarP(&trackRenormalizeFlag, "renormalize", "", false, "stage files already added which the patterns match as pointers")
+		cmd.Flags().BoolVarP(&trackSizeReportFlag, "filename-size-report", "", false, "report how many files in the working copy each pattern tracks, and their size")
+		cmd.Flags().StringVar(&trackAboveFlag, "above", trackAboveFlag, "with --filename-size-report, report files of at least this size which no pattern tracks")
 	})
 }
@@ -1,36 +1,285 @@
 package commands
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/git"
 	"github.com/git-lfs/git-lfs/lfs"
 	"github.com/git-lfs/git-lfs/localstorage"
 	"github.com/spf13/cobra"
 )
 
+var (
+	localUninstall   = false
+	systemUninstall  = false
+	purgeUninstall   = false
+	convertUninstall = ""
+)
+
 // uninstallCmd removes any configuration and hooks set by Git LFS.
-func uninstallCommand(cmd *cobra.Command, args []string) {
-	if err := lfs.UninstallFilters(); err != nil {
+func uninstallCommand(cmd *cobra.Command, args []string) error {
+	if localUninstall && systemUninstall {
+		return errorf("Only one of --local and --system options can be specified.")
+	}
+
+	switch convertUninstall {
+	case "", "pointers", "files":
+	default:
+		return errorf("Invalid --convert value %q: expected \"pointers\" or \"files\".", convertUninstall)
+	}
+	if len(convertUninstall) > 0 && !purgeUninstall {
+		return errorf("--convert can only be used with --purge")
+	}
+
+	if localUninstall || purgeUninstall {
+		if err := requireInRepo(); err != nil {
+			return err
+		}
+	}
+
+	var pointers []*lfs.WrappedPointer
+	if len(convertUninstall) > 0 {
+		var err error
+		if pointers, err = uninstallConvertiblePointers(); err != nil {
+			return err
+		}
+	}
+
+	opt := lfs.InstallOptions{Local: localUninstall, System: systemUninstall}
+	if err := lfs.UninstallFilters(opt); err != nil {
 		Error(err.Error())
 	}
 
-	Print("Global Git LFS configuration has been removed.")
+	if localUninstall {
+		Print("Local Git LFS configuration has been removed.")
+	} else if systemUninstall {
+		Print("System Git LFS configuration has been removed.")
+	} else {
+		Print("Global Git LFS configuration has been removed.")
+	}
+
+	if purgeUninstall && !localUninstall {
+		if err := lfs.UninstallFilters(lfs.InstallOptions{Local: true}); err != nil {
+			Error(err.Error())
+		}
+		Print("Local Git LFS configuration has been removed.")
+	}
 
 	if lfs.InRepo() {
 		localstorage.InitStorageOrFail()
-		uninstallHooksCommand(cmd, args)
+		if err := uninstallHooksCommand(cmd, args); err != nil {
+			return err
+		}
+		if _, err := unregisterMaintenance(); err != nil {
+			return err
+		}
+	}
+
+	if purgeUninstall {
+		if err := uninstallAttributes(); err != nil {
+			return err
+		}
 	}
+
+	switch convertUninstall {
+	case "pointers":
+		return uninstallConvertToPointers(pointers)
+	case "files":
+		return uninstallConvertToFiles(pointers)
+	}
+
+	return nil
 }
 
 // uninstallHooksCmd removes any hooks created by Git LFS.
-func uninstallHooksCommand(cmd *cobra.Command, args []string) {
+func uninstallHooksCommand(cmd *cobra.Command, args []string) error {
 	if err := lfs.UninstallHooks(); err != nil {
 		Error(err.Error())
 	}
 
 	Print("Hooks for this repository have been removed.")
+
+	return nil
+}
+
+// uninstallAttributes removes the lines which track files with Git LFS from
+// the repository's attributes files.
+func uninstallAttributes() error {
+	removed, err := lfs.RemoveLFSAttributes()
+
+	paths := make([]string, 0, len(removed))
+	for path := range removed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		name := path
+		if rel, err := filepath.Rel(config.LocalWorkingDir, path); err == nil {
+			name = filepath.ToSlash(rel)
+		}
+		Print("Removed %d Git LFS line(s) from %s", removed[path], name)
+	}
+
+	return err
+}
+
+// uninstallConvertiblePointers returns the files of the current commit which
+// are tracked by Git LFS and unchanged in the working tree, which --convert
+// converts. With --convert=files, it fails if any of them hasn't been checked
+// out, as there would be no contents to keep.
+func uninstallConvertiblePointers() ([]*lfs.WrappedPointer, error) {
+	ref, err := git.CurrentRef()
+	if err != nil {
+		// no commits yet, so no files to convert
+		return nil, nil
+	}
+
+	changes, err := git.WorkingCopyChanges()
+	if err != nil {
+		return nil, err
+	}
+
+	var pointers []*lfs.WrappedPointer
+	var scanErr error
+	gitscanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
+		if err != nil {
+			if scanErr == nil {
+				scanErr = err
+			}
+			return
+		}
+
+		if _, changed := changes[p.Name]; changed {
+			Error("Skipping %s, which has uncommitted changes", p.Name)
+			return
+		}
+		pointers = append(pointers, p)
+	})
+
+	if err := gitscanner.ScanTree(ref.Sha); err != nil {
+		scanErr = err
+	}
+	gitscanner.Close()
+	if scanErr != nil {
+		return nil, errorf("Could not scan for Git LFS files: %s", scanErr)
+	}
+
+	if convertUninstall != "files" {
+		return pointers, nil
+	}
+
+	var missing int
+	for _, p := range pointers {
+		if uninstallIsPointerFile(p) {
+			Error("%s hasn't been checked out", p.Name)
+			missing++
+		}
+	}
+	if missing > 0 {
+		return nil, errorf("%d file(s) hold pointers instead of their contents. Run `git lfs pull` before converting them to plain files.", missing)
+	}
+	return pointers, nil
+}
+
+// uninstallIsPointerFile returns whether the given file in the working tree
+// holds a pointer, rather than the contents of its object.
+func uninstallIsPointerFile(p *lfs.WrappedPointer) bool {
+	path := filepath.Join(config.LocalWorkingDir, p.Name)
+	if fi, err := os.Lstat(path); err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+
+	_, err := lfs.DecodePointerFromFile(path)
+	return err == nil
+}
+
+// uninstallConvertToPointers replaces the checked out files of the given
+// pointers with the pointers themselves, as Git will now check them out.
+func uninstallConvertToPointers(pointers []*lfs.WrappedPointer) error {
+	var names []string
+	for _, p := range pointers {
+		if uninstallIsPointerFile(p) {
+			continue
+		}
+
+		if err := uninstallWritePointer(p); err != nil {
+			Error("Could not convert %s: %s", p.Name, err)
+			continue
+		}
+		names = append(names, p.Name)
+	}
+
+	if len(names) > 0 {
+		if err := renormalizeContents(names); err != nil {
+			return err
+		}
+	}
+	Print("Converted %d file(s) to pointers.", len(names))
+	return nil
+}
+
+// uninstallWritePointer replaces the given file with its pointer, through a
+// temporary file, so that an object store hard linked to it is left alone.
+func uninstallWritePointer(p *lfs.WrappedPointer) error {
+	path := filepath.Join(config.LocalWorkingDir, p.Name)
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".lfs-uninstall")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.WriteString(p.Pointer.Encoded())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), fi.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// uninstallConvertToFiles stages the checked out files of the given pointers
+// again, now that they're no longer tracked by Git LFS, so that the next
+// commit stores their contents in Git itself.
+func uninstallConvertToFiles(pointers []*lfs.WrappedPointer) error {
+	names := make([]string, 0, len(pointers))
+	for _, p := range pointers {
+		names = append(names, p.Name)
+	}
+
+	if len(names) > 0 {
+		if err := renormalizeContents(names); err != nil {
+			return err
+		}
+	}
+	Print("Converted %d file(s) to plain files.", len(names))
+	return nil
 }
 
 func init() {
 	RegisterCommand("uninstall", uninstallCommand, func(cmd *cobra.Command) {
+		cmd.Flags().BoolVarP(&localUninstall, "local", "l", false, "Remove the Git LFS config from the repository's local config only.")
+		cmd.Flags().BoolVarP(&systemUninstall, "system", "", false, "Remove the Git LFS config from the system config only.")
+		cmd.Flags().BoolVarP(&purgeUninstall, "purge", "", false, "Also remove Git LFS from the repository's config and attributes.")
+		cmd.Flags().StringVarP(&convertUninstall, "convert", "", "", "With --purge, convert the files tracked by Git LFS to \"pointers\" or \"files\".")
 		cmd.AddCommand(NewCommand("hooks", uninstallHooksCommand))
 		cmd.PreRun = setupLocalStorage
 	})
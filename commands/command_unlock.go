@@ -22,30 +22,30 @@ type unlockFlags struct {
 	Force bool
 }
 
-func unlockCommand(cmd *cobra.Command, args []string) {
+func unlockCommand(cmd *cobra.Command, args []string) error {
 	if len(lockRemote) > 0 {
 		cfg.CurrentRemote = lockRemote
 	}
 
 	lockClient, err := locking.NewClient(cfg)
 	if err != nil {
-		Exit("Unable to create lock system: %v", err.Error())
+		return errorf("Unable to create lock system: %v", err.Error())
 	}
 	defer lockClient.Close()
 	if len(args) != 0 {
 		path, err := lockPath(args[0])
 		if err != nil {
-			Exit("Unable to determine path: %v", err.Error())
+			return errorf("Unable to determine path: %v", err.Error())
 		}
 
 		err = lockClient.UnlockFile(path, unlockCmdFlags.Force)
 		if err != nil {
-			Exit("Unable to unlock: %v", err.Error())
+			return errorf("Unable to unlock: %v", err.Error())
 		}
 	} else if unlockCmdFlags.Id != "" {
 		err := lockClient.UnlockFileById(unlockCmdFlags.Id, unlockCmdFlags.Force)
 		if err != nil {
-			Exit("Unable to unlock %v: %v", unlockCmdFlags.Id, err.Error())
+			return errorf("Unable to unlock %v: %v", unlockCmdFlags.Id, err.Error())
 		}
 	} else {
 		Error("Usage: git lfs unlock (--id my-lock-id | <path>)")
@@ -57,9 +57,11 @@ func unlockCommand(cmd *cobra.Command, args []string) {
 		}{true}); err != nil {
 			Error(err.Error())
 		}
-		return
+		return nil
 	}
 	Print("'%s' was unlocked", args[0])
+
+	return nil
 }
 
 func init() {
@@ -13,34 +13,35 @@ import (
 
 // untrackCommand takes a list of paths as an argument, and removes each path from the
 // default attributes file (.gitattributes), if it exists.
-func untrackCommand(cmd *cobra.Command, args []string) {
+func untrackCommand(cmd *cobra.Command, args []string) error {
 	if config.LocalGitDir == "" {
 		Print("Not a git repository.")
-		os.Exit(128)
+		return codeErrorf(128, "")
 	}
 	if config.LocalWorkingDir == "" {
 		Print("This operation must be run in a work tree.")
-		os.Exit(128)
+		return codeErrorf(128, "")
 	}
 
 	lfs.InstallHooks(false)
 
 	if len(args) < 1 {
 		Print("git lfs untrack <path> [path]*")
-		return
+		return nil
 	}
 
 	data, err := ioutil.ReadFile(".gitattributes")
 	if err != nil {
-		return
+		return nil
 	}
 
 	attributes := strings.NewReader(string(data))
+	macros := lfs.LocalAttributeMacros()
 
 	attributesFile, err := os.Create(".gitattributes")
 	if err != nil {
 		Print("Error opening .gitattributes for writing")
-		return
+		return nil
 	}
 	defer attributesFile.Close()
 
@@ -50,18 +51,20 @@ func untrackCommand(cmd *cobra.Command, args []string) {
 	// if the path was meant to be untracked, omit it, and print a message instead.
 	for scanner.Scan() {
 		line := scanner.Text()
-		if !strings.Contains(line, "filter=lfs") {
+		path, attrs, ok := lfs.ParseAttributesLine(line)
+		if !ok || !macros.TracksWithLFS(attrs) {
 			attributesFile.WriteString(line + "\n")
 			continue
 		}
 
-		path := strings.Fields(line)[0]
 		if removePath(path, args) {
 			Print("Untracking %s", path)
 		} else {
 			attributesFile.WriteString(line + "\n")
 		}
 	}
+
+	return nil
 }
 
 func removePath(path string, args []string) bool {
@@ -2,6 +2,7 @@ package commands
 
 import (
 	"regexp"
+	"strings"
 
 	"github.com/git-lfs/git-lfs/git"
 	"github.com/git-lfs/git-lfs/lfs"
@@ -15,9 +16,13 @@ var (
 
 // updateCommand is used for updating parts of Git LFS that reside under
 // .git/lfs.
-func updateCommand(cmd *cobra.Command, args []string) {
-	requireGitVersion()
-	requireInRepo()
+func updateCommand(cmd *cobra.Command, args []string) error {
+	if err := requireGitVersion(); err != nil {
+		return err
+	}
+	if err := requireInRepo(); err != nil {
+		return err
+	}
 
 	lfsAccessRE := regexp.MustCompile(`\Alfs\.(.*)\.access\z`)
 	for key, value := range cfg.Git.All() {
@@ -38,7 +43,7 @@ func updateCommand(cmd *cobra.Command, args []string) {
 	}
 
 	if updateForce && updateManual {
-		Exit("You cannot use --force and --manual options together")
+		return errorf("You cannot use --force and --manual options together")
 	}
 
 	if updateManual {
@@ -46,12 +51,15 @@ func updateCommand(cmd *cobra.Command, args []string) {
 	} else {
 		if err := lfs.InstallHooks(updateForce); err != nil {
 			Error(err.Error())
-			Exit("To resolve this, either:\n  1: run `git lfs update --manual` for instructions on how to merge hooks.\n  2: run `git lfs update --force` to overwrite your hook.")
+			return errorf("To resolve this, either:\n  1: run `git lfs update --manual` for instructions on how to merge hooks.\n  2: run `git lfs update --force` to overwrite your hook.")
+		} else if types := lfs.InstallableHookTypes(); len(types) > 1 {
+			Print("Updated %s and %s hooks.", strings.Join(types[:len(types)-1], ", "), types[len(types)-1])
 		} else {
-			Print("Updated pre-push hook.")
+			Print("Updated %s hook.", types[0])
 		}
 	}
 
+	return nil
 }
 
 func init() {
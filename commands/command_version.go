@@ -9,12 +9,14 @@ var (
 	lovesComics bool
 )
 
-func versionCommand(cmd *cobra.Command, args []string) {
+func versionCommand(cmd *cobra.Command, args []string) error {
 	Print(httputil.UserAgent)
 
 	if lovesComics {
 		Print("Nothing may see Gah Lak Tus and survive!")
 	}
+
+	return nil
 }
 
 func init() {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -16,9 +17,12 @@ import (
 	"github.com/git-lfs/git-lfs/filepathfilter"
 	"github.com/git-lfs/git-lfs/git"
 	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/localstorage"
 	"github.com/git-lfs/git-lfs/progress"
 	"github.com/git-lfs/git-lfs/tools"
 	"github.com/git-lfs/git-lfs/tq"
+	"github.com/git-lfs/git-lfs/tr"
+	"github.com/rubyist/tracerx"
 )
 
 // Populate man pages
@@ -34,27 +38,91 @@ var (
 
 	includeArg string
 	excludeArg string
+
+	// jobsArg overrides lfs.concurrenttransfers for the commands which
+	// transfer objects, when given with --jobs.
+	jobsArg int
 )
 
 // TransferManifest builds a tq.Manifest from the commands package global
-// cfg var.
+// cfg var, transferring as many objects at once as --jobs gives, if given.
 func TransferManifest() *tq.Manifest {
-	return lfs.TransferManifest(cfg)
+	m := lfs.TransferManifest(cfg)
+	m.SetConcurrentTransfers(jobsArg)
+	return m
 }
 
 // newDownloadCheckQueue builds a checking queue, checks that objects are there but doesn't download
 func newDownloadCheckQueue(options ...tq.Option) *tq.TransferQueue {
-	return lfs.NewDownloadCheckQueue(cfg, options...)
+	allOptions := make([]tq.Option, 0, len(options)+1)
+	allOptions = append(allOptions, options...)
+	allOptions = append(allOptions, tq.DryRun(true))
+	return newDownloadQueue(allOptions...)
 }
 
 // newDownloadQueue builds a DownloadQueue, allowing concurrent downloads.
 func newDownloadQueue(options ...tq.Option) *tq.TransferQueue {
-	return lfs.NewDownloadQueue(cfg, options...)
+	return tq.NewTransferQueue(tq.Download, TransferManifest(), withCommandContext(options)...)
+}
+
+// recoverTempObjects moves the downloads which interrupted commands finished,
+// but didn't store, from the temporary directory into the object store, before
+// a command decides which objects it needs to download.
+func recoverTempObjects() {
+	recovered, deleted, err := localstorage.Objects().RecoverTempObjects(localstorage.TempDir)
+	if err != nil {
+		LoggedError(err, "Could not recover temporary files: %v", err)
+	}
+	tracerx.Printf("recovered %d object(s) and deleted %d invalid temporary file(s)", recovered, deleted)
 }
 
 // newUploadQueue builds an UploadQueue, allowing `workers` concurrent uploads.
 func newUploadQueue(options ...tq.Option) *tq.TransferQueue {
-	return lfs.NewUploadQueue(cfg, options...)
+	return tq.NewTransferQueue(tq.Upload, TransferManifest(), withCommandContext(options)...)
+}
+
+// withCommandContext returns the given queue options, preceded by one which
+// stops the queue once the command's context is done, unless they give a
+// context of their own.
+func withCommandContext(options []tq.Option) []tq.Option {
+	return append([]tq.Option{tq.WithContext(commandContext())}, options...)
+}
+
+// newGitScanner returns a *lfs.GitScanner with the given callback, whose scans
+// stop once the command's context is done.
+func newGitScanner(cb lfs.GitScannerCallback) *lfs.GitScanner {
+	return lfs.NewGitScannerContext(commandContext(), cb)
+}
+
+// transferJournalPath returns the path of the journal recording the contents
+// of the last transfer queue in the given direction.
+func transferJournalPath(dir tq.Direction) string {
+	return filepath.Join(config.LocalGitDir, "lfs", "journal", dir.String())
+}
+
+// pushQueuePath returns the path of the journal of objects queued to be pushed
+// to the given remote while offline.
+func pushQueuePath(remote string) string {
+	return filepath.Join(pushQueueDir(), url.QueryEscape(remote))
+}
+
+// pushQueueDir returns the directory holding the journals of objects queued to
+// be pushed while offline, one for each remote.
+func pushQueueDir() string {
+	return filepath.Join(config.LocalGitDir, "lfs", "queue")
+}
+
+// newTransferJournal returns an option which records the contents of a
+// transfer queue in the given direction, to or from the current remote, so
+// that it can be resumed by 'git lfs resume' if interrupted. The queue is not
+// journaled if the journal can't be created.
+func newTransferJournal(dir tq.Direction) tq.Option {
+	j, err := tq.CreateJournal(transferJournalPath(dir), dir, cfg.CurrentRemote)
+	if err != nil {
+		tracerx.Printf("unable to create %s journal: %s", dir, err)
+		return tq.WithJournal(nil)
+	}
+	return tq.WithJournal(j)
 }
 
 func buildFilepathFilter(config *config.Configuration, includeArg, excludeArg *string) *filepathfilter.Filter {
@@ -74,6 +142,21 @@ func uploadTransfer(oid, filename string) (*tq.Transfer, error) {
 		return nil, errors.Wrapf(err, "Error uploading file %s (%s)", filename, oid)
 	}
 
+	if !tools.FileExists(localMediaPath) {
+		size, ok := lfs.ChunkedObjectSize(oid)
+		if !ok {
+			size, ok = lfs.CompressedObjectSize(oid)
+		}
+		if ok {
+			return &tq.Transfer{
+				Name: filename,
+				Path: localMediaPath,
+				Oid:  oid,
+				Size: size,
+			}, nil
+		}
+	}
+
 	if len(filename) > 0 {
 		if err = ensureFile(filename, localMediaPath); err != nil {
 			return nil, err
@@ -133,48 +216,60 @@ func ensureFile(smudgePath, cleanPath string) error {
 // Error prints a formatted message to Stderr.  It also gets printed to the
 // panic log if one is created for this command.
 func Error(format string, args ...interface{}) {
-	if len(args) == 0 {
-		fmt.Fprintln(ErrorWriter, format)
+	printError(nil, format, args...)
+}
+
+// printError prints a formatted message for the given error, or for no error
+// in particular if err is nil, to Stderr, as a JSON object if --json-errors is
+// given.
+func printError(err error, format string, args ...interface{}) {
+	if jsonErrors {
+		printErrorRecord(newErrorRecord(err, untranslatedMessage(format, args)))
 		return
 	}
-	fmt.Fprintf(ErrorWriter, format+"\n", args...)
+	fmt.Fprintln(ErrorWriter, errorMessage(format, args))
 }
 
-// Print prints a formatted message to Stdout.  It also gets printed to the
-// panic log if one is created for this command.
+// Print prints a formatted message to Stdout, translated as errorMessage
+// translates it.  It also gets printed to the panic log if one is created for
+// this command.
 func Print(format string, args ...interface{}) {
-	if len(args) == 0 {
-		fmt.Fprintln(OutputWriter, format)
-		return
-	}
-	fmt.Fprintf(OutputWriter, format+"\n", args...)
+	fmt.Fprintln(OutputWriter, errorMessage(format, args))
 }
 
-// Exit prints a formatted message and exits.
-func Exit(format string, args ...interface{}) {
-	Error(format, args...)
-	os.Exit(2)
+// errorMessage returns the message which format gives with args, or format
+// itself if there are no args, translated into the user's locale if it has a
+// translation there.
+func errorMessage(format string, args []interface{}) string {
+	if len(args) == 0 {
+		return tr.Get(format)
+	}
+	return tr.Sprintf(format, args...)
 }
 
-// ExitWithError either panics with a full stack trace for fatal errors, or
-// simply prints the error message and exits immediately.
-func ExitWithError(err error) {
-	errorWith(err, Panic, Exit)
+// untranslatedMessage is errorMessage in English, as messages are printed with
+// --json-errors, so that tools which read them get the same message in every
+// locale.
+func untranslatedMessage(format string, args []interface{}) string {
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
 }
 
 // FullError prints either a full stack trace for fatal errors, or just the
 // error message.
 func FullError(err error) {
-	errorWith(err, LoggedError, Error)
+	errorWith(err, LoggedError, printError)
 }
 
-func errorWith(err error, fatalErrFn func(error, string, ...interface{}), errFn func(string, ...interface{})) {
+func errorWith(err error, fatalErrFn, errFn func(error, string, ...interface{})) {
 	if Debugging || errors.IsFatalError(err) {
 		fatalErrFn(err, "%s", err)
 		return
 	}
 
-	errFn("%s", err)
+	errFn(err, "%s", err)
 }
 
 // Debug prints a formatted message if debugging is enabled.  The formatted
@@ -193,6 +288,11 @@ func Debug(format string, args ...interface{}) {
 //
 // It also writes a stack trace for the error to a log file without exiting.
 func LoggedError(err error, format string, args ...interface{}) {
+	if jsonErrors {
+		loggedErrorRecord(err, format, args...)
+		return
+	}
+
 	if len(format) > 0 {
 		Error(format, args...)
 	}
@@ -203,14 +303,24 @@ func LoggedError(err error, format string, args ...interface{}) {
 	}
 }
 
-// Panic prints a formatted message, and writes a stack trace for the error to
-// a log file before exiting.
-func Panic(err error, format string, args ...interface{}) {
-	LoggedError(err, format, args...)
-	os.Exit(2)
+// loggedErrorRecord is LoggedError with --json-errors: it prints the message,
+// or the error's if there is none, as a JSON object, with a hint naming the
+// log file.
+func loggedErrorRecord(err error, format string, args ...interface{}) {
+	msg := untranslatedMessage(format, args)
+	if len(msg) == 0 && err != nil {
+		msg = err.Error()
+	}
+
+	r := newErrorRecord(err, msg)
+	if file := handlePanic(err); len(file) > 0 {
+		r.Hint = strings.TrimSpace(fmt.Sprintf("%s Errors logged to %s; use `git lfs logs last` to view the log.", r.Hint, file))
+	}
+	printErrorRecord(r)
 }
 
 func Cleanup() {
+	stopProfiling()
 	if err := lfs.ClearTempObjects(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error clearing old temp files: %s\n", err)
 	}
@@ -228,7 +338,9 @@ func PipeCommand(name string, args ...string) error {
 	return cmd.Run()
 }
 
-func requireStdin(msg string) {
+// requireStdin returns an error which exits with 1 after printing msg, unless
+// something is piped to Stdin.
+func requireStdin(msg string) error {
 	var out string
 
 	stat, err := os.Stdin.Stat()
@@ -239,16 +351,19 @@ func requireStdin(msg string) {
 	}
 
 	if len(out) > 0 {
-		Error(out)
-		os.Exit(1)
+		return codeErrorf(1, "%s", out)
 	}
+	return nil
 }
 
-func requireInRepo() {
+// requireInRepo returns an error which exits with 128 unless the current
+// directory is in a Git repository.
+func requireInRepo() error {
 	if !lfs.InRepo() {
 		Print("Not in a git repository.")
-		os.Exit(128)
+		return codeErrorf(128, "")
 	}
+	return nil
 }
 
 func handlePanic(err error) string {
@@ -339,11 +454,11 @@ func determineIncludeExcludePaths(config *config.Configuration, includeArg, excl
 	return
 }
 
-func buildProgressMeter(dryRun bool) *progress.ProgressMeter {
-	return progress.NewMeter(
+func buildProgressMeter(dryRun bool, options ...progress.MeterOption) *progress.ProgressMeter {
+	return progress.NewMeter(append([]progress.MeterOption{
 		progress.WithOSEnv(cfg.Os),
-		progress.DryRun(dryRun),
-	)
+		progress.DryRun(dryRun || isQuiet()),
+	}, options...)...)
 }
 
 // isCommandEnabled returns whether the environment variable GITLFS<CMD>ENABLED
@@ -357,16 +472,17 @@ func isCommandEnabled(cfg *config.Configuration, cmd string) bool {
 	return cfg.Os.Bool(fmt.Sprintf("GITLFS%sENABLED", strings.ToUpper(cmd)), false)
 }
 
-func requireGitVersion() {
+func requireGitVersion() error {
 	minimumGit := "1.8.2"
 
 	if !git.Config.IsGitVersionAtLeast(minimumGit) {
 		gitver, err := git.Config.Version()
 		if err != nil {
-			Exit("Error getting git version: %s", err)
+			return errorf("Error getting git version: %s", err)
 		}
-		Exit("git version >= %s is required for Git LFS, your version: %s", minimumGit, gitver)
+		return errorf("git version >= %s is required for Git LFS, your version: %s", minimumGit, gitver)
 	}
+	return nil
 }
 
 func init() {
@@ -1,10 +1,23 @@
 package commands
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/tq"
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -54,3 +67,280 @@ func TestCommandEnabledDisabledByDefault(t *testing.T) {
 
 	assert.False(t, isCommandEnabled(cfg, "locks"))
 }
+
+func TestTransferFailuresExitCodes(t *testing.T) {
+	var none transferFailures
+	none.addObject(nil)
+	assert.Equal(t, 0, none.exitCode())
+
+	var auth transferFailures
+	auth.addObject(&tq.TransferError{Oid: "a", Action: "download", StatusCode: 404, Err: errors.New("not found")})
+	auth.addObject(&tq.TransferError{Oid: "b", StatusCode: 401, Err: errors.New("unauthorized")})
+	assert.Equal(t, exitAuthFailure, auth.exitCode())
+
+	var network transferFailures
+	network.addObject(&tq.TransferError{Oid: "a", Err: errors.Wrap(&net.OpError{Op: "dial", Err: errors.New("refused")}, "http")})
+	assert.Equal(t, exitNetworkFailure, network.exitCode())
+
+	var missing transferFailures
+	missing.addObject(nil)
+	missing.addObject(&tq.TransferError{Oid: "a", Action: "download", StatusCode: 404, Err: errors.New("not found")})
+	assert.Equal(t, exitMissingObject, missing.exitCode())
+
+	var partial transferFailures
+	partial.addObject(nil)
+	partial.addObject(&tq.TransferError{Oid: "a", StatusCode: 500, Err: errors.New("server error")})
+	assert.Equal(t, exitPartialSuccess, partial.exitCode())
+
+	var failed transferFailures
+	failed.addObject(&tq.TransferError{Oid: "a", StatusCode: 500, Err: errors.New("server error")})
+	assert.Equal(t, exitError, failed.exitCode())
+}
+
+func TestCommandErrors(t *testing.T) {
+	assert.Equal(t, 0, handleCommandError(nil))
+	assert.Equal(t, pushNothingExitCode, handleCommandError(codeErrorf(pushNothingExitCode, "")))
+
+	err := errorf("Could not read %s journal: %s", "upload", "EOF")
+	assert.Equal(t, "Could not read upload journal: EOF", err.Error())
+	assert.Equal(t, exitError, err.(*exitCodeError).code)
+
+	cause := errors.New("object missing")
+	err = withExitCode(exitMissingObject, cause)
+	assert.Equal(t, "object missing", err.Error())
+	assert.Equal(t, cause, err.(*exitCodeError).Cause())
+
+	var none transferFailures
+	none.addObject(nil)
+	assert.Nil(t, none.err())
+
+	var missing transferFailures
+	missing.addObject(&tq.TransferError{Oid: "a", Action: "download", StatusCode: 404, Err: errors.New("not found")})
+	assert.Equal(t, exitMissingObject, handleCommandError(missing.err()))
+}
+
+func TestInterruptCommand(t *testing.T) {
+	plain := &cobra.Command{Use: "plain"}
+	finish := beginCommandContext(plain)
+	assert.False(t, Interrupt())
+	assert.Nil(t, commandContext().Err())
+	assert.Nil(t, finish(nil))
+
+	cmd := &cobra.Command{Use: "fetch"}
+	addTimeoutFlag(cmd)
+	failed := errorf("No default remote")
+	finish = beginCommandContext(cmd)
+	assert.Equal(t, failed, finish(failed))
+
+	finish = beginCommandContext(cmd)
+	assert.True(t, Interrupt())
+	assert.Equal(t, context.Canceled, commandContext().Err())
+
+	err := finish(codeErrorf(exitMissingObject, ""))
+	assert.Equal(t, exitInterrupted, err.(*exitCodeError).code)
+	assert.False(t, Interrupt())
+	assert.Nil(t, commandContext().Err())
+}
+
+func TestErrorRecords(t *testing.T) {
+	generic := newErrorRecord(nil, "Not a git repository")
+	assert.Equal(t, &errorRecord{Code: errorCodeGeneric, Message: "Not a git repository"}, generic)
+
+	missing := newErrorRecord(&tq.TransferError{Oid: "a", Action: "download", StatusCode: 404, Err: errors.New("not found")}, "not found")
+	assert.Equal(t, errorCodeMissingObject, missing.Code)
+	assert.Equal(t, "a", missing.Oid)
+	assert.NotEmpty(t, missing.Hint)
+
+	auth := newErrorRecord(&tq.TransferError{Oid: "b", StatusCode: 403, Err: errors.New("forbidden")}, "forbidden")
+	assert.Equal(t, errorCodeAuthFailure, auth.Code)
+	assert.Equal(t, "b", auth.Oid)
+
+	network := newErrorRecord(errors.Wrap(&net.OpError{Op: "dial", Err: errors.New("refused")}, "batch"), "batch: dial: refused")
+	assert.Equal(t, errorCodeNetwork, network.Code)
+	assert.Empty(t, network.Oid)
+}
+
+func TestReadObjectIDs(t *testing.T) {
+	oid := "4c48d2a6991c9895bcddcf027e1e4907280bcf21975492b1afbade396d6a3340"
+	pointers, err := readObjectIDs(strings.NewReader("# comment\n" + oid + "\n\n" + strings.ToUpper(oid) + " 123\n"))
+	assert.Nil(t, err)
+	if assert.Len(t, pointers, 2) {
+		assert.Equal(t, oid, pointers[0].Oid)
+		assert.Equal(t, int64(0), pointers[0].Size)
+		assert.Equal(t, oid, pointers[1].Oid)
+		assert.Equal(t, int64(123), pointers[1].Size)
+	}
+
+	_, err = readObjectIDs(strings.NewReader(oid + " big\n"))
+	assert.EqualError(t, err, `line 1: invalid size "big"`)
+
+	_, err = readObjectIDs(strings.NewReader("\nabc\n"))
+	assert.EqualError(t, err, `line 2: expected "<oid>[:<size>]", got "abc"`)
+}
+
+func TestParseObjectID(t *testing.T) {
+	oid := "4c48d2a6991c9895bcddcf027e1e4907280bcf21975492b1afbade396d6a3340"
+
+	p, err := parseObjectID(oid + ":42")
+	assert.Nil(t, err)
+	assert.Equal(t, oid, p.Oid)
+	assert.Equal(t, int64(42), p.Size)
+
+	p, err = parseObjectID(oid)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), p.Size)
+
+	_, err = parseObjectID(oid + ":0")
+	assert.EqualError(t, err, `invalid size "0"`)
+
+	_, err = parseObjectID(oid + ":1:2")
+	assert.NotNil(t, err)
+}
+
+func TestFetchRetriesRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fetch-retry")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "fetch-retry")
+	pointers := []*lfs.WrappedPointer{
+		{Name: "a.dat", Pointer: lfs.NewPointer(strings.Repeat("a", 64), 1, nil)},
+		{Name: "dir/b.dat", Pointer: lfs.NewPointer(strings.Repeat("b", 64), 2, nil)},
+		{Name: "c.dat", Pointer: lfs.NewPointer(strings.Repeat("a", 64), 1, nil)},
+	}
+	assert.Nil(t, writeFetchRetries(path, "upstream", pointers))
+
+	remote, read, err := readFetchRetries(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "upstream", remote)
+	if assert.Len(t, read, 3) {
+		for i, p := range pointers {
+			assert.Equal(t, p.Name, read[i].Name)
+			assert.Equal(t, p.Oid, read[i].Oid)
+			assert.Equal(t, p.Size, read[i].Size)
+		}
+	}
+
+	_, _, err = readFetchRetries(filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestVerbosity(t *testing.T) {
+	defer func() {
+		quietFlag = false
+		verboseCount = 0
+	}()
+
+	for _, c := range []struct {
+		quiet   bool
+		verbose int
+		level   int
+	}{
+		{false, 0, verbosityNormal},
+		{false, 1, verbosityVerbose},
+		{false, 2, verbosityTrace},
+		{false, 5, verbosityTrace},
+		{true, 0, verbosityQuiet},
+		{true, 2, verbosityQuiet},
+	} {
+		quietFlag = c.quiet
+		verboseCount = c.verbose
+		assert.Equal(t, c.level, verbosity(), "quiet=%v, verbose=%d", c.quiet, c.verbose)
+		assert.Equal(t, c.level == verbosityQuiet, isQuiet())
+		assert.Equal(t, c.level >= verbosityVerbose, isVerbose())
+	}
+}
+
+func TestDaemonAnswersEachRequest(t *testing.T) {
+	var out strings.Builder
+	in := strings.NewReader("not json\n" + `{"op":"bogus"}` + "\n")
+	new(lfsDaemon).serveConn(in, &out)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Contains(t, lines[0], `"error":"invalid request: `)
+		assert.Equal(t, `{"error":"unknown op \"bogus\""}`, lines[1])
+	}
+}
+
+func TestServeProfiles(t *testing.T) {
+	addr, err := serveProfiles("127.0.0.1:0")
+	require.Nil(t, err)
+
+	res, err := http.Get(fmt.Sprintf("http://%s/debug/pprof/heap?debug=1", addr))
+	require.Nil(t, err)
+	defer res.Body.Close()
+
+	by, err := ioutil.ReadAll(res.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, string(by), "heap profile")
+}
+
+func TestGroupUploadErrors(t *testing.T) {
+	var errs []error
+	for i := 0; i < 25; i++ {
+		errs = append(errs, &tq.TransferError{
+			Oid:        fmt.Sprintf("%064d", i),
+			Action:     "upload",
+			StatusCode: 500,
+			Host:       "storage.example.com",
+			Err:        fmt.Errorf("[%064d] server error", i),
+		})
+	}
+	for i := 0; i < 3; i++ {
+		errs = append(errs, errors.New("connection refused"))
+	}
+	errs = append(errs, &tq.TransferError{Action: "verify", Err: errors.New("not verified")})
+
+	groups, records := groupUploadErrors(errs)
+	assert.Len(t, records, len(errs))
+	if assert.Len(t, groups, 3) {
+		assert.Equal(t, "Failed to upload to storage.example.com (HTTP 500)", groups[0].Title)
+		assert.Equal(t, 25, groups[0].Count)
+		assert.Len(t, groups[0].Errors, uploadErrorsShown)
+
+		// identical errors are only shown once
+		assert.Equal(t, "Failed to upload", groups[1].Title)
+		assert.Equal(t, 3, groups[1].Count)
+		assert.Len(t, groups[1].Errors, 1)
+
+		assert.Equal(t, "Failed to verify", groups[2].Title)
+		assert.Equal(t, 1, groups[2].Count)
+	}
+}
+
+func TestFilenameSizeReport(t *testing.T) {
+	macros := lfs.NewAttributeMacroSet()
+	lines := []*lfs.AttributesLine{
+		{Source: ".gitattributes", LineNo: 1, Pattern: "*.dat", Attrs: []string{"filter=lfs"}},
+		{Source: ".gitattributes", LineNo: 2, Pattern: "*.psd", Attrs: []string{"filter=lfs"}},
+		{Source: "a/.gitattributes", LineNo: 1, Dir: "a", Pattern: "*.dat", Attrs: []string{"filter=lfs"}},
+		{Source: "a/.gitattributes", LineNo: 2, Dir: "a", Pattern: "small.iso", Attrs: []string{"-filter"}},
+	}
+	files := []*workingCopyFile{
+		{Name: "x.dat", Size: 10},
+		{Name: "b/y.dat", Size: 20},
+		{Name: "a/z.dat", Size: 40},
+		{Name: "big.iso", Size: 2000},
+		{Name: "a/small.iso", Size: 1000},
+		{Name: "bigger.iso", Size: 3000},
+		{Name: "README", Size: 5},
+	}
+
+	patterns, untracked := filenameSizeReport(files, lines, macros, false, 1000)
+
+	if assert.Len(t, patterns, 3) {
+		assert.Equal(t, 2, patterns[0].Files)
+		assert.EqualValues(t, 30, patterns[0].Bytes)
+		assert.Equal(t, 0, patterns[1].Files)
+		assert.Equal(t, 1, patterns[2].Files)
+		assert.EqualValues(t, 40, patterns[2].Bytes)
+	}
+
+	var names []string
+	for _, f := range untracked {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"bigger.iso", "big.iso", "a/small.iso"}, names)
+}
@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// timeoutArg is the --timeout of the commands which take one.
+	timeoutArg time.Duration
+
+	// commandCtx is done once the command being run is interrupted, or its
+	// --timeout has passed, if it takes one, and cancelCommand cancels it.
+	// The scans and transfers of commands stop once it's done.
+	commandCtx    context.Context = context.Background()
+	cancelCommand context.CancelFunc
+	commandCtxMu  sync.Mutex
+)
+
+// addTimeoutFlag gives the command a --timeout flag, after which it stops
+// scanning and transferring objects, and fails. Commands which take one stop
+// the same way when they're interrupted, rather than exiting at once.
+func addTimeoutFlag(cmd *cobra.Command) {
+	cmd.Flags().DurationVarP(&timeoutArg, "timeout", "", 0, "Stop transferring objects after the given duration, such as 10m.")
+}
+
+// commandContext returns the context which the command being run scans and
+// transfers objects with.
+func commandContext() context.Context {
+	commandCtxMu.Lock()
+	defer commandCtxMu.Unlock()
+
+	return commandCtx
+}
+
+// beginCommandContext sets up the context of the given command, if it takes
+// a --timeout, before it runs. The returned function is given the error the
+// command returned, once it has, and returns the error to exit with instead,
+// for a command which failed because it was interrupted or timed out.
+func beginCommandContext(cmd *cobra.Command) func(error) error {
+	if cmd.Flags().Lookup("timeout") == nil {
+		return func(err error) error { return err }
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeoutArg > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeoutArg)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	commandCtxMu.Lock()
+	commandCtx, cancelCommand = ctx, cancel
+	commandCtxMu.Unlock()
+
+	return func(err error) error {
+		commandCtxMu.Lock()
+		commandCtx, cancelCommand = context.Background(), nil
+		commandCtxMu.Unlock()
+		ctxErr := ctx.Err()
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+
+		switch ctxErr {
+		case context.Canceled:
+			printCommandError(err)
+			return codeErrorf(exitInterrupted, "Interrupted before finishing.")
+		case context.DeadlineExceeded:
+			printCommandError(err)
+			return errorf("Timed out after %s.", timeoutArg)
+		}
+		return err
+	}
+}
+
+// Interrupt cancels the context of the command being run, if it takes a
+// --timeout, so that it stops scanning and transferring objects and returns,
+// and returns whether it did. The process should exit at once otherwise.
+func Interrupt() bool {
+	commandCtxMu.Lock()
+	defer commandCtxMu.Unlock()
+
+	if cancelCommand == nil {
+		return false
+	}
+	cancelCommand()
+	return true
+}
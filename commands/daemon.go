@@ -0,0 +1,223 @@
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/lfs"
+)
+
+// maxDaemonRequest is the longest request line the daemon reads, to allow
+// prefetches of many paths at once.
+const maxDaemonRequest = 16 * 1024 * 1024
+
+// daemonRequest is a request to "git lfs daemon", sent as a line of JSON. Paths
+// are relative to the root of the working copy.
+type daemonRequest struct {
+	// Op is one of "materialize", "present" or "prefetch".
+	Op    string   `json:"op"`
+	Path  string   `json:"path,omitempty"`
+	Oid   string   `json:"oid,omitempty"`
+	Paths []string `json:"paths,omitempty"`
+}
+
+// daemonResponse is the answer to a daemonRequest, sent as a line of JSON.
+type daemonResponse struct {
+	// Result is what was done or found: for "materialize", one of the
+	// results of "git lfs checkout --stdin"; for "present", "present",
+	// "absent" or "untracked"; and for "prefetch", "queued".
+	Result string `json:"result,omitempty"`
+	Oid    string `json:"oid,omitempty"`
+	// Queued is how many objects a prefetch is downloading.
+	Queued int    `json:"queued,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// lfsDaemon answers the requests of editors and other tools on a socket, so
+// that they needn't start a Git LFS process for each.
+type lfsDaemon struct {
+	// checkoutMu makes files be materialized one at a time, since each
+	// updates the index.
+	checkoutMu sync.Mutex
+
+	// pointers holds the pointers of the tree of the commit treeSha, which
+	// is the current ref's when it was last scanned, by path.
+	treeMu   sync.Mutex
+	treeSha  string
+	pointers map[string]*lfs.WrappedPointer
+
+	// prefetches waits for the downloads started by prefetch requests.
+	prefetches sync.WaitGroup
+}
+
+// Serve answers the requests made on the connections accepted from l until it
+// is closed, then waits for the prefetches in progress to finish.
+func (d *lfsDaemon) Serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			break
+		}
+
+		go func() {
+			defer conn.Close()
+			d.serveConn(conn, conn)
+		}()
+	}
+
+	d.prefetches.Wait()
+}
+
+// serveConn answers each request read from r on w, until r ends.
+func (d *lfsDaemon) serveConn(r io.Reader, w io.Writer) {
+	requests := bufio.NewScanner(r)
+	requests.Buffer(make([]byte, 0, 64*1024), maxDaemonRequest)
+	responses := json.NewEncoder(w)
+
+	for requests.Scan() {
+		var req daemonRequest
+		var res *daemonResponse
+		if err := json.Unmarshal(requests.Bytes(), &req); err != nil {
+			res = &daemonResponse{Error: fmt.Sprintf("invalid request: %s", err)}
+		} else {
+			res = d.handle(&req)
+		}
+
+		if err := responses.Encode(res); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers a single request.
+func (d *lfsDaemon) handle(req *daemonRequest) *daemonResponse {
+	switch req.Op {
+	case "materialize":
+		return d.materialize(req.Path)
+	case "present":
+		return d.present(req.Path, req.Oid)
+	case "prefetch":
+		return d.prefetch(req.Paths)
+	}
+	return &daemonResponse{Error: fmt.Sprintf("unknown op %q", req.Op)}
+}
+
+// materialize checks out the file at the given path, downloading its object
+// if it isn't local.
+func (d *lfsDaemon) materialize(path string) *daemonResponse {
+	p, err := d.pointer(path)
+	if err != nil {
+		return &daemonResponse{Error: err.Error()}
+	} else if p == nil {
+		return &daemonResponse{Result: "untracked"}
+	}
+
+	d.checkoutMu.Lock()
+	defer d.checkoutMu.Unlock()
+
+	c, err := newSingleCheckout()
+	if err != nil {
+		return &daemonResponse{Error: err.Error()}
+	}
+	c.download = true
+	result := c.Run(p)
+	c.Close()
+
+	return &daemonResponse{Result: string(result), Oid: p.Oid}
+}
+
+// present returns whether the object with the given oid, or that of the file
+// at the given path, is stored locally.
+func (d *lfsDaemon) present(path, oid string) *daemonResponse {
+	if len(oid) == 0 {
+		p, err := d.pointer(path)
+		if err != nil {
+			return &daemonResponse{Error: err.Error()}
+		} else if p == nil {
+			return &daemonResponse{Result: "untracked"}
+		}
+		oid = p.Oid
+	}
+
+	if _, ok := lfs.LocalObjectSize(oid); ok {
+		return &daemonResponse{Result: "present", Oid: oid}
+	}
+	return &daemonResponse{Result: "absent", Oid: oid}
+}
+
+// prefetch starts downloading the objects of the files at the given paths
+// which aren't local, without waiting for them.
+func (d *lfsDaemon) prefetch(paths []string) *daemonResponse {
+	var missing []*lfs.WrappedPointer
+	for _, path := range paths {
+		p, err := d.pointer(path)
+		if err != nil {
+			return &daemonResponse{Error: err.Error()}
+		}
+		if p == nil {
+			continue
+		}
+		lfs.LinkOrCopyFromReference(p.Oid, p.Size)
+		if !lfs.ObjectExistsOfSize(p.Oid, p.Size) {
+			missing = append(missing, p)
+		}
+	}
+
+	if len(missing) > 0 {
+		q := newDownloadQueue()
+		for _, p := range missing {
+			q.Add(downloadTransfer(p))
+		}
+
+		d.prefetches.Add(1)
+		go func() {
+			defer d.prefetches.Done()
+			q.Wait()
+			for _, err := range q.Errors() {
+				Error("daemon: prefetch: %s", err)
+			}
+		}()
+	}
+
+	return &daemonResponse{Result: "queued", Queued: len(missing)}
+}
+
+// pointer returns the pointer of the file at the given path in the current
+// ref, or nil if it isn't a Git LFS file, scanning the ref's tree again if it
+// has changed since it was last scanned.
+func (d *lfsDaemon) pointer(path string) (*lfs.WrappedPointer, error) {
+	ref, err := git.CurrentRef()
+	if err != nil {
+		return nil, err
+	}
+
+	d.treeMu.Lock()
+	defer d.treeMu.Unlock()
+
+	if ref.Sha != d.treeSha {
+		pointers := make(map[string]*lfs.WrappedPointer)
+		gitscanner := newGitScanner(func(p *lfs.WrappedPointer, err error) {
+			if err != nil {
+				LoggedError(err, "Scanner error")
+				return
+			}
+			pointers[p.Name] = p
+		})
+		err := gitscanner.ScanTree(ref.Sha)
+		gitscanner.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		d.treeSha = ref.Sha
+		d.pointers = pointers
+	}
+
+	return d.pointers[filepath.ToSlash(filepath.Clean(path))], nil
+}
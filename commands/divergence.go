@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/git-lfs/git-lfs/filepathfilter"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/rubyist/tracerx"
+)
+
+// divergenceAdvice explains how the given file in the index or the working
+// tree differs from the form Git LFS keeps it in, and how to fix it.
+func divergenceAdvice(f *lfs.DivergentFile) string {
+	switch f.Divergence {
+	case lfs.DivergentContent:
+		return fmt.Sprintf("%s is tracked by Git LFS, but is staged as its contents rather than a pointer; run `git add --renormalize %s`, or `git lfs renormalize` for every such file", f.Name, f.Name)
+	case lfs.DivergentPointerFile:
+		return fmt.Sprintf("%s is a Git LFS pointer in the working tree rather than its contents; run `git lfs checkout %s`, after `git lfs fetch` if the object isn't local", f.Name, f.Name)
+	case lfs.DivergentUntrackedPointer:
+		return fmt.Sprintf("%s is a Git LFS pointer, but isn't tracked by Git LFS, so it's checked out as the pointer; track it with `git lfs track`, then run `git lfs checkout %s`", f.Name, f.Name)
+	}
+	return f.Name
+}
+
+// committedDivergenceAdvice explains how the given file in a commit differs
+// from the form Git LFS keeps it in, and how to fix it.
+func committedDivergenceAdvice(f *lfs.DivergentFile, ref string) string {
+	switch f.Divergence {
+	case lfs.DivergentContent:
+		return fmt.Sprintf("%s is tracked by Git LFS, but is committed as its contents in %s rather than a pointer; run `git lfs renormalize` and commit, or rewrite unpushed commits with `git lfs migrate import --fixup`", f.Name, ref)
+	case lfs.DivergentUntrackedPointer:
+		return fmt.Sprintf("%s is committed as a Git LFS pointer in %s, but isn't tracked by Git LFS, so it's checked out as the pointer; track it with `git lfs track`", f.Name, ref)
+	}
+	return f.Name
+}
+
+// warnDivergentIndexFiles warns about the files allowed by the filter which are
+// staged as their contents although they're tracked by Git LFS, or as pointers
+// although they aren't.
+func warnDivergentIndexFiles(filter *filepathfilter.Filter) {
+	files, err := lfs.DivergentIndexFiles(filter)
+	if err != nil {
+		tracerx.Printf("divergence: %s", err)
+		return
+	}
+
+	for _, f := range files {
+		if f.Divergence != lfs.DivergentPointerFile {
+			Error("Warning: %s", divergenceAdvice(f))
+		}
+	}
+}
+
+// warnDivergentPushedFiles warns about the files changed by the commits of the
+// given ref being pushed to the current remote which are committed as their
+// contents although they're tracked by Git LFS, or as pointers although they
+// aren't, so their objects aren't pushed as expected.
+func warnDivergentPushedFiles(name, sha string) {
+	files, err := lfs.DivergentPushedFiles(sha, cfg.CurrentRemote, nil)
+	if err != nil {
+		tracerx.Printf("divergence: %s", err)
+		return
+	}
+
+	for _, f := range files {
+		Error("Warning: %s", committedDivergenceAdvice(f, name))
+	}
+}
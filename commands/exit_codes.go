@@ -0,0 +1,266 @@
+package commands
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/tq"
+)
+
+// The exit codes of the commands which transfer or check out objects, so that
+// scripts can tell why they failed, as git-lfs(1) documents. Commands exit
+// with 1 when they're used wrongly, and with exitError when they fail for a
+// reason without a code of its own. 'git lfs push --exit-code' exits with 3
+// when there's nothing to push, and the commands which take a --timeout exit
+// with exitInterrupted when they're interrupted before finishing.
+const (
+	exitError          = 2
+	exitAuthFailure    = 4
+	exitNetworkFailure = 5
+	exitMissingObject  = 6
+	exitPartialSuccess = 7
+	exitInterrupted    = 130
+)
+
+// exitCodeError is an error which a command returns to exit with a code other
+// than exitError, or to print a message of its own rather than the error's.
+// The command's caller prints msg, or else err, if either is given, and exits
+// with code.
+type exitCodeError struct {
+	code int
+	msg  string
+	// untranslated is msg in English, as it's printed with --json-errors.
+	untranslated string
+	// err is the error which caused the command to fail, if any.
+	err error
+	// logged is whether a stack trace for err is written to a log file,
+	// as LoggedError does.
+	logged bool
+}
+
+// errorf returns an error which prints the formatted message when the command
+// returns it, and exits with exitError.
+func errorf(format string, args ...interface{}) error {
+	return codeErrorf(exitError, format, args...)
+}
+
+// codeErrorf returns an error which prints the formatted message when the
+// command returns it, and exits with code. Nothing is printed if format is
+// empty, as for a command which printed why it failed already.
+func codeErrorf(code int, format string, args ...interface{}) error {
+	return &exitCodeError{code: code, msg: errorMessage(format, args), untranslated: untranslatedMessage(format, args)}
+}
+
+// loggedErrorf returns an error which prints the formatted message and writes
+// a stack trace for err to a log file when the command returns it, as Panic
+// does, and exits with exitError.
+func loggedErrorf(err error, format string, args ...interface{}) error {
+	return &exitCodeError{code: exitError, msg: errorMessage(format, args), untranslated: untranslatedMessage(format, args), err: err, logged: true}
+}
+
+// withExitCode returns an error which prints err, as FullError does, when the
+// command returns it, and exits with code.
+func withExitCode(code int, err error) error {
+	return &exitCodeError{code: code, err: err}
+}
+
+func (e *exitCodeError) Error() string {
+	if len(e.msg) > 0 {
+		return e.msg
+	}
+	if e.err != nil {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// message returns the message to print for the error: msg, or untranslated
+// with --json-errors.
+func (e *exitCodeError) message() string {
+	if jsonErrors {
+		return e.untranslated
+	}
+	return e.msg
+}
+
+// Cause returns the error which caused the command to fail, if any.
+func (e *exitCodeError) Cause() error {
+	return e.err
+}
+
+// handleCommandError prints the error which a command returned, if any, and
+// returns the code to exit with.
+func handleCommandError(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	printCommandError(err)
+	if e, ok := err.(*exitCodeError); ok {
+		return e.code
+	}
+	return exitError
+}
+
+// printCommandError prints err as it would be if a command returned it, for
+// the commands which carry on after an error. Errors other than an
+// exitCodeError print a stack trace to a log file when fatal, as FullError
+// does.
+func printCommandError(err error) {
+	e, ok := err.(*exitCodeError)
+	switch {
+	case !ok:
+		FullError(err)
+	case e.logged:
+		LoggedError(e.err, "%s", e.message())
+	case len(e.msg) > 0:
+		printError(e.err, "%s", e.message())
+	case e.err != nil:
+		FullError(e.err)
+	}
+}
+
+// transferFailures collects the failures of the objects a command transfers or
+// checks out, to choose the code it exits with. It is safe to use from
+// multiple goroutines.
+type transferFailures struct {
+	mu sync.Mutex
+	// queued is the number of objects given to be transferred or checked
+	// out, whether or not they failed.
+	queued int
+	errs   []error
+	// objects is the number of errs which each concern a single object,
+	// rather than, say, a batch request for any number of them.
+	objects int
+}
+
+// addQueue records the errors of a queue which was given `queued` objects.
+func (f *transferFailures) addQueue(q *tq.TransferQueue, queued int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.queued += queued
+	for _, err := range q.Errors() {
+		f.errs = append(f.errs, err)
+		if _, ok := err.(*tq.TransferError); ok {
+			f.objects++
+		}
+	}
+}
+
+// addObject records that a single object was transferred or checked out, if
+// err is nil, or failed with err.
+func (f *transferFailures) addObject(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.queued++
+	if err != nil {
+		f.errs = append(f.errs, err)
+		f.objects++
+	}
+}
+
+// exitCode returns the code to exit with: 0 if nothing failed, and otherwise,
+// in this order:
+//
+//   - exitAuthFailure if the server rejected the credentials given for any
+//     object, or none were given;
+//   - exitNetworkFailure if the server couldn't be reached for any object;
+//   - exitMissingObject if every object which failed is one the server
+//     doesn't have, when downloading, or the local storage doesn't, when
+//     uploading;
+//   - exitPartialSuccess if only some of the objects failed;
+//   - exitError otherwise.
+func (f *transferFailures) exitCode() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.errs) == 0 {
+		return 0
+	}
+
+	missing := 0
+	for _, err := range f.errs {
+		if isAuthFailure(err) {
+			return exitAuthFailure
+		}
+		if isMissingObject(err) {
+			missing++
+		}
+	}
+	for _, err := range f.errs {
+		if isNetworkFailure(err) {
+			return exitNetworkFailure
+		}
+	}
+
+	switch {
+	case missing == len(f.errs):
+		return exitMissingObject
+	case f.objects == len(f.errs) && f.objects < f.queued:
+		return exitPartialSuccess
+	}
+	return exitError
+}
+
+// err returns an error which exits with the code exitCode returns, or nil if
+// it's 0. The failures are printed as they're collected, so it prints nothing.
+func (f *transferFailures) err() error {
+	if code := f.exitCode(); code != 0 {
+		return codeErrorf(code, "")
+	}
+	return nil
+}
+
+// isAuthFailure returns whether err is the server rejecting the credentials
+// given, or asking for some.
+func isAuthFailure(err error) bool {
+	if e, ok := err.(*tq.TransferError); ok && (e.StatusCode == 401 || e.StatusCode == 403) {
+		return true
+	}
+	return errors.IsAuthError(err)
+}
+
+// isNetworkFailure returns whether err, or any error it wraps, is a failure to
+// reach the server, such as a refused connection or a timeout.
+func isNetworkFailure(err error) bool {
+	return anyCause(err, func(err error) bool {
+		_, ok := err.(net.Error)
+		return ok
+	})
+}
+
+// isMissingObject returns whether err is a failure to transfer an object
+// because the server doesn't have it, when downloading, or the local storage
+// doesn't, when uploading.
+func isMissingObject(err error) bool {
+	if e, ok := err.(*tq.TransferError); ok && e.Action == "download" && (e.StatusCode == 404 || e.StatusCode == 410) {
+		return true
+	}
+	if errors.IsCleanPointerError(err) {
+		return true
+	}
+	return anyCause(err, os.IsNotExist)
+}
+
+// anyCause returns whether fn is true of err or any error it wraps.
+func anyCause(err error, fn func(error) bool) bool {
+	for err != nil {
+		if fn(err) {
+			return true
+		}
+
+		c, ok := err.(interface {
+			Cause() error
+		})
+		if !ok {
+			return false
+		}
+		err = c.Cause()
+	}
+	return false
+}
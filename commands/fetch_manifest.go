@@ -0,0 +1,247 @@
+package commands
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/tq"
+	"github.com/rubyist/tracerx"
+)
+
+// fetchManifestEntry describes an object which is present locally after a
+// fetch, at one of the paths which reference it, in the file written by
+// "git lfs fetch --output-manifest".
+type fetchManifestEntry struct {
+	Oid  string `json:"oid"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Mtime is the modification time of the file at Path in the working
+	// tree, if it holds the object's contents as checked out by Git LFS.
+	Mtime *time.Time `json:"mtime,omitempty"`
+}
+
+type fetchManifestEntries []*fetchManifestEntry
+
+func (e fetchManifestEntries) Len() int      { return len(e) }
+func (e fetchManifestEntries) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e fetchManifestEntries) Less(i, j int) bool {
+	if e[i].Path != e[j].Path {
+		return e[i].Path < e[j].Path
+	}
+	return e[i].Oid < e[j].Oid
+}
+
+// fetchManifest collects the pointers which were fetched, so that they can be
+// written to a manifest once fetching is done.
+type fetchManifest struct {
+	pointers []*lfs.WrappedPointer
+}
+
+// Add adds the given pointers to the manifest.
+func (m *fetchManifest) Add(pointers []*lfs.WrappedPointer) {
+	m.pointers = append(m.pointers, pointers...)
+}
+
+// Write writes the manifest to the file at path, as a JSON array of the
+// objects which are present locally, sorted by path.
+func (m *fetchManifest) Write(path string) error {
+	// A file holds an object's contents if its pointer is what's staged,
+	// and it hasn't been changed since.
+	staged, err := git.IndexBlobs()
+	if err != nil {
+		return err
+	}
+	changes, err := git.WorkingCopyChanges()
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(m.pointers))
+	entries := make(fetchManifestEntries, 0, len(m.pointers))
+	for _, p := range m.pointers {
+		key := p.Name + "\x00" + p.Oid
+		if seen[key] || !lfs.ObjectExistsOfSize(p.Oid, p.Size) {
+			continue
+		}
+		seen[key] = true
+
+		entry := &fetchManifestEntry{Oid: p.Oid, Path: p.Name, Size: p.Size}
+		if status, changed := changes[p.Name]; len(p.Sha1) > 0 && staged[p.Name] == p.Sha1 && (!changed || status[1] == ' ') {
+			// the file may still be an unsmudged pointer
+			if fi, err := os.Stat(filepath.Join(config.LocalWorkingDir, p.Name)); err == nil && fi.Mode().IsRegular() && fi.Size() == p.Size {
+				mtime := fi.ModTime()
+				entry.Mtime = &mtime
+			}
+		}
+		entries = append(entries, entry)
+	}
+	sort.Sort(entries)
+
+	by, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, append(by, '\n'), 0644); err != nil {
+		return errors.Wrap(err, "write manifest")
+	}
+	return nil
+}
+
+// fetchURLEntry describes where an object can be downloaded from, as the
+// server gave it, in the manifest written by "git lfs fetch --urls-only".
+type fetchURLEntry struct {
+	Oid   string   `json:"oid"`
+	Size  int64    `json:"size"`
+	Paths []string `json:"paths"`
+	Href  string   `json:"href"`
+	// Header holds the headers the server asked for the download to be
+	// made with, which may include credentials.
+	Header    map[string]string `json:"header,omitempty"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+}
+
+type fetchURLEntries []*fetchURLEntry
+
+func (e fetchURLEntries) Len() int           { return len(e) }
+func (e fetchURLEntries) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e fetchURLEntries) Less(i, j int) bool { return e[i].Oid < e[j].Oid }
+
+// fetchURLManifest collects the download URLs the server gives for the
+// objects which would be fetched, without downloading them, so that other
+// download managers can.
+type fetchURLManifest struct {
+	// entries holds the objects the server gave URLs for, keyed by oid.
+	entries map[string]*fetchURLEntry
+	// paths holds the paths referencing each object, keyed by oid.
+	paths map[string][]string
+}
+
+func newFetchURLManifest() *fetchURLManifest {
+	return &fetchURLManifest{
+		entries: make(map[string]*fetchURLEntry),
+		paths:   make(map[string][]string),
+	}
+}
+
+// Resolve asks the server for the download URLs of the given pointers' objects
+// which it hasn't given yet, whether they're present locally or not. It
+// returns whether every object's URL was given.
+func (m *fetchURLManifest) Resolve(pointers []*lfs.WrappedPointer) bool {
+	q := newDownloadCheckQueue(tq.WithProgress(buildProgressMeter(true)))
+
+	watch := q.WatchTransfers()
+	resolved := make(map[string]*fetchURLEntry)
+	done := make(chan struct{})
+	go func() {
+		for t := range watch {
+			action, err := t.Actions.Get("download")
+			if err != nil {
+				continue
+			}
+
+			entry := &fetchURLEntry{Oid: t.Oid, Size: t.Size, Href: action.Href, Header: action.Header}
+			if !action.ExpiresAt.IsZero() {
+				expiresAt := action.ExpiresAt
+				entry.ExpiresAt = &expiresAt
+			}
+			resolved[t.Oid] = entry
+		}
+		close(done)
+	}()
+
+	queued := make(map[string]bool, len(pointers))
+	for _, p := range pointers {
+		m.paths[p.Oid] = append(m.paths[p.Oid], p.Name)
+		if _, ok := m.entries[p.Oid]; ok || queued[p.Oid] {
+			continue
+		}
+
+		queued[p.Oid] = true
+		tracerx.Printf("fetch: resolving the URL of %v [%v]", p.Name, p.Oid)
+		q.Add(downloadTransfer(p))
+	}
+
+	q.Wait()
+	<-done
+	for oid, entry := range resolved {
+		m.entries[oid] = entry
+	}
+
+	ok := true
+	for _, err := range q.Errors() {
+		ok = false
+		FullError(err)
+	}
+	for oid := range queued {
+		if _, found := m.entries[oid]; !found && ok {
+			Error("No download URL for %s", oid)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// Write writes the manifest to the file at path, or to stdout if path is
+// empty, as a JSON array of the objects' URLs, sorted by oid. As the headers
+// of the URLs may include credentials, only the user may read the file.
+func (m *fetchURLManifest) Write(path string) error {
+	entries := make(fetchURLEntries, 0, len(m.entries))
+	for oid, entry := range m.entries {
+		entry.Paths = uniqueSortedStrings(m.paths[oid])
+		entries = append(entries, entry)
+	}
+	sort.Sort(entries)
+
+	by, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	by = append(by, '\n')
+
+	if len(path) == 0 {
+		_, err = os.Stdout.Write(by)
+		return err
+	}
+	if err := writePrivateFile(path, by); err != nil {
+		return errors.Wrap(err, "write manifest")
+	}
+	return nil
+}
+
+// writePrivateFile writes by to the file at path, which only the user may read
+// or write, even if it already existed with a more permissive mode.
+func writePrivateFile(path string, by []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err = f.Chmod(0600); err == nil {
+		_, err = f.Write(by)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func uniqueSortedStrings(strs []string) []string {
+	seen := make(map[string]bool, len(strs))
+	unique := make([]string, 0, len(strs))
+	for _, s := range strs {
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, s)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
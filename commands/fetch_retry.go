@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/tq"
+)
+
+// fetchRetryPath returns the path of the retry file, which lists the objects
+// the last fetch or pull with failures could not download, for 'git lfs fetch
+// --retry-failed' to download them without scanning the refs again.
+func fetchRetryPath() string {
+	return filepath.Join(config.LocalGitDir, "lfs", "fetch-retry")
+}
+
+// fetchRetries collects the pointers whose objects failed to download, to be
+// written to the retry file. It is safe to use from multiple goroutines.
+type fetchRetries struct {
+	mu       sync.Mutex
+	pointers []*lfs.WrappedPointer
+}
+
+// AddMissing adds those of the given pointers whose objects aren't present
+// locally.
+func (r *fetchRetries) AddMissing(pointers []*lfs.WrappedPointer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range pointers {
+		if !lfs.ObjectExistsOfSize(p.Oid, p.Size) {
+			r.pointers = append(r.pointers, p)
+		}
+	}
+}
+
+// Len returns the number of objects which failed to download.
+func (r *fetchRetries) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[string]bool, len(r.pointers))
+	for _, p := range r.pointers {
+		seen[p.Oid] = true
+	}
+	return len(seen)
+}
+
+// Write replaces the retry file at path with one listing the pointers which
+// failed, to be downloaded from the given remote, and prints how to retry
+// them. If none failed, it removes any retry file left by an earlier fetch.
+func (r *fetchRetries) Write(path, remote string) error {
+	r.mu.Lock()
+	pointers := r.pointers
+	r.mu.Unlock()
+
+	if len(pointers) == 0 {
+		return removeFetchRetries(path)
+	}
+	if err := writeFetchRetries(path, remote, pointers); err != nil {
+		return err
+	}
+	Error("Run 'git lfs fetch --retry-failed' to retry the %d object(s) which failed to download", r.Len())
+	return nil
+}
+
+// writeFetchRetries writes a retry file at path listing the given pointers, to
+// be downloaded from the given remote. The file is written as a download
+// journal in which every object is pending, one line of JSON per object.
+func writeFetchRetries(path, remote string, pointers []*lfs.WrappedPointer) error {
+	// the retry file only lists the objects which failed in the last
+	// fetch, so it is replaced rather than appended to.
+	if err := removeFetchRetries(path); err != nil {
+		return err
+	}
+
+	j, err := tq.CreateJournal(path, tq.Download, remote)
+	if err != nil {
+		return err
+	}
+	for _, p := range pointers {
+		j.Add(p.Name, "", p.Oid, p.Size)
+	}
+	return j.Close()
+}
+
+// removeFetchRetries removes the retry file at path, if there is one.
+func removeFetchRetries(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// readFetchRetries reads the retry file at path, returning the remote and the
+// pointers it lists. It returns an error satisfying os.IsNotExist if there is
+// no retry file.
+func readFetchRetries(path string) (string, []*lfs.WrappedPointer, error) {
+	state, err := tq.ReadJournal(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	pending := state.Pending()
+	pointers := make([]*lfs.WrappedPointer, 0, len(pending))
+	for _, e := range pending {
+		pointers = append(pointers, &lfs.WrappedPointer{
+			Name:    e.Name,
+			Pointer: lfs.NewPointer(e.Oid, e.Size, nil),
+		})
+	}
+	return state.Remote, pointers, nil
+}
+
+// fetchRetryFailed downloads the objects listed in the retry file, from the
+// current remote, or the one they failed to download from if none is given.
+// It returns whether they were all downloaded; those which weren't are
+// collected in fetchFailedPointers, to rewrite the retry file with.
+func fetchRetryFailed() (bool, error) {
+	path := fetchRetryPath()
+	remote, pointers, err := readFetchRetries(path)
+	if os.IsNotExist(err) {
+		Print("No failed objects to retry")
+		return true, nil
+	} else if err != nil {
+		return false, errorf("Could not read the retry file %s: %s", path, err)
+	}
+
+	if len(cfg.CurrentRemote) == 0 {
+		cfg.CurrentRemote = remote
+	}
+
+	Print("Retrying the objects which failed to download")
+	ok, err := fetchAndReportToChan(pointers, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
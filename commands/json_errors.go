@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/git-lfs/git-lfs/tq"
+)
+
+// The codes of the error objects printed with --json-errors, telling why a
+// command failed as its exit code does.
+const (
+	errorCodeGeneric       = "error"
+	errorCodeAuthFailure   = "auth_failure"
+	errorCodeNetwork       = "network_failure"
+	errorCodeMissingObject = "missing_object"
+)
+
+// jsonErrors is set by the global --json-errors flag, to print errors as JSON
+// objects, one per line, rather than as text, for tools which run Git LFS.
+var jsonErrors bool
+
+// errorRecord is an error printed with --json-errors.
+type errorRecord struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Oid     string `json:"oid,omitempty"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// newErrorRecord returns the record of the given message, printed for err, or
+// for no error in particular if err is nil.
+func newErrorRecord(err error, message string) *errorRecord {
+	r := &errorRecord{Code: errorCodeGeneric, Message: message}
+	if err == nil {
+		return r
+	}
+
+	if e, ok := err.(*tq.TransferError); ok {
+		r.Oid = e.Oid
+	}
+
+	switch {
+	case isAuthFailure(err):
+		r.Code = errorCodeAuthFailure
+		r.Hint = "Check the credentials for the Git LFS server, or run `git credential reject` to be asked for them again."
+	case isNetworkFailure(err):
+		r.Code = errorCodeNetwork
+		r.Hint = "Check that the Git LFS server can be reached, then try again."
+	case isMissingObject(err):
+		r.Code = errorCodeMissingObject
+		r.Hint = "Push the object from a clone which has it, then try again."
+	}
+	return r
+}
+
+// printErrorRecord prints the given record as a line of JSON to ErrorWriter.
+func printErrorRecord(r *errorRecord) {
+	data, _ := json.Marshal(r)
+	fmt.Fprintln(ErrorWriter, string(data))
+}
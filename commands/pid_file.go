@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/tools"
+)
+
+// pidFile is a file recording the pid of a process which runs in the
+// background, such as 'git lfs prefetch --watch'. The process holds a lock on
+// it for as long as it runs, so that whether it's still running is told by the
+// lock, rather than by whether some process has its pid, which may have been
+// reused since.
+type pidFile struct {
+	path string
+	f    *os.File
+}
+
+// lockPidFile locks the pid file at path and records the current process in
+// it. If another process holds the lock, it returns nil and that process's pid
+// instead.
+func lockPidFile(path string) (*pidFile, int, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	locked, err := tools.LockFile(f, true, false)
+	if err != nil || !locked {
+		f.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+		pid, _ := readPid(path)
+		return nil, pid, nil
+	}
+
+	// the file may have been removed by the process which held it just
+	// before it was locked, leaving this process the only one to see it.
+	if !tools.SameFile(path, f) {
+		f.Close()
+		return lockPidFile(path)
+	}
+
+	if err := f.Truncate(0); err == nil {
+		_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+	}
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return &pidFile{path: path, f: f}, 0, nil
+}
+
+// Close removes the pid file and releases its lock.
+func (p *pidFile) Close() error {
+	return tools.CloseAndRemove(p.f, p.path)
+}
+
+// runningPid returns the pid recorded in the pid file at path, and whether the
+// process which recorded it still holds its lock.
+func runningPid(path string) (int, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	if locked, err := tools.LockFile(f, true, false); err != nil || locked {
+		return 0, false
+	}
+	return readPid(path)
+}
+
+// readPid returns the pid recorded in the pid file at path, if it has one.
+func readPid(path string) (int, bool) {
+	by, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(by)))
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	return pid, true
+}
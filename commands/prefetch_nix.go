@@ -0,0 +1,24 @@
+// +build !windows
+
+package commands
+
+import (
+	"os"
+	"syscall"
+)
+
+// daemonSysProcAttr starts the background prefetch process in a session of its
+// own, so that it is not stopped when the terminal which started it closes.
+func daemonSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// terminateProcess asks the process with the given pid to stop with SIGTERM,
+// so that it cleans up after itself.
+func terminateProcess(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,26 @@
+// +build windows
+
+package commands
+
+import (
+	"os"
+	"syscall"
+)
+
+// daemonSysProcAttr starts the background prefetch process hidden, and in a
+// process group of its own, so that it is not stopped by Ctrl+C in the console
+// which started it.
+func daemonSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{HideWindow: true, CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// terminateProcess stops the process with the given pid. Windows has no
+// SIGTERM, so it's killed, and its pid file is left behind unlocked.
+func terminateProcess(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	defer p.Release()
+	return p.Kill()
+}
@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	httppprof "net/http/pprof"
+	"os"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// profileFlag is the file the global --profile flag writes a profile
+	// of the command to.
+	profileFlag string
+
+	// stopProfile finishes writing the profile being written, if any.
+	stopProfile func()
+	profileMu   sync.Mutex
+)
+
+// startProfiling begins writing the profile --profile asks for before any
+// command runs: an execution trace, for "go tool trace", if the file ends in
+// ".trace", and otherwise a CPU profile, for "go tool pprof". It returns an
+// error, for Run to handle instead of running the command, if it can't.
+func startProfiling(cmd *cobra.Command) error {
+	if len(profileFlag) == 0 {
+		return nil
+	}
+
+	f, err := os.Create(profileFlag)
+	if err != nil {
+		return errorf("Could not write the profile: %s", err)
+	}
+
+	if strings.HasSuffix(profileFlag, ".trace") {
+		err = trace.Start(f)
+	} else {
+		err = pprof.StartCPUProfile(f)
+	}
+	if err != nil {
+		f.Close()
+		return errorf("Could not profile %q: %s", cmd.Name(), err)
+	}
+
+	profileMu.Lock()
+	stopProfile = func() {
+		if strings.HasSuffix(profileFlag, ".trace") {
+			trace.Stop()
+		} else {
+			pprof.StopCPUProfile()
+		}
+		f.Close()
+	}
+	profileMu.Unlock()
+	return nil
+}
+
+// stopProfiling finishes the profile --profile asked for, if it's being
+// written. It's called when the command finishes, whether it failed or not,
+// so that the profile covers failed commands too.
+func stopProfiling() {
+	profileMu.Lock()
+	defer profileMu.Unlock()
+
+	if stopProfile != nil {
+		stopProfile()
+		stopProfile = nil
+	}
+}
+
+// startProfileServer serves the net/http/pprof handlers on the local port
+// GIT_LFS_PROFILE_PORT gives, if it's set, so that the heap and goroutines of
+// long commands, such as "git lfs migrate" or "git lfs push --all", can be
+// inspected while they run. A port of 0 picks a free one. The address served
+// on is printed to stderr, and the command runs all the same if it can't be
+// served on.
+func startProfileServer() {
+	port, ok := cfg.Os.Get("GIT_LFS_PROFILE_PORT")
+	if !ok || len(port) == 0 {
+		return
+	}
+
+	addr, err := serveProfiles(net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not serve profiles on port %s: %s\n", port, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Serving profiles on http://%s/debug/pprof/\n", addr)
+}
+
+// serveProfiles serves the net/http/pprof handlers on the given address in the
+// background, returning the address they're served on.
+func serveProfiles(addr string) (net.Addr, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", httppprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", httppprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", httppprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", httppprof.Trace)
+
+	go http.Serve(l, mux)
+	return l.Addr(), nil
+}
@@ -7,77 +7,190 @@ import (
 	"os"
 	"os/exec"
 	"sync"
+	"time"
 
+	"github.com/git-lfs/git-lfs/config"
 	"github.com/git-lfs/git-lfs/errors"
 	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/tools"
 	"github.com/git-lfs/git-lfs/tq"
 )
 
+// checkoutResult is what checking out a single file did, as reported by
+// "git lfs checkout --stdin".
+type checkoutResult string
+
+const (
+	// checkoutDone means the file's contents were written.
+	checkoutDone checkoutResult = "ok"
+	// checkoutSkipped means the file was left alone, because it isn't
+	// the pointer: it was already checked out, or has been modified.
+	checkoutSkipped checkoutResult = "skipped"
+	// checkoutNotLocal means the file was left a pointer, because its
+	// object hasn't been fetched.
+	checkoutNotLocal checkoutResult = "missing"
+	// checkoutFailed means the file couldn't be checked out.
+	checkoutFailed checkoutResult = "error"
+)
+
 // Handles the process of checking out a single file, and updating the git
 // index.
-func newSingleCheckout() *singleCheckout {
+func newSingleCheckout() (*singleCheckout, error) {
 	// Get a converter from repo-relative to cwd-relative
 	// Since writing data & calling git update-index must be relative to cwd
 	pathConverter, err := lfs.NewRepoToCurrentPathConverter()
 	if err != nil {
-		Panic(err, "Could not convert file paths")
+		return nil, loggedErrorf(err, "Could not convert file paths")
 	}
 
 	return &singleCheckout{
 		gitIndexer:    &gitIndexer{},
 		pathConverter: pathConverter,
 		manifest:      TransferManifest(),
-	}
+		attributes:    lfs.LocalAttributeMatcher(),
+		mode:          cfg.CheckoutMode(),
+		missing:       cfg.MissingObjectPolicy(),
+	}, nil
 }
 
 type singleCheckout struct {
 	gitIndexer    *gitIndexer
 	pathConverter lfs.PathConverter
 	manifest      *tq.Manifest
+	// attributes tell which files are tracked by Git LFS, to warn that
+	// Git won't run the clean filter to turn the contents of the others
+	// back into their pointers.
+	attributes *lfs.AttributeMatcher
+	// mode is how files are written to the working tree, as given by
+	// lfs.checkoutmode.
+	mode string
+	// download is whether objects which aren't local are downloaded,
+	// rather than their files left as pointers.
+	download bool
+	// missing is what's done with the files of objects which couldn't be
+	// downloaded, as given by lfs.missingobjectpolicy.
+	missing string
+	// failures collects the files which couldn't be checked out.
+	failures transferFailures
+
+	// timeMu guards files and elapsed, the number of files Run has been
+	// given and the time it has spent on them, for GIT_TRACE_PERFORMANCE.
+	timeMu  sync.Mutex
+	files   int
+	elapsed time.Duration
 }
 
-func (c *singleCheckout) Run(p *lfs.WrappedPointer) {
+// Run checks out the file of the given pointer, returning what it did.
+func (c *singleCheckout) Run(p *lfs.WrappedPointer) checkoutResult {
+	defer c.timeCheckout(time.Now())
+
 	// Check the content - either missing or still this pointer (not exist is ok)
 	filepointer, err := lfs.DecodePointerFromFile(p.Name)
 	if err != nil && !os.IsNotExist(err) {
 		if errors.IsNotAPointerError(err) {
 			// File has non-pointer content, leave it alone
-			return
+			return checkoutSkipped
 		}
 
 		LoggedError(err, "Checkout error: %s", err)
-		return
+		c.failures.addObject(err)
+		return checkoutFailed
 	}
 
 	if filepointer != nil && filepointer.Oid != p.Oid {
 		// User has probably manually reset a file to another commit
 		// while leaving it a pointer; don't mess with this
-		return
+		return checkoutSkipped
+	}
+
+	if !c.attributes.TracksWithLFS(p.Name) {
+		Error("Warning: %s is a Git LFS pointer, but isn't tracked by Git LFS, so Git will see its contents as a change; track it with `git lfs track`", p.Name)
 	}
 
 	cwdfilepath := c.pathConverter.Convert(p.Name)
 
-	err = lfs.PointerSmudgeToFile(cwdfilepath, p.Pointer, false, c.manifest, nil)
+	linked, err := lfs.PointerLinkToFile(cwdfilepath, p.Pointer, p.Mode == "100755", c.mode)
+	if err != nil {
+		FullError(fmt.Errorf("Could not check out %q: %v", p.Name, err))
+		c.failures.addObject(err)
+		return checkoutFailed
+	}
+
+	if !linked {
+		err = lfs.PointerSmudgeToFile(cwdfilepath, p.Pointer, c.download, c.manifest, nil)
+	}
 	if err != nil {
 		if errors.IsDownloadDeclinedError(err) {
 			// acceptable error, data not local (fetch not run or include/exclude)
 			LoggedError(err, "Skipped checkout for %q, content not local. Use fetch to download.", p.Name)
-		} else {
-			FullError(fmt.Errorf("Could not check out %q", p.Name))
+			return checkoutNotLocal
 		}
-		return
+
+		FullError(fmt.Errorf("Could not check out %q: %v", p.Name, err))
+		c.leaveMissing(cwdfilepath, p.Pointer)
+		c.failures.addObject(err)
+		return checkoutFailed
+	}
+
+	if stat, err := os.Stat(cwdfilepath); err == nil && len(p.Extensions) == 0 {
+		recordWorktreeChecksum(p.Name, stat, p.Oid)
 	}
 
 	// errors are only returned when the gitIndexer is starting a new cmd
 	if err := c.gitIndexer.Add(cwdfilepath); err != nil {
-		Panic(err, "Could not update the index")
+		LoggedError(err, "Could not update the index")
+		c.failures.addObject(err)
+		return checkoutFailed
+	}
+	c.failures.addObject(nil)
+	return checkoutDone
+}
+
+// leaveMissing leaves the file at path, whose object couldn't be downloaded,
+// as lfs.missingobjectpolicy says: a pointer, as PointerSmudgeToFile left it,
+// or a placeholder marked as one. Either way, the checkout still fails.
+func (c *singleCheckout) leaveMissing(path string, ptr *lfs.Pointer) {
+	if c.missing != config.MissingObjectPlaceholder {
+		return
+	}
+
+	if err := lfs.PointerPlaceholderToFile(path, ptr); err != nil {
+		FullError(fmt.Errorf("Could not write a placeholder for %q: %v", path, err))
 	}
 }
 
+// LeaveMissing leaves the files of the given pointers, whose objects couldn't
+// be downloaded, as lfs.missingobjectpolicy says. Files which have been
+// changed from their pointers are left alone.
+func (c *singleCheckout) LeaveMissing(pointers []*lfs.WrappedPointer) {
+	for _, p := range pointers {
+		filepointer, err := lfs.DecodePointerFromFile(p.Name)
+		if err != nil || filepointer.Oid != p.Oid {
+			continue
+		}
+		c.leaveMissing(c.pathConverter.Convert(p.Name), p.Pointer)
+	}
+}
+
+// timeCheckout counts a file whose checkout began at started and has just
+// finished.
+func (c *singleCheckout) timeCheckout(started time.Time) {
+	c.timeMu.Lock()
+	c.files++
+	c.elapsed += time.Since(started)
+	c.timeMu.Unlock()
+}
+
 func (c *singleCheckout) Close() {
 	if err := c.gitIndexer.Close(); err != nil {
 		LoggedError(err, "Error updating the git index:\n%s", c.gitIndexer.Output())
 	}
+
+	c.timeMu.Lock()
+	if c.files > 0 {
+		tools.TracePerformance(c.elapsed, "checkout: %d file(s)", c.files)
+	}
+	c.timeMu.Unlock()
 }
 
 // Don't fire up the update-index command until we have at least one file to
@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/git-lfs/git-lfs/tq"
+)
+
+// pushQueuedObjects uploads the objects queued to be pushed to the remote
+// given in args, or to every remote if none is, or starts doing so in the
+// background with --background.
+func pushQueuedObjects(args []string) error {
+	if err := requireInRepo(); err != nil {
+		return err
+	}
+
+	var remote string
+	if len(args) > 0 {
+		remote = args[0]
+		if err := git.ValidateRemote(remote); err != nil {
+			return errorf("Invalid remote name %q", remote)
+		}
+	}
+
+	if cfg.Offline() {
+		return errorf("Git LFS is offline: unset lfs.offline to push the queued objects")
+	}
+
+	if pushBackground {
+		return startPushQueueFlush(remote)
+	}
+
+	var paths []string
+	if len(remote) > 0 {
+		paths = append(paths, pushQueuePath(remote))
+	} else if files, err := ioutil.ReadDir(pushQueueDir()); err == nil {
+		for _, file := range files {
+			paths = append(paths, filepath.Join(pushQueueDir(), file.Name()))
+		}
+	}
+
+	pushed := false
+	ok := true
+	for _, path := range paths {
+		state, err := tq.ReadJournal(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errorf("Could not read the push queue %s: %s", path, err)
+		}
+
+		pending := state.Pending()
+		if len(pending) == 0 {
+			os.Remove(path)
+			continue
+		}
+
+		pushed = true
+		resumeDryRun = pushDryRun
+		transferred, err := resumeTransfers(path, state, pending)
+		if err != nil {
+			return err
+		}
+		if !transferred {
+			ok = false
+		}
+	}
+
+	if !pushed {
+		if len(remote) > 0 {
+			Print("No queued objects to push to %s.", remote)
+		} else {
+			Print("No queued objects to push.")
+		}
+		if pushExitCode {
+			return codeErrorf(pushNothingExitCode, "")
+		}
+	}
+	if !ok {
+		return codeErrorf(exitError, "")
+	}
+	return nil
+}
+
+// startPushQueueFlush runs 'git lfs push --flush-queue' in the background, with
+// its output logged to .git/lfs/push-queue.log.
+func startPushQueueFlush(remote string) error {
+	args := []string{"push", "--flush-queue"}
+	if len(remote) > 0 {
+		args = append(args, remote)
+	}
+
+	pid, logPath, err := startBackgroundCommand("push-queue.log", args...)
+	if err != nil {
+		return errorf("Could not push the queued objects in the background: %s", err)
+	}
+
+	Print("Pushing the queued objects in the background (pid %d), logging to %s", pid, logPath)
+	return nil
+}
+
+// startBackgroundCommand runs git-lfs with the given args in the background,
+// detached from the terminal, with its output appended to the log of the given
+// name in .git/lfs. It returns the pid of the process and the path of its log.
+func startBackgroundCommand(logName string, args ...string) (int, string, error) {
+	logPath := filepath.Join(config.LocalGitDir, "lfs", logName)
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return 0, logPath, err
+	}
+
+	log, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, logPath, err
+	}
+	defer log.Close()
+
+	exe, err := lfsExecutable()
+	if err != nil {
+		return 0, logPath, err
+	}
+
+	cmd := subprocess.ExecCommand(exe, args...)
+	cmd.Dir = config.LocalWorkingDir
+	cmd.Stdout = log
+	cmd.Stderr = log
+	cmd.SysProcAttr = daemonSysProcAttr()
+
+	if err := cmd.Start(); err != nil {
+		return 0, logPath, err
+	}
+
+	pid := cmd.Process.Pid
+	cmd.Process.Release()
+	return pid, logPath, nil
+}
+
+// lfsExecutable returns the absolute path of the running git-lfs executable,
+// to run other git-lfs commands with.
+func lfsExecutable() (string, error) {
+	exe, err := exec.LookPath(os.Args[0])
+	if err == nil {
+		exe, err = filepath.Abs(exe)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not find git-lfs executable: %s", err)
+	}
+	return exe, nil
+}
@@ -9,12 +9,22 @@ import (
 	"github.com/git-lfs/git-lfs/config"
 	"github.com/git-lfs/git-lfs/httputil"
 	"github.com/git-lfs/git-lfs/localstorage"
+	"github.com/git-lfs/git-lfs/tr"
 	"github.com/spf13/cobra"
 )
 
 var (
 	commandFuncs []func() *cobra.Command
 	commandMu    sync.Mutex
+
+	// commandErr is the error returned by the command which was run, which
+	// Run handles once the command has returned.
+	commandErr error
+
+	// preRunErr is the error which stopped the root command's
+	// PersistentPreRun getting ready to run the command, which is then
+	// returned in its place. The vendored cobra has no PersistentPreRunE.
+	preRunErr error
 )
 
 // NewCommand creates a new 'git-lfs' sub command, given a command name and
@@ -22,8 +32,23 @@ var (
 //
 // Each command will initialize the local storage ('.git/lfs') directory when
 // run, unless the PreRun hook is set to nil.
-func NewCommand(name string, runFn func(*cobra.Command, []string)) *cobra.Command {
-	return &cobra.Command{Use: name, Run: runFn, PreRun: resolveLocalStorage}
+//
+// The run function returns an error rather than exiting, so that its deferred
+// calls run. Run prints it and exits with the code it gives, if any.
+func NewCommand(name string, runFn func(*cobra.Command, []string) error) *cobra.Command {
+	return &cobra.Command{
+		Use: name,
+		Run: func(cmd *cobra.Command, args []string) {
+			if preRunErr != nil {
+				commandErr = preRunErr
+				return
+			}
+
+			finish := beginCommandContext(cmd)
+			commandErr = finish(runFn(cmd, args))
+		},
+		PreRun: resolveLocalStorage,
+	}
 }
 
 // RegisterCommand creates a direct 'git-lfs' subcommand, given a command name,
@@ -34,7 +59,7 @@ func NewCommand(name string, runFn func(*cobra.Command, []string)) *cobra.Comman
 // function is called. The fn callback is passed the output from NewCommand,
 // and gives the caller the flexibility to customize the command by adding
 // flags, tweaking command hooks, etc.
-func RegisterCommand(name string, runFn func(cmd *cobra.Command, args []string), fn func(cmd *cobra.Command)) {
+func RegisterCommand(name string, runFn func(cmd *cobra.Command, args []string) error, fn func(cmd *cobra.Command)) {
 	commandMu.Lock()
 	commandFuncs = append(commandFuncs, func() *cobra.Command {
 		cmd := NewCommand(name, runFn)
@@ -47,7 +72,7 @@ func RegisterCommand(name string, runFn func(cmd *cobra.Command, args []string),
 }
 
 // Run initializes the 'git-lfs' command and runs it with the given stdin and
-// command line args.
+// command line args, exiting with the code of the error it returns, if any.
 func Run() {
 	root := NewCommand("git-lfs", gitlfsCommand)
 	root.PreRun = nil
@@ -57,6 +82,18 @@ func Run() {
 	root.SetHelpFunc(helpCommand)
 	root.SetUsageFunc(usageCommand)
 
+	root.PersistentFlags().BoolVar(&jsonErrors, "json-errors", false, "Print errors as JSON objects")
+	root.PersistentFlags().BoolVarP(&quietFlag, "quiet", "q", false, "Don't show progress, or what was done")
+	root.PersistentFlags().CountVarP(&verboseCount, "verbose", "v", "Log each file worked on; twice to trace too")
+	root.PersistentFlags().StringVar(&profileFlag, "profile", "", "Write a CPU profile, or an execution trace if the file ends in .trace, to this file")
+	root.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		applyVerbosity(cmd, args)
+		if preRunErr = startProfiling(cmd); preRunErr != nil {
+			return
+		}
+		startProfileServer()
+	}
+
 	for _, f := range commandFuncs {
 		if cmd := f(); cmd != nil {
 			root.AddCommand(cmd)
@@ -64,12 +101,22 @@ func Run() {
 	}
 
 	root.Execute()
+	code := handleCommandError(commandErr)
+	stopProfiling()
 	httputil.LogHttpStats(cfg)
+
+	if code != 0 {
+		os.Exit(code)
+	}
 }
 
-func gitlfsCommand(cmd *cobra.Command, args []string) {
-	versionCommand(cmd, args)
+func gitlfsCommand(cmd *cobra.Command, args []string) error {
+	if err := versionCommand(cmd, args); err != nil {
+		return err
+	}
 	cmd.Usage()
+
+	return nil
 }
 
 // resolveLocalStorage implements the `func(*cobra.Command, []string)` signature
@@ -97,9 +144,23 @@ func usageCommand(cmd *cobra.Command) error {
 }
 
 func printHelp(commandName string) {
-	if txt, ok := ManPages[commandName]; ok {
+	if txt, ok := manPage(commandName); ok {
 		fmt.Fprintf(os.Stderr, "%s\n", strings.TrimSpace(txt))
 	} else {
-		fmt.Fprintf(os.Stderr, "Sorry, no usage text found for %q\n", commandName)
+		fmt.Fprintln(os.Stderr, tr.Sprintf("Sorry, no usage text found for %q", commandName))
 	}
 }
+
+// manPage returns the help text of the named command, translated into the
+// user's locale if its man page has been, as in docs/man/<locale>, and
+// whether it has any.
+func manPage(commandName string) (string, bool) {
+	for _, locale := range tr.Locales() {
+		if txt, ok := ManPages[locale+"/"+commandName]; ok {
+			return txt, true
+		}
+	}
+
+	txt, ok := ManPages[commandName]
+	return txt, ok
+}
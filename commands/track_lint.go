@@ -0,0 +1,118 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/lfs"
+)
+
+// unsupportedPattern returns why Git ignores the given pattern in attributes
+// files, or an empty string if it doesn't.
+func unsupportedPattern(pattern string) string {
+	if strings.HasPrefix(pattern, "!") {
+		return "negative patterns are ignored in .gitattributes"
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return "patterns matching directories are ignored in .gitattributes, use " + pattern + "** to match the files in them"
+	}
+	return ""
+}
+
+// trackPatternWarnings returns the warnings for appending a line tracking the
+// given pattern to the .gitattributes file in its Dir: the existing lines
+// tracking the files it matches already, or differing from it only in case,
+// and the lines in other files which take precedence over it and give the files
+// it matches another filter.
+func trackPatternWarnings(added *lfs.AttributesLine, lines []*lfs.AttributesLine, macros lfs.AttributeMacroSet, ignoreCase bool) []string {
+	var warnings []string
+	for _, l := range lines {
+		if macros.TracksWithLFS(l.Attrs) {
+			if l.Dir == added.Dir && l.Pattern != added.Pattern && strings.EqualFold(l.Pattern, added.Pattern) {
+				warnings = append(warnings, fmt.Sprintf("Pattern %s differs only in case from %s (%s), and matches different files on case-insensitive file systems", added.Pattern, l.Pattern, l.Source))
+			} else if l.Covers(added, ignoreCase) {
+				warnings = append(warnings, fmt.Sprintf("Pattern %s is already matched by %s (%s)", added.Pattern, l.Pattern, l.Source))
+			}
+		} else if macros.SetsFilter(l.Attrs) && l.Rank() > added.Rank() && l.Covers(added, ignoreCase) {
+			warnings = append(warnings, fmt.Sprintf("Pattern %s is overridden by %s (%s), which does not track files with Git LFS", added.Pattern, l.Pattern, l.String()))
+		}
+	}
+	return warnings
+}
+
+// lintAttributes returns the problems with the repository's attributes files
+// which "git lfs track --lint" reports, each as "<file>:<line>: <problem>".
+func lintAttributes(ignoreCase bool) ([]string, error) {
+	lines, definitions := lfs.ReadAttributesLines()
+	macros := lfs.LocalAttributeMacros()
+
+	var problems []string
+	for _, d := range definitions {
+		if !d.Global && d.Source != ".gitattributes" && d.Source != ".git/info/attributes" {
+			problems = append(problems, fmt.Sprintf("%s: attribute macros may only be defined in the root .gitattributes", d))
+		}
+	}
+
+	for i, l := range lines {
+		if reason := unsupportedPattern(l.Pattern); len(reason) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: %s", l, reason))
+		}
+
+		for _, m := range lfs.AttributeMacros {
+			for _, attr := range l.Attrs {
+				if _, ok := macros[m.Name]; attr == m.Name && !ok {
+					problems = append(problems, fmt.Sprintf("%s: attribute macro %s is not defined, see \"git lfs track --macros\"", l, m.Name))
+				}
+			}
+		}
+
+		if !macros.TracksWithLFS(l.Attrs) {
+			continue
+		}
+
+		for _, prev := range lines[:i] {
+			if prev.Dir != l.Dir || !macros.TracksWithLFS(prev.Attrs) {
+				continue
+			}
+			if prev.Pattern == l.Pattern {
+				problems = append(problems, fmt.Sprintf("%s: pattern %s is already tracked at %s", l, l.Pattern, prev))
+			} else if strings.EqualFold(prev.Pattern, l.Pattern) {
+				problems = append(problems, fmt.Sprintf("%s: pattern %s differs only in case from %s at %s", l, l.Pattern, prev.Pattern, prev))
+			}
+		}
+
+		for _, other := range lines {
+			if !macros.TracksWithLFS(other.Attrs) && macros.SetsFilter(other.Attrs) &&
+				other.Overrides(l) && other.Covers(l, ignoreCase) {
+				problems = append(problems, fmt.Sprintf("%s: pattern %s is overridden by %s at %s", l, l.Pattern, other.Pattern, other))
+			}
+		}
+	}
+
+	staged, err := git.IndexBlobs()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(staged))
+	for name := range staged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sensitive := lfs.NewAttributeMatcher(lines, macros, false)
+	insensitive := lfs.NewAttributeMatcher(lines, macros, true)
+	for _, name := range names {
+		if tracked := sensitive.TracksWithLFS(name); tracked != insensitive.TracksWithLFS(name) {
+			system := "case-insensitive"
+			if tracked {
+				system = "case-sensitive"
+			}
+			problems = append(problems, fmt.Sprintf("%s: tracked by Git LFS only on %s file systems", name, system))
+		}
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,118 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/lfs"
+)
+
+// trackedPatternSize is how many files in the working copy a line tracking
+// files with Git LFS gives their filter, and how large they are altogether.
+type trackedPatternSize struct {
+	Line  *lfs.AttributesLine
+	Files int
+	Bytes int64
+}
+
+// workingCopyFile is a file in the working copy and its size.
+type workingCopyFile struct {
+	Name string
+	Size int64
+}
+
+type workingCopyFilesBySize []*workingCopyFile
+
+func (f workingCopyFilesBySize) Len() int      { return len(f) }
+func (f workingCopyFilesBySize) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+func (f workingCopyFilesBySize) Less(i, j int) bool {
+	if f[i].Size != f[j].Size {
+		return f[i].Size > f[j].Size
+	}
+	return f[i].Name < f[j].Name
+}
+
+// filenameSizeReport returns, for each of the given lines which tracks files
+// with Git LFS, the files it tracks, and the files of at least above bytes
+// which no line tracks, largest first. A file is counted against the line which
+// gives it its filter, as the lines it would match otherwise make no difference
+// to it.
+func filenameSizeReport(files []*workingCopyFile, lines []*lfs.AttributesLine, macros lfs.AttributeMacroSet, ignoreCase bool, above int64) ([]*trackedPatternSize, []*workingCopyFile) {
+	var patterns []*trackedPatternSize
+	byLine := make(map[*lfs.AttributesLine]*trackedPatternSize)
+	for _, l := range lines {
+		if macros.TracksWithLFS(l.Attrs) {
+			p := &trackedPatternSize{Line: l}
+			patterns = append(patterns, p)
+			byLine[l] = p
+		}
+	}
+
+	matcher := lfs.NewAttributeMatcher(lines, macros, ignoreCase)
+
+	var untracked workingCopyFilesBySize
+	for _, f := range files {
+		if matcher.TracksWithLFS(f.Name) {
+			if p, ok := byLine[matcher.Line(f.Name, "filter")]; ok {
+				p.Files++
+				p.Bytes += f.Size
+			}
+		} else if f.Size >= above {
+			untracked = append(untracked, f)
+		}
+	}
+	sort.Sort(untracked)
+
+	return patterns, untracked
+}
+
+// workingCopyFileSizes returns the files in the working copy which the next
+// commit could include, with their sizes. Those deleted since they were staged
+// and those which aren't regular files, such as symbolic links, are left out.
+func workingCopyFileSizes() ([]*workingCopyFile, error) {
+	names, err := git.GetWorkingCopyFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*workingCopyFile, 0, len(names))
+	for _, name := range names {
+		info, err := os.Lstat(filepath.Join(config.LocalWorkingDir, filepath.FromSlash(name)))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, &workingCopyFile{Name: name, Size: info.Size()})
+	}
+	return files, nil
+}
+
+// reportFilenameSizes prints the report of "git lfs track
+// --filename-size-report".
+func reportFilenameSizes(ignoreCase bool) error {
+	above, err := config.ParseSize(trackAboveFlag)
+	if err != nil {
+		return errorf("Invalid size for --above: %s", err)
+	}
+
+	files, err := workingCopyFileSizes()
+	if err != nil {
+		return err
+	}
+
+	lines, _ := lfs.ReadAttributesLines()
+	patterns, untracked := filenameSizeReport(files, lines, lfs.LocalAttributeMacros(), ignoreCase, above)
+
+	Print("Tracked patterns")
+	for _, p := range patterns {
+		Print("    %s (%s): %d file(s), %s", p.Line.Pattern, p.Line.Source, p.Files, humanizeBytes(p.Bytes))
+	}
+
+	Print("Files of %s or more not tracked by any pattern", humanizeBytes(above))
+	for _, f := range untracked {
+		Print("    %s (%s)", f.Name, humanizeBytes(f.Size))
+	}
+	return nil
+}
@@ -1,93 +1,260 @@
 package commands
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/git-lfs/git-lfs/config"
 	"github.com/git-lfs/git-lfs/errors"
 	"github.com/git-lfs/git-lfs/lfs"
+	"github.com/git-lfs/git-lfs/progress"
 	"github.com/git-lfs/git-lfs/tools"
 	"github.com/git-lfs/git-lfs/tq"
+	"github.com/rubyist/tracerx"
 )
 
 var uploadMissingErr = "%s does not exist in .git/lfs/objects. Tried %s, which matches %s."
 
 type uploadContext struct {
-	DryRun       bool
-	uploadedOids tools.StringSet
+	DryRun bool
+	// Later queues the objects to be pushed by "git lfs push --flush-queue"
+	// instead of uploading them, as is also done while Git LFS is offline.
+	Later bool
+
+	// uploadedOids holds the oids uploaded to each endpoint, keyed by its
+	// URL, since refs may be pushed to different endpoints.
+	uploadedOids map[string]tools.StringSet
+	endpoint     string
+
+	// meter is the overall progress meter of a push of several refs, each
+	// shown as a section of it, or nil when pushing one ref.
+	meter *progress.ProgressMeter
+	ref   string
+
+	summary pushSummary
+
+	// budget limits the requests made to each host at once by the queues
+	// which check which objects the server has and those which upload
+	// them, together.
+	budget *tq.ConnectionBudget
+}
+
+// pushSummary counts the objects a push sent, or would send, to the server,
+// and those it skipped because the server already had them.
+type pushSummary struct {
+	Files        int
+	Bytes        int64
+	SkippedFiles int
+	SkippedBytes int64
+}
+
+// Print shows the summary, as at the end of a push or a dry run of one. A dry
+// run doesn't ask the server which objects it has, so skips none.
+func (s pushSummary) Print(dryRun bool) {
+	if dryRun {
+		Print("Dry run: %d files to upload (%v)", s.Files, humanizeBytes(s.Bytes))
+		return
+	}
+
+	Print("Uploaded %d files (%v), skipped %d files already on the server (%v saved)",
+		s.Files, humanizeBytes(s.Bytes), s.SkippedFiles, humanizeBytes(s.SkippedBytes))
+}
+
+// skip counts an object of the given size which the server already has.
+func (s *pushSummary) skip(size int64) {
+	s.SkippedFiles++
+	s.SkippedBytes += size
 }
 
 func newUploadContext(dryRun bool) *uploadContext {
 	return &uploadContext{
 		DryRun:       dryRun,
-		uploadedOids: tools.NewStringSet(),
+		uploadedOids: make(map[string]tools.StringSet),
+		budget:       tq.NewConnectionBudget(TransferManifest()),
+	}
+}
+
+// useCurrentEndpoint records uploads against the endpoint of the ref being
+// pushed, as given by cfg.CurrentRef.
+func (c *uploadContext) useCurrentEndpoint() {
+	c.endpoint = cfg.Endpoint("upload").Url
+	if _, ok := c.uploadedOids[c.endpoint]; !ok {
+		c.uploadedOids[c.endpoint] = tools.NewStringSet()
+	}
+}
+
+// startRefs begins the push of the given number of refs, showing the progress
+// of each and of them all if there are several.
+func (c *uploadContext) startRefs(n int) {
+	if n > 1 {
+		c.meter = buildProgressMeter(c.DryRun, progress.WithSections(n))
+	}
+}
+
+// startRef begins the push of the objects of the named ref.
+func (c *uploadContext) startRef(name string) {
+	c.ref = name
+}
+
+// finishRefs shows the overall progress of a push of several refs.
+func (c *uploadContext) finishRefs() {
+	if c.meter != nil {
+		c.meter.Finish()
 	}
 }
 
 // AddUpload adds the given oid to the set of oids that have been uploaded in
 // the current process.
 func (c *uploadContext) SetUploaded(oid string) {
-	c.uploadedOids.Add(oid)
+	c.uploadedOids[c.endpoint].Add(oid)
 }
 
 // HasUploaded determines if the given oid has already been uploaded in the
 // current process.
 func (c *uploadContext) HasUploaded(oid string) bool {
-	return c.uploadedOids.Contains(oid)
+	return c.uploadedOids[c.endpoint].Contains(oid)
 }
 
-func (c *uploadContext) prepareUpload(unfiltered []*lfs.WrappedPointer) (*tq.TransferQueue, []*lfs.WrappedPointer) {
-	numUnfiltered := len(unfiltered)
-	uploadables := make([]*lfs.WrappedPointer, 0, numUnfiltered)
-	missingLocalObjects := make([]*lfs.WrappedPointer, 0, numUnfiltered)
-	missingSize := int64(0)
-	meter := buildProgressMeter(c.DryRun)
+// missingCheckSize is the most objects which aren't stored locally that a
+// streamed upload holds before asking the server which of them it has.
+const missingCheckSize = 1000
 
-	// XXX(taylor): temporary measure to fix duplicate (broken) results from
-	// scanner
-	uniqOids := tools.NewStringSet()
+// uploadStream uploads the objects of the pointers read from the given channel
+// as they're read, until it's closed. Only the oids of the objects are kept
+// once they're queued, so that the pointers of a large history need not all
+// be held in memory at once.
+//
+// If an object can't be queued, the objects not yet asked about are failed,
+// and the rest of the channel is read and ignored.
+func (c *uploadContext) uploadStream(pointers <-chan *lfs.WrappedPointer) error {
+	ctx, cancel := context.WithCancel(commandContext())
+	defer cancel()
 
-	// separate out objects that _should_ be uploaded, but don't exist in
-	// .git/lfs/objects. Those will skipped if the server already has them.
-	for _, p := range unfiltered {
-		// object already uploaded in this process, or we've already
-		// seen this OID (see above), skip!
-		if uniqOids.Contains(p.Oid) || c.HasUploaded(p.Oid) {
+	meter := buildProgressMeter(c.DryRun, progress.WithSection(c.meter, c.ref))
+	options := []tq.Option{tq.WithProgress(meter), tq.DryRun(c.DryRun), tq.WithConnectionBudget(c.budget), tq.WithContext(ctx)}
+	if !c.DryRun {
+		options = append(options, newTransferJournal(tq.Upload))
+	}
+	q := newUploadQueue(options...)
+
+	// objects the queue doesn't upload, or fail to, are ones the server
+	// said it already has.
+	var queuedFiles, uploadedFiles int
+	var queuedBytes, uploadedBytes int64
+	uploaded := q.WatchTransfers()
+	done := make(chan struct{})
+	go func() {
+		for t := range uploaded {
+			uploadedFiles++
+			uploadedBytes += t.Size
+		}
+		close(done)
+	}()
+
+	add := func(p *lfs.WrappedPointer) error {
+		t, err := uploadTransfer(p.Oid, p.Name)
+		if err != nil {
+			return uploadTransferError(p, err)
+		}
+
+		q.Add(t.Name, t.Path, t.Oid, t.Size)
+		c.SetUploaded(p.Oid)
+		queuedFiles++
+		queuedBytes += p.Size
+		return nil
+	}
+
+	// objects that _should_ be uploaded, but don't exist in
+	// .git/lfs/objects, are checked against the server in batches, and
+	// skipped if it already has them.
+	missing := make([]*lfs.WrappedPointer, 0, missingCheckSize)
+	missingOids := tools.NewStringSet()
+	var missingSize int64
+	checkMissing := func() error {
+		c.checkMissing(missing, missingSize)
+		for _, p := range missing {
+			if c.HasUploaded(p.Oid) {
+				// if the server already has this object, call
+				// Skip() on the progressmeter to decrement the
+				// number of files by 1 and the number of bytes
+				// by `p.Size`.
+				q.Skip(p.Size)
+				c.summary.skip(p.Size)
+			} else if err := add(p); err != nil {
+				return err
+			}
+		}
+		missing = missing[:0]
+		missingOids = tools.NewStringSet()
+		missingSize = 0
+		return nil
+	}
+
+	var err error
+	for p := range pointers {
+		if err != nil {
+			// stop asking about the queued objects, but read the
+			// rest of the channel.
+			cancel()
+			continue
+		}
+
+		// object already uploaded in this process, or waiting to be
+		// checked against the server, skip!
+		if c.HasUploaded(p.Oid) || missingOids.Contains(p.Oid) {
 			continue
 		}
-		uniqOids.Add(p.Oid)
 
-		// estimate in meter early (even if it's not going into uploadables), since
-		// we will call Skip() based on the results of the download check queue.
+		// estimate in meter early (even if it's not uploaded), since we
+		// will call Skip() based on the results of the download check
+		// queue.
 		meter.Add(p.Size)
 
 		if lfs.ObjectExistsOfSize(p.Oid, p.Size) {
-			uploadables = append(uploadables, p)
-		} else {
-			// We think we need to push this but we don't have it
-			// Store for server checking later
-			missingLocalObjects = append(missingLocalObjects, p)
-			missingSize += p.Size
+			err = add(p)
+			continue
+		}
+
+		missing = append(missing, p)
+		missingOids.Add(p.Oid)
+		missingSize += p.Size
+		if len(missing) >= missingCheckSize {
+			err = checkMissing()
 		}
 	}
+	if err == nil {
+		err = checkMissing()
+	}
+	if err != nil {
+		cancel()
+	}
 
-	// check to see if the server has the missing objects.
-	c.checkMissing(missingLocalObjects, missingSize)
+	q.Wait()
+	<-done
 
-	// build the TransferQueue, automatically skipping any missing objects that
-	// the server already has.
-	uploadQueue := newUploadQueue(tq.WithProgress(meter), tq.DryRun(c.DryRun))
-	for _, p := range missingLocalObjects {
-		if c.HasUploaded(p.Oid) {
-			// if the server already has this object, call Skip() on
-			// the progressmeter to decrement the number of files by
-			// 1 and the number of bytes by `p.Size`.
-			uploadQueue.Skip(p.Size)
-		} else {
-			uploadables = append(uploadables, p)
-		}
+	if err != nil {
+		return err
 	}
 
-	return uploadQueue, uploadables
+	c.summary.Files += uploadedFiles
+	c.summary.Bytes += uploadedBytes
+	if len(q.Errors()) == 0 {
+		c.summary.SkippedFiles += queuedFiles - uploadedFiles
+		c.summary.SkippedBytes += queuedBytes - uploadedBytes
+	}
+
+	if errs := q.Errors(); len(errs) > 0 {
+		reportUploadErrors(errs)
+
+		var failures transferFailures
+		failures.addQueue(q, queuedFiles)
+		return failures.err()
+	}
+	return nil
 }
 
 // This checks the given slice of pointers that don't exist in .git/lfs/objects
@@ -99,7 +266,25 @@ func (c *uploadContext) checkMissing(missing []*lfs.WrappedPointer, missingSize
 		return
 	}
 
-	checkQueue := newDownloadCheckQueue()
+	// skip checking the objects which the server's existence filter says
+	// it almost certainly has.
+	if filter := lfs.ServerExistenceFilter(cfg); filter != nil {
+		unknown := make([]*lfs.WrappedPointer, 0, numMissing)
+		for _, p := range missing {
+			if filter.Contains(p.Oid) {
+				c.SetUploaded(p.Oid)
+			} else {
+				unknown = append(unknown, p)
+			}
+		}
+
+		tracerx.Printf("existence filter: skipped checking %d of %d object(s)", numMissing-len(unknown), numMissing)
+		if missing = unknown; len(missing) == 0 {
+			return
+		}
+	}
+
+	checkQueue := newDownloadCheckQueue(tq.WithConnectionBudget(c.budget))
 	transferCh := checkQueue.Watch()
 
 	done := make(chan int)
@@ -124,42 +309,245 @@ func (c *uploadContext) checkMissing(missing []*lfs.WrappedPointer, missingSize
 	<-done
 }
 
-func uploadPointers(c *uploadContext, unfiltered []*lfs.WrappedPointer) {
+// uploadPointers uploads the objects of the given pointers, as
+// uploadPointerStream does.
+func uploadPointers(c *uploadContext, unfiltered []*lfs.WrappedPointer) error {
+	pointers := make(chan *lfs.WrappedPointer, len(unfiltered))
+	for _, p := range unfiltered {
+		pointers <- p
+	}
+	close(pointers)
+
+	return uploadPointerStream(c, pointers)
+}
+
+// uploadPointerStream uploads the objects of the pointers read from the given
+// channel, until it's closed, to the current endpoint, or queues them to be
+// pushed later. The channel is always read until it's closed, even if it
+// returns an error.
+func uploadPointerStream(c *uploadContext, pointers <-chan *lfs.WrappedPointer) error {
+	c.useCurrentEndpoint()
+
 	if c.DryRun {
-		for _, p := range unfiltered {
+		for p := range pointers {
 			if c.HasUploaded(p.Oid) {
 				continue
 			}
 
 			Print("push %s => %s", p.Oid, p.Name)
 			c.SetUploaded(p.Oid)
+			c.summary.Files++
+			c.summary.Bytes += p.Size
 		}
 
-		return
+		return nil
+	}
+
+	if c.Later || cfg.Offline() {
+		return c.queueUploads(pointers)
+	}
+
+	return c.uploadStream(pointers)
+}
+
+// uploadTransferError returns the error for the object of the given pointer
+// failing to be uploaded, which exits with exitMissingObject if it isn't
+// stored locally.
+func uploadTransferError(p *lfs.WrappedPointer, err error) error {
+	if errors.IsCleanPointerError(err) {
+		return codeErrorf(exitMissingObject, uploadMissingErr, p.Oid, p.Name, errors.GetContext(err, "pointer").(*lfs.Pointer).Oid)
+	}
+	if isMissingObject(err) {
+		return withExitCode(exitMissingObject, err)
+	}
+	return err
+}
+
+// queueUploads records the given pointers in the push queue of the current
+// remote, to be uploaded later by "git lfs push --flush-queue", or by "git lfs
+// push --queued" once Git LFS is no longer offline. Nothing more is queued
+// once an object can't be, though the rest of the channel is still read.
+func (c *uploadContext) queueUploads(pointers <-chan *lfs.WrappedPointer) error {
+	path := pushQueuePath(cfg.CurrentRemote)
+
+	var queued []*tq.JournalEntry
+	if state, err := tq.ReadJournal(path); err == nil {
+		queued = state.Pending()
+	} else if !os.IsNotExist(err) {
+		drainPointers(pointers)
+		return errorf("Could not read the push queue for %q: %s", cfg.CurrentRemote, err)
 	}
 
-	q, pointers := c.prepareUpload(unfiltered)
-	for _, p := range pointers {
+	j, err := tq.CreateJournal(path, tq.Upload, cfg.CurrentRemote)
+	if err != nil {
+		drainPointers(pointers)
+		return errorf("Could not queue objects to push to %q: %s", cfg.CurrentRemote, err)
+	}
+	defer j.Close()
+
+	// the objects already queued are kept by the journal.
+	seen := tools.NewStringSet()
+	for _, e := range queued {
+		seen.Add(e.Oid)
+	}
+
+	var n int
+	for p := range pointers {
+		if c.HasUploaded(p.Oid) || seen.Contains(p.Oid) {
+			continue
+		}
+
 		t, err := uploadTransfer(p.Oid, p.Name)
 		if err != nil {
-			if errors.IsCleanPointerError(err) {
-				Exit(uploadMissingErr, p.Oid, p.Name, errors.GetContext(err, "pointer").(*lfs.Pointer).Oid)
-			} else {
-				ExitWithError(err)
-			}
+			drainPointers(pointers)
+			return uploadTransferError(p, err)
 		}
 
-		q.Add(t.Name, t.Path, t.Oid, t.Size)
+		j.Add(t.Name, t.Path, t.Oid, t.Size)
 		c.SetUploaded(p.Oid)
+		seen.Add(p.Oid)
+		n++
 	}
 
-	q.Wait()
+	if n == 0 {
+		return nil
+	}
+
+	if cfg.Offline() {
+		Error("Git LFS is offline: queued %d files to push later with 'git lfs push --queued %s'", n, cfg.CurrentRemote)
+	} else {
+		Error("Queued %d files to push later with 'git lfs push --flush-queue'", n)
+	}
+	Error("Warning: until then, commits pushed to %s refer to Git LFS objects it doesn't have", cfg.CurrentRemote)
+	return nil
+}
 
-	for _, err := range q.Errors() {
-		FullError(err)
+// drainPointers reads the given channel until it's closed, so that whatever
+// writes to it isn't left waiting.
+func drainPointers(pointers <-chan *lfs.WrappedPointer) {
+	for range pointers {
 	}
+}
 
-	if len(q.Errors()) > 0 {
-		os.Exit(2)
+// uploadErrorRecord is a line of the log reportUploadErrors writes.
+type uploadErrorRecord struct {
+	Oid     string   `json:"oid,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Action  string   `json:"action,omitempty"`
+	Status  int      `json:"status,omitempty"`
+	Error   string   `json:"error"`
+	Retries []string `json:"retries,omitempty"`
+}
+
+// uploadErrorsShown is the most distinct errors of each group reportUploadErrors
+// prints. The rest are only counted, and written to the log.
+const uploadErrorsShown = 10
+
+// uploadErrorGroup is the errors of an upload which failed in the same way:
+// in the same action, against the same host, with the same HTTP status.
+type uploadErrorGroup struct {
+	Title string
+	// Errors are the first uploadErrorsShown errors of the group, leaving
+	// out those with the same message as one before.
+	Errors []error
+	// Count is the number of errors in the group, including those left
+	// out of Errors.
+	Count int
+
+	messages tools.StringSet
+}
+
+// groupUploadErrors groups the errors of an upload by what failed, where, and
+// the HTTP status it failed with, returning the groups in the order their
+// first errors were given, and a record of each error for the log.
+func groupUploadErrors(errs []error) ([]*uploadErrorGroup, []*uploadErrorRecord) {
+	var groups []*uploadErrorGroup
+	grouped := make(map[string]*uploadErrorGroup)
+	records := make([]*uploadErrorRecord, 0, len(errs))
+
+	for _, err := range errs {
+		record := &uploadErrorRecord{Error: err.Error()}
+		title := "Failed to upload"
+
+		if e, ok := err.(*tq.TransferError); ok {
+			record.Oid, record.Name = e.Oid, e.Name
+			record.Action, record.Status = e.Action, e.StatusCode
+			for _, retry := range e.Retries {
+				record.Retries = append(record.Retries, retry.Error())
+			}
+
+			title = "Failed to " + e.Action
+			if len(e.Host) > 0 {
+				title = fmt.Sprintf("%s to %s", title, e.Host)
+			}
+			if e.StatusCode > 0 {
+				title = fmt.Sprintf("%s (HTTP %d)", title, e.StatusCode)
+			}
+		}
+		records = append(records, record)
+
+		g, ok := grouped[title]
+		if !ok {
+			g = &uploadErrorGroup{Title: title, messages: tools.NewStringSet()}
+			groups = append(groups, g)
+			grouped[title] = g
+		}
+		g.Count++
+		if len(g.Errors) < uploadErrorsShown && g.messages.Add(err.Error()) {
+			g.Errors = append(g.Errors, err)
+		}
+	}
+
+	return groups, records
+}
+
+// reportUploadErrors prints the errors of an upload, grouped by what failed,
+// where, and the HTTP status it failed with, and writes them to a log of JSON
+// lines, one per error, for tools to read. Only the first few distinct errors
+// of each group are printed, so that the failure of a large push doesn't
+// flood the terminal.
+func reportUploadErrors(errs []error) {
+	groups, records := groupUploadErrors(errs)
+
+	for _, g := range groups {
+		if !jsonErrors {
+			Error("%s: %d errors", g.Title, g.Count)
+		}
+		for _, err := range g.Errors {
+			FullError(err)
+		}
+		if more := g.Count - len(g.Errors); more > 0 && !jsonErrors {
+			Error("  ...and %d more", more)
+		}
+	}
+
+	if path, err := writeUploadErrorLog(records); err != nil {
+		tracerx.Printf("unable to log upload errors: %s", err)
+	} else {
+		Error("Upload errors written to %s", path)
+	}
+}
+
+// writeUploadErrorLog writes the given records to a new file in the log
+// directory, returning its path.
+func writeUploadErrorLog(records []*uploadErrorRecord) (string, error) {
+	if err := os.MkdirAll(config.LocalLogDir, 0755); err != nil {
+		return "", err
+	}
+
+	name := time.Now().Format("20060102T150405.999999999") + "-upload-errors.json"
+	path := filepath.Join(config.LocalLogDir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return "", err
+		}
 	}
+	return path, nil
 }
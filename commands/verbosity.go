@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/rubyist/tracerx"
+	"github.com/spf13/cobra"
+)
+
+// The verbosity levels set by the global -q/--quiet and -v/--verbose flags,
+// which every command honours in the same way.
+const (
+	// verbosityQuiet shows no progress meters, and nothing of what was done
+	// by the commands which only report that, such as "git lfs gc".
+	verbosityQuiet = -1
+	// verbosityNormal is the level without either flag.
+	verbosityNormal = 0
+	// verbosityVerbose, with -v, also logs each file a command works on,
+	// such as those "git lfs prune" deletes.
+	verbosityVerbose = 1
+	// verbosityTrace, with -vv, also writes trace output to stderr, as
+	// GIT_TRACE=1 does.
+	verbosityTrace = 2
+)
+
+var (
+	quietFlag    bool
+	verboseCount int
+)
+
+// verbosity returns the verbosity level given by the global flags, or
+// verbosityQuiet if --quiet was given at all.
+func verbosity() int {
+	if quietFlag {
+		return verbosityQuiet
+	}
+	if verboseCount > verbosityTrace {
+		return verbosityTrace
+	}
+	return verboseCount
+}
+
+// isQuiet returns whether --quiet was given.
+func isQuiet() bool {
+	return verbosity() == verbosityQuiet
+}
+
+// isVerbose returns whether -v was given at least once, for commands to log
+// each file they work on.
+func isVerbose() bool {
+	return verbosity() >= verbosityVerbose
+}
+
+// applyVerbosity implements the `func(*cobra.Command, []string)` signature of
+// `cobra.Command.PersistentPreRun`, to enable trace output with -vv before any
+// command runs.
+func applyVerbosity(cmd *cobra.Command, args []string) {
+	if verbosity() < verbosityTrace {
+		return
+	}
+
+	// Git commands run by Git LFS trace too, as they do with GIT_TRACE.
+	os.Setenv("GIT_TRACE", "1")
+	tracerx.Enable(tracerx.DefaultKey)
+}
+
+// discardOutputIfQuiet discards what a command which only reports what it has
+// done prints, if --quiet was given.
+func discardOutputIfQuiet() {
+	if isQuiet() {
+		OutputWriter = ioutil.Discard
+	}
+}
@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"os"
+	"sync"
+
+	"github.com/git-lfs/git-lfs/localstorage"
+	"github.com/rubyist/tracerx"
+)
+
+var (
+	worktreeChecksums     *localstorage.Checksums
+	worktreeChecksumsOnce sync.Once
+)
+
+// readWorktreeChecksums returns the checksum database of the working tree,
+// read once for the command, or nil if lfs.worktreechecksums is false or it
+// can't be read.
+func readWorktreeChecksums() *localstorage.Checksums {
+	worktreeChecksumsOnce.Do(func() {
+		if !cfg.WorktreeChecksums() {
+			return
+		}
+
+		checksums, err := localstorage.ReadChecksums()
+		if err != nil {
+			tracerx.Printf("checksums: unable to read: %s", err)
+			return
+		}
+		worktreeChecksums = checksums
+	})
+	return worktreeChecksums
+}
+
+// recordWorktreeChecksum records that the working tree file with the given
+// name held the object with the given oid when it had the given stat info.
+func recordWorktreeChecksum(fileName string, stat os.FileInfo, oid string) {
+	if checksums := readWorktreeChecksums(); checksums != nil {
+		if err := checksums.Record(fileName, stat, oid); err != nil {
+			tracerx.Printf("checksums: unable to record %q: %s", fileName, err)
+		}
+	}
+}
+
+// worktreeFileHolds returns whether the checksum database has the working tree
+// file with the given name, relative to the root of the working tree, unchanged
+// since it held the object with the given oid. The file at cwdPath, its path
+// relative to the current directory, is only stat'd, never read.
+func worktreeFileHolds(name, cwdPath, oid string) bool {
+	checksums := readWorktreeChecksums()
+	if checksums == nil {
+		return false
+	}
+
+	stat, err := os.Stat(cwdPath)
+	if err != nil {
+		return false
+	}
+	recorded, ok := checksums.Lookup(name, stat)
+	return ok && recorded == oid
+}
@@ -6,10 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ThomsonReutersEikon/go-ntlm/ntlm"
 	"github.com/bgentry/go-netrc/netrc"
@@ -57,7 +59,11 @@ type Configuration struct {
 	// configuration.
 	Git Environment
 
-	CurrentRemote   string
+	CurrentRemote string
+	// CurrentRef is the full name of the ref being pushed or fetched, such
+	// as "refs/heads/master", which selects the "lfs.<ref>.url" overrides
+	// used by Endpoint. If it is empty, the current branch is used.
+	CurrentRef      string
 	NtlmSession     ntlm.ClientSession
 	envVars         map[string]string
 	envVarsMutex    sync.Mutex
@@ -72,6 +78,11 @@ type Configuration struct {
 	parsedNetrc    netrcfinder
 	urlAliasesMap  map[string]string
 	urlAliasMu     sync.Mutex
+
+	// endpointReachability holds whether each endpoint URL is reachable, as
+	// found by endpointReachable.
+	endpointReachability map[string]bool
+	endpointMu           sync.Mutex
 }
 
 func New() *Configuration {
@@ -99,13 +110,16 @@ type Values struct {
 
 // NewFrom returns a new `*config.Configuration` that reads both its Git
 // and Enviornment-level values from the ones provided instead of the actual
-// `.gitconfig` file or `os.Getenv`, respectively.
+// `.gitconfig` file or `os.Getenv`, respectively. As with the real ones, the
+// "GIT_LFS_<NAME>" values in `Os` override the "lfs.<name>" values in `Git`.
 //
 // This method should only be used during testing.
 func NewFrom(v Values) *Configuration {
+	osEnv := EnvironmentOf(mapFetcher(v.Os))
+
 	return &Configuration{
-		Os:  EnvironmentOf(mapFetcher(v.Os)),
-		Git: EnvironmentOf(mapFetcher(v.Git)),
+		Os:  osEnv,
+		Git: EnvironmentOf(&envOverrideFetcher{os: osEnv, git: mapFetcher(v.Git)}),
 
 		envVars: make(map[string]string, 0),
 	}
@@ -225,13 +239,25 @@ func (c *Configuration) SetManualEndpoint(e Endpoint) {
 	c.manualEndpoint = &e
 }
 
+// Endpoint returns the endpoint of the LFS server for the given operation, or,
+// for downloads, of its first reachable mirror if it is unreachable.
 func (c *Configuration) Endpoint(operation string) Endpoint {
 	if c.manualEndpoint != nil {
 		return *c.manualEndpoint
 	}
 
-	if operation == "upload" {
-		if url, ok := c.Git.Get("lfs.pushurl"); ok {
+	return c.failoverEndpoint(operation, c.primaryEndpoint(operation))
+}
+
+// primaryEndpoint returns the endpoint of the LFS server for the given
+// operation, as configured.
+func (c *Configuration) primaryEndpoint(operation string) Endpoint {
+	if url, ok := c.refEndpointUrl(operation); ok {
+		return NewEndpointWithConfig(url, c)
+	}
+
+	if key, ok := directionalUrlKeys[operation]; ok {
+		if url, ok := c.Git.Get("lfs." + key); ok {
 			return NewEndpointWithConfig(url, c)
 		}
 	}
@@ -249,6 +275,96 @@ func (c *Configuration) Endpoint(operation string) Endpoint {
 	return c.RemoteEndpoint(defaultRemote, operation)
 }
 
+// directionalUrlKeys maps each operation to the name of the URL settings which
+// apply to it alone, in place of the "url" ones, such as "lfs.pushurl": objects
+// may be fetched from a read-only mirror, and pushed to the server itself.
+var directionalUrlKeys = map[string]string{
+	"download": "pullurl",
+	"upload":   "pushurl",
+}
+
+// refEndpointUrl returns the URL given by the most specific
+// "lfs.<ref>.pushurl" (when uploading), "lfs.<ref>.pullurl" (when
+// downloading) or "lfs.<ref>.url" whose ref pattern matches the current ref,
+// and whether there was one. Patterns are full ref names, such as
+// "refs/heads/release/*", matched as with path.Match, except that a trailing
+// "*" also matches any number of path segments.
+func (c *Configuration) refEndpointUrl(operation string) (string, bool) {
+	keys := []string{"url"}
+	if key, ok := directionalUrlKeys[operation]; ok {
+		keys = []string{key, "url"}
+	}
+
+	all := c.Git.All()
+	ref := ""
+	for _, key := range keys {
+		var pattern, url string
+		for k, v := range all {
+			p, ok := refEndpointPattern(k, key)
+			if !ok || len(p) < len(pattern) || len(p) == len(pattern) && p > pattern {
+				continue
+			}
+
+			if len(ref) == 0 {
+				if ref = c.currentRef(); len(ref) == 0 {
+					return "", false
+				}
+			}
+
+			if refMatches(p, ref) {
+				pattern, url = p, v
+			}
+		}
+
+		if len(pattern) > 0 {
+			return url, true
+		}
+	}
+	return "", false
+}
+
+// refEndpointPattern returns the ref pattern in a "lfs.<ref>.<key>" config key,
+// and whether k is one.
+func refEndpointPattern(k, key string) (string, bool) {
+	prefix, suffix := "lfs.refs/", "."+key
+	if !strings.HasPrefix(k, prefix) || !strings.HasSuffix(k, suffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(k, "lfs."), suffix), true
+}
+
+// currentRef returns the lowercased full name of CurrentRef, or of the current
+// branch if it is empty. Remote-tracking branches of the current remote are
+// treated as the branches they track, so that fetching "origin/release/1.0"
+// uses the same endpoint as pushing "release/1.0".
+func (c *Configuration) currentRef() string {
+	ref := c.CurrentRef
+	if len(ref) == 0 || ref == "HEAD" {
+		current, err := git.CurrentRef()
+		if err != nil {
+			return ""
+		}
+		ref = current.Refspec()
+	}
+
+	ref = strings.ToLower(ref)
+	remotePrefix := "refs/remotes/" + strings.ToLower(c.CurrentRemote) + "/"
+	if len(c.CurrentRemote) > 0 && strings.HasPrefix(ref, remotePrefix) {
+		ref = "refs/heads/" + strings.TrimPrefix(ref, remotePrefix)
+	}
+	return ref
+}
+
+// refMatches returns whether the given ref pattern matches ref.
+func refMatches(pattern, ref string) bool {
+	if strings.HasSuffix(pattern, "*") && strings.HasPrefix(ref, strings.TrimSuffix(pattern, "*")) {
+		return true
+	}
+
+	matched, err := path.Match(pattern, ref)
+	return err == nil && matched
+}
+
 func (c *Configuration) ConcurrentTransfers() int {
 	if c.NtlmAccess("download") {
 		return 1
@@ -368,9 +484,9 @@ func (c *Configuration) RemoteEndpoint(remote, operation string) Endpoint {
 		remote = defaultRemote
 	}
 
-	// Support separate push URL if specified and pushing
-	if operation == "upload" {
-		if url, ok := c.Git.Get("remote." + remote + ".lfspushurl"); ok {
+	// Support separate push and pull URLs if specified
+	if key, ok := directionalUrlKeys[operation]; ok {
+		if url, ok := c.Git.Get("remote." + remote + ".lfs" + key); ok {
 			return NewEndpointWithConfig(url, c)
 		}
 	}
@@ -474,6 +590,393 @@ func (c *Configuration) SkipDownloadErrors() bool {
 	return c.Os.Bool("GIT_LFS_SKIP_DOWNLOAD_ERRORS", false) || c.Git.Bool("lfs.skipdownloaderrors", false)
 }
 
+// Offline returns whether Git LFS should avoid the network: the smudge filter
+// leaves pointers for objects which aren't present locally, and pushes queue
+// objects to be uploaded later with "git lfs push --queued". It is given by
+// lfs.offline or GIT_LFS_OFFLINE.
+func (c *Configuration) Offline() bool {
+	return c.Os.Bool("GIT_LFS_OFFLINE", false) || c.Git.Bool("lfs.offline", false)
+}
+
+// PushLater returns whether "git push" and "git lfs push" should queue objects
+// to be uploaded later by "git lfs push --flush-queue", instead of uploading
+// them. It is given by lfs.pushlater or GIT_LFS_PUSH_LATER.
+func (c *Configuration) PushLater() bool {
+	return c.Os.Bool("GIT_LFS_PUSH_LATER", false) || c.Git.Bool("lfs.pushlater", false)
+}
+
+// CacheCredentials returns whether credentials filled by the credential helper
+// should be reused for the rest of the process, rather than filled for every
+// request. It is given by lfs.cachecredentials, and is true by default.
+func (c *Configuration) CacheCredentials() bool {
+	return c.Git.Bool("lfs.cachecredentials", true)
+}
+
+// CredentialCacheTimeout returns the number of seconds, given by
+// lfs.credentialcachetimeout, for which Git's credential-cache daemon keeps
+// credentials for later invocations of Git LFS. It is 0 if they aren't kept.
+func (c *Configuration) CredentialCacheTimeout() int {
+	if timeout := c.Git.Int("lfs.credentialcachetimeout", 0); timeout > 0 {
+		return timeout
+	}
+	return 0
+}
+
+// AutoPush returns whether the Git LFS objects of each new commit should be
+// uploaded in the background by the post-commit hook, so that they're already
+// on the server by the time the commit is pushed. It is given by lfs.autopush or
+// GIT_LFS_AUTOPUSH.
+func (c *Configuration) AutoPush() bool {
+	return c.Os.Bool("GIT_LFS_AUTOPUSH", false) || c.Git.Bool("lfs.autopush", false)
+}
+
+// AutoGC returns whether "git lfs gc --auto" is run from Git's pre-auto-gc hook,
+// whenever Git's own automatic garbage collection or "git maintenance" runs. It
+// is given by lfs.autogc.
+func (c *Configuration) AutoGC() bool {
+	return c.Git.Bool("lfs.autogc", false)
+}
+
+// AutoGCIntervalDays returns the number of days within which "git lfs gc
+// --auto" does nothing if it has run already. It is given by
+// lfs.autogcintervaldays, and is 1 by default.
+func (c *Configuration) AutoGCIntervalDays() int {
+	return c.Git.Int("lfs.autogcintervaldays", 1)
+}
+
+// The schedules on which "git lfs maintenance" tasks can run, from the most to
+// the least frequent.
+const (
+	MaintenanceHourly = "hourly"
+	MaintenanceDaily  = "daily"
+	MaintenanceWeekly = "weekly"
+)
+
+// MaintenanceTaskEnabled returns whether the given "git lfs maintenance" task
+// runs on its schedule. It is given by lfs.maintenance.<task>.enabled, and is
+// true by default.
+func (c *Configuration) MaintenanceTaskEnabled(task string) bool {
+	return c.Git.Bool("lfs.maintenance."+task+".enabled", true)
+}
+
+// MaintenanceTaskSchedule returns how often the given "git lfs maintenance"
+// task runs: MaintenanceHourly, MaintenanceDaily or MaintenanceWeekly. It is
+// given by lfs.maintenance.<task>.schedule, and is the given default if unset
+// or unknown.
+func (c *Configuration) MaintenanceTaskSchedule(task, def string) string {
+	key := "lfs.maintenance." + task + ".schedule"
+	schedule, ok := c.Git.Get(key)
+	if !ok {
+		return def
+	}
+
+	switch schedule = strings.ToLower(schedule); schedule {
+	case MaintenanceHourly, MaintenanceDaily, MaintenanceWeekly:
+		return schedule
+	}
+
+	fmt.Fprintf(os.Stderr, "WARNING: Unknown %s %q, running %s instead\n", key, schedule, def)
+	return def
+}
+
+// ChunkStore returns whether new objects are kept locally as content-defined
+// chunks in .git/lfs/chunks, each stored once, rather than as whole files, so
+// that near-identical versions of large files take up little more space than
+// one. It is given by lfs.chunkstore, which also offers chunked transfers to
+// servers.
+func (c *Configuration) ChunkStore() bool {
+	return c.Git.Bool("lfs.chunkstore", false)
+}
+
+// RsyncArgs returns the extra arguments given to rsync for transfers to and
+// from rsync+ssh:// URLs, such as "--compress" or "--bwlimit=1m", as listed in
+// lfs.rsync.args.
+func (c *Configuration) RsyncArgs() []string {
+	v, _ := c.Git.Get("lfs.rsync.args")
+	return strings.Fields(v)
+}
+
+// WebdavChunkSize returns the size in bytes, given by lfs.webdav.chunksize, of
+// the parts which objects larger than it are uploaded to webdav+http(s):// URLs
+// in, so that interrupted uploads are resumed. It is 0 if objects are uploaded
+// whole, by default or if the size is invalid.
+func (c *Configuration) WebdavChunkSize() int64 {
+	v, ok := c.Git.Get("lfs.webdav.chunksize")
+	if !ok {
+		return 0
+	}
+
+	size, err := ParseSize(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: Invalid lfs.webdav.chunksize %q, uploading objects whole\n", v)
+		return 0
+	}
+	return size
+}
+
+// WebdavLocking returns whether objects are locked with WebDAV locks while they
+// are uploaded to webdav+http(s):// URLs, so that clients uploading the same
+// object at once don't overwrite each other. It is given by lfs.webdav.locking.
+func (c *Configuration) WebdavLocking() bool {
+	return c.Git.Bool("lfs.webdav.locking", true)
+}
+
+// IpfsGateway returns the URL of the IPFS gateway, given by lfs.ipfs.gateway,
+// which objects stored at ipfs+http(s):// URLs are downloaded from, such as a
+// public one, or an empty string if they're downloaded from the node itself.
+func (c *Configuration) IpfsGateway() string {
+	v, _ := c.Git.Get("lfs.ipfs.gateway")
+	return strings.TrimSuffix(v, "/")
+}
+
+// IpfsPin returns whether objects uploaded to ipfs+http(s):// URLs are pinned
+// on the node, so that its garbage collection keeps them. It is given by
+// lfs.ipfs.pin.
+func (c *Configuration) IpfsPin() bool {
+	return c.Git.Bool("lfs.ipfs.pin", true)
+}
+
+// DefaultPeerPort is the UDP port on which peers are discovered, and the TCP
+// port on which they serve objects, unless lfs.peers.port says otherwise.
+const DefaultPeerPort = 43159
+
+// PeersEnabled returns whether objects are looked for on peers in the local
+// network before they're downloaded from the remote, as lfs.peers.enabled
+// opts in to.
+func (c *Configuration) PeersEnabled() bool {
+	return c.Git.Bool("lfs.peers.enabled", false)
+}
+
+// PeerPort returns the port on which peers are discovered and serve objects,
+// given by lfs.peers.port.
+func (c *Configuration) PeerPort() int {
+	port := c.Git.Int("lfs.peers.port", DefaultPeerPort)
+	if port < 1 || port > 65535 {
+		fmt.Fprintf(os.Stderr, "WARNING: Invalid lfs.peers.port %d, using %d\n", port, DefaultPeerPort)
+		return DefaultPeerPort
+	}
+	return port
+}
+
+// PeerSecret returns the secret shared by the peers which serve objects to each
+// other, given by lfs.peers.secret, so that other clients in the local network
+// are neither found nor served.
+func (c *Configuration) PeerSecret() string {
+	v, _ := c.Git.Get("lfs.peers.secret")
+	return v
+}
+
+// PeerAddresses returns the "host[:port]" addresses of peers which are asked
+// directly, besides those found by broadcast, as given by the multi-valued
+// lfs.peers.address, for networks which don't carry broadcasts.
+func (c *Configuration) PeerAddresses() []string {
+	return c.Git.GetAll("lfs.peers.address")
+}
+
+// PeerDiscoveryTimeout returns how long peers are waited for to answer when
+// they're looked for, given in milliseconds by lfs.peers.timeout.
+func (c *Configuration) PeerDiscoveryTimeout() time.Duration {
+	ms := c.Git.Int("lfs.peers.timeout", 300)
+	if ms < 1 {
+		ms = 300
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// ProvenanceEnabled returns whether files cleaned into pointers are given
+// provenance keys recording who cleaned them, when and with what tool, as
+// lfs.provenance.enabled opts in to.
+func (c *Configuration) ProvenanceEnabled() bool {
+	return c.Git.Bool("lfs.provenance.enabled", false)
+}
+
+// WorktreeChecksums returns whether the objects of the working tree files
+// written by checkouts are recorded with their stat info, so that status
+// needn't report files which are unchanged since as modified, as
+// lfs.worktreechecksums opts in to.
+func (c *Configuration) WorktreeChecksums() bool {
+	return c.Git.Bool("lfs.worktreechecksums", false)
+}
+
+// ProvenanceTool returns the tool recorded as having cleaned files, given by
+// lfs.provenance.tool, or Git LFS and its version by default.
+func (c *Configuration) ProvenanceTool() string {
+	if v, ok := c.Git.Get("lfs.provenance.tool"); ok && len(v) > 0 {
+		return v
+	}
+	return "git-lfs/" + Version
+}
+
+// The modes in which Git LFS can write files to the working tree, as given by
+// lfs.checkoutmode.
+const (
+	CheckoutCopy     = "copy"
+	CheckoutHardlink = "hardlink"
+	CheckoutReflink  = "reflink"
+)
+
+// CheckoutMode returns how "git lfs checkout" and "git lfs pull" write files to
+// the working tree: by copying their objects, or by hard linking or reflinking
+// them where possible. It is given by lfs.checkoutmode, and is CheckoutCopy by
+// default or if the mode is unknown.
+func (c *Configuration) CheckoutMode() string {
+	mode, ok := c.Git.Get("lfs.checkoutmode")
+	if !ok {
+		return CheckoutCopy
+	}
+
+	switch mode = strings.ToLower(mode); mode {
+	case CheckoutCopy, CheckoutHardlink, CheckoutReflink:
+		return mode
+	}
+
+	fmt.Fprintf(os.Stderr, "WARNING: Unknown lfs.checkoutmode %q, copying files instead\n", mode)
+	return CheckoutCopy
+}
+
+// The ways in which Git LFS can leave the file of an object which couldn't be
+// downloaded, as given by lfs.missingobjectpolicy.
+const (
+	MissingObjectPointer     = "pointer"
+	MissingObjectPlaceholder = "placeholder"
+	MissingObjectFail        = "fail"
+)
+
+// MissingObjectPolicy returns what the smudge filter, "git lfs checkout" and
+// "git lfs pull" do with the file of an object which couldn't be downloaded:
+// leave it a pointer, mark it as a placeholder, or fail. It is given by
+// lfs.missingobjectpolicy, and is MissingObjectPointer by default if
+// lfs.skipdownloaderrors is set, and MissingObjectFail otherwise, or if the
+// policy is unknown.
+func (c *Configuration) MissingObjectPolicy() string {
+	fallback := MissingObjectFail
+	if c.SkipDownloadErrors() {
+		fallback = MissingObjectPointer
+	}
+
+	policy, ok := c.Git.Get("lfs.missingobjectpolicy")
+	if !ok {
+		return fallback
+	}
+
+	switch policy = strings.ToLower(policy); policy {
+	case MissingObjectPointer, MissingObjectPlaceholder, MissingObjectFail:
+		return policy
+	}
+
+	fmt.Fprintf(os.Stderr, "WARNING: Unknown lfs.missingobjectpolicy %q, using %q instead\n", policy, fallback)
+	return fallback
+}
+
+// The ways in which Git LFS can read git objects when scanning for pointers, as
+// given by lfs.scannerbackend.
+const (
+	ScannerBackendGit    = "git"
+	ScannerBackendNative = "native"
+)
+
+// ScannerBackend returns how scans for pointers read git objects: by running
+// "git cat-file", or by reading the object database in-process. It is given by
+// lfs.scannerbackend, and is ScannerBackendGit by default or if the backend is
+// unknown.
+func (c *Configuration) ScannerBackend() string {
+	backend, ok := c.Git.Get("lfs.scannerbackend")
+	if !ok {
+		return ScannerBackendGit
+	}
+
+	switch backend = strings.ToLower(backend); backend {
+	case ScannerBackendGit, ScannerBackendNative:
+		return backend
+	}
+
+	fmt.Fprintf(os.Stderr, "WARNING: Unknown lfs.scannerbackend %q, using git instead\n", backend)
+	return ScannerBackendGit
+}
+
+// The ways in which Git LFS can compress the objects it stores locally, as
+// given by lfs.storagecompression.
+const (
+	StorageCompressionNone = "none"
+	StorageCompressionZstd = "zstd"
+)
+
+// defaultStorageCompressionExcludes lists the extensions of files in formats
+// which are compressed already, whose objects aren't worth compressing again.
+var defaultStorageCompressionExcludes = []string{
+	"7z", "avi", "bz2", "docx", "flac", "gif", "gz", "jar", "jpeg", "jpg",
+	"mkv", "mov", "mp3", "mp4", "ogg", "png", "pptx", "rar", "tgz", "webm",
+	"webp", "xlsx", "xz", "zip", "zst",
+}
+
+// StorageCompression returns how new objects are compressed in the local
+// object store, trading the time taken to compress and decompress them for
+// disk space. It is given by lfs.storagecompression, and is
+// StorageCompressionNone by default or if the compression is unknown.
+func (c *Configuration) StorageCompression() string {
+	compression, ok := c.Git.Get("lfs.storagecompression")
+	if !ok {
+		return StorageCompressionNone
+	}
+
+	switch compression = strings.ToLower(compression); compression {
+	case StorageCompressionNone, StorageCompressionZstd:
+		return compression
+	}
+
+	fmt.Fprintf(os.Stderr, "WARNING: Unknown lfs.storagecompression %q, storing objects uncompressed\n", compression)
+	return StorageCompressionNone
+}
+
+// StorageCompressionExcluded returns whether the object of the file with the
+// given name is stored uncompressed whatever lfs.storagecompression says, as
+// its extension is one of those listed in lfs.storagecompression.exclude, or of
+// the common compressed formats by default.
+func (c *Configuration) StorageCompressionExcluded(name string) bool {
+	excludes := defaultStorageCompressionExcludes
+	if v, ok := c.Git.Get("lfs.storagecompression.exclude"); ok {
+		excludes = tools.CleanPaths(v, ",")
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	if len(ext) == 0 {
+		return false
+	}
+	for _, exclude := range excludes {
+		if strings.ToLower(strings.TrimPrefix(exclude, ".")) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// AlternateObjectDirs returns the Git LFS object directories of other
+// repositories on this machine, such as "/path/to/other/.git/lfs/objects",
+// given by the multi-valued lfs.alternate. Their objects are used instead of
+// downloading them, as Git uses the object directories listed in
+// .git/objects/info/alternates, and are never written to.
+func (c *Configuration) AlternateObjectDirs() []string {
+	return c.Git.GetAll("lfs.alternate")
+}
+
+// StorageLimit returns the size in bytes, given by lfs.storagelimit, under
+// which "git lfs prune" keeps the local object store by evicting the least
+// recently used objects it can fetch again. It is 0 if there is no limit or the
+// limit is invalid.
+func (c *Configuration) StorageLimit() int64 {
+	v, ok := c.Git.Get("lfs.storagelimit")
+	if !ok {
+		return 0
+	}
+
+	limit, err := ParseSize(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: Invalid lfs.storagelimit %q, ignoring it\n", v)
+		return 0
+	}
+	return limit
+}
+
 // loadGitConfig is a temporary measure to support legacy behavior dependent on
 // accessing properties set by ReadGitConfig, namely:
 //  - `c.extensions`
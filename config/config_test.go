@@ -141,6 +141,84 @@ func TestEndpointGlobalSeparateLfsPush(t *testing.T) {
 	assert.Equal(t, "", endpoint.SshPath)
 }
 
+func TestEndpointGlobalSeparateLfsPull(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.url":     "https://write.com/foo/bar",
+			"lfs.pullurl": "https://cdn.com/foo/bar",
+		},
+	})
+
+	assert.Equal(t, "https://cdn.com/foo/bar", cfg.Endpoint("download").Url)
+	assert.Equal(t, "https://write.com/foo/bar", cfg.Endpoint("upload").Url)
+}
+
+func TestEndpointSeparateRemoteLfsPullAndPush(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"remote.origin.url":        "https://example.com/foo/bar.git",
+			"remote.origin.lfspullurl": "https://cdn.com/foo/bar",
+			"remote.origin.lfspushurl": "https://write.com/foo/bar",
+		},
+	})
+
+	assert.Equal(t, "https://cdn.com/foo/bar", cfg.Endpoint("download").Url)
+	assert.Equal(t, "https://write.com/foo/bar", cfg.Endpoint("upload").Url)
+}
+
+func TestEndpointPerRefPullOverride(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.url":                          "https://default.com/foo/bar",
+			"lfs.pullurl":                      "https://cdn.com/foo/bar",
+			"lfs.refs/heads/release/*.url":     "https://release.com/foo/bar",
+			"lfs.refs/heads/release/*.pullurl": "https://cdn.release.com/foo/bar",
+		},
+	})
+
+	for ref, expected := range map[string][2]string{
+		"refs/heads/master":      {"https://cdn.com/foo/bar", "https://default.com/foo/bar"},
+		"refs/heads/release/1.0": {"https://cdn.release.com/foo/bar", "https://release.com/foo/bar"},
+	} {
+		cfg.CurrentRemote = "origin"
+		cfg.CurrentRef = ref
+
+		assert.Equal(t, expected[0], cfg.Endpoint("download").Url, ref)
+		assert.Equal(t, expected[1], cfg.Endpoint("upload").Url, ref)
+	}
+}
+
+func TestEndpointPerRefOverrides(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.url":                             "https://default.com/foo/bar",
+			"lfs.refs/heads/release/*.url":        "https://release.com/foo/bar",
+			"lfs.refs/heads/release/*.pushurl":    "https://write.release.com/foo/bar",
+			"lfs.refs/heads/release/legacy-*.url": "https://legacy.com/foo/bar",
+			"lfs.refs/tags/v?.0.url":              "https://tags.com/foo/bar",
+			"remote.origin.lfsurl":                "https://origin.com/foo/bar",
+			"lfs.refs/heads/release/1.0.access":   "basic",
+		},
+	})
+
+	for ref, expected := range map[string][2]string{
+		"refs/heads/master":                 {"https://default.com/foo/bar", "https://default.com/foo/bar"},
+		"refs/heads/release/1.0":            {"https://release.com/foo/bar", "https://write.release.com/foo/bar"},
+		"refs/heads/release/1.0/hotfix":     {"https://release.com/foo/bar", "https://write.release.com/foo/bar"},
+		"refs/heads/release/legacy-2":       {"https://legacy.com/foo/bar", "https://write.release.com/foo/bar"},
+		"refs/remotes/origin/release/1.0":   {"https://release.com/foo/bar", "https://write.release.com/foo/bar"},
+		"refs/remotes/upstream/release/1.0": {"https://default.com/foo/bar", "https://default.com/foo/bar"},
+		"refs/tags/v1.0":                    {"https://tags.com/foo/bar", "https://tags.com/foo/bar"},
+		"refs/tags/v1.0.1":                  {"https://default.com/foo/bar", "https://default.com/foo/bar"},
+	} {
+		cfg.CurrentRemote = "origin"
+		cfg.CurrentRef = ref
+
+		assert.Equal(t, expected[0], cfg.Endpoint("download").Url, ref)
+		assert.Equal(t, expected[1], cfg.Endpoint("upload").Url, ref)
+	}
+}
+
 func TestSSHEndpointOverridden(t *testing.T) {
 	cfg := NewFrom(Values{
 		Git: map[string]string{
@@ -488,10 +566,10 @@ func TestLoadValidExtension(t *testing.T) {
 
 	cfg.extensions = map[string]Extension{
 		"foo": Extension{
-			"foo",
-			"foo-clean %f",
-			"foo-smudge %f",
-			2,
+			Name:     "foo",
+			Clean:    "foo-clean %f",
+			Smudge:   "foo-smudge %f",
+			Priority: 2,
 		},
 	}
 
@@ -513,6 +591,169 @@ func TestLoadInvalidExtension(t *testing.T) {
 	assert.Equal(t, 0, ext.Priority)
 }
 
+func TestOffline(t *testing.T) {
+	assert.False(t, NewFrom(Values{}).Offline())
+	assert.True(t, NewFrom(Values{Git: map[string]string{"lfs.offline": "true"}}).Offline())
+	assert.True(t, NewFrom(Values{Os: map[string]string{"GIT_LFS_OFFLINE": "1"}}).Offline())
+	assert.False(t, NewFrom(Values{Git: map[string]string{"lfs.offline": "false"}}).Offline())
+}
+
+func TestPushLater(t *testing.T) {
+	assert.False(t, NewFrom(Values{}).PushLater())
+	assert.True(t, NewFrom(Values{Git: map[string]string{"lfs.pushlater": "true"}}).PushLater())
+	assert.True(t, NewFrom(Values{Os: map[string]string{"GIT_LFS_PUSH_LATER": "1"}}).PushLater())
+}
+
+func TestAutoPush(t *testing.T) {
+	assert.False(t, NewFrom(Values{}).AutoPush())
+	assert.True(t, NewFrom(Values{Git: map[string]string{"lfs.autopush": "true"}}).AutoPush())
+	assert.True(t, NewFrom(Values{Os: map[string]string{"GIT_LFS_AUTOPUSH": "1"}}).AutoPush())
+}
+
+func TestAutoGC(t *testing.T) {
+	cfg := NewFrom(Values{})
+	assert.False(t, cfg.AutoGC())
+	assert.Equal(t, 1, cfg.AutoGCIntervalDays())
+
+	cfg = NewFrom(Values{Git: map[string]string{
+		"lfs.autogc":             "true",
+		"lfs.autogcintervaldays": "7",
+	}})
+	assert.True(t, cfg.AutoGC())
+	assert.Equal(t, 7, cfg.AutoGCIntervalDays())
+}
+
+func TestMaintenanceTasks(t *testing.T) {
+	cfg := NewFrom(Values{})
+	assert.True(t, cfg.MaintenanceTaskEnabled("prune"))
+	assert.Equal(t, MaintenanceDaily, cfg.MaintenanceTaskSchedule("prune", MaintenanceDaily))
+
+	cfg = NewFrom(Values{Git: map[string]string{
+		"lfs.maintenance.prune.enabled":     "false",
+		"lfs.maintenance.prune.schedule":    "Weekly",
+		"lfs.maintenance.prefetch.schedule": "monthly",
+	}})
+	assert.False(t, cfg.MaintenanceTaskEnabled("prune"))
+	assert.True(t, cfg.MaintenanceTaskEnabled("verify"))
+	assert.Equal(t, MaintenanceWeekly, cfg.MaintenanceTaskSchedule("prune", MaintenanceDaily))
+	assert.Equal(t, MaintenanceHourly, cfg.MaintenanceTaskSchedule("prefetch", MaintenanceHourly))
+}
+
+func TestChunkStore(t *testing.T) {
+	assert.False(t, NewFrom(Values{}).ChunkStore())
+	assert.True(t, NewFrom(Values{Git: map[string]string{"lfs.chunkstore": "true"}}).ChunkStore())
+}
+
+func TestStorageCompression(t *testing.T) {
+	assert.Equal(t, StorageCompressionNone, NewFrom(Values{}).StorageCompression())
+	assert.Equal(t, StorageCompressionZstd, NewFrom(Values{Git: map[string]string{"lfs.storagecompression": "ZSTD"}}).StorageCompression())
+	assert.Equal(t, StorageCompressionNone, NewFrom(Values{Git: map[string]string{"lfs.storagecompression": "lzma"}}).StorageCompression())
+}
+
+func TestStorageCompressionExcluded(t *testing.T) {
+	cfg := NewFrom(Values{})
+	assert.True(t, cfg.StorageCompressionExcluded("images/photo.JPG"))
+	assert.True(t, cfg.StorageCompressionExcluded("dist/build.tar.gz"))
+	assert.False(t, cfg.StorageCompressionExcluded("data/model.bin"))
+	assert.False(t, cfg.StorageCompressionExcluded("README"))
+
+	cfg = NewFrom(Values{Git: map[string]string{"lfs.storagecompression.exclude": ".bin, psd"}})
+	assert.True(t, cfg.StorageCompressionExcluded("data/model.bin"))
+	assert.True(t, cfg.StorageCompressionExcluded("art/cover.psd"))
+	assert.False(t, cfg.StorageCompressionExcluded("images/photo.jpg"))
+}
+
+func TestCacheCredentials(t *testing.T) {
+	assert.True(t, NewFrom(Values{}).CacheCredentials())
+	assert.False(t, NewFrom(Values{Git: map[string]string{"lfs.cachecredentials": "false"}}).CacheCredentials())
+}
+
+func TestCredentialCacheTimeout(t *testing.T) {
+	assert.Equal(t, 0, NewFrom(Values{}).CredentialCacheTimeout())
+	assert.Equal(t, 900, NewFrom(Values{Git: map[string]string{"lfs.credentialcachetimeout": "900"}}).CredentialCacheTimeout())
+	assert.Equal(t, 0, NewFrom(Values{Git: map[string]string{"lfs.credentialcachetimeout": "-1"}}).CredentialCacheTimeout())
+}
+
+func TestCheckoutMode(t *testing.T) {
+	for value, expected := range map[string]string{
+		"":         CheckoutCopy,
+		"copy":     CheckoutCopy,
+		"hardlink": CheckoutHardlink,
+		"Reflink":  CheckoutReflink,
+		"bogus":    CheckoutCopy,
+	} {
+		git := map[string]string{}
+		if len(value) > 0 {
+			git["lfs.checkoutmode"] = value
+		}
+
+		cfg := NewFrom(Values{Git: git})
+		assert.Equal(t, expected, cfg.CheckoutMode(), "lfs.checkoutmode=%q", value)
+	}
+}
+
+func TestMissingObjectPolicy(t *testing.T) {
+	for _, c := range []struct {
+		value         string
+		skipDownloads bool
+		expected      string
+	}{
+		{"", false, MissingObjectFail},
+		{"", true, MissingObjectPointer},
+		{"Placeholder", false, MissingObjectPlaceholder},
+		{"pointer", false, MissingObjectPointer},
+		{"fail", true, MissingObjectFail},
+		{"bogus", false, MissingObjectFail},
+		{"bogus", true, MissingObjectPointer},
+	} {
+		git := map[string]string{}
+		if len(c.value) > 0 {
+			git["lfs.missingobjectpolicy"] = c.value
+		}
+		if c.skipDownloads {
+			git["lfs.skipdownloaderrors"] = "true"
+		}
+
+		cfg := NewFrom(Values{Git: git})
+		assert.Equal(t, c.expected, cfg.MissingObjectPolicy(), "lfs.missingobjectpolicy=%q", c.value)
+	}
+}
+
+func TestScannerBackend(t *testing.T) {
+	for value, expected := range map[string]string{
+		"":       ScannerBackendGit,
+		"git":    ScannerBackendGit,
+		"Native": ScannerBackendNative,
+		"bogus":  ScannerBackendGit,
+	} {
+		git := map[string]string{}
+		if len(value) > 0 {
+			git["lfs.scannerbackend"] = value
+		}
+
+		cfg := NewFrom(Values{Git: git})
+		assert.Equal(t, expected, cfg.ScannerBackend(), "lfs.scannerbackend=%q", value)
+	}
+}
+
+func TestStorageLimit(t *testing.T) {
+	for value, expected := range map[string]int64{
+		"":      0,
+		"500":   500,
+		"10m":   10 << 20,
+		"2G":    2 << 30,
+		"bogus": 0,
+	} {
+		git := map[string]string{}
+		if len(value) > 0 {
+			git["lfs.storagelimit"] = value
+		}
+
+		cfg := NewFrom(Values{Git: git})
+		assert.Equal(t, expected, cfg.StorageLimit(), "lfs.storagelimit=%q", value)
+	}
+}
+
 func TestFetchPruneConfigDefault(t *testing.T) {
 	cfg := NewFrom(Values{})
 	fp := cfg.FetchPruneConfig()
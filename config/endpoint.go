@@ -10,6 +10,32 @@ import (
 
 const EndpointUrlUnknown = "<unknown>"
 
+// RsyncScheme is the scheme of the URLs of directories on SSH hosts which
+// objects are transferred to and from with rsync, for hosts which don't run a
+// Git LFS server:
+//
+//   rsync+ssh://user@host:port/path/to/objects
+//
+const RsyncScheme = "rsync+ssh"
+
+// WebdavSchemePrefix starts the schemes of the URLs of collections on WebDAV
+// shares, such as those of Nextcloud or ownCloud, which objects are stored in
+// by hosts which don't run a Git LFS server:
+//
+//   webdav+https://user@host/remote.php/dav/files/user/lfs
+//
+// The rest of the scheme, "http" or "https", is that the share is reached by.
+const WebdavSchemePrefix = "webdav+"
+
+// IpfsSchemePrefix starts the schemes of the URLs of the RPC APIs of IPFS
+// nodes, such as those of a private cluster, which objects are stored in by
+// their content identifiers rather than on a Git LFS server:
+//
+//   ipfs+http://127.0.0.1:5001
+//
+// The rest of the scheme, "http" or "https", is that the API is reached by.
+const IpfsSchemePrefix = "ipfs+"
+
 // An Endpoint describes how to access a Git LFS server.
 type Endpoint struct {
 	Url            string
@@ -66,6 +92,11 @@ func NewEndpointWithConfig(rawurl string, c *Configuration) Endpoint {
 		return endpointFromHttpUrl(u)
 	case "git":
 		return endpointFromGitUrl(u, c)
+	case RsyncScheme:
+		return endpointFromRsyncUrl(u)
+	case WebdavSchemePrefix + "http", WebdavSchemePrefix + "https",
+		IpfsSchemePrefix + "http", IpfsSchemePrefix + "https":
+		return endpointFromHttpUrl(u)
 	case "":
 		return endpointFromBareSshUrl(u.String())
 	default:
@@ -139,6 +170,61 @@ func endpointFromSshUrl(u *url.URL) Endpoint {
 	return endpoint
 }
 
+// endpointFromRsyncUrl constructs a new endpoint from an rsync+ssh:// URL. The
+// URL is kept as it is, with the host, port and path pulled out for rsync. As
+// with Git's ssh:// URLs, a path starting with "/~/" is relative to the home
+// directory of the user on the host. Users and hosts starting with "-" are
+// rejected, as ssh would take them for options.
+func endpointFromRsyncUrl(u *url.URL) Endpoint {
+	endpoint := endpointFromSshUrl(u)
+	if endpoint.Url == EndpointUrlUnknown {
+		return endpoint
+	}
+	if strings.HasPrefix(endpoint.SshUserAndHost, "-") || strings.Contains(endpoint.SshUserAndHost, "@-") {
+		return Endpoint{Url: EndpointUrlUnknown}
+	}
+
+	endpoint.Url = u.String()
+	if strings.HasPrefix(u.Path, "/~/") {
+		endpoint.SshPath = u.Path[3:]
+	} else {
+		endpoint.SshPath = u.Path
+	}
+	return endpoint
+}
+
+// IsRsync returns whether the endpoint is a directory on an SSH host which
+// objects are transferred to and from with rsync, rather than a Git LFS server.
+func (e Endpoint) IsRsync() bool {
+	return strings.HasPrefix(e.Url, RsyncScheme+"://")
+}
+
+// IsWebdav returns whether the endpoint is a collection on a WebDAV share which
+// objects are stored in, rather than a Git LFS server.
+func (e Endpoint) IsWebdav() bool {
+	return strings.HasPrefix(e.Url, WebdavSchemePrefix+"http://") ||
+		strings.HasPrefix(e.Url, WebdavSchemePrefix+"https://")
+}
+
+// WebdavUrl returns the http(s):// URL of the WebDAV collection of the
+// endpoint, which must be a WebDAV endpoint.
+func (e Endpoint) WebdavUrl() string {
+	return strings.TrimPrefix(e.Url, WebdavSchemePrefix)
+}
+
+// IsIpfs returns whether the endpoint is the RPC API of an IPFS node which
+// objects are stored in, rather than a Git LFS server.
+func (e Endpoint) IsIpfs() bool {
+	return strings.HasPrefix(e.Url, IpfsSchemePrefix+"http://") ||
+		strings.HasPrefix(e.Url, IpfsSchemePrefix+"https://")
+}
+
+// IpfsUrl returns the http(s):// URL of the IPFS RPC API of the endpoint, which
+// must be an IPFS endpoint.
+func (e Endpoint) IpfsUrl() string {
+	return strings.TrimPrefix(e.Url, IpfsSchemePrefix)
+}
+
 // Construct a new endpoint from a HTTP URL
 func endpointFromHttpUrl(u *url.URL) Endpoint {
 	// just pass this straight through
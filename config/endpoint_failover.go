@@ -0,0 +1,199 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rubyist/tracerx"
+)
+
+// endpointProbeTimeout is how long a probe of an unreachable endpoint waits to
+// connect to it.
+const endpointProbeTimeout = 5 * time.Second
+
+// endpointFailure is the form in which an unreachable endpoint is recorded on
+// disk, so that other Git LFS processes don't try it again until it has been
+// probed.
+type endpointFailure struct {
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// MirrorUrls returns the URLs of the mirrors of the LFS server, which objects
+// are downloaded from in order when it is unreachable: those given by the
+// current remote's lfsmirrorurl, or otherwise by lfs.mirrorurl. Mirrors are
+// read-only, so uploads and locks always go to the server itself.
+func (c *Configuration) MirrorUrls() []string {
+	if len(c.CurrentRemote) > 0 {
+		if urls := c.Git.GetAll("remote." + c.CurrentRemote + ".lfsmirrorurl"); len(urls) > 0 {
+			return urls
+		}
+	}
+	return c.Git.GetAll("lfs.mirrorurl")
+}
+
+// FailOver marks the current endpoint for the given operation as unreachable,
+// and returns whether there is a different one to use instead. Only downloads
+// fail over.
+func (c *Configuration) FailOver(operation string) bool {
+	failed := c.Endpoint(operation).Url
+	if operation != "download" || len(c.MirrorUrls()) == 0 {
+		return false
+	}
+
+	tracerx.Printf("endpoint: %s is unreachable", failed)
+	c.setEndpointReachable(failed, false)
+	recordEndpointFailure(failed)
+
+	if next := c.Endpoint(operation).Url; next != failed {
+		tracerx.Printf("endpoint: failing over from %s to %s", failed, next)
+		return true
+	}
+	return false
+}
+
+// AvoidEndpoint stops using the current endpoint for the given operation for
+// the rest of this process, such as when it served corrupt objects, and returns
+// whether there is a different one to use instead. Unlike FailOver, it doesn't
+// record the endpoint as unreachable for other processes.
+func (c *Configuration) AvoidEndpoint(operation string) bool {
+	avoided := c.Endpoint(operation).Url
+	if len(c.MirrorUrls()) == 0 {
+		return false
+	}
+
+	c.setEndpointReachable(avoided, false)
+
+	if next := c.Endpoint(operation).Url; next != avoided {
+		tracerx.Printf("endpoint: switching from %s to %s", avoided, next)
+		return true
+	}
+	return false
+}
+
+// failoverEndpoint returns the endpoint to use in place of primary for the
+// given operation: primary itself if it is reachable, or if the operation isn't
+// a download, otherwise the first reachable mirror. If none are reachable,
+// primary is returned.
+func (c *Configuration) failoverEndpoint(operation string, primary Endpoint) Endpoint {
+	if operation != "download" {
+		return primary
+	}
+
+	mirrors := c.MirrorUrls()
+	if len(mirrors) == 0 || primary.Url == EndpointUrlUnknown || c.endpointReachable(primary.Url) {
+		return primary
+	}
+
+	for _, mirror := range mirrors {
+		if c.endpointReachable(mirror) {
+			return NewEndpointWithConfig(mirror, c)
+		}
+	}
+	return primary
+}
+
+// endpointReachable returns whether requests should be made to the endpoint
+// with the given URL. Once known, the answer doesn't change for the rest of the
+// process unless the endpoint is found to be unreachable, so that it isn't
+// switched midway through a transfer.
+//
+// An endpoint is reachable unless it has been recorded as unreachable. After
+// lfs.failoverprobeinterval seconds, it is probed by connecting to it, and if
+// that succeeds, it is used again.
+func (c *Configuration) endpointReachable(rawurl string) bool {
+	c.endpointMu.Lock()
+	reachable, ok := c.endpointReachability[rawurl]
+	c.endpointMu.Unlock()
+	if ok {
+		return reachable
+	}
+
+	reachable = true
+	var failure endpointFailure
+	if by, err := ioutil.ReadFile(endpointFailurePath(rawurl)); err == nil && json.Unmarshal(by, &failure) == nil {
+		interval := time.Duration(c.Git.Int("lfs.failoverprobeinterval", 300)) * time.Second
+		if time.Since(failure.FailedAt) < interval {
+			reachable = false
+		} else if err := probeEndpoint(rawurl); err != nil {
+			tracerx.Printf("endpoint: %s is still unreachable: %s", rawurl, err)
+			reachable = false
+			recordEndpointFailure(rawurl)
+		} else {
+			tracerx.Printf("endpoint: %s is reachable again", rawurl)
+			os.Remove(endpointFailurePath(rawurl))
+		}
+	}
+
+	c.setEndpointReachable(rawurl, reachable)
+	return reachable
+}
+
+// setEndpointReachable records whether the endpoint with the given URL is
+// reachable for the rest of this process.
+func (c *Configuration) setEndpointReachable(rawurl string, reachable bool) {
+	c.endpointMu.Lock()
+	defer c.endpointMu.Unlock()
+
+	if c.endpointReachability == nil {
+		c.endpointReachability = make(map[string]bool)
+	}
+	c.endpointReachability[rawurl] = reachable
+}
+
+// recordEndpointFailure records on disk that the endpoint with the given URL
+// was found to be unreachable now.
+func recordEndpointFailure(rawurl string) {
+	cachePath := endpointFailurePath(rawurl)
+	if len(cachePath) == 0 {
+		return
+	}
+
+	if by, err := json.Marshal(endpointFailure{FailedAt: time.Now()}); err == nil {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+			ioutil.WriteFile(cachePath, by, 0644)
+		}
+	}
+}
+
+// endpointFailurePath returns the path at which the given endpoint is recorded
+// as unreachable, or "" outside of a repository.
+func endpointFailurePath(rawurl string) string {
+	if len(LocalGitStorageDir) == 0 {
+		return ""
+	}
+
+	key := sha256.Sum256([]byte(rawurl))
+	return filepath.Join(LocalGitStorageDir, "lfs", "cache", "endpoints", hex.EncodeToString(key[:]))
+}
+
+// probeEndpoint returns an error if a connection can't be made to the host of
+// the given URL.
+func probeEndpoint(rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+
+	host := u.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		port := "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+
+	conn, err := net.DialTimeout("tcp", host, endpointProbeTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
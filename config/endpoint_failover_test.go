@@ -0,0 +1,154 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointWithoutMirrors(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.url": "https://primary.com/lfs",
+		},
+	})
+
+	assert.False(t, cfg.FailOver("download"))
+	assert.Equal(t, "https://primary.com/lfs", cfg.Endpoint("download").Url)
+}
+
+func TestEndpointFailsOverToMirrors(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.url":       "https://primary.com/lfs",
+			"lfs.mirrorurl": "https://mirror.com/lfs",
+		},
+	})
+
+	assert.Equal(t, "https://primary.com/lfs", cfg.Endpoint("download").Url)
+
+	assert.True(t, cfg.FailOver("download"))
+	assert.Equal(t, "https://mirror.com/lfs", cfg.Endpoint("download").Url)
+
+	// once every endpoint is unreachable, the primary is used again, but
+	// isn't failed over from.
+	assert.True(t, cfg.FailOver("download"))
+	assert.Equal(t, "https://primary.com/lfs", cfg.Endpoint("download").Url)
+	assert.False(t, cfg.FailOver("download"))
+}
+
+func TestEndpointAvoidedSwitchesToMirror(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.url":       "https://primary.com/lfs",
+			"lfs.mirrorurl": "https://mirror.com/lfs",
+		},
+	})
+
+	assert.True(t, cfg.AvoidEndpoint("download"))
+	assert.Equal(t, "https://mirror.com/lfs", cfg.Endpoint("download").Url)
+
+	without := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.url": "https://primary.com/lfs",
+		},
+	})
+
+	assert.False(t, without.AvoidEndpoint("download"))
+	assert.Equal(t, "https://primary.com/lfs", without.Endpoint("download").Url)
+}
+
+func TestEndpointUploadsDontFailOver(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.url":       "https://primary.com/lfs",
+			"lfs.mirrorurl": "https://mirror.com/lfs",
+		},
+	})
+
+	assert.False(t, cfg.FailOver("upload"))
+	assert.Equal(t, "https://primary.com/lfs", cfg.Endpoint("upload").Url)
+
+	// uploads go to the server even once downloads have failed over.
+	assert.True(t, cfg.FailOver("download"))
+	assert.Equal(t, "https://primary.com/lfs", cfg.Endpoint("upload").Url)
+}
+
+func TestEndpointRemoteMirrorsPrecedence(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"remote.origin.url":          "https://primary.com/repo",
+			"remote.origin.lfsmirrorurl": "https://remote-mirror.com/lfs",
+			"lfs.mirrorurl":              "https://mirror.com/lfs",
+		},
+	})
+	cfg.CurrentRemote = "origin"
+
+	assert.Equal(t, []string{"https://remote-mirror.com/lfs"}, cfg.MirrorUrls())
+	assert.True(t, cfg.FailOver("download"))
+	assert.Equal(t, "https://remote-mirror.com/lfs", cfg.Endpoint("download").Url)
+}
+
+func TestEndpointUnreachableIsSticky(t *testing.T) {
+	dir, err := ioutil.TempDir("", "endpoint-failover")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	oldStorageDir := LocalGitStorageDir
+	LocalGitStorageDir = dir
+	defer func() { LocalGitStorageDir = oldStorageDir }()
+
+	values := Values{
+		Git: map[string]string{
+			"lfs.url":       "https://primary.com/lfs",
+			"lfs.mirrorurl": "https://mirror.com/lfs",
+		},
+	}
+
+	assert.True(t, NewFrom(values).FailOver("download"))
+
+	// other processes use the mirror without trying the primary.
+	assert.Equal(t, "https://mirror.com/lfs", NewFrom(values).Endpoint("download").Url)
+}
+
+func TestEndpointUnreachableIsProbed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "endpoint-failover")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	oldStorageDir := LocalGitStorageDir
+	LocalGitStorageDir = dir
+	defer func() { LocalGitStorageDir = oldStorageDir }()
+
+	primary := srv.URL + "/lfs"
+	by, err := json.Marshal(endpointFailure{FailedAt: time.Now().Add(-time.Hour)})
+	require.Nil(t, err)
+	require.Nil(t, os.MkdirAll(filepath.Dir(endpointFailurePath(primary)), 0755))
+	require.Nil(t, ioutil.WriteFile(endpointFailurePath(primary), by, 0644))
+
+	values := Values{
+		Git: map[string]string{
+			"lfs.url":                   primary,
+			"lfs.mirrorurl":             "https://mirror.com/lfs",
+			"lfs.failoverprobeinterval": "7200",
+		},
+	}
+	assert.Equal(t, "https://mirror.com/lfs", NewFrom(values).Endpoint("download").Url)
+
+	values.Git["lfs.failoverprobeinterval"] = "60"
+	assert.Equal(t, primary, NewFrom(values).Endpoint("download").Url)
+
+	_, err = os.Stat(endpointFailurePath(primary))
+	assert.True(t, os.IsNotExist(err))
+}
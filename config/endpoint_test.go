@@ -21,3 +21,82 @@ func TestNewEndpointFromCloneURLWithConfig(t *testing.T) {
 		}
 	}
 }
+
+func TestNewEndpointFromRsyncURL(t *testing.T) {
+	tests := map[string]Endpoint{
+		"rsync+ssh://git@example.com/srv/lfs": Endpoint{
+			Url:            "rsync+ssh://git@example.com/srv/lfs",
+			SshUserAndHost: "git@example.com",
+			SshPath:        "/srv/lfs",
+		},
+		"rsync+ssh://example.com:2222/~/lfs/objects": Endpoint{
+			Url:            "rsync+ssh://example.com:2222/~/lfs/objects",
+			SshUserAndHost: "example.com",
+			SshPath:        "lfs/objects",
+			SshPort:        "2222",
+		},
+	}
+
+	cfg := New()
+	for rawurl, expected := range tests {
+		e := NewEndpointWithConfig(rawurl, cfg)
+		if e != expected {
+			t.Errorf("%s returned bad endpoint %+v", rawurl, e)
+		}
+		if !e.IsRsync() {
+			t.Errorf("%s is not an rsync endpoint", rawurl)
+		}
+	}
+
+	if NewEndpointWithConfig("ssh://git@example.com/srv/lfs", cfg).IsRsync() {
+		t.Errorf("ssh:// URL is an rsync endpoint")
+	}
+}
+
+func TestNewEndpointFromRsyncURLRejectsOptions(t *testing.T) {
+	cfg := New()
+	for _, rawurl := range []string{
+		"rsync+ssh://git@-oProxyCommand=sh/srv/lfs",
+		"rsync+ssh://-oProxyCommand=sh/srv/lfs",
+		"rsync+ssh://-oProxyCommand=sh@example.com/srv/lfs",
+	} {
+		e := NewEndpointWithConfig(rawurl, cfg)
+		if e.Url != EndpointUrlUnknown || e.IsRsync() {
+			t.Errorf("%s returned endpoint %+v", rawurl, e)
+		}
+	}
+}
+
+func TestNewEndpointFromWebdavURL(t *testing.T) {
+	cfg := New()
+	for rawurl, expected := range map[string]string{
+		"webdav+https://cloud.example.com/remote.php/dav/files/me/lfs": "https://cloud.example.com/remote.php/dav/files/me/lfs",
+		"webdav+http://localhost:8080/lfs/":                            "http://localhost:8080/lfs/",
+	} {
+		e := NewEndpointWithConfig(rawurl, cfg)
+		if e.Url != rawurl {
+			t.Errorf("%s returned bad endpoint %+v", rawurl, e)
+		}
+		if !e.IsWebdav() {
+			t.Errorf("%s is not a WebDAV endpoint", rawurl)
+		}
+		if url := e.WebdavUrl(); url != expected {
+			t.Errorf("%s has WebDAV URL %s, expected %s", rawurl, url, expected)
+		}
+	}
+
+	if NewEndpointWithConfig("https://example.com/lfs", cfg).IsWebdav() {
+		t.Errorf("https:// URL is a WebDAV endpoint")
+	}
+}
+
+func TestNewEndpointFromIpfsURL(t *testing.T) {
+	cfg := New()
+	e := NewEndpointWithConfig("ipfs+http://127.0.0.1:5001", cfg)
+	if e.Url != "ipfs+http://127.0.0.1:5001" || !e.IsIpfs() || e.IsWebdav() {
+		t.Errorf("returned bad endpoint %+v", e)
+	}
+	if url := e.IpfsUrl(); url != "http://127.0.0.1:5001" {
+		t.Errorf("has IPFS URL %s", url)
+	}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"strings"
+)
+
+const envOverridePrefix = "GIT_LFS_"
+
+// envOverrideReserved are environment variables which look like they override
+// a setting, but have their own meaning.
+var envOverrideReserved = []string{
+	"GIT_LFS_PROGRESS",
+}
+
+// envOverrideFetcher is an implementation of the Fetcher type which gives the
+// "GIT_LFS_<NAME>" environment variables precedence over the "lfs.<name>"
+// settings of the Fetcher it wraps, so that they can be changed without
+// modifying any configuration files.
+type envOverrideFetcher struct {
+	// os is the Environment the overrides are read from.
+	os Environment
+	// git is the Fetcher whose values are overridden.
+	git Fetcher
+}
+
+// Get implements the func `Fetcher.Get`, returning the value of the variable
+// overriding key, if it is set.
+func (f *envOverrideFetcher) Get(key string) (val string, ok bool) {
+	if val, ok := f.override(key); ok {
+		return val, true
+	}
+	return f.git.Get(key)
+}
+
+// GetAll implements the func `Fetcher.GetAll`. An overriding variable replaces
+// every value of the key.
+func (f *envOverrideFetcher) GetAll(key string) []string {
+	if val, ok := f.override(key); ok {
+		return []string{val}
+	}
+	return f.git.GetAll(key)
+}
+
+// All implements the func `Fetcher.All`, replacing the values of the keys
+// which are overridden.
+func (f *envOverrideFetcher) All() map[string]string {
+	all := f.git.All()
+	for key := range all {
+		if val, ok := f.override(key); ok {
+			all[key] = val
+		}
+	}
+	return all
+}
+
+func (f *envOverrideFetcher) set(key, value string) {
+	f.git.set(key, value)
+}
+
+func (f *envOverrideFetcher) del(key string) {
+	f.git.del(key)
+}
+
+func (f *envOverrideFetcher) override(key string) (string, bool) {
+	name, ok := EnvOverrideName(key)
+	if !ok || f.os == nil {
+		return "", false
+	}
+	return f.os.Get(name)
+}
+
+// EnvOverrideName returns the name of the environment variable which overrides
+// the given setting, such as "GIT_LFS_CONCURRENTTRANSFERS" for
+// "lfs.concurrenttransfers", and whether it can be overridden. Only settings in
+// the "lfs" section, outside of any subsection, can be.
+func EnvOverrideName(key string) (string, bool) {
+	key = strings.ToLower(key)
+	if !strings.HasPrefix(key, "lfs.") {
+		return "", false
+	}
+
+	name := strings.TrimPrefix(key, "lfs.")
+	if len(name) == 0 {
+		return "", false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return "", false
+		}
+	}
+
+	envName := envOverridePrefix + strings.ToUpper(name)
+	for _, reserved := range envOverrideReserved {
+		if envName == reserved {
+			return "", false
+		}
+	}
+	return envName, true
+}
+
+// EnvOverrideKey returns the setting overridden by the given environment
+// variable, and whether it overrides one. It is the inverse of
+// EnvOverrideName.
+func EnvOverrideKey(name string) (string, bool) {
+	if !strings.HasPrefix(name, envOverridePrefix) {
+		return "", false
+	}
+
+	key := "lfs." + strings.ToLower(strings.TrimPrefix(name, envOverridePrefix))
+	if envName, ok := EnvOverrideName(key); !ok || envName != name {
+		return "", false
+	}
+	return key, true
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvOverrideFetcherOverridesLfsSettings(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.concurrenttransfers":          "3",
+			"lfs.batch":                        "true",
+			"lfs.url":                          "https://git.local/lfs",
+			"lfs.https://git.local/lfs.access": "basic",
+		},
+		Os: map[string]string{
+			"GIT_LFS_CONCURRENTTRANSFERS": "8",
+			"GIT_LFS_BATCH":               "false",
+			"GIT_LFS_FETCHINCLUDE":        "a,b",
+		},
+	})
+
+	assert.Equal(t, 8, cfg.ConcurrentTransfers())
+	assert.False(t, cfg.Git.Bool("lfs.batch", true))
+	assert.Equal(t, []string{"a", "b"}, cfg.FetchIncludePaths())
+	assert.Equal(t, "https://git.local/lfs", cfg.Endpoint("download").Url)
+	assert.Equal(t, "8", cfg.Git.All()["lfs.concurrenttransfers"])
+	assert.Equal(t, []string{"8"}, cfg.Git.GetAll("lfs.ConcurrentTransfers"))
+}
+
+func TestEnvOverrideName(t *testing.T) {
+	for key, expected := range map[string]string{
+		"lfs.concurrenttransfers": "GIT_LFS_CONCURRENTTRANSFERS",
+		"lfs.URL":                 "GIT_LFS_URL",
+		"lfs.https://x.access":    "",
+		"lfs.extension.foo.clean": "",
+		"lfs.":                    "",
+		"lfs.progress":            "",
+		"core.editor":             "",
+	} {
+		name, ok := EnvOverrideName(key)
+		assert.Equal(t, expected, name, key)
+		assert.Equal(t, len(expected) > 0, ok, key)
+	}
+}
+
+func TestEnvOverrideKey(t *testing.T) {
+	for name, expected := range map[string]string{
+		"GIT_LFS_CONCURRENTTRANSFERS": "lfs.concurrenttransfers",
+		"GIT_LFS_PUSHURL":             "lfs.pushurl",
+		"GIT_LFS_SKIP_SMUDGE":         "",
+		"GIT_LFS_PROGRESS":            "",
+		"GIT_LFS_pushurl":             "",
+		"GIT_TRACE":                   "",
+	} {
+		key, ok := EnvOverrideKey(name)
+		assert.Equal(t, expected, key, name)
+		assert.Equal(t, len(expected) > 0, ok, name)
+	}
+}
@@ -15,6 +15,9 @@ type Environment interface {
 	// Get is shorthand for calling `e.Fetcher.Get(key)`.
 	Get(key string) (val string, ok bool)
 
+	// GetAll is shorthand for calling `e.Fetcher.GetAll(key)`.
+	GetAll(key string) []string
+
 	// Bool returns the boolean state associated with a given key, or the
 	// value "def", if no value was associated.
 	//
@@ -61,8 +64,17 @@ func (e *environment) Get(key string) (val string, ok bool) {
 	return e.Fetcher.Get(key)
 }
 
+func (e *environment) GetAll(key string) []string {
+	return e.Fetcher.GetAll(key)
+}
+
 func (e *environment) Bool(key string, def bool) (val bool) {
 	s, _ := e.Fetcher.Get(key)
+	return parseBool(s, def)
+}
+
+// parseBool parses a boolean value as Git does, returning def if it is empty.
+func parseBool(s string, def bool) bool {
 	if len(s) == 0 {
 		return def
 	}
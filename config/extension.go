@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
 	"sort"
+
+	"github.com/git-lfs/git-lfs/filepathfilter"
 )
 
 // An Extension describes how to manipulate files during smudge and clean.
@@ -12,6 +15,21 @@ type Extension struct {
 	Clean    string
 	Smudge   string
 	Priority int
+	// Patterns are the paths of the files which the extension cleans, as
+	// for lfs.fetchinclude. If there are none, it cleans every file.
+	Patterns []string
+	// Optional is whether a file is cleaned without the extension, rather
+	// than not at all, if the extension fails to clean it.
+	Optional bool
+}
+
+// Applies returns whether the extension cleans the file with the given path,
+// relative to the root of the repository.
+func (e *Extension) Applies(filename string) bool {
+	if len(e.Patterns) == 0 {
+		return true
+	}
+	return filepathfilter.New(e.Patterns, nil).Allows(filepath.FromSlash(filename))
 }
 
 // SortExtensions sorts a map of extensions in ascending order by Priority
@@ -9,22 +9,22 @@ import (
 func TestSortExtensions(t *testing.T) {
 	m := map[string]Extension{
 		"baz": Extension{
-			"baz",
-			"baz-clean %f",
-			"baz-smudge %f",
-			2,
+			Name:     "baz",
+			Clean:    "baz-clean %f",
+			Smudge:   "baz-smudge %f",
+			Priority: 2,
 		},
 		"foo": Extension{
-			"foo",
-			"foo-clean %f",
-			"foo-smudge %f",
-			0,
+			Name:     "foo",
+			Clean:    "foo-clean %f",
+			Smudge:   "foo-smudge %f",
+			Priority: 0,
 		},
 		"bar": Extension{
-			"bar",
-			"bar-clean %f",
-			"bar-smudge %f",
-			1,
+			Name:     "bar",
+			Clean:    "bar-clean %f",
+			Smudge:   "bar-smudge %f",
+			Priority: 1,
 		},
 	}
 
@@ -46,16 +46,16 @@ func TestSortExtensions(t *testing.T) {
 func TestSortExtensionsDuplicatePriority(t *testing.T) {
 	m := map[string]Extension{
 		"foo": Extension{
-			"foo",
-			"foo-clean %f",
-			"foo-smudge %f",
-			0,
+			Name:     "foo",
+			Clean:    "foo-clean %f",
+			Smudge:   "foo-smudge %f",
+			Priority: 0,
 		},
 		"bar": Extension{
-			"bar",
-			"bar-clean %f",
-			"bar-smudge %f",
-			0,
+			Name:     "bar",
+			Clean:    "bar-clean %f",
+			Smudge:   "bar-smudge %f",
+			Priority: 0,
 		},
 	}
 
@@ -8,6 +8,10 @@ type Fetcher interface {
 	// determining if the key exists.
 	Get(key string) (val string, ok bool)
 
+	// GetAll returns every string value associated with a given key, for
+	// keys which may be given more than once, or nil if there are none.
+	GetAll(key string) []string
+
 	// All returns a copy of all the key/value pairs for the current environment.
 	All() map[string]string
 
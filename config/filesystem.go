@@ -42,16 +42,50 @@ func ResolveGitBasicDirs() {
 	}
 }
 
+// resolveReferenceDir returns the Git LFS object directory of the repository
+// whose Git objects the repository with the given storage dir borrows, as it
+// does when it was cloned with --reference: the first of those listed in its
+// objects/info/alternates which has one.
 func resolveReferenceDir(gitStorageDir string) string {
-	cloneReferencePath := filepath.Join(gitStorageDir, "objects", "info", "alternates")
-	if tools.FileExists(cloneReferencePath) {
-		buffer, err := ioutil.ReadFile(cloneReferencePath)
-		if err == nil {
-			path := strings.TrimSpace(string(buffer[:]))
-			referenceLfsStoragePath := filepath.Join(filepath.Dir(path), "lfs", "objects")
-			if tools.DirExists(referenceLfsStoragePath) {
-				return referenceLfsStoragePath
-			}
+	objectsDir := filepath.Join(gitStorageDir, "objects")
+	cloneReferencePath := filepath.Join(objectsDir, "info", "alternates")
+	if !tools.FileExists(cloneReferencePath) {
+		return ""
+	}
+
+	buffer, err := ioutil.ReadFile(cloneReferencePath)
+	if err != nil {
+		return ""
+	}
+
+	for _, line := range strings.Split(string(buffer), "\n") {
+		path := strings.TrimSpace(line)
+		if len(path) == 0 || strings.HasPrefix(path, "#") {
+			continue
+		}
+		// Relative alternates are relative to the objects directory.
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(objectsDir, path)
+		}
+
+		referenceLfsStoragePath := filepath.Join(filepath.Dir(path), "lfs", "objects")
+		if tools.DirExists(referenceLfsStoragePath) {
+			return referenceLfsStoragePath
+		}
+	}
+	return ""
+}
+
+// ReferenceObjectDir returns the Git LFS object directory of the repository at
+// the given path, as given to "git clone --reference", which is either a
+// working copy or a bare repository, or an empty string if it has none.
+func ReferenceObjectDir(repo string) string {
+	for _, dir := range []string{
+		filepath.Join(repo, ".git", "lfs", "objects"),
+		filepath.Join(repo, "lfs", "objects"),
+	} {
+		if tools.DirExists(dir) {
+			return dir
 		}
 	}
 	return ""
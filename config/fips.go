@@ -0,0 +1,38 @@
+package config
+
+import "fmt"
+
+// fipsBuild is true when git-lfs has been built against a FIPS 140-2
+// validated crypto module, e.g. with GOEXPERIMENT=boringcrypto. See
+// fips_boringcrypto.go.
+var fipsBuild = false
+
+// FipsMode returns whether git-lfs should restrict itself to FIPS-approved
+// cryptography, refusing to use any feature which depends on non-approved
+// primitives (e.g. NTLM, which needs MD4, MD5 and RC4). It is always true for
+// FIPS builds, and can otherwise be turned on with lfs.fips.
+func (c *Configuration) FipsMode() bool {
+	return fipsBuild || c.Git.Bool("lfs.fips", false)
+}
+
+// CheckFipsExtensions returns an error if FIPS mode is enabled and any of the
+// given extensions hasn't been approved with lfs.fips.approvedextension: Git
+// LFS can't tell which cryptography an extension's programs use, such as to
+// hash or encrypt the files they clean.
+func (c *Configuration) CheckFipsExtensions(exts []Extension) error {
+	if !c.FipsMode() {
+		return nil
+	}
+
+	approved := make(map[string]bool)
+	for _, name := range c.Git.GetAll("lfs.fips.approvedextension") {
+		approved[name] = true
+	}
+
+	for _, ext := range exts {
+		if !approved[ext.Name] {
+			return fmt.Errorf("The %q extension is not permitted when lfs.fips is enabled, as it is not listed in lfs.fips.approvedextension", ext.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+// +build goexperiment.boringcrypto
+
+package config
+
+// Importing fipsonly restricts crypto/tls to FIPS-approved protocol versions,
+// cipher suites and curves for the whole process.
+import _ "crypto/tls/fipsonly"
+
+func init() {
+	fipsBuild = true
+}
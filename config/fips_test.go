@@ -0,0 +1,30 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFipsExtensionsAllowsAnythingWhenDisabled(t *testing.T) {
+	cfg := NewFrom(Values{})
+
+	assert.Nil(t, cfg.CheckFipsExtensions([]Extension{{Name: "encrypt"}}))
+}
+
+func TestCheckFipsExtensionsRefusesUnapproved(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.fips":                   "true",
+			"lfs.fips.approvedextension": "compress",
+		},
+	})
+
+	assert.Nil(t, cfg.CheckFipsExtensions(nil))
+	assert.Nil(t, cfg.CheckFipsExtensions([]Extension{{Name: "compress"}}))
+
+	err := cfg.CheckFipsExtensions([]Extension{{Name: "compress"}, {Name: "encrypt"}})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), `"encrypt" extension is not permitted`)
+	}
+}
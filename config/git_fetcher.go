@@ -9,11 +9,14 @@ import (
 	"sync"
 
 	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/tools"
 )
 
 type GitFetcher struct {
-	vmu  sync.RWMutex
-	vals map[string]string
+	vmu sync.RWMutex
+	// vals holds every value given for each key, in the order they were
+	// read, since some keys (such as "http.extraheader") may be repeated.
+	vals map[string][]string
 }
 
 type GitConfig struct {
@@ -29,7 +32,7 @@ func NewGitConfig(gitconfiglines string, onlysafe bool) *GitConfig {
 }
 
 func ReadGitConfig(configs ...*GitConfig) (gf *GitFetcher, extensions map[string]Extension, uniqRemotes map[string]bool) {
-	vals := make(map[string]string)
+	vals := make(map[string][]string)
 
 	extensions = make(map[string]Extension)
 	uniqRemotes = make(map[string]bool)
@@ -47,9 +50,9 @@ func ReadGitConfig(configs ...*GitConfig) (gf *GitFetcher, extensions map[string
 			key, val := strings.ToLower(pieces[0]), pieces[1]
 
 			if origKey, ok := uniqKeys[key]; ok {
-				if ShowConfigWarnings && vals[key] != val && strings.HasPrefix(key, gitConfigWarningPrefix) {
+				if prev := lastValue(vals[key]); ShowConfigWarnings && prev != val && strings.HasPrefix(key, gitConfigWarningPrefix) && !multiValueKeys[key] {
 					fmt.Fprintf(os.Stderr, "WARNING: These git config values clash:\n")
-					fmt.Fprintf(os.Stderr, "  git config %q = %q\n", origKey, vals[key])
+					fmt.Fprintf(os.Stderr, "  git config %q = %q\n", origKey, prev)
 					fmt.Fprintf(os.Stderr, "  git config %q = %q\n", pieces[0], val)
 				}
 			} else {
@@ -82,6 +85,16 @@ func ReadGitConfig(configs ...*GitConfig) (gf *GitFetcher, extensions map[string
 					if err == nil && p >= 0 {
 						ext.Priority = p
 					}
+				case "pattern":
+					if gc.OnlySafeKeys {
+						continue
+					}
+					ext.Patterns = append(ext.Patterns, tools.CleanPaths(val, ",")...)
+				case "optional":
+					if gc.OnlySafeKeys {
+						continue
+					}
+					ext.Optional = parseBool(val, false)
 				}
 
 				extensions[name] = ext
@@ -95,13 +108,21 @@ func ReadGitConfig(configs ...*GitConfig) (gf *GitFetcher, extensions map[string
 				uniqRemotes[remote] = remote == "origin"
 			} else if len(parts) > 2 && parts[len(parts)-1] == "access" {
 				allowed = true
+			} else if _, ok := refEndpointPattern(key, "url"); ok {
+				allowed = true
+			} else if _, ok := refEndpointPattern(key, "pushurl"); ok {
+				allowed = true
+			} else if _, ok := refEndpointPattern(key, "pullurl"); ok {
+				allowed = true
+			} else if _, _, ok := storageRouteKey(key); ok {
+				allowed = true
 			}
 
 			if !allowed && keyIsUnsafe(key) {
 				continue
 			}
 
-			vals[key] = val
+			vals[key] = append(vals[key], val)
 		}
 	}
 
@@ -122,8 +143,23 @@ func (g *GitFetcher) Get(key string) (val string, ok bool) {
 	g.vmu.RLock()
 	defer g.vmu.RUnlock()
 
-	val, ok = g.vals[strings.ToLower(key)]
-	return
+	vals, ok := g.vals[strings.ToLower(key)]
+	return lastValue(vals), ok
+}
+
+// GetAll implements the Fetcher interface, and returns every value associated
+// with the given key, in the order they were read, or nil if there are none.
+//
+// GetAll is safe to call across multiple goroutines.
+func (g *GitFetcher) GetAll(key string) []string {
+	g.vmu.RLock()
+	defer g.vmu.RUnlock()
+
+	vals := g.vals[strings.ToLower(key)]
+	if len(vals) == 0 {
+		return nil
+	}
+	return append([]string(nil), vals...)
 }
 
 func (g *GitFetcher) All() map[string]string {
@@ -132,8 +168,8 @@ func (g *GitFetcher) All() map[string]string {
 	g.vmu.RLock()
 	defer g.vmu.RUnlock()
 
-	for key, value := range g.vals {
-		newmap[key] = value
+	for key, values := range g.vals {
+		newmap[key] = lastValue(values)
 	}
 
 	return newmap
@@ -142,7 +178,7 @@ func (g *GitFetcher) All() map[string]string {
 func (g *GitFetcher) set(key, value string) {
 	g.vmu.Lock()
 	defer g.vmu.Unlock()
-	g.vals[strings.ToLower(key)] = value
+	g.vals[strings.ToLower(key)] = []string{value}
 }
 
 func (g *GitFetcher) del(key string) {
@@ -151,6 +187,15 @@ func (g *GitFetcher) del(key string) {
 	delete(g.vals, strings.ToLower(key))
 }
 
+// lastValue returns the last of the given values, which is the one that takes
+// precedence, or an empty string if there are none.
+func lastValue(vals []string) string {
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[len(vals)-1]
+}
+
 func getGitConfigs() (sources []*GitConfig) {
 	if lfsconfig := getFileGitConfig(".lfsconfig"); lfsconfig != nil {
 		sources = append(sources, lfsconfig)
@@ -193,10 +238,19 @@ func keyIsUnsafe(key string) bool {
 	return true
 }
 
+// multiValueKeys are the keys which may be given more than once, each value
+// adding to the others rather than overriding them.
+var multiValueKeys = map[string]bool{
+	"lfs.alternate":     true,
+	"lfs.peers.address": true,
+}
+
 var safeKeys = []string{
 	"lfs.fetchexclude",
 	"lfs.fetchinclude",
 	"lfs.gitprotocol",
+	"lfs.mirrorurl",
+	"lfs.pullurl",
 	"lfs.pushurl",
 	"lfs.url",
 }
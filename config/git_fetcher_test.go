@@ -0,0 +1,85 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadGitConfigKeepsRepeatedValues(t *testing.T) {
+	gf, _, _ := ReadGitConfig(NewGitConfig(
+		"http.extraheader=X-One: 1\nhttp.ExtraHeader=X-Two: 2\nlfs.url=https://git-lfs.local/repo",
+		false))
+
+	assert.Equal(t, []string{"X-One: 1", "X-Two: 2"}, gf.GetAll("http.extraHeader"))
+	assert.Nil(t, gf.GetAll("http.missing"))
+
+	val, ok := gf.Get("http.extraheader")
+	assert.True(t, ok)
+	assert.Equal(t, "X-Two: 2", val)
+	assert.Equal(t, "X-Two: 2", gf.All()["http.extraheader"])
+
+	gf.set("http.extraheader", "X-Three: 3")
+	assert.Equal(t, []string{"X-Three: 3"}, gf.GetAll("http.extraheader"))
+}
+
+func TestReadGitConfigSkipsUnsafeRepeatedValues(t *testing.T) {
+	gf, _, _ := ReadGitConfig(NewGitConfig("http.extraheader=X-Unsafe: 1", true))
+
+	assert.Nil(t, gf.GetAll("http.extraheader"))
+}
+
+func TestReadGitConfigAllowsSafePerRefUrls(t *testing.T) {
+	gf, _, _ := ReadGitConfig(NewGitConfig(
+		"lfs.refs/heads/release/*.url=https://release.local\nlfs.refs/heads/release/*.pushurl=https://write.release.local\nlfs.refs/heads/release/*.concurrenttransfers=1",
+		true))
+
+	val, ok := gf.Get("lfs.refs/heads/release/*.url")
+	assert.True(t, ok)
+	assert.Equal(t, "https://release.local", val)
+
+	val, ok = gf.Get("lfs.refs/heads/release/*.pushurl")
+	assert.True(t, ok)
+	assert.Equal(t, "https://write.release.local", val)
+
+	_, ok = gf.Get("lfs.refs/heads/release/*.concurrenttransfers")
+	assert.False(t, ok)
+}
+
+func TestReadGitConfigAllowsSafePullUrls(t *testing.T) {
+	gf, _, _ := ReadGitConfig(NewGitConfig(
+		"lfs.pullurl=https://cdn.local\nlfs.refs/heads/release/*.pullurl=https://cdn.release.local",
+		true))
+
+	val, ok := gf.Get("lfs.pullurl")
+	assert.True(t, ok)
+	assert.Equal(t, "https://cdn.local", val)
+
+	val, ok = gf.Get("lfs.refs/heads/release/*.pullurl")
+	assert.True(t, ok)
+	assert.Equal(t, "https://cdn.release.local", val)
+}
+
+func TestReadGitConfigExtensionPatterns(t *testing.T) {
+	_, extensions, _ := ReadGitConfig(NewGitConfig(
+		"lfs.extension.exif.clean=exif-strip\nlfs.extension.exif.pattern=*.jpg,*.jpeg\nlfs.extension.exif.pattern=raw/\nlfs.extension.exif.optional=true",
+		false))
+
+	ext := extensions["exif"]
+	assert.Equal(t, []string{"*.jpg", "*.jpeg", "raw"}, ext.Patterns)
+	assert.True(t, ext.Optional)
+	assert.True(t, ext.Applies("photos/a.jpg"))
+	assert.True(t, ext.Applies("raw/a.dng"))
+	assert.False(t, ext.Applies("a.png"))
+}
+
+func TestReadGitConfigSkipsUnsafeExtensionPatterns(t *testing.T) {
+	_, extensions, _ := ReadGitConfig(NewGitConfig(
+		"lfs.extension.exif.pattern=*.jpg\nlfs.extension.exif.optional=true",
+		true))
+
+	ext := extensions["exif"]
+	assert.Empty(t, ext.Patterns)
+	assert.False(t, ext.Optional)
+	assert.True(t, ext.Applies("a.png"))
+}
@@ -54,6 +54,15 @@ func (o *OsFetcher) Get(key string) (val string, ok bool) {
 	return v, ok
 }
 
+// GetAll implements the `Fetcher.GetAll` method. Environment variables have at
+// most one value.
+func (o *OsFetcher) GetAll(key string) []string {
+	if val, ok := o.Get(key); ok {
+		return []string{val}
+	}
+	return nil
+}
+
 func (o *OsFetcher) All() map[string]string {
 	return nil
 }
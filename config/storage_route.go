@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/filepathfilter"
+	"github.com/git-lfs/git-lfs/tools"
+)
+
+// A StorageRoute sends the objects of the files matching its patterns, or of at
+// least its minimum size, to another LFS server or server-side storage class
+// than the rest, such as huge videos to a server backed by cold storage. Routes
+// are given by "lfs.storage.<name>.<key>" keys, usually in .lfsconfig.
+type StorageRoute struct {
+	Name string
+	// Patterns are the paths of the files whose objects are routed, as for
+	// lfs.fetchinclude. If there are none, files are routed by size alone.
+	Patterns []string
+	// MinSize is the size, in bytes, below which objects are not routed.
+	MinSize int64
+	// Url is the URL of the LFS server to which objects are routed, or ""
+	// for the usual one.
+	Url string
+	// Class is the storage class requested from the server in batch API
+	// requests, or "" for none.
+	Class string
+
+	filter *filepathfilter.Filter
+}
+
+// Matches returns whether the object of the file with the given path, relative
+// to the root of the repository, and size is sent along the route.
+func (r *StorageRoute) Matches(name string, size int64) bool {
+	if size < r.MinSize {
+		return false
+	}
+	return len(r.Patterns) > 0 && r.filter.Allows(filepath.FromSlash(name)) ||
+		len(r.Patterns) == 0 && r.MinSize > 0
+}
+
+// StorageRoutes returns the configured storage routes, sorted by name, which is
+// the order in which they are matched.
+func (c *Configuration) StorageRoutes() []*StorageRoute {
+	byName := make(map[string]*StorageRoute)
+	for key := range c.Git.All() {
+		name, _, ok := storageRouteKey(key)
+		if !ok || byName[name] != nil {
+			continue
+		}
+
+		prefix := "lfs.storage." + name + "."
+		route := &StorageRoute{Name: name}
+		for _, patterns := range c.Git.GetAll(prefix + "pattern") {
+			route.Patterns = append(route.Patterns, tools.CleanPaths(patterns, ",")...)
+		}
+		route.filter = newStorageRouteFilter(route.Patterns)
+		route.Url, _ = c.Git.Get(prefix + "url")
+		route.Class, _ = c.Git.Get(prefix + "class")
+
+		if v, ok := c.Git.Get(prefix + "minsize"); ok {
+			size, err := ParseSize(v)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "WARNING: Invalid %sminsize %q, ignoring storage route %s\n", prefix, v, name)
+				continue
+			}
+			route.MinSize = size
+		}
+
+		byName[name] = route
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	routes := make([]*StorageRoute, 0, len(names))
+	for _, name := range names {
+		routes = append(routes, byName[name])
+	}
+	return routes
+}
+
+// StorageEndpoint returns the endpoint of the LFS server to which objects sent
+// along the given storage route go: the route's own, if it has one, or
+// otherwise Endpoint(operation).
+func (c *Configuration) StorageEndpoint(route *StorageRoute, operation string) Endpoint {
+	if route != nil && len(route.Url) > 0 {
+		return NewEndpointWithConfig(route.Url, c)
+	}
+	return c.Endpoint(operation)
+}
+
+// newStorageRouteFilter returns the filter which allows the files matching the
+// given patterns.
+func newStorageRouteFilter(patterns []string) *filepathfilter.Filter {
+	return filepathfilter.New(patterns, nil)
+}
+
+// storageRouteKey returns the name of the route and the key given by a
+// "lfs.storage.<name>.<key>" config key, and whether k is one.
+func storageRouteKey(k string) (name, key string, ok bool) {
+	if !strings.HasPrefix(k, "lfs.storage.") {
+		return "", "", false
+	}
+
+	rest := strings.TrimPrefix(k, "lfs.storage.")
+	i := strings.LastIndex(rest, ".")
+	if i <= 0 {
+		return "", "", false
+	}
+
+	switch key := rest[i+1:]; key {
+	case "pattern", "minsize", "url", "class":
+		return rest[:i], key, true
+	}
+	return "", "", false
+}
+
+// ParseSize parses a size in bytes, with an optional "k", "m" or "g" suffix, as
+// Git does for integer config values.
+func ParseSize(v string) (int64, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+
+	var factor int64 = 1
+	switch {
+	case strings.HasSuffix(v, "k"):
+		factor = 1 << 10
+	case strings.HasSuffix(v, "m"):
+		factor = 1 << 20
+	case strings.HasSuffix(v, "g"):
+		factor = 1 << 30
+	}
+	if factor > 1 {
+		v = v[:len(v)-1]
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", v)
+	}
+	return n * factor, nil
+}
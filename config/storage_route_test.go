@@ -0,0 +1,94 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageRoutes(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.url":                   "https://example.com/lfs",
+			"lfs.storage.video.pattern": "*.mp4,*.mov",
+			"lfs.storage.video.url":     "https://cold.example.com/lfs",
+			"lfs.storage.video.class":   "cold",
+			"lfs.storage.huge.minsize":  "1g",
+			"lfs.storage.huge.class":    "archive",
+		},
+	})
+
+	routes := cfg.StorageRoutes()
+	require.Len(t, routes, 2)
+
+	huge, video := routes[0], routes[1]
+	assert.Equal(t, "huge", huge.Name)
+	assert.Equal(t, int64(1<<30), huge.MinSize)
+	assert.Equal(t, "archive", huge.Class)
+	assert.Equal(t, "https://example.com/lfs", cfg.StorageEndpoint(huge, "upload").Url)
+
+	assert.Equal(t, "video", video.Name)
+	assert.Equal(t, []string{"*.mp4", "*.mov"}, video.Patterns)
+	assert.Equal(t, "cold", video.Class)
+	assert.Equal(t, "https://cold.example.com/lfs", cfg.StorageEndpoint(video, "upload").Url)
+
+	assert.Equal(t, "https://example.com/lfs", cfg.StorageEndpoint(nil, "upload").Url)
+}
+
+func TestStorageRouteMatches(t *testing.T) {
+	patterns := &StorageRoute{Patterns: []string{"*.mp4", "raw"}}
+	patterns.filter = newStorageRouteFilter(patterns.Patterns)
+	size := &StorageRoute{MinSize: 100}
+	both := &StorageRoute{Patterns: []string{"*.mp4"}, MinSize: 100}
+	both.filter = newStorageRouteFilter(both.Patterns)
+
+	for _, c := range []struct {
+		Route    *StorageRoute
+		Name     string
+		Size     int64
+		Expected bool
+	}{
+		{patterns, "a.mp4", 1, true},
+		{patterns, "dir/a.mp4", 1, true},
+		{patterns, "raw/a.dat", 1, true},
+		{patterns, "a.dat", 1000, false},
+		{size, "a.dat", 100, true},
+		{size, "a.dat", 99, false},
+		{both, "a.mp4", 100, true},
+		{both, "a.mp4", 99, false},
+		{both, "a.dat", 100, false},
+		{&StorageRoute{}, "a.dat", 100, false},
+	} {
+		assert.Equal(t, c.Expected, c.Route.Matches(c.Name, c.Size), "%v matching %q (%d)", c.Route.Patterns, c.Name, c.Size)
+	}
+}
+
+func TestStorageRoutesIgnoreInvalidSize(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"lfs.storage.huge.minsize": "lots",
+		},
+	})
+
+	assert.Empty(t, cfg.StorageRoutes())
+}
+
+func TestParseSize(t *testing.T) {
+	for v, expected := range map[string]int64{
+		"0":    0,
+		"512":  512,
+		"1k":   1 << 10,
+		"10M":  10 << 20,
+		" 2g ": 2 << 30,
+	} {
+		size, err := ParseSize(v)
+		assert.Nil(t, err, v)
+		assert.Equal(t, expected, size, v)
+	}
+
+	for _, v := range []string{"", "k", "-1", "1t", "1.5m"} {
+		_, err := ParseSize(v)
+		assert.NotNil(t, err, v)
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+// URLConfig returns the value of the given key in the section of the Git
+// config for the URL which most specifically matches u, such as
+// "credential.https://git-server.com/work.username", following Git's rules for
+// matching URLs: the scheme, host and port must be the same, a host may start
+// with "*." to match any subdomain, a user must be the same if one is given,
+// and the path must be the same as u's or one of its parent directories. The
+// longest matching path is the most specific, followed by one with a user.
+//
+// Keys without a URL, such as "credential.username", aren't matched.
+func (c *Configuration) URLConfig(section, key string, u *url.URL) (string, bool) {
+	prefix := strings.ToLower(section) + "."
+	suffix := "." + strings.ToLower(key)
+
+	var val string
+	best := -1
+	for k, v := range c.Git.All() {
+		if !strings.HasPrefix(k, prefix) || !strings.HasSuffix(k, suffix) || len(k) <= len(prefix)+len(suffix) {
+			continue
+		}
+
+		pattern, err := url.Parse(k[len(prefix) : len(k)-len(suffix)])
+		if err != nil || len(pattern.Scheme) == 0 {
+			continue
+		}
+
+		if specificity, ok := urlMatch(pattern, u); ok && specificity > best {
+			val = v
+			best = specificity
+		}
+	}
+	return val, best >= 0
+}
+
+// urlMatch returns whether the URL in a Git config key matches u, and how
+// specifically it does.
+func urlMatch(pattern, u *url.URL) (int, bool) {
+	if !strings.EqualFold(pattern.Scheme, u.Scheme) {
+		return 0, false
+	}
+
+	if !urlHostMatch(urlHost(pattern), urlHost(u)) {
+		return 0, false
+	}
+
+	var specificity int
+	if pattern.User != nil {
+		if u.User == nil || pattern.User.Username() != u.User.Username() {
+			return 0, false
+		}
+		specificity = 1
+	}
+
+	dir := strings.TrimSuffix(pattern.Path, "/")
+	path := strings.TrimSuffix(u.Path, "/")
+	if len(dir) > 0 && !strings.EqualFold(path, dir) && !strings.HasPrefix(strings.ToLower(path), strings.ToLower(dir)+"/") {
+		return 0, false
+	}
+
+	return specificity + 2*len(dir), true
+}
+
+// urlHost returns the lowercased host and port of u, without the default port
+// for its scheme.
+func urlHost(u *url.URL) string {
+	host := strings.ToLower(u.Host)
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		host = strings.TrimSuffix(host, ":443")
+	case "http":
+		host = strings.TrimSuffix(host, ":80")
+	}
+	return host
+}
+
+// urlHostMatch returns whether the host in a Git config key matches host,
+// where each "*" label in the pattern matches any one label in host.
+func urlHostMatch(pattern, host string) bool {
+	patternLabels := strings.Split(pattern, ".")
+	hostLabels := strings.Split(host, ".")
+	if len(patternLabels) != len(hostLabels) {
+		return false
+	}
+
+	for i, label := range patternLabels {
+		if label != "*" && label != hostLabels[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLConfigMatchesMostSpecificURL(t *testing.T) {
+	cfg := NewFrom(Values{
+		Git: map[string]string{
+			"credential.username":                                 "everyone",
+			"credential.https://git-server.com.username":          "host",
+			"credential.https://git-server.com/work.username":     "work",
+			"credential.https://git-server.com/work/a.username":   "work-a",
+			"credential.https://bot@git-server.com/work.username": "bot",
+			"credential.https://*.other-server.com.username":      "other",
+			"credential.http://git-server.com:8080.username":      "port",
+		},
+	})
+
+	for rawurl, expected := range map[string]string{
+		"https://git-server.com":               "host",
+		"https://git-server.com:443/foo":       "host",
+		"https://git-server.com/work":          "work",
+		"https://git-server.com/work/":         "work",
+		"https://git-server.com/work/b.git":    "work",
+		"https://git-server.com/workshop":      "host",
+		"https://git-server.com/work/a/b.git":  "work-a",
+		"https://git-server.com/WORK/a":        "work-a",
+		"https://bot@git-server.com/work/b":    "bot",
+		"https://bot@git-server.com/work/a":    "work-a",
+		"https://lfs.other-server.com/x":       "other",
+		"https://a.lfs.other-server.com/x":     "",
+		"http://git-server.com:8080/work":      "port",
+		"http://git-server.com/work":           "",
+		"https://git-server.com.evil.com/work": "",
+	} {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		val, ok := cfg.URLConfig("credential", "username", u)
+		assert.Equal(t, expected, val, rawurl)
+		assert.Equal(t, len(expected) > 0, ok, rawurl)
+	}
+}
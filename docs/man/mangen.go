@@ -46,6 +46,30 @@ func main() {
 	out.WriteString("package commands\n\nfunc init() {\n")
 	out.WriteString("// THIS FILE IS GENERATED, DO NOT EDIT\n")
 	out.WriteString("// Use 'go generate ./commands' to update\n")
+	count := convertManPages(out, manDir, fs, "")
+	for _, f := range fs {
+		if !f.IsDir() {
+			continue
+		}
+		// Translated man pages are in a directory named after their
+		// locale, as docs/man/de, and are keyed by it, as "de/push".
+		localeDir := filepath.Join(manDir, f.Name())
+		localeFs, err := ioutil.ReadDir(localeDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open %v: %v\n", localeDir, err)
+			os.Exit(2)
+		}
+		count += convertManPages(out, localeDir, localeFs, f.Name()+"/")
+	}
+	out.WriteString("}\n")
+	fmt.Fprintf(os.Stderr, "Successfully processed %d man pages.\n", count)
+
+}
+
+// convertManPages writes the .ronn files in manDir, whose contents are fs, to
+// out as entries of ManPages, keyed by their command's name with the given
+// prefix, and returns how many there were.
+func convertManPages(out *os.File, manDir string, fs []os.FileInfo, prefix string) int {
 	fileregex := regexp.MustCompile(`git-lfs(?:-([A-Za-z\-]+))?.\d.ronn`)
 	headerregex := regexp.MustCompile(`^###?\s+([A-Za-z0-9 ]+)`)
 	// only pick up caps in links to avoid matching optional args
@@ -61,7 +85,7 @@ func main() {
 				// This is git-lfs.1.ronn
 				cmd = "git-lfs"
 			}
-			out.WriteString("ManPages[\"" + cmd + "\"] = `")
+			out.WriteString("ManPages[\"" + prefix + cmd + "\"] = `")
 			contentf, err := os.Open(filepath.Join(manDir, f.Name()))
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Failed to open %v: %v\n", f.Name(), err)
@@ -144,7 +168,5 @@ func main() {
 			count++
 		}
 	}
-	out.WriteString("}\n")
-	fmt.Fprintf(os.Stderr, "Successfully processed %d man pages.\n", count)
-
+	return count
 }
@@ -3,6 +3,7 @@ package errors
 import (
 	"errors"
 	"testing"
+	"time"
 )
 
 func TestChecksHandleGoErrors(t *testing.T) {
@@ -73,3 +74,69 @@ func TestContextOnWrappedErrors(t *testing.T) {
 		t.Errorf("expected to delete from error context")
 	}
 }
+
+func TestRetriableLaterErrors(t *testing.T) {
+	at := time.Unix(1500000000, 0)
+	err := NewRetriableLaterError(errors.New("Go error"), at)
+
+	if !IsRetriableError(err) {
+		t.Error("expected retriable later error to be retriable")
+	}
+
+	if retryAfter, ok := IsRetriableLaterError(err); !ok || !retryAfter.Equal(at) {
+		t.Errorf("expected error to be retriable after %s, got %s (%t)", at, retryAfter, ok)
+	}
+
+	if _, ok := IsRetriableLaterError(NewRetriableError(errors.New("Go error"))); ok {
+		t.Error("expected retriable error to not be retriable later")
+	}
+}
+
+func TestCorruptObjectErrors(t *testing.T) {
+	err := NewCorruptObjectError(errors.New("Go error"), "some-oid")
+
+	if !IsCorruptObjectError(err) {
+		t.Error("expected corrupt object error to be corrupt")
+	}
+
+	if !IsRetriableError(err) {
+		t.Error("expected corrupt object error to be retriable")
+	}
+
+	if oid := GetContext(err, "oid"); oid != "some-oid" {
+		t.Errorf("expected oid in error context, got %v", oid)
+	}
+
+	if IsCorruptObjectError(NewRetriableError(errors.New("Go error"))) {
+		t.Error("expected retriable error to not be corrupt")
+	}
+}
+
+type causer struct {
+	error
+}
+
+func (c causer) Cause() error { return c.error }
+
+func TestChecksSeeThroughCausers(t *testing.T) {
+	err := causer{NewRetriableError(errors.New("Go error"))}
+
+	if !IsRetriableError(err) {
+		t.Error("expected the wrapped error to be retriable")
+	}
+}
+
+func TestWrappingKeepsContext(t *testing.T) {
+	err := Wrap(errors.New("Go error"), "http")
+	SetContext(err, "Status", "403 Forbidden")
+
+	retriable := NewRetriableError(err)
+	if status := GetContext(retriable, "Status"); status != "403 Forbidden" {
+		t.Errorf("expected the wrapped error's context, got %v", status)
+	}
+
+	SetContext(retriable, "Status", "500 Internal Server Error")
+	if status := GetContext(err, "Status"); status != "403 Forbidden" {
+		t.Errorf("expected the wrapped error's context to be unchanged, got %v", status)
+	}
+}
@@ -2,6 +2,7 @@ package errors
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -140,6 +141,35 @@ func IsRetriableError(err error) bool {
 	return false
 }
 
+// IsRetriableLaterError indicates the low level transfer had an error but the
+// caller may retry the operation once the returned time has passed, such as
+// when a server is rate limiting requests.
+func IsRetriableLaterError(err error) (time.Time, bool) {
+	if e, ok := err.(interface {
+		RetryAfter() time.Time
+	}); ok {
+		return e.RetryAfter(), true
+	}
+	if parent := parentOf(err); parent != nil {
+		return IsRetriableLaterError(parent)
+	}
+	return time.Time{}, false
+}
+
+// IsCorruptObjectError indicates that the contents of a downloaded object did
+// not match its OID. The download may be retried from scratch.
+func IsCorruptObjectError(err error) bool {
+	if e, ok := err.(interface {
+		CorruptObjectError() bool
+	}); ok {
+		return e.CorruptObjectError()
+	}
+	if parent := parentOf(err); parent != nil {
+		return IsCorruptObjectError(parent)
+	}
+	return false
+}
+
 type errorWithCause interface {
 	Cause() error
 	StackTrace() errors.StackTrace
@@ -154,7 +184,7 @@ type wrappedError struct {
 	context map[string]interface{}
 }
 
-// newWrappedError creates a wrappedError.
+// newWrappedError creates a wrappedError, with a copy of the context of err.
 func newWrappedError(err error, message string) *wrappedError {
 	if err == nil {
 		err = errors.New("Error")
@@ -170,8 +200,15 @@ func newWrappedError(err error, message string) *wrappedError {
 		errWithCause = errors.Wrap(err, "LFS").(errorWithCause)
 	}
 
+	// keep the context of the error being wrapped, such as the HTTP
+	// status of a response, so that it can still be read.
+	context := make(map[string]interface{})
+	for key, val := range Context(err) {
+		context[key] = val
+	}
+
 	return &wrappedError{
-		context:        make(map[string]interface{}),
+		context:        context,
 		errorWithCause: errWithCause,
 	}
 }
@@ -331,8 +368,55 @@ func NewRetriableError(err error) error {
 	return retriableError{newWrappedError(err, "")}
 }
 
+// Definitions for IsRetriableLaterError()
+
+type retriableLaterError struct {
+	*wrappedError
+	retryAfter time.Time
+}
+
+func (e retriableLaterError) RetriableError() bool {
+	return true
+}
+
+func (e retriableLaterError) RetryAfter() time.Time {
+	return e.retryAfter
+}
+
+// NewRetriableLaterError returns an error which may be retried once the given
+// time has passed. It is also a retriable error.
+func NewRetriableLaterError(err error, retryAfter time.Time) error {
+	return retriableLaterError{newWrappedError(err, ""), retryAfter}
+}
+
+// Definitions for IsCorruptObjectError()
+
+type corruptObjectError struct {
+	*wrappedError
+}
+
+func (e corruptObjectError) CorruptObjectError() bool {
+	return true
+}
+
+func (e corruptObjectError) RetriableError() bool {
+	return true
+}
+
+// NewCorruptObjectError returns an error for a download of the object with the
+// given OID whose contents did not match it. It is also a retriable error.
+func NewCorruptObjectError(err error, oid string) error {
+	e := corruptObjectError{newWrappedError(err, "")}
+	e.Set("oid", oid)
+	return e
+}
+
+// parentOf returns the error which err wraps, if any. Errors from outside this
+// package can be seen through by implementing Cause().
 func parentOf(err error) error {
-	if c, ok := err.(errorWithCause); ok {
+	if c, ok := err.(interface {
+		Cause() error
+	}); ok {
 		return c.Cause()
 	}
 
@@ -19,8 +19,18 @@ func main() {
 	var once sync.Once
 
 	go func() {
+		interrupted := false
 		for {
 			sig := <-c
+
+			// The first interrupt stops the commands which can stop
+			// their transfers, so that they're left to resume.
+			if sig == os.Interrupt && !interrupted && commands.Interrupt() {
+				interrupted = true
+				fmt.Fprintf(os.Stderr, "\nStopping because of %q signal. Send it again to exit now.\n", sig)
+				continue
+			}
+
 			once.Do(commands.Cleanup)
 			fmt.Fprintf(os.Stderr, "\nExiting because of %q signal.\n", sig)
 
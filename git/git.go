@@ -34,8 +34,144 @@ const (
 	// A ref which can be used as a placeholder for before the first commit
 	// Equivalent to git mktree < /dev/null, useful for diffing before first commit
 	RefBeforeFirstCommit = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	// RefBeforeFirstCommitSHA256 is RefBeforeFirstCommit in repositories
+	// with the "sha256" object format.
+	RefBeforeFirstCommitSHA256 = "6ef19b41225c5369f1c104d45d8d85efa9b057b53b14b4b9b939dd74decc5321"
+
+	// EmptyBlobSHA1 is the blob of an empty file, as "git hash-object
+	// /dev/null" names it.
+	EmptyBlobSHA1 = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+	// EmptyBlobSHA256 is EmptyBlobSHA1 in repositories with the "sha256"
+	// object format.
+	EmptyBlobSHA256 = "473a0f4c3be8a93681a267e3b1e9a7dcda1185436fe141f7749120a303721813"
 )
 
+// Object formats, as given by "git init --object-format".
+const (
+	ObjectFormatSHA1   = "sha1"
+	ObjectFormatSHA256 = "sha256"
+)
+
+// ObjectIDPattern matches the full hexadecimal name of an object, which is a
+// SHA-1 of 40 characters, or a SHA-256 of 64 in repositories with the "sha256"
+// object format.
+const ObjectIDPattern = `[0-9a-fA-F]{40}(?:[0-9a-fA-F]{24})?`
+
+// ObjectFormat returns the object format of the current repository, which is
+// ObjectFormatSHA1 unless it was initialized with "--object-format=sha256", or
+// if git is too old to say.
+func ObjectFormat() string {
+	format, err := subprocess.SimpleExec("git", "rev-parse", "--show-object-format")
+	if err == nil && format == ObjectFormatSHA256 {
+		return ObjectFormatSHA256
+	}
+	return ObjectFormatSHA1
+}
+
+// EmptyTree returns the name of the empty tree, RefBeforeFirstCommit, in the
+// object format of the current repository.
+func EmptyTree() string {
+	if ObjectFormat() == ObjectFormatSHA256 {
+		return RefBeforeFirstCommitSHA256
+	}
+	return RefBeforeFirstCommit
+}
+
+// EmptyBlob returns the name of the blob of an empty file in the object format
+// of the current repository.
+func EmptyBlob() string {
+	if ObjectFormat() == ObjectFormatSHA256 {
+		return EmptyBlobSHA256
+	}
+	return EmptyBlobSHA1
+}
+
+// IsShallowRepository returns whether the current repository is a shallow
+// clone, such as one cloned with "--depth", whose history stops at the commits
+// listed in its "shallow" file.
+func IsShallowRepository() bool {
+	out, err := subprocess.SimpleExec("git", "rev-parse", "--is-shallow-repository")
+	return err == nil && out == "true"
+}
+
+// ShallowCommits returns the commits of a shallow repository whose parents are
+// missing from it, as listed in its "shallow" file, or none if it isn't one.
+func ShallowCommits() ([]string, error) {
+	path, err := subprocess.SimpleExec("git", "rev-parse", "--git-path", "shallow")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var commits []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); IsObjectID(line) {
+			commits = append(commits, line)
+		}
+	}
+	return commits, nil
+}
+
+// IsPartialClone returns whether the current repository is a partial clone,
+// such as one cloned with "--filter=blob:none", which has a promisor remote git
+// fetches the objects it's missing from when they're read.
+func IsPartialClone() bool {
+	if len(Config.Find("extensions.partialclone")) > 0 {
+		return true
+	}
+
+	out, err := subprocess.SimpleExec("git", "config", "--type=bool", "--get-regexp", `^remote\..*\.promisor$`)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasSuffix(line, " true") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsObjectID returns whether s is the full hexadecimal name of an object, in
+// either object format.
+func IsObjectID(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// IsZeroObjectID returns whether s is the name git gives to objects which don't
+// exist, such as the old object of a ref being created in a hook: all zeros,
+// in either object format.
+func IsZeroObjectID(s string) bool {
+	return IsObjectID(s) && strings.Trim(s, "0") == ""
+}
+
+// SplitObjectLine splits a line of output starting with an object name, such as
+// "<sha> <path>" from "git rev-list --objects", into the name and the rest of
+// the line after the space following it. ok is false if the line doesn't start
+// with an object name.
+func SplitObjectLine(line string) (sha, rest string, ok bool) {
+	sha = line
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		sha, rest = line[:i], line[i+1:]
+	}
+	return sha, rest, IsObjectID(sha)
+}
+
 // A git reference (branch, tag etc)
 type Ref struct {
 	Name string
@@ -43,6 +179,23 @@ type Ref struct {
 	Sha  string
 }
 
+// Refspec returns the full name of the ref, such as "refs/heads/master", as
+// parsed by ParseRefToTypeAndName.
+func (r *Ref) Refspec() string {
+	switch r.Type {
+	case RefTypeLocalBranch:
+		return "refs/heads/" + r.Name
+	case RefTypeRemoteBranch:
+		return "refs/remotes/" + r.Name
+	case RefTypeLocalTag:
+		return "refs/tags/" + r.Name
+	case RefTypeRemoteTag:
+		return "refs/remotes/tags/" + r.Name
+	default:
+		return r.Name
+	}
+}
+
 // Some top level information about a commit (only first line of message)
 type CommitSummary struct {
 	Sha            string
@@ -211,7 +364,7 @@ func LocalRefs() ([]*Ref, error) {
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		parts := strings.SplitN(line, " ", 2)
-		if len(parts) != 2 || len(parts[0]) != 40 || len(parts[1]) < 1 {
+		if len(parts) != 2 || !IsObjectID(parts[0]) || len(parts[1]) < 1 {
 			tracerx.Printf("Invalid line from git show-ref: %q", line)
 			continue
 		}
@@ -310,6 +463,255 @@ func UpdateIndex(file string) error {
 	return err
 }
 
+// WorkingCopyChanges returns the status of each tracked file with uncommitted
+// changes, either staged or in the working copy, keyed by its path relative to
+// the root of the repository. Each status is the two-letter "XY" code shown by
+// 'git status --porcelain'.
+func WorkingCopyChanges() (map[string]string, error) {
+	cmd := subprocess.ExecCommand("git", "status", "--porcelain", "-z", "--untracked-files=no")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to call git status: %v", err)
+	}
+
+	return parseStatusPorcelainZ(string(out)), nil
+}
+
+// IndexBlobs returns the blob staged in the index for each file, keyed by its
+// path relative to the root of the repository.
+func IndexBlobs() (map[string]string, error) {
+	entries, err := IndexEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make(map[string]string, len(entries))
+	for _, e := range entries {
+		blobs[e.Path] = e.Sha1
+	}
+	return blobs, nil
+}
+
+// BlobEntry is a file in the index or a tree.
+type BlobEntry struct {
+	// Mode is the file's mode, such as "100644", "100755" for executable
+	// files, "120000" for symbolic links, or "160000" for submodules.
+	Mode string
+	Sha1 string
+	// Path is relative to the root of the repository.
+	Path string
+}
+
+// IsRegular returns whether the entry is a regular file, rather than a symbolic
+// link or a submodule, whose contents Git runs through filters.
+func (e *BlobEntry) IsRegular() bool {
+	return e.Mode == "100644" || e.Mode == "100755"
+}
+
+// IndexEntries returns the files staged in the index, leaving out those in
+// conflict.
+func IndexEntries() ([]*BlobEntry, error) {
+	cmd := subprocess.ExecCommand("git", "ls-files", "--stage", "--full-name", "-z", "--", ":/")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to call git ls-files: %v", err)
+	}
+
+	return parseLsFilesStageZ(string(out)), nil
+}
+
+// ChangedIndexEntries returns the files staged in the index which differ from
+// those in HEAD, or from those in the working tree, leaving out those in
+// conflict. Before the first commit, every file in the index is returned.
+func ChangedIndexEntries() ([]*BlobEntry, error) {
+	if _, err := ResolveRef("HEAD"); err != nil {
+		return IndexEntries()
+	}
+
+	cmd := subprocess.ExecCommand("git", "diff-index", "--cached", "--no-renames", "-z", "HEAD", "--")
+	staged, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to call git diff-index: %v", err)
+	}
+
+	cmd = subprocess.ExecCommand("git", "diff-files", "--no-renames", "-z")
+	unstaged, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to call git diff-files: %v", err)
+	}
+
+	// diff-index gives the staged files on the right, and diff-files on
+	// the left.
+	entries := parseRawDiffZ(string(staged), false)
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		seen[e.Path] = true
+	}
+	for _, e := range parseRawDiffZ(string(unstaged), true) {
+		if !seen[e.Path] {
+			seen[e.Path] = true
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// ChangedTreeEntries returns the files changed by the commits reachable from
+// the given ref but not from the remote-tracking branches of the given remote,
+// as the last of those commits to change each left it, leaving out those it
+// deleted.
+func ChangedTreeEntries(ref, remote string) ([]*BlobEntry, error) {
+	cmd := subprocess.ExecCommand("git", "log", "--raw", "--no-abbrev", "--no-renames", "-z", "--format=",
+		ref, "--not", "--remotes="+remote, "--")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to call git log: %v", err)
+	}
+
+	// commits are listed newest first, so the first entry for each path
+	// is the one it's left as.
+	var entries []*BlobEntry
+	seen := make(map[string]bool)
+	for _, e := range parseRawDiffZ(string(out), false) {
+		if !seen[e.Path] {
+			seen[e.Path] = true
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// parseRawDiffZ returns the files in the given output of a raw diff given with
+// -z and without renames, taking each from the left of the diff if left is set,
+// or from the right. Files missing from that side are left out.
+func parseRawDiffZ(out string, left bool) []*BlobEntry {
+	var entries []*BlobEntry
+
+	records := strings.Split(out, "\x00")
+	for i := 0; i+1 < len(records); i++ {
+		// :<mode> SP <mode> SP <sha1> SP <sha1> SP <status> NUL <path> NUL
+		header := strings.TrimLeft(records[i], "\n")
+		if !strings.HasPrefix(header, ":") {
+			continue
+		}
+
+		fields := strings.Fields(header[1:])
+		path := records[i+1]
+		i++
+		if len(fields) != 5 {
+			continue
+		}
+
+		mode, sha := fields[1], fields[3]
+		if left {
+			mode, sha = fields[0], fields[2]
+		}
+		if IsZeroObjectID(sha) {
+			continue
+		}
+		entries = append(entries, &BlobEntry{Mode: mode, Sha1: sha, Path: path})
+	}
+	return entries
+}
+
+func parseLsFilesStageZ(out string) []*BlobEntry {
+	var entries []*BlobEntry
+
+	for _, record := range strings.Split(out, "\x00") {
+		// <mode> SP <sha1> SP <stage> TAB <path>
+		tab := strings.IndexByte(record, '\t')
+		if tab < 0 {
+			continue
+		}
+
+		fields := strings.Fields(record[:tab])
+		if len(fields) != 3 || fields[2] != "0" {
+			continue
+		}
+		entries = append(entries, &BlobEntry{Mode: fields[0], Sha1: fields[1], Path: record[tab+1:]})
+	}
+	return entries
+}
+
+// CheckAttr returns the value of the given attribute for each of the given
+// paths, relative to the root of the repository, as 'git check-attr' gives
+// it: "set", "unset", "unspecified", or the value it's set to.
+func CheckAttr(attr string, paths []string) (map[string]string, error) {
+	values := make(map[string]string, len(paths))
+	if len(paths) == 0 {
+		return values, nil
+	}
+
+	root, err := RootDir()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := subprocess.ExecCommand("git", "check-attr", "-z", "--stdin", attr)
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\x00") + "\x00")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to call git check-attr: %v", err)
+	}
+
+	// <path> NUL <attribute> NUL <info> NUL
+	fields := strings.Split(string(out), "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		values[fields[i]] = fields[i+2]
+	}
+	return values, nil
+}
+
+// GetWorkingCopyFiles returns the paths, relative to the root of the
+// repository, of the files in the working copy which are staged, or untracked
+// but not ignored: those the next commit could include.
+func GetWorkingCopyFiles() ([]string, error) {
+	root, err := RootDir()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := subprocess.ExecCommand("git", "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	cmd.Dir = root
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to call git ls-files: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		// Unmerged files are listed once for each stage.
+		if len(name) > 0 && !seen[name] {
+			seen[name] = true
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+func parseStatusPorcelainZ(out string) map[string]string {
+	changes := make(map[string]string)
+
+	records := strings.Split(out, "\x00")
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		if len(record) < 4 {
+			continue
+		}
+
+		status := record[:2]
+		changes[record[3:]] = status
+
+		// renames and copies are followed by the original path
+		if status[0] == 'R' || status[0] == 'C' {
+			i++
+		}
+	}
+	return changes
+}
+
 type gitConfig struct {
 	gitVersion string
 	mu         sync.Mutex
@@ -329,6 +731,12 @@ func (c *gitConfig) FindGlobal(val string) string {
 	return output
 }
 
+// FindFile returns the git config value for the key in the given config file
+func (c *gitConfig) FindFile(file, val string) string {
+	output, _ := subprocess.SimpleExec("git", "config", "--file", file, val)
+	return output
+}
+
 // FindSystem returns the git config value in system scope for the key
 func (c *gitConfig) FindSystem(val string) string {
 	output, _ := subprocess.SimpleExec("git", "config", "--system", val)
@@ -356,6 +764,26 @@ func (c *gitConfig) UnsetGlobal(key string) (string, error) {
 	return subprocess.SimpleExec("git", "config", "--global", "--unset", key)
 }
 
+// FindAllGlobal returns all the values of the multi-valued key in global scope
+func (c *gitConfig) FindAllGlobal(key string) []string {
+	output, _ := subprocess.SimpleExec("git", "config", "--global", "--get-all", key)
+	if len(output) == 0 {
+		return nil
+	}
+	return strings.Split(output, "\n")
+}
+
+// AddGlobal adds a value for the multi-valued key to the global config
+func (c *gitConfig) AddGlobal(key, val string) (string, error) {
+	return subprocess.SimpleExec("git", "config", "--global", "--add", key, val)
+}
+
+// UnsetGlobalValue removes the given value of the multi-valued key from the
+// global config
+func (c *gitConfig) UnsetGlobalValue(key, val string) (string, error) {
+	return subprocess.SimpleExec("git", "config", "--global", "--unset-all", key, "^"+regexp.QuoteMeta(val)+"$")
+}
+
 // UnsetSystem removes the git config value for the key from the system config
 func (c *gitConfig) UnsetSystem(key string) (string, error) {
 	return subprocess.SimpleExec("git", "config", "--system", "--unset", key)
@@ -371,6 +799,11 @@ func (c *gitConfig) UnsetSystemSection(key string) (string, error) {
 	return subprocess.SimpleExec("git", "config", "--system", "--remove-section", key)
 }
 
+// UnsetLocalSection removes the entire named section from the local config
+func (c *gitConfig) UnsetLocalSection(key string) (string, error) {
+	return subprocess.SimpleExec("git", "config", "--local", "--remove-section", key)
+}
+
 // SetLocal sets the git config value for the key in the specified config file
 func (c *gitConfig) SetLocal(file, key, val string) (string, error) {
 	args := make([]string, 1, 5)
@@ -398,9 +831,11 @@ func (c *gitConfig) List() (string, error) {
 	return subprocess.SimpleExec("git", "config", "-l")
 }
 
-// ListFromFile lists all of the git config values in the given config file
+// ListFromFile lists all of the git config values in the given config file,
+// including those of the files it includes with "include.path" and
+// "includeIf.<condition>.path".
 func (c *gitConfig) ListFromFile(f string) (string, error) {
-	return subprocess.SimpleExec("git", "config", "-l", "-f", f)
+	return subprocess.SimpleExec("git", "config", "-l", "-f", f, "--includes")
 }
 
 // Version returns the git version
@@ -454,7 +889,7 @@ func RecentBranches(since time.Time, includeRemoteBranches bool, onlyRemote stri
 	// refs/remotes/origin/master ad3b29b773e46ad6870fdf08796c33d97190fe93 2015-08-13 16:50:37 +0100
 
 	// Output is ordered by latest commit date first, so we can stop at the threshold
-	regex := regexp.MustCompile(`^(refs/[^/]+/\S+)\s+([0-9A-Za-z]{40})\s+(\d{4}-\d{2}-\d{2}\s+\d{2}\:\d{2}\:\d{2}\s+[\+\-]\d{4})`)
+	regex := regexp.MustCompile(`^(refs/[^/]+/\S+)\s+(` + ObjectIDPattern + `)\s+(\d{4}-\d{2}-\d{2}\s+\d{2}\:\d{2}\:\d{2}\s+[\+\-]\d{4})`)
 	tracerx.Printf("RECENT: Getting refs >= %v", since)
 	var ret []*Ref
 	for scanner.Scan() {
@@ -573,21 +1008,79 @@ func GetCommitSummary(commit string) (*CommitSummary, error) {
 	}
 }
 
+// BlobCommit is a commit which sets a file to a blob, by adding or modifying
+// it.
+type BlobCommit struct {
+	Sha  string
+	Path string
+	Blob string
+}
+
+// BlobCommits returns the commits reachable from any ref which set a file to
+// one of the given blobs, oldest first.
+func BlobCommits(blobs map[string]bool) ([]*BlobCommit, error) {
+	cmd := subprocess.ExecCommand("git", "-c", "core.quotepath=false",
+		"log", "--all", "--reverse", "--raw", "--no-abbrev", "--no-renames",
+		"--format=commit %H")
+
+	outp, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to call git log: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Failed to call git log: %v", err)
+	}
+
+	var commits []*BlobCommit
+	var sha string
+	scanner := bufio.NewScanner(outp)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "commit ") {
+			sha = strings.TrimPrefix(line, "commit ")
+			continue
+		}
+
+		// :<old mode> <new mode> <old blob> <new blob> <status>\t<path>
+		tab := strings.IndexByte(line, '\t')
+		if !strings.HasPrefix(line, ":") || tab < 0 {
+			continue
+		}
+		fields := strings.Fields(line[:tab])
+		if len(fields) != 5 || !blobs[fields[3]] {
+			continue
+		}
+		commits = append(commits, &BlobCommit{Sha: sha, Path: line[tab+1:], Blob: fields[3]})
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("Failed to call git log: %v", err)
+	}
+	return commits, scanner.Err()
+}
+
+// GitAndRootDirs returns the absolute paths of the git dir and of the root of
+// the working tree, which is empty in bare repositories, such as when running
+// in a server-side hook, and inside the git dir itself. Whether there's a
+// working tree is asked of git, rather than inferred from its messages, which
+// may be translated, and the root is found from the path back up to it from the
+// current directory, which git only gives inside a working tree, so that one
+// process answers both.
 func GitAndRootDirs() (string, string, error) {
-	cmd := subprocess.ExecCommand("git", "rev-parse", "--git-dir", "--show-toplevel")
+	cmd := subprocess.ExecCommand("git", "rev-parse", "--git-dir", "--is-bare-repository", "--is-inside-work-tree", "--show-cdup")
 	buf := &bytes.Buffer{}
 	cmd.Stderr = buf
 
 	out, err := cmd.Output()
 	output := string(out)
 	if err != nil {
-		return "", "", fmt.Errorf("Failed to call git rev-parse --git-dir --show-toplevel: %q", buf.String())
+		return "", "", fmt.Errorf("Failed to call git rev-parse --git-dir: %q", buf.String())
 	}
 
-	paths := strings.Split(output, "\n")
-	pathLen := len(paths)
-
-	if pathLen == 0 {
+	// the path up to the root is empty at the root itself, so only the
+	// final newline is trimmed.
+	paths := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if len(paths) < 3 || len(paths) > 4 {
 		return "", "", fmt.Errorf("Bad git rev-parse output: %q", output)
 	}
 
@@ -596,12 +1089,18 @@ func GitAndRootDirs() (string, string, error) {
 		return "", "", fmt.Errorf("Error converting %q to absolute: %s", paths[0], err)
 	}
 
-	if pathLen == 1 || len(paths[1]) == 0 {
+	if paths[1] == "true" || paths[2] != "true" {
 		return absGitDir, "", nil
 	}
+	if len(paths) != 4 {
+		return "", "", fmt.Errorf("Bad git rev-parse output: %q", output)
+	}
 
-	absRootDir := paths[1]
-	return absGitDir, absRootDir, nil
+	rootDir, err := filepath.Abs(paths[3])
+	if err != nil {
+		return "", "", fmt.Errorf("Error converting %q to absolute: %s", paths[3], err)
+	}
+	return absGitDir, rootDir, nil
 }
 
 func RootDir() (string, error) {
@@ -682,6 +1181,122 @@ func GetAllWorkTreeHEADs(storageDir string) ([]*Ref, error) {
 	return worktrees, nil
 }
 
+// inProgressHeadFiles are the files git writes to a worktree's git dir while an
+// operation which can be abandoned or resumed is underway
+var inProgressHeadFiles = []string{"MERGE_HEAD", "CHERRY_PICK_HEAD", "REVERT_HEAD", "REBASE_HEAD"}
+
+// GetAllWorkTreeInProgressRefs returns the commits referenced by in-progress
+// merges, cherry-picks, reverts and rebases in all worktrees, plus the master
+// working copy. Pass in the git storage dir (parent of 'objects') to work from
+func GetAllWorkTreeInProgressRefs(storageDir string) ([]*Ref, error) {
+	dirs, err := workTreeGitDirs(storageDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []*Ref
+	for _, dir := range dirs {
+		for _, name := range inProgressHeadFiles {
+			headfile := filepath.Join(dir, name)
+			bytes, err := ioutil.ReadFile(headfile)
+			if err != nil {
+				if !os.IsNotExist(err) {
+					tracerx.Printf("Error reading %v, skipping: %v", headfile, err)
+				}
+				continue
+			}
+
+			// MERGE_HEAD contains one line per merged commit (octopus)
+			for _, line := range strings.Split(string(bytes), "\n") {
+				sha := strings.TrimSpace(line)
+				if len(sha) == 0 {
+					continue
+				}
+				refs = append(refs, &Ref{Name: name, Type: RefTypeOther, Sha: sha})
+			}
+		}
+	}
+
+	return refs, nil
+}
+
+// GetAllWorkTreeIndexFiles returns the paths of the index files belonging to
+// all worktrees, plus the master working copy. Missing index files (e.g. in a
+// bare repo) are omitted. Pass in the git storage dir (parent of 'objects') to
+// work from
+func GetAllWorkTreeIndexFiles(storageDir string) ([]string, error) {
+	dirs, err := workTreeGitDirs(storageDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []string
+	for _, dir := range dirs {
+		index := filepath.Join(dir, "index")
+		if _, err := os.Stat(index); err == nil {
+			indexes = append(indexes, index)
+		}
+	}
+
+	return indexes, nil
+}
+
+// workTreeGitDirs returns the storage dir itself, followed by the private git
+// dir of every linked worktree (i.e. .git/worktrees/<name>)
+func workTreeGitDirs(storageDir string) ([]string, error) {
+	dirs := []string{storageDir}
+
+	worktreesdir := filepath.Join(storageDir, "worktrees")
+	direntries, err := ioutil.ReadDir(worktreesdir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return dirs, nil
+		}
+		return nil, err
+	}
+
+	for _, dirfi := range direntries {
+		if dirfi.IsDir() {
+			dirs = append(dirs, filepath.Join(worktreesdir, dirfi.Name()))
+		}
+	}
+	return dirs, nil
+}
+
+// StashRefs returns a Ref for every commit recorded by 'git stash', i.e. each
+// entry in the stash reflog plus the index and untracked files commits which
+// are recorded as its 2nd & 3rd parents. Returns an empty slice if there is no
+// stash.
+func StashRefs() ([]*Ref, error) {
+	if _, err := subprocess.SimpleExec("git", "rev-parse", "--verify", "--quiet", "refs/stash"); err != nil {
+		// no stash entries
+		return nil, nil
+	}
+
+	out, err := subprocess.SimpleExec("git", "log", "--walk-reflogs", "--format=%H %P", "refs/stash", "--")
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []*Ref
+	for i, line := range strings.Split(out, "\n") {
+		shas := strings.Fields(line)
+		if len(shas) == 0 {
+			continue
+		}
+
+		name := fmt.Sprintf("stash@{%d}", i)
+		refs = append(refs, &Ref{Name: name, Type: RefTypeOther, Sha: shas[0]})
+		// shas[1] is the commit the stash was based on, which is reachable
+		// through the usual means; shas[2:] are the index & untracked files
+		for j, sha := range shas[2:] {
+			refs = append(refs, &Ref{Name: fmt.Sprintf("%s^%d", name, j+2), Type: RefTypeOther, Sha: sha})
+		}
+	}
+
+	return refs, nil
+}
+
 // Manually parse a reference file like HEAD and return the Ref it resolves to
 func parseRefFile(filename string) (*Ref, error) {
 	bytes, err := ioutil.ReadFile(filename)
@@ -922,7 +1537,7 @@ func CachedRemoteRefs(remoteName string) ([]*Ref, error) {
 	cmd.Start()
 	scanner := bufio.NewScanner(outp)
 
-	r := regexp.MustCompile(fmt.Sprintf(`([0-9a-fA-F]{40})\s+refs/remotes/%v/(.*)`, remoteName))
+	r := regexp.MustCompile(fmt.Sprintf(`(%s)\s+refs/remotes/%v/(.*)`, ObjectIDPattern, remoteName))
 	for scanner.Scan() {
 		if match := r.FindStringSubmatch(scanner.Text()); match != nil {
 			name := strings.TrimSpace(match[2])
@@ -951,7 +1566,7 @@ func RemoteRefs(remoteName string) ([]*Ref, error) {
 	cmd.Start()
 	scanner := bufio.NewScanner(outp)
 
-	r := regexp.MustCompile(`([0-9a-fA-F]{40})\s+refs/(heads|tags)/(.*)`)
+	r := regexp.MustCompile(`(` + ObjectIDPattern + `)\s+refs/(heads|tags)/(.*)`)
 	for scanner.Scan() {
 		if match := r.FindStringSubmatch(scanner.Text()); match != nil {
 			name := strings.TrimSpace(match[3])
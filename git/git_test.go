@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -265,6 +266,128 @@ func TestWorkTrees(t *testing.T) {
 	assert.Equal(t, expectedRefs, refs, "Refs should be correct")
 }
 
+func TestStashRefs(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	refs, err := StashRefs()
+	assert.Nil(t, err)
+	assert.Empty(t, refs)
+
+	repo.AddCommits([]*test.CommitInput{
+		{Files: []*test.FileInput{{Filename: "file1.txt", Size: 20}}},
+	})
+
+	assert.Nil(t, ioutil.WriteFile("file1.txt", []byte("modified"), 0644))
+	test.RunGitCommand(t, true, "stash")
+	assert.Nil(t, ioutil.WriteFile("file1.txt", []byte("modified again"), 0644))
+	test.RunGitCommand(t, true, "stash")
+
+	refs, err = StashRefs()
+	assert.Nil(t, err)
+	// each stash entry has its own commit plus an index commit
+	if assert.Len(t, refs, 4) {
+		assert.Equal(t, "stash@{0}", refs[0].Name)
+		assert.Equal(t, "stash@{0}^2", refs[1].Name)
+		assert.Equal(t, "stash@{1}", refs[2].Name)
+		assert.Equal(t, "stash@{1}^2", refs[3].Name)
+	}
+	stash0, err := ResolveRef("stash@{0}")
+	assert.Nil(t, err)
+	assert.Equal(t, stash0.Sha, refs[0].Sha)
+}
+
+func TestWorkingCopyChanges(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	repo.AddCommits([]*test.CommitInput{
+		{Files: []*test.FileInput{
+			{Filename: "file1.txt", Size: 20},
+			{Filename: "file2.txt", Size: 20},
+			{Filename: "file3.txt", Size: 20},
+		}},
+	})
+
+	changes, err := WorkingCopyChanges()
+	assert.Nil(t, err)
+	assert.Empty(t, changes)
+
+	assert.Nil(t, ioutil.WriteFile("file1.txt", []byte("modified"), 0644))
+	test.RunGitCommand(t, true, "mv", "file2.txt", "renamed.txt")
+	assert.Nil(t, ioutil.WriteFile("untracked.txt", []byte("untracked"), 0644))
+
+	changes, err = WorkingCopyChanges()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"file1.txt":   " M",
+		"renamed.txt": "R ",
+	}, changes)
+}
+
+func TestIndexBlobs(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	repo.AddCommits([]*test.CommitInput{
+		{Files: []*test.FileInput{
+			{Filename: "file1.txt", Size: 20},
+			{Filename: "dir/file2.txt", Size: 20},
+		}},
+	})
+
+	assert.Nil(t, os.Chdir("dir"))
+
+	blobs, err := IndexBlobs()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"file1.txt":     strings.TrimSpace(test.RunGitCommand(t, true, "rev-parse", "HEAD:file1.txt")),
+		"dir/file2.txt": strings.TrimSpace(test.RunGitCommand(t, true, "rev-parse", "HEAD:dir/file2.txt")),
+	}, blobs)
+}
+
+func TestGetAllWorkTreeInProgressRefs(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	outputs := repo.AddCommits([]*test.CommitInput{
+		{Files: []*test.FileInput{{Filename: "file1.txt", Size: 20}}},
+		{NewBranch: "branch2", Files: []*test.FileInput{{Filename: "file2.txt", Size: 25}}},
+	})
+	test.RunGitCommand(t, true, "checkout", "master")
+
+	storageDir := filepath.Join(repo.Path, ".git")
+	refs, err := GetAllWorkTreeInProgressRefs(storageDir)
+	assert.Nil(t, err)
+	assert.Empty(t, refs)
+
+	test.RunGitCommand(t, true, "merge", "--no-commit", "--no-ff", "branch2")
+
+	refs, err = GetAllWorkTreeInProgressRefs(storageDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []*Ref{&Ref{"MERGE_HEAD", RefTypeOther, outputs[1].Sha}}, refs)
+
+	indexes, err := GetAllWorkTreeIndexFiles(storageDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(storageDir, "index")}, indexes)
+}
+
 func TestVersionCompare(t *testing.T) {
 	assert.True(t, IsVersionAtLeast("2.6.0", "2.6.0"))
 	assert.True(t, IsVersionAtLeast("2.6.0", "2.6"))
@@ -278,6 +401,20 @@ func TestVersionCompare(t *testing.T) {
 	assert.False(t, IsVersionAtLeast("2.5.2", "2.5.10"))
 }
 
+func TestRefspec(t *testing.T) {
+	for _, fullref := range []string{
+		"refs/heads/release/1.0",
+		"refs/remotes/origin/master",
+		"refs/tags/v1.0",
+		"refs/stash",
+		"HEAD",
+	} {
+		typ, name := ParseRefToTypeAndName(fullref)
+		ref := &Ref{Name: name, Type: typ}
+		assert.Equal(t, fullref, ref.Refspec())
+	}
+}
+
 func TestGitAndRootDirs(t *testing.T) {
 	repo := test.NewRepo(t)
 	repo.Pushd()
@@ -304,6 +441,39 @@ func TestGitAndRootDirs(t *testing.T) {
 	assert.True(t, os.SameFile(expected, actual))
 }
 
+func TestGitAndRootDirsInSubdirectory(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	if err := os.MkdirAll(filepath.Join("a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Join("a", "b")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, root, err := GitAndRootDirs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := os.Stat(repo.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := os.Stat(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, os.SameFile(expected, actual))
+}
+
 func TestGetTrackedFiles(t *testing.T) {
 	repo := test.NewRepo(t)
 	repo.Pushd()
@@ -465,3 +635,194 @@ func TestLocalRefs(t *testing.T) {
 		t.Errorf("Unexpected local refs: %v", actual)
 	}
 }
+
+func TestObjectIDs(t *testing.T) {
+	sha1 := "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	sha256 := "6ef19b41225c5369f1c104d45d8d85efa9b057b53b14b4b9b939dd74decc5321"
+
+	for _, sha := range []string{sha1, sha256, strings.ToUpper(sha1)} {
+		assert.True(t, IsObjectID(sha), sha)
+		assert.False(t, IsZeroObjectID(sha), sha)
+	}
+	for _, sha := range []string{"", sha1[:39], sha256 + "0", sha1[:39] + "g", "HEAD"} {
+		assert.False(t, IsObjectID(sha), sha)
+	}
+	assert.True(t, IsZeroObjectID(strings.Repeat("0", 40)))
+	assert.True(t, IsZeroObjectID(strings.Repeat("0", 64)))
+	assert.False(t, IsZeroObjectID(strings.Repeat("0", 20)))
+
+	sha, rest, ok := SplitObjectLine(sha256 + " path/with spaces.dat")
+	assert.True(t, ok)
+	assert.Equal(t, sha256, sha)
+	assert.Equal(t, "path/with spaces.dat", rest)
+
+	sha, rest, ok = SplitObjectLine(sha1)
+	assert.True(t, ok)
+	assert.Equal(t, sha1, sha)
+	assert.Equal(t, "", rest)
+
+	_, _, ok = SplitObjectLine("not an object name")
+	assert.False(t, ok)
+}
+
+func TestSHA256Repository(t *testing.T) {
+	repo := test.NewCustomRepo(t, &test.RepoCreateSettings{
+		RepoType:     test.RepoTypeNormal,
+		ObjectFormat: ObjectFormatSHA256,
+	})
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	assert.Equal(t, ObjectFormatSHA256, ObjectFormat())
+	assert.Equal(t, RefBeforeFirstCommitSHA256, EmptyTree())
+	assert.Equal(t, EmptyBlobSHA256, EmptyBlob())
+
+	outputs := repo.AddCommits([]*test.CommitInput{
+		{
+			Files: []*test.FileInput{
+				{Filename: "file1.txt", Size: 20},
+			},
+			Tags: []string{"v1"},
+		},
+	})
+	assert.Len(t, outputs[0].Sha, 64)
+
+	refs, err := LocalRefs()
+	assert.Nil(t, err)
+	actual := make(map[string]string)
+	for _, r := range refs {
+		actual[r.Name] = r.Sha
+	}
+	assert.Len(t, actual, 2)
+	assert.Equal(t, outputs[0].Sha, actual["master"])
+	// v1 is an annotated tag, so is its own object
+	assert.Len(t, actual["v1"], 64)
+}
+
+func TestShallowAndPartialClones(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	outputs := repo.AddCommits([]*test.CommitInput{
+		{Files: []*test.FileInput{{Filename: "file1.txt", Size: 20}}},
+	})
+
+	assert.False(t, IsShallowRepository())
+	assert.False(t, IsPartialClone())
+	shallow, err := ShallowCommits()
+	assert.Nil(t, err)
+	assert.Empty(t, shallow)
+
+	gitDir, err := GitDir()
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(gitDir, "shallow"), []byte(outputs[0].Sha+"\n"), 0644))
+	assert.True(t, IsShallowRepository())
+	shallow, err = ShallowCommits()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{outputs[0].Sha}, shallow)
+
+	test.RunGitCommand(t, true, "config", "remote.origin.promisor", "false")
+	assert.False(t, IsPartialClone())
+	test.RunGitCommand(t, true, "config", "remote.origin.promisor", "true")
+	assert.True(t, IsPartialClone())
+}
+
+func TestChangedTreeEntriesAndCheckAttr(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	outputs := repo.AddCommits([]*test.CommitInput{
+		{Files: []*test.FileInput{
+			{Filename: "dir/file.dat", Size: 20},
+			{Filename: "file.txt", Size: 20},
+			{Filename: "pushed.txt", Size: 20},
+		}},
+		{Files: []*test.FileInput{
+			{Filename: "dir/file.dat", Size: 30},
+			{Filename: "file.txt", Size: 30},
+		}},
+	})
+
+	// the attributes of the working tree apply
+	assert.Nil(t, ioutil.WriteFile(".gitattributes", []byte("*.dat filter=lfs\n"), 0644))
+	assert.Nil(t, os.Chdir("dir"))
+
+	entries, err := ChangedTreeEntries("HEAD", "origin")
+	assert.Nil(t, err)
+	assert.Len(t, entries, 3)
+
+	// files the remote has the commits of aren't changed
+	test.RunGitCommand(t, true, "update-ref", "refs/remotes/origin/master", outputs[0].Sha)
+	entries, err = ChangedTreeEntries("HEAD", "origin")
+	assert.Nil(t, err)
+	var paths []string
+	for _, e := range entries {
+		assert.True(t, e.IsRegular())
+		assert.Equal(t, strings.TrimSpace(test.RunGitCommand(t, true, "rev-parse", "HEAD:"+e.Path)), e.Sha1)
+		paths = append(paths, e.Path)
+	}
+	assert.Equal(t, []string{"dir/file.dat", "file.txt"}, paths)
+
+	filters, err := CheckAttr("filter", paths)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"dir/file.dat": "lfs",
+		"file.txt":     "unspecified",
+	}, filters)
+}
+
+func TestChangedIndexEntries(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	assert.Nil(t, ioutil.WriteFile("staged.txt", []byte("staged"), 0644))
+	test.RunGitCommand(t, true, "add", "staged.txt")
+
+	// every file is changed before the first commit
+	entries, err := ChangedIndexEntries()
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+
+	repo.AddCommits([]*test.CommitInput{
+		{Files: []*test.FileInput{
+			{Filename: "unchanged.txt", Size: 20},
+			{Filename: "modified.txt", Size: 20},
+			{Filename: "deleted.txt", Size: 20},
+		}},
+	})
+
+	assert.Nil(t, ioutil.WriteFile("staged.txt", []byte("staged again"), 0644))
+	test.RunGitCommand(t, true, "add", "staged.txt")
+	staged := strings.TrimSpace(test.RunGitCommand(t, true, "rev-parse", ":staged.txt"))
+	assert.Nil(t, ioutil.WriteFile("staged.txt", []byte("modified again"), 0644))
+	assert.Nil(t, ioutil.WriteFile("modified.txt", []byte("modified"), 0644))
+	test.RunGitCommand(t, true, "rm", "-q", "--cached", "deleted.txt")
+
+	entries, err = ChangedIndexEntries()
+	assert.Nil(t, err)
+	actual := make(map[string]string)
+	for _, e := range entries {
+		assert.Equal(t, "100644", e.Mode)
+		actual[e.Path] = e.Sha1
+	}
+	// files are as they're staged, rather than in the working tree
+	assert.Equal(t, map[string]string{
+		"staged.txt":   staged,
+		"modified.txt": strings.TrimSpace(test.RunGitCommand(t, true, "rev-parse", ":modified.txt")),
+	}, actual)
+}
@@ -0,0 +1,53 @@
+package githistory
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/subprocess"
+)
+
+// DiffTree returns the blobs which were added or modified by the given commit,
+// compared to its first parent, or to the empty tree if it has no parents.
+// Deleted files, symlinks and submodules are not returned.
+func DiffTree(c *Commit) ([]*TreeEntry, error) {
+	args := []string{"diff-tree", "-r", "-z", "--no-renames", "--no-commit-id"}
+	if len(c.Parents) > 0 {
+		args = append(args, c.Parents[0], c.Sha)
+	} else {
+		args = append(args, "--root", c.Sha)
+	}
+
+	out, err := subprocess.ExecCommand("git", args...).Output()
+	if err != nil {
+		return nil, errors.Wrap(err, "git diff-tree")
+	}
+
+	return parseDiffTree(out)
+}
+
+// parseDiffTree parses the output of 'git diff-tree -r -z --no-renames', which
+// is a sequence of ":<old mode> SP <new mode> SP <old oid> SP <new oid> SP
+// <status> NUL <path> NUL" records.
+func parseDiffTree(out []byte) ([]*TreeEntry, error) {
+	var entries []*TreeEntry
+
+	records := bytes.Split(out, []byte{0})
+	for i := 0; i+1 < len(records); i += 2 {
+		header := string(records[i])
+		fields := strings.Fields(strings.TrimPrefix(header, ":"))
+		if !strings.HasPrefix(header, ":") || len(fields) != 5 {
+			return nil, fmt.Errorf("invalid diff-tree output: %q", header)
+		}
+
+		mode, oid, status := fields[1], fields[3], fields[4]
+		if status == "D" || mode == "120000" || mode == "160000" {
+			continue
+		}
+
+		entries = append(entries, &TreeEntry{Mode: mode, Oid: oid, Path: string(records[i+1])})
+	}
+	return entries, nil
+}
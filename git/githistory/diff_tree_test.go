@@ -0,0 +1,27 @@
+package githistory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDiffTreeSkipsDeletionsSymlinksAndSubmodules(t *testing.T) {
+	out := []byte(":000000 100644 0000000000000000000000000000000000000000 e69de29bb2d1d6434b8b29ae775ad8c2e48c5391 A\x00added.dat\x00" +
+		":100644 100755 e69de29bb2d1d6434b8b29ae775ad8c2e48c5391 2e65efe2a145dda7ee51d1741299f848e5bf752e M\x00dir/modified.sh\x00" +
+		":100644 000000 e69de29bb2d1d6434b8b29ae775ad8c2e48c5391 0000000000000000000000000000000000000000 D\x00deleted.dat\x00" +
+		":000000 120000 0000000000000000000000000000000000000000 2e65efe2a145dda7ee51d1741299f848e5bf752e A\x00link\x00" +
+		":000000 160000 0000000000000000000000000000000000000000 4b825dc642cb6eb9a060e54bf8d69288fbee4904 A\x00submodule\x00")
+
+	entries, err := parseDiffTree(out)
+	assert.Nil(t, err)
+	assert.Equal(t, []*TreeEntry{
+		{Mode: "100644", Oid: "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", Path: "added.dat"},
+		{Mode: "100755", Oid: "2e65efe2a145dda7ee51d1741299f848e5bf752e", Path: "dir/modified.sh"},
+	}, entries)
+}
+
+func TestParseDiffTreeRejectsInvalidOutput(t *testing.T) {
+	_, err := parseDiffTree([]byte("not diff-tree output\x00path\x00"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,374 @@
+// Package githistory rewrites ranges of commits by replacing the blobs in
+// their trees, shelling out to git's plumbing commands to do so.
+// NOTE: Subject to change, do not rely on this package from outside git-lfs source
+package githistory
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/rubyist/tracerx"
+)
+
+// TreeEntry is a single blob in the (recursive) tree of a commit.
+type TreeEntry struct {
+	// Mode is the octal file mode of the entry, e.g. "100644".
+	Mode string
+	// Oid is the SHA-1 of the blob.
+	Oid string
+	// Path is the slash-separated path of the entry, relative to the root
+	// of the tree.
+	Path string
+}
+
+// Commit is a commit which is being rewritten.
+type Commit struct {
+	// Sha is the SHA-1 of the original commit.
+	Sha string
+	// Parents are the SHA-1s of the original commit's parents.
+	Parents []string
+}
+
+// BlobFn is called for every blob of every commit being rewritten, and
+// returns the SHA-1 of the blob which should replace it, or entry.Oid to leave
+// it as it is.
+type BlobFn func(c *Commit, entry *TreeEntry) (string, error)
+
+// RewriteOptions says which commits to rewrite, and how.
+type RewriteOptions struct {
+	// Include are the revisions whose history should be rewritten, e.g.
+	// "HEAD".
+	Include []string
+	// Exclude are revisions whose history should be left as it is, e.g.
+	// "@{upstream}". Rev-list options such as "--remotes" may also be
+	// given.
+	Exclude []string
+	// BlobFn is called for each blob; see BlobFn.
+	BlobFn BlobFn
+}
+
+// Rewriter rewrites the history of a repository. The zero value is ready to
+// use, and operates on the repository in the current working directory.
+type Rewriter struct {
+	// rewritten maps original commit SHA-1s to their rewritten ones.
+	rewritten map[string]string
+}
+
+// NewRewriter returns a new *Rewriter.
+func NewRewriter() *Rewriter {
+	return &Rewriter{rewritten: make(map[string]string)}
+}
+
+// Rewrite rewrites each commit selected by opt, oldest first, replacing blobs
+// as directed by opt.BlobFn and re-parenting each commit onto the rewritten
+// version of its parents. Commits whose tree and parents are unchanged keep
+// their SHA-1.
+//
+// Rewrite only writes new objects: it is up to the caller to point refs at
+// the results, which are available from Rewritten.
+func (r *Rewriter) Rewrite(opt *RewriteOptions) error {
+	if r.rewritten == nil {
+		r.rewritten = make(map[string]string)
+	}
+
+	commits, err := RevList(opt.Include, opt.Exclude)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range commits {
+		newSha, err := r.rewriteCommit(c, opt.BlobFn)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("rewrite commit %s", c.Sha))
+		}
+
+		tracerx.Printf("githistory: %s -> %s", c.Sha, newSha)
+		r.rewritten[c.Sha] = newSha
+	}
+
+	return nil
+}
+
+// Rewritten returns the SHA-1 that the given commit was rewritten to, or sha
+// itself if it was not part of the rewritten range.
+func (r *Rewriter) Rewritten(sha string) string {
+	if newSha, ok := r.rewritten[sha]; ok {
+		return newSha
+	}
+	return sha
+}
+
+func (r *Rewriter) rewriteCommit(c *Commit, fn BlobFn) (string, error) {
+	entries, err := LsTree(c.Sha)
+	if err != nil {
+		return "", err
+	}
+
+	var changed []*TreeEntry
+	for _, entry := range entries {
+		oid, err := fn(c, entry)
+		if err != nil {
+			return "", err
+		}
+
+		if oid != entry.Oid {
+			changed = append(changed, &TreeEntry{Mode: entry.Mode, Oid: oid, Path: entry.Path})
+		}
+	}
+
+	parents := make([]string, len(c.Parents))
+	parentsChanged := false
+	for i, p := range c.Parents {
+		parents[i] = r.Rewritten(p)
+		if parents[i] != p {
+			parentsChanged = true
+		}
+	}
+
+	if len(changed) == 0 && !parentsChanged {
+		return c.Sha, nil
+	}
+
+	tree, err := writeTree(c.Sha, changed)
+	if err != nil {
+		return "", err
+	}
+
+	return commitTree(c.Sha, tree, parents)
+}
+
+// ReadBlob returns the contents of the blob with the given SHA-1.
+func ReadBlob(oid string) (io.ReadCloser, error) {
+	cmd := subprocess.ExecCommand("git", "cat-file", "blob", oid)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &blobReader{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+type blobReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (b *blobReader) Close() error {
+	b.ReadCloser.Close()
+	return b.cmd.Wait()
+}
+
+// WriteBlob writes the contents of r to the object database as a blob, and
+// returns its SHA-1.
+func WriteBlob(r io.Reader) (string, error) {
+	cmd := subprocess.ExecCommand("git", "hash-object", "-w", "--stdin")
+	cmd.Stdin = r
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrap(err, "git hash-object")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// RevList returns the commits reachable from include but not exclude, oldest
+// first, with each commit after all of its parents.
+func RevList(include, exclude []string) ([]*Commit, error) {
+	args := []string{"rev-list", "--reverse", "--topo-order", "--parents"}
+	args = append(args, include...)
+	if len(exclude) > 0 {
+		args = append(args, "--not")
+		args = append(args, exclude...)
+	}
+	args = append(args, "--")
+
+	out, err := subprocess.SimpleExec("git", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*Commit
+	for _, line := range strings.Split(out, "\n") {
+		shas := strings.Fields(line)
+		if len(shas) == 0 {
+			continue
+		}
+		commits = append(commits, &Commit{Sha: shas[0], Parents: shas[1:]})
+	}
+	return commits, nil
+}
+
+// LsTree returns every blob in the tree of the given commit, excluding
+// symlinks and submodules.
+func LsTree(sha string) ([]*TreeEntry, error) {
+	cmd := subprocess.ExecCommand("git", "ls-tree", "-r", "-z", "--full-tree", sha)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrap(err, "git ls-tree")
+	}
+
+	return parseLsTree(out)
+}
+
+// parseLsTree parses the output of 'git ls-tree -r -z', which is a sequence of
+// "<mode> SP <type> SP <oid> TAB <path> NUL" records.
+func parseLsTree(out []byte) ([]*TreeEntry, error) {
+	var entries []*TreeEntry
+	for _, record := range bytes.Split(out, []byte{0}) {
+		if len(record) == 0 {
+			continue
+		}
+
+		tab := bytes.IndexByte(record, '\t')
+		if tab < 0 {
+			return nil, fmt.Errorf("invalid ls-tree output: %q", record)
+		}
+
+		fields := strings.Fields(string(record[:tab]))
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid ls-tree output: %q", record)
+		}
+
+		// skip symlinks & submodules, which aren't file contents
+		if fields[1] != "blob" || fields[0] == "120000" {
+			continue
+		}
+
+		entries = append(entries, &TreeEntry{
+			Mode: fields[0],
+			Oid:  fields[2],
+			Path: string(record[tab+1:]),
+		})
+	}
+	return entries, nil
+}
+
+// writeTree writes a tree which is the tree of the given commit with the given
+// entries replaced, and returns its SHA-1. A temporary index file is used so
+// that the user's index is untouched.
+func writeTree(sha string, changed []*TreeEntry) (string, error) {
+	tmpdir, err := ioutil.TempDir("", "git-lfs-index")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	env := append(os.Environ(), "GIT_INDEX_FILE="+filepath.Join(tmpdir, "index"))
+
+	readTree := subprocess.ExecCommand("git", "read-tree", sha)
+	readTree.Env = env
+	if out, err := readTree.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git read-tree %s: %v: %s", sha, err, out)
+	}
+
+	var info bytes.Buffer
+	for _, entry := range changed {
+		fmt.Fprintf(&info, "%s %s\t%s\x00", entry.Mode, entry.Oid, entry.Path)
+	}
+
+	updateIndex := subprocess.ExecCommand("git", "update-index", "-z", "--index-info")
+	updateIndex.Env = env
+	updateIndex.Stdin = &info
+	if out, err := updateIndex.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git update-index: %v: %s", err, out)
+	}
+
+	writeTree := subprocess.ExecCommand("git", "write-tree")
+	writeTree.Env = env
+	out, err := writeTree.Output()
+	if err != nil {
+		return "", errors.Wrap(err, "git write-tree")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// commitTree writes a copy of the given commit with a new tree and parents,
+// preserving its author, committer and message, and returns its SHA-1.
+func commitTree(sha, tree string, parents []string) (string, error) {
+	raw, err := subprocess.ExecCommand("git", "cat-file", "commit", sha).Output()
+	if err != nil {
+		return "", errors.Wrap(err, "git cat-file")
+	}
+
+	env, message, err := parseCommitEnv(raw)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"commit-tree", tree}
+	for _, p := range parents {
+		args = append(args, "-p", p)
+	}
+
+	cmd := subprocess.ExecCommand("git", args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = bytes.NewReader(message)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrap(err, "git commit-tree")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// parseCommitEnv parses the raw contents of a commit object, and returns the
+// environment which makes 'git commit-tree' record the same author and
+// committer, along with the commit message.
+func parseCommitEnv(raw []byte) ([]string, []byte, error) {
+	var env []string
+
+	r := bufio.NewReader(bytes.NewReader(raw))
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid commit object: %q", raw)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if len(line) == 0 {
+			break
+		}
+
+		key := strings.SplitN(line, " ", 2)[0]
+		var prefix string
+		switch key {
+		case "author":
+			prefix = "GIT_AUTHOR_"
+		case "committer":
+			prefix = "GIT_COMMITTER_"
+		default:
+			continue
+		}
+
+		ident := strings.TrimPrefix(line, key+" ")
+		lt, gt := strings.Index(ident, "<"), strings.LastIndex(ident, ">")
+		if lt < 0 || gt < lt {
+			return nil, nil, fmt.Errorf("invalid %s in commit object: %q", key, ident)
+		}
+
+		env = append(env,
+			prefix+"NAME="+strings.TrimSpace(ident[:lt]),
+			prefix+"EMAIL="+ident[lt+1:gt],
+			prefix+"DATE="+strings.TrimSpace(ident[gt+1:]),
+		)
+	}
+
+	message, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return env, message, nil
+}
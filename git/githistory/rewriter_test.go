@@ -0,0 +1,47 @@
+package githistory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLsTreeSkipsSymlinksAndSubmodules(t *testing.T) {
+	out := []byte("100644 blob e69de29bb2d1d6434b8b29ae775ad8c2e48c5391\ta.txt\x00" +
+		"100755 blob e69de29bb2d1d6434b8b29ae775ad8c2e48c5391\tdir/with space.sh\x00" +
+		"120000 blob 2e65efe2a145dda7ee51d1741299f848e5bf752e\tlink\x00" +
+		"160000 commit 4b825dc642cb6eb9a060e54bf8d69288fbee4904\tsubmodule\x00")
+
+	entries, err := parseLsTree(out)
+	assert.Nil(t, err)
+	assert.Equal(t, []*TreeEntry{
+		{Mode: "100644", Oid: "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", Path: "a.txt"},
+		{Mode: "100755", Oid: "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", Path: "dir/with space.sh"},
+	}, entries)
+}
+
+func TestParseLsTreeRejectsInvalidOutput(t *testing.T) {
+	_, err := parseLsTree([]byte("not ls-tree output\x00"))
+	assert.NotNil(t, err)
+}
+
+func TestParseCommitEnv(t *testing.T) {
+	raw := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent e69de29bb2d1d6434b8b29ae775ad8c2e48c5391\n" +
+		"author A U Thor <author@example.com> 1136214245 -0700\n" +
+		"committer C O Mitter <committer@example.com> 1136214246 +0100\n" +
+		"\n" +
+		"Subject\n\n  indented body\n")
+
+	env, message, err := parseCommitEnv(raw)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"GIT_AUTHOR_NAME=A U Thor",
+		"GIT_AUTHOR_EMAIL=author@example.com",
+		"GIT_AUTHOR_DATE=1136214245 -0700",
+		"GIT_COMMITTER_NAME=C O Mitter",
+		"GIT_COMMITTER_EMAIL=committer@example.com",
+		"GIT_COMMITTER_DATE=1136214246 +0100",
+	}, env)
+	assert.Equal(t, "Subject\n\n  indented body\n", string(message))
+}
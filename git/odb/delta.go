@@ -0,0 +1,96 @@
+package odb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var errInvalidDelta = errors.New("invalid delta")
+
+// readDeltaSize reads one of the little-endian base 128 sizes at the start of
+// a delta.
+func readDeltaSize(r io.ByteReader) (uint64, error) {
+	var size uint64
+	for shift := uint(0); ; shift += 7 {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		size |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return size, nil
+		}
+	}
+}
+
+// applyDelta returns the object made by applying the given delta to base: a
+// series of instructions to copy a range of base, or insert new data.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	r := bytes.NewReader(delta)
+
+	baseSize, err := readDeltaSize(r)
+	if err != nil {
+		return nil, errInvalidDelta
+	}
+	if baseSize != uint64(len(base)) {
+		return nil, fmt.Errorf("delta base is %d bytes, expected %d", len(base), baseSize)
+	}
+	size, err := readDeltaSize(r)
+	if err != nil {
+		return nil, errInvalidDelta
+	}
+
+	result := make([]byte, 0, size)
+	for r.Len() > 0 {
+		op, _ := r.ReadByte()
+
+		switch {
+		case op&0x80 != 0:
+			// Copy: the bits of op say which bytes of the offset
+			// and size follow.
+			var offset, n uint64
+			for i := uint(0); i < 4; i++ {
+				if op&(1<<i) != 0 {
+					c, err := r.ReadByte()
+					if err != nil {
+						return nil, errInvalidDelta
+					}
+					offset |= uint64(c) << (8 * i)
+				}
+			}
+			for i := uint(0); i < 3; i++ {
+				if op&(0x10<<i) != 0 {
+					c, err := r.ReadByte()
+					if err != nil {
+						return nil, errInvalidDelta
+					}
+					n |= uint64(c) << (8 * i)
+				}
+			}
+			if n == 0 {
+				n = 0x10000
+			}
+			if offset+n > uint64(len(base)) {
+				return nil, errInvalidDelta
+			}
+			result = append(result, base[offset:offset+n]...)
+		case op != 0:
+			// Insert the next op bytes.
+			if r.Len() < int(op) {
+				return nil, errInvalidDelta
+			}
+			start := len(delta) - r.Len()
+			result = append(result, delta[start:start+int(op)]...)
+			r.Seek(int64(op), io.SeekCurrent)
+		default:
+			return nil, errInvalidDelta
+		}
+	}
+
+	if uint64(len(result)) != size {
+		return nil, fmt.Errorf("delta result is %d bytes, expected %d", len(result), size)
+	}
+	return result, nil
+}
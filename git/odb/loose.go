@@ -0,0 +1,87 @@
+package odb
+
+import (
+	"bufio"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// openLoose opens the loose object with the given SHA-1 in dir, returning a
+// reader of its contents after the "<type> <size>\0" header, which is parsed.
+func openLoose(dir, sha string) (io.ReadCloser, string, int64, error) {
+	f, err := os.Open(filepath.Join(dir, sha[0:2], sha[2:]))
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	zr, err := zlib.NewReader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, "", 0, fmt.Errorf("odb: loose object %s: %v", sha, err)
+	}
+
+	br := bufio.NewReader(zr)
+	header, err := br.ReadString(0)
+	if err != nil {
+		f.Close()
+		return nil, "", 0, fmt.Errorf("odb: loose object %s: invalid header: %v", sha, err)
+	}
+
+	fields := strings.Fields(strings.TrimSuffix(header, "\x00"))
+	if len(fields) != 2 {
+		f.Close()
+		return nil, "", 0, fmt.Errorf("odb: loose object %s: invalid header %q", sha, header)
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		f.Close()
+		return nil, "", 0, fmt.Errorf("odb: loose object %s: invalid size %q", sha, fields[1])
+	}
+
+	return &looseReader{Reader: br, f: f}, fields[0], size, nil
+}
+
+type looseReader struct {
+	io.Reader
+	f *os.File
+}
+
+func (r *looseReader) Close() error {
+	return r.f.Close()
+}
+
+// statLoose returns the type and size of the loose object with the given
+// SHA-1 in dir, or an error satisfying os.IsNotExist if there is none.
+func statLoose(dir, sha string) (string, int64, error) {
+	r, typ, size, err := openLoose(dir, sha)
+	if err != nil {
+		return "", 0, err
+	}
+	r.Close()
+	return typ, size, nil
+}
+
+// readLoose returns the type and contents of the loose object with the given
+// SHA-1 in dir, or an error satisfying os.IsNotExist if there is none.
+func readLoose(dir, sha string) (string, []byte, error) {
+	r, typ, size, err := openLoose(dir, sha)
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", nil, fmt.Errorf("odb: loose object %s: %v", sha, err)
+	}
+	if int64(len(data)) != size {
+		return "", nil, fmt.Errorf("odb: loose object %s: expected %d bytes, read %d", sha, size, len(data))
+	}
+	return typ, data, nil
+}
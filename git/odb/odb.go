@@ -0,0 +1,222 @@
+// Package odb reads objects from a Git repository's object database directly,
+// from its loose objects and packfiles, without starting any git processes.
+// NOTE: Subject to change, do not rely on this package from outside git-lfs source
+package odb
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Object types, as named by git.
+const (
+	TypeCommit = "commit"
+	TypeTree   = "tree"
+	TypeBlob   = "blob"
+	TypeTag    = "tag"
+)
+
+// notFoundError is returned when an object isn't in the database.
+type notFoundError struct {
+	sha string
+}
+
+func (e *notFoundError) Error() string {
+	return fmt.Sprintf("odb: object %s not found", e.sha)
+}
+
+// IsNotFound returns whether err says that an object isn't in the database.
+func IsNotFound(err error) bool {
+	_, ok := err.(*notFoundError)
+	return ok
+}
+
+// ObjectDatabase reads the objects in an objects directory, such as
+// ".git/objects", and in any alternates it lists. It is safe for concurrent use.
+type ObjectDatabase struct {
+	dirs  []string
+	packs []*packfile
+	// hashSize is the size of the binary names of objects: 20 bytes for
+	// SHA-1, or 32 for SHA-256.
+	hashSize int
+
+	mu sync.Mutex
+}
+
+// FromFilesystem opens the object database in the given objects directory of
+// a repository with SHA-1 object names. Packs added to it later, e.g. by
+// "git gc", aren't seen.
+func FromFilesystem(root string) (*ObjectDatabase, error) {
+	return FromFilesystemWithFormat(root, "sha1")
+}
+
+// FromFilesystemWithFormat is FromFilesystem for a repository with the given
+// object format, as "git rev-parse --show-object-format" names it: "sha1" or
+// "sha256".
+func FromFilesystemWithFormat(root, format string) (*ObjectDatabase, error) {
+	d := &ObjectDatabase{hashSize: sha1.Size}
+	if format == "sha256" {
+		d.hashSize = sha256.Size
+	}
+	if err := d.addDir(root, 0); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// maxAlternateDepth is how deep alternates of alternates are followed, as git
+// does.
+const maxAlternateDepth = 5
+
+func (d *ObjectDatabase) addDir(dir string, depth int) error {
+	for _, existing := range d.dirs {
+		if existing == dir {
+			return nil
+		}
+	}
+	d.dirs = append(d.dirs, dir)
+
+	idxs, err := filepath.Glob(filepath.Join(dir, "pack", "pack-*.idx"))
+	if err != nil {
+		return err
+	}
+	// Newer packs are likelier to have the objects being looked for, as
+	// git assumes too.
+	sort.Sort(sort.Reverse(byModTime(idxs)))
+	for _, idx := range idxs {
+		p, err := openPackfile(idx, d.hashSize)
+		if err != nil {
+			return err
+		}
+		d.packs = append(d.packs, p)
+	}
+
+	if depth >= maxAlternateDepth {
+		return nil
+	}
+	return d.addAlternates(dir, depth)
+}
+
+// addAlternates adds the object directories listed in the
+// "info/alternates" file of dir, relative to dir if they aren't absolute.
+func (d *ObjectDatabase) addAlternates(dir string, depth int) error {
+	f, err := os.Open(filepath.Join(dir, "info", "alternates"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(dir, line)
+		}
+		if err := d.addDir(filepath.Clean(line), depth+1); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Close closes the packfiles of the database.
+func (d *ObjectDatabase) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var firstErr error
+	for _, p := range d.packs {
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	d.packs = nil
+	return firstErr
+}
+
+// Stat returns the type and size of the object with the given name, reading no
+// more of it than needed to do so.
+func (d *ObjectDatabase) Stat(sha string) (string, int64, error) {
+	bsha, err := d.decodeSha(sha)
+	if err != nil {
+		return "", 0, err
+	}
+
+	for _, p := range d.packs {
+		if offset, ok := p.find(bsha); ok {
+			return p.stat(d, offset)
+		}
+	}
+	for _, dir := range d.dirs {
+		typ, size, err := statLoose(dir, sha)
+		if err == nil || !os.IsNotExist(err) {
+			return typ, size, err
+		}
+	}
+	return "", 0, &notFoundError{sha}
+}
+
+// Read returns the type and contents of the object with the given name.
+func (d *ObjectDatabase) Read(sha string) (string, []byte, error) {
+	bsha, err := d.decodeSha(sha)
+	if err != nil {
+		return "", nil, err
+	}
+	return d.read(bsha)
+}
+
+func (d *ObjectDatabase) read(bsha []byte) (string, []byte, error) {
+	for _, p := range d.packs {
+		if offset, ok := p.find(bsha); ok {
+			return p.read(d, offset)
+		}
+	}
+
+	sha := hex.EncodeToString(bsha)
+	for _, dir := range d.dirs {
+		typ, data, err := readLoose(dir, sha)
+		if err == nil || !os.IsNotExist(err) {
+			return typ, data, err
+		}
+	}
+	return "", nil, &notFoundError{sha}
+}
+
+func (d *ObjectDatabase) decodeSha(sha string) ([]byte, error) {
+	b, err := hex.DecodeString(sha)
+	if err != nil || len(b) != d.hashSize {
+		return nil, fmt.Errorf("odb: invalid object name %q", sha)
+	}
+	return b, nil
+}
+
+// byModTime sorts paths from the least to the most recently modified.
+type byModTime []string
+
+func (s byModTime) Len() int      { return len(s) }
+func (s byModTime) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byModTime) Less(i, j int) bool {
+	return modTime(s[i]) < modTime(s[j])
+}
+
+func modTime(path string) int64 {
+	if info, err := os.Stat(path); err == nil {
+		return info.ModTime().UnixNano()
+	}
+	return 0
+}
@@ -0,0 +1,195 @@
+package odb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyDelta(t *testing.T) {
+	base := []byte("hello world")
+	delta := []byte{
+		11,      // base size
+		12,      // result size
+		0x90, 5, // copy 5 bytes from offset 0
+		2, ',', ' ', // insert ", "
+		0x91, 6, 5, // copy 5 bytes from offset 6
+	}
+
+	result, err := applyDelta(base, delta)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello, world", string(result))
+}
+
+func TestApplyDeltaRejectsWrongBase(t *testing.T) {
+	_, err := applyDelta([]byte("hello"), []byte{11, 1, 1, 'x'})
+	assert.NotNil(t, err)
+}
+
+func TestApplyDeltaRejectsCopyOutOfRange(t *testing.T) {
+	_, err := applyDelta([]byte("hello"), []byte{5, 10, 0x90, 10})
+	assert.NotNil(t, err)
+}
+
+func TestReadLooseObjects(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo)
+
+	commitFiles(t, repo, 3)
+	assertMatchesGit(t, repo)
+}
+
+func TestReadPackedObjectsWithDeltas(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo)
+
+	commitFiles(t, repo, 10)
+	git(t, repo, "repack", "-a", "-d", "-f", "--depth=50", "--window=50")
+
+	packs, _ := filepath.Glob(filepath.Join(repo, ".git", "objects", "pack", "*.pack"))
+	require.Len(t, packs, 1)
+	verify := git(t, repo, "verify-pack", "-v", packs[0])
+	require.Contains(t, verify, "chain length", "expected the pack to have deltas")
+
+	assertMatchesGit(t, repo)
+}
+
+func TestReadPackedObjectsWithRefDeltas(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo)
+
+	commitFiles(t, repo, 10)
+	git(t, repo, "-c", "repack.useDeltaBaseOffset=false", "repack", "-a", "-d", "-f", "--depth=50", "--window=50")
+
+	assertMatchesGit(t, repo)
+}
+
+func TestReadObjectsFromAlternates(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo)
+	commitFiles(t, repo, 2)
+	git(t, repo, "repack", "-a", "-d")
+
+	clone, err := ioutil.TempDir("", "odb-alternates")
+	require.Nil(t, err)
+	defer os.RemoveAll(clone)
+	git(t, clone, "clone", "-q", "--shared", repo, ".")
+
+	db, err := FromFilesystem(filepath.Join(clone, ".git", "objects"))
+	require.Nil(t, err)
+	defer db.Close()
+
+	sha := strings.TrimSpace(git(t, clone, "rev-parse", "HEAD"))
+	typ, _, err := db.Read(sha)
+	assert.Nil(t, err)
+	assert.Equal(t, TypeCommit, typ)
+}
+
+func TestReadSHA256Objects(t *testing.T) {
+	repo := newTestRepo(t, "--object-format=sha256")
+	defer os.RemoveAll(repo)
+
+	commitFiles(t, repo, 10)
+	assertMatchesGit(t, repo)
+
+	git(t, repo, "-c", "repack.useDeltaBaseOffset=false", "repack", "-a", "-d", "-f", "--depth=50", "--window=50")
+	assertMatchesGit(t, repo)
+
+	// SHA-1 names aren't the names of objects in SHA-256 repositories
+	db, err := FromFilesystemWithFormat(filepath.Join(repo, ".git", "objects"), "sha256")
+	require.Nil(t, err)
+	defer db.Close()
+	_, _, err = db.Read(strings.Repeat("0", 40))
+	assert.False(t, IsNotFound(err))
+	_, _, err = db.Read(strings.Repeat("0", 64))
+	assert.True(t, IsNotFound(err))
+}
+
+func TestObjectNotFound(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo)
+
+	db, err := FromFilesystem(filepath.Join(repo, ".git", "objects"))
+	require.Nil(t, err)
+	defer db.Close()
+
+	_, _, err = db.Read(strings.Repeat("0", 40))
+	assert.True(t, IsNotFound(err))
+	_, _, err = db.Stat(strings.Repeat("0", 40))
+	assert.True(t, IsNotFound(err))
+}
+
+// assertMatchesGit checks that every object in repo is read as
+// "git cat-file" reads it.
+func assertMatchesGit(t *testing.T, repo string) {
+	format := strings.TrimSpace(git(t, repo, "rev-parse", "--show-object-format"))
+	db, err := FromFilesystemWithFormat(filepath.Join(repo, ".git", "objects"), format)
+	require.Nil(t, err)
+	defer db.Close()
+
+	out := git(t, repo, "cat-file", "--batch-all-objects", "--batch-check")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.NotEmpty(t, lines)
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		require.Len(t, fields, 3)
+		sha, expectedType := fields[0], fields[1]
+		expectedSize, _ := strconv.ParseInt(fields[2], 10, 64)
+
+		typ, size, err := db.Stat(sha)
+		assert.Nil(t, err, sha)
+		assert.Equal(t, expectedType, typ, sha)
+		assert.Equal(t, expectedSize, size, sha)
+
+		typ, data, err := db.Read(sha)
+		assert.Nil(t, err, sha)
+		assert.Equal(t, expectedType, typ, sha)
+		assert.Equal(t, git(t, repo, "cat-file", expectedType, sha), string(data), sha)
+	}
+}
+
+func newTestRepo(t *testing.T, initArgs ...string) string {
+	dir, err := ioutil.TempDir("", "odb")
+	require.Nil(t, err)
+
+	git(t, dir, append([]string{"init", "-q"}, initArgs...)...)
+	git(t, dir, "config", "user.name", "Git LFS Tests")
+	git(t, dir, "config", "user.email", "git-lfs@example.com")
+	return dir
+}
+
+// commitFiles makes n commits, each changing a few lines of a large file so
+// that packing them makes deltas.
+func commitFiles(t *testing.T, repo string, n int) {
+	var content bytes.Buffer
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&content, "line %d of a file which is large enough to delta\n", i)
+	}
+
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&content, "change %d\n", i)
+		require.Nil(t, ioutil.WriteFile(filepath.Join(repo, "file.txt"), content.Bytes(), 0644))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(repo, fmt.Sprintf("small%d.txt", i)), []byte("small"), 0644))
+		git(t, repo, "add", ".")
+		git(t, repo, "commit", "-q", "-m", fmt.Sprintf("commit %d", i))
+	}
+	git(t, repo, "tag", "-a", "-m", "a tag", "v1")
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	require.Nil(t, err, "git %v", args)
+	return string(out)
+}
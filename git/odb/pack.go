@@ -0,0 +1,286 @@
+package odb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Types of the objects in a packfile.
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+var packTypeNames = map[int]string{
+	packCommit: TypeCommit,
+	packTree:   TypeTree,
+	packBlob:   TypeBlob,
+	packTag:    TypeTag,
+}
+
+var idxMagic = []byte{0xff, 't', 'O', 'c'}
+
+// packfile is a packfile and its version 2 index, which is read into memory.
+type packfile struct {
+	name string
+	f    *os.File
+	size int64
+
+	// hashSize is the size of the binary names of the objects.
+	hashSize int
+
+	fanout       [256]uint32
+	shas         []byte
+	offsets      []byte
+	largeOffsets []byte
+}
+
+// openPackfile opens the packfile with the index at the given path, whose
+// objects have binary names of hashSize bytes.
+func openPackfile(idxPath string, hashSize int) (*packfile, error) {
+	idx, err := ioutil.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(idx) < 8+256*4 || !bytes.Equal(idx[0:4], idxMagic) {
+		return nil, fmt.Errorf("odb: %s: unsupported pack index version", idxPath)
+	}
+	if v := binary.BigEndian.Uint32(idx[4:8]); v != 2 {
+		return nil, fmt.Errorf("odb: %s: unsupported pack index version %d", idxPath, v)
+	}
+
+	p := &packfile{name: strings.TrimSuffix(idxPath, ".idx") + ".pack", hashSize: hashSize}
+	for i := 0; i < 256; i++ {
+		p.fanout[i] = binary.BigEndian.Uint32(idx[8+i*4:])
+	}
+
+	n := int(p.fanout[255])
+	shasAt := 8 + 256*4
+	offsetsAt := shasAt + n*hashSize + n*4 // skipping the CRC32s
+	largeAt := offsetsAt + n*4
+	// the index ends with the checksums of the pack and itself
+	if len(idx) < largeAt+2*hashSize {
+		return nil, fmt.Errorf("odb: %s: truncated pack index", idxPath)
+	}
+	p.shas = idx[shasAt : shasAt+n*hashSize]
+	p.offsets = idx[offsetsAt:largeAt]
+	p.largeOffsets = idx[largeAt : len(idx)-2*hashSize]
+
+	f, err := os.Open(p.name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	header := make([]byte, 8)
+	if _, err := f.ReadAt(header, 0); err != nil || string(header[0:4]) != "PACK" {
+		f.Close()
+		return nil, fmt.Errorf("odb: %s: not a packfile", p.name)
+	}
+	if v := binary.BigEndian.Uint32(header[4:8]); v != 2 && v != 3 {
+		f.Close()
+		return nil, fmt.Errorf("odb: %s: unsupported packfile version %d", p.name, v)
+	}
+
+	p.f = f
+	p.size = info.Size()
+	return p, nil
+}
+
+func (p *packfile) Close() error {
+	return p.f.Close()
+}
+
+// find returns the offset in the packfile of the object with the given
+// binary name, if it has it.
+func (p *packfile) find(sha []byte) (int64, bool) {
+	lo := 0
+	if sha[0] > 0 {
+		lo = int(p.fanout[sha[0]-1])
+	}
+	hi := int(p.fanout[sha[0]])
+
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		switch c := bytes.Compare(sha, p.shas[mid*p.hashSize:(mid+1)*p.hashSize]); {
+		case c == 0:
+			return p.offset(mid), true
+		case c < 0:
+			hi = mid
+		default:
+			lo = mid + 1
+		}
+	}
+	return 0, false
+}
+
+func (p *packfile) offset(i int) int64 {
+	o := binary.BigEndian.Uint32(p.offsets[i*4:])
+	if o&0x80000000 == 0 {
+		return int64(o)
+	}
+	i = int(o & 0x7fffffff)
+	return int64(binary.BigEndian.Uint64(p.largeOffsets[i*8:]))
+}
+
+// packEntry is the header of an object in a packfile.
+type packEntry struct {
+	typ  int
+	size int64
+
+	// baseOffset is the offset of the base of an OFS_DELTA object, and
+	// baseSha the binary name of the base of a REF_DELTA one.
+	baseOffset int64
+	baseSha    []byte
+
+	// r reads the compressed data of the object.
+	r *bufio.Reader
+}
+
+// entry reads the header of the object at the given offset.
+func (p *packfile) entry(offset int64) (*packEntry, error) {
+	r := bufio.NewReader(io.NewSectionReader(p.f, offset, p.size-offset))
+
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, p.errorf(offset, "%v", err)
+	}
+	e := &packEntry{typ: int(c>>4) & 7, size: int64(c & 0x0f), r: r}
+	for shift := uint(4); c&0x80 != 0; shift += 7 {
+		if c, err = r.ReadByte(); err != nil {
+			return nil, p.errorf(offset, "%v", err)
+		}
+		e.size |= int64(c&0x7f) << shift
+	}
+
+	switch e.typ {
+	case packOfsDelta:
+		if c, err = r.ReadByte(); err != nil {
+			return nil, p.errorf(offset, "%v", err)
+		}
+		rel := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = r.ReadByte(); err != nil {
+				return nil, p.errorf(offset, "%v", err)
+			}
+			rel = ((rel + 1) << 7) | int64(c&0x7f)
+		}
+		if rel <= 0 || rel > offset {
+			return nil, p.errorf(offset, "invalid delta base offset %d", rel)
+		}
+		e.baseOffset = offset - rel
+	case packRefDelta:
+		e.baseSha = make([]byte, p.hashSize)
+		if _, err := io.ReadFull(r, e.baseSha); err != nil {
+			return nil, p.errorf(offset, "%v", err)
+		}
+	case packCommit, packTree, packBlob, packTag:
+	default:
+		return nil, p.errorf(offset, "unknown object type %d", e.typ)
+	}
+	return e, nil
+}
+
+// inflate returns a reader of the uncompressed data of e, which is closed by
+// the caller.
+func (e *packEntry) inflate() (io.ReadCloser, error) {
+	return zlib.NewReader(e.r)
+}
+
+// stat returns the type and size of the object at the given offset. Deltas
+// are only read far enough to find their size, and their bases' headers to
+// find their type.
+func (p *packfile) stat(d *ObjectDatabase, offset int64) (string, int64, error) {
+	e, err := p.entry(offset)
+	if err != nil {
+		return "", 0, err
+	}
+	if name, ok := packTypeNames[e.typ]; ok {
+		return name, e.size, nil
+	}
+
+	zr, err := e.inflate()
+	if err != nil {
+		return "", 0, p.errorf(offset, "%v", err)
+	}
+	defer zr.Close()
+
+	br := bufio.NewReader(zr)
+	if _, err := readDeltaSize(br); err != nil {
+		return "", 0, p.errorf(offset, "%v", err)
+	}
+	size, err := readDeltaSize(br)
+	if err != nil {
+		return "", 0, p.errorf(offset, "%v", err)
+	}
+
+	var typ string
+	if e.typ == packOfsDelta {
+		typ, _, err = p.stat(d, e.baseOffset)
+	} else {
+		typ, _, err = d.Stat(hex.EncodeToString(e.baseSha))
+	}
+	return typ, int64(size), err
+}
+
+// read returns the type and contents of the object at the given offset,
+// applying it to its base if it's a delta.
+func (p *packfile) read(d *ObjectDatabase, offset int64) (string, []byte, error) {
+	e, err := p.entry(offset)
+	if err != nil {
+		return "", nil, err
+	}
+
+	zr, err := e.inflate()
+	if err != nil {
+		return "", nil, p.errorf(offset, "%v", err)
+	}
+	data := make([]byte, e.size)
+	_, err = io.ReadFull(zr, data)
+	zr.Close()
+	if err != nil {
+		return "", nil, p.errorf(offset, "%v", err)
+	}
+
+	if name, ok := packTypeNames[e.typ]; ok {
+		return name, data, nil
+	}
+
+	var typ string
+	var base []byte
+	if e.typ == packOfsDelta {
+		typ, base, err = p.read(d, e.baseOffset)
+	} else {
+		typ, base, err = d.read(e.baseSha)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	result, err := applyDelta(base, data)
+	if err != nil {
+		return "", nil, p.errorf(offset, "%v", err)
+	}
+	return typ, result, nil
+}
+
+func (p *packfile) errorf(offset int64, format string, args ...interface{}) error {
+	return fmt.Errorf("odb: %s at %d: %s", p.name, offset, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,250 @@
+package httputil
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/rubyist/tracerx"
+)
+
+// defaultFallbackDelay is the time to wait for a connection attempt to
+// succeed before starting an attempt against the next address in parallel,
+// as recommended by RFC 6555.
+const defaultFallbackDelay = 300 * time.Millisecond
+
+// happyEyeballsDialer implements "Happy Eyeballs" (RFC 6555) dual-stack
+// dialing. All of the addresses a host resolves to are tried in turn,
+// alternating between IPv6 and IPv4, with each attempt given a head start of
+// FallbackDelay before the next one is started in parallel. The first
+// connection to succeed is used, and the rest are closed.
+//
+// This stops a host with a broken AAAA (or A) record from stalling every
+// request for the full connect timeout.
+type happyEyeballsDialer struct {
+	// Timeout is the connect timeout for each individual address.
+	Timeout time.Duration
+	// KeepAlive is the TCP keepalive period of established connections.
+	KeepAlive time.Duration
+	// FallbackDelay is how long to wait on one attempt before racing the
+	// next address against it.
+	FallbackDelay time.Duration
+
+	// lookup and dial may be overridden for testing.
+	lookup func(host string) ([]net.IP, error)
+	dial   func(network, address string, timeout time.Duration) (net.Conn, error)
+}
+
+// newDialer returns a *happyEyeballsDialer configured for the given host
+// (which may be "host:port"), using the lfs.dialtimeout, lfs.keepalive and
+// lfs.dialfallbackdelay settings. Each may be overridden for a single host
+// with lfs.<url>.<setting>.
+func newDialer(c *config.Configuration, host string) *happyEyeballsDialer {
+	dialtime := hostConfigInt(c, host, "dialtimeout", 30)
+	keepalivetime := hostConfigInt(c, host, "keepalive", 1800) // 30 minutes
+	fallbackdelay := hostConfigInt(c, host, "dialfallbackdelay", int(defaultFallbackDelay/time.Millisecond))
+
+	return &happyEyeballsDialer{
+		Timeout:       time.Duration(dialtime) * time.Second,
+		KeepAlive:     time.Duration(keepalivetime) * time.Second,
+		FallbackDelay: time.Duration(fallbackdelay) * time.Millisecond,
+	}
+}
+
+// newHostDialer returns the function the HTTP client for the given host (which
+// may be "host:port") dials its connections with, as http.Transport.Dial.
+// Connections are dialed with the settings dialerFor chooses for the address.
+func newHostDialer(c *config.Configuration, host string) func(network, address string) (net.Conn, error) {
+	direct := newDialer(c, host)
+	return func(network, address string) (net.Conn, error) {
+		return dialerFor(c, host, direct, address).Dial(network, address)
+	}
+}
+
+// dialerFor returns the dialer to connect to the given address with for the
+// HTTP client of the given host: direct, which has the host's settings, if
+// the address is the host's, or one with the settings of the address itself if
+// it isn't, as when requests are sent through a proxy, so that the host's
+// settings aren't applied to the proxy.
+func dialerFor(c *config.Configuration, host string, direct *happyEyeballsDialer, address string) *happyEyeballsDialer {
+	if strings.EqualFold(hostname(address), hostname(host)) {
+		return direct
+	}
+
+	tracerx.Printf("dial: %s isn't %s, using its own settings", address, host)
+	return newDialer(c, address)
+}
+
+// hostname returns the given host (which may be "host:port") without the port
+// or the brackets around an IPv6 address.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// Dial connects to the address on the named network, racing all of the
+// addresses the host resolves to as described above. It has the signature
+// required by http.Transport.Dial.
+func (d *happyEyeballsDialer) Dial(network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return d.dialOne(network, address)
+	}
+
+	ips, err := d.lookupHost(host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := interleaveAddrs(ips)
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("dial %s: no addresses found for %q", network, host)
+	}
+
+	results := make(chan dialResult, len(addrs))
+	pending, next := 0, 0
+	startNext := func() {
+		addr := net.JoinHostPort(addrs[next].String(), port)
+		next++
+		pending++
+
+		tracerx.Printf("dial: connecting to %s (%s)", addr, host)
+		go func() {
+			conn, err := d.dialOne(network, addr)
+			results <- dialResult{conn, err}
+		}()
+	}
+
+	var firstErr error
+	startNext()
+	for pending > 0 {
+		var fallback *time.Timer
+		var fallbackc <-chan time.Time
+		if next < len(addrs) {
+			fallback = time.NewTimer(d.fallbackDelay())
+			fallbackc = fallback.C
+		}
+
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if fallback != nil {
+					fallback.Stop()
+				}
+				go closeLosers(results, pending)
+				return res.conn, nil
+			}
+
+			tracerx.Printf("dial: %s", res.err)
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			// Don't wait out the delay when we already know this
+			// address is no good.
+			if next < len(addrs) {
+				startNext()
+			}
+		case <-fallbackc:
+			startNext()
+		}
+
+		if fallback != nil {
+			fallback.Stop()
+		}
+	}
+
+	return nil, firstErr
+}
+
+func (d *happyEyeballsDialer) dialOne(network, address string) (net.Conn, error) {
+	if d.dial != nil {
+		return d.dial(network, address, d.Timeout)
+	}
+
+	dialer := &net.Dialer{Timeout: d.Timeout, KeepAlive: d.KeepAlive}
+	return dialer.Dial(network, address)
+}
+
+func (d *happyEyeballsDialer) lookupHost(host string) ([]net.IP, error) {
+	if d.lookup != nil {
+		return d.lookup(host)
+	}
+	return net.LookupIP(host)
+}
+
+func (d *happyEyeballsDialer) fallbackDelay() time.Duration {
+	if d.FallbackDelay <= 0 {
+		return defaultFallbackDelay
+	}
+	return d.FallbackDelay
+}
+
+// closeLosers closes any connections from the remaining n attempts that are
+// still in flight once a winner has been chosen.
+func closeLosers(results <-chan dialResult, n int) {
+	for i := 0; i < n; i++ {
+		if res := <-results; res.conn != nil {
+			res.conn.Close()
+		}
+	}
+}
+
+// interleaveAddrs orders the given addresses so that IPv6 and IPv4 addresses
+// alternate, starting with the address family of the first address returned
+// by the resolver, which is its preferred one.
+func interleaveAddrs(ips []net.IP) []net.IP {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	first, second := v6, v4
+	if len(ips) > 0 && ips[0].To4() != nil {
+		first, second = v4, v6
+	}
+
+	addrs := make([]net.IP, 0, len(ips))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			addrs = append(addrs, first[i])
+		}
+		if i < len(second) {
+			addrs = append(addrs, second[i])
+		}
+	}
+	return addrs
+}
+
+// hostConfigInt returns the value of "lfs.<url>.<key>" for the given host
+// (which may be "host:port"), falling back to the global "lfs.<key>", or def
+// if neither are set.
+func hostConfigInt(c *config.Configuration, host, key string, def int) int {
+	for _, scheme := range []string{"https", "http"} {
+		for _, format := range []string{"lfs.%s://%s/.%s", "lfs.%s://%s.%s"} {
+			k := fmt.Sprintf(format, scheme, host, key)
+			if _, ok := c.Git.Get(k); ok {
+				return c.Git.Int(k, def)
+			}
+		}
+	}
+
+	return c.Git.Int("lfs."+key, def)
+}
@@ -0,0 +1,168 @@
+package httputil
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterleaveAddrsPrefersFirstFamily(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("2001:db8::1"),
+		net.ParseIP("2001:db8::2"),
+		net.ParseIP("192.0.2.1"),
+	}
+
+	assert.Equal(t, []net.IP{
+		net.ParseIP("2001:db8::1"),
+		net.ParseIP("192.0.2.1"),
+		net.ParseIP("2001:db8::2"),
+	}, interleaveAddrs(ips))
+
+	ips = []net.IP{
+		net.ParseIP("192.0.2.1"),
+		net.ParseIP("2001:db8::1"),
+	}
+
+	assert.Equal(t, []net.IP{
+		net.ParseIP("192.0.2.1"),
+		net.ParseIP("2001:db8::1"),
+	}, interleaveAddrs(ips))
+}
+
+// fakeConn is a net.Conn which records whether it was closed.
+type fakeConn struct {
+	net.Conn
+	addr   string
+	mu     sync.Mutex
+	closed bool
+}
+
+func (c *fakeConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func TestHappyEyeballsFallsBackFromHangingAddress(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+
+	d := &happyEyeballsDialer{
+		FallbackDelay: 10 * time.Millisecond,
+		lookup: func(host string) ([]net.IP, error) {
+			return []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.1")}, nil
+		},
+		dial: func(network, address string, timeout time.Duration) (net.Conn, error) {
+			if address == "[2001:db8::1]:443" {
+				// simulate a broken AAAA record
+				<-hang
+				return nil, errors.New("timeout")
+			}
+			return &fakeConn{addr: address}, nil
+		},
+	}
+
+	start := time.Now()
+	conn, err := d.Dial("tcp", "git-lfs.local:443")
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.1:443", conn.(*fakeConn).addr)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestHappyEyeballsSkipsDelayOnFailure(t *testing.T) {
+	d := &happyEyeballsDialer{
+		FallbackDelay: time.Hour,
+		lookup: func(host string) ([]net.IP, error) {
+			return []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.1")}, nil
+		},
+		dial: func(network, address string, timeout time.Duration) (net.Conn, error) {
+			if address == "[2001:db8::1]:443" {
+				return nil, errors.New("connection refused")
+			}
+			return &fakeConn{addr: address}, nil
+		},
+	}
+
+	conn, err := d.Dial("tcp", "git-lfs.local:443")
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.1:443", conn.(*fakeConn).addr)
+}
+
+func TestHappyEyeballsReturnsFirstError(t *testing.T) {
+	d := &happyEyeballsDialer{
+		lookup: func(host string) ([]net.IP, error) {
+			return []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.1")}, nil
+		},
+		dial: func(network, address string, timeout time.Duration) (net.Conn, error) {
+			return nil, errors.New("refused: " + address)
+		},
+	}
+
+	conn, err := d.Dial("tcp", "git-lfs.local:443")
+	assert.Nil(t, conn)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "refused: [2001:db8::1]:443", err.Error())
+	}
+}
+
+func TestHappyEyeballsDialsIPLiteralDirectly(t *testing.T) {
+	d := &happyEyeballsDialer{
+		lookup: func(host string) ([]net.IP, error) {
+			t.Fatal("should not resolve an IP literal")
+			return nil, nil
+		},
+		dial: func(network, address string, timeout time.Duration) (net.Conn, error) {
+			return &fakeConn{addr: address}, nil
+		},
+	}
+
+	conn, err := d.Dial("tcp", "[::1]:8080")
+	assert.Nil(t, err)
+	assert.Equal(t, "[::1]:8080", conn.(*fakeConn).addr)
+}
+
+func TestNewDialerUsesPerHostSettings(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.dialtimeout":                        "10",
+			"lfs.keepalive":                          "60",
+			"lfs.https://git-lfs.local/.dialtimeout": "2",
+			"lfs.dialfallbackdelay":                  "50",
+		},
+	})
+
+	d := newDialer(cfg, "git-lfs.local")
+	assert.Equal(t, 2*time.Second, d.Timeout)
+	assert.Equal(t, 60*time.Second, d.KeepAlive)
+	assert.Equal(t, 50*time.Millisecond, d.FallbackDelay)
+
+	d = newDialer(cfg, "other.local")
+	assert.Equal(t, 10*time.Second, d.Timeout)
+}
+
+func TestDialerForUsesProxySettingsForProxy(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.https://git-lfs.local/.dialtimeout":   "2",
+			"lfs.http://proxy.local:3128/.dialtimeout": "5",
+		},
+	})
+
+	direct := newDialer(cfg, "git-lfs.local")
+	assert.Equal(t, direct, dialerFor(cfg, "git-lfs.local", direct, "git-lfs.local:443"))
+	assert.Equal(t, direct, dialerFor(cfg, "GIT-LFS.local:8443", direct, "git-lfs.local:8443"))
+
+	// the host's settings aren't applied to the proxy it's reached through
+	d := dialerFor(cfg, "git-lfs.local", direct, "proxy.local:3128")
+	assert.Equal(t, 5*time.Second, d.Timeout)
+
+	d = dialerFor(cfg, "git-lfs.local", direct, "other-proxy.local:3128")
+	assert.Equal(t, 30*time.Second, d.Timeout)
+}
@@ -0,0 +1,53 @@
+package httputil
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/git-lfs/git-lfs/auth"
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+)
+
+// fipsCipherSuites are the TLS 1.2 cipher suites built from FIPS-approved
+// algorithms only: ECDHE or RSA key exchange, AES-GCM and SHA-2.
+var fipsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// fipsCurves are the FIPS-approved elliptic curves.
+var fipsCurves = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+
+// restrictTLSConfigForFips limits the given TLS config to FIPS-approved
+// protocol versions, cipher suites and curves.
+func restrictTLSConfigForFips(t *tls.Config) {
+	t.MinVersion = tls.VersionTLS12
+	t.MaxVersion = tls.VersionTLS12
+	t.CipherSuites = fipsCipherSuites
+	t.CurvePreferences = fipsCurves
+	t.PreferServerCipherSuites = false
+}
+
+// checkFipsRequest returns a fatal error if FIPS mode is enabled and the given
+// request would need a feature which is not permitted in that mode.
+func checkFipsRequest(cfg *config.Configuration, req *http.Request) error {
+	if !cfg.FipsMode() {
+		return nil
+	}
+
+	if cfg.NtlmAccess(auth.GetOperationForRequest(req)) {
+		return errors.NewFatalError(fmt.Errorf("NTLM authentication is not available when lfs.fips is enabled, as it requires non-FIPS-approved cryptography"))
+	}
+
+	if req.URL.Scheme == "https" && isCertVerificationDisabledForHost(cfg, req.Host) {
+		return errors.NewFatalError(fmt.Errorf("Disabling SSL certificate verification for %s is not permitted when lfs.fips is enabled", req.Host))
+	}
+
+	return nil
+}
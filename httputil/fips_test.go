@@ -0,0 +1,69 @@
+package httputil
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFipsRequestAllowsAnythingWhenDisabled(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.url":                               "https://git-lfs.local/repo",
+			"lfs.https://git-lfs.local/repo.access": "ntlm",
+		},
+	})
+
+	req, err := http.NewRequest("GET", "https://git-lfs.local/repo/objects", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, checkFipsRequest(cfg, req))
+}
+
+func TestCheckFipsRequestRefusesNtlm(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.fips":                              "true",
+			"lfs.url":                               "https://git-lfs.local/repo",
+			"lfs.https://git-lfs.local/repo.access": "ntlm",
+		},
+	})
+
+	req, err := http.NewRequest("GET", "https://git-lfs.local/repo/objects", nil)
+	assert.Nil(t, err)
+
+	err = checkFipsRequest(cfg, req)
+	if assert.NotNil(t, err) {
+		assert.True(t, errors.IsFatalError(err))
+		assert.Contains(t, err.Error(), "NTLM")
+	}
+}
+
+func TestCheckFipsRequestRefusesDisabledCertVerification(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.fips":       "true",
+			"http.sslverify": "false",
+		},
+	})
+
+	req, err := http.NewRequest("GET", "https://git-lfs.local/repo/objects", nil)
+	assert.Nil(t, err)
+
+	err = checkFipsRequest(cfg, req)
+	if assert.NotNil(t, err) {
+		assert.True(t, errors.IsFatalError(err))
+	}
+}
+
+func TestRestrictTLSConfigForFips(t *testing.T) {
+	c := &tls.Config{}
+	restrictTLSConfigForFips(c)
+
+	assert.Equal(t, uint16(tls.VersionTLS12), c.MinVersion)
+	assert.Equal(t, fipsCipherSuites, c.CipherSuites)
+	assert.Equal(t, fipsCurves, c.CurvePreferences)
+}
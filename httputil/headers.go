@@ -0,0 +1,144 @@
+package httputil
+
+import (
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/rubyist/tracerx"
+)
+
+// setConfiguredHeaders sets the User-Agent suffix and extra headers configured
+// for the request's URL. Extra headers never replace those the request has
+// already, such as those given by the server in a transfer action, so it is
+// also safe to call more than once for the same request, such as when it is
+// retried with credentials.
+func setConfiguredHeaders(cfg *config.Configuration, req *http.Request) {
+	if suffix := userAgentSuffix(cfg, req.URL); len(suffix) > 0 {
+		req.Header.Set("User-Agent", UserAgent+" "+suffix)
+	}
+
+	for name, values := range extraHeaders(cfg, req.URL) {
+		if _, ok := req.Header[name]; !ok {
+			req.Header[name] = values
+		}
+	}
+}
+
+// userAgentSuffix returns the most specific "lfs.<url>.useragentsuffix"
+// matching u, falling back to the global "lfs.useragentsuffix".
+func userAgentSuffix(cfg *config.Configuration, u *url.URL) string {
+	values := append(cfg.Git.GetAll("lfs.useragentsuffix"), urlConfigValues(cfg, "lfs", "useragentsuffix", u)...)
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(values[len(values)-1])
+}
+
+// extraHeaders parses the "http.<url>.extraheader" values matching u, each of
+// which is a header in the form "Name: value", as Git does. The global
+// "http.extraheader" values come first if u is on the host of the Git LFS
+// endpoint, but aren't sent to other hosts, such as those of the storage
+// which transfer actions point to, as they may hold credentials. An empty
+// value clears the headers given before it.
+func extraHeaders(cfg *config.Configuration, u *url.URL) http.Header {
+	header := make(http.Header)
+
+	values := urlConfigValues(cfg, "http", "extraheader", u)
+	if endpointHost(cfg, u) {
+		values = append(cfg.Git.GetAll("http.extraheader"), values...)
+	}
+
+	for _, value := range values {
+		if len(value) == 0 {
+			header = make(http.Header)
+			continue
+		}
+
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) < 2 || len(strings.TrimSpace(parts[0])) == 0 {
+			tracerx.Printf("httputil: ignoring invalid http.extraheader %q", value)
+			continue
+		}
+
+		name := textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(parts[0]))
+		header[name] = append(header[name], strings.TrimSpace(parts[1]))
+	}
+
+	return header
+}
+
+// endpointHost returns whether u has the scheme and host of the endpoint of
+// the Git LFS server for downloads or uploads.
+func endpointHost(cfg *config.Configuration, u *url.URL) bool {
+	for _, operation := range []string{"download", "upload"} {
+		eu, err := url.Parse(cfg.Endpoint(operation).Url)
+		if err == nil && strings.EqualFold(eu.Scheme, u.Scheme) && strings.EqualFold(eu.Host, u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlConfigValues returns the values of each "<section>.<url>.<key>" whose URL
+// matches u, least specific first.
+func urlConfigValues(cfg *config.Configuration, section, key string, u *url.URL) []string {
+	var values []string
+
+	prefix, suffix := section+".", "."+key
+	var matches []string
+	for k := range cfg.Git.All() {
+		if !strings.HasPrefix(k, prefix) || !strings.HasSuffix(k, suffix) {
+			continue
+		}
+
+		rawurl := strings.TrimSuffix(strings.TrimPrefix(k, prefix), suffix)
+		if len(rawurl) > 0 && configURLMatches(rawurl, u) {
+			matches = append(matches, k)
+		}
+	}
+
+	// longer URLs are more specific, so their values come last and take
+	// precedence over shorter ones.
+	sort.Sort(bySpecificity(matches))
+
+	for _, k := range matches {
+		values = append(values, cfg.Git.GetAll(k)...)
+	}
+	return values
+}
+
+// bySpecificity sorts config keys by the length of the URL in them, shortest
+// first.
+type bySpecificity []string
+
+func (s bySpecificity) Len() int      { return len(s) }
+func (s bySpecificity) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s bySpecificity) Less(i, j int) bool {
+	if len(s[i]) != len(s[j]) {
+		return len(s[i]) < len(s[j])
+	}
+	return s[i] < s[j]
+}
+
+// configURLMatches returns whether the URL in a config key, such as the
+// "https://example.com/path" in "http.https://example.com/path.extraheader",
+// matches u: its scheme and host must be the same, and its path must be a
+// prefix of u's path ending at a path segment.
+func configURLMatches(rawurl string, u *url.URL) bool {
+	cu, err := url.Parse(rawurl)
+	if err != nil || len(cu.Scheme) == 0 || len(cu.Host) == 0 {
+		return false
+	}
+
+	if !strings.EqualFold(cu.Scheme, u.Scheme) || !strings.EqualFold(cu.Host, u.Host) {
+		return false
+	}
+
+	cpath := strings.TrimSuffix(cu.Path, "/")
+	upath := strings.ToLower(u.Path)
+	return len(cpath) == 0 || upath == cpath || strings.HasPrefix(upath, cpath+"/")
+}
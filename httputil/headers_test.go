@@ -0,0 +1,119 @@
+package httputil
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetConfiguredHeadersWithoutConfig(t *testing.T) {
+	cfg := config.NewFrom(config.Values{})
+
+	req, err := NewHttpRequest("GET", "https://git-lfs.local/repo/objects", nil)
+	assert.Nil(t, err)
+
+	setConfiguredHeaders(cfg, req)
+	assert.Equal(t, UserAgent, req.Header.Get("User-Agent"))
+	assert.Equal(t, 1, len(req.Header))
+}
+
+func TestSetConfiguredHeadersForMatchingURL(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.url":          "https://git-lfs.local/repo",
+			"http.extraheader": "X-Global: global",
+			"http.https://git-lfs.local/repo.extraheader":    "x-gateway-route: lfs",
+			"http.https://git-lfs.local/other.extraheader":   "X-Other: other",
+			"http.https://elsewhere.local/.extraheader":      "X-Elsewhere: 1",
+			"lfs.useragentsuffix":                            "corp",
+			"lfs.https://git-lfs.local/repo.useragentsuffix": "waf-exempt",
+		},
+	})
+
+	req, err := NewHttpRequest("GET", "https://git-lfs.local/repo/objects/batch", nil)
+	assert.Nil(t, err)
+
+	setConfiguredHeaders(cfg, req)
+	assert.Equal(t, UserAgent+" waf-exempt", req.Header.Get("User-Agent"))
+	assert.Equal(t, "global", req.Header.Get("X-Global"))
+	assert.Equal(t, []string{"lfs"}, req.Header["X-Gateway-Route"])
+	assert.Equal(t, "", req.Header.Get("X-Other"))
+	assert.Equal(t, "", req.Header.Get("X-Elsewhere"))
+
+	// applying them again must not repeat them
+	setConfiguredHeaders(cfg, req)
+	assert.Equal(t, []string{"lfs"}, req.Header["X-Gateway-Route"])
+}
+
+func TestSetConfiguredHeadersForStorageHost(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.url":          "https://git-lfs.local/repo",
+			"http.extraheader": "Authorization: Bearer lfs-token",
+			"http.https://storage.local/.extraheader": "X-Storage: 1",
+		},
+	})
+
+	req, err := NewHttpRequest("GET", "https://storage.local/objects/oid", nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Signature storage")
+
+	setConfiguredHeaders(cfg, req)
+	assert.Equal(t, []string{"Signature storage"}, req.Header["Authorization"])
+	assert.Equal(t, "1", req.Header.Get("X-Storage"))
+
+	req, err = NewHttpRequest("GET", "https://storage.local/objects/oid", nil)
+	assert.Nil(t, err)
+
+	setConfiguredHeaders(cfg, req)
+	assert.Equal(t, "", req.Header.Get("Authorization"))
+}
+
+func TestSetConfiguredHeadersUsesGlobalUserAgentSuffix(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.useragentsuffix": "corp",
+		},
+	})
+
+	req, err := NewHttpRequest("GET", "https://storage.local/objects/oid", nil)
+	assert.Nil(t, err)
+
+	setConfiguredHeaders(cfg, req)
+	assert.Equal(t, UserAgent+" corp", req.Header.Get("User-Agent"))
+}
+
+func TestExtraHeadersEmptyValueClearsEarlierOnes(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.url":          "https://git-lfs.local/repo",
+			"http.extraheader": "X-Global: global",
+			"http.https://git-lfs.local/.extraheader": "",
+		},
+	})
+
+	req, err := http.NewRequest("GET", "https://git-lfs.local/repo", nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 0, len(extraHeaders(cfg, req.URL)))
+}
+
+func TestConfigURLMatches(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://git-lfs.local:8443/org/repo.git/info/lfs", nil)
+	assert.Nil(t, err)
+
+	for rawurl, expected := range map[string]bool{
+		"https://git-lfs.local:8443":              true,
+		"https://git-lfs.local:8443/":             true,
+		"https://git-lfs.local:8443/org":          true,
+		"https://git-lfs.local:8443/org/repo.git": true,
+		"https://git-lfs.local:8443/or":           false,
+		"https://git-lfs.local":                   false,
+		"http://git-lfs.local:8443":               false,
+		"git-lfs.local":                           false,
+	} {
+		assert.Equal(t, expected, configURLMatches(rawurl, req.URL), rawurl)
+	}
+}
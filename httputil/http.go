@@ -9,7 +9,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"net/http/httputil"
 	"os"
@@ -117,22 +116,21 @@ func NewHttpClient(c *config.Configuration, host string) *HttpClient {
 		return client
 	}
 
-	dialtime := c.Git.Int("lfs.dialtimeout", 30)
-	keepalivetime := c.Git.Int("lfs.keepalive", 1800) // 30 minutes
-	tlstime := c.Git.Int("lfs.tlstimeout", 30)
+	tlstime := hostConfigInt(c, host, "tlstimeout", 30)
 
 	tr := &http.Transport{
-		Proxy: ProxyFromGitConfigOrEnvironment(c),
-		Dial: (&net.Dialer{
-			Timeout:   time.Duration(dialtime) * time.Second,
-			KeepAlive: time.Duration(keepalivetime) * time.Second,
-		}).Dial,
+		Proxy:               ProxyFromGitConfigOrEnvironment(c),
+		Dial:                newHostDialer(c, host),
 		TLSHandshakeTimeout: time.Duration(tlstime) * time.Second,
 		MaxIdleConnsPerHost: c.ConcurrentTransfers(),
 	}
 
 	tr.TLSClientConfig = &tls.Config{}
-	if isCertVerificationDisabledForHost(c, host) {
+	if c.FipsMode() {
+		restrictTLSConfigForFips(tr.TLSClientConfig)
+	}
+
+	if isCertVerificationDisabledForHost(c, host) && !c.FipsMode() {
 		tr.TLSClientConfig.InsecureSkipVerify = true
 	} else {
 		tr.TLSClientConfig.RootCAs = getRootCAsForHost(c, host)
@@ -156,6 +156,7 @@ func cloneRequest(request *http.Request) (*http.Request, error) {
 	if err != nil {
 		return nil, err
 	}
+	clonedReq = clonedReq.WithContext(request.Context())
 
 	for k, _ := range request.Header {
 		clonedReq.Header.Add(k, request.Header.Get(k))
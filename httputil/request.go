@@ -2,6 +2,7 @@ package httputil
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -50,7 +51,12 @@ func doHttpRequest(cfg *config.Configuration, req *http.Request, creds auth.Cred
 		err   error
 	)
 
-	if cfg.NtlmAccess(auth.GetOperationForRequest(req)) {
+	setConfiguredHeaders(cfg, req)
+
+	if fipsErr := checkFipsRequest(cfg, req); fipsErr != nil {
+		cause = "fips"
+		err = fipsErr
+	} else if cfg.NtlmAccess(auth.GetOperationForRequest(req)) {
 		cause = "ntlm"
 		res, err = doNTLMRequest(cfg, req, true)
 	} else {
@@ -127,7 +133,7 @@ func DoHttpRequestWithRedirects(cfg *config.Configuration, req *http.Request, vi
 			redirectTo = locurl.String()
 		}
 
-		redirectedReq, err := NewHttpRequest(req.Method, redirectTo, nil)
+		redirectedReq, err := NewHttpRequestContext(req.Context(), req.Method, redirectTo, nil)
 		if err != nil {
 			return res, errors.Wrapf(err, err.Error())
 		}
@@ -163,10 +169,17 @@ func DoHttpRequestWithRedirects(cfg *config.Configuration, req *http.Request, vi
 
 // NewHttpRequest creates a template request, with the given headers & UserAgent supplied
 func NewHttpRequest(method, rawurl string, header map[string]string) (*http.Request, error) {
+	return NewHttpRequestContext(context.Background(), method, rawurl, header)
+}
+
+// NewHttpRequestContext creates a template request like NewHttpRequest, which
+// is cancelled once the given context is done.
+func NewHttpRequestContext(ctx context.Context, method, rawurl string, header map[string]string) (*http.Request, error) {
 	req, err := http.NewRequest(method, rawurl, nil)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 
 	for key, value := range header {
 		req.Header.Set(key, value)
@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/git-lfs/git-lfs/config"
 	"github.com/git-lfs/git-lfs/errors"
@@ -148,3 +149,55 @@ func TestErrorStatusWithDefaultMessage(t *testing.T) {
 		}
 	}
 }
+
+func TestRateLimitedStatus(t *testing.T) {
+	cfg := config.New()
+	u, err := url.Parse("https://lfs-server.com/objects/oid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	headers := map[string]time.Duration{
+		"Retry-After: 120": 2 * time.Minute,
+		"Retry-After: " + date.Format(http.TimeFormat): time.Hour,
+		"RateLimit-Reset: 30":                          30 * time.Second,
+		"RateLimit-Limit: 100\nRateLimit-Reset: 60":    time.Minute,
+		"Retry-After: 10\nRateLimit-Reset: 60":         10 * time.Second,
+		"Retry-After: soon\nRateLimit-Reset: 60":       time.Minute,
+		"RateLimit-Limit: 100\nRateLimit-Remaining: 0": -1,
+		"Retry-After: -5":                              -1,
+	}
+
+	for header, delay := range headers {
+		res := &http.Response{
+			StatusCode: 429,
+			Header:     make(http.Header),
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			Request:    &http.Request{URL: u},
+		}
+		for _, line := range strings.Split(header, "\n") {
+			parts := strings.SplitN(line, ": ", 2)
+			res.Header.Set(parts[0], parts[1])
+		}
+
+		err := handleResponse(cfg, res, nil)
+		if !errors.IsRetriableError(err) {
+			t.Errorf("Expected HTTP 429 with %q to be retriable", header)
+		}
+
+		at, ok := errors.IsRetriableLaterError(err)
+		if delay < 0 {
+			if ok {
+				t.Errorf("Expected HTTP 429 with %q to not be retriable later", header)
+			}
+			continue
+		}
+
+		if !ok {
+			t.Errorf("Expected HTTP 429 with %q to be retriable later", header)
+		} else if d := at.Sub(time.Now()); d > delay || d < delay-5*time.Second {
+			t.Errorf("Expected HTTP 429 with %q to be retriable in %s, got %s", header, delay, d)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/git-lfs/git-lfs/auth"
 	"github.com/git-lfs/git-lfs/config"
@@ -88,6 +90,13 @@ func handleResponse(cfg *config.Configuration, res *http.Response, creds auth.Cr
 		return errors.NewAuthError(err)
 	}
 
+	if res.StatusCode == 429 {
+		if at, ok := retryAfter(res); ok {
+			return errors.NewRetriableLaterError(err, at)
+		}
+		return errors.NewRetriableError(err)
+	}
+
 	if res.StatusCode > 499 && res.StatusCode != 501 && res.StatusCode != 507 && res.StatusCode != 509 {
 		if err == nil {
 			err = errors.Errorf("api: received status %d", res.StatusCode)
@@ -98,6 +107,28 @@ func handleResponse(cfg *config.Configuration, res *http.Response, creds auth.Cr
 	return err
 }
 
+// retryAfter returns the time after which a request which the server rate
+// limited may be retried. It is given by the Retry-After header, either as a
+// number of seconds or as a date, or failing that by the RateLimit-Reset
+// header, as a number of seconds.
+func retryAfter(res *http.Response) (time.Time, bool) {
+	if v := res.Header.Get("Retry-After"); len(v) > 0 {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return time.Now().Add(time.Duration(secs) * time.Second), true
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			return at, true
+		}
+	}
+
+	if v := res.Header.Get("RateLimit-Reset"); len(v) > 0 {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return time.Now().Add(time.Duration(secs) * time.Second), true
+		}
+	}
+	return time.Time{}, false
+}
+
 func defaultError(res *http.Response) error {
 	var msgFmt string
 
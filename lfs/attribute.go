@@ -31,6 +31,9 @@ type InstallOptions struct {
 	Force  bool
 	Local  bool
 	System bool
+	// File is the config file to install into, such as the config of a
+	// template directory, in place of the local, system or global config.
+	File string
 }
 
 // Install instructs Git to set all keys and values relative to the root
@@ -67,7 +70,9 @@ func (a *Attribute) normalizeKey(relative string) string {
 // will be overridden.
 func (a *Attribute) set(key, value string, upgradeables []string, opt InstallOptions) error {
 	var currentValue string
-	if opt.Local {
+	if len(opt.File) > 0 {
+		currentValue = git.Config.FindFile(opt.File, key)
+	} else if opt.Local {
 		currentValue = git.Config.FindLocal(key)
 	} else if opt.System {
 		currentValue = git.Config.FindSystem(key)
@@ -77,10 +82,10 @@ func (a *Attribute) set(key, value string, upgradeables []string, opt InstallOpt
 
 	if opt.Force || shouldReset(currentValue, upgradeables) {
 		var err error
-		if opt.Local {
+		if opt.Local || len(opt.File) > 0 {
 			// ignore error for unset, git returns non-zero if missing
-			git.Config.UnsetLocalKey("", key)
-			_, err = git.Config.SetLocal("", key, value)
+			git.Config.UnsetLocalKey(opt.File, key)
+			_, err = git.Config.SetLocal(opt.File, key, value)
 		} else if opt.System {
 			// ignore error for unset, git returns non-zero if missing
 			git.Config.UnsetSystem(key)
@@ -99,11 +104,19 @@ func (a *Attribute) set(key, value string, upgradeables []string, opt InstallOpt
 	return nil
 }
 
-// Uninstall removes all properties in the path of this property.
-func (a *Attribute) Uninstall() {
-	// uninstall from both system and global
-	git.Config.UnsetSystemSection(a.Section)
-	git.Config.UnsetGlobalSection(a.Section)
+// Uninstall removes all properties in the path of this property, from the
+// local or system config if the options say so, or else from both the system
+// and global config.
+func (a *Attribute) Uninstall(opt InstallOptions) {
+	// ignore errors, git returns non-zero if the section is missing
+	if opt.Local {
+		git.Config.UnsetLocalSection(a.Section)
+	} else if opt.System {
+		git.Config.UnsetSystemSection(a.Section)
+	} else {
+		git.Config.UnsetSystemSection(a.Section)
+		git.Config.UnsetGlobalSection(a.Section)
+	}
 }
 
 // shouldReset determines whether or not a value is resettable given its current
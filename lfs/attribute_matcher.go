@@ -0,0 +1,308 @@
+package lfs
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+)
+
+// AttributesFiles returns the paths of the repository's attributes files: its
+// .git/info/attributes, if there is one, and the .gitattributes files in its
+// working copy.
+func AttributesFiles() []string {
+	var paths []string
+
+	repoAttributes := filepath.Join(config.LocalGitDir, "info", "attributes")
+	if info, err := os.Stat(repoAttributes); err == nil && !info.IsDir() {
+		paths = append(paths, repoAttributes)
+	}
+
+	if len(config.LocalWorkingDir) == 0 {
+		return paths
+	}
+
+	monitor := localFSMonitor()
+	if monitor != nil {
+		if found, ok := monitor.AttributesFiles(); ok {
+			tracerx.Printf("fsmonitor: .gitattributes files unchanged")
+			return append(paths, found...)
+		}
+	}
+
+	var found []string
+	tools.FastWalkGitRepo(config.LocalWorkingDir, func(parentDir string, info os.FileInfo, err error) {
+		if err != nil {
+			tracerx.Printf("Error finding .gitattributes: %v", err)
+			return
+		}
+
+		if info.IsDir() || info.Name() != ".gitattributes" {
+			return
+		}
+		found = append(found, filepath.Join(parentDir, info.Name()))
+	})
+
+	if monitor != nil {
+		monitor.SetAttributesFiles(found)
+	}
+	return append(paths, found...)
+}
+
+// GlobalAttributesFile returns the path of the user's global attributes file,
+// as Git finds it: core.attributesFile, with a leading "~/" expanded, or
+// $XDG_CONFIG_HOME/git/attributes, or ~/.config/git/attributes. It returns ""
+// if none of them can be worked out.
+func GlobalAttributesFile() string {
+	home, _ := config.Config.Os.Get("HOME")
+	if file, ok := config.Config.Git.Get("core.attributesfile"); ok && len(file) > 0 {
+		if strings.HasPrefix(file, "~/") && len(home) > 0 {
+			file = filepath.Join(home, file[2:])
+		}
+		return file
+	}
+
+	if xdg, _ := config.Config.Os.Get("XDG_CONFIG_HOME"); len(xdg) > 0 {
+		return filepath.Join(xdg, "git", "attributes")
+	}
+	if len(home) > 0 {
+		return filepath.Join(home, ".config", "git", "attributes")
+	}
+	return ""
+}
+
+// ReadAttributesLines returns the lines of the user's global attributes file
+// and of the repository's attributes files which give patterns attributes, and
+// those which define attribute macros.
+func ReadAttributesLines() (lines, definitions []*AttributesLine) {
+	type attributesFile struct {
+		path   string
+		global bool
+	}
+
+	var files []attributesFile
+	if global := GlobalAttributesFile(); len(global) > 0 {
+		files = append(files, attributesFile{path: global, global: true})
+	}
+	for _, file := range AttributesFiles() {
+		files = append(files, attributesFile{path: file})
+	}
+
+	for _, file := range files {
+		attributes, err := os.Open(file.path)
+		if err != nil {
+			continue
+		}
+
+		// the lines of the global file are relative to the root of
+		// the repository, and it is named by its own path.
+		source, dir := filepath.ToSlash(file.path), ""
+		if !file.global {
+			relfile, _ := filepath.Rel(config.LocalWorkingDir, file.path)
+			source = filepath.ToSlash(relfile)
+			if d := path.Dir(source); d != "." && source != ".git/info/attributes" {
+				dir = d
+			}
+		}
+
+		scanner := bufio.NewScanner(attributes)
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			line := &AttributesLine{Source: source, LineNo: lineNo, Dir: dir, Global: file.global}
+
+			if pattern, attrs, ok := ParseAttributesLine(scanner.Text()); ok {
+				line.Pattern, line.Attrs = pattern, attrs
+				lines = append(lines, line)
+			} else if macros := NewAttributeMacroSet(); macros.Define(scanner.Text()) {
+				definitions = append(definitions, line)
+			}
+		}
+		attributes.Close()
+	}
+
+	return lines, definitions
+}
+
+// Rank returns the precedence of the lines of the line's attributes file:
+// those of the repository override those of the global attributes file, those
+// in deeper directories override those in shallower ones, and those in
+// .git/info/attributes override them all.
+func (l *AttributesLine) Rank() int {
+	if l.Global {
+		return -1
+	}
+	if l.Source == ".git/info/attributes" {
+		return 1 << 30
+	}
+	if len(l.Dir) == 0 {
+		return 0
+	}
+	return strings.Count(l.Dir, "/") + 1
+}
+
+// Overrides returns whether Git gives the attributes of l precedence over
+// those of other, for the files they both match.
+func (l *AttributesLine) Overrides(other *AttributesLine) bool {
+	if l.Source == other.Source {
+		return l.LineNo > other.LineNo
+	}
+	return l.Rank() > other.Rank()
+}
+
+// AttributesLinesByPrecedence sorts lines from the lowest precedence to the
+// highest. Sorted stably, lines of the same file stay in order.
+type AttributesLinesByPrecedence []*AttributesLine
+
+func (l AttributesLinesByPrecedence) Len() int           { return len(l) }
+func (l AttributesLinesByPrecedence) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l AttributesLinesByPrecedence) Less(i, j int) bool { return l[i].Rank() < l[j].Rank() }
+
+// attributeRule is a line of an attributes file, with its attributes' macros
+// expanded.
+type attributeRule struct {
+	line  *AttributesLine
+	attrs []string
+}
+
+// value returns the value the rule gives attr, as 'git check-attr' gives it,
+// and whether it gives it one: the last of its attributes naming attr wins.
+func (r *attributeRule) value(attr string) (string, bool) {
+	var value string
+	var ok bool
+	for _, a := range r.attrs {
+		switch {
+		case a == attr:
+			value, ok = "set", true
+		case a == "-"+attr:
+			value, ok = "unset", true
+		case a == "!"+attr:
+			value, ok = "unspecified", true
+		case strings.HasPrefix(a, attr+"="):
+			value, ok = a[len(attr)+1:], true
+		}
+	}
+	return value, ok
+}
+
+// AttributeMatcher gives the attributes of files as Git would from the lines of
+// a repository's attributes files, without running 'git check-attr'. The lines
+// which may apply to the files in each directory are worked out once for that
+// directory and cached, so that matching many files is fast.
+//
+// It is safe to use from multiple goroutines.
+type AttributeMatcher struct {
+	// rules are the lines which may match files, from the highest
+	// precedence to the lowest.
+	rules      []*attributeRule
+	ignoreCase bool
+
+	mu sync.Mutex
+	// dirs holds the rules which may match the files in each directory,
+	// keyed by its slash-separated path, in the same order as rules.
+	dirs map[string][]*attributeRule
+}
+
+// NewAttributeMatcher returns a matcher of the given lines, whose macros are
+// those of the given set. If ignoreCase is true, files are matched as on a
+// case-insensitive file system.
+func NewAttributeMatcher(lines []*AttributesLine, macros AttributeMacroSet, ignoreCase bool) *AttributeMatcher {
+	sorted := make(AttributesLinesByPrecedence, 0, len(lines))
+	for _, l := range lines {
+		// Git ignores negative patterns in attributes files.
+		if !strings.HasPrefix(l.Pattern, "!") {
+			sorted = append(sorted, l)
+		}
+	}
+	sort.Stable(sorted)
+
+	rules := make([]*attributeRule, 0, len(sorted))
+	for i := len(sorted) - 1; i >= 0; i-- {
+		rules = append(rules, &attributeRule{line: sorted[i], attrs: macros.Expand(sorted[i].Attrs)})
+	}
+
+	return &AttributeMatcher{
+		rules:      rules,
+		ignoreCase: ignoreCase,
+		dirs:       make(map[string][]*attributeRule),
+	}
+}
+
+// LocalAttributeMatcher returns a matcher of the current repository's
+// attributes files, matching files case-insensitively if core.ignorecase is
+// set.
+func LocalAttributeMatcher() *AttributeMatcher {
+	lines, _ := ReadAttributesLines()
+	return NewAttributeMatcher(lines, LocalAttributeMacros(), config.Config.Git.Bool("core.ignorecase", false))
+}
+
+// Value returns the value of attr for the file at the given slash-separated
+// path, relative to the root of the repository, as 'git check-attr' gives it:
+// "set", "unset", "unspecified", or the value it's set to.
+func (m *AttributeMatcher) Value(name, attr string) string {
+	value, _ := m.match(name, attr)
+	return value
+}
+
+// Line returns the line of the attributes files which gives attr its value for
+// the file at the given slash-separated path, relative to the root of the
+// repository, or nil if none does.
+func (m *AttributeMatcher) Line(name, attr string) *AttributesLine {
+	_, line := m.match(name, attr)
+	return line
+}
+
+// match returns the value of attr for the file at the given path, and the line
+// which gives it that value, if any.
+func (m *AttributeMatcher) match(name, attr string) (string, *AttributesLine) {
+	name = path.Clean(name)
+	for _, r := range m.dirRules(path.Dir(name)) {
+		if value, ok := r.value(attr); ok && r.line.Matches(name, m.ignoreCase) {
+			return value, r.line
+		}
+	}
+	return "unspecified", nil
+}
+
+// TracksWithLFS returns whether the file at the given slash-separated path,
+// relative to the root of the repository, is tracked by Git LFS.
+func (m *AttributeMatcher) TracksWithLFS(name string) bool {
+	return m.Value(name, "filter") == "lfs"
+}
+
+// dirRules returns the rules which may match the files in the given
+// slash-separated directory: those of the attributes files in it and in the
+// directories above it.
+func (m *AttributeMatcher) dirRules(dir string) []*attributeRule {
+	if dir == "." {
+		dir = ""
+	}
+	if m.ignoreCase {
+		dir = strings.ToLower(dir)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rules, ok := m.dirs[dir]; ok {
+		return rules
+	}
+
+	var rules []*attributeRule
+	for _, r := range m.rules {
+		ruleDir := r.line.Dir
+		if m.ignoreCase {
+			ruleDir = strings.ToLower(ruleDir)
+		}
+		if len(ruleDir) == 0 || ruleDir == dir || strings.HasPrefix(dir, ruleDir+"/") {
+			rules = append(rules, r)
+		}
+	}
+	m.dirs[dir] = rules
+	return rules
+}
@@ -0,0 +1,100 @@
+package lfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testAttributesLine(source string, lineNo int, dir, line string) *AttributesLine {
+	pattern, attrs, _ := ParseAttributesLine(line)
+	return &AttributesLine{Source: source, LineNo: lineNo, Dir: dir, Pattern: pattern, Attrs: attrs}
+}
+
+func TestAttributeMatcherValue(t *testing.T) {
+	macros := NewAttributeMacroSet()
+	macros.Define(LFSMacro.Definition())
+
+	m := NewAttributeMatcher([]*AttributesLine{
+		testAttributesLine(".gitattributes", 1, "", "*.dat lfs"),
+		testAttributesLine(".gitattributes", 2, "", "small.dat -filter eol=lf"),
+		testAttributesLine(".gitattributes", 3, "", "!*.bin lfs"),
+		testAttributesLine("sub/.gitattributes", 1, "sub", "*.dat !filter"),
+		testAttributesLine("sub/.gitattributes", 2, "sub", "/*.psd filter=lfs"),
+		testAttributesLine(".git/info/attributes", 1, "", "local.psd -filter"),
+	}, macros, false)
+
+	for name, expected := range map[string]string{
+		"a.dat":           "lfs",
+		"deep/a/b.dat":    "lfs",
+		"small.dat":       "unset",
+		"x.bin":           "unspecified",
+		"sub/a.dat":       "unspecified",
+		"sub/deep/a.dat":  "unspecified",
+		"sub/a.psd":       "lfs",
+		"sub/deep/a.psd":  "unspecified",
+		"sub/local.psd":   "unset",
+		"subdir/a.dat":    "lfs",
+		"./a.dat":         "lfs",
+		"A.DAT":           "unspecified",
+		"other/small.dat": "unset",
+	} {
+		assert.Equal(t, expected, m.Value(name, "filter"), "file: %q", name)
+	}
+
+	assert.Equal(t, "lf", m.Value("small.dat", "eol"))
+	assert.Equal(t, "unset", m.Value("a.dat", "text"))
+	assert.Equal(t, "set", m.Value("a.dat", "lfs"))
+	assert.True(t, m.TracksWithLFS("a.dat"))
+	assert.False(t, m.TracksWithLFS("small.dat"))
+
+	assert.Equal(t, 1, m.Line("a.dat", "filter").LineNo)
+	assert.Equal(t, "sub/.gitattributes", m.Line("sub/a.psd", "filter").Source)
+	assert.Nil(t, m.Line("x.bin", "filter"))
+}
+
+func TestAttributeMatcherGlobalAttributes(t *testing.T) {
+	global := testAttributesLine("/home/user/.config/git/attributes", 1, "", "*.bin filter=lfs")
+	global.Global = true
+	otherGlobal := testAttributesLine("/home/user/.config/git/attributes", 2, "", "*.iso filter=lfs")
+	otherGlobal.Global = true
+
+	m := NewAttributeMatcher([]*AttributesLine{
+		testAttributesLine(".git/info/attributes", 1, "", "local.bin -filter"),
+		testAttributesLine(".gitattributes", 1, "", "*.iso -filter"),
+		global,
+		otherGlobal,
+	}, NewAttributeMacroSet(), false)
+
+	assert.True(t, m.TracksWithLFS("a.bin"))
+	assert.True(t, m.TracksWithLFS("sub/a.bin"))
+	assert.False(t, m.TracksWithLFS("local.bin"))
+	assert.False(t, m.TracksWithLFS("a.iso"))
+	assert.Equal(t, global, m.Line("a.bin", "filter"))
+}
+
+func TestAttributeMatcherIgnoreCase(t *testing.T) {
+	lines := []*AttributesLine{
+		testAttributesLine("Sub/.gitattributes", 1, "Sub", "*.dat filter=lfs"),
+	}
+
+	assert.False(t, NewAttributeMatcher(lines, NewAttributeMacroSet(), false).TracksWithLFS("sub/A.DAT"))
+	assert.True(t, NewAttributeMatcher(lines, NewAttributeMacroSet(), true).TracksWithLFS("sub/A.DAT"))
+}
+
+func TestAttributeMatcherCachesRulesByDirectory(t *testing.T) {
+	m := NewAttributeMatcher([]*AttributesLine{
+		testAttributesLine(".gitattributes", 1, "", "*.dat filter=lfs"),
+		testAttributesLine("a/.gitattributes", 1, "a", "*.psd filter=lfs"),
+	}, NewAttributeMacroSet(), false)
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, m.TracksWithLFS("a/b/"+strings.Repeat("x", i)+".psd"))
+	}
+	assert.True(t, m.TracksWithLFS("b/x.dat"))
+
+	assert.Len(t, m.dirs, 2)
+	assert.Len(t, m.dirs["a/b"], 2)
+	assert.Len(t, m.dirs["b"], 1)
+}
@@ -0,0 +1,149 @@
+package lfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/localstorage"
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+)
+
+// PointerLinkToFile writes the object of ptr to the working tree file with the
+// given name by linking it to the object in the given checkout mode, rather
+// than copying it. It returns false, and leaves the file alone, if that isn't
+// possible or safe: if the mode is config.CheckoutCopy, the object is missing
+// or has extensions, the file is or should be executable, or the file system
+// doesn't support the link, so that the caller can copy the object instead.
+//
+// Objects are read-only, so that the working tree files hard linked to them
+// can't be modified in place. If one has been anyway, found by it being
+// writable again, it's moved to .git/lfs/bad as "git lfs fsck" does, and an
+// error is returned.
+func PointerLinkToFile(filename string, ptr *Pointer, executable bool, mode string) (bool, error) {
+	if mode == config.CheckoutCopy || len(ptr.Extensions) > 0 || executable {
+		return false, nil
+	}
+	if mode == config.CheckoutHardlink && runtime.GOOS == "windows" {
+		// read-only files can't be removed by Git on Windows.
+		return false, nil
+	}
+
+	LinkOrCopyFromReference(ptr.Oid, ptr.Size)
+	if !ObjectExistsOfSize(ptr.Oid, ptr.Size) {
+		return false, nil
+	}
+	if err := EnsureWholeObject(ptr.Oid, ptr.Size); err != nil {
+		return false, err
+	}
+
+	mediafile, err := LocalMediaPath(ptr.Oid)
+	if err != nil {
+		return false, err
+	}
+	object, err := os.Stat(mediafile)
+	if err != nil {
+		return false, err
+	}
+
+	if stat, err := os.Stat(filename); err == nil {
+		if stat.Mode()&0111 != 0 {
+			return false, nil
+		}
+		if os.SameFile(stat, object) {
+			return true, nil
+		}
+	}
+
+	dir := filepath.Dir(filename)
+	os.MkdirAll(dir, 0755)
+	tmp, err := ioutil.TempFile(dir, ".git-lfs-checkout-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	switch mode {
+	case config.CheckoutHardlink:
+		tmp.Close()
+		if ok, err := linkObject(ptr.Oid, mediafile, object, tmp.Name()); !ok || err != nil {
+			return false, err
+		}
+	case config.CheckoutReflink:
+		ok, err := cloneObject(mediafile, tmp)
+		tmp.Close()
+		if !ok || err != nil {
+			return false, err
+		}
+	default:
+		tmp.Close()
+		return false, nil
+	}
+
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return false, fmt.Errorf("Could not link working directory file: %v", err)
+	}
+	recordAccess(ptr.Oid)
+	return true, nil
+}
+
+// linkObject hard links the object with the given oid, at mediafile, to the
+// path given by name, replacing it.
+func linkObject(oid, mediafile string, object os.FileInfo, name string) (bool, error) {
+	if err := verifyLinkedObject(oid, mediafile, object); err != nil {
+		return false, err
+	}
+
+	if err := localstorage.ProtectObject(mediafile); err != nil {
+		return false, err
+	}
+
+	os.Remove(name)
+	if err := os.Link(mediafile, name); err != nil {
+		tracerx.Printf("checkout: unable to hard link %s, copying it: %s", oid, err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// verifyLinkedObject checks the object with the given oid, at mediafile, if it
+// has been made writable while other files are hard linked to it, in which case
+// it may have been modified through one of them. If it doesn't match its oid,
+// it's moved to .git/lfs/bad and an error is returned.
+func verifyLinkedObject(oid, mediafile string, object os.FileInfo) error {
+	if localstorage.IsProtected(object) || linkCount(object) < 2 {
+		return nil
+	}
+
+	if err := tools.VerifyFileHash(oid, mediafile); err == nil {
+		return nil
+	}
+
+	badDir := filepath.Join(config.LocalGitStorageDir, "lfs", "bad")
+	if err := os.MkdirAll(badDir, 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(mediafile, filepath.Join(badDir, oid)); err != nil {
+		return err
+	}
+	return fmt.Errorf("Object %s was modified through a hard link to it, moved it to %s", oid, badDir)
+}
+
+// cloneObject reflinks the object at mediafile to the file f.
+func cloneObject(mediafile string, f *os.File) (bool, error) {
+	src, err := os.Open(mediafile)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	if ok, err := tools.CloneFile(f, src); !ok {
+		tracerx.Printf("checkout: unable to reflink %s, copying it: %v", mediafile, err)
+		return false, nil
+	}
+	return true, os.Chmod(f.Name(), 0644)
+}
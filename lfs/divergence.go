@@ -0,0 +1,218 @@
+package lfs
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/filepathfilter"
+	"github.com/git-lfs/git-lfs/git"
+)
+
+// Divergence is how a file differs from the form Git LFS keeps it in.
+type Divergence int
+
+const (
+	// DivergentContent is a file tracked by Git LFS whose blob holds its
+	// contents rather than a pointer, as when it was added before it was
+	// tracked, or without Git LFS installed.
+	DivergentContent Divergence = iota + 1
+	// DivergentPointerFile is a file tracked by Git LFS whose blob is a
+	// pointer, but which holds the pointer in the working tree rather than
+	// its contents, as when it wasn't checked out.
+	DivergentPointerFile
+	// DivergentUntrackedPointer is a file whose blob is a pointer, but
+	// which isn't tracked by Git LFS, so that it's checked out as the
+	// pointer.
+	DivergentUntrackedPointer
+)
+
+// DivergentFile is a file in the index or a tree which differs from the form
+// Git LFS keeps it in.
+type DivergentFile struct {
+	// Name is the file's path relative to the root of the repository.
+	Name       string
+	Divergence Divergence
+	// Pointer is the file's pointer, unless its Divergence is
+	// DivergentContent.
+	Pointer *Pointer
+	// Mode is the file's mode, such as "100755".
+	Mode string
+}
+
+// DivergentIndexFiles returns the files allowed by the filter which are staged
+// in the index, or held in the working tree, in another form than Git LFS
+// keeps them in.
+func DivergentIndexFiles(filter *filepathfilter.Filter) ([]*DivergentFile, error) {
+	entries, err := git.IndexEntries()
+	if err != nil {
+		return nil, err
+	}
+	return divergentIndexFiles(entries, filter)
+}
+
+// DivergentChangedFiles is like DivergentIndexFiles, but only looks at the files
+// which are staged with changes from HEAD, or changed in the working tree, so
+// that it doesn't read every file in a large repository.
+func DivergentChangedFiles(filter *filepathfilter.Filter) ([]*DivergentFile, error) {
+	entries, err := git.ChangedIndexEntries()
+	if err != nil {
+		return nil, err
+	}
+	return divergentIndexFiles(entries, filter)
+}
+
+// divergentIndexFiles returns the files among the given index entries which are
+// staged, or held in the working tree, in another form than Git LFS keeps them
+// in.
+func divergentIndexFiles(entries []*git.BlobEntry, filter *filepathfilter.Filter) ([]*DivergentFile, error) {
+	files, err := divergentFiles(entries, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// The files tracked by Git LFS whose blobs are pointers should hold
+	// their contents in the working tree. Those which the core.fsmonitor
+	// hook says are unchanged since they were last read aren't read again.
+	monitor := localFSMonitor()
+	read := make(map[string]string)
+	for _, e := range entries {
+		if !e.IsRegular() || !filter.Allows(e.Path) {
+			continue
+		}
+
+		pointer, tracked := files.pointers[e.Sha1], files.tracked[e.Path]
+		if pointer == nil || !tracked {
+			continue
+		}
+
+		oid, ok := "", false
+		if monitor != nil {
+			oid, ok = monitor.Pointer(e.Path)
+		}
+		if !ok {
+			oid = worktreePointerOid(filepath.Join(config.LocalWorkingDir, filepath.FromSlash(e.Path)))
+			read[e.Path] = oid
+		}
+
+		if oid == pointer.Oid {
+			files.divergent = append(files.divergent, &DivergentFile{
+				Name: e.Path, Divergence: DivergentPointerFile, Pointer: pointer, Mode: e.Mode,
+			})
+		}
+	}
+	if monitor != nil && len(read) > 0 {
+		monitor.SetPointers(read)
+	}
+
+	return files.divergent, nil
+}
+
+// worktreePointerOid returns the oid of the pointer the working tree file at the
+// given path holds, or "" if it doesn't hold one.
+func worktreePointerOid(path string) string {
+	if fi, err := os.Stat(path); err != nil || fi.Size() >= blobSizeCutoff {
+		return ""
+	}
+	if filepointer, err := DecodePointerFromFile(path); err == nil {
+		return filepointer.Oid
+	}
+	return ""
+}
+
+// DivergentPushedFiles returns the files allowed by the filter which are
+// changed by the commits reachable from the given ref but not from the
+// remote-tracking branches of the given remote, as those being pushed are, and
+// are left in another form than Git LFS keeps them in, as the current
+// attributes tell.
+func DivergentPushedFiles(ref, remote string, filter *filepathfilter.Filter) ([]*DivergentFile, error) {
+	entries, err := git.ChangedTreeEntries(ref, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := divergentFiles(entries, filter)
+	if err != nil {
+		return nil, err
+	}
+	return files.divergent, nil
+}
+
+// divergentBlobs holds what divergentFiles found about a set of blob entries.
+type divergentBlobs struct {
+	divergent []*DivergentFile
+	// pointers holds the pointers among the blobs, keyed by their sha1s.
+	pointers map[string]*Pointer
+	// tracked holds the paths which are tracked by Git LFS.
+	tracked map[string]bool
+}
+
+// divergentFiles returns the regular files among the given entries which the
+// filter allows whose blobs are contents although they're tracked by Git LFS,
+// or pointers although they aren't.
+func divergentFiles(entries []*git.BlobEntry, filter *filepathfilter.Filter) (*divergentBlobs, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	shas := make(chan string, len(entries))
+	for _, e := range entries {
+		if !e.IsRegular() || !filter.Allows(e.Path) {
+			continue
+		}
+
+		paths = append(paths, e.Path)
+		if !seen[e.Sha1] {
+			seen[e.Sha1] = true
+			shas <- e.Sha1
+		}
+	}
+	close(shas)
+
+	attributes := LocalAttributeMatcher()
+	// the blob of an empty file, which the clean filter leaves alone
+	// rather than storing it as an object.
+	emptyBlob := git.EmptyBlob()
+
+	errCh := make(chan error)
+	close(errCh)
+	smallShas, err := catFileBatchCheck(NewStringChannelWrapper(shas, errCh))
+	if err != nil {
+		return nil, err
+	}
+	found, err := catFileBatch(smallShas)
+	if err != nil {
+		return nil, err
+	}
+
+	files := &divergentBlobs{
+		pointers: make(map[string]*Pointer),
+		tracked:  make(map[string]bool, len(paths)),
+	}
+	for p := range found.Results {
+		files.pointers[p.Sha1] = p.Pointer
+	}
+	if err := found.Wait(); err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if !e.IsRegular() || !filter.Allows(e.Path) {
+			continue
+		}
+
+		tracked := attributes.TracksWithLFS(e.Path)
+		files.tracked[e.Path] = tracked
+
+		pointer := files.pointers[e.Sha1]
+		if tracked && pointer == nil && e.Sha1 != emptyBlob {
+			files.divergent = append(files.divergent, &DivergentFile{
+				Name: e.Path, Divergence: DivergentContent, Mode: e.Mode,
+			})
+		} else if !tracked && pointer != nil {
+			files.divergent = append(files.divergent, &DivergentFile{
+				Name: e.Path, Divergence: DivergentUntrackedPointer, Pointer: pointer, Mode: e.Mode,
+			})
+		}
+	}
+
+	return files, nil
+}
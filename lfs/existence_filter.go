@@ -0,0 +1,75 @@
+package lfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/git-lfs/git-lfs/api"
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/rubyist/tracerx"
+)
+
+// existenceFilterCache is the form in which a server's existence filter is
+// cached on disk.
+type existenceFilterCache struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	// Filter is nil if the server didn't offer one.
+	Filter *api.ExistenceFilter `json:"filter"`
+}
+
+// ServerExistenceFilter returns a filter of the objects which the server that
+// objects are pushed to has, or nil if it doesn't offer one or
+// lfs.existencefilter is false. Filters are cached in .git/lfs/cache/existence,
+// and fetched again after lfs.existencefiltermaxage seconds.
+func ServerExistenceFilter(cfg *config.Configuration) *api.ExistenceFilter {
+	if !cfg.Git.Bool("lfs.existencefilter", true) {
+		return nil
+	}
+
+	// rsync+ssh://, webdav+http(s):// and ipfs+http(s):// endpoints have no
+	// server to offer one.
+	e := cfg.Endpoint("upload")
+	if e.IsRsync() || e.IsWebdav() || e.IsIpfs() {
+		return nil
+	}
+
+	endpoint := e.Url
+	if len(endpoint) == 0 {
+		return nil
+	}
+
+	key := sha256.Sum256([]byte(endpoint))
+	cachePath := filepath.Join(config.LocalGitStorageDir, "lfs", "cache", "existence", hex.EncodeToString(key[:]))
+	maxAge := time.Duration(cfg.Git.Int("lfs.existencefiltermaxage", 3600)) * time.Second
+
+	var cached existenceFilterCache
+	if by, err := ioutil.ReadFile(cachePath); err == nil && json.Unmarshal(by, &cached) == nil {
+		if time.Since(cached.FetchedAt) < maxAge && (cached.Filter == nil || cached.Filter.Valid()) {
+			return cached.Filter
+		}
+	}
+
+	cached = existenceFilterCache{FetchedAt: time.Now()}
+
+	client := api.NewClient(api.NewHttpLifecycle(cfg))
+	schema, filter := client.Existence.Filter()
+	if _, err := client.Do(schema); err != nil {
+		tracerx.Printf("api: no existence filter from %s: %s", endpoint, err)
+	} else if !filter.Valid() {
+		tracerx.Printf("api: invalid existence filter from %s", endpoint)
+	} else {
+		cached.Filter = filter
+	}
+
+	if by, err := json.Marshal(cached); err == nil {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+			ioutil.WriteFile(cachePath, by, 0644)
+		}
+	}
+	return cached.Filter
+}
@@ -5,7 +5,6 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"hash"
 	"io"
 	"os"
 	"os/exec"
@@ -32,115 +31,117 @@ type pipeExtResult struct {
 	oidOut string
 }
 
-type extCommand struct {
-	cmd    *exec.Cmd
-	out    io.WriteCloser
-	err    *bytes.Buffer
-	hasher hash.Hash
-	result *pipeExtResult
-}
-
+// pipeExtensions runs the request's extensions one after another, as the
+// stages of a pipeline: the first reads the request's reader, and each of the
+// others the whole output of the one before it, which is kept in a temporary
+// file until it has finished. The output of the last is left in response.file,
+// and the oids of what each read and wrote are given in response.results, in
+// the order they ran.
+//
+// If an optional extension fails to clean a file, a warning is written and the
+// pipeline carries on without it, as though it had passed the file through
+// unchanged. Any other failure stops the pipeline, and is returned.
 func pipeExtensions(request *pipeRequest) (response pipeResponse, err error) {
-	var extcmds []*extCommand
-	for _, e := range request.extensions {
-		var pieces []string
-		switch request.action {
-		case "clean":
-			pieces = strings.Split(e.Clean, " ")
-		case "smudge":
-			pieces = strings.Split(e.Smudge, " ")
-		default:
-			err = fmt.Errorf("Invalid action: " + request.action)
-			return
-		}
-		name := strings.Trim(pieces[0], " ")
-		var args []string
-		for _, value := range pieces[1:] {
-			arg := strings.Replace(value, "%f", request.fileName, -1)
-			args = append(args, arg)
-		}
-		cmd := exec.Command(name, args...)
-		ec := &extCommand{cmd: cmd, result: &pipeExtResult{name: e.Name}}
-		extcmds = append(extcmds, ec)
+	if request.action != "clean" && request.action != "smudge" {
+		err = fmt.Errorf("Invalid action: " + request.action)
+		return
 	}
-
-	hasher := sha256.New()
-	pipeReader, pipeWriter := io.Pipe()
-	multiWriter := io.MultiWriter(hasher, pipeWriter)
-
-	var input io.Reader
-	var output io.WriteCloser
-	input = pipeReader
-	extcmds[0].cmd.Stdin = input
-	if response.file, err = TempFile(""); err != nil {
+	if err = config.Config.CheckFipsExtensions(request.extensions); err != nil {
 		return
 	}
-	defer response.file.Close()
-	output = response.file
 
-	last := len(extcmds) - 1
-	for i, ec := range extcmds {
-		ec.hasher = sha256.New()
+	input, oid, err := writeExtensionStage(request.reader)
+	if err != nil {
+		return
+	}
 
-		if i == last {
-			ec.cmd.Stdout = io.MultiWriter(ec.hasher, output)
-			ec.out = output
-			continue
-		}
+	for _, e := range request.extensions {
+		output, outOid, extErr := runExtension(e, request.action, request.fileName, input)
+		if extErr != nil {
+			if request.action == "clean" && e.Optional {
+				fmt.Fprintf(os.Stderr, "Skipping optional extension '%s' for %s: %s\n", e.Name, request.fileName, extErr)
+				response.results = append(response.results, &pipeExtResult{name: e.Name, oidIn: oid, oidOut: oid})
+				continue
+			}
 
-		nextec := extcmds[i+1]
-		var nextStdin io.WriteCloser
-		var stdout io.ReadCloser
-		if nextStdin, err = nextec.cmd.StdinPipe(); err != nil {
-			return
-		}
-		if stdout, err = ec.cmd.StdoutPipe(); err != nil {
+			os.Remove(input.Name())
+			err = extErr
 			return
 		}
 
-		ec.cmd.Stdin = input
-		ec.cmd.Stdout = io.MultiWriter(ec.hasher, nextStdin)
-		ec.out = nextStdin
+		os.Remove(input.Name())
+		response.results = append(response.results, &pipeExtResult{name: e.Name, oidIn: oid, oidOut: outOid})
+		input, oid = output, outOid
+	}
 
-		input = stdout
+	response.file = input
+	return
+}
 
-		var errBuff bytes.Buffer
-		ec.err = &errBuff
-		ec.cmd.Stderr = ec.err
+// writeExtensionStage writes the contents of r to a temporary file, from which
+// the first stage of an extension pipeline reads them, and returns it with
+// their oid.
+func writeExtensionStage(r io.Reader) (*os.File, string, error) {
+	file, err := TempFile("")
+	if err != nil {
+		return nil, "", err
 	}
+	defer file.Close()
 
-	for _, ec := range extcmds {
-		if err = ec.cmd.Start(); err != nil {
-			return
-		}
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(hasher, file), r); err != nil {
+		os.Remove(file.Name())
+		return nil, "", err
 	}
+	return file, hex.EncodeToString(hasher.Sum(nil)), nil
+}
 
-	if _, err = io.Copy(multiWriter, request.reader); err != nil {
-		return
+// runExtension runs the extension's command for the given action on the
+// contents of input, and returns a temporary file holding its output, with
+// their oid.
+func runExtension(e config.Extension, action, fileName string, input *os.File) (*os.File, string, error) {
+	command := e.Clean
+	if action == "smudge" {
+		command = e.Smudge
 	}
-	if err = pipeWriter.Close(); err != nil {
-		return
+
+	pieces := strings.Split(command, " ")
+	name := strings.Trim(pieces[0], " ")
+	var args []string
+	for _, value := range pieces[1:] {
+		arg := strings.Replace(value, "%f", fileName, -1)
+		args = append(args, arg)
 	}
 
-	for _, ec := range extcmds {
-		if err = ec.cmd.Wait(); err != nil {
-			if ec.err != nil {
-				errStr := ec.err.String()
-				err = fmt.Errorf("Extension '%s' failed with: %s", ec.result.name, errStr)
-			}
-			return
-		}
-		if err = ec.out.Close(); err != nil {
-			return
-		}
+	in, err := os.Open(input.Name())
+	if err != nil {
+		return nil, "", err
 	}
+	defer in.Close()
 
-	oid := hex.EncodeToString(hasher.Sum(nil))
-	for _, ec := range extcmds {
-		ec.result.oidIn = oid
-		oid = hex.EncodeToString(ec.hasher.Sum(nil))
-		ec.result.oidOut = oid
-		response.results = append(response.results, ec.result)
+	output, err := TempFile("")
+	if err != nil {
+		return nil, "", err
 	}
-	return
+	defer output.Close()
+
+	hasher := sha256.New()
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = in
+	cmd.Stdout = io.MultiWriter(hasher, output)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		os.Remove(output.Name())
+
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) == 0 {
+			msg = err.Error()
+		}
+		return nil, "", fmt.Errorf("Extension '%s' failed with: %s", e.Name, msg)
+	}
+
+	return output, hex.EncodeToString(hasher.Sum(nil)), nil
 }
@@ -0,0 +1,233 @@
+package lfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/rubyist/tracerx"
+)
+
+var (
+	worktreeMonitor     *fsmonitor
+	worktreeMonitorOnce sync.Once
+)
+
+// fsmonitorCache is what was found about the working tree as of the token the
+// core.fsmonitor hook gave, cached on disk so that the next command only needs
+// to look at the files changed since.
+type fsmonitorCache struct {
+	Token string `json:"token"`
+	// AttributesFiles holds the paths of the .gitattributes files, relative
+	// to the root of the working tree, or is nil if they weren't found.
+	AttributesFiles []string `json:"attributes_files"`
+	// Pointers holds the oid of the pointer each file which was read
+	// held, keyed by its path relative to the root of the working tree,
+	// or "" if it didn't hold one.
+	Pointers map[string]string `json:"pointers"`
+}
+
+// fsmonitor answers which files in the working tree changed since the last
+// command looked at them, through the hook core.fsmonitor names, such as the
+// one Git provides for Watchman, so that commands can use what they found then
+// about the rest instead of walking the whole working tree again.
+type fsmonitor struct {
+	path  string
+	cache *fsmonitorCache
+	mu    sync.Mutex
+}
+
+// localFSMonitor returns the monitor of the current working tree, asking the
+// core.fsmonitor hook which files have changed the first time it's called. It
+// returns nil if there's no hook, or it can't be asked.
+func localFSMonitor() *fsmonitor {
+	worktreeMonitorOnce.Do(func() {
+		worktreeMonitor = newFSMonitor()
+	})
+	return worktreeMonitor
+}
+
+func newFSMonitor() *fsmonitor {
+	hook, _ := config.Config.Git.Get("core.fsmonitor")
+	if len(hook) == 0 || len(config.LocalWorkingDir) == 0 || len(config.LocalGitDir) == 0 {
+		return nil
+	}
+	if b, err := strconv.ParseBool(hook); err == nil {
+		// core.fsmonitor=true uses Git's own daemon, which can only be
+		// asked by Git.
+		if b {
+			tracerx.Printf("fsmonitor: built-in daemon not supported, walking the working tree")
+		}
+		return nil
+	}
+	if version, _ := config.Config.Git.Get("core.fsmonitorhookversion"); len(version) > 0 && version != "2" {
+		tracerx.Printf("fsmonitor: hook version %s not supported, walking the working tree", version)
+		return nil
+	}
+	if !filepath.IsAbs(hook) && strings.ContainsAny(hook, `/\`) {
+		hook = filepath.Join(config.LocalWorkingDir, hook)
+	}
+
+	m := &fsmonitor{path: filepath.Join(config.LocalGitDir, "lfs", "fsmonitor")}
+
+	var cached fsmonitorCache
+	if by, err := ioutil.ReadFile(m.path); err == nil {
+		if err := json.Unmarshal(by, &cached); err != nil {
+			cached = fsmonitorCache{}
+		}
+	}
+
+	cmd := subprocess.ExecCommand(hook, "2", cached.Token)
+	cmd.Dir = config.LocalWorkingDir
+	out, err := cmd.Output()
+	if err != nil {
+		tracerx.Printf("fsmonitor: unable to run %s: %s", hook, err)
+		return nil
+	}
+
+	token, changed, all, ok := parseFSMonitorOutput(out)
+	if !ok {
+		tracerx.Printf("fsmonitor: unable to parse the output of %s", hook)
+		return nil
+	}
+
+	m.cache = &fsmonitorCache{Token: token, Pointers: make(map[string]string)}
+	if all || len(cached.Token) == 0 {
+		tracerx.Printf("fsmonitor: every file may have changed")
+		return m
+	}
+
+	tracerx.Printf("fsmonitor: %d path(s) changed", len(changed))
+	changedSet := make(map[string]bool, len(changed))
+	attributesChanged := false
+	for _, path := range changed {
+		changedSet[path] = true
+		attributesChanged = attributesChanged || path == ".gitattributes" || strings.HasSuffix(path, "/.gitattributes")
+	}
+
+	if !attributesChanged {
+		m.cache.AttributesFiles = cached.AttributesFiles
+	}
+	for path, oid := range cached.Pointers {
+		if !changedSet[path] {
+			m.cache.Pointers[path] = oid
+		}
+	}
+	return m
+}
+
+// parseFSMonitorOutput parses the output of a core.fsmonitor hook run with
+// version 2 of its protocol: a token, followed by the paths changed since the
+// token it was given, each ended by a NUL. all is true if every file may have
+// changed: if a path is "/", or a directory, given with a trailing slash, which
+// is taken to mean that any file in it may have.
+func parseFSMonitorOutput(out []byte) (token string, changed []string, all bool, ok bool) {
+	fields := bytes.Split(out, []byte{0})
+	if len(fields) < 2 || len(fields[0]) == 0 {
+		return "", nil, false, false
+	}
+
+	token = string(fields[0])
+	for _, field := range fields[1:] {
+		path := string(field)
+		switch {
+		case len(path) == 0:
+		case strings.HasSuffix(path, "/"):
+			all = true
+		default:
+			changed = append(changed, path)
+		}
+	}
+	return token, changed, all, true
+}
+
+// AttributesFiles returns the paths of the .gitattributes files in the working
+// tree, if they're unchanged since they were last found.
+func (m *fsmonitor) AttributesFiles() ([]string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cache.AttributesFiles == nil {
+		return nil, false
+	}
+	paths := make([]string, 0, len(m.cache.AttributesFiles))
+	for _, rel := range m.cache.AttributesFiles {
+		paths = append(paths, filepath.Join(config.LocalWorkingDir, filepath.FromSlash(rel)))
+	}
+	return paths, true
+}
+
+// SetAttributesFiles records the paths of the .gitattributes files found in
+// the working tree.
+func (m *fsmonitor) SetAttributesFiles(paths []string) {
+	rels := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if rel, err := filepath.Rel(config.LocalWorkingDir, path); err == nil {
+			rels = append(rels, filepath.ToSlash(rel))
+		}
+	}
+
+	m.mu.Lock()
+	m.cache.AttributesFiles = rels
+	m.mu.Unlock()
+	m.save()
+}
+
+// Pointer returns the oid of the pointer the file at the given path, relative
+// to the root of the working tree, held when it was last read, or "" if it
+// didn't hold one, if it's unchanged since.
+func (m *fsmonitor) Pointer(path string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oid, ok := m.cache.Pointers[path]
+	return oid, ok
+}
+
+// SetPointers records the oid of the pointer each of the given files held when
+// it was read, or "" if it didn't hold one.
+func (m *fsmonitor) SetPointers(pointers map[string]string) {
+	m.mu.Lock()
+	for path, oid := range pointers {
+		m.cache.Pointers[path] = oid
+	}
+	m.mu.Unlock()
+	m.save()
+}
+
+// save writes what's known about the working tree as of the monitor's token.
+func (m *fsmonitor) save() {
+	m.mu.Lock()
+	by, err := json.Marshal(m.cache)
+	m.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		tracerx.Printf("fsmonitor: unable to save: %s", err)
+		return
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(m.path), "fsmonitor")
+	if err != nil {
+		tracerx.Printf("fsmonitor: unable to save: %s", err)
+		return
+	}
+	_, err = tmp.Write(by)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), m.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		tracerx.Printf("fsmonitor: unable to save: %s", err)
+	}
+}
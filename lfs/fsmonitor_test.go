@@ -0,0 +1,32 @@
+package lfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFSMonitorOutput(t *testing.T) {
+	token, changed, all, ok := parseFSMonitorOutput([]byte("c:123:4\x00a.dat\x00dir/.gitattributes\x00"))
+	assert.True(t, ok)
+	assert.Equal(t, "c:123:4", token)
+	assert.Equal(t, []string{"a.dat", "dir/.gitattributes"}, changed)
+	assert.False(t, all)
+
+	token, changed, all, ok = parseFSMonitorOutput([]byte("c:123:5\x00"))
+	assert.True(t, ok)
+	assert.Equal(t, "c:123:5", token)
+	assert.Empty(t, changed)
+	assert.False(t, all)
+
+	for _, out := range []string{"c:123:6\x00/\x00", "c:123:6\x00a.dat\x00dir/\x00"} {
+		_, _, all, ok = parseFSMonitorOutput([]byte(out))
+		assert.True(t, ok, out)
+		assert.True(t, all, out)
+	}
+
+	for _, out := range []string{"", "c:123:7", "\x00a.dat\x00"} {
+		_, _, _, ok = parseFSMonitorOutput([]byte(out))
+		assert.False(t, ok, out)
+	}
+}
@@ -0,0 +1,341 @@
+package lfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/config"
+)
+
+// AttributeMacro is a Git attribute macro which sets the attributes of files
+// tracked by Git LFS under a single name, so that ".gitattributes" can say
+// "*.psd lfs" in place of "*.psd filter=lfs diff=lfs merge=lfs -text".
+type AttributeMacro struct {
+	Name       string
+	Attributes []string
+}
+
+// Definition returns the line of a .gitattributes file which defines the
+// macro.
+func (m *AttributeMacro) Definition() string {
+	return "[attr]" + m.Name + " " + strings.Join(m.Attributes, " ")
+}
+
+var (
+	// LFSMacro is set for files tracked by Git LFS as usual.
+	LFSMacro = &AttributeMacro{"lfs", []string{"filter=lfs", "diff=lfs", "merge=lfs", "-text"}}
+
+	// LFSLockableMacro is set for files which must also be locked before
+	// they're edited.
+	LFSLockableMacro = &AttributeMacro{"lfs-lockable", []string{"lfs", "lockable"}}
+
+	// LFSTextMacro is set for files whose "text" attribute is left to other
+	// lines of .gitattributes.
+	LFSTextMacro = &AttributeMacro{"lfs-text", []string{"filter=lfs", "diff=lfs", "merge=lfs"}}
+
+	// AttributeMacros are the macros which "git lfs track --macros" defines.
+	AttributeMacros = []*AttributeMacro{LFSMacro, LFSLockableMacro, LFSTextMacro}
+)
+
+// AttributeMacroSet holds the attribute macros defined in a repository, by
+// name.
+type AttributeMacroSet map[string][]string
+
+// NewAttributeMacroSet returns a set with Git's built-in "binary" macro.
+func NewAttributeMacroSet() AttributeMacroSet {
+	return AttributeMacroSet{"binary": {"-diff", "-merge", "-text"}}
+}
+
+// LocalAttributeMacros returns the macros defined in the user's global
+// attributes file, and in the root .gitattributes file of the current
+// repository and its .git/info/attributes, which are the only files of a
+// repository in which Git allows them.
+func LocalAttributeMacros() AttributeMacroSet {
+	macros := NewAttributeMacroSet()
+	for _, path := range []string{
+		GlobalAttributesFile(),
+		filepath.Join(config.LocalWorkingDir, ".gitattributes"),
+		filepath.Join(config.LocalGitDir, "info", "attributes"),
+	} {
+		if len(path) == 0 {
+			continue
+		}
+		if f, err := os.Open(path); err == nil {
+			macros.Read(f)
+			f.Close()
+		}
+	}
+	return macros
+}
+
+// Read adds the macros defined in the given .gitattributes file.
+func (s AttributeMacroSet) Read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		s.Define(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Define adds the macro defined by the given line of a .gitattributes file,
+// and returns whether it was a macro definition.
+func (s AttributeMacroSet) Define(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "[attr]") {
+		return false
+	}
+
+	s[strings.TrimPrefix(fields[0], "[attr]")] = fields[1:]
+	return true
+}
+
+// Defines returns whether the set defines the given macro as it is defined by
+// Git LFS.
+func (s AttributeMacroSet) Defines(m *AttributeMacro) bool {
+	attrs, ok := s[m.Name]
+	return ok && strings.Join(attrs, " ") == strings.Join(m.Attributes, " ")
+}
+
+// Expand returns the given attributes with each macro replaced by the
+// attributes it sets, in order, as Git does.
+func (s AttributeMacroSet) Expand(attrs []string) []string {
+	return s.expand(attrs, make(map[string]bool))
+}
+
+func (s AttributeMacroSet) expand(attrs []string, expanding map[string]bool) []string {
+	expanded := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		macro, ok := s[attr]
+		if !ok || expanding[attr] {
+			expanded = append(expanded, attr)
+			continue
+		}
+
+		expanding[attr] = true
+		expanded = append(expanded, attr)
+		expanded = append(expanded, s.expand(macro, expanding)...)
+		delete(expanding, attr)
+	}
+	return expanded
+}
+
+// TracksWithLFS returns whether the given attributes, with any macros
+// expanded, set the Git LFS filter.
+func (s AttributeMacroSet) TracksWithLFS(attrs []string) bool {
+	filter, _ := s.filter(attrs)
+	return filter == "filter=lfs"
+}
+
+// SetsFilter returns whether the given attributes, with any macros expanded,
+// set, unset or unspecify the "filter" attribute.
+func (s AttributeMacroSet) SetsFilter(attrs []string) bool {
+	_, ok := s.filter(attrs)
+	return ok
+}
+
+// filter returns the last of the given attributes, with any macros expanded,
+// which gives the "filter" attribute, and whether there is one.
+func (s AttributeMacroSet) filter(attrs []string) (string, bool) {
+	var filter string
+	var ok bool
+	for _, attr := range s.Expand(attrs) {
+		if attr == "filter" || strings.HasPrefix(attr, "filter=") ||
+			attr == "-filter" || attr == "!filter" {
+			filter, ok = attr, true
+		}
+	}
+	return filter, ok
+}
+
+// Shorten returns the attributes as one of the given macros, if they set
+// exactly the same attributes as it, in any order, or the attributes as they
+// were.
+func (s AttributeMacroSet) Shorten(attrs []string, macros []*AttributeMacro) []string {
+	set := s.attributeSet(attrs)
+	for _, m := range macros {
+		if !s.Defines(m) {
+			continue
+		}
+
+		mset := s.attributeSet(m.Attributes)
+		if len(mset) != len(set) {
+			continue
+		}
+
+		matched := true
+		for attr := range mset {
+			if !set[attr] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return []string{m.Name}
+		}
+	}
+	return attrs
+}
+
+// attributeSet returns the attributes which are set by the given ones, other
+// than the names of the macros among them.
+func (s AttributeMacroSet) attributeSet(attrs []string) map[string]bool {
+	set := make(map[string]bool, len(attrs))
+	for _, attr := range s.Expand(attrs) {
+		if _, ok := s[attr]; !ok {
+			set[attr] = true
+		}
+	}
+	return set
+}
+
+// RemoveLFSAttributes removes the lines of the repository's attributes files
+// which track files with Git LFS, and the definitions of the macros which do,
+// such as those "git lfs track --macros" adds. It returns the number of lines
+// removed from each file it changed, keyed by the file's path.
+func RemoveLFSAttributes() (map[string]int, error) {
+	macros := LocalAttributeMacros()
+	removed := make(map[string]int)
+	for _, path := range AttributesFiles() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return removed, err
+		}
+
+		kept, n := removeLFSAttributeLines(string(data), macros)
+		if n == 0 {
+			continue
+		}
+		if err := ioutil.WriteFile(path, []byte(kept), 0644); err != nil {
+			return removed, err
+		}
+		removed[path] = n
+	}
+	return removed, nil
+}
+
+// removeLFSAttributeLines returns the given attributes file without the lines
+// which track files with Git LFS or define macros which do, and how many lines
+// were removed. Line endings are left as they were.
+func removeLFSAttributeLines(data string, macros AttributeMacroSet) (string, int) {
+	var kept strings.Builder
+	var n int
+	for _, line := range strings.SplitAfter(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.HasPrefix(fields[0], "[attr]") {
+			if macros.TracksWithLFS([]string{strings.TrimPrefix(fields[0], "[attr]")}) {
+				n++
+				continue
+			}
+		} else if _, attrs, ok := ParseAttributesLine(line); ok && macros.TracksWithLFS(attrs) {
+			n++
+			continue
+		}
+		kept.WriteString(line)
+	}
+	return kept.String(), n
+}
+
+// ParseAttributesLine returns the pattern and the attributes given by a line
+// of a .gitattributes file, and false for blank lines, comments and macro
+// definitions.
+func ParseAttributesLine(line string) (string, []string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[attr]") {
+		return "", nil, false
+	}
+	return fields[0], fields[1:], true
+}
+
+// AttributesLine is a line of a .gitattributes file which gives the files
+// matching a pattern attributes.
+type AttributesLine struct {
+	// Source is the path of the file, relative to the root of the
+	// repository.
+	Source string
+	// LineNo is the number of the line in the file, counting from 1.
+	LineNo int
+	// Dir is the slash-separated directory, relative to the root of the
+	// repository, to which the pattern is relative, or "" for the root.
+	Dir     string
+	Pattern string
+	Attrs   []string
+	// Global is true for the lines of the user's global attributes file,
+	// whose Source is its path.
+	Global bool
+}
+
+// String returns the position of the line, as "<source>:<line>".
+func (l *AttributesLine) String() string {
+	return fmt.Sprintf("%s:%d", l.Source, l.LineNo)
+}
+
+// Matches returns whether the line's pattern matches the file at the given
+// slash-separated path, relative to the root of the repository, following the
+// rules for patterns in .gitignore files: a pattern without a slash, other
+// than a trailing one, matches the names of files at any depth below Dir, and
+// other patterns match paths relative to Dir. If ignoreCase is true, they are
+// matched as on a case-insensitive file system.
+func (l *AttributesLine) Matches(name string, ignoreCase bool) bool {
+	dir, pattern := l.Dir, l.Pattern
+	if ignoreCase {
+		dir, pattern, name = strings.ToLower(dir), strings.ToLower(pattern), strings.ToLower(name)
+	}
+
+	if len(dir) > 0 {
+		if !strings.HasPrefix(name, dir+"/") {
+			return false
+		}
+		name = name[len(dir)+1:]
+	}
+
+	if !strings.Contains(pattern, "/") {
+		return matchPattern(pattern, path.Base(name))
+	}
+	return matchPattern(strings.TrimPrefix(pattern, "/"), name)
+}
+
+// Covers returns whether the line's pattern matches every file that other's
+// does, as far as can be told from the patterns alone, by matching other's
+// pattern as though it were a path. If ignoreCase is true, they are compared as
+// on a case-insensitive file system.
+func (l *AttributesLine) Covers(other *AttributesLine, ignoreCase bool) bool {
+	if !strings.Contains(other.Pattern, "/") {
+		// other matches names at any depth, which only a pattern without
+		// a slash can too.
+		if strings.Contains(l.Pattern, "/") {
+			return false
+		}
+		return l.Matches(path.Join(other.Dir, other.Pattern), ignoreCase)
+	}
+	return l.Matches(path.Join(other.Dir, strings.TrimPrefix(other.Pattern, "/")), ignoreCase)
+}
+
+// matchPattern matches a .gitignore pattern against a slash-separated path,
+// with "**" matching any number of directories.
+func matchPattern(pattern, name string) bool {
+	if pattern == "**" {
+		return true
+	}
+	if strings.HasPrefix(pattern, "**/") {
+		rest := pattern[3:]
+		for {
+			if matchPattern(rest, name) {
+				return true
+			}
+			i := strings.IndexByte(name, '/')
+			if i < 0 {
+				return false
+			}
+			name = name[i+1:]
+		}
+	}
+
+	matched, err := path.Match(pattern, name)
+	return err == nil && matched
+}
@@ -0,0 +1,153 @@
+package lfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAttributesLine(t *testing.T) {
+	pattern, attrs, ok := ParseAttributesLine("*.psd  filter=lfs diff=lfs")
+	assert.True(t, ok)
+	assert.Equal(t, "*.psd", pattern)
+	assert.Equal(t, []string{"filter=lfs", "diff=lfs"}, attrs)
+
+	for _, line := range []string{"", "   ", "# *.psd filter=lfs", LFSMacro.Definition()} {
+		_, _, ok := ParseAttributesLine(line)
+		assert.False(t, ok, "line: %q", line)
+	}
+}
+
+func TestAttributeMacroSetTracksWithLFS(t *testing.T) {
+	macros := NewAttributeMacroSet()
+	assert.False(t, macros.TracksWithLFS([]string{"lfs"}))
+
+	for _, m := range AttributeMacros {
+		assert.True(t, macros.Define(m.Definition()))
+	}
+	assert.False(t, macros.Define("*.psd lfs"))
+
+	for attrs, expected := range map[string]bool{
+		"filter=lfs diff=lfs merge=lfs -text": true,
+		"lfs":                                 true,
+		"lfs-lockable":                        true,
+		"lfs-text":                            true,
+		"lfs -filter":                         false,
+		"filter=lfs !filter":                  false,
+		"lfs filter=other":                    false,
+		"binary":                              false,
+		"text":                                false,
+	} {
+		assert.Equal(t, expected, macros.TracksWithLFS(strings.Fields(attrs)), "attributes: %q", attrs)
+	}
+}
+
+func TestAttributeMacroSetExpandsRecursiveMacros(t *testing.T) {
+	macros := NewAttributeMacroSet()
+	macros.Define("[attr]a b x")
+	macros.Define("[attr]b a y")
+
+	assert.Equal(t, []string{"a", "b", "a", "y", "x"}, macros.Expand([]string{"a"}))
+}
+
+func TestAttributeMacroSetShorten(t *testing.T) {
+	macros := NewAttributeMacroSet()
+	assert.Equal(t, []string{"filter=lfs", "diff=lfs", "merge=lfs", "-text"},
+		macros.Shorten([]string{"filter=lfs", "diff=lfs", "merge=lfs", "-text"}, AttributeMacros))
+
+	for _, m := range AttributeMacros {
+		macros.Define(m.Definition())
+	}
+
+	for attrs, expected := range map[string]string{
+		"filter=lfs diff=lfs merge=lfs -text":          "lfs",
+		"-text merge=lfs diff=lfs filter=lfs":          "lfs",
+		"filter=lfs diff=lfs merge=lfs -text lockable": "lfs-lockable",
+		"lfs lockable":                               "lfs-lockable",
+		"filter=lfs diff=lfs merge=lfs":              "lfs-text",
+		"filter=lfs diff=lfs -text":                  "filter=lfs diff=lfs -text",
+		"filter=lfs diff=lfs merge=lfs -text eol=lf": "filter=lfs diff=lfs merge=lfs -text eol=lf",
+	} {
+		assert.Equal(t, expected, strings.Join(macros.Shorten(strings.Fields(attrs), AttributeMacros), " "), "attributes: %q", attrs)
+	}
+}
+
+func TestAttributesLineMatches(t *testing.T) {
+	for _, c := range []struct {
+		Dir, Pattern, Name string
+		IgnoreCase         bool
+		Expected           bool
+	}{
+		{"", "*.psd", "a.psd", false, true},
+		{"", "*.psd", "dir/sub/a.psd", false, true},
+		{"", "*.psd", "a.PSD", false, false},
+		{"", "*.psd", "a.PSD", true, true},
+		{"", "/a.psd", "dir/a.psd", false, false},
+		{"", "dir/*.psd", "dir/a.psd", false, true},
+		{"", "dir/*.psd", "dir/sub/a.psd", false, false},
+		{"", "dir/**/*.psd", "dir/sub/a.psd", false, true},
+		{"", "**/*.psd", "a.psd", false, true},
+		{"dir", "*.psd", "dir/sub/a.psd", false, true},
+		{"dir", "*.psd", "other/a.psd", false, false},
+		{"dir", "sub/*.psd", "dir/sub/a.psd", false, true},
+	} {
+		l := &AttributesLine{Dir: c.Dir, Pattern: c.Pattern}
+		assert.Equal(t, c.Expected, l.Matches(c.Name, c.IgnoreCase), "%q in %q matching %q", c.Pattern, c.Dir, c.Name)
+	}
+}
+
+func TestAttributesLineCovers(t *testing.T) {
+	for _, c := range []struct {
+		Dir, Pattern, OtherDir, OtherPattern string
+		Expected                             bool
+	}{
+		{"", "*.psd", "", "a.psd", true},
+		{"", "*.psd", "", "dir/*.psd", true},
+		{"", "*.psd", "dir", "*.psd", true},
+		{"", "dir/*.psd", "", "*.psd", false},
+		{"", "dir/*.psd", "dir", "a.psd", false},
+		{"", "dir/*.psd", "", "dir/a.psd", true},
+		{"", "*.psd", "", "*.png", false},
+	} {
+		l := &AttributesLine{Dir: c.Dir, Pattern: c.Pattern}
+		other := &AttributesLine{Dir: c.OtherDir, Pattern: c.OtherPattern}
+		assert.Equal(t, c.Expected, l.Covers(other, false), "%q covering %q in %q", c.Pattern, c.OtherPattern, c.OtherDir)
+	}
+}
+
+func TestRemoveLFSAttributeLines(t *testing.T) {
+	macros := NewAttributeMacroSet()
+	macros.Define(LFSMacro.Definition())
+	macros.Define(LFSLockableMacro.Definition())
+	macros.Define("[attr]docs text diff")
+
+	data := strings.Join([]string{
+		LFSMacro.Definition(),
+		LFSLockableMacro.Definition(),
+		"[attr]docs text diff",
+		"# *.psd are tracked",
+		"*.psd lfs\r",
+		"*.zip filter=lfs diff=lfs merge=lfs -text",
+		"*.png lfs-lockable",
+		"*.md docs",
+		"*.txt text",
+		"*.bin lfs -filter",
+		"",
+	}, "\n")
+
+	kept, n := removeLFSAttributeLines(data, macros)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, strings.Join([]string{
+		"[attr]docs text diff",
+		"# *.psd are tracked",
+		"*.md docs",
+		"*.txt text",
+		"*.bin lfs -filter",
+		"",
+	}, "\n"), kept)
+
+	kept, n = removeLFSAttributeLines("*.txt text", macros)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, "*.txt text", kept)
+}
@@ -1,17 +1,28 @@
 package lfs
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
+	"runtime"
 	"sync"
 	"time"
 
+	"github.com/git-lfs/git-lfs/config"
 	"github.com/git-lfs/git-lfs/filepathfilter"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/git/odb"
+	"github.com/git-lfs/git-lfs/tools"
 	"github.com/rubyist/tracerx"
 )
 
 var missingCallbackErr = errors.New("No callback given")
 
+// leftToRemoteCatFileProcs is the number of 'git cat-file --batch' processes
+// ScanLeftToRemote reads possible pointers with in parallel.
+var leftToRemoteCatFileProcs = tools.MinInt(runtime.NumCPU(), 4)
+
 // IsCallbackMissing returns a boolean indicating whether the error is reporting
 // that a GitScanner is missing a required GitScannerCallback.
 func IsCallbackMissing(err error) bool {
@@ -25,6 +36,28 @@ type GitScanner struct {
 	remote      string
 	skippedRefs []string
 
+	// checker is shared by the scans of ScanLeftToRemote, started by the
+	// first of them.
+	checker *catFileBatchChecker
+	// db is the object database read by scans of refs when
+	// lfs.scannerbackend is "native", opened by the first of them.
+	db *odb.ObjectDatabase
+
+	// partialClone is whether the repository is a partial clone, found by
+	// the first scan of refs, and missing holds the objects scans found
+	// missing from it.
+	partialClone *bool
+	missing      tools.StringSet
+	// shallow holds the shallow commits of a shallow repository, read by
+	// the first scan of refs, and truncated those of them scans reached,
+	// whose history is missing.
+	shallow   tools.StringSet
+	truncated tools.StringSet
+
+	// ctx stops the scans once it's done, killing the git processes they
+	// run.
+	ctx context.Context
+
 	closed  bool
 	started time.Time
 	mu      sync.Mutex
@@ -35,7 +68,14 @@ type GitScannerCallback func(*WrappedPointer, error)
 // NewGitScanner initializes a *GitScanner for a Git repository in the current
 // working directory.
 func NewGitScanner(cb GitScannerCallback) *GitScanner {
-	return &GitScanner{started: time.Now(), callback: cb}
+	return NewGitScannerContext(context.Background(), cb)
+}
+
+// NewGitScannerContext initializes a *GitScanner like NewGitScanner, whose
+// scans stop once the given context is done. The scan which was stopped gives
+// its callback the context's error.
+func NewGitScannerContext(ctx context.Context, cb GitScannerCallback) *GitScanner {
+	return &GitScanner{started: time.Now(), callback: cb, missing: tools.NewStringSet(), truncated: tools.NewStringSet(), ctx: ctx}
 }
 
 // Close stops exits once all processing has stopped, and all resources are
@@ -49,7 +89,25 @@ func (s *GitScanner) Close() {
 	}
 
 	s.closed = true
-	tracerx.PerformanceSince("scan", s.started)
+	if s.checker != nil {
+		if err := s.checker.Close(); err != nil {
+			tracerx.Printf("scan: %s", err)
+		}
+		s.checker = nil
+	}
+	if s.db != nil {
+		if err := s.db.Close(); err != nil {
+			tracerx.Printf("scan: %s", err)
+		}
+		s.db = nil
+	}
+	if n := s.missing.Cardinality(); n > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d object(s) missing from this partial clone were not scanned for Git LFS pointers\n", n)
+	}
+	if n := s.truncated.Cardinality(); n > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: the history before %d shallow commit(s) is missing from this shallow clone, so it was not scanned for Git LFS pointers\n", n)
+	}
+	tools.TracePerformanceSince(s.started, "scan")
 }
 
 // RemoteForPush sets up this *GitScanner to scan for objects to push to the
@@ -80,9 +138,21 @@ func (s *GitScanner) ScanLeftToRemote(left string, cb GitScannerCallback) error
 		s.mu.Unlock()
 		return fmt.Errorf("Unable to scan starting at %q: no remote set.", left)
 	}
+	if s.checker == nil && s.objectDatabase() == nil {
+		checker, err := newCatFileBatchChecker()
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		s.checker = checker
+	}
+	checker := s.checker
 	s.mu.Unlock()
 
-	return scanRefsToChan(callback, left, "", s.opts(ScanLeftToRemoteMode))
+	opts := s.opts(ScanLeftToRemoteMode)
+	opts.checker = checker
+	opts.catFileProcs = leftToRemoteCatFileProcs
+	return scanRefsToChan(callback, left, "", opts)
 }
 
 // ScanRefRange scans through all commits from the given left and right refs,
@@ -137,7 +207,7 @@ func (s *GitScanner) ScanTree(ref string) error {
 	if err != nil {
 		return err
 	}
-	return runScanTree(callback, ref, s.Filter)
+	return runScanTree(s.ctx, callback, ref, s.Filter)
 }
 
 // ScanUnpushed scans history for all LFS pointers which have been added but not
@@ -147,7 +217,7 @@ func (s *GitScanner) ScanUnpushed(remote string, cb GitScannerCallback) error {
 	if err != nil {
 		return err
 	}
-	return scanUnpushed(callback, remote)
+	return scanUnpushed(s.ctx, callback, remote)
 }
 
 // ScanPreviousVersions scans changes reachable from ref (commit) back to since.
@@ -159,7 +229,7 @@ func (s *GitScanner) ScanPreviousVersions(ref string, since time.Time, cb GitSca
 	if err != nil {
 		return err
 	}
-	return logPreviousSHAs(callback, ref, since)
+	return logPreviousSHAs(s.ctx, callback, ref, since)
 }
 
 // ScanIndex scans the git index for modified LFS objects.
@@ -168,7 +238,17 @@ func (s *GitScanner) ScanIndex(ref string, cb GitScannerCallback) error {
 	if err != nil {
 		return err
 	}
-	return scanIndex(callback, ref)
+	return scanIndex(s.ctx, callback, ref)
+}
+
+// ScanIndexFile scans all LFS pointers staged in the given index file, which
+// need not belong to the current worktree.
+func (s *GitScanner) ScanIndexFile(indexFile string, cb GitScannerCallback) error {
+	callback, err := firstGitScannerCallback(cb, s.callback)
+	if err != nil {
+		return err
+	}
+	return scanIndexFile(s.ctx, callback, indexFile)
 }
 
 func (s *GitScanner) opts(mode ScanningMode) *ScanRefsOptions {
@@ -176,12 +256,90 @@ func (s *GitScanner) opts(mode ScanningMode) *ScanRefsOptions {
 	defer s.mu.Unlock()
 
 	opts := newScanRefsOptions()
+	opts.ctx = s.ctx
 	opts.ScanMode = mode
 	opts.RemoteName = s.remote
 	opts.skippedRefs = s.skippedRefs
+	opts.db = s.objectDatabase()
+	if s.isPartialClone() {
+		opts.missingObject = s.addMissingObject
+	}
+	if shallow := s.shallowCommits(); shallow.Cardinality() > 0 {
+		opts.shallowCommits = shallow
+		opts.reachedShallowCommit = s.addTruncatedCommit
+	}
 	return opts
 }
 
+// isPartialClone returns whether the repository is a partial clone, whose
+// missing objects scans should skip rather than have git fetch each of them
+// from its promisor remote. It must be called with s.mu held.
+func (s *GitScanner) isPartialClone() bool {
+	if s.partialClone == nil {
+		partial := git.IsPartialClone()
+		if partial {
+			tracerx.Printf("scan: partial clone, skipping missing objects")
+		}
+		s.partialClone = &partial
+	}
+	return *s.partialClone
+}
+
+// shallowCommits returns the shallow commits of the repository, at which the
+// history scans read stops, or none if it isn't a shallow repository. It must
+// be called with s.mu held.
+func (s *GitScanner) shallowCommits() tools.StringSet {
+	if s.shallow == nil {
+		commits, err := git.ShallowCommits()
+		if err != nil {
+			tracerx.Printf("scan: unable to read the shallow commits: %s", err)
+		} else if len(commits) > 0 {
+			tracerx.Printf("scan: shallow repository, history stops at its %d shallow commit(s)", len(commits))
+		}
+		s.shallow = tools.NewStringSetFromSlice(commits)
+	}
+	return s.shallow
+}
+
+// addTruncatedCommit records that a scan reached the given shallow commit,
+// whose history is missing, to warn about once the scanner is closed.
+func (s *GitScanner) addTruncatedCommit(sha string) {
+	s.mu.Lock()
+	s.truncated.Add(sha)
+	s.mu.Unlock()
+}
+
+// addMissingObject records that a scan found the object with the given name
+// missing from a partial clone, to warn about once the scanner is closed.
+func (s *GitScanner) addMissingObject(sha string) {
+	s.mu.Lock()
+	s.missing.Add(sha)
+	s.mu.Unlock()
+}
+
+// objectDatabase returns the object database scans should read objects from,
+// or nil if they should run 'git cat-file' instead. The database is opened the
+// first time it is needed, and if it can't be, scans fall back to git. It must
+// be called with s.mu held.
+func (s *GitScanner) objectDatabase() *odb.ObjectDatabase {
+	if s.db != nil || s.closed {
+		return s.db
+	}
+	if config.Config.ScannerBackend() != config.ScannerBackendNative {
+		return nil
+	}
+
+	db, err := openObjectDatabase()
+	if err != nil {
+		tracerx.Printf("scan: unable to read objects in-process, using git: %s", err)
+		return nil
+	}
+
+	tracerx.Printf("scan: reading objects in-process")
+	s.db = db
+	return db
+}
+
 func firstGitScannerCallback(callbacks ...GitScannerCallback) (GitScannerCallback, error) {
 	for _, cb := range callbacks {
 		if cb == nil {
@@ -207,7 +365,27 @@ type ScanRefsOptions struct {
 	SkipDeletedBlobs bool
 	skippedRefs      []string
 	nameMap          map[string]string
-	mutex            *sync.Mutex
+
+	// checker, if set, is used instead of starting a 'git cat-file
+	// --batch-check' process for the scan.
+	checker *catFileBatchChecker
+	// catFileProcs is the number of 'git cat-file --batch' processes to
+	// read possible pointers with, 1 if unset.
+	catFileProcs int
+	// db, if set, is read from in-process instead of running any 'git
+	// cat-file' processes for the scan.
+	db *odb.ObjectDatabase
+	// missingObject, if set, is called with the name of each object missing
+	// from a partial clone, which the scan skips.
+	missingObject func(sha string)
+	// reachedShallowCommit, if set, is called with the name of each of
+	// shallowCommits the scan reaches, whose history it can't scan.
+	shallowCommits       tools.StringSet
+	reachedShallowCommit func(sha string)
+	// ctx stops the scan once it's done.
+	ctx context.Context
+
+	mutex *sync.Mutex
 }
 
 func (o *ScanRefsOptions) GetName(sha string) (string, bool) {
@@ -227,5 +405,6 @@ func newScanRefsOptions() *ScanRefsOptions {
 	return &ScanRefsOptions{
 		nameMap: make(map[string]string, 0),
 		mutex:   &sync.Mutex{},
+		ctx:     context.Background(),
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"strconv"
+	"sync"
 
 	"github.com/git-lfs/git-lfs/errors"
 )
@@ -60,6 +61,70 @@ func runCatFileBatch(pointerCh chan *WrappedPointer, revs *StringChannelWrapper,
 	return nil
 }
 
+// runCatFileBatches behaves like runCatFileBatch, but reads the revs with n
+// 'git cat-file --batch' processes in parallel, so pointers are sent to
+// pointerCh in no particular order. errCh must have room for an error from
+// each process, and one more.
+func runCatFileBatches(n int, pointerCh chan *WrappedPointer, revs *StringChannelWrapper, errCh chan error) error {
+	cmds := make([]*wrappedCmd, 0, n)
+	for i := 0; i < n; i++ {
+		cmd, err := startCommand("git", "cat-file", "--batch")
+		if err != nil {
+			for _, cmd := range cmds {
+				cmd.Stdin.Close()
+				cmd.Wait()
+			}
+			return err
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(cmds))
+	for _, cmd := range cmds {
+		go func(cmd *wrappedCmd) {
+			defer wg.Done()
+
+			scanner := &catFileBatchScanner{r: cmd.Stdout}
+			for r := range revs.Results {
+				cmd.Stdin.Write([]byte(r + "\n"))
+				canScan := scanner.Scan()
+				if p := scanner.Pointer(); p != nil {
+					pointerCh <- p
+				}
+
+				if err := scanner.Err(); err != nil {
+					errCh <- err
+				}
+
+				if !canScan {
+					break
+				}
+			}
+
+			cmd.Stdin.Close()
+
+			stderr, _ := ioutil.ReadAll(cmd.Stderr)
+			if err := cmd.Wait(); err != nil {
+				errCh <- fmt.Errorf("Error in git cat-file --batch: %v %v", err, string(stderr))
+			}
+		}(cmd)
+	}
+
+	go func() {
+		wg.Wait()
+
+		if err := revs.Wait(); err != nil {
+			errCh <- err
+		}
+
+		close(pointerCh)
+		close(errCh)
+	}()
+
+	return nil
+}
+
 type catFileBatchScanner struct {
 	r       *bufio.Reader
 	pointer *WrappedPointer
@@ -120,6 +185,7 @@ func (s *catFileBatchScanner) next() (*WrappedPointer, error) {
 			Sha1:    string(fields[0]),
 			Pointer: p,
 		}
+		warnNormalizedPointer(pointer.Sha1, p)
 	}
 
 	_, err = s.r.ReadBytes('\n') // Extra \n inserted by cat-file
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 // runCatFileBatchCheck uses 'git cat-file --batch-check' to get the type and
@@ -53,6 +55,85 @@ func runCatFileBatchCheck(smallRevCh chan string, revs *StringChannelWrapper, er
 	return nil
 }
 
+// catFileBatchChecker is a long-running 'git cat-file --batch-check' process,
+// which can be shared by many scans instead of starting one for each, such as
+// the scans of each ref being pushed.
+type catFileBatchChecker struct {
+	cmd     *wrappedCmd
+	scanner *catFileBatchCheckScanner
+	mu      sync.Mutex
+}
+
+func newCatFileBatchChecker() (*catFileBatchChecker, error) {
+	cmd, err := startCommand("git", "cat-file", "--batch-check")
+	if err != nil {
+		return nil, err
+	}
+
+	return &catFileBatchChecker{
+		cmd:     cmd,
+		scanner: &catFileBatchCheckScanner{s: bufio.NewScanner(cmd.Stdout), limit: blobSizeCutoff},
+	}, nil
+}
+
+// Check returns the given sha1 if it is of a blob under the blobSizeCutoff,
+// which may be a pointer, and an empty string otherwise.
+func (c *catFileBatchChecker) Check(sha1 string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.cmd.Stdin.Write([]byte(sha1 + "\n")); err != nil {
+		return "", err
+	}
+
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("git cat-file --batch-check exited early")
+	}
+	return c.scanner.BlobOID(), c.scanner.Err()
+}
+
+// Close stops the 'git cat-file --batch-check' process.
+func (c *catFileBatchChecker) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cmd.Stdin.Close()
+	stderr, _ := ioutil.ReadAll(c.cmd.Stderr)
+	if err := c.cmd.Wait(); err != nil {
+		return fmt.Errorf("Error in git cat-file --batch-check: %v %v", err, string(stderr))
+	}
+	return nil
+}
+
+// runCatFileBatchCheckWith behaves like runCatFileBatchCheck, but checks the
+// revs with the given long-running checker, which is left running.
+func runCatFileBatchCheckWith(checker *catFileBatchChecker, smallRevCh chan string, revs *StringChannelWrapper, errCh chan error) {
+	go func() {
+		for r := range revs.Results {
+			b, err := checker.Check(r)
+			if err != nil {
+				errCh <- err
+				// drain revs so that rev-list can finish
+				for range revs.Results {
+				}
+				break
+			}
+			if len(b) > 0 {
+				smallRevCh <- b
+			}
+		}
+
+		if err := revs.Wait(); err != nil {
+			errCh <- err
+		}
+		close(smallRevCh)
+		close(errCh)
+	}()
+}
+
 type catFileBatchCheckScanner struct {
 	s       *bufio.Scanner
 	limit   int
@@ -81,17 +162,19 @@ func (s *catFileBatchCheckScanner) next() (string, bool) {
 
 	// Format is:
 	// <sha1> <type> <size>
-	// type is at a fixed spot, if we see that it's "blob", we can avoid
-	// splitting the line just to get the size.
-	if lineLen < 46 {
+	// type is at a fixed spot after the sha1, which is 40 characters long,
+	// or 64 in SHA-256 repositories. If we see that it's "blob", we can
+	// avoid splitting the line just to get the size.
+	shaLen := strings.IndexByte(line, ' ')
+	if (shaLen != 40 && shaLen != 64) || lineLen < shaLen+6 {
 		return "", hasNext
 	}
 
-	if line[41:45] != "blob" {
+	if line[shaLen+1:shaLen+5] != "blob" {
 		return "", hasNext
 	}
 
-	size, err := strconv.Atoi(line[46:lineLen])
+	size, err := strconv.Atoi(line[shaLen+6 : lineLen])
 	if err != nil {
 		return "", hasNext
 	}
@@ -100,5 +183,5 @@ func (s *catFileBatchCheckScanner) next() (string, bool) {
 		return "", hasNext
 	}
 
-	return line[0:40], hasNext
+	return line[0:shaLen], hasNext
 }
@@ -33,6 +33,27 @@ func TestCatFileBatchCheckScannerWithValidOutput(t *testing.T) {
 	assert.Equal(t, "", s.BlobOID())
 }
 
+func TestCatFileBatchCheckScannerWithSHA256Output(t *testing.T) {
+	sha256 := strings.Repeat("0", 63)
+	lines := []string{
+		sha256 + "1 blob 123",
+		sha256 + "2 tree 123",
+		sha256 + "3 blob 123456789",
+		"0000000000000000000000000000000000000000000000000004 blob 123",
+	}
+	r := strings.NewReader(strings.Join(lines, "\n"))
+	s := &catFileBatchCheckScanner{
+		s:     bufio.NewScanner(r),
+		limit: 1024,
+	}
+
+	assertNextOID(t, s, sha256+"1")
+	assertNextOID(t, s, "")
+	assertNextOID(t, s, "")
+	assertNextOID(t, s, "")
+	assertScannerDone(t, s)
+}
+
 type stringScanner interface {
 	Next() (string, bool, error)
 	Err() error
@@ -2,7 +2,9 @@ package lfs
 
 import (
 	"bufio"
+	"context"
 	"io"
+	"os"
 	"os/exec"
 	"strings"
 
@@ -20,7 +22,17 @@ type wrappedCmd struct {
 // stdout & stderr pipes, wrapped in a wrappedCmd. The stdout buffer will be of stdoutBufSize
 // bytes.
 func startCommand(command string, args ...string) (*wrappedCmd, error) {
-	cmd := exec.Command(command, args...)
+	return startCommandContext(context.Background(), nil, command, args...)
+}
+
+// startCommandContext behaves like startCommand, but appends the given
+// "KEY=value" pairs to the environment inherited by the command, and kills it
+// once ctx is done, if it hasn't exited already.
+func startCommandContext(ctx context.Context, env []string, command string, args ...string) (*wrappedCmd, error) {
+	cmd := exec.CommandContext(ctx, command, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, err
@@ -2,6 +2,9 @@ package lfs
 
 import (
 	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
 	"strings"
 	"sync"
 )
@@ -11,19 +14,19 @@ import (
 //
 // Ref is the ref at which to scan, which may be "HEAD" if there is at least one
 // commit.
-func scanIndex(cb GitScannerCallback, ref string) error {
+func scanIndex(ctx context.Context, cb GitScannerCallback, ref string) error {
 	indexMap := &indexFileMap{
 		nameMap:      make(map[string][]*indexFile),
 		nameShaPairs: make(map[string]bool),
 		mutex:        &sync.Mutex{},
 	}
 
-	revs, err := revListIndex(ref, false, indexMap)
+	revs, err := revListIndex(ctx, ref, false, indexMap)
 	if err != nil {
 		return err
 	}
 
-	cachedRevs, err := revListIndex(ref, true, indexMap)
+	cachedRevs, err := revListIndex(ctx, ref, true, indexMap)
 	if err != nil {
 		return err
 	}
@@ -102,17 +105,103 @@ func scanIndex(cb GitScannerCallback, ref string) error {
 	return nil
 }
 
+// scanIndexFile reports all Git LFS pointers staged in the given index file,
+// whether or not they differ from any commit.
+func scanIndexFile(ctx context.Context, cb GitScannerCallback, indexFile string) error {
+	opt := newScanRefsOptions()
+	opt.ctx = ctx
+
+	revs, err := lsFilesStage(indexFile, opt)
+	if err != nil {
+		return err
+	}
+
+	smallShas, err := catFileBatchCheck(revs)
+	if err != nil {
+		return err
+	}
+
+	pointers, err := catFileBatch(smallShas)
+	if err != nil {
+		return err
+	}
+
+	for p := range pointers.Results {
+		if name, ok := opt.GetName(p.Sha1); ok {
+			p.Name = name
+		}
+		cb(p, nil)
+	}
+
+	if err := pointers.Wait(); err != nil {
+		cb(nil, err)
+	}
+
+	return nil
+}
+
+// lsFilesStage uses git ls-files to return the list of blob sha1s staged in
+// the given index file. It returns a channel from which sha1 strings can be
+// read.
+func lsFilesStage(indexFile string, opt *ScanRefsOptions) (*StringChannelWrapper, error) {
+	cmd, err := startCommandContext(opt.ctx, []string{"GIT_INDEX_FILE=" + indexFile},
+		"git", "ls-files", "--stage", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Stdin.Close()
+
+	revs := make(chan string, chanBufSize)
+	errchan := make(chan error, 1)
+
+	go func() {
+		seen := make(map[string]bool)
+		for {
+			// Format is:
+			// <mode> SP <sha1> SP <stage> TAB <file name> NUL
+			entry, err := cmd.Stdout.ReadString(0)
+			if len(entry) > 1 {
+				parts := strings.SplitN(strings.TrimRight(entry, "\x00"), "\t", 2)
+				description := strings.Split(parts[0], " ")
+				if len(parts) == 2 && len(description) == 3 {
+					sha1 := description[1]
+					opt.SetName(sha1, parts[1])
+					if !seen[sha1] {
+						seen[sha1] = true
+						revs <- sha1
+					}
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+
+		stderr, _ := ioutil.ReadAll(cmd.Stderr)
+		if err := cmd.Wait(); opt.ctx.Err() != nil {
+			errchan <- opt.ctx.Err()
+		} else if err != nil {
+			errchan <- fmt.Errorf("Error in git ls-files: %v %v", err, string(stderr))
+		}
+		close(revs)
+		close(errchan)
+	}()
+
+	return NewStringChannelWrapper(revs, errchan), nil
+}
+
 // revListIndex uses git diff-index to return the list of object sha1s
 // for in the indexf. It returns a channel from which sha1 strings can be read.
 // The namMap will be filled indexFile pointers mapping sha1s to indexFiles.
-func revListIndex(atRef string, cache bool, indexMap *indexFileMap) (*StringChannelWrapper, error) {
+func revListIndex(ctx context.Context, atRef string, cache bool, indexMap *indexFileMap) (*StringChannelWrapper, error) {
 	cmdArgs := []string{"diff-index", "-M"}
 	if cache {
 		cmdArgs = append(cmdArgs, "--cached")
 	}
 	cmdArgs = append(cmdArgs, atRef)
 
-	cmd, err := startCommand("git", cmdArgs...)
+	cmd, err := startCommandContext(ctx, nil, "git", cmdArgs...)
 	if err != nil {
 		return nil, err
 	}
@@ -162,6 +251,9 @@ func revListIndex(atRef string, cache bool, indexMap *indexFileMap) (*StringChan
 		// 	errchan <- fmt.Errorf("Error in git diff-index: %v %v", err, string(stderr))
 		// }
 		cmd.Wait()
+		if err := ctx.Err(); err != nil {
+			errchan <- err
+		}
 		close(revs)
 		close(errchan)
 	}()
@@ -3,6 +3,7 @@ package lfs
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -39,7 +40,7 @@ type gitscannerResult struct {
 	Err     error
 }
 
-func scanUnpushed(cb GitScannerCallback, remote string) error {
+func scanUnpushed(ctx context.Context, cb GitScannerCallback, remote string) error {
 	logArgs := []string{"log",
 		"--branches", "--tags", // include all locally referenced commits
 		"--not"} // but exclude everything that comes after
@@ -53,16 +54,16 @@ func scanUnpushed(cb GitScannerCallback, remote string) error {
 	// Add standard search args to find lfs references
 	logArgs = append(logArgs, logLfsSearchArgs...)
 
-	cmd, err := startCommand("git", logArgs...)
+	cmd, err := startCommandContext(ctx, nil, "git", logArgs...)
 	if err != nil {
 		return err
 	}
 
-	parseScannerLogOutput(cb, LogDiffAdditions, cmd)
+	parseScannerLogOutput(ctx, cb, LogDiffAdditions, cmd)
 	return nil
 }
 
-func parseScannerLogOutput(cb GitScannerCallback, direction LogDiffDirection, cmd *wrappedCmd) {
+func parseScannerLogOutput(ctx context.Context, cb GitScannerCallback, direction LogDiffDirection, cmd *wrappedCmd) {
 	ch := make(chan gitscannerResult, chanBufSize)
 
 	go func() {
@@ -74,7 +75,9 @@ func parseScannerLogOutput(cb GitScannerCallback, direction LogDiffDirection, cm
 		}
 		stderr, _ := ioutil.ReadAll(cmd.Stderr)
 		err := cmd.Wait()
-		if err != nil {
+		if cerr := ctx.Err(); cerr != nil {
+			ch <- gitscannerResult{Err: cerr}
+		} else if err != nil {
 			ch <- gitscannerResult{Err: fmt.Errorf("Error in git log: %v %v", err, string(stderr))}
 		}
 		close(ch)
@@ -88,7 +91,7 @@ func parseScannerLogOutput(cb GitScannerCallback, direction LogDiffDirection, cm
 
 // logPreviousVersions scans history for all previous versions of LFS pointers
 // from 'since' up to (but not including) the final state at ref
-func logPreviousSHAs(cb GitScannerCallback, ref string, since time.Time) error {
+func logPreviousSHAs(ctx context.Context, cb GitScannerCallback, ref string, since time.Time) error {
 	logArgs := []string{"log",
 		fmt.Sprintf("--since=%v", git.FormatGitDate(since)),
 	}
@@ -97,12 +100,12 @@ func logPreviousSHAs(cb GitScannerCallback, ref string, since time.Time) error {
 	// ending at ref
 	logArgs = append(logArgs, ref)
 
-	cmd, err := startCommand("git", logArgs...)
+	cmd, err := startCommandContext(ctx, nil, "git", logArgs...)
 	if err != nil {
 		return err
 	}
 
-	parseScannerLogOutput(cb, LogDiffDeletions, cmd)
+	parseScannerLogOutput(ctx, cb, LogDiffDeletions, cmd)
 	return nil
 }
 
@@ -151,7 +154,7 @@ func newLogScanner(dir LogDiffDirection, r io.Reader) *logScanner {
 
 		// no need to compile these regexes on every `git-lfs` call, just ones that
 		// use the scanner.
-		commitHeaderRegex:    regexp.MustCompile(`^lfs-commit-sha: ([A-Fa-f0-9]{40})(?: ([A-Fa-f0-9]{40}))*`),
+		commitHeaderRegex:    regexp.MustCompile(`^lfs-commit-sha: (` + git.ObjectIDPattern + `)(?: (` + git.ObjectIDPattern + `))*`),
 		fileHeaderRegex:      regexp.MustCompile(`diff --git a\/(.+?)\s+b\/(.+)`),
 		fileMergeHeaderRegex: regexp.MustCompile(`diff --cc (.+)`),
 		pointerDataRegex:     regexp.MustCompile(`^([\+\- ])(version https://git-lfs|oid sha256|size|ext-).*$`),
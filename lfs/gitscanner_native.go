@@ -0,0 +1,85 @@
+package lfs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/git"
+	"github.com/git-lfs/git-lfs/git/odb"
+)
+
+// openObjectDatabase opens the object database of the current repository, for
+// scans with lfs.scannerbackend=native.
+func openObjectDatabase() (*odb.ObjectDatabase, error) {
+	dir := os.Getenv("GIT_OBJECT_DIRECTORY")
+	if len(dir) == 0 {
+		dir = filepath.Join(config.LocalGitStorageDir, "objects")
+	}
+	return odb.FromFilesystemWithFormat(dir, git.ObjectFormat())
+}
+
+// runNativeBatchCheck behaves like runCatFileBatchCheck, but reads the type and
+// size of each object from db instead of 'git cat-file --batch-check'. Objects
+// which aren't in db are skipped, as that does. Only the first error is sent to
+// errCh, but revs is always drained.
+func runNativeBatchCheck(db *odb.ObjectDatabase, smallRevCh chan string, revs *StringChannelWrapper, errCh chan error) {
+	go func() {
+		var statErr error
+		for r := range revs.Results {
+			typ, size, err := db.Stat(r)
+			if err != nil {
+				if statErr == nil && !odb.IsNotFound(err) {
+					statErr = err
+				}
+				continue
+			}
+
+			if typ == odb.TypeBlob && size < blobSizeCutoff {
+				smallRevCh <- r
+			}
+		}
+
+		if statErr != nil {
+			errCh <- statErr
+		}
+		if err := revs.Wait(); err != nil {
+			errCh <- err
+		}
+		close(smallRevCh)
+		close(errCh)
+	}()
+}
+
+// runNativeBatch behaves like runCatFileBatch, but reads the contents of each
+// object from db instead of 'git cat-file --batch'. As runNativeBatchCheck,
+// only the first error is sent to errCh.
+func runNativeBatch(db *odb.ObjectDatabase, pointerCh chan *WrappedPointer, revs *StringChannelWrapper, errCh chan error) {
+	go func() {
+		var readErr error
+		for r := range revs.Results {
+			_, data, err := db.Read(r)
+			if err != nil {
+				if readErr == nil {
+					readErr = err
+				}
+				continue
+			}
+
+			if p, err := DecodePointer(bytes.NewReader(data)); err == nil {
+				warnNormalizedPointer(r, p)
+				pointerCh <- &WrappedPointer{Sha1: r, Pointer: p}
+			}
+		}
+
+		if readErr != nil {
+			errCh <- readErr
+		}
+		if err := revs.Wait(); err != nil {
+			errCh <- err
+		}
+		close(pointerCh)
+		close(errCh)
+	}()
+}
@@ -8,9 +8,9 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-)
 
-var z40 = regexp.MustCompile(`\^?0{40}`)
+	"github.com/git-lfs/git-lfs/git"
+)
 
 // scanRefsToChan takes a ref and returns a channel of WrappedPointer objects
 // for all Git LFS pointers it finds for that ref.
@@ -25,12 +25,28 @@ func scanRefsToChan(cb GitScannerCallback, refLeft, refRight string, opt *ScanRe
 		return err
 	}
 
-	smallShas, err := catFileBatchCheck(revs)
-	if err != nil {
-		return err
+	var smallShas *StringChannelWrapper
+	switch {
+	case opt.db != nil:
+		smallShas = nativeBatchCheck(opt.db, revs)
+	case opt.checker != nil:
+		smallShas = catFileBatchCheckWith(opt.checker, revs)
+	default:
+		smallShas, err = catFileBatchCheck(revs)
+		if err != nil {
+			return err
+		}
 	}
 
-	pointers, err := catFileBatch(smallShas)
+	var pointers *PointerChannelWrapper
+	switch {
+	case opt.db != nil:
+		pointers = nativeBatch(opt.db, smallShas)
+	case opt.catFileProcs > 1:
+		pointers, err = catFileBatches(opt.catFileProcs, smallShas)
+	default:
+		pointers, err = catFileBatch(smallShas)
+	}
 	if err != nil {
 		return err
 	}
@@ -54,6 +70,11 @@ func scanRefsToChan(cb GitScannerCallback, refLeft, refRight string, opt *ScanRe
 // channel from which sha1 strings can be read.
 func revListShas(refLeft, refRight string, opt *ScanRefsOptions) (*StringChannelWrapper, error) {
 	refArgs := []string{"rev-list", "--objects"}
+	if opt.missingObject != nil {
+		// List the objects missing from a partial clone, rather than
+		// have git fetch them from its promisor remote one at a time.
+		refArgs = append(refArgs, "--missing=print")
+	}
 	var stdin []string
 	switch opt.ScanMode {
 	case ScanRefsMode:
@@ -64,7 +85,7 @@ func revListShas(refLeft, refRight string, opt *ScanRefsOptions) (*StringChannel
 		}
 
 		refArgs = append(refArgs, refLeft)
-		if refRight != "" && !z40.MatchString(refRight) {
+		if refRight != "" && !git.IsZeroObjectID(strings.TrimPrefix(refRight, "^")) {
 			refArgs = append(refArgs, refRight)
 		}
 	case ScanAllMode:
@@ -84,7 +105,7 @@ func revListShas(refLeft, refRight string, opt *ScanRefsOptions) (*StringChannel
 	// file named "master".
 	refArgs = append(refArgs, "--")
 
-	cmd, err := startCommand("git", refArgs...)
+	cmd, err := startCommandContext(opt.ctx, nil, "git", refArgs...)
 	if err != nil {
 		return nil, err
 	}
@@ -102,20 +123,31 @@ func revListShas(refLeft, refRight string, opt *ScanRefsOptions) (*StringChannel
 		scanner := bufio.NewScanner(cmd.Stdout)
 		for scanner.Scan() {
 			line := strings.TrimSpace(scanner.Text())
-			if len(line) < 40 {
+			if strings.HasPrefix(line, "?") {
+				if opt.missingObject != nil && git.IsObjectID(line[1:]) {
+					opt.missingObject(line[1:])
+				}
 				continue
 			}
 
-			sha1 := line[0:40]
-			if len(line) > 40 {
-				opt.SetName(sha1, line[41:len(line)])
+			sha1, name, ok := git.SplitObjectLine(line)
+			if !ok {
+				continue
+			}
+
+			if len(name) > 0 {
+				opt.SetName(sha1, name)
+			} else if opt.reachedShallowCommit != nil && opt.shallowCommits.Contains(sha1) {
+				opt.reachedShallowCommit(sha1)
 			}
 			revs <- sha1
 		}
 
 		stderr, _ := ioutil.ReadAll(cmd.Stderr)
 		err := cmd.Wait()
-		if err != nil {
+		if cerr := opt.ctx.Err(); cerr != nil {
+			errchan <- cerr
+		} else if err != nil {
 			errchan <- fmt.Errorf("Error in git rev-list --objects: %v %v", err, string(stderr))
 		} else {
 			// Special case detection of ambiguous refs; lower level commands like
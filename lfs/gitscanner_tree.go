@@ -3,6 +3,7 @@ package lfs
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -16,12 +17,15 @@ import (
 type TreeBlob struct {
 	Sha1     string
 	Filename string
+	// Mode is the file mode of the blob in the tree, such as "100755",
+	// or "" if unknown.
+	Mode string
 }
 
-func runScanTree(cb GitScannerCallback, ref string, filter *filepathfilter.Filter) error {
+func runScanTree(ctx context.Context, cb GitScannerCallback, ref string, filter *filepathfilter.Filter) error {
 	// We don't use the nameMap approach here since that's imprecise when >1 file
 	// can be using the same content
-	treeShas, err := lsTreeBlobs(ref, filter)
+	treeShas, err := lsTreeBlobs(ctx, ref, filter)
 	if err != nil {
 		return err
 	}
@@ -62,6 +66,7 @@ func catFileBatchTree(treeblobs *TreeBlobChannelWrapper) (*PointerChannelWrapper
 			hasNext := scanner.Scan()
 			if p := scanner.Pointer(); p != nil {
 				p.Name = t.Filename
+				p.Mode = t.Mode
 				pointers <- p
 			}
 
@@ -98,8 +103,8 @@ func catFileBatchTree(treeblobs *TreeBlobChannelWrapper) (*PointerChannelWrapper
 // Use ls-tree at ref to find a list of candidate tree blobs which might be lfs files
 // The returned channel will be sent these blobs which should be sent to catFileBatchTree
 // for final check & conversion to Pointer
-func lsTreeBlobs(ref string, filter *filepathfilter.Filter) (*TreeBlobChannelWrapper, error) {
-	cmd, err := startCommand("git", "ls-tree",
+func lsTreeBlobs(ctx context.Context, ref string, filter *filepathfilter.Filter) (*TreeBlobChannelWrapper, error) {
+	cmd, err := startCommandContext(ctx, nil, "git", "ls-tree",
 		"-r",          // recurse
 		"-l",          // report object size (we'll need this)
 		"-z",          // null line termination
@@ -126,7 +131,9 @@ func lsTreeBlobs(ref string, filter *filepathfilter.Filter) (*TreeBlobChannelWra
 
 		stderr, _ := ioutil.ReadAll(cmd.Stderr)
 		err := cmd.Wait()
-		if err != nil {
+		if cerr := ctx.Err(); cerr != nil {
+			errchan <- cerr
+		} else if err != nil {
 			errchan <- fmt.Errorf("Error in git ls-tree: %v %v", err, string(stderr))
 		}
 		close(blobs)
@@ -186,7 +193,7 @@ func (s *lsTreeScanner) next() (*TreeBlob, bool) {
 	if sz < blobSizeCutoff {
 		sha1 := attrs[2]
 		filename := parts[1]
-		return &TreeBlob{Sha1: sha1, Filename: filename}, hasNext
+		return &TreeBlob{Sha1: sha1, Filename: filename, Mode: attrs[0]}, hasNext
 	}
 	return nil, hasNext
 }
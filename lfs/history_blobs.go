@@ -0,0 +1,167 @@
+package lfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/git"
+)
+
+// HistoryBlob is a blob reachable from the commits scanned by
+// ScanHistoryBlobs.
+type HistoryBlob struct {
+	Sha1 string
+	// Name is the first path the blob was found at.
+	Name string
+	Size int64
+	// Pointer is the pointer the blob holds, if it decodes as one.
+	Pointer *Pointer
+	// PointerErr is why the blob doesn't decode as a pointer, if it looks
+	// like one otherwise.
+	PointerErr error
+}
+
+// ScanHistoryBlobs calls cb with each blob reachable from the given refs, or
+// from every ref if none are given, in no particular order.
+func ScanHistoryBlobs(refs []string, cb func(*HistoryBlob)) error {
+	blobs, err := historyBlobs(refs)
+	if err != nil {
+		return err
+	}
+
+	var small []*HistoryBlob
+	for _, b := range blobs {
+		if b.Size < blobSizeCutoff {
+			small = append(small, b)
+		}
+	}
+	if err := decodeHistoryPointers(small); err != nil {
+		return err
+	}
+
+	for _, b := range blobs {
+		cb(b)
+	}
+	return nil
+}
+
+// historyBlobs lists the blobs reachable from the given refs, or from every ref
+// if none are given, with their sizes.
+func historyBlobs(refs []string) ([]*HistoryBlob, error) {
+	args := []string{"rev-list", "--objects"}
+	if len(refs) == 0 {
+		args = append(args, "--all")
+	}
+	args = append(append(args, refs...), "--")
+
+	revList, err := startCommand("git", args...)
+	if err != nil {
+		return nil, err
+	}
+	revList.Stdin.Close()
+
+	var shas []string
+	names := make(map[string]string)
+	scanner := bufio.NewScanner(revList.Stdout)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		sha, name, ok := git.SplitObjectLine(line)
+		if !ok {
+			continue
+		}
+		shas = append(shas, sha)
+		if len(name) > 0 {
+			names[sha] = name
+		}
+	}
+
+	stderr, _ := ioutil.ReadAll(revList.Stderr)
+	if err := revList.Wait(); err != nil {
+		return nil, fmt.Errorf("Error in git rev-list --objects: %v %v", err, string(stderr))
+	}
+
+	check, err := startCommand("git", "cat-file", "--batch-check")
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for _, sha := range shas {
+			check.Stdin.Write([]byte(sha + "\n"))
+		}
+		check.Stdin.Close()
+	}()
+
+	var blobs []*HistoryBlob
+	scanner = bufio.NewScanner(check.Stdout)
+	for scanner.Scan() {
+		// <sha1> <type> <size>
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		blobs = append(blobs, &HistoryBlob{Sha1: fields[0], Name: names[fields[0]], Size: size})
+	}
+
+	stderr, _ = ioutil.ReadAll(check.Stderr)
+	if err := check.Wait(); err != nil {
+		return nil, fmt.Errorf("Error in git cat-file --batch-check: %v %v", err, string(stderr))
+	}
+	return blobs, scanner.Err()
+}
+
+// decodeHistoryPointers decodes the pointers in the given blobs, which must be
+// small enough to be pointers, recording which look like pointers but don't
+// decode as one.
+func decodeHistoryPointers(blobs []*HistoryBlob) error {
+	if len(blobs) == 0 {
+		return nil
+	}
+
+	cmd, err := startCommand("git", "cat-file", "--batch")
+	if err != nil {
+		return err
+	}
+	go func() {
+		for _, b := range blobs {
+			cmd.Stdin.Write([]byte(b.Sha1 + "\n"))
+		}
+		cmd.Stdin.Close()
+	}()
+
+	r := bufio.NewReader(cmd.Stdout)
+	for _, b := range blobs {
+		// <sha1> blob <size>, then the contents and a newline
+		if _, err := r.ReadString('\n'); err != nil {
+			return err
+		}
+
+		data := make([]byte, b.Size+1)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+
+		p, err := DecodePointer(bytes.NewReader(data[:b.Size]))
+		if err == nil {
+			b.Pointer = p
+		} else if !errors.IsNotAPointerError(err) {
+			b.PointerErr = err
+		}
+	}
+
+	stderr, _ := ioutil.ReadAll(cmd.Stderr)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("Error in git cat-file --batch: %v %v", err, string(stderr))
+	}
+	return nil
+}
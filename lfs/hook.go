@@ -20,6 +20,10 @@ type Hook struct {
 	Type         string
 	Contents     string
 	Upgradeables []string
+
+	// dir, if set, is the directory the hook is installed in, in place of
+	// the repository's hooks directory.
+	dir string
 }
 
 func (h *Hook) Exists() bool {
@@ -38,6 +42,10 @@ func (h *Hook) Path() string {
 // directory. If `core.hooksPath` is configured and supported (Git verison is
 // greater than "2.9.0"), it will return that instead.
 func (h *Hook) Dir() string {
+	if len(h.dir) > 0 {
+		return h.dir
+	}
+
 	customHooksSupported := git.Config.IsGitVersionAtLeast("2.9.0")
 	if hp, ok := config.Config.Git.Get("core.hooksPath"); ok && customHooksSupported {
 		return hp
@@ -4,12 +4,14 @@ package lfs
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
 	"github.com/git-lfs/git-lfs/localstorage"
 	"github.com/git-lfs/git-lfs/tools"
 	"github.com/git-lfs/git-lfs/tq"
@@ -51,6 +53,15 @@ func LocalMediaPathReadOnly(oid string) string {
 	return localstorage.Objects().ObjectPath(oid)
 }
 
+// recordAccess notes that the object with the given oid was used to write a
+// working tree file, for the least recently used eviction of "git lfs prune".
+// Failing to do so isn't worth failing the checkout for.
+func recordAccess(oid string) {
+	if err := localstorage.RecordAccess(oid); err != nil {
+		tracerx.Printf("unable to record access to %s: %s", oid, err)
+	}
+}
+
 func LocalReferencePath(sha string) string {
 	if config.LocalReferenceDir == "" {
 		return ""
@@ -58,9 +69,147 @@ func LocalReferencePath(sha string) string {
 	return filepath.Join(config.LocalReferenceDir, sha[0:2], sha[2:4], sha)
 }
 
+// referencePaths returns the paths the object with the given oid would have in
+// the object directory of the repository this one was cloned from with
+// --reference, if any, and in those given by lfs.alternate, in that order.
+// Relative alternates are relative to this repository's object directory, as
+// those of Git are.
+func referencePaths(oid string) []string {
+	var paths []string
+	if path := LocalReferencePath(oid); len(path) > 0 {
+		paths = append(paths, path)
+	}
+
+	for _, dir := range config.Config.AlternateObjectDirs() {
+		if len(dir) == 0 {
+			continue
+		}
+		if !filepath.IsAbs(dir) && localstorage.Objects() != nil {
+			dir = filepath.Join(localstorage.Objects().RootDir, dir)
+		}
+		paths = append(paths, filepath.Join(dir, oid[0:2], oid[2:4], oid))
+	}
+	return paths
+}
+
+// ObjectExistsOfSize returns whether the object with the given oid and size is
+// stored locally, either whole, as chunks or compressed.
 func ObjectExistsOfSize(oid string, size int64) bool {
 	path := localstorage.Objects().ObjectPath(oid)
-	return tools.FileExistsOfSize(path, size)
+	return tools.FileExistsOfSize(path, size) || chunkedObjectExists(oid, size) || compressedObjectExists(oid, size)
+}
+
+// LocalObjectSize returns the size of the object with the given oid, and
+// whether it is stored locally, either whole, as chunks or compressed.
+func LocalObjectSize(oid string) (int64, bool) {
+	if fi, err := os.Stat(localstorage.Objects().ObjectPath(oid)); err == nil && fi.Mode().IsRegular() {
+		return fi.Size(), true
+	}
+	if size, ok := ChunkedObjectSize(oid); ok {
+		return size, true
+	}
+	return CompressedObjectSize(oid)
+}
+
+// chunkedObjectExists returns whether the object with the given oid and size is
+// stored as chunks.
+func chunkedObjectExists(oid string, size int64) bool {
+	chunks := localstorage.Chunks()
+	return chunks != nil && chunks.Has(oid, size)
+}
+
+// ChunkedObjectSize returns the size of the object with the given oid, and
+// whether it is stored as chunks.
+func ChunkedObjectSize(oid string) (int64, bool) {
+	if chunks := localstorage.Chunks(); chunks != nil {
+		return chunks.Size(oid)
+	}
+	return 0, false
+}
+
+// compressedObjectExists returns whether the object with the given oid and size
+// is stored compressed.
+func compressedObjectExists(oid string, size int64) bool {
+	compressed := localstorage.Compressed()
+	return compressed != nil && compressed.Has(oid, size)
+}
+
+// CompressedObjectSize returns the size of the object with the given oid, and
+// whether it is stored compressed.
+func CompressedObjectSize(oid string) (int64, bool) {
+	if compressed := localstorage.Compressed(); compressed != nil {
+		return compressed.Size(oid)
+	}
+	return 0, false
+}
+
+// OpenLocalObject opens the locally stored object with the given oid for
+// reading, reassembling it from its chunks or decompressing it if it isn't
+// stored whole.
+func OpenLocalObject(oid string) (io.ReadCloser, error) {
+	f, err := os.Open(LocalMediaPathReadOnly(oid))
+	if err == nil {
+		return f, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if chunks := localstorage.Chunks(); chunks != nil {
+		if r, cerr := chunks.Open(oid); cerr == nil {
+			return r, nil
+		}
+	}
+	if compressed := localstorage.Compressed(); compressed != nil {
+		if _, ok := compressed.Size(oid); ok {
+			return compressed.Open(oid)
+		}
+	}
+	return nil, err
+}
+
+// EnsureWholeObject reassembles the object with the given oid and size in the
+// object store from its chunks, or decompresses it, unless it is stored whole
+// already, for the commands which need a file of its contents.
+func EnsureWholeObject(oid string, size int64) error {
+	mediafile, err := LocalMediaPath(oid)
+	if err != nil {
+		return err
+	}
+	if tools.FileExistsOfSize(mediafile, size) {
+		return nil
+	}
+
+	if chunkedObjectExists(oid, size) {
+		tracerx.Printf("reassembling %s from its chunks", oid)
+		return localstorage.Chunks().Reconstruct(oid, mediafile)
+	}
+	if compressedObjectExists(oid, size) {
+		tracerx.Printf("decompressing %s", oid)
+		return localstorage.Compressed().Decompress(oid, mediafile)
+	}
+	return nil
+}
+
+// MoveToChunkStore stores the whole object with the given oid in the chunk
+// store, and then deletes it from the object store. It does nothing if the
+// object isn't stored whole.
+func MoveToChunkStore(oid string) error {
+	mediafile := LocalMediaPathReadOnly(oid)
+	f, err := os.Open(mediafile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	_, err = localstorage.Chunks().Store(oid, f)
+	f.Close()
+	if err != nil {
+		return errors.Wrapf(err, "Error storing %s as chunks", oid)
+	}
+	return os.Remove(mediafile)
 }
 
 func Environ(cfg *config.Configuration, manifest *tq.Manifest) []string {
@@ -120,7 +269,7 @@ func Environ(cfg *config.Configuration, manifest *tq.Manifest) []string {
 
 // TransferManifest builds a tq.Manifest using the given cfg.
 func TransferManifest(cfg *config.Configuration) *tq.Manifest {
-	return tq.NewManifestWithGitEnv(cfg.Access("download"), cfg.Git)
+	return tq.NewManifestWithConfig(cfg)
 }
 
 func InRepo() bool {
@@ -153,17 +302,34 @@ func AllObjects() []localstorage.Object {
 	return localstorage.Objects().AllObjects()
 }
 
+// LinkOrCopyFromReference links or copies the object with the given oid and
+// size into the object store from the first of the object directories given by
+// referencePaths which has it, unless it is stored locally already. Those
+// directories are only read from.
 func LinkOrCopyFromReference(oid string, size int64) error {
 	if ObjectExistsOfSize(oid, size) {
 		return nil
 	}
-	altMediafile := LocalReferencePath(oid)
-	mediafile, err := LocalMediaPath(oid)
-	if err != nil {
-		return err
-	}
-	if altMediafile != "" && tools.FileExistsOfSize(altMediafile, size) {
-		return LinkOrCopy(altMediafile, mediafile)
+
+	for _, altMediafile := range referencePaths(oid) {
+		if !tools.FileExistsOfSize(altMediafile, size) {
+			continue
+		}
+
+		mediafile, err := LocalMediaPath(oid)
+		if err != nil {
+			return err
+		}
+		tracerx.Printf("using %s from %s", oid, altMediafile)
+		if err := LinkOrCopy(altMediafile, mediafile); err != nil {
+			return err
+		}
+		// A hard link shares the permissions of the other repository's
+		// object, which mustn't be changed.
+		if info, err := os.Stat(mediafile); err == nil && localstorage.IsProtected(info) {
+			return nil
+		}
+		return localstorage.ProtectObject(mediafile)
 	}
 	return nil
 }
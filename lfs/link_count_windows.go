@@ -0,0 +1,11 @@
+// +build windows
+
+package lfs
+
+import "os"
+
+// linkCount returns the number of hard links to the file with the given info,
+// which isn't needed on Windows, where objects aren't hard linked.
+func linkCount(info os.FileInfo) uint64 {
+	return 1
+}
@@ -10,6 +10,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/git-lfs/git-lfs/errors"
 	"github.com/git-lfs/git-lfs/progress"
@@ -22,12 +23,19 @@ var (
 		"https://hawser.github.com/spec/v1",  // pre-release
 		"https://git-lfs.github.com/spec/v1", // public launch
 	}
-	latest      = "https://git-lfs.github.com/spec/v1"
-	oidType     = "sha256"
-	oidRE       = regexp.MustCompile(`\A[[:alnum:]]{64}`)
-	matcherRE   = regexp.MustCompile("git-media|hawser|git-lfs")
-	extRE       = regexp.MustCompile(`\Aext-\d{1}-\w+`)
-	pointerKeys = []string{"version", "oid", "size"}
+	latest = "https://git-lfs.github.com/spec/v1"
+	// keyedVersion is the version of pointers which have keys v1 pointers
+	// can't, such as "ipfs-cid" and "provenance-" keys, so that parsers
+	// which only know v1 refuse them rather than reading them without those
+	// keys.
+	keyedVersion = "https://git-lfs.github.com/spec/v2"
+	ipfsCidKey   = "ipfs-cid"
+	oidType      = "sha256"
+	oidRE        = regexp.MustCompile(`\A[[:alnum:]]{64}`)
+	matcherRE    = regexp.MustCompile("git-media|hawser|git-lfs")
+	extRE        = regexp.MustCompile(`\Aext-\d{1}-\w+`)
+	pointerKeys  = []string{"version", "oid", "size"}
+	utf8BOM      = []byte("\xef\xbb\xbf")
 )
 
 type Pointer struct {
@@ -36,6 +44,16 @@ type Pointer struct {
 	Size       int64
 	OidType    string
 	Extensions []*PointerExtension
+	// IpfsCid is the content identifier of the object on IPFS, if it's
+	// stored there, given by the "ipfs-cid" key.
+	IpfsCid string
+	// Provenance records who cleaned the file into the pointer, if the
+	// pointer has "provenance-" keys.
+	Provenance Provenance
+	// Normalized describes how the data the pointer was decoded from
+	// differed from its canonical encoding, such as "CRLF line endings",
+	// or is empty if it didn't.
+	Normalized []string
 }
 
 // A PointerExtension is parsed from the Git LFS Pointer file.
@@ -53,7 +71,7 @@ func (p ByPriority) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 func (p ByPriority) Less(i, j int) bool { return p[i].Priority < p[j].Priority }
 
 func NewPointer(oid string, size int64, exts []*PointerExtension) *Pointer {
-	return &Pointer{latest, oid, size, oidType, exts}
+	return &Pointer{latest, oid, size, oidType, exts, "", nil, nil}
 }
 
 func NewPointerExtension(name string, priority int, oid string) *PointerExtension {
@@ -73,12 +91,23 @@ func (p *Pointer) Encoded() string {
 		return ""
 	}
 
+	version := latest
+	if len(p.IpfsCid) > 0 || len(p.Provenance) > 0 {
+		version = keyedVersion
+	}
+
 	var buffer bytes.Buffer
-	buffer.WriteString(fmt.Sprintf("version %s\n", latest))
+	buffer.WriteString(fmt.Sprintf("version %s\n", version))
 	for _, ext := range p.Extensions {
 		buffer.WriteString(fmt.Sprintf("ext-%d-%s %s:%s\n", ext.Priority, ext.Name, ext.OidType, ext.Oid))
 	}
+	if len(p.IpfsCid) > 0 {
+		buffer.WriteString(fmt.Sprintf("%s %s\n", ipfsCidKey, p.IpfsCid))
+	}
 	buffer.WriteString(fmt.Sprintf("oid %s:%s\n", p.OidType, p.Oid))
+	for _, field := range p.Provenance.Fields() {
+		buffer.WriteString(fmt.Sprintf("%s%s %s\n", provenanceKeyPrefix, field, p.Provenance[field]))
+	}
 	buffer.WriteString(fmt.Sprintf("size %d\n", p.Size))
 	return buffer.String()
 }
@@ -128,15 +157,86 @@ func DecodeFrom(reader io.Reader) (*Pointer, io.Reader, error) {
 		return nil, contents, err
 	}
 
-	p, err := decodeKV(bytes.TrimSpace(buf))
+	data, normalized := normalizePointerData(bytes.TrimSpace(buf))
+	p, err := decodeKV(data)
+	if err == nil {
+		p.Normalized = normalized
+	}
 	return p, contents, err
 }
 
+// normalizePointerData returns the given pointer data without a byte order
+// mark, with LF line endings, and with its keys in the order Encoded gives
+// them, along with descriptions of what was changed, so that pointers written
+// by editors or tools which alter them can still be read.
+func normalizePointerData(data []byte) ([]byte, []string) {
+	var normalized []string
+	if bytes.HasPrefix(data, utf8BOM) {
+		data = bytes.TrimSpace(data[len(utf8BOM):])
+		normalized = append(normalized, "a byte order mark")
+	}
+	if bytes.Contains(data, []byte("\r\n")) {
+		data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+		normalized = append(normalized, "CRLF line endings")
+	}
+
+	lines := pointerLines(bytes.Split(data, []byte("\n")))
+	for _, line := range lines {
+		if lines.rank(line) < 0 {
+			// Data which isn't a pointer, or has keys which a
+			// pointer can't, is left for decodeKV to reject.
+			return data, normalized
+		}
+	}
+	if !sort.IsSorted(lines) {
+		sort.Stable(lines)
+		data = bytes.Join(lines, []byte("\n"))
+		normalized = append(normalized, "keys out of order")
+	}
+	return data, normalized
+}
+
+// pointerLines sorts the lines of a pointer by their keys, in the order
+// Encoded gives them.
+type pointerLines [][]byte
+
+func (l pointerLines) Len() int           { return len(l) }
+func (l pointerLines) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l pointerLines) Less(i, j int) bool { return l.rank(l[i]) < l.rank(l[j]) }
+
+// rank returns the position of the given line's key among the keys of a
+// pointer, or -1 if a pointer can't have it.
+func (l pointerLines) rank(line []byte) int {
+	key := string(line)
+	if i := strings.IndexByte(key, ' '); i >= 0 {
+		key = key[:i]
+	}
+
+	switch {
+	case key == "version":
+		return 0
+	case extRE.MatchString(key):
+		return 1
+	case key == ipfsCidKey:
+		return 2
+	case key == "oid":
+		return 3
+	case provenanceKeyRE.MatchString(key):
+		return 4
+	case key == "size":
+		return 5
+	}
+	return -1
+}
+
 func verifyVersion(version string) error {
 	if len(version) == 0 {
 		return errors.NewNotAPointerError(errors.New("Missing version"))
 	}
 
+	if version == keyedVersion {
+		return nil
+	}
 	for _, v := range v1Aliases {
 		if v == version {
 			return nil
@@ -147,7 +247,7 @@ func verifyVersion(version string) error {
 }
 
 func decodeKV(data []byte) (*Pointer, error) {
-	kvps, exts, err := decodeKVData(data)
+	kvps, exts, keyed, provenance, err := decodeKVData(data)
 	if err != nil {
 		if errors.IsBadPointerKeyError(err) {
 			return nil, errors.StandardizeBadPointerError(err)
@@ -158,6 +258,14 @@ func decodeKV(data []byte) (*Pointer, error) {
 	if err := verifyVersion(kvps["version"]); err != nil {
 		return nil, err
 	}
+	if kvps["version"] != keyedVersion {
+		if _, ok := keyed[ipfsCidKey]; ok {
+			return nil, fmt.Errorf("Invalid key %q in a %s pointer", ipfsCidKey, kvps["version"])
+		}
+		if fields := provenance.Fields(); len(fields) > 0 {
+			return nil, fmt.Errorf("Invalid key %q in a %s pointer", provenanceKeyPrefix+fields[0], kvps["version"])
+		}
+	}
 
 	value, ok := kvps["oid"]
 	if !ok {
@@ -190,7 +298,16 @@ func decodeKV(data []byte) (*Pointer, error) {
 		sort.Sort(ByPriority(extensions))
 	}
 
-	return NewPointer(oid, size, extensions), nil
+	pointer := NewPointer(oid, size, extensions)
+	if kvps["version"] == keyedVersion {
+		pointer.Version = keyedVersion
+	}
+	pointer.IpfsCid = keyed[ipfsCidKey]
+	pointer.Provenance = provenance
+	if len(pointer.IpfsCid) > 0 {
+		tq.RememberIpfsCid(oid, pointer.IpfsCid)
+	}
+	return pointer, nil
 }
 
 func parseOid(value string) (string, error) {
@@ -240,7 +357,10 @@ func validatePointerExtensions(exts []*PointerExtension) error {
 	return nil
 }
 
-func decodeKVData(data []byte) (kvps map[string]string, exts map[string]string, err error) {
+// decodeKVData returns the keys of the given pointer data: those every pointer
+// has, its extensions, the keys only pointers of keyedVersion can have, and
+// its provenance, which only they can have too.
+func decodeKVData(data []byte) (kvps map[string]string, exts map[string]string, keyed map[string]string, provenance Provenance, err error) {
 	kvps = make(map[string]string)
 
 	if !matcherRE.Match(data) {
@@ -272,6 +392,20 @@ func decodeKVData(data []byte) (kvps map[string]string, exts map[string]string,
 		}
 
 		if expected := pointerKeys[line]; key != expected {
+			if key == ipfsCidKey {
+				if keyed == nil {
+					keyed = make(map[string]string)
+				}
+				keyed[key] = value
+				continue
+			}
+			if provenanceKeyRE.MatchString(key) {
+				if provenance == nil {
+					provenance = make(Provenance)
+				}
+				provenance[strings.TrimPrefix(key, provenanceKeyPrefix)] = value
+				continue
+			}
 			if !extRE.Match([]byte(key)) {
 				err = errors.NewBadPointerKeyError(expected, key)
 				return
@@ -290,3 +424,26 @@ func decodeKVData(data []byte) (kvps map[string]string, exts map[string]string,
 	err = scanner.Err()
 	return
 }
+
+var (
+	warnedPointers   = make(map[string]bool)
+	warnedPointersMu sync.Mutex
+)
+
+// warnNormalizedPointer warns, once for each blob, that the pointer in the blob
+// with the given SHA-1 was normalized to be read, and how.
+func warnNormalizedPointer(sha1 string, p *Pointer) {
+	if len(p.Normalized) == 0 {
+		return
+	}
+
+	warnedPointersMu.Lock()
+	defer warnedPointersMu.Unlock()
+	if warnedPointers[sha1] {
+		return
+	}
+	warnedPointers[sha1] = true
+
+	fmt.Fprintf(os.Stderr, "Warning: Git LFS pointer %s (blob %s) has %s; run `git lfs pointer --fix` to rewrite it\n",
+		p.Oid, sha1, strings.Join(p.Normalized, " and "))
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/git-lfs/git-lfs/errors"
 	"github.com/git-lfs/git-lfs/progress"
 	"github.com/git-lfs/git-lfs/tools"
+	"github.com/git-lfs/git-lfs/tq"
 )
 
 type cleanedAsset struct {
@@ -20,11 +21,18 @@ type cleanedAsset struct {
 }
 
 func PointerClean(reader io.Reader, fileName string, fileSize int64, cb progress.CopyCallback) (*cleanedAsset, error) {
-	extensions, err := config.Config.SortedExtensions()
+	sorted, err := config.Config.SortedExtensions()
 	if err != nil {
 		return nil, err
 	}
 
+	var extensions []config.Extension
+	for _, ext := range sorted {
+		if ext.Applies(fileName) {
+			extensions = append(extensions, ext)
+		}
+	}
+
 	var oid string
 	var size int64
 	var tmp *os.File
@@ -59,9 +67,25 @@ func PointerClean(reader io.Reader, fileName string, fileSize int64, cb progress
 	}
 
 	pointer := NewPointer(oid, size, exts)
+	pointer.Provenance = cleanProvenance(oid, size)
+	if pointer.IpfsCid, err = CleanIpfsCid(tmp.Name()); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
 	return &cleanedAsset{tmp.Name(), pointer}, err
 }
 
+// CleanIpfsCid returns the content identifier on IPFS of the contents of the
+// file at the given path, if objects are uploaded to an ipfs+http(s):// URL, as
+// pointers must record it for objects to be downloaded from there. Otherwise it
+// returns "".
+func CleanIpfsCid(path string) (string, error) {
+	if !config.Config.Endpoint("upload").IsIpfs() {
+		return "", nil
+	}
+	return tq.IpfsFileCid(path)
+}
+
 func copyToTemp(reader io.Reader, fileSize int64, cb progress.CopyCallback) (oid string, size int64, tmp *os.File, err error) {
 	tmp, err = TempFile("")
 	if err != nil {
@@ -24,14 +24,42 @@ func PointerSmudgeToFile(filename string, ptr *Pointer, download bool, manifest
 	}
 	defer file.Close()
 	if err := PointerSmudge(file, ptr, filename, download, manifest, cb); err != nil {
+		// leave the pointer, rather than whatever was written of the
+		// object, as lfs.missingobjectpolicy decides what's done with it
+		file.Seek(0, os.SEEK_SET)
+		file.Truncate(0)
+		ptr.Encode(file)
+
 		if errors.IsDownloadDeclinedError(err) {
-			// write placeholder data instead
-			file.Seek(0, os.SEEK_SET)
-			ptr.Encode(file)
 			return err
-		} else {
-			return fmt.Errorf("Could not write working directory file: %v", err)
 		}
+		return fmt.Errorf("Could not write working directory file: %v", err)
+	}
+	return nil
+}
+
+// MissingObjectXattr is the extended attribute PointerPlaceholderToFile marks
+// placeholders with, whose value is the OID of the object they stand in for.
+const MissingObjectXattr = "user.git-lfs.missing"
+
+// PointerPlaceholderToFile replaces the file at filename with a placeholder for
+// the object of ptr, which couldn't be downloaded: its pointer, so that it's
+// checked out once the object can be, and cleaned as it was, marked with the
+// MissingObjectXattr extended attribute where the file system supports it.
+func PointerPlaceholderToFile(filename string, ptr *Pointer) error {
+	os.MkdirAll(filepath.Dir(filename), 0755)
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("Could not create working directory file: %v", err)
+	}
+	_, err = ptr.Encode(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("Could not write working directory file: %v", err)
+	}
+
+	if err := tools.SetXattr(filename, MissingObjectXattr, ptr.Oid); err != nil {
+		tracerx.Printf("unable to mark placeholder %s: %s", filename, err)
 	}
 	return nil
 }
@@ -51,11 +79,15 @@ func PointerSmudge(writer io.Writer, ptr *Pointer, workingfile string, download
 			tracerx.Printf("Removing %s, size %d is invalid", mediafile, fileSize)
 			os.RemoveAll(mediafile)
 			stat = nil
+		} else if err := verifyLinkedObject(ptr.Oid, mediafile, stat); err != nil {
+			return errors.NewSmudgeError(err, ptr.Oid, mediafile)
 		}
 	}
 
 	if statErr != nil || stat == nil {
-		if download {
+		if chunkedObjectExists(ptr.Oid, ptr.Size) || compressedObjectExists(ptr.Oid, ptr.Size) {
+			err = readStoredFile(writer, ptr, mediafile, workingfile, cb)
+		} else if download {
 			err = downloadFile(writer, ptr, workingfile, mediafile, manifest, cb)
 		} else {
 			return errors.NewDownloadDeclinedError(statErr, "smudge")
@@ -68,6 +100,10 @@ func PointerSmudge(writer io.Writer, ptr *Pointer, workingfile string, download
 		return errors.NewSmudgeError(err, ptr.Oid, mediafile)
 	}
 
+	recordAccess(ptr.Oid)
+	if err := RecordProvenance(ptr.Oid, ptr.Provenance); err != nil {
+		tracerx.Printf("unable to record provenance of %s: %s", ptr.Oid, err)
+	}
 	return nil
 }
 
@@ -90,9 +126,36 @@ func downloadFile(writer io.Writer, ptr *Pointer, workingfile, mediafile string,
 		}
 	}
 
+	if !tools.FileExists(mediafile) && (chunkedObjectExists(ptr.Oid, ptr.Size) || compressedObjectExists(ptr.Oid, ptr.Size)) {
+		return readStoredFile(writer, ptr, mediafile, workingfile, nil)
+	}
 	return readLocalFile(writer, ptr, mediafile, workingfile, nil)
 }
 
+// readStoredFile writes the contents of the object of ptr, which is stored as
+// chunks or compressed, to writer. Objects with extensions are reassembled or
+// decompressed in the object store first, as the extensions read them from
+// there.
+func readStoredFile(writer io.Writer, ptr *Pointer, mediafile string, workingfile string, cb progress.CopyCallback) error {
+	if len(ptr.Extensions) > 0 {
+		if err := EnsureWholeObject(ptr.Oid, ptr.Size); err != nil {
+			return err
+		}
+		return readLocalFile(writer, ptr, mediafile, workingfile, cb)
+	}
+
+	reader, err := OpenLocalObject(ptr.Oid)
+	if err != nil {
+		return errors.Wrapf(err, "Error opening stored media file.")
+	}
+	defer reader.Close()
+
+	if _, err := tools.CopyWithCallback(writer, reader, ptr.Size, cb); err != nil {
+		return errors.Wrapf(err, "Error reading from stored media file: %s", err)
+	}
+	return nil
+}
+
 func readLocalFile(writer io.Writer, ptr *Pointer, mediafile string, workingfile string, cb progress.CopyCallback) error {
 	reader, err := os.Open(mediafile)
 	if err != nil {
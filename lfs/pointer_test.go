@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/git-lfs/git-lfs/errors"
 	"github.com/stretchr/testify/assert"
@@ -155,6 +156,86 @@ size 12345`
 	assertEqualWithExample(t, ex, "sha256", p.Extensions[2].OidType)
 }
 
+func TestEncodeProvenance(t *testing.T) {
+	var buf bytes.Buffer
+	pointer := NewPointer("main_oid", 12345, nil)
+	pointer.Provenance = NewProvenance("A U Thor\n<author@example.com>", time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC), "git-lfs/2.0.0")
+	_, err := EncodePointer(&buf, pointer)
+	assert.Nil(t, err)
+
+	bufReader := bufio.NewReader(&buf)
+	assertLine(t, bufReader, "version https://git-lfs.github.com/spec/v2\n")
+	assertLine(t, bufReader, "oid sha256:main_oid\n")
+	assertLine(t, bufReader, "provenance-by A U Thor <author@example.com>\n")
+	assertLine(t, bufReader, "provenance-time 2017-01-02T15:04:05Z\n")
+	assertLine(t, bufReader, "provenance-tool git-lfs/2.0.0\n")
+	assertLine(t, bufReader, "size 12345\n")
+}
+
+func TestDecodeProvenance(t *testing.T) {
+	ex := `version https://git-lfs.github.com/spec/v2
+oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+provenance-by A U Thor <author@example.com>
+provenance-time 2017-01-02T15:04:05Z
+provenance-x.ci-job 1234
+size 12345`
+
+	p, err := DecodePointer(bytes.NewBufferString(ex))
+	assertEqualWithExample(t, ex, nil, err)
+	assertEqualWithExample(t, ex, "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393", p.Oid)
+	assertEqualWithExample(t, ex, int64(12345), p.Size)
+	assertEqualWithExample(t, ex, "A U Thor <author@example.com>", p.Provenance[ProvenanceBy])
+	assertEqualWithExample(t, ex, "2017-01-02T15:04:05Z", p.Provenance[ProvenanceTime])
+	assertEqualWithExample(t, ex, "1234", p.Provenance["x.ci-job"])
+	assertEqualWithExample(t, ex, "cleaned by A U Thor <author@example.com>, at 2017-01-02T15:04:05Z, x.ci-job 1234", p.Provenance.String())
+
+	// fields which aren't known survive being encoded again
+	assertEqualWithExample(t, ex, ex+"\n", p.Encoded())
+}
+
+func TestDecodeProvenanceRequiresV2(t *testing.T) {
+	ex := `version https://git-lfs.github.com/spec/v1
+oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+provenance-by A U Thor <author@example.com>
+size 12345`
+
+	_, err := DecodePointer(bytes.NewBufferString(ex))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), `Invalid key "provenance-by"`)
+	}
+}
+
+func TestEncodeIpfsCid(t *testing.T) {
+	var buf bytes.Buffer
+	pointer := NewPointer("main_oid", 12345, nil)
+	pointer.IpfsCid = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+	_, err := EncodePointer(&buf, pointer)
+	assert.Nil(t, err)
+
+	bufReader := bufio.NewReader(&buf)
+	assertLine(t, bufReader, "version https://git-lfs.github.com/spec/v2\n")
+	assertLine(t, bufReader, "ipfs-cid bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi\n")
+	assertLine(t, bufReader, "oid sha256:main_oid\n")
+	assertLine(t, bufReader, "size 12345\n")
+}
+
+func TestDecodeIpfsCid(t *testing.T) {
+	ex := `version https://git-lfs.github.com/spec/v2
+ipfs-cid bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi
+oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+size 12345`
+
+	p, err := DecodePointer(bytes.NewBufferString(ex))
+	assertEqualWithExample(t, ex, nil, err)
+	assertEqualWithExample(t, ex, keyedVersion, p.Version)
+	assertEqualWithExample(t, ex, "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi", p.IpfsCid)
+	assertEqualWithExample(t, ex, ex+"\n", p.Encoded())
+
+	// v1 pointers can't give one
+	_, err = DecodePointer(strings.NewReader(strings.Replace(ex, "spec/v2", "spec/v1", 1)))
+	assert.NotNil(t, err)
+}
+
 func TestDecodePreRelease(t *testing.T) {
 	ex := `version https://hawser.github.com/spec/v1
 oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
@@ -178,6 +259,25 @@ func TestDecodeFromEmptyReader(t *testing.T) {
 	assert.Empty(t, by)
 }
 
+func TestDecodeNormalized(t *testing.T) {
+	for normalized, data := range map[string]string{
+		"":                  "version https://git-lfs.github.com/spec/v1\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 12345\n",
+		"CRLF line endings": "version https://git-lfs.github.com/spec/v1\r\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\r\nsize 12345\r\n",
+		"a byte order mark": "\xef\xbb\xbfversion https://git-lfs.github.com/spec/v1\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 12345\n",
+		"keys out of order": "version https://git-lfs.github.com/spec/v1\nsize 12345\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\n",
+		"a byte order mark, CRLF line endings, keys out of order": "\xef\xbb\xbfsize 12345\r\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\r\nversion https://git-lfs.github.com/spec/v1\r\n",
+	} {
+		p, err := DecodePointer(bytes.NewBufferString(data))
+		if !assert.Nil(t, err, normalized) {
+			continue
+		}
+
+		assert.Equal(t, "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393", p.Oid, normalized)
+		assert.Equal(t, int64(12345), p.Size, normalized)
+		assert.Equal(t, normalized, strings.Join(p.Normalized, ", "), normalized)
+	}
+}
+
 func TestDecodeInvalid(t *testing.T) {
 	examples := []string{
 		"invalid stuff",
@@ -233,11 +333,6 @@ oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
 size 12345
 wat wat`,
 
-		// keys out of order
-		`version https://git-lfs.github.com/spec/v1
-size 12345
-oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393`,
-
 		// bad ext name
 		`version https://git-lfs.github.com/spec/v1
 ext-0-$$$$ sha256:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff
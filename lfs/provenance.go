@@ -0,0 +1,175 @@
+package lfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	// ProvenanceBy is the provenance field naming who cleaned a file, as
+	// "Name <email>".
+	ProvenanceBy = "by"
+	// ProvenanceTime is the provenance field giving when a file was
+	// cleaned, in RFC 3339 format.
+	ProvenanceTime = "time"
+	// ProvenanceTool is the provenance field naming the tool which cleaned
+	// a file.
+	ProvenanceTool = "tool"
+
+	provenanceKeyPrefix = "provenance-"
+)
+
+var provenanceKeyRE = regexp.MustCompile(`\Aprovenance-[a-z0-9.-]+\z`)
+
+// Provenance records who cleaned a file into a pointer, when, and with what
+// tool, as "provenance-<field> <value>" keys in the pointer. Fields which
+// aren't known are kept, so that pointers keep them when encoded again.
+type Provenance map[string]string
+
+// NewProvenance returns the provenance of a file cleaned by the given person,
+// at the given time, with the given tool.
+func NewProvenance(by string, t time.Time, tool string) Provenance {
+	p := make(Provenance)
+	p.set(ProvenanceBy, by)
+	p.set(ProvenanceTime, t.UTC().Format(time.RFC3339))
+	p.set(ProvenanceTool, tool)
+	return p
+}
+
+// set sets the given field, unless value is empty, replacing the line breaks
+// which pointer values can't hold.
+func (p Provenance) set(field, value string) {
+	value = strings.TrimSpace(strings.Replace(strings.Replace(value, "\r", " ", -1), "\n", " ", -1))
+	if len(value) > 0 {
+		p[field] = value
+	}
+}
+
+// Fields returns the provenance's fields, sorted as their keys are in a
+// pointer.
+func (p Provenance) Fields() []string {
+	fields := make([]string, 0, len(p))
+	for field := range p {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// String describes the provenance, such as "cleaned by A U Thor
+// <author@example.com>, at 2017-01-02T15:04:05Z, with git-lfs/2.0.0".
+func (p Provenance) String() string {
+	var parts []string
+	if by, ok := p[ProvenanceBy]; ok {
+		parts = append(parts, "by "+by)
+	}
+	if t, ok := p[ProvenanceTime]; ok {
+		parts = append(parts, "at "+t)
+	}
+	if tool, ok := p[ProvenanceTool]; ok {
+		parts = append(parts, "with "+tool)
+	}
+	for _, field := range p.Fields() {
+		switch field {
+		case ProvenanceBy, ProvenanceTime, ProvenanceTool:
+		default:
+			parts = append(parts, fmt.Sprintf("%s %s", field, p[field]))
+		}
+	}
+	return "cleaned " + strings.Join(parts, ", ")
+}
+
+// cleanProvenance returns the provenance a file cleaned into the object with
+// the given oid and size is given: the one already recorded for the object, so
+// that cleaning the same contents again gives the same pointer, or, if there is
+// none and lfs.provenance.enabled is set, a new one, which is recorded. Objects
+// which are already stored, as they were added before provenance was enabled
+// or fetched without any, aren't given one, which would change their pointers.
+func cleanProvenance(oid string, size int64) Provenance {
+	if p := RecordedProvenance(oid); p != nil {
+		return p
+	}
+	if !config.Config.ProvenanceEnabled() || ObjectExistsOfSize(oid, size) {
+		return nil
+	}
+
+	name, _ := config.Config.Git.Get("user.name")
+	email, _ := config.Config.Git.Get("user.email")
+	p := NewProvenance(fmt.Sprintf("%s <%s>", name, email), time.Now(), config.Config.ProvenanceTool())
+	if err := RecordProvenance(oid, p); err != nil {
+		tracerx.Printf("unable to record provenance of %s: %s", oid, err)
+	}
+	return p
+}
+
+func provenancePath(oid string) string {
+	return filepath.Join(config.LocalGitStorageDir, "lfs", "provenance", oid[0:2], oid)
+}
+
+// RecordedProvenance returns the provenance recorded for the object with the
+// given oid, by cleaning or checking out a file with it, or nil if there is
+// none.
+func RecordedProvenance(oid string) Provenance {
+	if len(config.LocalGitStorageDir) == 0 || len(oid) < 2 {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(provenancePath(oid))
+	if err != nil {
+		return nil
+	}
+
+	p := make(Provenance)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		if len(parts) == 2 {
+			p[parts[0]] = parts[1]
+		}
+	}
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
+
+// RecordProvenance records the given provenance for the object with the given
+// oid, unless one is recorded already, so that files cleaned into the object
+// later are given the same one.
+func RecordProvenance(oid string, p Provenance) error {
+	if len(config.LocalGitStorageDir) == 0 || len(p) == 0 || len(oid) < 2 {
+		return nil
+	}
+
+	path := provenancePath(oid)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	for _, field := range p.Fields() {
+		if _, err := fmt.Fprintf(f, "%s %s\n", field, p[field]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
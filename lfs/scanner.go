@@ -1,6 +1,9 @@
 package lfs
 
-import "github.com/git-lfs/git-lfs/tools"
+import (
+	"github.com/git-lfs/git-lfs/git/odb"
+	"github.com/git-lfs/git-lfs/tools"
+)
 
 const (
 	// blobSizeCutoff is used to determine which files to scan for Git LFS
@@ -23,6 +26,9 @@ type WrappedPointer struct {
 	Name    string
 	SrcName string
 	Status  string
+	// Mode is the file mode of the pointer blob in its tree, such as
+	// "100755", if it was found by scanning a tree, or "" otherwise.
+	Mode string
 	*Pointer
 }
 
@@ -53,6 +59,44 @@ func catFileBatch(revs *StringChannelWrapper) (*PointerChannelWrapper, error) {
 	return NewPointerChannelWrapper(pointerCh, errCh), nil
 }
 
+// catFileBatchCheckWith behaves like catFileBatchCheck, but checks the revs
+// with the given long-running checker instead of starting a new process.
+func catFileBatchCheckWith(checker *catFileBatchChecker, revs *StringChannelWrapper) *StringChannelWrapper {
+	smallRevCh := make(chan string, chanBufSize)
+	errCh := make(chan error, 2) // a check error, and one from revs
+	runCatFileBatchCheckWith(checker, smallRevCh, revs, errCh)
+	return NewStringChannelWrapper(smallRevCh, errCh)
+}
+
+// catFileBatches behaves like catFileBatch, but reads the objects with n
+// 'git cat-file --batch' processes in parallel.
+func catFileBatches(n int, revs *StringChannelWrapper) (*PointerChannelWrapper, error) {
+	pointerCh := make(chan *WrappedPointer, chanBufSize)
+	errCh := make(chan error, 2*n+1) // a scan & exit error from each process, and one from revs
+	if err := runCatFileBatches(n, pointerCh, revs, errCh); err != nil {
+		return nil, err
+	}
+	return NewPointerChannelWrapper(pointerCh, errCh), nil
+}
+
+// nativeBatchCheck behaves like catFileBatchCheck, but reads the objects from
+// db in-process.
+func nativeBatchCheck(db *odb.ObjectDatabase, revs *StringChannelWrapper) *StringChannelWrapper {
+	smallRevCh := make(chan string, chanBufSize)
+	errCh := make(chan error, 2) // a stat error, and one from revs
+	runNativeBatchCheck(db, smallRevCh, revs, errCh)
+	return NewStringChannelWrapper(smallRevCh, errCh)
+}
+
+// nativeBatch behaves like catFileBatch, but reads the objects from db
+// in-process.
+func nativeBatch(db *odb.ObjectDatabase, revs *StringChannelWrapper) *PointerChannelWrapper {
+	pointerCh := make(chan *WrappedPointer, chanBufSize)
+	errCh := make(chan error, 2) // a read error, and one from revs
+	runNativeBatch(db, pointerCh, revs, errCh)
+	return NewPointerChannelWrapper(pointerCh, errCh)
+}
+
 // ChannelWrapper for pointer Scan* functions to more easily return async error data via Wait()
 // See NewPointerChannelWrapper for construction / use
 type PointerChannelWrapper struct {
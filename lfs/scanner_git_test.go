@@ -5,18 +5,31 @@ package lfs_test // to avoid import cycles
 // which avoids import cycles with testutils
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"testing"
 	"time"
 
+	"github.com/git-lfs/git-lfs/git"
 	. "github.com/git-lfs/git-lfs/lfs"
 	"github.com/git-lfs/git-lfs/test"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestScanUnpushed(t *testing.T) {
-	repo := test.NewRepo(t)
+	testScanUnpushed(t, "")
+}
+
+func TestScanUnpushedSHA256(t *testing.T) {
+	testScanUnpushed(t, git.ObjectFormatSHA256)
+}
+
+func testScanUnpushed(t *testing.T, objectFormat string) {
+	repo := test.NewCustomRepo(t, &test.RepoCreateSettings{
+		RepoType:     test.RepoTypeNormal,
+		ObjectFormat: objectFormat,
+	})
 	repo.Pushd()
 	defer func() {
 		repo.Popd()
@@ -112,6 +125,129 @@ func scanUnpushed(remoteName string) ([]*WrappedPointer, error) {
 	return pointers, multiErr
 }
 
+func TestScanWithDoneContext(t *testing.T) {
+	repo := test.NewRepo(t)
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	repo.AddCommits([]*test.CommitInput{
+		{Files: []*test.FileInput{{Filename: "file1.txt", Size: 20}}},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var pointers []*WrappedPointer
+	gitscanner := NewGitScannerContext(ctx, func(p *WrappedPointer, err error) {
+		if err == nil {
+			pointers = append(pointers, p)
+		}
+	})
+	defer gitscanner.Close()
+
+	assert.Equal(t, context.Canceled, gitscanner.ScanRef("master", nil))
+	assert.Empty(t, pointers)
+}
+
+func TestScanLeftToRemote(t *testing.T) {
+	testScanLeftToRemote(t, "")
+}
+
+func TestScanLeftToRemoteSHA256(t *testing.T) {
+	testScanLeftToRemote(t, git.ObjectFormatSHA256)
+}
+
+func testScanLeftToRemote(t *testing.T, objectFormat string) {
+	repo := test.NewCustomRepo(t, &test.RepoCreateSettings{
+		RepoType:     test.RepoTypeNormal,
+		ObjectFormat: objectFormat,
+	})
+	repo.Pushd()
+	defer func() {
+		repo.Popd()
+		repo.Cleanup()
+	}()
+
+	inputs := []*test.CommitInput{
+		{ // 0
+			Files: []*test.FileInput{
+				{Filename: "file1.txt", Size: 20},
+			},
+		},
+		{ // 1
+			Files: []*test.FileInput{
+				{Filename: "file1.txt", Size: 25},
+				{Filename: "file2.txt", Size: 26},
+				{Filename: "file3.txt", Size: 27},
+			},
+		},
+		{ // 2
+			NewBranch: "branch2",
+			Files: []*test.FileInput{
+				{Filename: "file1.txt", Size: 30},
+				{Filename: "file4.txt", Size: 31},
+			},
+		},
+	}
+	outputs := repo.AddCommits(inputs)
+
+	repo.AddRemote("origin")
+	test.RunGitCommand(t, true, "push", "origin", outputs[0].Sha+":refs/heads/master")
+
+	// One scanner is used for both refs, as when pushing several refs, so
+	// they share a 'git cat-file --batch-check' process
+	gitscanner := NewGitScanner(nil)
+	assert.Nil(t, gitscanner.RemoteForPush("origin"))
+	defer gitscanner.Close()
+
+	pointers, err := scanLeftToRemote(gitscanner, "master")
+	assert.Nil(t, err)
+	expected := []string{
+		"file1.txt " + outputs[1].Files[0].Oid,
+		"file2.txt " + outputs[1].Files[1].Oid,
+		"file3.txt " + outputs[1].Files[2].Oid,
+	}
+	sort.Strings(expected)
+	assert.Equal(t, expected, pointers)
+
+	pointers, err = scanLeftToRemote(gitscanner, "branch2")
+	assert.Nil(t, err)
+	expected = append(expected,
+		"file1.txt "+outputs[2].Files[0].Oid,
+		"file4.txt "+outputs[2].Files[1].Oid,
+	)
+	sort.Strings(expected)
+	assert.Equal(t, expected, pointers)
+}
+
+// scanLeftToRemote returns the sorted names and oids of the pointers found by
+// gitscanner.ScanLeftToRemote(), which are found in no particular order.
+func scanLeftToRemote(gitscanner *GitScanner, ref string) ([]string, error) {
+	pointers := make([]string, 0, 10)
+	var multiErr error
+
+	err := gitscanner.ScanLeftToRemote(ref, func(p *WrappedPointer, err error) {
+		if err != nil {
+			if multiErr != nil {
+				multiErr = fmt.Errorf("%v\n%v", multiErr, err)
+			} else {
+				multiErr = err
+			}
+			return
+		}
+
+		pointers = append(pointers, p.Name+" "+p.Oid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(pointers)
+	return pointers, multiErr
+}
+
 func TestScanPreviousVersions(t *testing.T) {
 	repo := test.NewRepo(t)
 	repo.Pushd()
@@ -3,6 +3,10 @@ package lfs
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/git-lfs/git-lfs/config"
 )
 
 var (
@@ -19,6 +23,22 @@ var (
 		},
 	}
 
+	// postCommitHook invokes `git lfs post-commit` after each commit, to
+	// upload the commit's objects in the background. It is only installed
+	// when lfs.autopush is set.
+	postCommitHook = &Hook{
+		Type:     "post-commit",
+		Contents: "#!/bin/sh\ncommand -v git-lfs >/dev/null 2>&1 || exit 0\ngit lfs post-commit \"$@\"",
+	}
+
+	// preAutoGCHook invokes `git lfs gc --auto` before Git's automatic
+	// garbage collection, such as by `git maintenance`. It is only
+	// installed when lfs.autogc is set, and never stops Git's own.
+	preAutoGCHook = &Hook{
+		Type:     "pre-auto-gc",
+		Contents: "#!/bin/sh\ncommand -v git-lfs >/dev/null 2>&1 || exit 0\ngit lfs gc --auto --quiet\nexit 0",
+	}
+
 	hooks = []*Hook{
 		prePushHook,
 	}
@@ -58,7 +78,7 @@ var (
 func GetHookInstallSteps() string {
 
 	var buf bytes.Buffer
-	for _, h := range hooks {
+	for _, h := range installableHooks() {
 		buf.WriteString(fmt.Sprintf("Add the following to .git/hooks/%s :\n\n", h.Type))
 		buf.WriteString(h.Contents)
 		buf.WriteString("\n")
@@ -66,9 +86,34 @@ func GetHookInstallSteps() string {
 	return buf.String()
 }
 
-// InstallHooks installs all hooks in the `hooks` var.
+// installableHooks returns the hooks in the `hooks` var, along with the
+// post-commit hook if lfs.autopush is set and the pre-auto-gc hook if
+// lfs.autogc is set.
+func installableHooks() []*Hook {
+	installable := append([]*Hook{}, hooks...)
+	if config.Config.AutoPush() {
+		installable = append(installable, postCommitHook)
+	}
+	if config.Config.AutoGC() {
+		installable = append(installable, preAutoGCHook)
+	}
+	return installable
+}
+
+// InstallableHookTypes returns the types of the hooks InstallHooks installs,
+// such as "pre-push".
+func InstallableHookTypes() []string {
+	var types []string
+	for _, h := range installableHooks() {
+		types = append(types, h.Type)
+	}
+	return types
+}
+
+// InstallHooks installs all hooks in the `hooks` var, the post-commit hook if
+// lfs.autopush is set and the pre-auto-gc hook if lfs.autogc is set.
 func InstallHooks(force bool) error {
-	for _, h := range hooks {
+	for _, h := range installableHooks() {
 		if err := h.Install(force); err != nil {
 			return err
 		}
@@ -77,7 +122,33 @@ func InstallHooks(force bool) error {
 	return nil
 }
 
-// UninstallHooks removes all hooks in range of the `hooks` var.
+// InstallTemplate installs the filters and hooks InstallFilters and
+// InstallHooks install into the given template directory, named by
+// init.templateDir, from which Git copies them into each repository it creates
+// or clones, so that they're set up for Git LFS from the start.
+func InstallTemplate(dir string, opt InstallOptions, passThrough bool) error {
+	if err := os.MkdirAll(filepath.Join(dir, "hooks"), 0755); err != nil {
+		return err
+	}
+
+	opt.File = filepath.Join(dir, "config")
+	if err := InstallFilters(opt, passThrough); err != nil {
+		return err
+	}
+
+	for _, h := range installableHooks() {
+		templateHook := *h
+		templateHook.dir = filepath.Join(dir, "hooks")
+		if err := templateHook.Install(opt.Force); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UninstallHooks removes all hooks in range of the `hooks` var, and the
+// post-commit and pre-auto-gc hooks if they were installed.
 func UninstallHooks() error {
 	for _, h := range hooks {
 		if err := h.Uninstall(); err != nil {
@@ -85,6 +156,14 @@ func UninstallHooks() error {
 		}
 	}
 
+	for _, h := range []*Hook{postCommitHook, preAutoGCHook} {
+		if h.Exists() {
+			if err := h.Uninstall(); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -103,8 +182,8 @@ func InstallFilters(opt InstallOptions, passThrough bool) error {
 }
 
 // UninstallFilters proxies into the Uninstall method on the Filters type to
-// remove all installed filters.
-func UninstallFilters() error {
-	filters.Uninstall()
+// remove all installed filters from the config the options choose.
+func UninstallFilters(opt InstallOptions) error {
+	filters.Uninstall(opt)
 	return nil
 }
@@ -0,0 +1,145 @@
+package localstorage
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/git-lfs/git-lfs/config"
+)
+
+// accessLogPath returns the path of the file recording when objects were last
+// used to write files to a working tree. It lives outside the objects
+// directory so that it is shared between worktrees but never scanned as an
+// object.
+func accessLogPath() string {
+	return filepath.Join(config.LocalGitStorageDir, "lfs", "access")
+}
+
+// accessLogMu serializes the writes to the access log of this process, so that
+// the entries of concurrent checkouts aren't interleaved, or appended to a log
+// which ForgetAccess is replacing.
+var accessLogMu sync.Mutex
+
+// RecordAccess notes that the object with the given OID was used just now.
+// Entries are appended to the access log as "<oid> <unix time>" lines, so that
+// concurrent smudge processes don't need to lock it; the latest time for an
+// object wins.
+func RecordAccess(oid string) error {
+	if len(config.LocalGitStorageDir) == 0 {
+		return nil
+	}
+
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+
+	f, err := os.OpenFile(accessLogPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s %d\n", oid, time.Now().Unix())
+	return err
+}
+
+// AccessTimes returns the time each object in the access log was last used.
+// Objects that were never used since they were added to the store have no
+// entry, and malformed lines are ignored.
+func AccessTimes() (map[string]time.Time, error) {
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+
+	return readAccessTimes()
+}
+
+// ForgetAccess drops the given objects from the access log, compacting it to
+// one entry for each of the others, without the repeated and stale entries
+// RecordAccess leaves. No entry recorded meanwhile by this process is lost.
+func ForgetAccess(oids []string) error {
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+
+	times, err := readAccessTimes()
+	if err != nil || len(times) == 0 {
+		return err
+	}
+	for _, oid := range oids {
+		delete(times, oid)
+	}
+	return writeAccessTimes(times)
+}
+
+// readAccessTimes is AccessTimes, with accessLogMu held.
+func readAccessTimes() (map[string]time.Time, error) {
+	times := make(map[string]time.Time)
+
+	f, err := os.Open(accessLogPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return times, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || !oidRE.MatchString(fields[0]) {
+			continue
+		}
+
+		secs, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if t := time.Unix(secs, 0); t.After(times[fields[0]]) {
+			times[fields[0]] = t
+		}
+	}
+	return times, scanner.Err()
+}
+
+// writeAccessTimes replaces the access log with one entry for each of the
+// given objects, with accessLogMu held.
+func writeAccessTimes(times map[string]time.Time) error {
+	oids := make([]string, 0, len(times))
+	for oid := range times {
+		oids = append(oids, oid)
+	}
+	sort.Strings(oids)
+
+	path := accessLogPath()
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "access")
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	for _, oid := range oids {
+		fmt.Fprintf(w, "%s %d\n", oid, times[oid].Unix())
+	}
+	if err = w.Flush(); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
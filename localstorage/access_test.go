@@ -0,0 +1,56 @@
+package localstorage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAccessConcurrently(t *testing.T) {
+	dir, err := ioutil.TempDir("", "access")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, os.MkdirAll(filepath.Join(dir, "lfs"), 0755))
+
+	oldStorageDir := config.LocalGitStorageDir
+	config.LocalGitStorageDir = dir
+	defer func() { config.LocalGitStorageDir = oldStorageDir }()
+
+	oids := make([]string, 50)
+	for i := range oids {
+		oids[i] = oidOf([]byte(fmt.Sprintf("object %d", i)))
+	}
+
+	var wg sync.WaitGroup
+	for _, oid := range oids {
+		wg.Add(1)
+		go func(oid string) {
+			defer wg.Done()
+			assert.Nil(t, RecordAccess(oid))
+		}(oid)
+	}
+
+	// the log is compacted while the objects are recorded
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Nil(t, ForgetAccess([]string{oids[0]}))
+	}()
+	wg.Wait()
+	require.Nil(t, ForgetAccess([]string{oids[0]}))
+
+	times, err := AccessTimes()
+	require.Nil(t, err)
+	assert.Len(t, times, len(oids)-1)
+	for _, oid := range oids[1:] {
+		_, ok := times[oid]
+		assert.True(t, ok, "no access time for %s", oid)
+	}
+}
@@ -0,0 +1,193 @@
+package localstorage
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/rubyist/tracerx"
+)
+
+// checksumsCompactLines is the fewest lines the checksum database is rewritten
+// at, once at least half of them have been replaced by later entries.
+const checksumsCompactLines = 1000
+
+// checksumsPath returns the path of the checksum database of the current
+// working tree. Unlike the access log, it lives in the git dir of each
+// worktree, as the files it describes belong to one.
+func checksumsPath() string {
+	return filepath.Join(config.LocalGitDir, "lfs", "checksums")
+}
+
+// checksumEntry is the object a working tree file held when it had the given
+// size and modification time, and when that was recorded, in nanoseconds since
+// the epoch.
+type checksumEntry struct {
+	oid      string
+	size     int64
+	modTime  int64
+	recorded int64
+}
+
+// Checksums is the database of the objects held by the files in a working
+// tree, with their size and modification time when they did, so that whether a
+// file still holds its object can be found from its stat info without hashing
+// it. Entries are appended as "<oid> <size> <mtime> <recorded> <path>" lines,
+// so that concurrent processes don't need to lock it; the latest entry for a
+// path wins.
+type Checksums struct {
+	entries map[string]*checksumEntry
+	mu      sync.Mutex
+}
+
+// ReadChecksums reads the checksum database of the current working tree.
+// Malformed lines are ignored, and the database is rewritten without the
+// entries later ones replaced once there are enough of them.
+func ReadChecksums() (*Checksums, error) {
+	c := &Checksums{entries: make(map[string]*checksumEntry)}
+	if len(config.LocalGitDir) == 0 {
+		return c, nil
+	}
+
+	f, err := os.Open(checksumsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+
+		fields := strings.SplitN(scanner.Text(), " ", 5)
+		if len(fields) != 5 || !oidRE.MatchString(fields[0]) || len(fields[4]) == 0 {
+			continue
+		}
+
+		e := &checksumEntry{oid: fields[0]}
+		if e.size, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+			continue
+		}
+		if e.modTime, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+			continue
+		}
+		if e.recorded, err = strconv.ParseInt(fields[3], 10, 64); err != nil {
+			continue
+		}
+		c.entries[fields[4]] = e
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if lines >= checksumsCompactLines && lines >= 2*len(c.entries) {
+		if err := c.write(); err != nil {
+			tracerx.Printf("checksums: unable to compact: %s", err)
+		}
+	}
+	return c, nil
+}
+
+// Lookup returns the object recorded for the file at the given path, relative
+// to the root of the working tree, if it's unchanged since, as given by its
+// stat info. Entries recorded in the same second the file was last modified
+// aren't trusted, as it may have been modified again since without its
+// modification time changing, on file systems which keep it to the second.
+func (c *Checksums) Lookup(path string, fi os.FileInfo) (string, bool) {
+	c.mu.Lock()
+	e, ok := c.entries[filepath.ToSlash(path)]
+	c.mu.Unlock()
+
+	if !ok || !fi.Mode().IsRegular() || fi.Size() != e.size || fi.ModTime().UnixNano() != e.modTime {
+		return "", false
+	}
+	if fi.ModTime().Unix() >= time.Unix(0, e.recorded).Unix() {
+		return "", false
+	}
+	return e.oid, true
+}
+
+// Record notes that the file at the given path, relative to the root of the
+// working tree, held the object with the given oid when it had the given stat
+// info.
+func (c *Checksums) Record(path string, fi os.FileInfo, oid string) error {
+	path = filepath.ToSlash(path)
+	if len(config.LocalGitDir) == 0 || !fi.Mode().IsRegular() || strings.ContainsAny(path, "\r\n") {
+		return nil
+	}
+
+	e := &checksumEntry{
+		oid:      oid,
+		size:     fi.Size(),
+		modTime:  fi.ModTime().UnixNano(),
+		recorded: time.Now().UnixNano(),
+	}
+
+	c.mu.Lock()
+	c.entries[path] = e
+	c.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(checksumsPath()), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(checksumsPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s %d %d %d %s\n", e.oid, e.size, e.modTime, e.recorded, path)
+	return err
+}
+
+// write replaces the checksum database with one entry for each path, as
+// ForgetAccess does the access log.
+func (c *Checksums) write() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	paths := make([]string, 0, len(c.entries))
+	for path := range c.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	path := checksumsPath()
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "checksums")
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	for _, p := range paths {
+		e := c.entries[p]
+		fmt.Fprintf(w, "%s %d %d %d %s\n", e.oid, e.size, e.modTime, e.recorded, p)
+	}
+	if err = w.Flush(); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
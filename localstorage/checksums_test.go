@@ -0,0 +1,97 @@
+package localstorage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checksums")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	oldGitDir := config.LocalGitDir
+	config.LocalGitDir = filepath.Join(dir, ".git")
+	defer func() { config.LocalGitDir = oldGitDir }()
+
+	writeFile := func(name, data string, age time.Duration) os.FileInfo {
+		path := filepath.Join(dir, name)
+		require.Nil(t, ioutil.WriteFile(path, []byte(data), 0644))
+		mtime := time.Now().Add(-age)
+		require.Nil(t, os.Chtimes(path, mtime, mtime))
+		fi, err := os.Stat(path)
+		require.Nil(t, err)
+		return fi
+	}
+
+	c, err := ReadChecksums()
+	require.Nil(t, err)
+
+	old := writeFile("old.dat", "old", time.Hour)
+	oldOid := oidOf([]byte("old"))
+	require.Nil(t, c.Record("dir/old file.dat", old, oldOid))
+
+	// the file was just written, so may be written again within the same
+	// second without its modification time changing
+	recent := writeFile("recent.dat", "recent", 0)
+	require.Nil(t, c.Record("recent.dat", recent, oidOf([]byte("recent"))))
+
+	c, err = ReadChecksums()
+	require.Nil(t, err)
+
+	oid, ok := c.Lookup("dir/old file.dat", old)
+	assert.True(t, ok)
+	assert.Equal(t, oldOid, oid)
+
+	_, ok = c.Lookup("recent.dat", recent)
+	assert.False(t, ok)
+	_, ok = c.Lookup("missing.dat", old)
+	assert.False(t, ok)
+
+	// changing the file's size or modification time changes it
+	_, ok = c.Lookup("dir/old file.dat", writeFile("old.dat", "new", 2*time.Hour))
+	assert.False(t, ok)
+	_, ok = c.Lookup("dir/old file.dat", writeFile("old.dat", "older", time.Hour))
+	assert.False(t, ok)
+}
+
+func TestChecksumsCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checksums")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	oldGitDir := config.LocalGitDir
+	config.LocalGitDir = dir
+	defer func() { config.LocalGitDir = oldGitDir }()
+
+	path := filepath.Join(dir, "file.dat")
+	require.Nil(t, ioutil.WriteFile(path, []byte("file"), 0644))
+	mtime := time.Now().Add(-time.Hour)
+	require.Nil(t, os.Chtimes(path, mtime, mtime))
+	fi, err := os.Stat(path)
+	require.Nil(t, err)
+
+	c, err := ReadChecksums()
+	require.Nil(t, err)
+	for i := 0; i < checksumsCompactLines; i++ {
+		require.Nil(t, c.Record("file.dat", fi, oidOf([]byte("file"))))
+	}
+
+	c, err = ReadChecksums()
+	require.Nil(t, err)
+	oid, ok := c.Lookup("file.dat", fi)
+	assert.True(t, ok)
+	assert.Equal(t, oidOf([]byte("file")), oid)
+
+	by, err := ioutil.ReadFile(checksumsPath())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, strings.Count(string(by), "\n"))
+}
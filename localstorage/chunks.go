@@ -0,0 +1,452 @@
+package localstorage
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/tools"
+)
+
+var (
+	// MinChunkSize, AvgChunkSize and MaxChunkSize bound the sizes of the
+	// content-defined chunks objects are split into. Changing them changes
+	// where objects are split, so they must match those of the server for
+	// chunked transfers to share chunks.
+	MinChunkSize = 16 * 1024
+	AvgChunkSize = 64 * 1024
+	MaxChunkSize = 256 * 1024
+
+	// gearTable holds a pseudo-random number for each byte value, which the
+	// rolling hash of SplitChunks adds up.
+	gearTable [256]uint64
+)
+
+func init() {
+	// splitmix64, with a fixed seed so that every client and server splits
+	// objects the same way.
+	x := uint64(0x6c66732d6368756e)
+	for i := range gearTable {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gearTable[i] = z ^ (z >> 31)
+	}
+}
+
+// Chunk is a piece of an object in the chunk store, named by the SHA-256 of its
+// contents like the object itself.
+type Chunk struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// SplitChunks splits the data read from r into content-defined chunks, calling
+// fn with each in turn. Chunk boundaries are found with a rolling hash of the
+// data before them, so that inserting or removing bytes in one part of an
+// object only changes the chunks around it, and near-identical versions of an
+// object share most of their chunks. The data given to fn is only valid until
+// it returns.
+func SplitChunks(r io.Reader, fn func(data []byte) error) error {
+	mask := chunkMask(AvgChunkSize)
+	buf := make([]byte, 0, MaxChunkSize)
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	var h uint64
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		buf = append(buf, b)
+		h = (h << 1) + gearTable[b]
+
+		if (len(buf) >= MinChunkSize && h&mask == 0) || len(buf) >= MaxChunkSize {
+			if err := fn(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+			h = 0
+		}
+	}
+
+	if len(buf) > 0 {
+		return fn(buf)
+	}
+	return nil
+}
+
+// chunkMask returns the mask of the rolling hash bits which must all be zero at
+// a chunk boundary for chunks to average the given size.
+func chunkMask(avg int) uint64 {
+	var bits uint
+	for 1<<(bits+1) <= avg {
+		bits++
+	}
+	return uint64(1)<<bits - 1
+}
+
+// ChunkStore stores objects locally as the content-defined chunks they are made
+// up of, each of which is stored once however many objects share it. An object
+// is recorded in a manifest, listing its chunks in order.
+type ChunkStore struct {
+	RootDir string
+}
+
+func NewChunkStore(rootDir string) *ChunkStore {
+	return &ChunkStore{RootDir: rootDir}
+}
+
+func (s *ChunkStore) chunkPath(oid string) string {
+	return filepath.Join(s.RootDir, oid[0:2], oid[2:4], oid)
+}
+
+func (s *ChunkStore) manifestDir() string {
+	return filepath.Join(s.RootDir, "manifests")
+}
+
+func (s *ChunkStore) manifestPath(oid string) string {
+	return filepath.Join(s.manifestDir(), oid[0:2], oid[2:4], oid)
+}
+
+// HasChunk returns whether the chunk with the given OID and size is stored.
+func (s *ChunkStore) HasChunk(oid string, size int64) bool {
+	return tools.FileExistsOfSize(s.chunkPath(oid), size)
+}
+
+// WriteChunk stores the given chunk data, unless the chunk is stored already.
+// It returns an error if the data doesn't have the given OID.
+func (s *ChunkStore) WriteChunk(oid string, data []byte) error {
+	if s.HasChunk(oid, int64(len(data))) {
+		return nil
+	}
+
+	h := tools.NewLfsContentHash()
+	h.Write(data)
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != oid {
+		return fmt.Errorf("chunk %s has unexpected contents %s", oid, actual)
+	}
+
+	path := s.chunkPath(oid)
+	if err := writeFileAtomically(path, data, 0644); err != nil {
+		return err
+	}
+	return ProtectObject(path)
+}
+
+// OpenChunk opens the chunk with the given OID for reading.
+func (s *ChunkStore) OpenChunk(oid string) (*os.File, error) {
+	return os.Open(s.chunkPath(oid))
+}
+
+// Store splits the object with the given OID read from r into chunks, stores
+// those which aren't stored already and writes the object's manifest. If the
+// data read doesn't have the given OID, no manifest is written.
+func (s *ChunkStore) Store(oid string, r io.Reader) ([]Chunk, error) {
+	var chunks []Chunk
+	objectHash := tools.NewLfsContentHash()
+
+	err := SplitChunks(r, func(data []byte) error {
+		objectHash.Write(data)
+
+		h := tools.NewLfsContentHash()
+		h.Write(data)
+		chunk := Chunk{Oid: hex.EncodeToString(h.Sum(nil)), Size: int64(len(data))}
+		if err := s.WriteChunk(chunk.Oid, data); err != nil {
+			return err
+		}
+
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if actual := hex.EncodeToString(objectHash.Sum(nil)); actual != oid {
+		return nil, fmt.Errorf("object %s has unexpected contents %s", oid, actual)
+	}
+	return chunks, s.WriteManifest(oid, chunks)
+}
+
+// WriteManifest records that the object with the given OID is made up of the
+// given chunks, which must all be stored already.
+func (s *ChunkStore) WriteManifest(oid string, chunks []Chunk) error {
+	var buf []byte
+	for _, c := range chunks {
+		if !s.HasChunk(c.Oid, c.Size) {
+			return fmt.Errorf("chunk %s of object %s is not stored", c.Oid, oid)
+		}
+		buf = append(buf, fmt.Sprintf("%s %d\n", c.Oid, c.Size)...)
+	}
+
+	return writeFileAtomically(s.manifestPath(oid), buf, 0644)
+}
+
+// Manifest returns the chunks the object with the given OID is made up of, in
+// order.
+func (s *ChunkStore) Manifest(oid string) ([]Chunk, error) {
+	f, err := os.Open(s.manifestPath(oid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var chunks []Chunk
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || !oidRE.MatchString(fields[0]) {
+			return nil, fmt.Errorf("invalid manifest for %s: %q", oid, scanner.Text())
+		}
+
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid manifest for %s: %q", oid, scanner.Text())
+		}
+		chunks = append(chunks, Chunk{Oid: fields[0], Size: size})
+	}
+	return chunks, scanner.Err()
+}
+
+// Stat returns the info of the manifest of the object with the given OID, whose
+// modification time is when the object was stored.
+func (s *ChunkStore) Stat(oid string) (os.FileInfo, error) {
+	return os.Stat(s.manifestPath(oid))
+}
+
+// Size returns the size of the object with the given OID, and whether it is
+// stored as chunks, all of which are present.
+func (s *ChunkStore) Size(oid string) (int64, bool) {
+	chunks, err := s.Manifest(oid)
+	if err != nil {
+		return 0, false
+	}
+
+	var total int64
+	for _, c := range chunks {
+		if !s.HasChunk(c.Oid, c.Size) {
+			return 0, false
+		}
+		total += c.Size
+	}
+	return total, true
+}
+
+// Has returns whether the object with the given OID and size is stored as
+// chunks, all of which are present.
+func (s *ChunkStore) Has(oid string, size int64) bool {
+	total, ok := s.Size(oid)
+	return ok && total == size
+}
+
+// Open returns a reader of the contents of the object with the given OID,
+// reassembled from its chunks. The reader returns an error at the end of the
+// object, rather than io.EOF, if the contents don't have the OID.
+func (s *ChunkStore) Open(oid string) (io.ReadCloser, error) {
+	chunks, err := s.Manifest(oid)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkReader{store: s, oid: oid, chunks: chunks, hash: tools.NewLfsContentHash()}, nil
+}
+
+// Reconstruct writes the object with the given OID, reassembled from its
+// chunks, to the given path, such as that of the object in the object store.
+func (s *ChunkStore) Reconstruct(oid, path string) error {
+	r, err := s.Open(oid)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), dirPerms); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrapf(err, "reconstruct %s", oid)
+	}
+	return ProtectObject(path)
+}
+
+// Remove deletes the manifest of the object with the given OID. Its chunks are
+// left for PruneChunks, as other objects may share them.
+func (s *ChunkStore) Remove(oid string) error {
+	err := os.Remove(s.manifestPath(oid))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Objects returns the objects stored as chunks.
+func (s *ChunkStore) Objects() []Object {
+	var objects []Object
+
+	filepath.Walk(s.manifestDir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !oidRE.MatchString(info.Name()) {
+			return nil
+		}
+
+		chunks, err := s.Manifest(info.Name())
+		if err != nil {
+			return nil
+		}
+
+		o := Object{Oid: info.Name()}
+		for _, c := range chunks {
+			o.Size += c.Size
+		}
+		objects = append(objects, o)
+		return nil
+	})
+
+	return objects
+}
+
+// PruneChunks deletes the chunks which no object's manifest lists, returning
+// how many were deleted and their total size.
+func (s *ChunkStore) PruneChunks() (int, int64, error) {
+	referenced := tools.NewStringSet()
+	for _, o := range s.Objects() {
+		chunks, err := s.Manifest(o.Oid)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, c := range chunks {
+			referenced.Add(c.Oid)
+		}
+	}
+
+	var count int
+	var size int64
+	err := filepath.Walk(s.RootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path == s.manifestDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !oidRE.MatchString(info.Name()) || referenced.Contains(info.Name()) {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		count++
+		size += info.Size()
+		return nil
+	})
+	return count, size, err
+}
+
+// chunkReader reads an object from its chunks in turn, checking the OID of its
+// contents at the end.
+type chunkReader struct {
+	store  *ChunkStore
+	oid    string
+	chunks []Chunk
+	cur    *os.File
+	hash   hash.Hash
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.chunks) == 0 {
+				if actual := hex.EncodeToString(r.hash.Sum(nil)); actual != r.oid {
+					return 0, fmt.Errorf("chunks of object %s have unexpected contents %s", r.oid, actual)
+				}
+				return 0, io.EOF
+			}
+
+			f, err := r.store.OpenChunk(r.chunks[0].Oid)
+			if err != nil {
+				return 0, err
+			}
+			r.cur = f
+			r.chunks = r.chunks[1:]
+		}
+
+		n, err := r.cur.Read(p)
+		r.hash.Write(p[:n])
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
+
+// writeFileAtomically writes data to the file at path by way of a temporary
+// file next to it, so that readers never see it partially written.
+func writeFileAtomically(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, dirPerms); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,193 @@
+package localstorage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func randomData(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func oidOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func splitOids(t *testing.T, data []byte) []string {
+	var oids []string
+	var joined []byte
+	err := SplitChunks(bytes.NewReader(data), func(chunk []byte) error {
+		assert.True(t, len(chunk) <= MaxChunkSize)
+		oids = append(oids, oidOf(chunk))
+		joined = append(joined, chunk...)
+		return nil
+	})
+	require.Nil(t, err)
+	assert.Equal(t, data, joined)
+	return oids
+}
+
+func TestSplitChunksIsContentDefined(t *testing.T) {
+	data := randomData(1, 2*1024*1024)
+	edited := append(append(append([]byte{}, data[:1000000]...), []byte("inserted bytes")...), data[1000000:]...)
+
+	before := splitOids(t, data)
+	after := splitOids(t, edited)
+	assert.True(t, len(before) > 8, "expected more chunks, got %d", len(before))
+
+	shared := 0
+	seen := make(map[string]bool)
+	for _, oid := range before {
+		seen[oid] = true
+	}
+	for _, oid := range after {
+		if seen[oid] {
+			shared++
+		}
+	}
+	assert.True(t, shared >= len(before)-2, "only %d of %d chunks shared", shared, len(before))
+}
+
+func TestSplitChunksEmpty(t *testing.T) {
+	assert.Empty(t, splitOids(t, nil))
+}
+
+func newTestChunkStore(t *testing.T) (*ChunkStore, func()) {
+	dir, err := ioutil.TempDir("", "chunkstore")
+	require.Nil(t, err)
+	return NewChunkStore(filepath.Join(dir, "chunks")), func() {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil {
+				os.Chmod(path, 0755)
+			}
+			return nil
+		})
+		os.RemoveAll(dir)
+	}
+}
+
+func TestChunkStoreStoresSharedChunksOnce(t *testing.T) {
+	s, cleanup := newTestChunkStore(t)
+	defer cleanup()
+
+	data := randomData(2, 1024*1024)
+	edited := append(append([]byte{}, data...), []byte("appended")...)
+	oid, editedOid := oidOf(data), oidOf(edited)
+
+	chunks, err := s.Store(oid, bytes.NewReader(data))
+	require.Nil(t, err)
+	editedChunks, err := s.Store(editedOid, bytes.NewReader(edited))
+	require.Nil(t, err)
+
+	assert.True(t, s.Has(oid, int64(len(data))))
+	assert.True(t, s.Has(editedOid, int64(len(edited))))
+	assert.False(t, s.Has(oid, int64(len(edited))))
+
+	size, ok := s.Size(editedOid)
+	assert.True(t, ok)
+	assert.Equal(t, int64(len(edited)), size)
+
+	manifest, err := s.Manifest(oid)
+	require.Nil(t, err)
+	assert.Equal(t, chunks, manifest)
+
+	unique := make(map[string]bool)
+	for _, c := range append(chunks, editedChunks...) {
+		unique[c.Oid] = true
+	}
+	assert.True(t, len(unique) <= len(chunks)+1, "%d chunks stored for %d", len(unique), len(chunks))
+
+	r, err := s.Open(editedOid)
+	require.Nil(t, err)
+	read, err := ioutil.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, edited, read)
+
+	assert.Len(t, s.Objects(), 2)
+}
+
+func TestChunkStoreStoreChecksOid(t *testing.T) {
+	s, cleanup := newTestChunkStore(t)
+	defer cleanup()
+
+	oid := oidOf([]byte("expected"))
+	_, err := s.Store(oid, bytes.NewReader([]byte("actual")))
+	assert.NotNil(t, err)
+	assert.False(t, s.Has(oid, 6))
+}
+
+func TestChunkStoreReconstruct(t *testing.T) {
+	s, cleanup := newTestChunkStore(t)
+	defer cleanup()
+
+	data := randomData(3, 300*1024)
+	oid := oidOf(data)
+	_, err := s.Store(oid, bytes.NewReader(data))
+	require.Nil(t, err)
+
+	path := filepath.Join(filepath.Dir(s.RootDir), "objects", oid[0:2], oid[2:4], oid)
+	require.Nil(t, s.Reconstruct(oid, path))
+
+	by, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, data, by)
+}
+
+func TestChunkStoreOpenDetectsCorruptChunks(t *testing.T) {
+	s, cleanup := newTestChunkStore(t)
+	defer cleanup()
+
+	data := randomData(4, 100*1024)
+	oid := oidOf(data)
+	chunks, err := s.Store(oid, bytes.NewReader(data))
+	require.Nil(t, err)
+
+	path := s.chunkPath(chunks[0].Oid)
+	require.Nil(t, os.Chmod(path, 0644))
+	require.Nil(t, ioutil.WriteFile(path, make([]byte, chunks[0].Size), 0644))
+
+	r, err := s.Open(oid)
+	require.Nil(t, err)
+	_, err = ioutil.ReadAll(r)
+	r.Close()
+	assert.NotNil(t, err)
+}
+
+func TestChunkStorePruneChunks(t *testing.T) {
+	s, cleanup := newTestChunkStore(t)
+	defer cleanup()
+
+	kept := randomData(5, 200*1024)
+	removed := randomData(6, 200*1024)
+	keptChunks, err := s.Store(oidOf(kept), bytes.NewReader(kept))
+	require.Nil(t, err)
+	removedChunks, err := s.Store(oidOf(removed), bytes.NewReader(removed))
+	require.Nil(t, err)
+
+	require.Nil(t, s.Remove(oidOf(removed)))
+	count, size, err := s.PruneChunks()
+	assert.Nil(t, err)
+	assert.Equal(t, len(removedChunks), count)
+	assert.Equal(t, int64(len(removed)), size)
+
+	for _, c := range keptChunks {
+		assert.True(t, s.HasChunk(c.Oid, c.Size))
+	}
+	for _, c := range removedChunks {
+		assert.False(t, s.HasChunk(c.Oid, c.Size))
+	}
+	assert.True(t, s.Has(oidOf(kept), int64(len(kept))))
+}
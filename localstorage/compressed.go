@@ -0,0 +1,382 @@
+package localstorage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	compressedExt = ".zst"
+	zstdMagic     = 0xFD2FB528
+)
+
+// ZstdCommand is the zstd executable objects are compressed and decompressed
+// with.
+var ZstdCommand = "zstd"
+
+// ErrZstdNotFound is returned by CompressObject when ZstdCommand can't be
+// found, so that objects are stored uncompressed.
+var ErrZstdNotFound = errors.New("lfs.storagecompression is set to zstd, but the zstd program wasn't found; install zstd, or unset lfs.storagecompression")
+
+// zstdNotFoundOnce warns that objects are stored uncompressed as zstd can't be
+// found once, rather than for each object.
+var zstdNotFoundOnce sync.Once
+
+// CompressedStore stores objects locally compressed with zstd, as a frame
+// recording the size of the object, so that whether an object of a given size
+// is stored can be told without decompressing it.
+type CompressedStore struct {
+	RootDir string
+}
+
+func NewCompressedStore(rootDir string) *CompressedStore {
+	return &CompressedStore{RootDir: rootDir}
+}
+
+func (s *CompressedStore) path(oid string) string {
+	return filepath.Join(s.RootDir, oid[0:2], oid[2:4], oid+compressedExt)
+}
+
+// Compress stores a compressed copy of the object with the given OID from the
+// file at the given path, such as that of the object in the object store. It
+// returns false, storing nothing, if compressing the object doesn't make it
+// smaller, as is the case for formats which are compressed already.
+func (s *CompressedStore) Compress(oid, path string) (bool, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	dest := s.path(oid)
+	if err := os.MkdirAll(filepath.Dir(dest), dirPerms); err != nil {
+		return false, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dest), "tmp-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	var stderr bytes.Buffer
+	cmd := subprocess.ExecCommand(ZstdCommand, "-q", "-c", "--", path)
+	cmd.Stdout = tmp
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, zstdError(err, stderr.String(), "compress %s", oid)
+	}
+
+	compressed, err := os.Stat(tmp.Name())
+	if err != nil {
+		return false, err
+	}
+	if compressed.Size() >= stat.Size() {
+		return false, nil
+	}
+
+	if size, ok := s.Size(oid); ok && size == stat.Size() {
+		return true, nil
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return false, err
+	}
+	return true, ProtectObject(dest)
+}
+
+// CompressObject stores the whole object with the given OID compressed, and
+// then deletes it from the object store, if lfs.storagecompression is set and
+// the file with the given name isn't excluded from it. It does nothing if the
+// object isn't stored whole, or if compressing it doesn't make it smaller, or
+// if lfs.chunkstore is set, as objects are stored as chunks then. It returns
+// ErrZstdNotFound, warning about it the first time, if zstd isn't installed.
+func CompressObject(cfg *config.Configuration, oid, name string) error {
+	if cfg.StorageCompression() == config.StorageCompressionNone || cfg.ChunkStore() || compressed == nil || objects == nil {
+		return nil
+	}
+	if cfg.StorageCompressionExcluded(name) {
+		tracerx.Printf("not compressing %s, as %s is excluded", oid, name)
+		return nil
+	}
+
+	mediafile := objects.ObjectPath(oid)
+	if !tools.FileExists(mediafile) {
+		return nil
+	}
+
+	if _, err := exec.LookPath(ZstdCommand); err != nil {
+		zstdNotFoundOnce.Do(func() {
+			fmt.Fprintf(os.Stderr, "WARNING: %s; storing objects uncompressed\n", ErrZstdNotFound)
+		})
+		return ErrZstdNotFound
+	}
+
+	ok, err := compressed.Compress(oid, mediafile)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		tracerx.Printf("not compressing %s, as it doesn't get any smaller", oid)
+		return nil
+	}
+	return os.Remove(mediafile)
+}
+
+// Stat returns the info of the compressed file of the object with the given
+// OID, whose modification time is when the object was stored.
+func (s *CompressedStore) Stat(oid string) (os.FileInfo, error) {
+	return os.Stat(s.path(oid))
+}
+
+// Size returns the size of the object with the given OID, as recorded in its
+// compressed file, and whether it is stored compressed.
+func (s *CompressedStore) Size(oid string) (int64, bool) {
+	f, err := os.Open(s.path(oid))
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	size, err := zstdContentSize(f)
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+// Has returns whether the object with the given OID and size is stored
+// compressed.
+func (s *CompressedStore) Has(oid string, size int64) bool {
+	actual, ok := s.Size(oid)
+	return ok && actual == size
+}
+
+// Open returns a reader of the decompressed contents of the object with the
+// given OID. The reader returns an error at the end of the object, rather than
+// io.EOF, if the contents don't have the OID.
+func (s *CompressedStore) Open(oid string) (io.ReadCloser, error) {
+	path := s.path(oid)
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	r := &decompressReader{oid: oid, hash: tools.NewLfsContentHash()}
+	r.cmd = subprocess.ExecCommand(ZstdCommand, "-d", "-q", "-c", "--", path)
+	r.cmd.Stderr = &r.stderr
+
+	out, err := r.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	r.out = out
+
+	if err := r.cmd.Start(); err != nil {
+		return nil, zstdError(err, "", "decompress %s", oid)
+	}
+	return r, nil
+}
+
+// Decompress writes the decompressed object with the given OID to the given
+// path, such as that of the object in the object store.
+func (s *CompressedStore) Decompress(oid, path string) error {
+	r, err := s.Open(oid)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), dirPerms); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrapf(err, "decompress %s", oid)
+	}
+	return ProtectObject(path)
+}
+
+// Remove deletes the compressed file of the object with the given OID.
+func (s *CompressedStore) Remove(oid string) error {
+	err := os.Remove(s.path(oid))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Objects returns the objects stored compressed.
+func (s *CompressedStore) Objects() []Object {
+	var objects []Object
+
+	filepath.Walk(s.RootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(info.Name(), compressedExt) {
+			return nil
+		}
+
+		oid := strings.TrimSuffix(info.Name(), compressedExt)
+		if len(oid) != 64 || !oidRE.MatchString(oid) {
+			return nil
+		}
+
+		if size, ok := s.Size(oid); ok {
+			objects = append(objects, Object{Oid: oid, Size: size})
+		}
+		return nil
+	})
+
+	return objects
+}
+
+// zstdContentSize returns the size of the contents of the zstd frame read from
+// r, from the frame header. It returns an error if the header doesn't record
+// the size, as when the frame was written by a streaming compressor.
+func zstdContentSize(r io.Reader) (int64, error) {
+	// magic number, frame header descriptor, window descriptor, dictionary
+	// ID and frame content size, at most
+	var header [4 + 1 + 1 + 4 + 8]byte
+	n, err := io.ReadFull(r, header[:])
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	buf := header[:n]
+
+	if len(buf) < 5 || binary.LittleEndian.Uint32(buf) != zstdMagic {
+		return 0, errors.New("not a zstd frame")
+	}
+
+	descriptor := buf[4]
+	singleSegment := descriptor&0x20 != 0
+	pos := 5
+	if !singleSegment {
+		pos++
+	}
+	pos += []int{0, 1, 2, 4}[descriptor&0x03]
+
+	var sizeLen int
+	switch descriptor >> 6 {
+	case 0:
+		if singleSegment {
+			sizeLen = 1
+		}
+	case 1:
+		sizeLen = 2
+	case 2:
+		sizeLen = 4
+	case 3:
+		sizeLen = 8
+	}
+	if sizeLen == 0 {
+		return 0, errors.New("zstd frame doesn't record its content size")
+	}
+	if len(buf) < pos+sizeLen {
+		return 0, errors.New("truncated zstd frame header")
+	}
+
+	field := buf[pos : pos+sizeLen]
+	switch sizeLen {
+	case 1:
+		return int64(field[0]), nil
+	case 2:
+		return int64(binary.LittleEndian.Uint16(field)) + 256, nil
+	case 4:
+		return int64(binary.LittleEndian.Uint32(field)), nil
+	default:
+		return int64(binary.LittleEndian.Uint64(field)), nil
+	}
+}
+
+// zstdError describes a failure to run zstd, including what it printed to
+// stderr, if anything.
+func zstdError(err error, stderr string, format string, args ...interface{}) error {
+	if _, ok := err.(*exec.Error); ok {
+		return errors.Wrapf(err, "%s: the zstd program, which objects stored by lfs.storagecompression need, wasn't found", fmt.Sprintf(format, args...))
+	}
+	if stderr = strings.TrimSpace(stderr); len(stderr) > 0 {
+		err = fmt.Errorf("%v: %s", err, stderr)
+	}
+	return errors.Wrapf(err, format, args...)
+}
+
+// decompressReader reads an object from the output of zstd, checking the OID of
+// its contents at the end.
+type decompressReader struct {
+	oid    string
+	cmd    *exec.Cmd
+	out    io.ReadCloser
+	stderr bytes.Buffer
+	hash   hash.Hash
+	done   bool
+	err    error
+}
+
+func (r *decompressReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, r.err
+	}
+
+	n, err := r.out.Read(p)
+	r.hash.Write(p[:n])
+	if err != io.EOF {
+		return n, err
+	}
+
+	r.err = io.EOF
+	if werr := r.wait(); werr != nil {
+		r.err = zstdError(werr, r.stderr.String(), "decompress %s", r.oid)
+	} else if actual := hex.EncodeToString(r.hash.Sum(nil)); actual != r.oid {
+		r.err = fmt.Errorf("compressed object %s has unexpected contents %s", r.oid, actual)
+	}
+	return n, r.err
+}
+
+func (r *decompressReader) Close() error {
+	if r.done {
+		return nil
+	}
+	r.out.Close()
+	if r.cmd.Process != nil {
+		r.cmd.Process.Kill()
+	}
+	r.wait()
+	return nil
+}
+
+func (r *decompressReader) wait() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+	return r.cmd.Wait()
+}
@@ -0,0 +1,139 @@
+package localstorage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCompressedStore(t *testing.T) (*CompressedStore, string, func()) {
+	if _, err := exec.LookPath(ZstdCommand); err != nil {
+		t.Skip("zstd is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "compressedstore")
+	require.Nil(t, err)
+	return NewCompressedStore(filepath.Join(dir, "compressed")), dir, func() {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil {
+				os.Chmod(path, 0755)
+			}
+			return nil
+		})
+		os.RemoveAll(dir)
+	}
+}
+
+func writeTestObject(t *testing.T, dir string, data []byte) (string, string) {
+	oid := oidOf(data)
+	path := filepath.Join(dir, "objects", oid)
+	require.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.Nil(t, ioutil.WriteFile(path, data, 0644))
+	return oid, path
+}
+
+func TestCompressedStoreRoundTrip(t *testing.T) {
+	s, dir, cleanup := newTestCompressedStore(t)
+	defer cleanup()
+
+	data := bytes.Repeat([]byte("compressible contents "), 10000)
+	oid, path := writeTestObject(t, dir, data)
+
+	ok, err := s.Compress(oid, path)
+	require.Nil(t, err)
+	assert.True(t, ok)
+
+	stat, err := s.Stat(oid)
+	require.Nil(t, err)
+	assert.True(t, stat.Size() < int64(len(data)))
+
+	size, ok := s.Size(oid)
+	assert.True(t, ok)
+	assert.Equal(t, int64(len(data)), size)
+	assert.True(t, s.Has(oid, int64(len(data))))
+	assert.False(t, s.Has(oid, 1))
+
+	r, err := s.Open(oid)
+	require.Nil(t, err)
+	read, err := ioutil.ReadAll(r)
+	r.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, data, read)
+
+	out := filepath.Join(dir, "decompressed", oid)
+	require.Nil(t, s.Decompress(oid, out))
+	by, err := ioutil.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, data, by)
+
+	objects := s.Objects()
+	require.Len(t, objects, 1)
+	assert.Equal(t, Object{Oid: oid, Size: int64(len(data))}, objects[0])
+
+	require.Nil(t, s.Remove(oid))
+	assert.False(t, s.Has(oid, int64(len(data))))
+	assert.Empty(t, s.Objects())
+}
+
+func TestCompressedStoreSkipsIncompressibleObjects(t *testing.T) {
+	s, dir, cleanup := newTestCompressedStore(t)
+	defer cleanup()
+
+	oid, path := writeTestObject(t, dir, randomData(7, 64*1024))
+
+	ok, err := s.Compress(oid, path)
+	require.Nil(t, err)
+	assert.False(t, ok)
+	assert.Empty(t, s.Objects())
+}
+
+func TestCompressedStoreOpenDetectsCorruptObjects(t *testing.T) {
+	s, dir, cleanup := newTestCompressedStore(t)
+	defer cleanup()
+
+	data := bytes.Repeat([]byte("original"), 4096)
+	other := bytes.Repeat([]byte("modified"), 4096)
+	oid, path := writeTestObject(t, dir, data)
+	otherOid, otherPath := writeTestObject(t, dir, other)
+
+	_, err := s.Compress(oid, path)
+	require.Nil(t, err)
+	_, err = s.Compress(otherOid, otherPath)
+	require.Nil(t, err)
+	require.Nil(t, os.Chmod(s.path(oid), 0644))
+	require.Nil(t, os.Rename(s.path(otherOid), s.path(oid)))
+
+	r, err := s.Open(oid)
+	require.Nil(t, err)
+	_, err = ioutil.ReadAll(r)
+	r.Close()
+	assert.NotNil(t, err)
+}
+
+func TestZstdContentSize(t *testing.T) {
+	for desc, c := range map[string]struct {
+		header []byte
+		size   int64
+	}{
+		"single segment, 1 byte": {[]byte{0x28, 0xb5, 0x2f, 0xfd, 0x20, 0x2a}, 42},
+		"2 bytes":                {[]byte{0x28, 0xb5, 0x2f, 0xfd, 0x40, 0x58, 0x00, 0x01}, 256 + 256},
+		"4 bytes with dict id":   {[]byte{0x28, 0xb5, 0x2f, 0xfd, 0x81, 0x58, 0x07, 0x00, 0x00, 0x01, 0x00}, 65536},
+		"8 bytes":                {[]byte{0x28, 0xb5, 0x2f, 0xfd, 0xe0, 0, 0, 0, 0, 1, 0, 0, 0}, 1 << 32},
+	} {
+		size, err := zstdContentSize(bytes.NewReader(c.header))
+		assert.Nil(t, err, desc)
+		assert.Equal(t, c.size, size, desc)
+	}
+
+	_, err := zstdContentSize(bytes.NewReader([]byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x58}))
+	assert.NotNil(t, err, "frame without content size")
+
+	_, err = zstdContentSize(bytes.NewReader([]byte("not zstd at all")))
+	assert.NotNil(t, err, "not a zstd frame")
+}
@@ -18,6 +18,8 @@ const (
 
 var (
 	objects        *LocalStorage
+	chunks         *ChunkStore
+	compressed     *CompressedStore
 	notInRepoErr   = errors.New("not in a repository")
 	TempDir        = filepath.Join(os.TempDir(), "git-lfs")
 	checkedTempDir string
@@ -27,6 +29,18 @@ func Objects() *LocalStorage {
 	return objects
 }
 
+// Chunks returns the store of the repository's objects kept as chunks, which is
+// used when "lfs.chunkstore" is set.
+func Chunks() *ChunkStore {
+	return chunks
+}
+
+// Compressed returns the store of the repository's objects kept compressed,
+// which is used when "lfs.storagecompression" is set.
+func Compressed() *CompressedStore {
+	return compressed
+}
+
 func InitStorage() error {
 	if len(config.LocalGitStorageDir) == 0 || len(config.LocalGitDir) == 0 {
 		return notInRepoErr
@@ -43,6 +57,8 @@ func InitStorage() error {
 	}
 
 	objects = objs
+	chunks = NewChunkStore(filepath.Join(config.LocalGitStorageDir, "lfs", "chunks"))
+	compressed = NewCompressedStore(filepath.Join(config.LocalGitStorageDir, "lfs", "compressed"))
 	config.LocalLogDir = filepath.Join(objs.RootDir, "logs")
 	if err := os.MkdirAll(config.LocalLogDir, localLogDirPerms); err != nil {
 		return errors.Wrap(err, "create log dir")
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 )
 
 const (
@@ -14,8 +15,9 @@ const (
 )
 
 var (
-	oidRE                = regexp.MustCompile(`\A[[:alnum:]]{64}`)
-	dirPerms os.FileMode = 0755
+	oidRE                   = regexp.MustCompile(`\A[[:alnum:]]{64}`)
+	dirPerms    os.FileMode = 0755
+	objectPerms os.FileMode = 0444
 )
 
 // LocalStorage manages the locally stored LFS objects for a repository.
@@ -42,6 +44,23 @@ func NewStorage(storageDir, tempDir string) (*LocalStorage, error) {
 	return &LocalStorage{storageDir, tempDir}, nil
 }
 
+// ProtectObject makes the object file at the given path read-only, so that
+// tools which modify files in place can't corrupt it through hard links to it,
+// such as those made by "lfs.checkoutmode=hardlink". It does nothing on
+// Windows, where read-only files can't be deleted.
+func ProtectObject(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	return os.Chmod(path, objectPerms)
+}
+
+// IsProtected returns whether the object file with the given info is read-only,
+// as ProtectObject makes it. It is always true on Windows.
+func IsProtected(info os.FileInfo) bool {
+	return runtime.GOOS == "windows" || info.Mode().Perm()&0222 == 0
+}
+
 func (s *LocalStorage) ObjectPath(oid string) string {
 	return filepath.Join(localObjectDir(s, oid), oid)
 }
@@ -6,28 +6,163 @@ import (
 	"strings"
 	"time"
 
+	"github.com/git-lfs/git-lfs/tools"
 	"github.com/rubyist/tracerx"
 )
 
+const (
+	// tempObjectRecoverAge is how long a finished download must have been
+	// left alone before RecoverTempObjects takes it, so that it isn't taken
+	// from under a process about to move it into the store itself.
+	tempObjectRecoverAge = time.Minute
+	// tempObjectAbandonAge is how long an unfinished download must have
+	// been left alone before it's taken to be abandoned, and deleted.
+	tempObjectAbandonAge = time.Hour
+)
+
 func (s *LocalStorage) ClearTempObjects() error {
+	_, _, err := s.ClearStaleTempObjects(false)
+	return err
+}
+
+// ClearStaleTempObjects deletes the temporary files of downloads which are
+// invalid, finished or were abandoned over an hour ago, returning how many
+// there were and their total size. With dryRun, nothing is deleted.
+func (s *LocalStorage) ClearStaleTempObjects(dryRun bool) (int, int64, error) {
 	if len(s.TempDir) == 0 {
-		return nil
+		return 0, 0, nil
 	}
 
 	d, err := os.Open(s.TempDir)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
+	defer d.Close()
 
+	var count int
+	var size int64
 	filenames, _ := d.Readdirnames(-1)
 	for _, filename := range filenames {
 		path := filepath.Join(s.TempDir, filename)
-		if shouldDeleteTempObject(s, path) {
-			os.RemoveAll(path)
+		info, err := os.Stat(path)
+		if err != nil || !shouldDeleteTempObject(s, path) {
+			continue
 		}
+
+		if !dryRun {
+			if err := os.RemoveAll(path); err != nil {
+				continue
+			}
+		}
+		count++
+		size += info.Size()
 	}
 
-	return nil
+	return count, size, nil
+}
+
+// RecoverTempObjects moves the temporary files of downloads left in dir, named
+// after the OIDs of their objects, into the store, so that the work of
+// processes which were interrupted after finishing a download, but before
+// storing it, isn't lost. Files which don't hash to their OIDs are deleted once
+// they've been abandoned. It returns how many objects were recovered and how
+// many files were deleted.
+func (s *LocalStorage) RecoverTempObjects(dir string) (int, int, error) {
+	d, err := os.Open(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+	filenames, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var recovered, deleted int
+	for _, filename := range filenames {
+		if !oidRE.MatchString(filename) {
+			continue
+		}
+
+		path := filepath.Join(dir, filename)
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || time.Since(info.ModTime()) < tempObjectRecoverAge {
+			continue
+		}
+
+		oid := filename[:64]
+		if fi, err := os.Stat(s.ObjectPath(oid)); err == nil && !fi.IsDir() {
+			tracerx.Printf("Removing existing tmp object file: %s", path)
+			if os.Remove(path) == nil {
+				deleted++
+			}
+			continue
+		}
+
+		if err := tools.VerifyFileHash(oid, path); err != nil {
+			if time.Since(info.ModTime()) > tempObjectAbandonAge {
+				tracerx.Printf("Removing abandoned tmp object file: %s", path)
+				if os.Remove(path) == nil {
+					deleted++
+				}
+			}
+			continue
+		}
+
+		dst, err := s.BuildObjectPath(oid)
+		if err != nil {
+			return recovered, deleted, err
+		}
+		if err := tools.RenameFileCopyPermissions(path, dst); err != nil {
+			return recovered, deleted, err
+		}
+		if err := ProtectObject(dst); err != nil {
+			return recovered, deleted, err
+		}
+		tracerx.Printf("Recovered tmp object file: %s", path)
+		recovered++
+	}
+
+	return recovered, deleted, nil
+}
+
+// ClearOrphanedTempFiles deletes the "tmp-" files older than the given age in
+// the given store directories, which are left behind when writes of objects
+// and chunks are interrupted, returning how many there were and their total
+// size. With dryRun, nothing is deleted.
+func ClearOrphanedTempFiles(dirs []string, age time.Duration, dryRun bool) (int, int64, error) {
+	var count int
+	var size int64
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() || !strings.HasPrefix(info.Name(), "tmp-") || time.Since(info.ModTime()) < age {
+				return nil
+			}
+
+			tracerx.Printf("Removing orphaned tmp file: %s", path)
+			if !dryRun {
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+			}
+			count++
+			size += info.Size()
+			return nil
+		})
+		if err != nil {
+			return count, size, err
+		}
+	}
+	return count, size, nil
 }
 
 func shouldDeleteTempObject(s *LocalStorage, path string) bool {
@@ -0,0 +1,71 @@
+package localstorage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverTempObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recovertemp")
+	require.Nil(t, err)
+	defer func() {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil {
+				os.Chmod(path, 0755)
+			}
+			return nil
+		})
+		os.RemoveAll(dir)
+	}()
+
+	s, err := NewStorage(filepath.Join(dir, "objects"), filepath.Join(dir, "tmp", "objects"))
+	require.Nil(t, err)
+	tmp := filepath.Join(dir, "tmp")
+
+	writeTemp := func(name, data string, age time.Duration) string {
+		path := filepath.Join(tmp, name)
+		require.Nil(t, ioutil.WriteFile(path, []byte(data), 0644))
+		mtime := time.Now().Add(-age)
+		require.Nil(t, os.Chtimes(path, mtime, mtime))
+		return path
+	}
+
+	finished := oidOf([]byte("finished"))
+	writeTemp(finished+"123", "finished", time.Hour)
+	recent := oidOf([]byte("recent"))
+	writeTemp(recent+"456", "recent", time.Second)
+	partial := writeTemp(oidOf([]byte("partial"))+"789", "part", 10*time.Minute)
+	abandoned := writeTemp(oidOf([]byte("abandoned"))+"012", "aband", 2*time.Hour)
+	other := writeTemp("345", "not a download", 2*time.Hour)
+
+	recovered, deleted, err := s.RecoverTempObjects(tmp)
+	require.Nil(t, err)
+	assert.Equal(t, 1, recovered)
+	assert.Equal(t, 1, deleted)
+
+	by, err := ioutil.ReadFile(s.ObjectPath(finished))
+	assert.Nil(t, err)
+	assert.Equal(t, "finished", string(by))
+	assert.False(t, fileExists(s.ObjectPath(recent)))
+	assert.True(t, fileExists(partial))
+	assert.False(t, fileExists(abandoned))
+	assert.True(t, fileExists(other))
+
+	// downloads of objects which are already stored are deleted
+	writeTemp(finished+"678", "finished", time.Hour)
+	recovered, deleted, err = s.RecoverTempObjects(tmp)
+	require.Nil(t, err)
+	assert.Equal(t, 0, recovered)
+	assert.Equal(t, 1, deleted)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
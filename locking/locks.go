@@ -5,14 +5,20 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/git-lfs/git-lfs/api"
 	"github.com/git-lfs/git-lfs/config"
 	"github.com/git-lfs/git-lfs/git"
 	"github.com/git-lfs/git-lfs/tools/kv"
+	"github.com/rubyist/tracerx"
 )
 
+// lockPageSize is the number of locks asked for in each page of a search, so
+// that servers with many locks needn't return all of them in one response.
+const lockPageSize = 100
+
 var (
 	// ErrNoMatchingLocks is an error returned when no matching locks were
 	// able to be resolved
@@ -58,6 +64,14 @@ func (c *Client) Close() error {
 // path must be relative to the root of the repository
 // Returns the lock id if successful, or an error
 func (c *Client) LockFile(path string) (Lock, error) {
+	return c.LockFileExpiring(path, 0)
+}
+
+// LockFileExpiring attempts to lock a file on the current remote, asking the
+// server to release the lock after expiresIn, if that's greater than zero.
+// Servers which don't support expiry lock the file regardless, and the
+// returned lock's ExpiresAt is nil.
+func (c *Client) LockFileExpiring(path string, expiresIn time.Duration) (Lock, error) {
 
 	// TODO: this is not really the constraint we need to avoid merges, improve as per proposal
 	latest, err := git.CurrentRemoteRef()
@@ -69,6 +83,7 @@ func (c *Client) LockFile(path string) (Lock, error) {
 		Path:               path,
 		Committer:          api.NewCommitter(c.cfg.CurrentCommitter()),
 		LatestRemoteCommit: latest.Sha,
+		ExpiresIn:          int(expiresIn / time.Second),
 	})
 
 	if _, err := c.apiClient.Do(s); err != nil {
@@ -136,15 +151,31 @@ type Lock struct {
 	Email string `json:"email"`
 	// LockedAt is the time at which this lock was acquired.
 	LockedAt time.Time `json:"locked_at"`
+	// ExpiresAt is the time at which the server will release this lock, or
+	// nil if it won't.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired returns whether l was due to be released by the server before now,
+// although the server still holds it.
+func (l Lock) Expired(now time.Time) bool {
+	return l.ExpiresAt != nil && l.ExpiresAt.Before(now)
+}
+
+// Stale returns whether l has expired, or was acquired before cutoff if cutoff
+// isn't zero, so that it has likely been abandoned.
+func (l Lock) Stale(now, cutoff time.Time) bool {
+	return l.Expired(now) || (!cutoff.IsZero() && l.LockedAt.Before(cutoff))
 }
 
 func (c *Client) newLockFromApi(a api.Lock) Lock {
 	return Lock{
-		Id:       a.Id,
-		Path:     a.Path,
-		Name:     a.Committer.Name,
-		Email:    a.Committer.Email,
-		LockedAt: a.LockedAt,
+		Id:        a.Id,
+		Path:      a.Path,
+		Name:      a.Committer.Name,
+		Email:     a.Committer.Email,
+		LockedAt:  a.LockedAt,
+		ExpiresAt: a.ExpiresAt,
 	}
 }
 
@@ -162,14 +193,11 @@ func (c *Client) SearchLocks(filter map[string]string, limit int, localOnly bool
 
 func (c *Client) searchCachedLocks(filter map[string]string, limit int) ([]Lock, error) {
 	cachedlocks := c.cache.Locks()
-	path, filterByPath := filter["path"]
-	id, filterById := filter["id"]
 	lockCount := 0
 	locks := make([]Lock, 0, len(cachedlocks))
 	for _, l := range cachedlocks {
 		// Manually filter by Path/Id
-		if (filterByPath && path != l.Path) ||
-			(filterById && id != l.Id) {
+		if !lockMatches(l, filter) {
 			continue
 		}
 		locks = append(locks, l)
@@ -190,6 +218,7 @@ func (c *Client) searchRemoteLocks(filter map[string]string, limit int) ([]Lock,
 	}
 	query := &api.LockSearchRequest{Filters: apifilters}
 	for {
+		query.Limit = pageLimit(limit, len(locks))
 		s, resp := c.apiClient.Locks.Search(query)
 		if _, err := c.apiClient.Do(s); err != nil {
 			return locks, fmt.Errorf("Error communicating with LFS API: %v", err)
@@ -200,7 +229,14 @@ func (c *Client) searchRemoteLocks(filter map[string]string, limit int) ([]Lock,
 		}
 
 		for _, l := range resp.Locks {
-			locks = append(locks, c.newLockFromApi(l))
+			lock := c.newLockFromApi(l)
+			// Servers which don't support some filters, such as
+			// "path_prefix", return locks which don't match them.
+			if !lockMatches(lock, filter) {
+				continue
+			}
+
+			locks = append(locks, lock)
 			if limit > 0 && len(locks) >= limit {
 				// Exit outer loop too
 				return locks, nil
@@ -218,6 +254,109 @@ func (c *Client) searchRemoteLocks(filter map[string]string, limit int) ([]Lock,
 
 }
 
+// VerifiableLocks returns the locks on the current remote which match the given
+// name/value filter, separated into those held by the current committer (ours)
+// and those held by anyone else (theirs).
+// If limit > 0 then search stops at that number of locks in total
+// If the server doesn't support listing locks for verification, locks are
+// searched for instead and separated by the committer's email address.
+func (c *Client) VerifiableLocks(filter map[string]string, limit int) (ours, theirs []Lock, err error) {
+	ours = make([]Lock, 0)
+	theirs = make([]Lock, 0)
+
+	query := &api.LockVerifiableRequest{
+		Committer: api.NewCommitter(c.cfg.CurrentCommitter()),
+	}
+	for {
+		query.Limit = pageLimit(limit, len(ours)+len(theirs))
+		s, resp := c.apiClient.Locks.SearchVerifiable(query)
+		if _, err := c.apiClient.Do(s); err != nil {
+			if len(query.Cursor) == 0 {
+				tracerx.Printf("locking: unable to verify locks, searching instead: %v", err)
+				return c.verifiableLocksFromSearch(filter, limit)
+			}
+			return ours, theirs, fmt.Errorf("Error communicating with LFS API: %v", err)
+		}
+
+		if resp.Err != "" {
+			return ours, theirs, fmt.Errorf("Error response from LFS API: %v", resp.Err)
+		}
+
+		for _, l := range resp.Ours {
+			if lock := c.newLockFromApi(l); lockMatches(lock, filter) {
+				ours = append(ours, lock)
+			}
+		}
+		for _, l := range resp.Theirs {
+			if lock := c.newLockFromApi(l); lockMatches(lock, filter) {
+				theirs = append(theirs, lock)
+			}
+		}
+
+		if limit > 0 && len(ours)+len(theirs) >= limit {
+			return truncateLocks(ours, theirs, limit)
+		}
+
+		if resp.NextCursor == "" {
+			return ours, theirs, nil
+		}
+		query.Cursor = resp.NextCursor
+	}
+}
+
+func (c *Client) verifiableLocksFromSearch(filter map[string]string, limit int) (ours, theirs []Lock, err error) {
+	ours = make([]Lock, 0)
+	theirs = make([]Lock, 0)
+
+	locks, err := c.searchRemoteLocks(filter, limit)
+
+	_, email := c.cfg.CurrentCommitter()
+	for _, l := range locks {
+		if l.Email == email {
+			ours = append(ours, l)
+		} else {
+			theirs = append(theirs, l)
+		}
+	}
+	return ours, theirs, err
+}
+
+// truncateLocks drops locks from the end of theirs, and then of ours, so that
+// there are at most limit locks between them.
+func truncateLocks(ours, theirs []Lock, limit int) ([]Lock, []Lock, error) {
+	if len(ours) > limit {
+		ours = ours[:limit]
+	}
+	if len(ours)+len(theirs) > limit {
+		theirs = theirs[:limit-len(ours)]
+	}
+	return ours, theirs, nil
+}
+
+// pageLimit returns the number of locks to ask the server for in the next page
+// of a search for limit locks, of which found have been found so far.
+func pageLimit(limit, found int) int {
+	if limit > 0 && limit-found < lockPageSize {
+		return limit - found
+	}
+	return lockPageSize
+}
+
+// lockMatches returns whether l matches the "path", "path_prefix" and "id"
+// values of the given filter.
+func lockMatches(l Lock, filter map[string]string) bool {
+	if path, ok := filter["path"]; ok && path != l.Path {
+		return false
+	}
+	if prefix, ok := filter["path_prefix"]; ok && !strings.HasPrefix(l.Path, prefix) {
+		return false
+	}
+	if id, ok := filter["id"]; ok && id != l.Id {
+		return false
+	}
+	return true
+}
+
 // lockIdFromPath makes a call to the LFS API and resolves the ID for the locked
 // locked at the given path.
 //
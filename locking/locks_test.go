@@ -3,6 +3,7 @@ package locking
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -96,3 +97,152 @@ func TestRefreshCache(t *testing.T) {
 	}, locks)
 
 }
+
+func TestSearchLocksWithPathPrefix(t *testing.T) {
+	client := &Client{
+		cfg:       config.NewFrom(config.Values{}),
+		apiClient: api.NewClient(&TestLifecycle{}),
+	}
+
+	locks, err := client.SearchLocks(map[string]string{"path_prefix": "folder/"}, 0, false)
+	assert.Nil(t, err)
+
+	sort.Sort(LocksById(locks))
+	assert.Equal(t, []string{"folder/test1.dat", "folder/test2.dat", "folder/test3.dat"}, lockPaths(locks))
+}
+
+// verifyLifecycle returns each of pages in turn in response to requests to
+// list locks for verification, and fails any other request.
+type verifyLifecycle struct {
+	pages []api.LockVerifiableList
+	limit int
+}
+
+func (l *verifyLifecycle) Build(schema *api.RequestSchema) (*http.Request, error) {
+	if schema.Path != "/locks/verify" {
+		return nil, errors.New("unexpected request")
+	}
+	l.limit = schema.Body.(*api.LockVerifiableRequest).Limit
+	return http.NewRequest("POST", "http://dummy/locks/verify", nil)
+}
+
+func (l *verifyLifecycle) Execute(req *http.Request, into interface{}) (api.Response, error) {
+	page := l.pages[0]
+	l.pages = l.pages[1:]
+
+	*into.(*api.LockVerifiableList) = page
+	return api.WrapHttpResponse(&http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+	}), nil
+}
+
+func (l *verifyLifecycle) Cleanup(resp api.Response) error {
+	return resp.Body().Close()
+}
+
+func TestVerifiableLocks(t *testing.T) {
+	lifecycle := &verifyLifecycle{pages: []api.LockVerifiableList{
+		{
+			Ours:       []api.Lock{{Id: "1", Path: "folder/a.dat"}},
+			Theirs:     []api.Lock{{Id: "2", Path: "folder/b.dat"}, {Id: "3", Path: "other/c.dat"}},
+			NextCursor: "4",
+		},
+		{
+			Ours:   []api.Lock{{Id: "4", Path: "other/d.dat"}},
+			Theirs: []api.Lock{{Id: "5", Path: "folder/e.dat"}},
+		},
+	}}
+	client := &Client{
+		cfg:       config.NewFrom(config.Values{}),
+		apiClient: api.NewClient(lifecycle),
+	}
+
+	ours, theirs, err := client.VerifiableLocks(map[string]string{"path_prefix": "folder/"}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"folder/a.dat"}, lockPaths(ours))
+	assert.Equal(t, []string{"folder/b.dat", "folder/e.dat"}, lockPaths(theirs))
+	assert.Equal(t, lockPageSize, lifecycle.limit)
+}
+
+func TestVerifiableLocksWithLimit(t *testing.T) {
+	lifecycle := &verifyLifecycle{pages: []api.LockVerifiableList{
+		{
+			Ours:       []api.Lock{{Id: "1", Path: "a.dat"}},
+			Theirs:     []api.Lock{{Id: "2", Path: "b.dat"}},
+			NextCursor: "3",
+		},
+		{
+			Ours:   []api.Lock{{Id: "3", Path: "c.dat"}},
+			Theirs: []api.Lock{{Id: "4", Path: "d.dat"}},
+		},
+	}}
+	client := &Client{
+		cfg:       config.NewFrom(config.Values{}),
+		apiClient: api.NewClient(lifecycle),
+	}
+
+	ours, theirs, err := client.VerifiableLocks(nil, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.dat", "c.dat"}, lockPaths(ours))
+	assert.Equal(t, []string{"b.dat"}, lockPaths(theirs))
+	assert.Equal(t, 1, lifecycle.limit)
+}
+
+func TestVerifiableLocksFallsBackToSearch(t *testing.T) {
+	client := &Client{
+		cfg: config.NewFrom(config.Values{
+			Git: map[string]string{"user.name": "Fred", "user.email": "fred@bloggs.com"},
+		}),
+		apiClient: api.NewClient(&searchOnlyLifecycle{}),
+	}
+
+	ours, theirs, err := client.VerifiableLocks(nil, 0)
+	assert.Nil(t, err)
+
+	sort.Sort(LocksById(ours))
+	sort.Sort(LocksById(theirs))
+	assert.Equal(t, []string{"folder/test1.dat", "folder/test2.dat", "root.dat"}, lockPaths(ours))
+	assert.Equal(t, []string{"other/test1.dat", "folder/test3.dat"}, lockPaths(theirs))
+}
+
+// searchOnlyLifecycle behaves as TestLifecycle, but fails requests to list
+// locks for verification, as a server which doesn't support them would.
+type searchOnlyLifecycle struct {
+	TestLifecycle
+}
+
+func (l *searchOnlyLifecycle) Build(schema *api.RequestSchema) (*http.Request, error) {
+	if schema.Path == "/locks/verify" {
+		return nil, errors.New("not found")
+	}
+	return l.TestLifecycle.Build(schema)
+}
+
+func lockPaths(locks []Lock) []string {
+	paths := make([]string, 0, len(locks))
+	for _, l := range locks {
+		paths = append(paths, l.Path)
+	}
+	return paths
+}
+
+func TestLockStale(t *testing.T) {
+	now := time.Now()
+	cutoff := now.Add(-30 * 24 * time.Hour)
+
+	expiredAt, expiringAt := now.Add(-time.Minute), now.Add(time.Minute)
+
+	old := Lock{LockedAt: now.Add(-31 * 24 * time.Hour)}
+	recent := Lock{LockedAt: now.Add(-time.Hour)}
+	expired := Lock{LockedAt: now.Add(-time.Hour), ExpiresAt: &expiredAt}
+	expiring := Lock{LockedAt: now.Add(-time.Hour), ExpiresAt: &expiringAt}
+
+	assert.True(t, old.Stale(now, cutoff))
+	assert.False(t, recent.Stale(now, cutoff))
+	assert.True(t, expired.Stale(now, cutoff))
+	assert.False(t, expiring.Stale(now, cutoff))
+
+	assert.False(t, old.Stale(now, time.Time{}))
+	assert.True(t, expired.Stale(now, time.Time{}))
+}
@@ -0,0 +1,71 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// jsonCounts are the counts of a meter in its JSON updates.
+type jsonCounts struct {
+	Files            int64      `json:"files"`
+	EstimatedFiles   int64      `json:"estimated_files"`
+	SkippedFiles     int64      `json:"skipped_files"`
+	Bytes            int64      `json:"bytes"`
+	EstimatedBytes   int64      `json:"estimated_bytes"`
+	CommittedBytes   int64      `json:"committed_bytes,omitempty"`
+	SkippedBytes     int64      `json:"skipped_bytes"`
+	RateLimitedUntil *time.Time `json:"rate_limited_until,omitempty"`
+}
+
+// jsonUpdate is an update written by a meter when GIT_LFS_PROGRESS_FORMAT is
+// "json". Updates of a section give its own counts as well as the totals of
+// its overall meter; the others give only the totals.
+type jsonUpdate struct {
+	Section  string      `json:"section,omitempty"`
+	Index    int32       `json:"index,omitempty"`
+	Sections int32       `json:"sections,omitempty"`
+	Progress *jsonCounts `json:"progress,omitempty"`
+	Total    *jsonCounts `json:"total"`
+}
+
+func (p *ProgressMeter) jsonCounts() *jsonCounts {
+	c := &jsonCounts{
+		Files:          atomic.LoadInt64(&p.finishedFiles),
+		EstimatedFiles: int64(atomic.LoadInt32(&p.estimatedFiles)),
+		SkippedFiles:   atomic.LoadInt64(&p.skippedFiles),
+		Bytes:          atomic.LoadInt64(&p.currentBytes),
+		EstimatedBytes: atomic.LoadInt64(&p.estimatedBytes),
+		CommittedBytes: atomic.LoadInt64(&p.committedBytes),
+		SkippedBytes:   atomic.LoadInt64(&p.skippedBytes),
+	}
+	if until := atomic.LoadInt64(&p.rateLimitedUntil); until > time.Now().UnixNano() {
+		t := time.Unix(0, until).UTC()
+		c.RateLimitedUntil = &t
+	}
+	return c
+}
+
+// writeJSON writes an update of the meter to stdout as a line of JSON, unless
+// nothing has changed since the last one.
+func (p *ProgressMeter) writeJSON() {
+	u := &jsonUpdate{Total: p.jsonCounts()}
+	if p.parent != nil {
+		u.Section = p.sectionName
+		u.Index = p.sectionIndex
+		u.Sections = p.parent.sections
+		u.Progress = u.Total
+		u.Total = p.parent.jsonCounts()
+	} else if p.sections > 0 {
+		u.Sections = p.sections
+	}
+
+	b, err := json.Marshal(u)
+	if err != nil || string(b) == p.lastUpdate {
+		return
+	}
+	p.lastUpdate = string(b)
+	fmt.Fprintf(os.Stdout, "%s\n", b)
+}
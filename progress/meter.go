@@ -8,7 +8,9 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
+	"github.com/git-lfs/git-lfs/tr"
 	"github.com/olekukonko/ts"
 )
 
@@ -22,33 +24,54 @@ type ProgressMeter struct {
 	transferringFiles int64
 	estimatedBytes    int64
 	currentBytes      int64
+	committedBytes    int64
 	skippedBytes      int64
+	rateLimitedUntil  int64 // in nanoseconds since the epoch
 	started           int32
 	estimatedFiles    int32
+	sections          int32 // the number of sections of an overall meter
+	startedSections   int32
 	startTime         time.Time
 	finished          chan interface{}
 	logger            *progressLogger
 	fileIndex         map[string]int64 // Maps a file name to its transfer number
 	fileIndexMutex    *sync.Mutex
 	dryRun            bool
+	json              bool
+
+	// tty is whether a line is drawn for each transfer in progress, as
+	// they are held in transfers, above the summary line. ttyLines is the
+	// number of transfer lines last drawn, guarded by ttyMutex.
+	tty       bool
+	transfers map[string]*transferStatus
+	ttyLines  int
+	ttyMutex  sync.Mutex
+
+	// parent is the overall meter of which this meter is the section with
+	// the given name and 1-based index, or nil if it is not a section.
+	parent       *ProgressMeter
+	sectionName  string
+	sectionIndex int32
+	lastUpdate   string
 }
 
 type env interface {
 	Get(key string) (val string, ok bool)
 }
 
-type meterOption func(*ProgressMeter)
+// MeterOption is an option for NewMeter().
+type MeterOption func(*ProgressMeter)
 
 // DryRun is an option for NewMeter() that determines whether updates should be
 // sent to stdout.
-func DryRun(dryRun bool) meterOption {
+func DryRun(dryRun bool) MeterOption {
 	return func(m *ProgressMeter) {
 		m.dryRun = dryRun
 	}
 }
 
 // WithLogFile is an option for NewMeter() that sends updates to a text file.
-func WithLogFile(name string) meterOption {
+func WithLogFile(name string) MeterOption {
 	printErr := func(err string) {
 		fmt.Fprintf(os.Stderr, "Error creating progress logger: %s\n", err)
 	}
@@ -81,20 +104,57 @@ func WithLogFile(name string) meterOption {
 }
 
 // WithOSEnv is an option for NewMeter() that sends updates to the text file
-// path specified in the OS Env.
-func WithOSEnv(os env) meterOption {
+// path specified in the OS Env, and writes them to stdout as JSON if
+// GIT_LFS_PROGRESS_FORMAT is "json", or as a single line if it is "plain".
+// Otherwise, a line is drawn for each transfer in progress when stdout is a
+// terminal.
+func WithOSEnv(os env) MeterOption {
 	name, _ := os.Get("GIT_LFS_PROGRESS")
-	return WithLogFile(name)
+	format, _ := os.Get("GIT_LFS_PROGRESS_FORMAT")
+	logFile := WithLogFile(name)
+
+	return func(m *ProgressMeter) {
+		logFile(m)
+		m.json = strings.ToLower(format) == "json"
+		m.tty = ttyEnabled(format)
+	}
+}
+
+// WithSections is an option for NewMeter() that makes an overall meter of the
+// given number of sections, such as the refs being pushed, each transferred
+// with a meter made with WithSection(). The overall meter is not started
+// itself; its sections display its progress along with their own, and its
+// Finish() displays the final totals.
+func WithSections(n int) MeterOption {
+	return func(m *ProgressMeter) {
+		m.sections = int32(n)
+	}
+}
+
+// WithSection is an option for NewMeter() that makes the meter the next
+// section of the given overall meter, with the given name. Files and bytes
+// added to or transferred by the section are counted by the overall meter
+// too.
+func WithSection(parent *ProgressMeter, name string) MeterOption {
+	return func(m *ProgressMeter) {
+		if parent == nil {
+			return
+		}
+		m.parent = parent
+		m.sectionName = name
+		m.sectionIndex = atomic.AddInt32(&parent.startedSections, 1)
+	}
 }
 
 // NewMeter creates a new ProgressMeter.
-func NewMeter(options ...meterOption) *ProgressMeter {
+func NewMeter(options ...MeterOption) *ProgressMeter {
 	m := &ProgressMeter{
 		logger:         &progressLogger{},
 		startTime:      time.Now(),
 		fileIndex:      make(map[string]int64),
 		fileIndexMutex: &sync.Mutex{},
 		finished:       make(chan interface{}),
+		transfers:      make(map[string]*transferStatus),
 	}
 
 	for _, opt := range options {
@@ -117,6 +177,9 @@ func (p *ProgressMeter) Start() {
 func (p *ProgressMeter) Add(size int64) {
 	atomic.AddInt32(&p.estimatedFiles, 1)
 	atomic.AddInt64(&p.estimatedBytes, size)
+	if p.parent != nil {
+		p.parent.Add(size)
+	}
 }
 
 // Skip tells the progress meter that a file of size `size` is being skipped
@@ -127,6 +190,9 @@ func (p *ProgressMeter) Skip(size int64) {
 	// Reduce bytes and files so progress easier to parse
 	atomic.AddInt32(&p.estimatedFiles, -1)
 	atomic.AddInt64(&p.estimatedBytes, -size)
+	if p.parent != nil {
+		p.parent.Skip(size)
+	}
 }
 
 // StartTransfer tells the progress meter that a transferring file is being
@@ -135,29 +201,69 @@ func (p *ProgressMeter) StartTransfer(name string) {
 	idx := atomic.AddInt64(&p.transferringFiles, 1)
 	p.fileIndexMutex.Lock()
 	p.fileIndex[name] = idx
+	p.startTransferStatus(name, idx)
 	p.fileIndexMutex.Unlock()
 }
 
 // TransferBytes increments the number of bytes transferred
 func (p *ProgressMeter) TransferBytes(direction, name string, read, total int64, current int) {
 	atomic.AddInt64(&p.currentBytes, int64(current))
+	if p.parent != nil {
+		atomic.AddInt64(&p.parent.currentBytes, int64(current))
+	}
+	p.updateTransferStatus(name, read, total)
 	p.logBytes(direction, name, read, total)
 }
 
+// Commit tells the progress meter that the remote has acknowledged storing
+// another `size` bytes durably, which adapters that can tell report apart from
+// the bytes they've written.
+func (p *ProgressMeter) Commit(size int64) {
+	atomic.AddInt64(&p.committedBytes, size)
+	if p.parent != nil {
+		atomic.AddInt64(&p.parent.committedBytes, size)
+	}
+}
+
 // FinishTransfer increments the finished transfer count
 func (p *ProgressMeter) FinishTransfer(name string) {
 	atomic.AddInt64(&p.finishedFiles, 1)
+	if p.parent != nil {
+		atomic.AddInt64(&p.parent.finishedFiles, 1)
+	}
 	p.fileIndexMutex.Lock()
 	delete(p.fileIndex, name)
+	delete(p.transfers, name)
 	p.fileIndexMutex.Unlock()
 }
 
-// Finish shuts down the ProgressMeter
+// RateLimited tells the progress meter that the server is rate limiting
+// transfers, which will resume at the given time.
+func (p *ProgressMeter) RateLimited(until time.Time) {
+	for {
+		current := atomic.LoadInt64(&p.rateLimitedUntil)
+		if until.UnixNano() <= current || atomic.CompareAndSwapInt64(&p.rateLimitedUntil, current, until.UnixNano()) {
+			return
+		}
+	}
+}
+
+// Finish shuts down the ProgressMeter. The Finish() of an overall meter
+// displays the totals of its sections, if there is more than one.
 func (p *ProgressMeter) Finish() {
 	close(p.finished)
-	p.update()
+	// Transfers which failed are never finished, so their lines are
+	// erased along with the rest.
+	p.fileIndexMutex.Lock()
+	p.transfers = make(map[string]*transferStatus)
+	p.fileIndexMutex.Unlock()
+	if p.sections > 1 {
+		p.updateOverall()
+	} else {
+		p.update()
+	}
 	p.logger.Close()
-	if !p.dryRun && p.estimatedBytes > 0 {
+	if !p.dryRun && !p.json && p.estimatedBytes > 0 {
 		fmt.Fprintf(os.Stdout, "\n")
 	}
 }
@@ -189,21 +295,69 @@ func (p *ProgressMeter) update() {
 		return
 	}
 
-	// (%d of %d files, %d skipped) %f B / %f B, %f B skipped
-	// skipped counts only show when > 0
+	if p.json {
+		p.writeJSON()
+		return
+	}
 
-	out := fmt.Sprintf("\rGit LFS: (%d of %d files", p.finishedFiles, p.estimatedFiles)
-	if p.skippedFiles > 0 {
-		out += fmt.Sprintf(", %d skipped", p.skippedFiles)
+	// [%d/%d] %s (%d of %d files, %d skipped) %f B / %f B, %f B committed, %f B skipped
+	// section names, committed and skipped counts only show when present
+
+	out := "\rGit LFS: "
+	if p.parent != nil {
+		out += fmt.Sprintf("[%d/%d] %s ", p.sectionIndex, p.parent.sections, p.sectionName)
+	}
+	out += p.counts()
+	if until := atomic.LoadInt64(&p.rateLimitedUntil); until > time.Now().UnixNano() {
+		out += tr.Sprintf(", rate limited by server, resuming at %s", time.Unix(0, until).Format("15:04:05"))
 	}
-	out += fmt.Sprintf(") %s / %s", formatBytes(p.currentBytes), formatBytes(p.estimatedBytes))
-	if p.skippedBytes > 0 {
-		out += fmt.Sprintf(", %s skipped", formatBytes(p.skippedBytes))
+	if p.parent != nil {
+		out += tr.Sprintf(", total %s", p.parent.counts())
 	}
 
+	if p.tty {
+		p.writeTTY(out)
+		return
+	}
 	fmt.Fprintf(os.Stdout, pad(out))
 }
 
+// updateOverall displays the totals of an overall meter's sections.
+func (p *ProgressMeter) updateOverall() {
+	if p.dryRun || (p.estimatedFiles == 0 && p.skippedFiles == 0) {
+		return
+	}
+
+	if p.json {
+		p.writeJSON()
+		return
+	}
+
+	fmt.Fprint(os.Stdout, pad("\rGit LFS: "+tr.Sprintf("total %s", p.counts())))
+}
+
+// counts returns the file and byte counts of the meter, as in
+// "(%d of %d files, %d skipped) %f B / %f B, %f B committed, %f B skipped".
+func (p *ProgressMeter) counts() string {
+	finishedFiles := atomic.LoadInt64(&p.finishedFiles)
+	estimatedFiles := atomic.LoadInt32(&p.estimatedFiles)
+	skippedFiles := atomic.LoadInt64(&p.skippedFiles)
+	skippedBytes := atomic.LoadInt64(&p.skippedBytes)
+
+	out := tr.Sprintf("(%d of %d files", finishedFiles, estimatedFiles)
+	if skippedFiles > 0 {
+		out += tr.Sprintf(", %d skipped", skippedFiles)
+	}
+	out += fmt.Sprintf(") %s / %s", formatBytes(atomic.LoadInt64(&p.currentBytes)), formatBytes(atomic.LoadInt64(&p.estimatedBytes)))
+	if committedBytes := atomic.LoadInt64(&p.committedBytes); committedBytes > 0 {
+		out += tr.Sprintf(", %s committed", formatBytes(committedBytes))
+	}
+	if skippedBytes > 0 {
+		out += tr.Sprintf(", %s skipped", formatBytes(skippedBytes))
+	}
+	return out
+}
+
 func formatBytes(i int64) string {
 	switch {
 	case i > 1099511627776:
@@ -237,8 +391,9 @@ func pad(msg string) string {
 
 	// Pad the string with whitespace so that printing at the start of the
 	// line removes all traces from the last print.removes all traces from
-	// the last print.
-	padding := strings.Repeat(" ", maxInt(0, width-len(msg)))
+	// the last print. The width is counted in runes, as the message may
+	// be translated.
+	padding := strings.Repeat(" ", maxInt(0, width-utf8.RuneCountInString(msg)))
 
 	return msg + padding
 }
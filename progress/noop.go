@@ -1,5 +1,7 @@
 package progress
 
+import "time"
+
 func Noop() Meter {
 	return &nonMeter{}
 }
@@ -11,5 +13,7 @@ func (m *nonMeter) Add(size int64)
 func (m *nonMeter) Skip(size int64)                                                      {}
 func (m *nonMeter) StartTransfer(name string)                                            {}
 func (m *nonMeter) TransferBytes(direction, name string, read, total int64, current int) {}
+func (m *nonMeter) Commit(size int64)                                                    {}
 func (m *nonMeter) FinishTransfer(name string)                                           {}
+func (m *nonMeter) RateLimited(until time.Time)                                          {}
 func (m *nonMeter) Finish()                                                              {}
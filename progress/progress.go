@@ -2,12 +2,16 @@
 // NOTE: Subject to change, do not rely on this package from outside git-lfs source
 package progress
 
+import "time"
+
 type Meter interface {
 	Start()
 	Add(int64)
 	Skip(size int64)
 	StartTransfer(name string)
 	TransferBytes(direction, name string, read, total int64, current int)
+	Commit(size int64)
 	FinishTransfer(name string)
+	RateLimited(until time.Time)
 	Finish()
 }
@@ -0,0 +1,174 @@
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/git-lfs/git-lfs/tr"
+	"github.com/olekukonko/ts"
+)
+
+// maxTransferLines is the most transfers a meter shows a line for on a
+// terminal; the rest are counted on a line of their own.
+const maxTransferLines = 10
+
+// transferStatus is the progress of a single transfer, shown on a line of its
+// own on a terminal.
+type transferStatus struct {
+	name    string
+	index   int64
+	read    int64
+	total   int64
+	started time.Time
+}
+
+type transferStatuses []*transferStatus
+
+func (s transferStatuses) Len() int           { return len(s) }
+func (s transferStatuses) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s transferStatuses) Less(i, j int) bool { return s[i].index < s[j].index }
+
+// isTerminal returns whether f is a terminal which understands the escape
+// sequences used to redraw the lines of each transfer.
+func isTerminal(f *os.File) bool {
+	if runtime.GOOS == "windows" {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// startTransferStatus starts showing the progress of the named transfer, the
+// idx'th the meter was told of.
+func (p *ProgressMeter) startTransferStatus(name string, idx int64) {
+	if !p.tty {
+		return
+	}
+	p.transfers[name] = &transferStatus{name: name, index: idx, started: time.Now()}
+}
+
+// updateTransferStatus records that read of the total bytes of the named
+// transfer have been transferred.
+func (p *ProgressMeter) updateTransferStatus(name string, read, total int64) {
+	if !p.tty {
+		return
+	}
+
+	p.fileIndexMutex.Lock()
+	defer p.fileIndexMutex.Unlock()
+	if s, ok := p.transfers[name]; ok {
+		s.read = read
+		s.total = total
+	}
+}
+
+// writeTTY redraws the lines of the transfers in progress, followed by the
+// summary line, over those it last drew.
+func (p *ProgressMeter) writeTTY(summary string) {
+	p.ttyMutex.Lock()
+	defer p.ttyMutex.Unlock()
+
+	width := defaultWidth
+	if size, err := ts.GetSize(); err == nil && size.Col() > 0 {
+		width = size.Col()
+	}
+
+	var out bytes.Buffer
+	if p.ttyLines > 0 {
+		fmt.Fprintf(&out, "\x1b[%dA", p.ttyLines)
+	}
+
+	lines := p.transferLines(width)
+	for _, line := range lines {
+		out.WriteString("\r\x1b[2K" + line + "\n")
+	}
+	// Erase whatever is left below the summary of transfers which have
+	// since finished.
+	out.WriteString("\r\x1b[2K" + truncate(strings.TrimPrefix(summary, "\r"), width) + "\x1b[J")
+
+	p.ttyLines = len(lines)
+	fmt.Fprint(os.Stdout, out.String())
+}
+
+// transferLines returns a line for each transfer in progress, as in
+// "  path/to/file.bin  42%  1.20 MB/s", fitted to the given width, in the
+// order they started.
+func (p *ProgressMeter) transferLines(width int) []string {
+	p.fileIndexMutex.Lock()
+	statuses := make(transferStatuses, 0, len(p.transfers))
+	for _, s := range p.transfers {
+		statuses = append(statuses, &transferStatus{name: s.name, index: s.index, read: s.read, total: s.total, started: s.started})
+	}
+	p.fileIndexMutex.Unlock()
+	sort.Sort(statuses)
+
+	more := 0
+	if len(statuses) > maxTransferLines {
+		more = len(statuses) - maxTransferLines + 1
+		statuses = statuses[:maxTransferLines-1]
+	}
+
+	lines := make([]string, 0, len(statuses)+1)
+	for _, s := range statuses {
+		stats := "  " + s.percent() + "  " + s.speed()
+		lines = append(lines, "  "+truncateLeft(s.name, width-utf8.RuneCountInString(stats)-2)+stats)
+	}
+	if more > 0 {
+		lines = append(lines, truncate(tr.Sprintf("  ... and %d more", more), width))
+	}
+	return lines
+}
+
+// percent returns how much of the transfer is done, as in " 42%".
+func (s *transferStatus) percent() string {
+	if s.total <= 0 {
+		return "  0%"
+	}
+	return fmt.Sprintf("%3d%%", s.read*100/s.total)
+}
+
+// speed returns the average speed of the transfer so far, as in "1.20 MB/s".
+func (s *transferStatus) speed() string {
+	elapsed := time.Since(s.started).Seconds()
+	if elapsed <= 0 {
+		return formatBytes(0) + "/s"
+	}
+	return formatBytes(int64(float64(s.read)/elapsed)) + "/s"
+}
+
+// truncate cuts msg short to fit the given width, counted in runes so that
+// translated messages aren't cut in the middle of a character.
+func truncate(msg string, width int) string {
+	runes := []rune(msg)
+	if width < 0 || len(runes) <= width {
+		return msg
+	}
+	return string(runes[:width])
+}
+
+// truncateLeft cuts the start of name short, replacing it with "...", to fit
+// the given width, counted in runes, so that the end of a path, its file name,
+// is kept.
+func truncateLeft(name string, width int) string {
+	runes := []rune(name)
+	if len(runes) <= width {
+		return name
+	}
+	if width <= 3 {
+		return strings.Repeat(".", maxInt(0, width))
+	}
+	return "..." + string(runes[len(runes)-width+3:])
+}
+
+// ttyEnabled returns whether the meter draws a line for each transfer, which
+// it does when stdout is a terminal, unless GIT_LFS_PROGRESS_FORMAT asks for
+// another format.
+func ttyEnabled(format string) bool {
+	return len(format) == 0 && isTerminal(os.Stdout)
+}
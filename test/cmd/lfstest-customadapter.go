@@ -42,13 +42,19 @@ func main() {
 		switch req.Event {
 		case "init":
 			writeToStderr(fmt.Sprintf("Initialised test custom adapter for %s\n", req.Operation), errWriter)
+			if wd, err := os.Getwd(); err == nil {
+				writeToStderr(fmt.Sprintf("Working directory: %s\n", wd), errWriter)
+			}
+			writeToStderr(fmt.Sprintf("LFSTEST_SECRET=%s\n", os.Getenv("LFSTEST_SECRET")), errWriter)
 			resp := &initResponse{}
 			sendResponse(resp, writer, errWriter)
 		case "download":
 			writeToStderr(fmt.Sprintf("Received download request for %s\n", req.Oid), errWriter)
+			failOnce(errWriter)
 			performDownload(req.Oid, req.Size, req.Action, writer, errWriter)
 		case "upload":
 			writeToStderr(fmt.Sprintf("Received upload request for %s\n", req.Oid), errWriter)
+			failOnce(errWriter)
 			performUpload(req.Oid, req.Size, req.Action, req.Path, writer, errWriter)
 		case "terminate":
 			writeToStderr("Terminating test custom adapter gracefully.\n", errWriter)
@@ -58,6 +64,33 @@ func main() {
 
 }
 
+// failOnce crashes or hangs, as LFSTEST_CUSTOM_ADAPTER_FAIL is "crash" or
+// "hang", the first time it is called by any adapter process, as recorded by
+// creating the file LFSTEST_CUSTOM_ADAPTER_FAIL_MARKER, so that restarting the
+// adapter can be tested.
+func failOnce(errWriter *bufio.Writer) {
+	mode := os.Getenv("LFSTEST_CUSTOM_ADAPTER_FAIL")
+	marker := os.Getenv("LFSTEST_CUSTOM_ADAPTER_FAIL_MARKER")
+	if len(mode) == 0 || len(marker) == 0 {
+		return
+	}
+
+	f, err := os.OpenFile(marker, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	f.Close()
+
+	switch mode {
+	case "crash":
+		writeToStderr("Crashing on purpose\n", errWriter)
+		os.Exit(1)
+	case "hang":
+		writeToStderr("Hanging on purpose\n", errWriter)
+		time.Sleep(time.Hour)
+	}
+}
+
 func writeToStderr(msg string, errWriter *bufio.Writer) {
 	if !strings.HasSuffix(msg, "\n") {
 		msg = msg + "\n"
@@ -91,7 +124,11 @@ func sendTransferError(oid string, code int, message string, writer, errWriter *
 }
 
 func sendProgress(oid string, bytesSoFar int64, bytesSinceLast int, writer, errWriter *bufio.Writer) {
-	resp := &progressResponse{"progress", oid, bytesSoFar, bytesSinceLast}
+	sendCommittedProgress(oid, bytesSoFar, bytesSinceLast, 0, writer, errWriter)
+}
+
+func sendCommittedProgress(oid string, bytesSoFar int64, bytesSinceLast int, bytesCommitted int64, writer, errWriter *bufio.Writer) {
+	resp := &progressResponse{"progress", oid, bytesSoFar, bytesSinceLast, bytesCommitted}
 	err := sendResponse(resp, writer, errWriter)
 	if err != nil {
 		writeToStderr(fmt.Sprintf("Unable to send progress update: %v\n", err), errWriter)
@@ -201,6 +238,9 @@ func performUpload(oid string, size int64, a *action, fromPath string, writer, e
 	io.Copy(ioutil.Discard, res.Body)
 	res.Body.Close()
 
+	// the server has stored the whole object once it has responded
+	sendCommittedProgress(oid, size, 0, size, writer, errWriter)
+
 	// completed
 	complete := &transferResponse{"complete", oid, "", nil}
 	err = sendResponse(complete, writer, errWriter)
@@ -251,4 +291,5 @@ type progressResponse struct {
 	Oid            string `json:"oid"`
 	BytesSoFar     int64  `json:"bytesSoFar"`
 	BytesSinceLast int    `json:"bytesSinceLast"`
+	BytesCommitted int64  `json:"bytesCommitted,omitempty"`
 }
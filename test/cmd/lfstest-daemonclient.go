@@ -0,0 +1,40 @@
+// +build testtools
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+// lfstest-daemonclient sends each line read from stdin to the "git lfs daemon"
+// listening on the socket given as its argument, and prints each response.
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: lfstest-daemonclient <socket>")
+		os.Exit(1)
+	}
+
+	conn, err := net.Dial("unix", os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	responses := bufio.NewReader(conn)
+	requests := bufio.NewScanner(os.Stdin)
+	for requests.Scan() {
+		fmt.Fprintln(conn, requests.Text())
+
+		res, err := responses.ReadString('\n')
+		if err != nil && err != io.EOF {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Print(res)
+	}
+}
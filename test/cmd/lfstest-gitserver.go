@@ -6,12 +6,15 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/rand"
+	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"log"
@@ -27,11 +30,17 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/git-lfs/git-lfs/localstorage"
+	"github.com/git-lfs/git-lfs/tq"
 )
 
 var (
 	repoDir      string
 	largeObjects = newLfsStorage()
+	largeChunks  = newLfsStorage()
+	webdavFiles  = newLfsStorage()
+	ipfsFiles    = newLfsStorage()
 	server       *httptest.Server
 	serverTLS    *httptest.Server
 
@@ -50,6 +59,7 @@ var (
 		"status-storage-403", "status-storage-404", "status-storage-410", "status-storage-422", "status-storage-500", "status-storage-503",
 		"status-batch-resume-206", "batch-resume-fail-fallback", "return-expired-action", "return-expired-action-forever", "return-invalid-size",
 		"object-authenticated", "storage-download-retry", "storage-upload-retry", "unknown-oid",
+		"rate-limit-batch", "rate-limit-storage",
 	}
 )
 
@@ -68,6 +78,9 @@ func main() {
 
 	mux.HandleFunc("/storage/", storageHandler)
 	mux.HandleFunc("/redirect307/", redirect307Handler)
+	mux.HandleFunc("/chunked/", chunkedHandler)
+	mux.HandleFunc("/webdav/", webdavHandler)
+	mux.HandleFunc("/ipfs-node/", ipfsHandler)
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		id, ok := reqId(w)
 		if !ok {
@@ -159,6 +172,12 @@ func lfsHandler(w http.ResponseWriter, r *http.Request, id string) {
 			lfsBatchHandler(w, r, id, repo)
 		} else if strings.HasSuffix(r.URL.String(), "locks") || strings.HasSuffix(r.URL.String(), "unlock") {
 			locksHandler(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "locks/verify") {
+			if strings.Contains(repo, "verify-unsupported") {
+				w.WriteHeader(404)
+				return
+			}
+			locksVerifyHandler(w, r)
 		} else {
 			panic("asdf")
 			w.WriteHeader(404)
@@ -168,6 +187,8 @@ func lfsHandler(w http.ResponseWriter, r *http.Request, id string) {
 	case "GET":
 		if strings.Contains(r.URL.String(), "/locks") {
 			locksHandler(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/objects/filter") && strings.Contains(repo, "existence-filter") {
+			lfsExistenceFilterHandler(w, r, id, repo)
 		} else {
 			w.WriteHeader(404)
 		}
@@ -176,6 +197,36 @@ func lfsHandler(w http.ResponseWriter, r *http.Request, id string) {
 	}
 }
 
+// lfsExistenceFilterHandler responds with a Bloom filter of the objects in the
+// repo, for repos with "existence-filter" in their name.
+func lfsExistenceFilterHandler(w http.ResponseWriter, r *http.Request, id, repo string) {
+	const bits, hashes = 1024, 4
+
+	filter := make([]byte, bits/8)
+	for _, oid := range largeObjects.Oids(repo) {
+		b, err := hex.DecodeString(oid)
+		if err != nil || len(b) < 16 {
+			continue
+		}
+
+		h1 := binary.BigEndian.Uint64(b[0:8])
+		h2 := binary.BigEndian.Uint64(b[8:16])
+		for i := uint64(0); i < hashes; i++ {
+			n := (h1 + i*h2) % bits
+			filter[n/8] |= 1 << (n % 8)
+		}
+	}
+
+	debug(id, "existence filter for %s", repo)
+	by, _ := json.Marshal(map[string]interface{}{
+		"hashes": hashes,
+		"bits":   bits,
+		"filter": filter,
+	})
+	w.WriteHeader(200)
+	w.Write(by)
+}
+
 func lfsUrl(repo, oid string) string {
 	return server.URL + "/storage/" + oid + "?r=" + repo
 }
@@ -210,6 +261,30 @@ func incrementRetriesFor(api, direction, repo, oid string, check bool) (after ui
 	return retries, true
 }
 
+// rateLimited returns whether a request of the given kind for the given object
+// should be rate limited, which the first two are.
+func rateLimited(kind, repo, oid string) bool {
+	retriesMu.Lock()
+	defer retriesMu.Unlock()
+
+	key := strings.Join([]string{"rate-limit", kind, repo, oid}, ":")
+	retries[key]++
+
+	return retries[key] < 3
+}
+
+// firstRequest returns whether this is the first request of the given kind for
+// the given object.
+func firstRequest(kind, repo, oid string) bool {
+	retriesMu.Lock()
+	defer retriesMu.Unlock()
+
+	key := strings.Join([]string{"first", kind, repo, oid}, ":")
+	retries[key]++
+
+	return retries[key] == 1
+}
+
 func lfsDeleteHandler(w http.ResponseWriter, r *http.Request, id, repo string) {
 	parts := strings.Split(r.URL.Path, "/")
 	oid := parts[len(parts)-1]
@@ -244,9 +319,10 @@ func lfsBatchHandler(w http.ResponseWriter, r *http.Request, id, repo string) {
 	}
 
 	type batchReq struct {
-		Transfers []string    `json:"transfers"`
-		Operation string      `json:"operation"`
-		Objects   []lfsObject `json:"objects"`
+		Transfers    []string    `json:"transfers"`
+		Operation    string      `json:"operation"`
+		Objects      []lfsObject `json:"objects"`
+		StorageClass string      `json:"storage_class"`
 	}
 	type batchResp struct {
 		Transfer string      `json:"transfer,omitempty"`
@@ -267,6 +343,15 @@ func lfsBatchHandler(w http.ResponseWriter, r *http.Request, id, repo string) {
 		log.Fatal(err)
 	}
 
+	for _, obj := range objs.Objects {
+		if oidHandlers[obj.Oid] == "rate-limit-batch" && rateLimited("batch", repo, obj.Oid) {
+			debug(id, "RESPONSE: 429")
+			w.Header().Set("RateLimit-Reset", "1")
+			w.WriteHeader(429)
+			return
+		}
+	}
+
 	res := []lfsObject{}
 	testingChunked := testingChunkedTransferEncoding(r)
 	testingTus := testingTusUploadInBatchReq(r)
@@ -278,6 +363,8 @@ func lfsBatchHandler(w http.ResponseWriter, r *http.Request, id, repo string) {
 		searchForTransfer = "tus"
 	} else if testingCustomTransfer {
 		searchForTransfer = "testcustom"
+	} else if strings.Contains(repo, "chunkstore") {
+		searchForTransfer = "chunked"
 	}
 	if len(searchForTransfer) > 0 {
 		for _, t := range objs.Transfers {
@@ -322,6 +409,12 @@ func lfsBatchHandler(w http.ResponseWriter, r *http.Request, id, repo string) {
 			o.Authenticated = true
 		}
 
+		// Repositories named "storage-class-<class>" only store objects
+		// in the storage class they're named after.
+		if class := strings.TrimPrefix(repo, "storage-class-"); !checkingObject && class != repo && objs.StorageClass != class {
+			handler = "status-batch-422"
+		}
+
 		switch handler {
 		case "status-batch-403":
 			o.Err = &lfsError{Code: 403, Message: "welp"}
@@ -343,6 +436,9 @@ func lfsBatchHandler(w http.ResponseWriter, r *http.Request, id, repo string) {
 					Href:   lfsUrl(repo, obj.Oid),
 					Header: map[string]string{},
 				}
+				if transferChoice == "chunked" {
+					a.Href = server.URL + "/chunked/" + obj.Oid + "?r=" + repo
+				}
 
 				if handler == "return-expired-action-forever" || (handler == "return-expired-action" && canServeExpired(repo)) {
 					a.ExpiresAt = time.Now().Add(-5 * time.Minute)
@@ -407,6 +503,256 @@ var batchResumeFailFallbackStorageAttempts = 0
 var tusStorageAttempts = 0
 
 // handles any /storage/{oid} requests
+type chunkedChunk struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type chunkedManifest struct {
+	Oid    string         `json:"oid,omitempty"`
+	Size   int64          `json:"size,omitempty"`
+	Chunks []chunkedChunk `json:"chunks"`
+}
+
+// chunkedHandler serves the chunked transfer adapter: manifests of objects at
+// /chunked/<oid>, and their chunks at /chunked/<oid>/chunks/<chunk-oid>.
+// Chunks are stored per repository, and objects are assembled from them once
+// the client POSTs a manifest listing no chunks the server is missing.
+func chunkedHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := reqId(w)
+	if !ok {
+		return
+	}
+
+	repo := r.URL.Query().Get("r")
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/chunked/"), "/")
+	oid := parts[0]
+	debug(id, "chunked %s %s repo: %s", r.Method, r.URL.Path, repo)
+
+	if len(parts) == 3 && parts[1] == "chunks" {
+		chunkOid := parts[2]
+		switch r.Method {
+		case "GET":
+			by, ok := largeChunks.Get(repo, chunkOid)
+			if !ok {
+				w.WriteHeader(404)
+				return
+			}
+			w.Write(by)
+		case "PUT":
+			by, _ := ioutil.ReadAll(r.Body)
+			sum := sha256.Sum256(by)
+			if hex.EncodeToString(sum[:]) != chunkOid {
+				w.WriteHeader(422)
+				return
+			}
+			largeChunks.Set(repo, chunkOid, by)
+			w.WriteHeader(200)
+		default:
+			w.WriteHeader(405)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.git-lfs.chunks+json")
+	switch r.Method {
+	case "GET":
+		by, ok := largeObjects.Get(repo, oid)
+		if !ok {
+			w.WriteHeader(404)
+			return
+		}
+
+		manifest := chunkedManifest{Oid: oid, Size: int64(len(by)), Chunks: []chunkedChunk{}}
+		localstorage.SplitChunks(bytes.NewReader(by), func(data []byte) error {
+			sum := sha256.Sum256(data)
+			chunkOid := hex.EncodeToString(sum[:])
+			largeChunks.Set(repo, chunkOid, append([]byte{}, data...))
+			manifest.Chunks = append(manifest.Chunks, chunkedChunk{Oid: chunkOid, Size: int64(len(data))})
+			return nil
+		})
+		json.NewEncoder(w).Encode(manifest)
+	case "POST":
+		var manifest chunkedManifest
+		if err := json.NewDecoder(r.Body).Decode(&manifest); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+
+		missing := []string{}
+		var buf bytes.Buffer
+		for _, c := range manifest.Chunks {
+			by, ok := largeChunks.Get(repo, c.Oid)
+			if !ok {
+				missing = append(missing, c.Oid)
+				continue
+			}
+			buf.Write(by)
+		}
+
+		if len(missing) == 0 && !largeObjects.Has(repo, oid) {
+			sum := sha256.Sum256(buf.Bytes())
+			if hex.EncodeToString(sum[:]) != oid {
+				w.WriteHeader(422)
+				return
+			}
+			largeObjects.Set(repo, oid, buf.Bytes())
+		}
+
+		json.NewEncoder(w).Encode(struct {
+			Missing []string `json:"missing"`
+		}{missing})
+	default:
+		w.WriteHeader(405)
+	}
+}
+
+var (
+	webdavLocks   = make(map[string]string)
+	webdavLocksMu sync.Mutex
+)
+
+// webdavHandler serves a WebDAV share, keeping files by path, with just what
+// the WebDAV transfer adapter asks of one: ranged PUTs, collections, locks and
+// MOVEs.
+func webdavHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := reqId(w)
+	if !ok {
+		return
+	}
+
+	debug(id, "webdav %s %s", r.Method, r.URL.Path)
+
+	webdavLocksMu.Lock()
+	token, locked := webdavLocks[r.URL.Path]
+	webdavLocksMu.Unlock()
+
+	switch r.Method {
+	case "HEAD", "GET":
+		by, ok := webdavFiles.Get("webdav", r.URL.Path)
+		if !ok {
+			w.WriteHeader(404)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(by)))
+		if r.Method == "GET" {
+			w.Write(by)
+		}
+	case "MKCOL":
+		w.WriteHeader(201)
+	case "LOCK":
+		if locked {
+			w.WriteHeader(423)
+			return
+		}
+		token = fmt.Sprintf("<opaquelocktoken:%s>", id)
+		webdavLocksMu.Lock()
+		webdavLocks[r.URL.Path] = token
+		webdavLocksMu.Unlock()
+		w.Header().Set("Lock-Token", token)
+		w.WriteHeader(200)
+	case "UNLOCK":
+		if !locked || r.Header.Get("Lock-Token") != token {
+			w.WriteHeader(409)
+			return
+		}
+		webdavLocksMu.Lock()
+		delete(webdavLocks, r.URL.Path)
+		webdavLocksMu.Unlock()
+		w.WriteHeader(204)
+	case "PUT":
+		if locked && !strings.Contains(r.Header.Get("If"), token) {
+			w.WriteHeader(423)
+			return
+		}
+		by, _ := ioutil.ReadAll(r.Body)
+		if rng := r.Header.Get("Content-Range"); len(rng) > 0 {
+			var start int
+			fmt.Sscanf(rng, "bytes %d-", &start)
+			existing, _ := webdavFiles.Get("webdav", r.URL.Path)
+			if start > len(existing) {
+				w.WriteHeader(416)
+				return
+			}
+			by = append(existing[:start:start], by...)
+		}
+		webdavFiles.Set("webdav", r.URL.Path, by)
+		w.WriteHeader(201)
+	case "MOVE":
+		dest := r.Header.Get("Destination")
+		if i := strings.Index(dest, "/webdav/"); i >= 0 {
+			dest = dest[i:]
+		}
+		webdavLocksMu.Lock()
+		destToken, destLocked := webdavLocks[dest]
+		webdavLocksMu.Unlock()
+		if destLocked && !strings.Contains(r.Header.Get("If"), destToken) {
+			w.WriteHeader(423)
+			return
+		}
+		by, ok := webdavFiles.Get("webdav", r.URL.Path)
+		if !ok {
+			w.WriteHeader(404)
+			return
+		}
+		webdavFiles.Set("webdav", dest, by)
+		webdavFiles.Delete("webdav", r.URL.Path)
+		w.WriteHeader(201)
+	default:
+		w.WriteHeader(405)
+	}
+}
+
+// ipfsHandler serves the parts of the RPC API of an IPFS node which the IPFS
+// transfer adapter uses, keeping files by their root CIDs, and a gateway
+// serving them.
+func ipfsHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := reqId(w)
+	if !ok {
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/ipfs-node")
+	cid := strings.TrimPrefix(r.URL.Query().Get("arg"), "/ipfs/")
+	debug(id, "ipfs %s %s %s", r.Method, path, cid)
+
+	switch {
+	case path == "/api/v0/add":
+		f, _, err := r.FormFile("data")
+		if err != nil || r.URL.Query().Get("raw-leaves") != "true" {
+			w.WriteHeader(400)
+			return
+		}
+		by, _ := ioutil.ReadAll(f)
+		dag := tq.NewIpfsDag()
+		dag.Write(by)
+		cid = dag.Cid()
+		ipfsFiles.Set("ipfs", cid, by)
+		json.NewEncoder(w).Encode(map[string]interface{}{"Name": "data", "Hash": cid, "Size": strconv.Itoa(len(by))})
+	case path == "/api/v0/files/stat":
+		by, ok := ipfsFiles.Get("ipfs", cid)
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(500)
+			w.Write([]byte(`{"Message":"block was not found locally (offline)","Code":0,"Type":"error"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"Hash": cid, "Size": len(by), "Local": true})
+	case path == "/api/v0/cat", strings.HasPrefix(path, "/ipfs/"):
+		if len(cid) == 0 {
+			cid = strings.TrimPrefix(path, "/ipfs/")
+		}
+		by, ok := ipfsFiles.Get("ipfs", cid)
+		if !ok {
+			w.WriteHeader(404)
+			return
+		}
+		w.Write(by)
+	default:
+		w.WriteHeader(404)
+	}
+}
+
 func storageHandler(w http.ResponseWriter, r *http.Request) {
 	id, ok := reqId(w)
 	if !ok {
@@ -421,6 +767,12 @@ func storageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	debug(id, "storage %s %s repo: %s", r.Method, oid, repo)
+	if oidHandlers[oid] == "rate-limit-storage" && rateLimited(r.Method, repo, oid) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(429)
+		return
+	}
+
 	switch r.Method {
 	case "PUT":
 		switch oidHandlers[oid] {
@@ -501,9 +853,20 @@ func storageHandler(w http.ResponseWriter, r *http.Request) {
 					statusCode = 500
 					by = []byte("malformed content")
 				}
-			} else if len(by) == len("status-batch-resume-206") && string(by) == "status-batch-resume-206" {
-				// Resume if header includes range, otherwise deliberately interrupt
-				if rangeHdr := r.Header.Get("Range"); rangeHdr != "" {
+			} else if string(by) == "status-batch-resume-206" || string(by) == "status-batch-resume-changed" {
+				// Resume if header includes range and If-Range matches
+				// the ETag, otherwise deliberately interrupt. The
+				// "changed" object gets a new ETag after the first
+				// request, so the whole object is sent instead.
+				etag := `"v1"`
+				if string(by) == "status-batch-resume-changed" && !firstRequest("resume-changed", repo, oid) {
+					etag = `"v2"`
+				}
+				w.Header().Set("ETag", etag)
+
+				if rangeHdr := r.Header.Get("Range"); rangeHdr == "" {
+					byteLimit = 10
+				} else if r.Header.Get("If-Range") == etag {
 					regex := regexp.MustCompile(`bytes=(\d+)\-.*`)
 					match := regex.FindStringSubmatch(rangeHdr)
 					if match != nil && len(match) > 1 {
@@ -511,8 +874,6 @@ func storageHandler(w http.ResponseWriter, r *http.Request) {
 						resumeAt, _ = strconv.ParseInt(match[1], 10, 32)
 						w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", resumeAt, len(by), resumeAt-int64(len(by))))
 					}
-				} else {
-					byteLimit = 10
 				}
 			} else if len(by) == len("batch-resume-fail-fallback") && string(by) == "batch-resume-fail-fallback" {
 				// Fail any Range: request even though we said we supported it
@@ -528,6 +889,15 @@ func storageHandler(w http.ResponseWriter, r *http.Request) {
 					batchResumeFailFallbackStorageAttempts++
 				}
 			}
+			if string(by) == "storage-download-corrupt" && firstRequest("corrupt", repo, oid) ||
+				strings.HasSuffix(repo, "-corrupt") {
+				// Serve contents of the right size which
+				// don't match the OID, only the first time
+				// for the object with these contents.
+				by = bytes.ToUpper(by)
+				w.Header().Set("X-Corrupt-Object", "true")
+			}
+
 			w.WriteHeader(statusCode)
 			if byteLimit > 0 {
 				w.Write(by[0:byteLimit])
@@ -554,6 +924,13 @@ func storageHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
 		w.WriteHeader(200)
+	case "OPTIONS":
+		// tus.io
+		w.Header().Set("Tus-Resumable", "1.0.0")
+		w.Header().Set("Tus-Version", "1.0.0")
+		w.Header().Set("Tus-Extension", "checksum")
+		w.Header().Set("Tus-Checksum-Algorithm", "sha1,sha256")
+		w.WriteHeader(204)
 	case "PATCH":
 		// tus.io
 		if !validateTusHeaders(r, id) {
@@ -563,6 +940,31 @@ func storageHandler(w http.ResponseWriter, r *http.Request) {
 		parts := strings.Split(r.URL.Path, "/")
 		oid := parts[len(parts)-1]
 
+		// Check the bytes sent against Upload-Checksum if given,
+		// corrupting the first upload of each object to repos ending
+		// in "-checksum-mismatch" to make sure the client retries.
+		var checksum hash.Hash
+		var expectedChecksum string
+		if hdr := r.Header.Get("Upload-Checksum"); len(hdr) > 0 {
+			fields := strings.Fields(hdr)
+			if len(fields) == 2 && fields[0] == "sha256" {
+				checksum = sha256.New()
+			} else if len(fields) == 2 && fields[0] == "sha1" {
+				checksum = sha1.New()
+			} else {
+				debug(id, "Unsupported Upload-Checksum %q", hdr)
+				w.WriteHeader(400)
+				return
+			}
+			expectedChecksum = fields[1]
+
+			body := io.Reader(r.Body)
+			if strings.HasSuffix(repo, "-checksum-mismatch") && firstRequest("tus-checksum", repo, oid) {
+				body = io.MultiReader(strings.NewReader("x"), body)
+			}
+			r.Body = ioutil.NopCloser(io.TeeReader(body, checksum))
+		}
+
 		offsetHdr := r.Header.Get("Upload-Offset")
 		offset, err := strconv.ParseInt(offsetHdr, 10, 64)
 		if err != nil {
@@ -616,6 +1018,14 @@ func storageHandler(w http.ResponseWriter, r *http.Request) {
 				largeObjects.SetIncomplete(repo, oid, b)
 			}
 			w.WriteHeader(500)
+		} else if checksum != nil && base64.StdEncoding.EncodeToString(checksum.Sum(nil)) != expectedChecksum {
+			// Checksum mismatch: discard the bytes sent, keeping
+			// any from an earlier upload to resume from.
+			debug(id, "Checksum mismatch uploading %v", oid)
+			if offset > 0 {
+				largeObjects.SetIncomplete(repo, oid, buf.Bytes()[:offset])
+			}
+			w.WriteHeader(460)
 		} else {
 			checkoid := hex.EncodeToString(hash.Sum(nil))
 			if checkoid != oid {
@@ -717,18 +1127,20 @@ type Committer struct {
 }
 
 type Lock struct {
-	Id         string    `json:"id"`
-	Path       string    `json:"path"`
-	Committer  Committer `json:"committer"`
-	CommitSHA  string    `json:"commit_sha"`
-	LockedAt   time.Time `json:"locked_at"`
-	UnlockedAt time.Time `json:"unlocked_at,omitempty"`
+	Id         string     `json:"id"`
+	Path       string     `json:"path"`
+	Committer  Committer  `json:"committer"`
+	CommitSHA  string     `json:"commit_sha"`
+	LockedAt   time.Time  `json:"locked_at"`
+	UnlockedAt time.Time  `json:"unlocked_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
 }
 
 type LockRequest struct {
 	Path               string    `json:"path"`
 	LatestRemoteCommit string    `json:"latest_remote_commit"`
 	Committer          Committer `json:"committer"`
+	ExpiresIn          int       `json:"expires_in,omitempty"`
 }
 
 type LockResponse struct {
@@ -753,6 +1165,19 @@ type LockList struct {
 	Err        string `json:"error,omitempty"`
 }
 
+type LockVerifiableRequest struct {
+	Committer Committer `json:"committer"`
+	Cursor    string    `json:"cursor,omitempty"`
+	Limit     int       `json:"limit,omitempty"`
+}
+
+type LockVerifiableList struct {
+	Ours       []Lock `json:"ours"`
+	Theirs     []Lock `json:"theirs"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Err        string `json:"error,omitempty"`
+}
+
 var (
 	lmu   sync.RWMutex
 	locks = []Lock{}
@@ -828,6 +1253,17 @@ func locksHandler(w http.ResponseWriter, r *http.Request) {
 				locks = filtered
 			}
 
+			if prefix := r.FormValue("path_prefix"); prefix != "" {
+				var filtered []Lock
+				for _, l := range locks {
+					if strings.HasPrefix(l.Path, prefix) {
+						filtered = append(filtered, l)
+					}
+				}
+
+				locks = filtered
+			}
+
 			if limit := r.FormValue("limit"); limit != "" {
 				size, err := strconv.Atoi(r.FormValue("limit"))
 				if err != nil {
@@ -835,16 +1271,15 @@ func locksHandler(w http.ResponseWriter, r *http.Request) {
 						Err: "unable to parse limit amount",
 					})
 				} else {
-					size = int(math.Min(float64(len(locks)), 3))
+					// The server returns, at most, three locks at a
+					// time.
+					size = int(math.Min(float64(size), 3))
 					if size < 0 {
 						locks = []Lock{}
-					} else {
+					} else if size < len(locks) {
+						ll.NextCursor = locks[size].Id
 						locks = locks[:size]
-						if size+1 < len(locks) {
-							ll.NextCursor = locks[size+1].Id
-						}
 					}
-
 				}
 			}
 
@@ -908,6 +1343,14 @@ func locksHandler(w http.ResponseWriter, r *http.Request) {
 				LockedAt:  time.Now(),
 			}
 
+			// Expired locks are still listed, as they would be by servers
+			// which release them lazily.
+			repo, _ := repoFromLfsUrl(r.URL.Path)
+			if lockRequest.ExpiresIn > 0 && !strings.Contains(repo, "lock-expiry-unsupported") {
+				expiresAt := lock.LockedAt.Add(time.Duration(lockRequest.ExpiresIn) * time.Second)
+				lock.ExpiresAt = &expiresAt
+			}
+
 			addLocks(*lock)
 
 			// TODO(taylor): commit_needed case
@@ -922,6 +1365,58 @@ func locksHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// locksVerifyHandler lists the locks held by the committer in the request,
+// separately from those held by others, three at a time.
+func locksVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	enc := json.NewEncoder(w)
+
+	var req LockVerifiableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		enc.Encode(&LockVerifiableList{Err: err.Error()})
+		return
+	}
+
+	locks := getLocks()
+	if len(req.Cursor) > 0 {
+		lastSeen := -1
+		for i, l := range locks {
+			if l.Id == req.Cursor {
+				lastSeen = i
+				break
+			}
+		}
+
+		if lastSeen < 0 {
+			enc.Encode(&LockVerifiableList{
+				Err: fmt.Sprintf("cursor (%s) not found", req.Cursor),
+			})
+			return
+		}
+		locks = locks[lastSeen:]
+	}
+
+	list := &LockVerifiableList{Ours: []Lock{}, Theirs: []Lock{}}
+
+	size := 3
+	if req.Limit > 0 && req.Limit < size {
+		size = req.Limit
+	}
+	if size < len(locks) {
+		list.NextCursor = locks[size].Id
+		locks = locks[:size]
+	}
+
+	for _, l := range locks {
+		if l.Committer.Email == req.Committer.Email {
+			list.Ours = append(list.Ours, l)
+		} else {
+			list.Theirs = append(list.Theirs, l)
+		}
+	}
+
+	enc.Encode(list)
+}
+
 func missingRequiredCreds(w http.ResponseWriter, r *http.Request, repo string) bool {
 	if repo != "requirecreds" {
 		return false
@@ -1004,6 +1499,17 @@ func (s *lfsStorage) Has(repo, oid string) bool {
 	return ok
 }
 
+func (s *lfsStorage) Oids(repo string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	oids := make([]string, 0, len(s.objects[repo]))
+	for oid := range s.objects[repo] {
+		oids = append(oids, oid)
+	}
+	return oids
+}
+
 func (s *lfsStorage) Set(repo, oid string, by []byte) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
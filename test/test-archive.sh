@@ -0,0 +1,80 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "archive: replaces pointers with contents"
+(
+  set -e
+
+  reponame="archive-contents"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  mkdir -p dir
+  printf "large file contents" > dir/a.dat
+  printf "small" > b.txt
+  ln -s b.txt link.txt
+  git add .gitattributes dir/a.dat b.txt link.txt
+  git commit -m "add files"
+  git tag v1
+  git push origin master
+
+  contents_oid="$(calc_oid "large file contents")"
+
+  # objects which aren't local are downloaded
+  rm -rf .git/lfs/objects
+
+  git lfs archive --prefix=release/ -o ../out.tar v1
+  mkdir ../tar && tar -xf ../out.tar -C ../tar
+  [ "large file contents" = "$(cat ../tar/release/dir/a.dat)" ]
+  [ "small" = "$(cat ../tar/release/b.txt)" ]
+  [ "b.txt" = "$(readlink ../tar/release/link.txt)" ]
+  assert_local_object "$contents_oid" 19
+
+  # git archive records the commit in the archive
+  [ "$(git rev-parse v1^{commit})" = "$(git get-tar-commit-id < ../out.tar)" ]
+
+  git lfs archive -o ../out.tgz master dir
+  mkdir ../tgz && tar -xzf ../out.tgz -C ../tgz
+  [ "large file contents" = "$(cat ../tgz/dir/a.dat)" ]
+  [ ! -e ../tgz/b.txt ]
+
+  git lfs archive --format=zip master > ../out.zip
+  mkdir ../zip && (cd ../zip && unzip -q ../out.zip)
+  [ "large file contents" = "$(cat ../zip/dir/a.dat)" ]
+  [ "small" = "$(cat ../zip/b.txt)" ]
+  [ "b.txt" = "$(readlink ../zip/link.txt)" ]
+)
+end_test
+
+begin_test "archive: fails without hanging when the archive can't be written"
+(
+  set -e
+
+  if [ ! -w /dev/full ]; then
+    echo "skip: needs /dev/full"
+    exit 0
+  fi
+
+  reponame="archive-write-error"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "large file contents" > a.dat
+  # more than fits in the pipe from git archive
+  head -c 1048576 /dev/urandom > big.bin
+  git add .gitattributes a.dat big.bin
+  git commit -m "add files"
+
+  set +e
+  timeout 60 git lfs archive -o /dev/full master 2>&1 | tee archive.log
+  res=${PIPESTATUS[0]}
+  set -e
+
+  [ "$res" != "0" ]
+  [ "$res" != "124" ]
+  grep "archive:" archive.log
+)
+end_test
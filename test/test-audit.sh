@@ -0,0 +1,73 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "audit: clean history"
+(
+  set -e
+
+  reponame="audit-clean"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  git lfs audit 2>&1 | tee audit.log
+  grep "Git LFS audit OK" audit.log
+)
+end_test
+
+begin_test "audit: problems in history"
+(
+  set -e
+
+  reponame="audit-problems"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "pushed" > pushed.dat
+  git add .gitattributes pushed.dat
+  git commit -m "add pushed.dat"
+  git push origin master
+
+  printf "unpushed" > unpushed.dat
+  git add unpushed.dat
+  git commit -m "add unpushed.dat"
+  unpushed_oid="$(calc_oid "unpushed")"
+
+  seq 1 1000 > big.bin
+  git add big.bin
+
+  # commit a pointer with a malformed oid, bypassing the clean filter
+  blob="$(printf "version https://git-lfs.github.com/spec/v1\noid sha256:xyz\nsize 3\n" | git hash-object -w --stdin)"
+  git update-index --add --cacheinfo 100644 "$blob" bad.dat
+  git commit -m "add big.bin and bad.dat"
+
+  set +e
+  git lfs audit --above=1k 2>&1 | tee audit.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" = "1" ]
+
+  grep "Large files not stored with Git LFS:" audit.log
+  grep "big.bin (" audit.log
+  grep "Malformed Git LFS pointers:" audit.log
+  grep "bad.dat (blob ${blob:0:7}): Invalid Oid" audit.log
+  grep "Git LFS objects missing from every remote:" audit.log
+  grep "unpushed.dat ($unpushed_oid), present locally" audit.log
+  grep "1 large file(s), 1 malformed pointer(s), 1 object(s) missing from every remote" audit.log
+  [ "0" = "$(grep "pushed.dat" audit.log | grep -vc unpushed)" ]
+
+  set +e
+  git lfs audit --skip-remotes HEAD~1 2>&1 | tee audit.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" = "0" ]
+  grep "Git LFS audit OK" audit.log
+)
+end_test
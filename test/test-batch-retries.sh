@@ -62,3 +62,95 @@ begin_test "batch storage download causes retries"
   popd
 )
 end_test
+
+begin_test "batch upload waits when rate limited"
+(
+  set -e
+
+  reponame="batch-upload-rate-limit"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" batch-upload-rate-limit
+
+  contents="rate-limit-batch"
+  oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+
+  git lfs track "*.dat"
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+
+  # rate limiting doesn't use up the retries of the objects in the batch
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  grep "tq: rate limited by" push.log
+
+  assert_server_object "$reponame" "$oid"
+)
+end_test
+
+begin_test "batch upload fails when rate limited too many times"
+(
+  set -e
+
+  reponame="batch-upload-rate-limit-exhausted"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  contents="rate-limit-batch"
+  oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+
+  git lfs track "*.dat"
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+
+  set +e
+  GIT_TRACE=1 git -c lfs.transfer.maxratelimitretries=1 push origin master 2>&1 | tee push.log
+  res=${PIPESTATUS[0]}
+  set -e
+
+  [ "$res" -ne 0 ]
+  grep "tq: refusing to retry \"$oid\", rate limited too many times (2)" push.log
+  refute_server_object "$reponame" "$oid"
+)
+end_test
+
+begin_test "storage upload and download wait when rate limited"
+(
+  set -e
+
+  reponame="storage-rate-limit"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" storage-rate-limit
+
+  contents="rate-limit-storage"
+  oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+
+  git lfs track "*.dat"
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  grep "tq: enqueue rate limited retry for \"$oid\"" push.log
+  [ "0" -eq "$(grep -c "tq: enqueue retry #" push.log)" ]
+
+  assert_server_object "$reponame" "$oid"
+
+  pushd ..
+    git \
+      -c "filter.lfs.process=" \
+      -c "filter.lfs.smudge=cat" \
+      -c "filter.lfs.required=false" \
+      clone "$GITSERVER/$reponame" "$reponame-assert"
+
+    cd "$reponame-assert"
+
+    git config credential.helper lfstest
+
+    GIT_TRACE=1 git lfs pull origin 2>&1 | tee pull.log
+    grep "tq: enqueue rate limited retry for \"$oid\"" pull.log
+
+    assert_local_object "$oid" "${#contents}"
+  popd
+)
+end_test
@@ -0,0 +1,88 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "blame-object: provenance and commits"
+(
+  set -e
+
+  reponame="blame-object"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.provenance.enabled true
+  git config lfs.provenance.tool "asset-exporter/3.1"
+  git config user.name "Pro Venance"
+  git config user.email "provenance@example.com"
+
+  git lfs track "*.dat"
+  printf "contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  oid="$(calc_oid "contents")"
+
+  git cat-file -p :a.dat | tee pointer.log
+  grep "version https://git-lfs.github.com/spec/v2" pointer.log
+  grep "provenance-by Pro Venance <provenance@example.com>" pointer.log
+  grep "provenance-time " pointer.log
+  grep "provenance-tool asset-exporter/3.1" pointer.log
+
+  # cleaning the same contents again gives the same pointer
+  touch a.dat
+  [ -z "$(git status --porcelain a.dat)" ]
+  cp a.dat b.dat
+  git add b.dat
+  [ "$(git rev-parse :a.dat)" = "$(git rev-parse :b.dat)" ]
+  git commit -m "copy a.dat"
+
+  git lfs blame-object "${oid:0:10}" 2>&1 | tee blame.log
+  grep "Object $oid (8 B)" blame.log
+  grep "cleaned by Pro Venance <provenance@example.com>, at .*, with asset-exporter/3.1" blame.log
+  grep "introduced in $(git rev-parse --short HEAD~1) by .*: a.dat (add a.dat)" blame.log
+  grep "also added in $(git rev-parse --short HEAD) by .*: b.dat (copy a.dat)" blame.log
+
+  git push origin master
+
+  # clones without provenance enabled check out the pointers, and keep their
+  # provenance when the files are cleaned again
+  cd ..
+  clone_repo "$reponame" "$reponame-clone"
+  [ "contents" = "$(cat a.dat)" ]
+  touch a.dat
+  [ -z "$(git status --porcelain a.dat)" ]
+
+  set +e
+  git lfs blame-object 0000000 2>&1 | tee blame.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" = "1" ]
+  grep "0000000: no pointer to this object in any commit" blame.log
+)
+end_test
+
+begin_test "blame-object: provenance is opt-in"
+(
+  set -e
+
+  reponame="blame-object-opt-in"
+  git init "$reponame"
+  cd "$reponame"
+
+  git lfs track "*.dat"
+  printf "contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  [ "0" = "$(git cat-file -p :a.dat | grep -c provenance)" ]
+
+  # objects already stored aren't given provenance once it's enabled, which
+  # would change their pointers
+  git config lfs.provenance.enabled true
+  touch a.dat
+  [ -z "$(git status --porcelain a.dat)" ]
+
+  git lfs blame-object "$(calc_oid "contents")" 2>&1 | tee blame.log
+  [ "0" = "$(grep -c "cleaned by" blame.log)" ]
+  grep "introduced in .*: a.dat (add a.dat)" blame.log
+)
+end_test
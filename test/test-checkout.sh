@@ -119,3 +119,212 @@ begin_test "checkout: outside git repository"
   grep "Not in a git repository" checkout.log
 )
 end_test
+
+begin_test "checkout: conflicts"
+(
+  set -e
+
+  reponame="checkout-conflicts"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "base" > file.dat
+  git add .gitattributes file.dat
+  git commit -m "base"
+
+  git checkout -b theirs
+  printf "theirs" > file.dat
+  git add file.dat
+  git commit -m "theirs"
+
+  git checkout master
+  printf "ours" > file.dat
+  git add file.dat
+  git commit -m "ours"
+  git push origin master theirs
+
+  set +e
+  git merge theirs
+  set -e
+
+  git lfs checkout --to base.dat --base file.dat
+  git lfs checkout --to ours.dat --ours file.dat
+  git lfs checkout --to theirs.dat --theirs file.dat
+  [ "base" = "$(cat base.dat)" ]
+  [ "ours" = "$(cat ours.dat)" ]
+  [ "theirs" = "$(cat theirs.dat)" ]
+
+  # objects which aren't local are downloaded
+  rm -rf .git/lfs/objects
+  mkdir -p subdir
+  cd subdir
+  git lfs checkout --to ../theirs2.dat --theirs ../file.dat
+  [ "theirs" = "$(cat ../theirs2.dat)" ]
+  cd ..
+
+  set +e
+  git lfs checkout --to none.dat --ours .gitattributes 2>&1 | tee checkout.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" = "2" ]
+  grep "is it in conflict?" checkout.log
+
+  set +e
+  git lfs checkout --to both.dat --ours --theirs file.dat 2>&1 | tee checkout.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" = "2" ]
+  grep "only one of --base, --ours or --theirs" checkout.log
+)
+end_test
+
+begin_test "checkout: hardlink mode"
+(
+  set -e
+
+  reponame="checkout-hardlink"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents="a"
+  contents_oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  printf "$contents" > b.dat
+  printf "$contents" > exec.dat
+  chmod +x exec.dat
+  git add .gitattributes a.dat b.dat exec.dat
+  git commit -m "add files"
+
+  rm a.dat b.dat
+  git cat-file -p :exec.dat > exec.dat
+  git config lfs.checkoutmode hardlink
+  git lfs checkout
+
+  object=".git/lfs/objects/${contents_oid:0:2}/${contents_oid:2:2}/$contents_oid"
+  inode="$(ls -i "$object" | awk '{print $1}')"
+  [ "$inode" = "$(ls -i a.dat | awk '{print $1}')" ]
+  [ "$inode" = "$(ls -i b.dat | awk '{print $1}')" ]
+  [ "$inode" != "$(ls -i exec.dat | awk '{print $1}')" ]
+  [ "$contents" = "$(cat a.dat)" ]
+  [ "$contents" = "$(cat exec.dat)" ]
+  # the object is read-only, so that it can't be modified through the links
+  ls -l "$object" | grep "^-r--r--r--"
+
+  # the files aren't seen as modified
+  [ -z "$(git status --porcelain -uno)" ]
+
+  # unless it is made writable, which is noticed when linking to it again
+  chmod u+w a.dat
+  printf "b" > a.dat
+  rm b.dat
+
+  git lfs checkout 2>&1 | tee checkout.log
+  grep "Object $contents_oid was modified through a hard link to it" checkout.log
+  [ -f ".git/lfs/bad/$contents_oid" ]
+  [ ! -f "$object" ]
+  [ ! -f b.dat ]
+)
+end_test
+
+begin_test "checkout: reflink mode falls back to copying"
+(
+  set -e
+
+  reponame="checkout-reflink"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents="a"
+  contents_oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  rm a.dat
+
+  git config lfs.checkoutmode reflink
+  git lfs checkout
+
+  object=".git/lfs/objects/${contents_oid:0:2}/${contents_oid:2:2}/$contents_oid"
+  [ "$(ls -i "$object" | awk '{print $1}')" != "$(ls -i a.dat | awk '{print $1}')" ]
+  [ "$contents" = "$(cat a.dat)" ]
+  [ -z "$(git status --porcelain -uno)" ]
+
+  git config lfs.checkoutmode bogus
+  rm a.dat
+  git lfs checkout 2>&1 | tee checkout.log
+  grep "Unknown lfs.checkoutmode \"bogus\"" checkout.log
+  [ "$contents" = "$(cat a.dat)" ]
+)
+end_test
+
+begin_test "checkout: warns about pointers which aren't tracked"
+(
+  set -e
+
+  reponame="checkout-untracked"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat" "*.bin"
+  printf "tracked" > a.dat
+  printf "untracked" > a.bin
+  git add .gitattributes a.dat a.bin
+  git commit -m "add files"
+
+  git lfs untrack "*.bin"
+  git add .gitattributes
+  git commit -m "untrack *.bin"
+
+  rm a.dat a.bin
+  git checkout -- a.dat a.bin
+  git lfs checkout 2>&1 | tee checkout.log
+  grep "Warning: a.bin is a Git LFS pointer, but isn't tracked by Git LFS" checkout.log
+  [ "0" -eq "$(grep -c "a.dat" checkout.log)" ]
+  [ "untracked" = "$(cat a.bin)" ]
+
+  # not when it is tracked by the global attributes file
+  printf "*.bin filter=lfs diff=lfs merge=lfs -text\n" > ../attributes
+  git config core.attributesFile "$(cd .. && pwd)/attributes"
+  git reset -q
+  rm a.bin
+  GIT_LFS_SKIP_SMUDGE=1 git checkout -- a.bin
+  git lfs checkout 2>&1 | tee checkout.log
+  [ "untracked" = "$(cat a.bin)" ]
+  [ "0" -eq "$(grep -c "Warning" checkout.log)" ]
+)
+end_test
+
+begin_test "checkout --stdin"
+(
+  set -e
+
+  reponame="checkout-stdin"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents="a"
+  printf "$contents" > a.dat
+  printf "b" > b.dat
+  printf "not lfs" > c.txt
+  git add .gitattributes a.dat b.dat c.txt
+  git commit -m "add files"
+
+  # leave both files as pointers, and b.dat's object not local
+  b_oid="$(calc_oid "b")"
+  rm ".git/lfs/objects/${b_oid:0:2}/${b_oid:2:2}/$b_oid"
+  git show HEAD:a.dat > a.dat
+  git show HEAD:b.dat > b.dat
+
+  printf "a.dat\0b.dat\0c.txt\0a.dat" | git lfs checkout --stdin > checkout.out
+  [ "$contents" = "$(cat a.dat)" ]
+  [ "$(tr '\0' '\n' < checkout.out)" = "$(printf "ok a.dat\nmissing b.dat\nuntracked c.txt\nskipped a.dat")" ]
+
+  git lfs checkout --stdin a.dat 2>&1 | tee checkout.log
+  grep "can't be combined with paths" checkout.log
+)
+end_test
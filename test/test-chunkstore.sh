@@ -0,0 +1,164 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+# count_chunks prints the number of chunks in the chunk store.
+count_chunks() {
+  find .git/lfs/chunks -type f -not -path "*/manifests/*" -not -name "tmp-*" | wc -l | tr -d " "
+}
+
+begin_test "chunkstore: objects are stored as chunks"
+(
+  set -e
+
+  reponame="chunkstore-local"
+  git init "$reponame"
+  cd "$reponame"
+
+  git config lfs.chunkstore true
+  git lfs track "*.bin"
+
+  head -c 1048576 /dev/urandom > a.bin
+  cp a.bin b.bin
+  printf "a few more bytes" >> b.bin
+  cp a.bin "$TRASHDIR/a.bin.orig"
+
+  a_oid="$(calc_oid_file a.bin)"
+  b_oid="$(calc_oid_file b.bin)"
+
+  git add .gitattributes a.bin
+  [ ! -e ".git/lfs/objects/${a_oid:0:2}/${a_oid:2:2}/$a_oid" ]
+  [ -f ".git/lfs/chunks/manifests/${a_oid:0:2}/${a_oid:2:2}/$a_oid" ]
+  before="$(count_chunks)"
+
+  git add b.bin
+  git commit -m "add a.bin and b.bin"
+  [ -f ".git/lfs/chunks/manifests/${b_oid:0:2}/${b_oid:2:2}/$b_oid" ]
+  after="$(count_chunks)"
+  [ "$after" -le "$((before + 2))" ]
+
+  rm a.bin b.bin
+  git checkout -- a.bin b.bin
+  cmp a.bin "$TRASHDIR/a.bin.orig"
+  [ "$b_oid" = "$(calc_oid_file b.bin)" ]
+
+  git lfs fsck | tee fsck.log
+  grep "Git LFS fsck OK" fsck.log
+)
+end_test
+
+begin_test "chunkstore: chunked transfers only send missing chunks"
+(
+  set -e
+
+  reponame="chunkstore-transfer"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.chunkstore true
+  git lfs track "*.bin"
+
+  head -c 1048576 /dev/urandom > a.bin
+  a_oid="$(calc_oid_file a.bin)"
+  git add .gitattributes a.bin
+  git commit -m "add a.bin"
+
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  grep "xfer: chunked upload of \"$a_oid\" sent 1048576 of 1048576 bytes" push.log
+  assert_server_object "$reponame" "$a_oid"
+
+  cp a.bin b.bin
+  printf "a few more bytes" >> b.bin
+  b_oid="$(calc_oid_file b.bin)"
+  git add b.bin
+  git commit -m "add b.bin"
+
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  sent="$(grep "xfer: chunked upload of \"$b_oid\" sent" push.log | sed -e "s/.* sent \([0-9]*\) of.*/\1/")"
+  [ "$sent" -lt 524288 ]
+  assert_server_object "$reponame" "$b_oid"
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 git clone "$GITSERVER/$reponame" "$reponame-clone"
+  cd "$reponame-clone"
+  git config lfs.chunkstore true
+  git config lfs.concurrenttransfers 1
+
+  GIT_TRACE=1 git lfs pull 2>&1 | tee pull.log
+  fetched="$(grep "xfer: chunked download of" pull.log | sed -e "s/.* fetched \([0-9]*\) of.*/\1/" | awk '{ s += $1 } END { print s }')"
+  [ "$fetched" -lt 1572864 ]
+
+  [ "$a_oid" = "$(calc_oid_file a.bin)" ]
+  [ "$b_oid" = "$(calc_oid_file b.bin)" ]
+  [ ! -e ".git/lfs/objects/${a_oid:0:2}/${a_oid:2:2}/$a_oid" ]
+  [ ! -e ".git/lfs/objects/${b_oid:0:2}/${b_oid:2:2}/$b_oid" ]
+)
+end_test
+
+begin_test "chunkstore: whole objects for servers without chunked transfers"
+(
+  set -e
+
+  reponame="chunked-basic-server"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.chunkstore true
+  git lfs track "*.bin"
+
+  head -c 102400 /dev/urandom > a.bin
+  oid="$(calc_oid_file a.bin)"
+  git add .gitattributes a.bin
+  git commit -m "add a.bin"
+  [ ! -e ".git/lfs/objects/${oid:0:2}/${oid:2:2}/$oid" ]
+
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  grep "xfer: reassembling \"$oid\" from its chunks to upload it" push.log
+  assert_server_object "$reponame" "$oid"
+
+  # prune moves the reassembled object back to the chunk store
+  [ -f ".git/lfs/objects/${oid:0:2}/${oid:2:2}/$oid" ]
+  git lfs prune 2>&1 | tee prune.log
+  grep "Moved 1 files to the chunk store" prune.log
+  [ ! -e ".git/lfs/objects/${oid:0:2}/${oid:2:2}/$oid" ]
+
+  rm a.bin
+  git checkout -- a.bin
+  [ "$oid" = "$(calc_oid_file a.bin)" ]
+)
+end_test
+
+begin_test "chunkstore: prune deletes unused chunks"
+(
+  set -e
+
+  reponame="chunkstore-prune"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.chunkstore true
+  git config lfs.fetchrecentrefsdays 0
+  git config lfs.fetchrecentcommitsdays 0
+  git lfs track "*.bin"
+
+  head -c 102400 /dev/urandom > a.bin
+  old_oid="$(calc_oid_file a.bin)"
+  git add .gitattributes a.bin
+  git commit -m "add a.bin"
+
+  head -c 102400 /dev/urandom > a.bin
+  new_oid="$(calc_oid_file a.bin)"
+  git add a.bin
+  git commit -m "replace a.bin"
+  git push origin master
+
+  git lfs prune --verify-remote 2>&1 | tee prune.log
+  grep "Pruning 1 files" prune.log
+  grep "Deleted [0-9]* unused chunks" prune.log
+  [ ! -e ".git/lfs/chunks/manifests/${old_oid:0:2}/${old_oid:2:2}/$old_oid" ]
+
+  rm a.bin
+  git checkout -- a.bin
+  [ "$new_oid" = "$(calc_oid_file a.bin)" ]
+)
+end_test
@@ -218,6 +218,7 @@ begin_test "clone with flags"
   # specific test for --bare
   git lfs clone --bare "$GITSERVER/$reponame" "$newclonedir"
   [ -d "$newclonedir/objects" ]
+  rm -rf "$newclonedir"
 
   # short flags
   git lfs clone -l -v -n -s -b branch2 "$GITSERVER/$reponame" "$newclonedir"
@@ -504,3 +505,72 @@ begin_test "clone in current directory"
   popd
 )
 end_test
+
+begin_test "clone with --reference"
+(
+  set -e
+
+  reponame="clone_with_reference"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents="reference"
+  contents_oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+  git push origin master
+
+  cd "$TRASHDIR"
+
+  # nothing is downloaded, so the server isn't needed
+  for flags in "" "--dissociate"; do
+    rm -rf "$reponame-clone"
+    git -c lfs.url="http://127.0.0.1:1/$reponame" lfs clone --reference "$reponame" $flags "$GITSERVER/$reponame" "$reponame-clone" 2>&1 | tee clone.log
+    grep "files)" clone.log && exit 1
+
+    pushd "$reponame-clone"
+      [ "$contents" = "$(cat a.dat)" ]
+      assert_local_object "$contents_oid" 9
+    popd
+  done
+  [ ! -e "$reponame-clone/.git/objects/info/alternates" ]
+
+  # git lfs pull takes objects from the reference repository too
+  rm -rf "$reponame-clone"
+  git clone --reference "$reponame" "$GITSERVER/$reponame" "$reponame-clone"
+  cd "$reponame-clone"
+  rm -rf .git/lfs/objects a.dat
+  git -c lfs.url="http://127.0.0.1:1/$reponame" lfs pull 2>&1 | tee pull.log
+  grep "files)" pull.log && exit 1
+  [ "$contents" = "$(cat a.dat)" ]
+  assert_local_object "$contents_oid" 9
+)
+end_test
+
+begin_test "clone with clone.defaultRemoteName"
+(
+  set -e
+
+  reponame="clone_default_remote_name"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents="upstream"
+  contents_oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "initial commit"
+  git push origin master
+
+  cd "$TRASHDIR"
+  git -c clone.defaultRemoteName=upstream lfs clone "$GITSERVER/$reponame" "$reponame-clone"
+
+  cd "$reponame-clone"
+  git remote get-url upstream
+  [ "$contents" = "$(cat a.dat)" ]
+  assert_local_object "$contents_oid" 8
+)
+end_test
@@ -0,0 +1,58 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+# includeIf.onbranch was added in git 2.23.0
+ensure_git_version_isnt $VERSION_LOWER "2.23.0"
+
+begin_test "lfsconfig includes"
+(
+  set -e
+
+  reponame="lfsconfig-includes"
+  mkdir $reponame
+  cd $reponame
+  git init
+  git commit --allow-empty -m "initial commit"
+
+  git config --file=.lfsconfig-all lfs.url http://included
+  git config --file=.lfsconfig include.path .lfsconfig-all
+  git lfs env | tee env.log
+  grep "Endpoint=http://included (auth=none)" env.log
+
+  git config --file=.lfsconfig-release lfs.url http://release-included
+  git config --file=.lfsconfig "includeIf.onbranch:release/*.path" .lfsconfig-release
+  git lfs env | tee env.log
+  grep "Endpoint=http://included (auth=none)" env.log
+
+  git checkout -b release/1.0
+  git lfs env | tee env.log
+  grep "Endpoint=http://release-included (auth=none)" env.log
+
+  # unsafe keys are ignored in included files, too
+  git config --file=.lfsconfig-release lfs.extension.foo.clean "foo-clean"
+  git lfs ext | tee ext.log
+  [ "0" -eq "$(grep -c "foo-clean" ext.log)" ]
+)
+end_test
+
+begin_test "lfsconfig per-ref urls"
+(
+  set -e
+
+  reponame="lfsconfig-per-ref-urls"
+  mkdir $reponame
+  cd $reponame
+  git init
+  git commit --allow-empty -m "initial commit"
+
+  git config --file=.lfsconfig lfs.url http://default
+  git config --file=.lfsconfig "lfs.refs/heads/release/*.url" http://release
+  git lfs env | tee env.log
+  grep "Endpoint=http://default (auth=none)" env.log
+
+  git checkout -b release/1.0
+  git lfs env | tee env.log
+  grep "Endpoint=http://release (auth=none)" env.log
+)
+end_test
@@ -135,3 +135,50 @@ begin_test "url alias must be prefix"
   grep "Endpoint=badalias:rest (auth=none)" env.log
 )
 end_test
+
+begin_test "lfs.pullurl fetches from a mirror and pushes to the server"
+(
+  set -e
+
+  reponame="config-pullurl"
+  setup_remote_repo "$reponame"
+  setup_remote_repo "$reponame-mirror"
+  clone_repo "$reponame" "$reponame"
+
+  mirrorurl="$GITSERVER/$reponame-mirror.git/info/lfs"
+  git config lfs.pullurl "$mirrorurl"
+  git lfs env | tee env.log
+  grep "Endpoint=$mirrorurl (auth=none)" env.log
+
+  git lfs track "*.dat"
+  printf "pulled" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  oid="$(calc_oid "pulled")"
+  assert_server_object "$reponame" "$oid"
+  refute_server_object "$reponame-mirror" "$oid"
+
+  git -c lfs.url="$mirrorurl" lfs push origin --object-id "$oid"
+  assert_server_object "$reponame-mirror" "$oid"
+
+  # the fetch is sent to the mirror, so it succeeds when only the mirror has
+  # the object
+  delete_server_object "$reponame" "$oid"
+  rm -rf .git/lfs/objects
+  git lfs fetch origin master
+  assert_local_object "$oid" 6
+
+  # locks are kept by the server, so every lock operation is sent to it
+  GITLFSLOCKSENABLED=1 git lfs lock "a.dat" | tee lock.log
+  id=$(grep -oh "\((.*)\)" lock.log | tr -d "()")
+  assert_server_lock "$reponame" "$id"
+
+  GITLFSLOCKSENABLED=1 git lfs locks --path "a.dat" | tee locks.log
+  grep "1 lock(s) matched query" locks.log
+
+  GITLFSLOCKSENABLED=1 git lfs unlock "a.dat"
+  refute_server_lock "$reponame" "$id"
+)
+end_test
@@ -0,0 +1,105 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "corrupt download: quarantined and retried"
+(
+  set -e
+
+  reponame="corrupt-download-retry"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents="storage-download-corrupt"
+  contents_oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+  assert_server_object "$reponame" "$contents_oid"
+
+  rm -rf .git/lfs/objects
+
+  GIT_TRACE=1 git lfs fetch origin master 2>&1 | tee fetch.log
+  grep "xfer: quarantined corrupt download of \"$contents_oid\"" fetch.log
+  grep "tq: retrying object $contents_oid" fetch.log
+  assert_local_object "$contents_oid" "${#contents}"
+
+  [ "2" -eq "$(ls .git/lfs/quarantine | wc -l)" ]
+  quarantined="$(ls .git/lfs/quarantine/$contents_oid-* | grep -v ".txt$")"
+  [ "STORAGE-DOWNLOAD-CORRUPT" = "$(cat "$quarantined")" ]
+
+  cat "$quarantined.txt"
+  grep "expected oid: $contents_oid" "$quarantined.txt"
+  grep "actual oid: $(calc_oid "STORAGE-DOWNLOAD-CORRUPT")" "$quarantined.txt"
+  grep "bytes received: ${#contents}" "$quarantined.txt"
+  grep "url: $GITSERVER/storage/$contents_oid" "$quarantined.txt"
+  grep "status: 200 OK" "$quarantined.txt"
+  grep "  X-Corrupt-Object: true" "$quarantined.txt"
+
+  [ ! -e ".git/lfs/objects/incomplete/$contents_oid.tmp" ]
+)
+end_test
+
+begin_test "corrupt download: retried from mirror"
+(
+  set -e
+
+  reponame="corrupt-download-mirror"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents="a"
+  contents_oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+  assert_server_object "$reponame" "$contents_oid"
+
+  # the server corrupts every download from repositories named "*-corrupt"
+  git config lfs.url "$GITSERVER/$reponame-corrupt.git/info/lfs"
+  git lfs push --object-id origin "$contents_oid"
+  assert_server_object "$reponame-corrupt" "$contents_oid"
+
+  git config lfs.mirrorurl "$GITSERVER/$reponame.git/info/lfs"
+  rm -rf .git/lfs/objects
+
+  GIT_TRACE=1 git lfs fetch origin master 2>&1 | tee fetch.log
+  [ "1" -eq "$(grep -c "xfer: quarantined corrupt download" fetch.log)" ]
+  grep "endpoint: switching from $GITSERVER/$reponame-corrupt.git/info/lfs to $GITSERVER/$reponame.git/info/lfs" fetch.log
+  assert_local_object "$contents_oid" 1
+)
+end_test
+
+begin_test "corrupt download: fails without a mirror"
+(
+  set -e
+
+  reponame="corrupt-download-fail"
+  setup_remote_repo "$reponame-corrupt"
+  clone_repo "$reponame-corrupt" "$reponame"
+
+  git lfs track "*.dat"
+  contents="a"
+  contents_oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+  assert_server_object "$reponame-corrupt" "$contents_oid"
+
+  rm -rf .git/lfs/objects
+
+  set +e
+  git lfs fetch origin master 2>&1 | tee fetch.log
+  res="${PIPESTATUS[0]}"
+  set -e
+
+  [ "0" != "$res" ]
+  grep "Expected OID $contents_oid" fetch.log
+  refute_local_object "$contents_oid"
+)
+end_test
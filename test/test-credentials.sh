@@ -292,3 +292,71 @@ begin_test "credentials from remote.origin.url"
   grep "(1 of 1 files)" fetch.log
 )
 end_test
+
+begin_test "credentials are filled once per push"
+(
+  set -e
+
+  reponame="credentials-cached"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  for i in 1 2 3 4 5; do
+    echo "cached $i" > "$i.dat"
+  done
+  git add .gitattributes *.dat
+  git commit -m "add 5 files"
+
+  GIT_TRACE=1 git lfs push origin master 2>&1 | tee push.log
+  grep "(5 of 5 files)" push.log
+  [ "1" -eq "$(grep -cE "creds: git credential fill" push.log)" ]
+  [ "1" -eq "$(grep -cE "creds: git credential approve" push.log)" ]
+
+  echo "uncached 6" > 6.dat
+  echo "uncached 7" > 7.dat
+  git add 6.dat 7.dat
+  git commit -m "add 2 files"
+
+  git config lfs.cachecredentials false
+  GIT_TRACE=1 git lfs push origin master 2>&1 | tee push.log
+  grep "Uploaded 2 files" push.log
+  [ "1" -lt "$(grep -cE "creds: git credential fill" push.log)" ]
+)
+end_test
+
+begin_test "credentials cached across invocations with lfs.credentialcachetimeout"
+(
+  set -e
+
+  if [[ $(uname) == *"MINGW"* ]]; then
+    echo "skip: git credential-cache isn't supported on Windows"
+    exit 0
+  fi
+
+  reponame="credentials-cache-daemon"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.credentialcachetimeout 60
+
+  git lfs track "*.dat"
+  echo "daemon a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  GIT_TRACE=1 git lfs push origin master 2>&1 | tee push.log
+  grep "Uploaded 1 files" push.log
+  [ "1" -eq "$(grep -c "creds: git credential fill" push.log)" ]
+
+  echo "daemon b" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+
+  GIT_TRACE=1 git lfs push origin master 2>&1 | tee push.log
+  git credential-cache exit || true
+  grep "Uploaded 1 files" push.log
+  grep "creds: filled from credential-cache daemon" push.log
+  [ "0" -eq "$(grep -c "creds: git credential fill" push.log)" ]
+)
+end_test
@@ -94,6 +94,8 @@ begin_test "custom-transfer-upload-download"
   grep "xfer: started custom adapter process" pushcustom.log
   grep "xfer\[lfstest-customadapter\]:" pushcustom.log
   grep "11 of 11 files" pushcustom.log
+  # the adapter reports each object committed once the server has stored it
+  grep "8.16 KB committed" pushcustom.log
 
   rm -rf .git/lfs/objects
   GIT_TRACE=1 git lfs fetch --all  2>&1 | tee fetchcustom.log
@@ -106,3 +108,104 @@ begin_test "custom-transfer-upload-download"
 
 )
 end_test
+
+begin_test "custom-transfer restarts crashed and hung adapters"
+(
+  set -e
+
+  reponame="test-custom-transfer-restart"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" $reponame
+
+  git config lfs.customtransfer.testcustom.path lfstest-customadapter
+  git config lfs.customtransfer.testcustom.concurrent false
+  git config lfs.customtransfer.testcustom.timeout 2
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  printf "b" > b.dat
+  git add .gitattributes a.dat b.dat
+  git commit -m "add files"
+
+  export LFSTEST_CUSTOM_ADAPTER_FAIL=crash
+  export LFSTEST_CUSTOM_ADAPTER_FAIL_MARKER="$TRASHDIR/$reponame-crashed"
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  [ ${PIPESTATUS[0]} = "0" ]
+  grep "Crashing on purpose" push.log
+  grep "xfer: restarting custom adapter process \"lfstest-customadapter\" for worker 0 (1 of 3)" push.log
+  assert_server_object "$reponame" "$(calc_oid "a")"
+  assert_server_object "$reponame" "$(calc_oid "b")"
+
+  rm -rf .git/lfs/objects
+  export LFSTEST_CUSTOM_ADAPTER_FAIL=hang
+  export LFSTEST_CUSTOM_ADAPTER_FAIL_MARKER="$TRASHDIR/$reponame-hung"
+  GIT_TRACE=1 git lfs fetch 2>&1 | tee fetch.log
+  [ ${PIPESTATUS[0]} = "0" ]
+  grep "Hanging on purpose" fetch.log
+  grep "sent nothing for 2s" fetch.log
+  assert_local_object "$(calc_oid "a")" 1
+  assert_local_object "$(calc_oid "b")" 1
+
+  # without restarts, the crash fails the fetch
+  rm -rf .git/lfs/objects
+  git config lfs.customtransfer.testcustom.restarts 0
+  export LFSTEST_CUSTOM_ADAPTER_FAIL=crash
+  export LFSTEST_CUSTOM_ADAPTER_FAIL_MARKER="$TRASHDIR/$reponame-crashed-again"
+  GIT_TRACE=1 git lfs fetch 2>&1 | tee fetch.log
+  [ ${PIPESTATUS[0]} != "0" ]
+  [ "0" = "$(grep -c "restarting custom adapter process" fetch.log)" ]
+)
+end_test
+
+begin_test "custom-transfer sandbox"
+(
+  set -e
+
+  reponame="test-custom-transfer-sandbox"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" $reponame
+
+  git config lfs.customtransfer.testcustom.path lfstest-customadapter
+  git config lfs.customtransfer.testcustom.concurrent false
+  git config lfs.customtransfer.testcustom.workdir adapters/testcustom
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  export LFSTEST_SECRET=hunter2
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  [ ${PIPESTATUS[0]} = "0" ]
+  grep "Working directory: .*/.git/lfs/adapters/testcustom" push.log
+  grep "LFSTEST_SECRET=hunter2" push.log
+
+  # a restricted environment only has the variables passed explicitly, such
+  # as those the test credential helper needs
+  printf "b" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+  git config lfs.customtransfer.testcustom.cleanenv true
+  git config lfs.customtransfer.testcustom.passenv CREDSDIR
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  [ ${PIPESTATUS[0]} = "0" ]
+  grep "LFSTEST_SECRET=$" push.log
+
+  printf "c" > c.dat
+  git add c.dat
+  git commit -m "add c.dat"
+  git config lfs.customtransfer.testcustom.passenv "CREDSDIR, LFSTEST_SECRET"
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  [ ${PIPESTATUS[0]} = "0" ]
+  grep "LFSTEST_SECRET=hunter2" push.log
+
+  # an adapter which can't start within its memory limit fails the push
+  printf "d" > d.dat
+  git add d.dat
+  git commit -m "add d.dat"
+  git config lfs.customtransfer.testcustom.maxmemory 1m
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  [ ${PIPESTATUS[0]} != "0" ]
+  grep "ulimit -v 1024" push.log
+)
+end_test
@@ -0,0 +1,79 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "daemon: materializes files and prefetches objects on request"
+(
+  set -e
+
+  reponame="daemon"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents_a="a"
+  contents_a_oid="$(calc_oid "$contents_a")"
+  contents_b="b"
+  contents_b_oid="$(calc_oid "$contents_b")"
+  printf "$contents_a" > a.dat
+  printf "$contents_b" > b.dat
+  printf "not lfs" > c.txt
+  git add .gitattributes a.dat b.dat c.txt
+  git commit -m "add files"
+  git push origin master
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-clone"
+  refute_local_object "$contents_a_oid"
+  refute_local_object "$contents_b_oid"
+
+  (umask 022 && exec git lfs daemon > daemon.log 2>&1) &
+  daemon=$!
+  trap "kill $daemon 2>/dev/null || true" EXIT
+
+  socket=".git/lfs/daemon.sock"
+  for i in $(seq 1 50); do
+    [ -S "$socket" ] && break
+    sleep 0.1
+  done
+  [ -S "$socket" ]
+
+  printf '%s\n' \
+    '{"op":"present","path":"a.dat"}' \
+    '{"op":"materialize","path":"a.dat"}' \
+    '{"op":"present","path":"a.dat"}' \
+    '{"op":"present","path":"c.txt"}' \
+    '{"op":"materialize","path":"a.dat"}' \
+    '{"op":"bogus"}' | lfstest-daemonclient "$socket" | tee responses.log
+
+  # the socket is only open to the user, whatever the umask
+  [ "srw-------" = "$(ls -l "$socket" | cut -c1-10)" ]
+
+  [ "$(sed -n 1p responses.log)" = "{\"result\":\"absent\",\"oid\":\"$contents_a_oid\"}" ]
+  [ "$(sed -n 2p responses.log)" = "{\"result\":\"ok\",\"oid\":\"$contents_a_oid\"}" ]
+  [ "$(sed -n 3p responses.log)" = "{\"result\":\"present\",\"oid\":\"$contents_a_oid\"}" ]
+  [ "$(sed -n 4p responses.log)" = '{"result":"untracked"}' ]
+  [ "$(sed -n 5p responses.log)" = "{\"result\":\"skipped\",\"oid\":\"$contents_a_oid\"}" ]
+  [ "$(sed -n 6p responses.log)" = '{"error":"unknown op \"bogus\""}' ]
+  [ "$contents_a" = "$(cat a.dat)" ]
+  [ -z "$(git status --porcelain -uno)" ]
+
+  echo '{"op":"prefetch","paths":["a.dat","b.dat","c.txt"]}' | lfstest-daemonclient "$socket" | tee prefetch.log
+  [ '{"result":"queued","queued":1}' = "$(cat prefetch.log)" ]
+  for i in $(seq 1 50); do
+    [ -f ".git/lfs/objects/${contents_b_oid:0:2}/${contents_b_oid:2:2}/$contents_b_oid" ] && break
+    sleep 0.1
+  done
+  assert_local_object "$contents_b_oid" 1
+  # prefetching leaves the file alone
+  git cat-file -p ":b.dat" | cmp - b.dat
+
+  # a second daemon refuses to replace a running one
+  git lfs daemon 2>&1 | tee second.log
+  grep "git lfs daemon is already running on" second.log
+
+  kill "$daemon"
+  wait "$daemon" || true
+  [ ! -S "$socket" ]
+)
+end_test
@@ -0,0 +1,95 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "diff: textconv summarises images"
+(
+  set -e
+
+  reponame="diff-textconv"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.gif"
+  git config diff.lfs.textconv "git lfs diff --textconv"
+
+  printf 'GIF89a\002\000\003\000\000\000\000' > a.gif
+  git add .gitattributes a.gif
+  git commit -m "2x3"
+
+  printf 'GIF89a\004\000\005\000\000\000\000' > a.gif
+  git add a.gif
+  git commit -m "4x5"
+
+  git diff HEAD^ HEAD -- a.gif | tee diff.log
+  grep "^-dimensions 2x3" diff.log
+  grep "^+dimensions 4x5" diff.log
+  grep "^ format gif" diff.log
+  grep "^ size 13 (13 B)" diff.log
+
+  # results are cached by OID
+  ls .git/lfs/cache/diff | wc -l | grep 2
+)
+end_test
+
+begin_test "diff: command shows the size delta"
+(
+  set -e
+
+  reponame="diff-command"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  git config diff.lfs.command "git lfs diff"
+
+  printf "small" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "small"
+
+  printf "much bigger" > a.dat
+  git diff | tee diff.log
+  grep "diff --git-lfs a/a.dat b/a.dat" diff.log
+  grep "^-size 5 (5 B)" diff.log
+  grep "^+size 11 (11 B)" diff.log
+  grep "^ size +6 B" diff.log
+)
+end_test
+
+begin_test "diff: inspectors and objects which aren't local"
+(
+  set -e
+
+  reponame="diff-inspector"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  git config diff.lfs.textconv "git lfs diff --textconv"
+  git config lfs.inspector.dat 'printf "words %s\n" $(wc -w < %f)'
+
+  printf "one two" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "one"
+
+  printf "one two three" > a.dat
+  git add a.dat
+  git commit -m "two"
+  git push origin master
+
+  git diff HEAD^ HEAD -- a.dat | tee diff.log
+  grep "^-words 2" diff.log
+  grep "^+words 3" diff.log
+
+  # without the smudge filter, only the pointers are given to textconv
+  rm -rf .git/lfs/objects .git/lfs/cache
+  GIT_LFS_SKIP_SMUDGE=1 git diff HEAD^ HEAD -- a.dat | tee diff.log
+  grep "^ (contents not downloaded)" diff.log
+  grep "^+size 13 (13 B)" diff.log
+
+  git config lfs.diffdownload true
+  GIT_LFS_SKIP_SMUDGE=1 git diff HEAD^ HEAD -- a.dat | tee diff.log
+  grep "^+words 3" diff.log
+  assert_local_object "$(calc_oid "one two three")" 13
+)
+end_test
@@ -0,0 +1,60 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "endpoint failover: push doesn't fail over to mirror"
+(
+  set -e
+
+  reponame="endpoint-failover-push"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.url "http://127.0.0.1:1/$reponame.git/info/lfs"
+  git config lfs.mirrorurl "$GITSERVER/$reponame.git/info/lfs"
+
+  git lfs track "*.dat"
+  contents="a"
+  oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  GIT_TRACE=1 git lfs push origin master > push.log 2>&1 && {
+    echo >&2 "fatal: expected push to an unreachable server to fail"
+    exit 1
+  }
+  cat push.log
+  [ "0" -eq "$(grep -c "endpoint: failing over" push.log)" ]
+  refute_server_object "$reponame" "$oid"
+)
+end_test
+
+begin_test "endpoint failover: fetch fails over to remote mirror"
+(
+  set -e
+
+  reponame="endpoint-failover-fetch"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents="a"
+  oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+  assert_server_object "$reponame" "$oid"
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-fetch"
+
+  git config remote.origin.lfsurl "http://127.0.0.1:1/$reponame.git/info/lfs"
+  git config remote.origin.lfsmirrorurl "$GITSERVER/$reponame.git/info/lfs"
+
+  GIT_TRACE=1 git lfs fetch 2>&1 | tee fetch.log
+  grep "endpoint: failing over" fetch.log
+  assert_local_object "$oid" 1
+)
+end_test
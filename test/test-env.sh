@@ -845,3 +845,27 @@ UploadTransfers=basic,supertransfer,tus
 
 )
 end_test
+
+begin_test "env with setting overrides"
+(
+  set -e
+  reponame="env-with-setting-overrides"
+  git init $reponame
+  cd $reponame
+
+  git config lfs.concurrenttransfers 5
+  git config lfs.url "https://git-server.com/lfs"
+
+  git lfs env | tee env.log
+  grep "ConcurrentTransfers=5" env.log
+  grep "Endpoint=https://git-server.com/lfs (auth=none)" env.log
+  [ "0" -eq "$(grep -c "overrides git config" env.log)" ]
+
+  GIT_LFS_CONCURRENTTRANSFERS=9 GIT_LFS_URL="https://ci-server.com/lfs" \
+    git lfs env | tee env.log
+  grep "ConcurrentTransfers=9" env.log
+  grep "Endpoint=https://ci-server.com/lfs (auth=none)" env.log
+  grep "GIT_LFS_CONCURRENTTRANSFERS overrides git config lfs.concurrenttransfers" env.log
+  grep "GIT_LFS_URL overrides git config lfs.url" env.log
+)
+end_test
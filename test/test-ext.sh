@@ -60,3 +60,88 @@ begin_test "ext"
   [ "$actual" = "$expected" ]
 )
 end_test
+
+begin_test "ext: clean and smudge pipeline"
+(
+  set -e
+
+  mkdir ext-pipeline
+  cd ext-pipeline
+  git init
+
+  git config lfs.extension.upper.clean "tr a-z A-Z"
+  git config lfs.extension.upper.smudge "tr A-Z a-z"
+  git config lfs.extension.upper.priority 0
+  git config lfs.extension.upper.pattern "*.txt"
+
+  git config lfs.extension.reverse.clean "rev"
+  git config lfs.extension.reverse.smudge "rev"
+  git config lfs.extension.reverse.priority 1
+
+  git lfs track "*.txt" "*.dat"
+  printf "hello\n" > a.txt
+  printf "hello\n" > a.dat
+  git add .gitattributes a.txt a.dat
+  git commit -m "add a.txt and a.dat"
+
+  # extensions run in order of priority, and only on the files they match
+  pointer="$(git cat-file -p :a.txt)"
+  echo "$pointer"
+  echo "$pointer" | grep "^ext-0-upper sha256:$(calc_oid "hello\n")"
+  echo "$pointer" | grep "^ext-1-reverse sha256:$(calc_oid "HELLO\n")"
+  echo "$pointer" | grep "^oid sha256:$(calc_oid "OLLEH\n")"
+
+  pointer="$(git cat-file -p :a.dat)"
+  echo "$pointer"
+  echo "$pointer" | grep "^ext-0-reverse sha256:"
+  [ "0" -eq "$(echo "$pointer" | grep -c "upper")" ]
+
+  # smudging undoes them in reverse order
+  rm a.txt a.dat
+  git checkout -- a.txt a.dat
+  [ "hello" = "$(cat a.txt)" ]
+  [ "hello" = "$(cat a.dat)" ]
+)
+end_test
+
+begin_test "ext: failing extensions"
+(
+  set -e
+
+  mkdir ext-failing
+  cd ext-failing
+  git init
+
+  git config lfs.extension.reverse.clean "rev"
+  git config lfs.extension.reverse.smudge "rev"
+  git config lfs.extension.reverse.priority 0
+
+  git config lfs.extension.broken.clean "false"
+  git config lfs.extension.broken.smudge "false"
+  git config lfs.extension.broken.priority 1
+  git config lfs.extension.broken.optional true
+
+  git lfs track "*.txt"
+  printf "hello\n" > a.txt
+
+  # optional extensions which fail are skipped
+  git add .gitattributes a.txt 2>&1 | tee add.log
+  grep "Skipping optional extension 'broken' for a.txt" add.log
+
+  pointer="$(git cat-file -p :a.txt)"
+  echo "$pointer" | grep "^ext-0-reverse sha256:"
+  [ "0" -eq "$(echo "$pointer" | grep -c "broken")" ]
+
+  # other extensions which fail stop the file from being cleaned
+  git config lfs.extension.broken.optional false
+  printf "goodbye\n" > a.txt
+
+  set +e
+  git add a.txt 2>&1 | tee add.log
+  res="${PIPESTATUS[0]}"
+  set -e
+
+  [ "0" -ne "$res" ]
+  git lfs logs last | grep "Extension 'broken' failed with: exit status 1"
+)
+end_test
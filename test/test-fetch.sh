@@ -64,6 +64,69 @@ begin_test "fetch"
 
   git lfs fetch 2>&1 | grep "(1 of 1 files)"
   assert_local_object "$contents_oid" 1
+  ls -l ".git/lfs/objects/${contents_oid:0:2}/${contents_oid:2:2}/$contents_oid" | grep "^-r--r--r--"
+)
+end_test
+
+begin_test "fetch with lfs.alternate"
+(
+  set -e
+  clone_repo "$reponame" alternate-clone
+  rm -rf .git/lfs/objects
+
+  git config --add lfs.alternate "$TRASHDIR/missing/.git/lfs/objects"
+  git config --add lfs.alternate "../../../../repo/.git/lfs/objects"
+
+  # nothing is downloaded, so the server isn't needed
+  git -c lfs.url="http://127.0.0.1:1/$reponame" lfs fetch origin origin/newbranch 2>&1 | tee fetch.log
+  grep "files)" fetch.log && exit 1
+  assert_local_object "$contents_oid" 1
+  assert_local_object "$b_oid" 1
+
+  # checkout takes objects from the alternates too
+  rm -rf .git/lfs/objects a.dat
+  git lfs checkout a.dat
+  [ "a" = "$(cat a.dat)" ]
+  assert_local_object "$contents_oid" 1
+
+  # the alternate is left as it was
+  [ -f "../repo/.git/lfs/objects/${b_oid:0:2}/${b_oid:2:2}/$b_oid" ]
+)
+end_test
+
+begin_test "fetch --jobs"
+(
+  set -e
+  cd clone
+  rm -rf .git/lfs/objects
+
+  git config lfs.concurrenttransfers 2
+  GIT_TRACE=1 git lfs fetch --jobs 7 2>&1 | tee fetch.log
+  grep "(1 of 1 files)" fetch.log
+  grep "Begin() with 7 workers" fetch.log
+  assert_local_object "$contents_oid" 1
+
+  rm -rf .git/lfs/objects
+  GIT_TRACE=1 git lfs fetch 2>&1 | tee fetch.log
+  grep "Begin() with 2 workers" fetch.log
+  git config --unset lfs.concurrenttransfers
+)
+end_test
+
+begin_test "fetch --timeout"
+(
+  set -e
+  cd clone
+  rm -rf .git/lfs/objects
+
+  set +e
+  git lfs fetch --timeout=1ns 2>&1 | tee fetch.log
+  res=${PIPESTATUS[0]}
+  set -e
+
+  [ "$res" = "2" ]
+  grep "Timed out after 1ns." fetch.log
+  refute_local_object "$contents_oid"
 )
 end_test
 
@@ -223,6 +286,69 @@ begin_test "fetch with include filter overriding exclude filter"
 )
 end_test
 
+begin_test "fetch --output-manifest"
+(
+  set -e
+  cd clone
+  rm -rf .git/lfs/objects
+
+  git lfs fetch -I "*.dat" -X "" --output-manifest ../fetch-manifest.json origin master newbranch
+  cat ../fetch-manifest.json
+
+  grep -A3 "\"oid\": \"$contents_oid\"" ../fetch-manifest.json > a.entry
+  grep "\"path\": \"a.dat\"" a.entry
+  grep "\"size\": 1" a.entry
+  grep "\"mtime\": " a.entry
+
+  # b.dat isn't checked out, so has no modification time
+  grep -A3 "\"oid\": \"$b_oid\"" ../fetch-manifest.json > b.entry
+  grep "\"path\": \"b.dat\"" b.entry
+  [ "0" -eq "$(grep -c "mtime" b.entry)" ]
+  rm a.entry b.entry
+)
+end_test
+
+begin_test "fetch --urls-only"
+(
+  set -e
+  cd clone
+  rm -rf .git/lfs/objects
+
+  git lfs fetch -I "*.dat" -X "" --urls-only origin master newbranch > urls.json
+  cat urls.json
+
+  grep -A6 "\"oid\": \"$contents_oid\"" urls.json > a.entry
+  grep "\"size\": 1" a.entry
+  grep "\"a.dat\"" a.entry
+  grep "\"href\": \"$GITSERVER/.*$contents_oid" a.entry
+  grep -A6 "\"oid\": \"$b_oid\"" urls.json > b.entry
+  grep "\"b.dat\"" b.entry
+  rm a.entry b.entry
+
+  # nothing is downloaded, and only the URLs are written
+  refute_local_object "$contents_oid"
+  refute_local_object "$b_oid"
+  [ "0" -eq "$(grep -c "Fetching" urls.json)" ]
+
+  # the headers may hold credentials, so only the user may read the manifest
+  touch ../urls.json
+  chmod 644 ../urls.json
+  git lfs fetch --urls-only --output-manifest ../urls.json origin master 2>&1 | tee fetch.log
+  grep "Fetching master" fetch.log
+  grep "\"oid\": \"$contents_oid\"" ../urls.json
+  [ "-rw-------" = "$(ls -l ../urls.json | cut -c 1-10)" ]
+  [ "0" -eq "$(grep -c "$b_oid" ../urls.json)" ]
+
+  set +e
+  git lfs fetch --urls-only --prune 2>&1 | tee fetch.log
+  fetch_exit=${PIPESTATUS[0]}
+  set -e
+  [ "$fetch_exit" != "0" ]
+  grep "Cannot combine --urls-only with --prune" fetch.log
+  rm urls.json
+)
+end_test
+
 begin_test "fetch with missing object"
 (
   set -e
@@ -238,12 +364,104 @@ begin_test "fetch with missing object"
   git lfs fetch origin master newbranch
   fetch_exit=$?
   set -e
-  [ "$fetch_exit" != "0" ]
+  # 6 means that every object which failed is missing from the server
+  [ "$fetch_exit" = "6" ]
   assert_local_object "$contents_oid" 1
   refute_local_object "$b_oid"
 )
 end_test
 
+begin_test "fetch with missing object and --json-errors"
+(
+  set -e
+  cd clone
+  rm -rf .git/lfs/objects
+
+  set +e
+  git lfs fetch --json-errors origin master newbranch 2>fetch.log
+  fetch_exit=$?
+  set -e
+  cat fetch.log
+  [ "$fetch_exit" = "6" ]
+
+  grep "\"code\":\"missing_object\"" fetch.log | grep "\"oid\":\"$b_oid\""
+  grep "\"code\":\"missing_object\"" fetch.log | grep "\"hint\":"
+  grep "\"code\":\"error\",\"message\":\"Warning: errors occurred\"" fetch.log
+)
+end_test
+
+begin_test "fetch --json-errors prints messages in English"
+(
+  set -e
+  cd clone
+
+  set +e
+  LANG=en_US.UTF-8 LANGUAGE=de git lfs fetch not-a-remote 2>&1 | tee fetch.log
+  set -e
+  grep "Ungültiger Remote-Name" fetch.log
+
+  set +e
+  LANG=en_US.UTF-8 LANGUAGE=de git lfs fetch --json-errors not-a-remote 2>fetch.log
+  set -e
+  cat fetch.log
+  grep "\"message\":\"Invalid remote name" fetch.log
+  [ "0" -eq "$(grep -c "Ungültiger" fetch.log)" ]
+)
+end_test
+
+begin_test "fetch --retry-failed"
+(
+  set -e
+  cd clone
+  rm -rf .git/lfs/objects .git/lfs/fetch-retry
+
+  set +e
+  git lfs fetch origin master newbranch 2>&1 | tee fetch.log
+  fetch_exit=${PIPESTATUS[0]}
+  set -e
+  [ "$fetch_exit" = "6" ]
+  grep "Run 'git lfs fetch --retry-failed' to retry the 1 object(s) which failed to download" fetch.log
+  grep "$b_oid" .git/lfs/fetch-retry
+  [ "0" -eq "$(grep -c "$contents_oid" .git/lfs/fetch-retry)" ]
+  cp .git/lfs/fetch-retry ../stale-fetch-retry
+
+  # still missing, so the retry file is kept
+  set +e
+  git lfs fetch --retry-failed 2>&1 | tee fetch.log
+  fetch_exit=${PIPESTATUS[0]}
+  set -e
+  [ "$fetch_exit" = "6" ]
+  grep "$b_oid" .git/lfs/fetch-retry
+
+  set +e
+  git lfs fetch --retry-failed origin master 2>&1 | tee fetch.log
+  fetch_exit=${PIPESTATUS[0]}
+  set -e
+  [ "$fetch_exit" = "2" ]
+  grep "Cannot combine --retry-failed" fetch.log
+
+  (cd ../repo && git lfs push --object-id origin "$b_oid")
+
+  git lfs fetch --retry-failed 2>&1 | tee fetch.log
+  grep "Retrying the objects which failed to download" fetch.log
+  assert_local_object "$b_oid" 1
+  [ ! -e .git/lfs/fetch-retry ]
+
+  git lfs fetch --retry-failed 2>&1 | tee fetch.log
+  grep "No failed objects to retry" fetch.log
+
+  # a later fetch with no failures removes a stale retry file
+  cp ../stale-fetch-retry .git/lfs/fetch-retry
+  git lfs fetch origin master newbranch 2>&1 | tee fetch.log
+  [ "0" -eq "$(grep -c "retry-failed" fetch.log)" ]
+  [ ! -e .git/lfs/fetch-retry ]
+
+  cp ../stale-fetch-retry .git/lfs/fetch-retry
+  git lfs pull 2>&1 | tee pull.log
+  [ ! -e .git/lfs/fetch-retry ]
+)
+end_test
+
 begin_test "fetch-all"
 (
   set -e
@@ -534,3 +752,35 @@ begin_test "fetch with invalid remote"
   grep "Invalid remote name" fetch.log
 )
 end_test
+
+begin_test "fetch recovers finished downloads from the temporary directory"
+(
+  set -e
+
+  reponame="fetch-recover-temp"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "recovered" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  oid="$(calc_oid "recovered")"
+  delete_server_object "$reponame" "$oid"
+  rm -rf .git/lfs/objects
+
+  # a download which was finished, but not stored, and one which was abandoned
+  mkdir -p .git/lfs/tmp
+  printf "recovered" > ".git/lfs/tmp/${oid}123"
+  printf "aband" > ".git/lfs/tmp/$(calc_oid "abandoned")456"
+  touch -d "2 hours ago" .git/lfs/tmp/*
+
+  git lfs fetch
+  assert_local_object "$oid" 9
+  [ ! -e ".git/lfs/tmp/${oid}123" ]
+  [ ! -e ".git/lfs/tmp/$(calc_oid "abandoned")456" ]
+  refute_local_object "$(calc_oid "abandoned")"
+)
+end_test
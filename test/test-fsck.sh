@@ -36,6 +36,7 @@ begin_test "fsck default"
   fi
 
 
+  chmod u+w .git/lfs/objects/$aOid12/$aOid34/$aOid
   echo "CORRUPTION" >> .git/lfs/objects/$aOid12/$aOid34/$aOid
 
   moved=$(native_path "$TRASHDIR/$reponame/.git/lfs/bad")
@@ -82,6 +83,7 @@ begin_test "fsck dry run"
     exit 1
   fi
 
+  chmod u+w .git/lfs/objects/$aOid12/$aOid34/$aOid
   echo "CORRUPTION" >> .git/lfs/objects/$aOid12/$aOid34/$aOid
 
   [ "Object a.dat ($aOid) is corrupt" = "$(git lfs fsck --dry-run)" ]
@@ -113,3 +115,34 @@ begin_test "fsck: outside git repository"
   grep "Not in a git repository" fsck.log
 )
 end_test
+
+begin_test "fsck restores read-only objects"
+(
+  set -e
+
+  reponame="fsck-read-only"
+  git init $reponame
+  cd $reponame
+
+  git lfs track "*.dat"
+  echo "test data" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "first commit"
+
+  aOid=$(git log --patch a.dat | grep "^+oid" | cut -d ":" -f 2)
+  object=".git/lfs/objects/${aOid:0:2}/${aOid:2:2}/$aOid"
+  ls -l "$object" | grep "^-r--r--r--"
+
+  chmod u+w "$object"
+
+  [ "Object a.dat ($aOid) is writable" = "$(git lfs fsck --dry-run)" ]
+  ls -l "$object" | grep "^-rw-r--r--"
+
+  expected="$(printf 'Object a.dat (%s) is writable
+Making writable objects read-only' "$aOid")"
+  [ "$expected" = "$(git lfs fsck)" ]
+  ls -l "$object" | grep "^-r--r--r--"
+
+  [ "Git LFS fsck OK" = "$(git lfs fsck)" ]
+)
+end_test
@@ -0,0 +1,167 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "gc: prunes, clears temp files and fixes permissions"
+(
+  set -e
+
+  reponame="gc-all"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.fetchrecentrefsdays 0
+  git config lfs.fetchrecentcommitsdays 0
+  git lfs track "*.dat"
+
+  printf "old contents" > a.dat
+  old_oid="$(calc_oid "old contents")"
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  printf "new contents" > a.dat
+  new_oid="$(calc_oid "new contents")"
+  git add a.dat
+  git commit -m "update a.dat"
+  git push origin master
+
+  new_path=".git/lfs/objects/${new_oid:0:2}/${new_oid:2:2}/$new_oid"
+  chmod u+w "$new_path"
+
+  # the temporary files of abandoned downloads are also cleared up at the end
+  # of every command, including the dry run
+  mkdir -p .git/lfs/tmp/objects
+  printf "partial" > .git/lfs/tmp/objects/invalid-tmp-file
+  printf "orphaned" > ".git/lfs/objects/${new_oid:0:2}/${new_oid:2:2}/tmp-orphaned"
+  touch -t 200001010000 ".git/lfs/objects/${new_oid:0:2}/${new_oid:2:2}/tmp-orphaned"
+
+  git lfs gc --dry-run 2>&1 | tee gc.log
+  grep "1 files would be pruned" gc.log
+  grep "2 temporary files would be deleted" gc.log
+  grep "1 writable objects would be made read-only" gc.log
+  assert_local_object "$old_oid" 12
+  ls -l "$new_path" | grep "^-rw-r--r--"
+  [ ! -e .git/lfs/gc.last ]
+
+  printf "partial" > .git/lfs/tmp/objects/invalid-tmp-file
+  git lfs gc 2>&1 | tee gc.log
+  grep "Pruning 1 files" gc.log
+  grep "Deleted 2 temporary files" gc.log
+  grep "Made 1 writable objects read-only" gc.log
+  refute_local_object "$old_oid"
+  ls -l "$new_path" | grep "^-r--r--r--"
+  [ ! -e .git/lfs/tmp/objects/invalid-tmp-file ]
+  [ ! -e ".git/lfs/objects/${new_oid:0:2}/${new_oid:2:2}/tmp-orphaned" ]
+  [ -e .git/lfs/gc.last ]
+)
+end_test
+
+begin_test "gc: --auto only runs once per interval"
+(
+  set -e
+
+  reponame="gc-auto"
+  git init "$reponame"
+  cd "$reponame"
+  git commit --allow-empty -m "initial commit"
+
+  git lfs gc --auto 2>&1 | tee gc.log
+  grep "Nothing to prune" gc.log
+  [ -e .git/lfs/gc.last ]
+
+  git lfs gc --auto 2>&1 | tee gc.log
+  [ "$(wc -c < gc.log | tr -d " ")" = "0" ]
+
+  touch -t 200001010000 .git/lfs/gc.last
+  git lfs gc --auto --quiet 2>&1 | tee gc.log
+  [ "$(wc -c < gc.log | tr -d " ")" = "0" ]
+  [ -n "$(find .git/lfs/gc.last -mmin -5)" ]
+)
+end_test
+
+begin_test "gc: lfs.autogc installs the pre-auto-gc hook"
+(
+  set -e
+
+  reponame="gc-hook"
+  git init "$reponame"
+  cd "$reponame"
+
+  git config lfs.autogc true
+  git lfs update 2>&1 | tee update.log
+  grep "Updated pre-push and pre-auto-gc hooks." update.log
+  grep "git lfs gc --auto --quiet" .git/hooks/pre-auto-gc
+
+  # more than one pack makes Git's automatic garbage collection run
+  git config gc.autoPackLimit 1
+  git config maintenance.auto false
+  git commit --allow-empty -m "first"
+  git repack
+  git commit --allow-empty -m "second"
+  git repack
+  [ ! -e .git/lfs/gc.last ]
+  git gc --auto
+  [ -e .git/lfs/gc.last ]
+
+  git lfs uninstall
+  [ ! -e .git/hooks/pre-auto-gc ]
+)
+end_test
+
+begin_test "gc: deletes finished download journals"
+(
+  set -e
+
+  reponame="gc-journal"
+  git init "$reponame"
+  cd "$reponame"
+
+  git lfs track "*.dat"
+  printf "journaled" > a.dat
+  oid="$(calc_oid "journaled")"
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  mkdir -p .git/lfs/journal
+  printf '{"op":"begin","direction":"download","remote":"origin"}\n{"op":"add","name":"a.dat","oid":"%s","size":9}\n' "$oid" > .git/lfs/journal/download
+
+  git lfs gc --no-prune 2>&1 | tee gc.log
+  grep "Deleted the finished download journal" gc.log
+  [ ! -e .git/lfs/journal/download ]
+)
+end_test
+
+begin_test "gc: compresses objects with lfs.storagecompression"
+(
+  set -e
+
+  if ! command -v zstd > /dev/null 2>&1; then
+    echo "skip: zstd is not installed"
+    exit 0
+  fi
+
+  reponame="gc-compress"
+  git init "$reponame"
+  cd "$reponame"
+
+  git lfs track "*.txt" "*.zip"
+  for i in $(seq 1 2000); do echo "line $i of a compressible file"; done > a.txt
+  cp a.txt b.zip
+  printf "another zip" >> b.zip
+  a_oid="$(calc_oid_file a.txt)"
+  b_oid="$(calc_oid_file b.zip)"
+  git add .gitattributes a.txt b.zip
+  git commit -m "add files"
+
+  git config lfs.storagecompression zstd
+  git lfs gc --no-prune 2>&1 | tee gc.log
+  grep "Compressed 1 objects" gc.log
+  [ -f ".git/lfs/compressed/${a_oid:0:2}/${a_oid:2:2}/$a_oid.zst" ]
+  [ ! -e ".git/lfs/objects/${a_oid:0:2}/${a_oid:2:2}/$a_oid" ]
+  [ -f ".git/lfs/objects/${b_oid:0:2}/${b_oid:2:2}/$b_oid" ]
+
+  rm a.txt
+  git checkout -- a.txt
+  [ "$a_oid" = "$(calc_oid_file a.txt)" ]
+)
+end_test
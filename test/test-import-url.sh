@@ -0,0 +1,96 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "import-url from a local path"
+(
+  set -e
+
+  reponame="import-url-local"
+  git init "$reponame"
+  cd "$reponame"
+
+  contents="a build artifact"
+  contents_oid="$(calc_oid "$contents")"
+  printf "$contents" > "$TRASHDIR/artifact.bin"
+
+  git lfs import-url "$TRASHDIR/artifact.bin" "build/artifact.bin" | tee import.log
+  grep "Tracking build/artifact.bin" import.log
+  grep "Imported $TRASHDIR/artifact.bin (16 B) as build/artifact.bin" import.log
+
+  grep "build/artifact.bin filter=lfs diff=lfs merge=lfs -text" .gitattributes
+  [ "$(pointer "$contents_oid" 16)" = "$(cat build/artifact.bin)" ]
+  assert_local_object "$contents_oid" 16
+
+  [ -z "$(git diff --cached --name-only)" ]
+
+  git lfs import-url "$TRASHDIR/artifact.bin" "build/artifact.bin" 2>&1 | tee exists.log
+  grep "build/artifact.bin already exists, use --force to overwrite it." exists.log
+
+  printf "a newer build artifact" > "$TRASHDIR/artifact.bin"
+  newer_oid="$(calc_oid "a newer build artifact")"
+  git lfs import-url --force --add "file://$TRASHDIR/artifact.bin" "build/artifact.bin" | tee force.log
+  grep "Tracking" force.log && exit 1
+  [ "1" -eq "$(grep -c "build/artifact.bin" .gitattributes)" ]
+
+  git diff --cached --name-only | sort | tee staged.log
+  grep ".gitattributes" staged.log
+  grep "build/artifact.bin" staged.log
+
+  git commit -m "import artifact"
+  assert_pointer "master" "build/artifact.bin" "$newer_oid" 22
+  assert_local_object "$newer_oid" 22
+)
+end_test
+
+begin_test "import-url from a URL"
+(
+  set -e
+
+  reponame="import-url-remote"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  contents="an artifact on a server"
+  contents_oid="$(calc_oid "$contents")"
+
+  git lfs track "*.dat"
+  printf "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+  assert_server_object "$reponame" "$contents_oid"
+
+  cd ..
+  git init "$reponame-import"
+  cd "$reponame-import"
+
+  git lfs track "*.dat"
+  git lfs import-url "$GITSERVER/storage/$contents_oid?r=$reponame" "imported.dat" | tee import.log
+  grep "Tracking" import.log && exit 1
+  grep "imported.dat" .gitattributes && exit 1
+
+  [ "$(pointer "$contents_oid" 23)" = "$(cat imported.dat)" ]
+  assert_local_object "$contents_oid" 23
+
+  missing_oid="$(calc_oid "missing")"
+  git lfs import-url "$GITSERVER/storage/$missing_oid?r=$reponame" "missing.dat" 2>&1 | tee missing.log
+  grep "Could not read" missing.log
+  [ ! -e missing.dat ]
+)
+end_test
+
+begin_test "import-url outside the working copy"
+(
+  set -e
+
+  reponame="import-url-outside"
+  git init "$reponame"
+  cd "$reponame"
+
+  printf "outside" > "$TRASHDIR/outside.bin"
+  git lfs import-url "$TRASHDIR/outside.bin" "../outside-copy.bin" 2>&1 | tee import.log
+  grep "is outside of the git working directory" import.log
+  [ ! -e "../outside-copy.bin" ]
+)
+end_test
@@ -237,3 +237,43 @@ begin_test "install in directory without access to .git/lfs"
   [ "git-lfs clean -- %f" = "$(git config filter.lfs.clean)" ]
 )
 end_test
+
+begin_test "install --template"
+(
+  set -e
+
+  git config --global --unset init.templatedir || true
+
+  git lfs install --template 2>&1 | tee install.log
+  grep "Set init.templateDir to $HOME/.git-template." install.log
+  grep "Git LFS initialized in template directory $HOME/.git-template." install.log
+
+  [ "$HOME/.git-template" = "$(git config --global init.templatedir)" ]
+  [ "git-lfs filter-process" = "$(git config --file "$HOME/.git-template/config" filter.lfs.process)" ]
+  grep "git lfs pre-push" "$HOME/.git-template/hooks/pre-push"
+
+  git config --global --remove-section filter.lfs
+
+  reponame="$(basename "$0" ".sh")-template"
+  git init "$reponame"
+  cd "$reponame"
+
+  [ "git-lfs filter-process" = "$(git config --local filter.lfs.process)" ]
+  grep "git lfs pre-push" .git/hooks/pre-push
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git cat-file -p :a.dat | grep "https://git-lfs.github.com/spec/v1"
+
+  # a template directory which is set is used as it is
+  cd ..
+  git config --global init.templatedir "~/other-template"
+  git lfs install --template 2>&1 | tee install.log
+  [ "0" = "$(grep -c "Set init.templateDir" install.log)" ]
+  [ -f "$HOME/other-template/hooks/pre-push" ]
+
+  git config --global --unset init.templatedir
+  git lfs install
+)
+end_test
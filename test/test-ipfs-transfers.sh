@@ -0,0 +1,60 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "ipfs transfers: push and fetch objects stored on an IPFS node"
+(
+  set -e
+
+  reponame="ipfs-transfers"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config -f .lfsconfig lfs.url "ipfs+$GITSERVER/ipfs-node"
+
+  git lfs track "*.dat"
+  contents="ipfs contents"
+  oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  # larger than a chunk, so stored as a DAG
+  head -c 400000 /dev/urandom > b.dat
+  b_oid="$(calc_oid_file b.dat)"
+  git add .lfsconfig .gitattributes a.dat b.dat
+  git commit -m "add a.dat and b.dat"
+
+  # pointers give the root CIDs, which only v2 pointers can
+  git cat-file -p :a.dat | tee a.ptr
+  grep "version https://git-lfs.github.com/spec/v2" a.ptr
+  grep "ipfs-cid bafkrei" a.ptr
+  git cat-file -p :b.dat | tee b.ptr
+  grep "ipfs-cid bafybei" b.ptr
+
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  grep "tq: transferring batch of size 2 with IPFS" push.log
+  [ "0" = "$(grep -c "api: batch" push.log)" ]
+  refute_server_object "$reponame" "$oid"
+
+  # objects the node has already aren't sent again
+  GIT_TRACE=1 git lfs push --object-id origin "$oid" 2>&1 | tee push.log
+  grep "is on the IPFS node already" push.log
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-fetch"
+
+  git lfs pull 2>&1 | tee pull.log
+  assert_local_object "$oid" 13
+  assert_local_object "$b_oid" 400000
+  [ "$contents" = "$(cat a.dat)" ]
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-gateway"
+  git config lfs.ipfs.gateway "$GITSERVER/ipfs-node/"
+
+  GIT_TRACE=1 git lfs pull 2>&1 | tee pull.log
+  grep "ipfs-node/ipfs/bafkrei" pull.log
+  grep "ipfs-node/ipfs/bafybei" pull.log
+  assert_local_object "$oid" 13
+  assert_local_object "$b_oid" 400000
+  [ "$contents" = "$(cat a.dat)" ]
+)
+end_test
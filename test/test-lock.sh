@@ -76,3 +76,37 @@ begin_test "locking a directory"
   grep "cannot lock directory" lock.log
 )
 end_test
+
+begin_test "creating a lock with --expires-in"
+(
+  set -e
+
+  reponame="lock_create_expiring"
+  setup_remote_repo_with_file "$reponame" "expiring.dat"
+
+  GITLFSLOCKSENABLED=1 git lfs lock --expires-in 8h "expiring.dat" 2>&1 | tee lock.log
+  grep "'expiring.dat' was locked" lock.log
+  grep "The lock expires at" lock.log
+
+  id=$(grep -oh "\((.*)\)" lock.log | tr -d "()")
+  assert_server_lock "$reponame" "$id"
+  grep "\"expires_at\"" http.json
+
+  GITLFSLOCKSENABLED=1 git lfs lock --expires-in soon "expiring.dat" 2>&1 | tee lock.log
+  grep "Invalid --expires-in \"soon\"" lock.log
+)
+end_test
+
+begin_test "creating a lock with --expires-in against a server without expiry"
+(
+  set -e
+
+  reponame="lock-expiry-unsupported"
+  setup_remote_repo_with_file "$reponame" "unexpiring.dat"
+
+  GITLFSLOCKSENABLED=1 git lfs lock --expires-in 2d "unexpiring.dat" 2>&1 | tee lock.log
+  grep "'unexpiring.dat' was locked" lock.log
+  grep "Warning: the server doesn't support lock expiry" lock.log
+  [ "0" -eq "$(grep -c "The lock expires at" lock.log)" ]
+)
+end_test
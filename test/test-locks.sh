@@ -107,6 +107,107 @@ begin_test "list locks with pagination"
 )
 end_test
 
+begin_test "list locks with a path prefix"
+(
+  set -e
+
+  reponame="locks_list_prefix"
+  setup_remote_repo "remote_$reponame"
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track "*.dat"
+  mkdir -p prefix_dir prefix_dir2
+  echo "a" > prefix_dir/a.dat
+  echo "b" > prefix_dir/b.dat
+  echo "c" > prefix_dir2/c.dat
+  git add .gitattributes prefix_dir prefix_dir2
+  git commit -m "add files"
+  git push origin master 2>&1 | tee push.log
+  grep "master -> master" push.log
+
+  for f in prefix_dir/a.dat prefix_dir/b.dat prefix_dir2/c.dat; do
+    GITLFSLOCKSENABLED=1 git lfs lock "$f" | tee lock.log
+    assert_server_lock "$reponame" "$(grep -oh "\((.*)\)" lock.log | tr -d "()")"
+  done
+
+  GITLFSLOCKSENABLED=1 git lfs locks --path-prefix prefix_dir/ | tee locks.log
+  grep "2 lock(s) matched query" locks.log
+  grep "prefix_dir/a.dat" locks.log
+  grep "prefix_dir/b.dat" locks.log
+  [ "0" -eq "$(grep -c "prefix_dir2" locks.log)" ]
+
+  cd prefix_dir2
+  GITLFSLOCKSENABLED=1 git lfs locks --path-prefix . | tee locks.log
+  grep "1 lock(s) matched query" locks.log
+  grep "prefix_dir2/c.dat" locks.log
+)
+end_test
+
+begin_test "list locks with --verify"
+(
+  set -e
+
+  reponame="locks_list_verify"
+  setup_remote_repo "remote_$reponame"
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track "*.dat"
+  mkdir -p verify_dir
+  echo "mine" > verify_dir/mine.dat
+  echo "theirs" > verify_dir/theirs.dat
+  git add .gitattributes verify_dir
+  git commit -m "add files"
+  git push origin master 2>&1 | tee push.log
+  grep "master -> master" push.log
+
+  GITLFSLOCKSENABLED=1 git lfs lock verify_dir/mine.dat | tee lock.log
+  assert_server_lock "$reponame" "$(grep -oh "\((.*)\)" lock.log | tr -d "()")"
+  GITLFSLOCKSENABLED=1 git -c user.email=other@example.com lfs lock verify_dir/theirs.dat | tee lock.log
+  assert_server_lock "$reponame" "$(grep -oh "\((.*)\)" lock.log | tr -d "()")"
+
+  GITLFSLOCKSENABLED=1 GIT_TRACE=1 git lfs locks --verify --path-prefix verify_dir/ 2>&1 | tee locks.log
+  [ "0" -eq "$(grep -c "unable to verify locks" locks.log)" ]
+  grep "O verify_dir/mine.dat" locks.log
+  grep "  verify_dir/theirs.dat" locks.log
+  grep "2 lock(s) matched query, 1 of them yours." locks.log
+
+  GITLFSLOCKSENABLED=1 git lfs locks --verify --json --path-prefix verify_dir/ | tee locks.json
+  grep '"ours":\[{"id":"[^"]*","path":"verify_dir/mine.dat"' locks.json
+  grep '"theirs":\[{"id":"[^"]*","path":"verify_dir/theirs.dat"' locks.json
+
+  GITLFSLOCKSENABLED=1 git lfs locks --verify --local 2>&1 | tee locks.log
+  grep "\-\-verify and \-\-local can't be used together" locks.log
+)
+end_test
+
+begin_test "list locks with --verify against a server which doesn't support it"
+(
+  set -e
+
+  reponame="locks_list_verify-unsupported"
+  setup_remote_repo "remote_$reponame"
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track "*.dat"
+  mkdir -p unsupported_dir
+  echo "mine" > unsupported_dir/mine.dat
+  echo "theirs" > unsupported_dir/theirs.dat
+  git add .gitattributes unsupported_dir
+  git commit -m "add files"
+  git push origin master 2>&1 | tee push.log
+  grep "master -> master" push.log
+
+  GITLFSLOCKSENABLED=1 git lfs lock unsupported_dir/mine.dat
+  GITLFSLOCKSENABLED=1 git -c user.email=other@example.com lfs lock unsupported_dir/theirs.dat
+
+  GITLFSLOCKSENABLED=1 GIT_TRACE=1 git lfs locks --verify --path-prefix unsupported_dir/ 2>&1 | tee locks.log
+  grep "unable to verify locks, searching instead" locks.log
+  grep "O unsupported_dir/mine.dat" locks.log
+  grep "  unsupported_dir/theirs.dat" locks.log
+  grep "2 lock(s) matched query, 1 of them yours." locks.log
+)
+end_test
+
 begin_test "cached locks"
 (
   set -e
@@ -151,3 +252,57 @@ begin_test "cached locks"
 end_test
 
 
+
+begin_test "stale locks"
+(
+  set -e
+
+  reponame="locks_stale"
+  setup_remote_repo "remote_$reponame"
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track "*.dat"
+  mkdir -p stale_dir
+  for f in expired recent theirs; do
+    echo "$f" > "stale_dir/$f.dat"
+  done
+  git add .gitattributes stale_dir
+  git commit -m "add files"
+  git push origin master 2>&1 | tee push.log
+  grep "master -> master" push.log
+
+  GITLFSLOCKSENABLED=1 git lfs lock --expires-in 1s stale_dir/expired.dat
+  GITLFSLOCKSENABLED=1 git lfs lock stale_dir/recent.dat
+  GITLFSLOCKSENABLED=1 git -c user.email=other@example.com lfs lock stale_dir/theirs.dat
+  sleep 2
+
+  GITLFSLOCKSENABLED=1 git lfs locks --stale --path-prefix stale_dir/ | tee locks.log
+  grep "1 stale lock(s) matched query" locks.log
+  grep "stale_dir/expired.dat.*expired" locks.log
+
+  GITLFSLOCKSENABLED=1 git lfs locks --stale --older-than 1d --path-prefix stale_dir/ | tee locks.log
+  grep "1 stale lock(s) matched query" locks.log
+
+  GITLFSLOCKSENABLED=1 git lfs locks --stale --older-than 0s --path-prefix stale_dir/ --json | tee locks.json
+  grep "stale_dir/expired.dat" locks.json
+  grep "stale_dir/recent.dat" locks.json
+  grep "stale_dir/theirs.dat" locks.json
+
+  GITLFSLOCKSENABLED=1 git lfs locks --unlock 2>&1 | tee locks.log
+  grep "\-\-older-than, \-\-unlock and \-\-force can only be used with \-\-stale" locks.log
+
+  GITLFSLOCKSENABLED=1 git lfs locks --stale --older-than 0s --path-prefix stale_dir/ --unlock | tee locks.log
+  grep "Unlocked 2 stale lock(s)." locks.log
+  grep "Skipped 1 stale lock(s) held by others: use --force to unlock them." locks.log
+
+  GITLFSLOCKSENABLED=1 git lfs locks --path-prefix stale_dir/ | tee locks.log
+  grep "1 lock(s) matched query" locks.log
+  grep "stale_dir/theirs.dat" locks.log
+
+  GITLFSLOCKSENABLED=1 git lfs locks --stale --older-than 0s --path-prefix stale_dir/ --unlock --force | tee locks.log
+  grep "Unlocked 1 stale lock(s)." locks.log
+
+  GITLFSLOCKSENABLED=1 git lfs locks --path-prefix stale_dir/ | tee locks.log
+  grep "0 lock(s) matched query" locks.log
+)
+end_test
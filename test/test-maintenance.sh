@@ -0,0 +1,211 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+# fake_crontab writes a crontab replacement keeping the user's crontab in
+# $TRASHDIR/crontab, and has "git maintenance" schedule with it.
+fake_crontab() {
+  cat > "$TRASHDIR/fake-crontab" <<'EOF'
+#!/usr/bin/env bash
+if [ "$1" = "-l" ]; then
+  [ -f "$TRASHDIR/crontab" ] || { echo "no crontab for $USER" >&2; exit 1; }
+  cat "$TRASHDIR/crontab"
+else
+  cp "$1" "$TRASHDIR/crontab"
+fi
+EOF
+  chmod +x "$TRASHDIR/fake-crontab"
+  export TRASHDIR
+  export GIT_TEST_MAINT_SCHEDULER="crontab:$TRASHDIR/fake-crontab"
+}
+
+begin_test "maintenance: start and stop the schedule"
+(
+  set -e
+
+  fake_crontab
+  rm -f "$TRASHDIR/crontab"
+  echo "30 2 * * * backup" > "$TRASHDIR/crontab"
+
+  reponame="maintenance-start"
+  git init "$reponame"
+  cd "$reponame"
+  repo="$(pwd -P)"
+
+  git lfs maintenance start 2>&1 | tee start.log
+  grep "Registered $repo for Git LFS maintenance." start.log
+  [ "$repo" = "$(git config --global --get-all maintenance.repo)" ]
+
+  # the schedule is Git's own, which leaves the rest of the crontab alone
+  cat "$TRASHDIR/crontab"
+  grep "30 2 \* \* \* backup" "$TRASHDIR/crontab"
+  grep "BEGIN GIT MAINTENANCE SCHEDULE" "$TRASHDIR/crontab"
+  [ "0" = "$(grep -c "lfs" "$TRASHDIR/crontab")" ]
+
+  # starting again neither registers the repository twice, nor duplicates the
+  # schedule
+  git lfs maintenance start
+  [ "1" = "$(git config --global --get-all maintenance.repo | wc -l | tr -d " ")" ]
+  [ "1" = "$(grep -c "BEGIN GIT MAINTENANCE SCHEDULE" "$TRASHDIR/crontab")" ]
+
+  git lfs maintenance stop 2>&1 | tee stop.log
+  grep "Git maintenance schedule removed." stop.log
+  [ "30 2 * * * backup" = "$(cat "$TRASHDIR/crontab")" ]
+  [ "$repo" = "$(git config --global --get-all maintenance.repo)" ]
+
+  git lfs maintenance unregister 2>&1 | tee unregister.log
+  grep "Unregistered $repo from Git LFS maintenance." unregister.log
+  [ -z "$(git config --global --get-all maintenance.repo)" ]
+)
+end_test
+
+begin_test "maintenance: install --maintenance"
+(
+  set -e
+
+  fake_crontab
+  rm -f "$TRASHDIR/crontab"
+
+  reponame="maintenance-install"
+  git init "$reponame"
+  cd "$reponame"
+  repo="$(pwd -P)"
+
+  git lfs install --maintenance 2>&1 | tee install.log
+  grep "Git LFS maintenance scheduled" install.log
+  [ "$repo" = "$(git config --global --get-all maintenance.repo)" ]
+  grep "BEGIN GIT MAINTENANCE SCHEDULE" "$TRASHDIR/crontab"
+
+  git lfs uninstall 2>&1 | tee uninstall.log
+  grep "Unregistered $repo from Git LFS maintenance." uninstall.log
+  [ -z "$(git config --global --get-all maintenance.repo)" ]
+
+  git lfs maintenance stop
+  git lfs install
+)
+end_test
+
+begin_test "maintenance: run the due tasks of registered repositories"
+(
+  set -e
+
+  reponame="maintenance-auto"
+  git init "$reponame"
+  cd "$reponame"
+  git commit --allow-empty -m "initial commit"
+
+  GIT_TRACE=1 git lfs maintenance run --auto 2>&1 | tee run.log
+  grep "maintenance: running the prefetch task" run.log
+  grep "maintenance: running the prune task" run.log
+  grep "maintenance: running the verify task" run.log
+  [ -f .git/lfs/maintenance/prefetch ]
+
+  # nothing is due again until the hourly task's hour is up
+  GIT_TRACE=1 git lfs maintenance run --auto 2>&1 | tee run.log
+  [ "0" = "$(grep -c "maintenance: running the" run.log)" ]
+
+  touch -d "2 hours ago" .git/lfs/maintenance/prefetch
+  GIT_TRACE=1 git lfs maintenance run --auto 2>&1 | tee run.log
+  grep "maintenance: running the prefetch task" run.log
+  [ "1" = "$(grep -c "maintenance: running the" run.log)" ]
+
+  # the filter starts the due tasks in the background, once the repository
+  # is registered
+  git lfs track "*.dat"
+  touch -d "2 hours ago" .git/lfs/maintenance/prefetch
+  printf "a" > a.dat
+  GIT_TRACE=1 git add a.dat 2>&1 | tee add.log
+  [ "0" = "$(grep -c "maintenance: running the due tasks" add.log)" ]
+
+  git lfs maintenance register
+  printf "b" > b.dat
+  GIT_TRACE=1 git add b.dat 2>&1 | tee add.log
+  grep "maintenance: running the due tasks in the background" add.log
+
+  for i in $(seq 1 20); do
+    [ -z "$(find .git/lfs/maintenance/prefetch -mmin +60)" ] && break
+    sleep 1
+  done
+  [ -z "$(find .git/lfs/maintenance/prefetch -mmin +60)" ]
+
+  git lfs maintenance unregister
+)
+end_test
+
+begin_test "maintenance: run the tasks due on a schedule"
+(
+  set -e
+
+  reponame="maintenance-schedule"
+  git init "$reponame"
+  cd "$reponame"
+  git commit --allow-empty -m "initial commit"
+
+  GIT_TRACE=1 git lfs maintenance run --schedule=hourly 2>&1 | tee run.log
+  grep "maintenance: running the prefetch task" run.log
+  [ "0" = "$(grep -c "running the prune task" run.log)" ]
+  [ "0" = "$(grep -c "running the verify task" run.log)" ]
+
+  GIT_TRACE=1 git lfs maintenance run --schedule=weekly 2>&1 | tee run.log
+  grep "maintenance: running the prefetch task" run.log
+  grep "maintenance: running the prune task" run.log
+  grep "maintenance: running the verify task" run.log
+
+  git config lfs.maintenance.prefetch.enabled false
+  git config lfs.maintenance.verify.schedule hourly
+  GIT_TRACE=1 git lfs maintenance run --schedule=hourly 2>&1 | tee run.log
+  [ "0" = "$(grep -c "running the prefetch task" run.log)" ]
+  grep "maintenance: running the verify task" run.log
+
+  set +e
+  git lfs maintenance run --schedule=monthly 2>&1 | tee run.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" != "0" ]
+  grep "Invalid schedule \"monthly\"" run.log
+
+  set +e
+  git lfs maintenance run --task=defrag 2>&1 | tee run.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" != "0" ]
+  grep "Unknown maintenance task \"defrag\"" run.log
+)
+end_test
+
+begin_test "maintenance: verify removes corrupt objects in registered repositories"
+(
+  set -e
+
+  reponame="maintenance-verify"
+  git init "$reponame"
+  cd "$reponame"
+
+  git lfs track "*.dat"
+  printf "good" > good.dat
+  printf "bad" > bad.dat
+  good_oid="$(calc_oid "good")"
+  bad_oid="$(calc_oid "bad")"
+  git add .gitattributes good.dat bad.dat
+  git commit -m "add files"
+
+  bad_path=".git/lfs/objects/${bad_oid:0:2}/${bad_oid:2:2}/$bad_oid"
+  chmod u+w "$bad_path"
+  printf "corrupted" > "$bad_path"
+
+  git lfs maintenance register
+  cd ..
+  git for-each-repo --config=maintenance.repo lfs maintenance run --task=verify 2>&1 | tee verify.log
+  grep "Object $bad_oid is corrupt" verify.log
+
+  cd "$reponame"
+  assert_local_object "$good_oid" 4
+  [ ! -e "$bad_path" ]
+  [ -f ".git/lfs/bad/$bad_oid" ]
+
+  git lfs maintenance run --task=verify 2>&1 | tee verify.log
+  grep "Verified 1 objects" verify.log
+
+  git lfs maintenance unregister
+)
+end_test
@@ -0,0 +1,153 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+# setup_merge_conflict creates a repository in which master and the "theirs"
+# branch have both changed file.dat from "base", to "ours" and "theirs", with
+# theirs changed most recently, and checks out master.
+setup_merge_conflict() {
+  local reponame="$1"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "*.dat merge=lfs" >> .gitattributes
+  git config merge.lfs.driver "git lfs merge-driver --ancestor %O --current %A --other %B --marker-size %L --path %P"
+
+  printf "base" > file.dat
+  git add .gitattributes file.dat
+  git commit -m "base"
+
+  git checkout -b theirs
+  printf "theirs" > file.dat
+  git add file.dat
+  GIT_COMMITTER_DATE="2030-01-01T00:00:00" git commit -m "theirs"
+
+  git checkout master
+  printf "ours" > file.dat
+  git add file.dat
+  git commit -m "ours"
+}
+
+begin_test "merge-driver: theirs"
+(
+  set -e
+
+  setup_merge_conflict "merge-driver-theirs"
+  git config lfs.mergestrategy theirs
+
+  git merge --no-edit theirs
+  [ "theirs" = "$(cat file.dat)" ]
+  [ "$(git rev-parse theirs:file.dat)" = "$(git rev-parse HEAD:file.dat)" ]
+)
+end_test
+
+begin_test "merge-driver: ours"
+(
+  set -e
+
+  setup_merge_conflict "merge-driver-ours"
+  git config lfs.mergestrategy ours
+
+  git merge --no-edit theirs
+  [ "ours" = "$(cat file.dat)" ]
+  [ "$(git rev-parse HEAD^1:file.dat)" = "$(git rev-parse HEAD:file.dat)" ]
+)
+end_test
+
+begin_test "merge-driver: newest"
+(
+  set -e
+
+  setup_merge_conflict "merge-driver-newest"
+  git config lfs.mergestrategy newest
+
+  git merge --no-edit theirs
+  [ "theirs" = "$(cat file.dat)" ]
+)
+end_test
+
+begin_test "merge-driver: program"
+(
+  set -e
+
+  setup_merge_conflict "merge-driver-program"
+  git config lfs.mergeprogram 'cat %A %O %B > %D'
+
+  git merge --no-edit theirs
+  [ "oursbasetheirs" = "$(cat file.dat)" ]
+
+  merged_oid="$(calc_oid "oursbasetheirs")"
+  git cat-file -p HEAD:file.dat | grep "$merged_oid"
+  assert_local_object "$merged_oid" 14
+)
+end_test
+
+begin_test "merge-driver: program with placeholders in the path"
+(
+  set -e
+
+  reponame="merge-driver-program-path"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "*.dat merge=lfs" >> .gitattributes
+  git config merge.lfs.driver "git lfs merge-driver --ancestor %O --current %A --other %B --marker-size %L --path %P"
+  git config lfs.mergeprogram 'printf "%s" %P > %D'
+
+  printf "base" > "50%B.dat"
+  git add .gitattributes "50%B.dat"
+  git commit -m "base"
+
+  git checkout -b theirs
+  printf "theirs" > "50%B.dat"
+  git add "50%B.dat"
+  git commit -m "theirs"
+
+  git checkout master
+  printf "ours" > "50%B.dat"
+  git add "50%B.dat"
+  git commit -m "ours"
+
+  git merge --no-edit theirs
+  [ "50%B.dat" = "$(cat "50%B.dat")" ]
+)
+end_test
+
+begin_test "merge-driver: conflict"
+(
+  set -e
+
+  setup_merge_conflict "merge-driver-conflict"
+
+  set +e
+  git merge --no-edit theirs 2>&1 | tee merge.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" = "1" ]
+  grep "CONFLICT" merge.log
+  grep "<<<<<<< ours" file.dat
+  grep ">>>>>>> theirs" file.dat
+
+  git lfs checkout --to theirs.dat --theirs file.dat
+  [ "theirs" = "$(cat theirs.dat)" ]
+)
+end_test
+
+begin_test "merge-driver: failing program leaves a conflict"
+(
+  set -e
+
+  setup_merge_conflict "merge-driver-program-fails"
+  git config lfs.mergeprogram 'exit 1'
+
+  set +e
+  git merge --no-edit theirs 2>&1 | tee merge.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" = "1" ]
+  grep "merge program" merge.log
+  grep "<<<<<<< ours" file.dat
+)
+end_test
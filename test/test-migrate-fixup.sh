@@ -0,0 +1,93 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "migrate import --fixup: converts unpushed files"
+(
+  set -e
+
+  reponame="migrate-fixup"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  echo "small" > small.txt
+  git add small.txt
+  git commit -m "initial commit"
+  git push origin master
+  pushed="$(git rev-parse HEAD)"
+
+  # commit a large file before it is tracked
+  git lfs uninstall
+  printf "big file contents" > big.dat
+  git add big.dat
+  git commit -m "add big.dat"
+  git lfs install
+  git lfs track "*.dat"
+  git add .gitattributes
+  git commit -m "track *.dat"
+
+  [ "big file contents" = "$(git cat-file -p HEAD:big.dat)" ]
+
+  git lfs migrate import --fixup 2>&1 | tee migrate.log
+  grep "converted 1 file(s) on master" migrate.log
+
+  # pushed history is untouched
+  [ "$pushed" = "$(git rev-parse HEAD~2)" ]
+  [ "add big.dat" = "$(git log -1 --format=%s HEAD~1)" ]
+
+  contents_oid="$(calc_oid "big file contents")"
+  git cat-file -p HEAD~1:big.dat | grep "oid sha256:$contents_oid"
+  git cat-file -p HEAD:big.dat | grep "oid sha256:$contents_oid"
+  assert_local_object "$contents_oid" 17
+
+  [ "big file contents" = "$(cat big.dat)" ]
+  [ -z "$(git status --porcelain --untracked-files=no)" ]
+
+  git push origin master
+  assert_server_object "$reponame" "$contents_oid"
+)
+end_test
+
+begin_test "migrate import --fixup: nothing to do"
+(
+  set -e
+
+  reponame="migrate-fixup-nothing"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "already lfs" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  before="$(git rev-parse HEAD)"
+
+  git lfs migrate import --fixup 2>&1 | tee migrate.log
+  grep "nothing to convert on master" migrate.log
+  [ "$before" = "$(git rev-parse HEAD)" ]
+)
+end_test
+
+begin_test "migrate import: refuses a dirty working copy"
+(
+  set -e
+
+  reponame="migrate-fixup-dirty"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "text" > a.txt
+  git add .gitattributes a.txt
+  git commit -m "initial commit"
+  echo "changed" > a.txt
+
+  set +e
+  git lfs migrate import --fixup 2>&1 | tee migrate.log
+  res=${PIPESTATUS[0]}
+  set -e
+
+  [ "$res" = "2" ]
+  grep "working copy has uncommitted changes" migrate.log
+)
+end_test
@@ -0,0 +1,101 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "migrate remote: moves objects to a new server"
+(
+  set -e
+
+  reponame="migrate-remote"
+  setup_remote_repo "$reponame"
+  setup_remote_repo "$reponame-new"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git checkout -b other
+  printf "b" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+  git push origin master other
+
+  a_oid="$(calc_oid "a")"
+  b_oid="$(calc_oid "b")"
+
+  # objects which aren't local are fetched from the old server first
+  rm -rf .git/lfs/objects
+
+  newurl="$GITSERVER/$reponame-new.git/info/lfs"
+  git lfs migrate remote "$newurl" 2>&1 | tee migrate.log
+  grep "migrate remote: set remote.origin.lfsurl=$newurl (in .git/config)" migrate.log
+  grep "migrate remote: origin now uses $newurl" migrate.log
+
+  assert_server_object "$reponame-new" "$a_oid"
+  assert_server_object "$reponame-new" "$b_oid"
+  [ "$newurl" = "$(git config remote.origin.lfsurl)" ]
+  git lfs env | grep "Endpoint=$newurl"
+
+  # running it again moves nothing
+  git lfs migrate remote "$newurl" 2>&1 | tee migrate.log
+  grep "origin already uses $newurl" migrate.log
+)
+end_test
+
+begin_test "migrate remote: rewrites .lfsconfig"
+(
+  set -e
+
+  reponame="migrate-remote-lfsconfig"
+  setup_remote_repo "$reponame"
+  setup_remote_repo "$reponame-new"
+  clone_repo "$reponame" "$reponame"
+
+  git config -f .lfsconfig lfs.url "$GITSERVER/$reponame.git/info/lfs"
+  git lfs track "*.dat"
+  printf "c" > c.dat
+  git add .lfsconfig .gitattributes c.dat
+  git commit -m "add c.dat"
+  git push origin master
+
+  newurl="$GITSERVER/$reponame-new.git/info/lfs"
+  git lfs migrate remote "$newurl" 2>&1 | tee migrate.log
+  grep "migrate remote: set lfs.url=$newurl (in .lfsconfig)" migrate.log
+
+  assert_server_object "$reponame-new" "$(calc_oid "c")"
+  [ "$newurl" = "$(git config -f .lfsconfig lfs.url)" ]
+  [ -z "$(git config remote.origin.lfsurl)" ]
+)
+end_test
+
+begin_test "migrate remote: leaves the remote as it is when objects can't be fetched"
+(
+  set -e
+
+  reponame="migrate-remote-missing"
+  setup_remote_repo "$reponame"
+  setup_remote_repo "$reponame-new"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "d" > d.dat
+  git add .gitattributes d.dat
+  git commit -m "add d.dat"
+  git push origin master
+
+  d_oid="$(calc_oid "d")"
+  delete_server_object "$reponame" "$d_oid"
+  rm -rf .git/lfs/objects
+
+  set +e
+  git lfs migrate remote "$GITSERVER/$reponame-new.git/info/lfs" 2>&1 | tee migrate.log
+  migrate_exit=${PIPESTATUS[0]}
+  set -e
+  [ "$migrate_exit" = "2" ]
+
+  grep "could not fetch every object" migrate.log
+  refute_server_object "$reponame-new" "$d_oid"
+  [ -z "$(git config remote.origin.lfsurl)" ]
+)
+end_test
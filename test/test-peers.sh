@@ -0,0 +1,73 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "peers: download objects from a peer before the remote"
+(
+  set -e
+
+  reponame="peers-download"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents="shared by a peer"
+  oid="$(calc_oid "$contents")"
+  missing="only on the remote"
+  missing_oid="$(calc_oid "$missing")"
+  printf "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  cd ..
+  clone_repo "$reponame" "$reponame-peer"
+  assert_local_object "$oid" 16
+
+  port=$((40000 + $$ % 10000))
+
+  # without a secret, nothing is served
+  git lfs peers serve --port "$port" 2>&1 | tee serve.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected 'git lfs peers serve' to fail without a secret"
+    exit 1
+  fi
+  grep "lfs.peers.secret must be set" serve.log
+
+  git config lfs.peers.secret studio
+  git lfs peers serve --port "$port" > serve.log 2>&1 &
+  serve_pid=$!
+  trap "kill $serve_pid" EXIT
+  sleep 1
+
+  cd ../"$reponame"
+  printf "$missing" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+  git push origin master
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-fetch"
+  git config lfs.peers.enabled true
+  git config lfs.peers.secret studio
+  git config lfs.peers.port "$port"
+  git config lfs.peers.address 127.0.0.1
+
+  git lfs peers | tee peers.log
+  grep ":$port" peers.log
+
+  GIT_TRACE=1 git lfs fetch 2>&1 | tee fetch.log
+  grep "peers: downloaded $oid from .*:$port" fetch.log
+  grep "tq: sending batch of size 1" fetch.log
+  assert_local_object "$oid" 16
+  assert_local_object "$missing_oid" 18
+
+  # peers with another secret are neither found nor asked
+  rm -rf .git/lfs/objects
+  git config lfs.peers.secret guess
+  GIT_TRACE=1 git lfs fetch 2>&1 | tee fetch.log
+  grep "peers: none found" fetch.log
+  grep "tq: sending batch of size 2" fetch.log
+  assert_local_object "$oid" 16
+)
+end_test
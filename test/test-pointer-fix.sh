@@ -0,0 +1,58 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "pointer --fix: non-canonical pointers are read and fixed"
+(
+  set -e
+
+  reponame="pointer-fix"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "crlf" > a.dat
+  printf "bom" > b.dat
+  git add .gitattributes a.dat b.dat
+  git commit -m "add a.dat and b.dat"
+  git push origin master
+
+  a_oid="$(calc_oid "crlf")"
+  b_oid="$(calc_oid "bom")"
+
+  # commit non-canonical pointers directly, bypassing the clean filter
+  a_blob="$(printf "version https://git-lfs.github.com/spec/v1\r\nsize 4\r\noid sha256:$a_oid\r\n" | git hash-object -w --stdin)"
+  printf "\xef\xbb\xbfversion https://git-lfs.github.com/spec/v1\noid sha256:$b_oid\nsize 3\n" > b.dat
+  b_blob="$(git hash-object -w --no-filters b.dat)"
+  git update-index --cacheinfo 100644 "$a_blob" a.dat
+  git update-index --cacheinfo 100644 "$b_blob" b.dat
+  git commit -m "non-canonical pointers"
+
+  # the smudge filter reads them, with a warning
+  rm a.dat
+  git checkout -- a.dat 2>&1 | tee checkout.log
+  grep "a.dat: Git LFS pointer has CRLF line endings and keys out of order" checkout.log
+  [ "crlf" = "$(cat a.dat)" ]
+
+  # as do the scanners
+  git lfs ls-files 2>&1 | tee ls-files.log
+  grep "Warning: Git LFS pointer $b_oid (blob $b_blob) has a byte order mark" ls-files.log
+  grep "b.dat" ls-files.log
+
+  git lfs pointer --fix 2>&1 | tee fix.log
+  grep "Fixed a.dat, which had CRLF line endings and keys out of order" fix.log
+  grep "Fixed b.dat, which had a byte order mark" fix.log
+  grep "Fixed 2 pointer(s)" fix.log
+
+  [ "$(printf "version https://git-lfs.github.com/spec/v1\noid sha256:$a_oid\nsize 4")" = "$(git cat-file -p :a.dat)" ]
+  [ "$(printf "version https://git-lfs.github.com/spec/v1\noid sha256:$b_oid\nsize 3")" = "$(git cat-file -p :b.dat)" ]
+
+  # b.dat held the pointer itself, so it was rewritten too
+  [ "$(git cat-file -p :b.dat)" = "$(cat b.dat)" ]
+  [ "crlf" = "$(cat a.dat)" ]
+  [ -z "$(git diff --name-only)" ]
+
+  git lfs pointer --fix 2>&1 | tee fix.log
+  grep "No pointers to fix" fix.log
+)
+end_test
@@ -0,0 +1,80 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "pointer verify-tree: ranges"
+(
+  set -e
+
+  reponame="pointer-verify-tree"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  git add .gitattributes
+  git commit -m "track *.dat"
+
+  printf "good" > good.dat
+  git add good.dat
+  git commit -m "add good.dat"
+  good_oid="$(calc_oid "good")"
+
+  set +e
+  git lfs pointer verify-tree HEAD~1..HEAD 2>&1 | tee verify.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" = "1" ]
+  grep "good.dat ($good_oid): object missing from the Git LFS server" verify.log
+
+  git lfs push origin master
+  git lfs pointer verify-tree HEAD~1..HEAD
+
+  # commit the contents of bad.dat directly, bypassing the clean filter
+  blob="$(printf "raw contents" | git hash-object -w --stdin)"
+  git update-index --add --cacheinfo 100644 "$blob" bad.dat
+  git commit -m "add bad.dat"
+
+  set +e
+  git lfs pointer verify-tree --no-server-check HEAD~2..HEAD 2>&1 | tee verify.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" = "1" ]
+  grep "bad.dat: not a valid Git LFS pointer" verify.log
+  grep "1 invalid pointer(s), 0 object(s) missing" verify.log
+  [ "0" = "$(grep -c "good.dat" verify.log)" ]
+)
+end_test
+
+begin_test "pointer verify-tree: pre-receive hook"
+(
+  set -e
+
+  reponame="pointer-verify-tree-hook"
+  setup_remote_repo "$reponame"
+
+  remotedir="$REMOTEDIR/$reponame.git"
+  git --git-dir="$remotedir" config lfs.url "$GITSERVER/$reponame.git/info/lfs"
+  printf '#!/bin/sh\nexec "%s/git-lfs" pointer verify-tree\n' "$BINPATH" > "$remotedir/hooks/pre-receive"
+  chmod +x "$remotedir/hooks/pre-receive"
+
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "pushed" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master 2>&1 | tee push.log
+
+  blob="$(printf "raw contents" | git hash-object -w --stdin)"
+  git update-index --add --cacheinfo 100644 "$blob" b.dat
+  git commit -m "add b.dat"
+
+  set +e
+  git push origin master 2>&1 | tee push.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" != "0" ]
+  grep "b.dat: not a valid Git LFS pointer" push.log
+  grep "pre-receive hook declined" push.log
+)
+end_test
@@ -0,0 +1,127 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "post-commit with lfs.autopush"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" repo
+
+  git config lfs.autopush true
+  git lfs update | tee update.log
+  grep "Updated pre-push and post-commit hooks." update.log
+  grep "git lfs post-commit" .git/hooks/post-commit
+
+  git lfs track "*.dat"
+  echo "autopush" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  oid="$(calc_oid_file a.dat)"
+  n=0
+  while ! grep -q "Uploaded 1 files" .git/lfs/autopush.log 2>/dev/null; do
+    n=$((n + 1))
+    [ $n -lt 100 ] || { cat .git/lfs/autopush.log; exit 1; }
+    sleep 0.2
+  done
+  cat .git/lfs/autopush.log
+
+  assert_server_object "$reponame" "$oid"
+
+  git push origin master 2>&1 | tee push.log
+  grep "(0 of 0 files, 1 skipped)" push.log
+)
+end_test
+
+begin_test "post-commit queues commits while an autopush is running"
+(
+  set -e
+
+  if ! command -v flock > /dev/null 2>&1; then
+    echo "skip: flock is not installed"
+    exit 0
+  fi
+
+  reponame="$(basename "$0" ".sh")-queued"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" repo-queued
+
+  git config lfs.autopush true
+  git lfs update
+  git lfs track "*.dat"
+  git add .gitattributes
+  git commit -m "track *.dat"
+  wait_for_autopush() {
+    n=0
+    while [ -e .git/lfs/autopush.pid ] || ! grep -q "$1" .git/lfs/autopush.log 2>/dev/null; do
+      n=$((n + 1))
+      [ $n -lt 100 ] || { cat .git/lfs/autopush.log; exit 1; }
+      sleep 0.2
+    done
+  }
+  wait_for_autopush "Uploaded 0 files"
+  rm .git/lfs/autopush.log
+
+  # hold the lock an autopush holds while it runs
+  mkdir -p .git/lfs
+  echo "$$" > .git/lfs/autopush.pid
+  flock .git/lfs/autopush.pid sleep 30 &
+  flock_pid=$!
+  sleep 1
+
+  echo "queued" > a.dat
+  git add a.dat
+  GIT_TRACE=1 git commit -m "add a.dat" 2>&1 | tee commit.log
+  grep "already pushing in the background (pid $$), queued" commit.log
+  [ -e .git/lfs/autopush.queued ]
+  [ ! -e .git/lfs/autopush.log ]
+
+  kill "$flock_pid"
+  wait "$flock_pid" || true
+  rm .git/lfs/autopush.pid
+
+  echo "pushed with the queued commit" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+  wait_for_autopush "Uploaded 2 files"
+  cat .git/lfs/autopush.log
+
+  [ ! -e .git/lfs/autopush.queued ]
+  assert_server_object "$reponame" "$(calc_oid_file a.dat)"
+  assert_server_object "$reponame" "$(calc_oid_file b.dat)"
+)
+end_test
+
+begin_test "post-commit without lfs.autopush"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-disabled"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" repo-disabled
+
+  git lfs update | tee update.log
+  grep "Updated pre-push hook." update.log
+  [ ! -e .git/hooks/post-commit ]
+
+  git config lfs.autopush true
+  git lfs update
+  [ -e .git/hooks/post-commit ]
+
+  # the hook does nothing once lfs.autopush is unset
+  git config --unset lfs.autopush
+  git lfs track "*.dat"
+  echo "not autopushed" > b.dat
+  git add .gitattributes b.dat
+  git commit -m "add b.dat"
+  [ ! -e .git/lfs/autopush.log ]
+  refute_server_object "$reponame" "$(calc_oid_file b.dat)"
+
+  git lfs uninstall hooks
+  [ ! -e .git/hooks/post-commit ]
+  [ ! -e .git/hooks/pre-push ]
+)
+end_test
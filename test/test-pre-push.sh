@@ -234,6 +234,44 @@ begin_test "pre-push with missing pointer which is on server"
 )
 end_test
 
+begin_test "pre-push with missing pointer in existence filter"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-existence-filter"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  contents="filtered data"
+  contents_oid=$(calc_oid "$contents")
+  git lfs track "*.dat"
+  printf "$contents" > a.dat
+  git add a.dat .gitattributes
+  git commit -m "add a.dat"
+
+  # the filter cached by the first push won't have the object in it
+  git config lfs.existencefiltermaxage 0
+
+  echo "refs/heads/master master refs/heads/master 0000000000000000000000000000000000000000" |
+    git lfs pre-push origin "$GITSERVER/$reponame" 2>&1 |
+    tee push.log
+  grep "(1 of 1 files)" push.log
+  assert_server_object "$reponame" "$contents_oid"
+
+  printf "$contents" > b.dat
+  git add b.dat
+  git commit -m "add b.dat, same content"
+  rm -rf .git/lfs/objects
+
+  echo "refs/heads/master master refs/heads/master 0000000000000000000000000000000000000000" |
+    GIT_TRACE=1 git lfs pre-push origin "$GITSERVER/$reponame" 2>&1 |
+    tee push.log
+  [ -z "$(grep -i 'Error' push.log)" ]
+  grep "existence filter: skipped checking 1 of 1 object(s)" push.log
+  [ -z "$(grep "POST .*/objects/batch" push.log)" ]
+)
+end_test
+
 begin_test "pre-push multiple branches"
 (
   set -e
@@ -448,3 +486,28 @@ begin_test "pre-push delete branch"
 
 )
 end_test
+
+begin_test "pre-push while offline"
+(
+  set -e
+
+  reponame="pre-push-offline"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "offline" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  oid="$(calc_oid "offline\n")"
+
+  git -c lfs.offline=true push origin master 2>&1 | tee push.log
+  grep "Git LFS is offline: queued 1 files to push later with 'git lfs push --queued origin'" push.log
+  refute_server_object "$reponame" "$oid"
+  [ "$(git rev-parse master)" = "$(git rev-parse origin/master)" ]
+
+  git lfs push --queued origin
+  assert_server_object "$reponame" "$oid"
+)
+end_test
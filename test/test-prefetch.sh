@@ -0,0 +1,163 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "prefetch: downloads objects for new upstream commits"
+(
+  set -e
+
+  reponame="prefetch-once"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  contents_b="b"
+  contents_b_oid="$(calc_oid "$contents_b")"
+
+  cd ..
+  clone_repo "$reponame" "$reponame-other"
+  printf "$contents_b" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+  git push origin master
+
+  cd "../$reponame"
+  refute_local_object "$contents_b_oid"
+
+  git lfs prefetch 2>&1 | tee prefetch.log
+  grep "Prefetching origin/master" prefetch.log
+  assert_local_object "$contents_b_oid" 1
+
+  # the branch itself is left alone until it is pulled
+  [ ! -f b.dat ]
+  git pull origin master
+  [ "$contents_b" = "$(cat b.dat)" ]
+)
+end_test
+
+begin_test "prefetch: --daemon runs in the background until stopped"
+(
+  set -e
+
+  reponame="prefetch-daemon"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  contents_c="c"
+  contents_c_oid="$(calc_oid "$contents_c")"
+
+  cd ..
+  clone_repo "$reponame" "$reponame-other"
+  printf "$contents_c" > c.dat
+  git add c.dat
+  git commit -m "add c.dat"
+  git push origin master
+
+  cd "../$reponame"
+  git lfs prefetch --daemon --interval 1 2>&1 | tee daemon.log
+  grep "in the background" daemon.log
+  [ -f .git/lfs/prefetch.pid ]
+
+  set +e
+  git lfs prefetch --daemon 2>&1 | tee again.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" = "2" ]
+  grep "already running" again.log
+
+  for i in $(seq 1 20); do
+    [ -s ".git/lfs/objects/${contents_c_oid:0:2}/${contents_c_oid:2:2}/$contents_c_oid" ] && break
+    sleep 1
+  done
+  assert_local_object "$contents_c_oid" 1
+  grep "Prefetching origin/master" .git/lfs/prefetch.log
+
+  git lfs prefetch --stop 2>&1 | tee stop.log
+  grep "Stopped git lfs prefetch" stop.log
+  [ ! -f .git/lfs/prefetch.pid ]
+
+  git lfs prefetch --stop 2>&1 | tee stop.log
+  grep "not running in the background" stop.log
+)
+end_test
+
+begin_test "prefetch: --watch removes its pid file when it stops"
+(
+  set -e
+
+  reponame="prefetch-watch-stop"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  git lfs prefetch --watch --interval 1 --timeout 2s
+  [ ! -f .git/lfs/prefetch.pid ]
+
+  # git-lfs itself is run, rather than git, which would be the one sent the
+  # signal.
+  git-lfs prefetch --watch --interval 1 > watch.log 2>&1 &
+  pid=$!
+  for i in $(seq 1 20); do
+    [ -f .git/lfs/prefetch.pid ] && break
+    sleep 1
+  done
+  [ -f .git/lfs/prefetch.pid ]
+
+  kill -TERM "$pid"
+  wait "$pid"
+  [ ! -f .git/lfs/prefetch.pid ]
+)
+end_test
+
+begin_test "prefetch: --stop leaves alone a process given a stale pid"
+(
+  set -e
+
+  reponame="prefetch-stale-pid"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  # the pid file of a prefetch which didn't clean up after itself, whose pid
+  # has since been given to another process
+  sleep 60 &
+  pid=$!
+  mkdir -p .git/lfs
+  echo "$pid" > .git/lfs/prefetch.pid
+
+  git lfs prefetch --stop 2>&1 | tee stop.log
+  grep "not running in the background" stop.log
+  kill -0 "$pid"
+
+  git lfs prefetch --daemon --interval 1 2>&1 | tee daemon.log
+  grep "in the background" daemon.log
+  [ "$pid" != "$(cat .git/lfs/prefetch.pid)" ]
+
+  git lfs prefetch --stop 2>&1 | tee stop.log
+  grep "Stopped git lfs prefetch" stop.log
+  [ ! -f .git/lfs/prefetch.pid ]
+  kill -0 "$pid"
+  kill "$pid"
+)
+end_test
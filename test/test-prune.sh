@@ -537,4 +537,223 @@ begin_test "prune verify"
   refute_local_object "$oid_commit3"
 
 )
-end_test
\ No newline at end of file
+end_test
+
+begin_test "prune keep stashed, staged and in-progress"
+(
+  set -e
+
+  reponame="prune_safety"
+  setup_remote_repo "remote_$reponame"
+
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track "*.dat" 2>&1 | tee track.log
+  grep "Tracking \*.dat" track.log
+
+  content_head="HEAD content"
+  content_stashed="Stashed content (keep)"
+  content_staged="Staged content (keep)"
+  content_merging="Content on branch being merged (keep)"
+  oid_head=$(calc_oid "$content_head")
+  oid_stashed=$(calc_oid "$content_stashed")
+  oid_staged=$(calc_oid "$content_staged")
+  oid_merging=$(calc_oid "$content_merging")
+
+  echo "[
+  {
+    \"CommitDate\":\"$(get_date -40d)\",
+    \"Files\":[
+      {\"Filename\":\"file.dat\",\"Size\":${#content_head}, \"Data\":\"$content_head\"}]
+  },
+  {
+    \"CommitDate\":\"$(get_date -30d)\",
+    \"NewBranch\":\"merging\",
+    \"Files\":[
+      {\"Filename\":\"merging.dat\",\"Size\":${#content_merging}, \"Data\":\"$content_merging\"}]
+  }
+  ]" | lfstest-testutils addcommits
+
+  git push origin master merging
+  git checkout master
+
+  git config lfs.fetchrecentrefsdays 0
+  git config lfs.fetchrecentremoterefs true
+  git config lfs.fetchrecentcommitsdays 0
+
+  # stash a modification, stage another, and start a merge of a branch which
+  # is then deleted, so none of the content is reachable from a branch
+  printf "$content_stashed" > file.dat
+  git stash
+  git merge --no-commit --no-ff merging
+  git branch -D merging
+  git push origin :merging
+  printf "$content_staged" > staged.dat
+  git add staged.dat
+
+  git lfs prune --dry-run --verbose 2>&1 | tee prune.log
+  grep "4 local objects, 4 retained" prune.log
+  grep "Nothing to prune" prune.log
+
+  git lfs prune --no-safety-check --dry-run --verbose 2>&1 | tee prune.log
+  grep "4 local objects, 1 retained" prune.log
+  grep "3 files would be pruned" prune.log
+  grep "$oid_stashed" prune.log
+  grep "$oid_staged" prune.log
+  grep "$oid_merging" prune.log
+
+  git lfs prune
+  assert_local_object "$oid_head" "${#content_head}"
+  assert_local_object "$oid_stashed" "${#content_stashed}"
+  assert_local_object "$oid_staged" "${#content_staged}"
+  assert_local_object "$oid_merging" "${#content_merging}"
+)
+end_test
+
+begin_test "prune objects older than"
+(
+  set -e
+
+  reponame="prune_objects_older_than"
+  setup_remote_repo "remote_$reponame"
+
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track "*.dat" 2>&1 | tee track.log
+  grep "Tracking \*.dat" track.log
+
+  content_unused="Unused for a month, unreferenced"
+  content_used="Used yesterday, unreferenced"
+  content_recent="Unused for a month, on a recent branch"
+  content_head="Unused for a month, but at HEAD"
+  oid_unused=$(calc_oid "$content_unused")
+  oid_used=$(calc_oid "$content_used")
+  oid_recent=$(calc_oid "$content_recent")
+  oid_head=$(calc_oid "$content_head")
+
+  echo "[
+  {
+    \"CommitDate\":\"$(get_date -40d)\",
+    \"Files\":[
+      {\"Filename\":\"file.dat\",\"Size\":${#content_unused}, \"Data\":\"$content_unused\"}]
+  },
+  {
+    \"CommitDate\":\"$(get_date -30d)\",
+    \"Files\":[
+      {\"Filename\":\"file.dat\",\"Size\":${#content_used}, \"Data\":\"$content_used\"}]
+  },
+  {
+    \"CommitDate\":\"$(get_date -1d)\",
+    \"NewBranch\":\"recent\",
+    \"Files\":[
+      {\"Filename\":\"file.dat\",\"Size\":${#content_recent}, \"Data\":\"$content_recent\"}]
+  },
+  {
+    \"ParentBranches\":[\"master\"],
+    \"Files\":[
+      {\"Filename\":\"file.dat\",\"Size\":${#content_head}, \"Data\":\"$content_head\"}]
+  }
+  ]" | lfstest-testutils addcommits
+
+  git push origin master recent
+
+  git config lfs.fetchrecentrefsdays 5
+  git config lfs.fetchrecentcommitsdays 0
+
+  now=$(date +%s)
+  month_ago=$((now - 30*24*60*60))
+  printf "%s %s\n%s %s\n%s %s\n%s %s\n" \
+    "$oid_unused" "$month_ago" \
+    "$oid_used" "$((now - 24*60*60))" \
+    "$oid_recent" "$month_ago" \
+    "$oid_head" "$month_ago" > .git/lfs/access
+
+  git lfs prune --objects-older-than 7 --dry-run --verbose 2>&1 | tee prune.log
+  grep "2 files would be pruned" prune.log
+  grep "$oid_unused" prune.log
+  grep "$oid_recent" prune.log
+
+  git lfs prune --objects-older-than 7
+  refute_local_object "$oid_unused"
+  refute_local_object "$oid_recent"
+  assert_local_object "$oid_used" "${#content_used}"
+  assert_local_object "$oid_head" "${#content_head}"
+
+  # pruned objects are dropped from the access log
+  [ "$(grep -c "$oid_unused" .git/lfs/access)" -eq 0 ]
+  [ "$(grep -c "$oid_used" .git/lfs/access)" -eq 1 ]
+
+  # checking out a file records that its object was used
+  rm file.dat
+  git lfs checkout file.dat
+  [ "$(grep -c "$oid_head" .git/lfs/access)" -eq 2 ]
+)
+end_test
+
+begin_test "prune storage limit"
+(
+  set -e
+
+  reponame="prune_storage_limit"
+  setup_remote_repo "remote_$reponame"
+
+  clone_repo "remote_$reponame" "clone_$reponame"
+
+  git lfs track "*.dat" 2>&1 | tee track.log
+  grep "Tracking \*.dat" track.log
+
+  content_lru="Least recently used, on a recent branch"
+  content_mru="Most recently used, on a recent branch"
+  content_head="Least recently used of all, but at HEAD"
+  oid_lru=$(calc_oid "$content_lru")
+  oid_mru=$(calc_oid "$content_mru")
+  oid_head=$(calc_oid "$content_head")
+
+  echo "[
+  {
+    \"CommitDate\":\"$(get_date -3d)\",
+    \"Files\":[
+      {\"Filename\":\"head.dat\",\"Size\":${#content_head}, \"Data\":\"$content_head\"}]
+  },
+  {
+    \"CommitDate\":\"$(get_date -2d)\",
+    \"NewBranch\":\"recent\",
+    \"Files\":[
+      {\"Filename\":\"lru.dat\",\"Size\":${#content_lru}, \"Data\":\"$content_lru\"},
+      {\"Filename\":\"mru.dat\",\"Size\":${#content_mru}, \"Data\":\"$content_mru\"}]
+  },
+  {
+    \"ParentBranches\":[\"master\"]
+  }
+  ]" | lfstest-testutils addcommits
+
+  git push origin master recent
+
+  git config lfs.fetchrecentrefsdays 5
+  git config lfs.fetchrecentcommitsdays 0
+
+  now=$(date +%s)
+  printf "%s %s\n%s %s\n%s %s\n" \
+    "$oid_lru" "$((now - 3600))" \
+    "$oid_mru" "$now" \
+    "$oid_head" "$((now - 7200))" > .git/lfs/access
+
+  git lfs prune --dry-run 2>&1 | tee prune.log
+  grep "Nothing to prune" prune.log
+
+  git config lfs.storagelimit $((${#content_head} + ${#content_mru}))
+  git lfs prune --verbose 2>&1 | tee prune.log
+  grep "Pruning 1 files" prune.log
+  grep "$oid_lru" prune.log
+  refute_local_object "$oid_lru"
+  assert_local_object "$oid_mru" "${#content_mru}"
+  assert_local_object "$oid_head" "${#content_head}"
+
+  # objects at HEAD are kept even when over the limit
+  git config lfs.storagelimit 1
+  git lfs prune 2>&1 | tee prune.log
+  grep "more than lfs.storagelimit" prune.log
+  refute_local_object "$oid_mru"
+  assert_local_object "$oid_head" "${#content_head}"
+)
+end_test
@@ -139,6 +139,112 @@ begin_test "pull with raw remote url"
 )
 end_test
 
+begin_test "pull --fast-forward-only-check"
+(
+  set -e
+
+  reponame="pull-check-first"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "present" > present.dat
+  printf "missing" > missing.dat
+  git add .gitattributes present.dat missing.dat
+  git commit -m "add files"
+  git push origin master
+
+  present_oid="$(calc_oid "present")"
+  missing_oid="$(calc_oid "missing")"
+  delete_server_object "$reponame" "$missing_oid"
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 git clone "$GITSERVER/$reponame" "$reponame-clone"
+  cd "$reponame-clone"
+
+  set +e
+  git lfs pull --fast-forward-only-check > pull.log 2>&1
+  res=$?
+  set -e
+  cat pull.log
+  [ "$res" -eq 6 ]
+  grep "Not pulling: 1 of 2 objects can't be downloaded" pull.log
+
+  # neither the objects nor the working copy were touched
+  refute_local_object "$present_oid"
+  grep "$present_oid" present.dat
+  grep "$missing_oid" missing.dat
+
+  # the check passes once the objects which aren't local are on the server
+  git lfs pull --fast-forward-only-check --exclude="missing.dat"
+  [ "present" = "$(cat present.dat)" ]
+  assert_local_object "$present_oid" 7
+)
+end_test
+
+begin_test "pull with lfs.missingobjectpolicy"
+(
+  set -e
+
+  reponame="pull-missing-object-policy"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "present" > present.dat
+  printf "missing" > missing.dat
+  git add .gitattributes present.dat missing.dat
+  git commit -m "add files"
+  git push origin master
+
+  missing_oid="$(calc_oid "missing")"
+  delete_server_object "$reponame" "$missing_oid"
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 git clone "$GITSERVER/$reponame" "$reponame-clone"
+  cd "$reponame-clone"
+
+  set +e
+  git -c lfs.missingobjectpolicy=fail lfs pull > pull.log 2>&1
+  res=$?
+  set -e
+  cat pull.log
+  [ "$res" -ne 0 ]
+  grep "$missing_oid" missing.dat
+
+  # pulls still fail when objects are missing, whatever the policy
+  for policy in pointer placeholder; do
+    rm -f present.dat
+    git checkout -- present.dat
+
+    set +e
+    git -c lfs.missingobjectpolicy=$policy lfs pull > pull.log 2>&1
+    res=$?
+    set -e
+    cat pull.log
+    [ "$res" -ne 0 ]
+    [ "present" = "$(cat present.dat)" ]
+    grep "$missing_oid" missing.dat
+  done
+
+  touch xattr-test
+  if command -v getfattr >/dev/null && setfattr -n user.test -v 1 xattr-test 2>/dev/null; then
+    [ "$missing_oid" = "$(getfattr --only-values -n user.git-lfs.missing missing.dat)" ]
+  fi
+  rm xattr-test
+
+  # placeholders are cleaned as the pointers they are, so aren't modified,
+  # and are checked out once their objects can be downloaded
+  [ -z "$(git status --porcelain -- missing.dat)" ]
+
+  cd ../"$reponame"
+  git lfs push --object-id origin "$missing_oid"
+  cd ../"$reponame-clone"
+  git lfs pull
+  [ "missing" = "$(cat missing.dat)" ]
+)
+end_test
+
 begin_test "pull: outside git repository"
 (
   set +e
@@ -128,3 +128,72 @@ begin_test "push: upload file with api 500"
   push_fail_test "status-batch-500"
 )
 end_test
+
+begin_test "push: upload errors are grouped and logged"
+(
+  set -e
+
+  reponame="push-failures-error-log"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "status-storage-422" > bad.dat
+  git add .gitattributes bad.dat
+  git commit -m "add bad.dat"
+
+  set +e
+  git lfs push origin master > push.log 2>&1
+  res=$?
+  set -e
+  cat push.log
+  [ "$res" -eq 2 ]
+  grep "Failed to upload to .* (HTTP 422): 1 errors" push.log
+
+  log="$(ls .git/lfs/objects/logs/*-upload-errors.json)"
+  grep "Upload errors written to .*/$log" push.log
+  cat "$log"
+
+  oid="$(calc_oid "status-storage-422")"
+  [ "1" -eq "$(wc -l < "$log")" ]
+  grep "\"oid\":\"$oid\"" "$log"
+  grep '"name":"bad.dat"' "$log"
+  grep '"action":"upload"' "$log"
+  grep '"status":422' "$log"
+  grep '"retries":\[' "$log"
+)
+end_test
+
+begin_test "push: exit codes tell why uploads failed"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-exit-codes"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "hi" > good.dat
+  printf "status-storage-500" > bad.dat
+  git add .gitattributes good.dat bad.dat
+  git commit -m "welp"
+
+  set +e
+  git lfs push origin master 2>&1 | tee push.log
+  res="${PIPESTATUS[0]}"
+  set -e
+
+  # good.dat was uploaded, but not bad.dat
+  assert_server_object "$reponame" "$(calc_oid "hi")"
+  [ "$res" = "7" ]
+
+  git config lfs.url "http://git-lfs-bad-dns:63378"
+
+  set +e
+  GIT_TERMINAL_PROMPT=0 git lfs push origin master 2>&1 | tee push.log
+  res="${PIPESTATUS[0]}"
+  set -e
+
+  [ "$res" = "5" ]
+)
+end_test
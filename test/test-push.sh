@@ -174,6 +174,36 @@ begin_test "push --all (no ref args)"
 )
 end_test
 
+begin_test "push --all (no ref args) skips objects on the remote"
+(
+  set -e
+
+  reponame="push-all-skip-remote"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "old" > old.dat
+  git add .gitattributes old.dat
+  git commit -m "add old.dat"
+  git push origin master
+
+  git checkout -b branch
+  printf "new" > new.dat
+  git add new.dat
+  git commit -m "add new.dat"
+
+  git lfs push --dry-run --all origin 2>&1 | tee push.log
+  grep "push $(calc_oid "new") => new.dat" push.log
+  [ $(grep -c "push" < push.log) -eq 1 ]
+
+  # objects reachable from the remote are pushed when refs are given
+  git lfs push --dry-run --all origin branch 2>&1 | tee push.log
+  grep "push $(calc_oid "new") => new.dat" push.log
+  grep "push $(calc_oid "old") => old.dat" push.log
+)
+end_test
+
 begin_test "push --all (1 ref arg)"
 (
   set -e
@@ -274,6 +304,49 @@ begin_test "push --all (multiple ref args)"
 )
 end_test
 
+begin_test "push multiple refs shows the progress of each"
+(
+  set -e
+
+  reponame="push-multiple-refs-progress"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  git checkout -b branch
+  echo "b" > b.dat
+  echo "c" > c.dat
+  git add b.dat c.dat
+  git commit -m "add b.dat and c.dat"
+
+  git lfs push origin master branch 2>&1 | tee push.log
+  grep "Git LFS: \[1/2\] master (1 of 1 files)" push.log
+  grep "Git LFS: \[2/2\] branch (2 of 2 files)" push.log
+  grep "total (3 of 3 files)" push.log
+  grep "Git LFS: total (3 of 3 files)" push.log
+
+  git checkout master
+  echo "d" > d.dat
+  git add d.dat
+  git commit -m "add d.dat"
+  git checkout branch
+  echo "e" > e.dat
+  git add e.dat
+  git commit -m "add e.dat"
+
+  GIT_LFS_PROGRESS_FORMAT=json git lfs push origin master branch > push.json
+  cat push.json
+  grep '"section":"master","index":1,"sections":2,"progress":{"files":1,"estimated_files":1' push.json
+  grep '"section":"branch","index":2,"sections":2,"progress":{"files":1,"estimated_files":1' push.json
+  tail -n 1 push.json | grep '^{"sections":2,"total":{"files":2,"estimated_files":2,"skipped_files":3,"bytes":4,"estimated_bytes":4'
+  [ "0" -eq "$(grep -c "Git LFS:" push.json)" ]
+)
+end_test
+
 begin_test "push --all (ref with deleted files)"
 (
   set -e
@@ -357,6 +430,118 @@ begin_test "push object id(s)"
 )
 end_test
 
+begin_test "push object ids from stdin and a file"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-object-id-stdin"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "stdin a" > a.dat
+  printf "stdin b" > b.dat
+  printf "file c" > c.dat
+  git add .gitattributes a.dat b.dat c.dat
+  git commit -m "add files"
+
+  a_oid="$(calc_oid "stdin a")"
+  b_oid="$(calc_oid "stdin b")"
+  c_oid="$(calc_oid "file c")"
+
+  # sizes are optional, and looked up in the local store when not given
+  printf "# objects to push\n$a_oid\n\n$b_oid 7\n" | git lfs push --object-id --stdin origin 2>&1 | tee push.log
+  grep "Uploaded 2 files" push.log
+  assert_server_object "$reponame" "$a_oid"
+  assert_server_object "$reponame" "$b_oid"
+  refute_server_object "$reponame" "$c_oid"
+
+  echo "$c_oid" > oids.txt
+  git lfs push --object-id-file oids.txt origin 2>&1 | tee push.log
+  grep "Uploaded 1 files" push.log
+  assert_server_object "$reponame" "$c_oid"
+
+  echo "not-an-oid" > oids.txt
+  set +e
+  git lfs push --object-id-file oids.txt origin 2>&1 | tee push.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" = "2" ]
+  grep "line 1: expected" push.log
+)
+end_test
+
+begin_test "push object ids needs the sizes of objects not stored locally"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-object-id-size"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "sized" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  oid="$(calc_oid "sized")"
+
+  # the size of a local object is looked up, and must match one given
+  set +e
+  git lfs push --object-id origin "$oid:6" 2>&1 | tee push.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" = "2" ]
+  grep "Size 6 given for $oid, but the local object is 5 bytes" push.log
+
+  GIT_TRACE=1 git lfs push --object-id origin "$oid" 2>&1 | tee push.log
+  grep "Uploaded 1 files" push.log
+  assert_server_object "$reponame" "$oid"
+
+  rm -rf .git/lfs/objects
+
+  set +e
+  git lfs push --object-id origin "$oid" 2>&1 | tee push.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" = "6" ]
+  grep "$oid is not stored locally, so its size is unknown; give it as <oid>:<size>" push.log
+
+  # with its size, the server is asked whether it has the object
+  git lfs push --object-id origin "$oid:5" 2>&1 | tee push.log
+  grep "skipped 1 files already on the server" push.log
+)
+end_test
+
+begin_test "push --quiet and --verbose"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-verbosity"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "quiet" > quiet.dat
+  git add .gitattributes quiet.dat
+  git commit -m "add quiet.dat"
+
+  git lfs push -q origin master 2>&1 | tee push.log
+  [ "0" -eq "$(grep -c "Git LFS:" push.log)" ]
+  assert_server_object "$reponame" "$(calc_oid "quiet")"
+
+  printf "verbose" > verbose.dat
+  git add verbose.dat
+  git commit -m "add verbose.dat"
+
+  git lfs push -v origin master 2>&1 | tee push.log
+  [ "0" -eq "$(grep -c "trace git-lfs" push.log)" ]
+
+  git lfs push -vv origin master 2>&1 | tee push.log
+  grep "trace git-lfs" push.log
+  grep "(0 of 0 files, 2 skipped)" push.log
+)
+end_test
+
 begin_test "push modified files"
 (
   set -e
@@ -542,6 +727,163 @@ begin_test "push to raw remote url"
 )
 end_test
 
+begin_test "push with per-ref urls"
+(
+  set -e
+
+  reponame="push-per-ref-urls"
+  setup_remote_repo "$reponame"
+  setup_remote_repo "$reponame-release"
+  clone_repo "$reponame" "$reponame"
+
+  git config --file=.lfsconfig "lfs.refs/heads/release/*.url" "$GITSERVER/$reponame-release.git/info/lfs"
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .lfsconfig .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  git checkout -b release/1.0
+  printf "b" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+
+  git push origin master release/1.0 2>&1 | tee push.log
+
+  assert_server_object "$reponame" "$(calc_oid "a")"
+  refute_server_object "$reponame" "$(calc_oid "b")"
+  assert_server_object "$reponame-release" "$(calc_oid "a")"
+  assert_server_object "$reponame-release" "$(calc_oid "b")"
+
+  printf "c" > c.dat
+  git add c.dat
+  git commit -m "add c.dat"
+
+  git lfs push origin release/1.0 2>&1 | tee push.log
+  refute_server_object "$reponame" "$(calc_oid "c")"
+  assert_server_object "$reponame-release" "$(calc_oid "c")"
+)
+end_test
+
+begin_test "push refspecs"
+(
+  set -e
+
+  reponame="push-refspecs"
+  setup_remote_repo "$reponame"
+  setup_remote_repo "$reponame-release"
+  clone_repo "$reponame" "$reponame"
+
+  git config --file=.lfsconfig "lfs.refs/heads/release/*.url" "$GITSERVER/$reponame-release.git/info/lfs"
+  git config --file=.lfsconfig "lfs.refs/tags/release/*.url" "$GITSERVER/$reponame-release.git/info/lfs"
+  git lfs track "*.dat"
+  git add .lfsconfig .gitattributes
+  git commit -m "initial commit"
+
+  git checkout -b feature
+  printf "a" > a.dat
+  git add a.dat
+  git commit -m "add a.dat"
+
+  # the objects are pushed to the endpoint of the remote ref
+  git lfs push origin feature:release/1.0 2>&1 | tee push.log
+  refute_server_object "$reponame" "$(calc_oid "a")"
+  assert_server_object "$reponame-release" "$(calc_oid "a")"
+
+  git lfs push origin +HEAD:refs/heads/master 2>&1 | tee push.log
+  assert_server_object "$reponame" "$(calc_oid "a")"
+
+  printf "b" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+  git tag release/2.0
+
+  git lfs push origin tag release/2.0 2>&1 | tee push.log
+  refute_server_object "$reponame" "$(calc_oid "b")"
+  assert_server_object "$reponame-release" "$(calc_oid "b")"
+
+  printf "c" > c.dat
+  git add c.dat
+  git commit -m "add c.dat"
+
+  # deletions push nothing, and HEAD is the current branch
+  git lfs push --dry-run origin :release/1.0 2>&1 | tee push.log
+  [ "0" = "$(grep -c "push" push.log)" ]
+  git lfs push origin HEAD 2>&1 | tee push.log
+  assert_server_object "$reponame" "$(calc_oid "c")"
+
+  set +e
+  git lfs push origin HEAD~1:not-a-full-ref 2>&1 | tee push.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" != "0" ]
+  grep "is not a full ref name" push.log
+
+  set +e
+  git lfs push origin tag 2>&1 | tee push.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" != "0" ]
+  grep "tag shorthand without <tag>" push.log
+)
+end_test
+
+begin_test "push --branches, --tags and ref patterns"
+(
+  set -e
+
+  reponame="push-ref-patterns"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  git add .gitattributes
+  git commit -m "initial commit"
+
+  for name in release/1.0 release/2.0 feature; do
+    git checkout -b "$name" master
+    printf "$name" > "$(basename "$name").dat"
+    git add "$(basename "$name").dat"
+    git commit -m "add $name"
+  done
+  git checkout -b tagged master
+  printf "tagged" > tagged.dat
+  git add tagged.dat
+  git commit -m "add tagged.dat"
+  git tag v1.0
+  git checkout master
+  git branch -D tagged
+
+  git lfs push --dry-run origin "refs/heads/release/*" 2>&1 | tee push.log
+  grep "push $(calc_oid "release/1.0") => 1.0.dat" push.log
+  grep "push $(calc_oid "release/2.0") => 2.0.dat" push.log
+  [ "2" = "$(grep -c "^push" push.log)" ]
+
+  git lfs push --dry-run origin "refs/heads/release/*:refs/heads/rc/*" 2>&1 | tee push.log
+  [ "2" = "$(grep -c "^push" push.log)" ]
+
+  git lfs push --dry-run --tags origin 2>&1 | tee push.log
+  grep "push $(calc_oid "tagged") => tagged.dat" push.log
+  [ "1" = "$(grep -c "^push" push.log)" ]
+
+  git lfs push --dry-run --branches origin 2>&1 | tee push.log
+  grep "push $(calc_oid "feature") => feature.dat" push.log
+  [ "0" = "$(grep -c "tagged.dat" push.log)" ]
+  [ "3" = "$(grep -c "^push" push.log)" ]
+
+  git lfs push --tags origin "refs/heads/feature" 2>&1 | tee push.log
+  assert_server_object "$reponame" "$(calc_oid "tagged")"
+  assert_server_object "$reponame" "$(calc_oid "feature")"
+  refute_server_object "$reponame" "$(calc_oid "release/1.0")"
+
+  set +e
+  git lfs push origin "refs/heads/release/*:refs/heads/rc" 2>&1 | tee push.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" != "0" ]
+  grep "must have a single \* on both sides" push.log
+)
+end_test
+
 begin_test "push (with invalid object size)"
 (
   set -e
@@ -572,3 +914,399 @@ begin_test "push (with invalid object size)"
   refute_server_object "$reponame" "$(calc_oid "$contents")"
 )
 end_test
+
+begin_test "push with lfs.scannerbackend=native"
+(
+  set -e
+
+  reponame="push-scanner-backend-native"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  for i in 1 2 3; do
+    echo "native $i" > "native$i.dat"
+    git add .gitattributes "native$i.dat"
+    git commit -m "add native$i.dat"
+  done
+  git gc -q
+  echo "native loose" > loose.dat
+  git add loose.dat
+  git commit -m "add loose.dat"
+
+  git lfs push --dry-run origin master 2>&1 | sort > git.log
+  git -c lfs.scannerbackend=native lfs push --dry-run origin master 2>&1 | sort > native.log
+  [ $(grep -c "push" native.log) -eq 4 ]
+  diff -u git.log native.log
+
+  GIT_TRACE=1 git -c lfs.scannerbackend=native lfs push origin master 2>&1 | tee push.log
+  grep "scan: reading objects in-process" push.log
+  grep "(4 of 4 files)" push.log
+
+  for i in 1 2 3; do
+    assert_server_object "$reponame" "$(calc_oid "native $i\n")"
+  done
+)
+end_test
+
+begin_test "push summary and --exit-code"
+(
+  set -e
+
+  reponame="push-summary"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "summary a" > a.dat
+  printf "summary b" > b.dat
+  git add .gitattributes a.dat b.dat
+  git commit -m "add a.dat and b.dat"
+
+  git lfs push --dry-run --exit-code origin master 2>&1 | tee push.log
+  grep "Dry run: 2 files to upload (18 B)" push.log
+
+  git lfs push --exit-code origin master 2>&1 | tee push.log
+  grep "Uploaded 2 files (18 B), skipped 0 files already on the server (0 B saved)" push.log
+
+  # the remote ref isn't pushed, so the objects are found again, but the
+  # server has them.
+  set +e
+  git lfs push --exit-code origin master > push.log 2>&1
+  exit_code=$?
+  set -e
+  cat push.log
+  [ "$exit_code" -eq 3 ]
+  grep "Uploaded 0 files (0 B), skipped 2 files already on the server (18 B saved)" push.log
+
+  git lfs push origin master 2>&1 | tee push.log
+  grep "skipped 2 files already on the server" push.log
+
+  git push origin master
+
+  set +e
+  git lfs push --dry-run --exit-code origin master > push.log 2>&1
+  exit_code=$?
+  set -e
+  cat push.log
+  [ "$exit_code" -eq 3 ]
+  grep "Dry run: 0 files to upload (0 B)" push.log
+)
+end_test
+
+begin_test "push while offline queues objects for push --queued"
+(
+  set -e
+
+  reponame="push-offline"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "offline a" > a.dat
+  echo "offline b" > b.dat
+  git add .gitattributes a.dat b.dat
+  git commit -m "add a.dat and b.dat"
+
+  oida="$(calc_oid "offline a\n")"
+  oidb="$(calc_oid "offline b\n")"
+
+  git config lfs.offline true
+  git lfs push origin master 2>&1 | tee push.log
+  grep "Git LFS is offline: queued 2 files to push later with 'git lfs push --queued origin'" push.log
+  refute_server_object "$reponame" "$oida"
+  refute_server_object "$reponame" "$oidb"
+
+  # pushing again doesn't queue the objects twice
+  git lfs push origin master 2>&1 | tee push.log
+  [ "0" -eq "$(grep -c "queued" push.log)" ]
+
+  git lfs status 2>&1 | tee status.log
+  grep "Git LFS objects queued to be pushed to origin:" status.log
+  grep "a.dat (10 B)" status.log
+  grep "b.dat (10 B)" status.log
+
+  git lfs push --queued origin 2>&1 | tee push.log
+  grep "Git LFS is offline" push.log
+  refute_server_object "$reponame" "$oida"
+
+  git config --unset lfs.offline
+  git lfs push --queued origin 2>&1 | tee push.log
+  assert_server_object "$reponame" "$oida"
+  assert_server_object "$reponame" "$oidb"
+
+  git lfs status 2>&1 | tee status.log
+  [ "0" -eq "$(grep -c "queued" status.log)" ]
+
+  git lfs push --queued origin 2>&1 | tee push.log
+  grep "No queued objects to push to origin." push.log
+)
+end_test
+
+begin_test "push --later and --flush-queue"
+(
+  set -e
+
+  reponame="push-later"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "later a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  oida="$(calc_oid "later a\n")"
+  oidb="$(calc_oid "later b\n")"
+
+  git lfs push --later origin master 2>&1 | tee push.log
+  grep "Queued 1 files to push later with 'git lfs push --flush-queue'" push.log
+  grep "Warning: until then, commits pushed to origin refer to Git LFS objects it doesn't have" push.log
+  refute_server_object "$reponame" "$oida"
+
+  echo "later b" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+
+  git -c lfs.pushlater=true push origin master 2>&1 | tee push.log
+  grep "Queued 1 files to push later" push.log
+  refute_server_object "$reponame" "$oidb"
+
+  git lfs push --flush-queue --dry-run 2>&1 | tee push.log
+  grep "upload $oida => a.dat" push.log
+  grep "upload $oidb => b.dat" push.log
+  refute_server_object "$reponame" "$oida"
+
+  git lfs push --flush-queue 2>&1 | tee push.log
+  assert_server_object "$reponame" "$oida"
+  assert_server_object "$reponame" "$oidb"
+
+  git lfs push --flush-queue 2>&1 | tee push.log
+  grep "No queued objects to push." push.log
+)
+end_test
+
+begin_test "push --flush-queue --background"
+(
+  set -e
+
+  reponame="push-later-background"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "background" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  oid="$(calc_oid "background\n")"
+
+  git lfs push --later origin master
+  git lfs push --flush-queue --background origin 2>&1 | tee push.log
+  grep "Pushing the queued objects in the background" push.log
+
+  for i in $(seq 1 50); do
+    if [ ! -s ".git/lfs/queue/origin" ] && grep -q "Resuming upload" .git/lfs/push-queue.log 2>/dev/null; then
+      break
+    fi
+    sleep 0.2
+  done
+
+  cat .git/lfs/push-queue.log
+  assert_server_object "$reponame" "$oid"
+)
+end_test
+
+begin_test "push --jobs"
+(
+  set -e
+
+  reponame="push-jobs"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "push jobs" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  GIT_TRACE=1 git lfs push -j 5 origin master 2>&1 | tee push.log
+  grep "(1 of 1 files)" push.log
+  grep "Begin() with 5 workers" push.log
+)
+end_test
+
+begin_test "push with GIT_TRACE_PERFORMANCE and --profile"
+(
+  set -e
+
+  reponame="push-performance"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "push performance" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  GIT_TRACE_PERFORMANCE="$TRASHDIR/$reponame/perf.log" GIT_TRACE_BARE=1 \
+    git lfs push --profile="$TRASHDIR/$reponame/push.pprof" origin master 2>&1 | tee push.log
+  grep "(1 of 1 files)" push.log
+
+  cat perf.log
+  grep "^performance: [0-9.]* s:  git-lfs scan$" perf.log
+  grep "^performance: [0-9.]* s:  git-lfs batch: 1 object(s)$" perf.log
+  grep "^performance: [0-9.]* s:  git-lfs transfer: basic adapter$" perf.log
+  [ -s push.pprof ]
+
+  git lfs push --profile="$TRASHDIR/$reponame/push.trace" origin master
+  [ -s push.trace ]
+
+  # the command isn't run if its profile can't be written
+  set +e
+  git lfs push --profile="$TRASHDIR/$reponame/missing/push.pprof" origin master 2>&1 | tee push.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" != "0" ]
+  grep "Could not write the profile" push.log
+  [ "0" -eq "$(grep -c "files)" push.log)" ]
+)
+end_test
+
+begin_test "push in a SHA-256 repository"
+(
+  set -e
+
+  reponame="push-sha256"
+  setup_remote_repo "$reponame" --object-format=sha256
+
+  cd "$TRASHDIR"
+  git init --object-format=sha256 "$reponame"
+  cd "$reponame"
+  git remote add origin "$GITSERVER/$reponame"
+  git config credential.helper lfstest
+  [ "sha256" = "$(git rev-parse --show-object-format)" ]
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  git push origin master 2>&1 | tee push.log
+  grep "Git LFS: (1 of 1 files)" push.log
+  assert_server_object "$reponame" "$(calc_oid "a")"
+
+  printf "b" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+
+  # only the objects which the remote doesn't have are pushed
+  git lfs push --dry-run origin master 2>&1 | tee push.log
+  grep "push $(calc_oid "b") => b.dat" push.log
+  [ "1" -eq "$(grep -c "^push" push.log)" ]
+
+  git -c lfs.scannerbackend=native lfs push --dry-run origin master 2>&1 | tee push.log
+  grep "push $(calc_oid "b") => b.dat" push.log
+  [ "1" -eq "$(grep -c "^push" push.log)" ]
+
+  git push origin master
+  assert_server_object "$reponame" "$(calc_oid "b")"
+  [ "0" -eq "$(git lfs push --dry-run origin master | grep -c "^push")" ]
+)
+end_test
+
+begin_test "push from a partial clone"
+(
+  set -e
+
+  reponame="push-partial-clone"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  printf "a" > a.txt
+  git add .gitattributes a.dat a.txt
+  git commit -m "add a.dat"
+  printf "b" > a.dat
+  printf "b" > a.txt
+  git add a.dat a.txt
+  git commit -m "change a.dat"
+  git push origin master
+
+  git -C "$REMOTEDIR/$reponame.git" config uploadpack.allowFilter true
+
+  cd "$TRASHDIR"
+  GIT_LFS_SKIP_SMUDGE=1 git clone --filter=blob:none "file://$REMOTEDIR/$reponame.git" "$reponame-partial"
+  cd "$reponame-partial"
+  git remote set-url origin "$GITSERVER/$reponame"
+  git config credential.helper lfstest
+  git update-ref -d refs/remotes/origin/master
+
+  missing="$(git rev-list --objects --missing=print --all | grep -c "^?")"
+  [ "$missing" -gt 0 ]
+
+  # the objects missing from the clone are skipped, rather than fetched
+  git lfs push --dry-run --all origin 2>&1 | tee push.log
+  grep "$missing object(s) missing from this partial clone" push.log
+  grep "push $(calc_oid "b") => a.dat" push.log
+  [ "1" -eq "$(grep -c "^push" push.log)" ]
+
+  printf "c" > c.dat
+  git add c.dat
+  git commit -m "add c.dat"
+
+  git lfs push origin master 2>&1 | tee push.log
+  grep "missing from this partial clone" push.log
+  assert_server_object "$reponame" "$(calc_oid "c")"
+  [ "$missing" -eq "$(git rev-list --objects --missing=print --all | grep -c "^?")" ]
+)
+end_test
+
+begin_test "push from a shallow clone"
+(
+  set -e
+
+  reponame="push-shallow-clone"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  printf "b" > a.dat
+  git add a.dat
+  git commit -m "change a.dat"
+  git push origin master
+
+  cd "$TRASHDIR"
+  GIT_LFS_SKIP_SMUDGE=1 git clone --depth=1 "file://$REMOTEDIR/$reponame.git" "$reponame-shallow"
+  cd "$reponame-shallow"
+  git remote set-url origin "$GITSERVER/$reponame"
+  git config credential.helper lfstest
+  git update-ref -d refs/remotes/origin/master
+  [ "true" = "$(git rev-parse --is-shallow-repository)" ]
+
+  printf "c" > c.dat
+  git add c.dat
+  git commit -m "add c.dat"
+
+  # history stops at the shallow commit, whose object the remote has
+  # already, with a warning that what came before it wasn't scanned
+  git lfs push --dry-run origin master 2>&1 | tee push.log
+  grep "push $(calc_oid "c") => c.dat" push.log
+  [ "0" -eq "$(grep -c "push $(calc_oid "a")" push.log)" ]
+  grep "Warning: the history before 1 shallow commit(s) is missing from this shallow clone" push.log
+
+  git lfs push origin master 2>&1 | tee push.log
+  grep "missing from this shallow clone" push.log
+  assert_server_object "$reponame" "$(calc_oid "c")"
+
+  # there's no warning when the history scanned stops before the shallow
+  # commit
+  git update-ref refs/remotes/origin/master HEAD~1
+  git lfs push --dry-run origin master 2>&1 | tee push.log
+  grep "push $(calc_oid "c") => c.dat" push.log
+  [ "0" -eq "$(grep -c "shallow" push.log)" ]
+)
+end_test
@@ -0,0 +1,155 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "renormalize: files staged as their contents"
+(
+  set -e
+
+  reponame="renormalize-contents"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "kept" > b.txt
+  git add .gitattributes b.txt
+  git commit -m "track *.dat"
+
+  # staged without the clean filter, as without Git LFS installed
+  contents="staged before tracking"
+  oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git update-index --add --cacheinfo 100644,"$(git hash-object -w --no-filters a.dat)",a.dat
+
+  git lfs status 2>&1 | tee status.log
+  grep "Git LFS files which need fixing:" status.log
+  grep "a.dat is tracked by Git LFS, but is staged as its contents" status.log
+  grep "git add --renormalize a.dat" status.log
+  [ "0" -eq "$(grep -c "b.txt" status.log)" ]
+
+  git commit -m "add a.dat"
+
+  git lfs checkout 2>&1 | tee checkout.log
+  grep "Warning: a.dat is tracked by Git LFS" checkout.log
+
+  git push origin master 2>&1 | tee push.log
+  grep "Warning: a.dat is tracked by Git LFS, but is committed as its contents in refs/heads/master" push.log
+
+  # files in the commits the remote already has aren't looked at again
+  printf "more" > c.txt
+  git add c.txt
+  git commit -m "add c.txt"
+  git push origin master 2>&1 | tee push.log
+  [ "0" -eq "$(grep -c "a.dat" push.log)" ]
+
+  git lfs renormalize --dry-run 2>&1 | tee renormalize.log
+  grep "Renormalizing a.dat" renormalize.log
+  [ "$contents" = "$(git cat-file -p :a.dat)" ]
+
+  git lfs renormalize 2>&1 | tee renormalize.log
+  grep "Renormalizing a.dat" renormalize.log
+  git cat-file -p :a.dat | grep "oid sha256:$oid"
+  [ "kept" = "$(git cat-file -p :b.txt)" ]
+  assert_local_object "$oid" 22
+
+  git lfs status 2>&1 | tee status.log
+  [ "0" -eq "$(grep -c "need fixing" status.log)" ]
+)
+end_test
+
+begin_test "renormalize: pointer files in the working tree"
+(
+  set -e
+
+  reponame="renormalize-pointers"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  contents="not checked out"
+  oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-clone"
+  git lfs fetch
+
+  # status only looks at changed files
+  git lfs status 2>&1 | tee status.log
+  [ "0" -eq "$(grep -c "need fixing" status.log)" ]
+
+  git lfs renormalize --dry-run 2>&1 | tee renormalize.log
+  grep "Checking out a.dat" renormalize.log
+  [ "$contents" != "$(cat a.dat)" ]
+
+  git lfs renormalize 2>&1 | tee renormalize.log
+  grep "Checking out a.dat" renormalize.log
+  [ "$contents" = "$(cat a.dat)" ]
+
+  git lfs status 2>&1 | tee status.log
+  [ "0" -eq "$(grep -c "need fixing" status.log)" ]
+)
+end_test
+
+begin_test "renormalize: pointers which aren't tracked"
+(
+  set -e
+
+  reponame="renormalize-untracked"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "untracked pointer" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  git lfs untrack "*.dat"
+  git add .gitattributes
+  git commit -m "untrack *.dat"
+
+  git lfs checkout 2>&1 | tee checkout.log
+  grep "Warning: a.dat is a Git LFS pointer, but isn't tracked by Git LFS" checkout.log
+
+  git lfs renormalize 2>&1 | tee renormalize.log
+  grep "Warning: a.dat is a Git LFS pointer, but isn't tracked by Git LFS" renormalize.log
+)
+end_test
+
+begin_test "renormalize: pointers tracked by the global attributes file"
+(
+  set -e
+
+  reponame="renormalize-global-attributes"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.bin"
+  printf "global pointer" > a.bin
+  git add .gitattributes a.bin
+  git commit -m "add a.bin"
+
+  git lfs untrack "*.bin"
+  git add .gitattributes
+  git commit -m "untrack *.bin"
+
+  printf "*.bin filter=lfs diff=lfs merge=lfs -text\n" > ../attributes
+  git config core.attributesFile "$(cd .. && pwd)/attributes"
+  git lfs renormalize --dry-run 2>&1 | tee renormalize.log
+  [ "0" -eq "$(grep -c "isn't tracked by Git LFS" renormalize.log)" ]
+
+  git config --unset core.attributesFile
+  mkdir -p ../xdg/git
+  mv ../attributes ../xdg/git/attributes
+  XDG_CONFIG_HOME="$(cd .. && pwd)/xdg" git lfs renormalize --dry-run 2>&1 | tee renormalize.log
+  [ "0" -eq "$(grep -c "isn't tracked by Git LFS" renormalize.log)" ]
+
+  # .gitattributes overrides the global attributes file
+  printf "*.bin -filter\n" > .gitattributes
+  XDG_CONFIG_HOME="$(cd .. && pwd)/xdg" git lfs renormalize --dry-run 2>&1 | tee renormalize.log
+  grep "a.bin is a Git LFS pointer, but isn't tracked by Git LFS" renormalize.log
+)
+end_test
@@ -34,11 +34,15 @@ begin_test "resume-http-range"
   git lfs fetch 2>&1 | tee fetchinterrupted.log
   refute_local_object "$contents_oid"
 
+  # the ETag of the interrupted download is kept to resume it with If-Range
+  grep '"v1"' ".git/lfs/objects/incomplete/$contents_oid.validator"
+
   # now fetch again, this should try to resume and server should send remainder
   # this time (it does not cut short when Range is requested)
   GIT_TRACE=1 git lfs fetch 2>&1 | tee fetchresume.log
   grep "xfer: server accepted resume" fetchresume.log
   assert_local_object "$contents_oid" "${#contents}"
+  [ ! -e ".git/lfs/objects/incomplete/$contents_oid.validator" ]
 
 )
 end_test
@@ -85,3 +89,41 @@ begin_test "resume-http-range-fallback"
 )
 end_test
 
+
+begin_test "resume-http-range-changed"
+(
+  set -e
+
+  reponame="resume-http-range-changed"
+  setup_remote_repo "$reponame"
+
+  clone_repo "$reponame" $reponame
+
+  git lfs track "*.dat" 2>&1 | tee track.log
+  grep "Tracking \*.dat" track.log
+
+  # this string announces to server that we want it to abort the download part
+  # way, then give the object a new ETag so that it can't be resumed
+  contents="status-batch-resume-changed"
+  contents_oid=$(calc_oid "$contents")
+
+  printf "$contents" > a.dat
+  git add a.dat
+  git add .gitattributes
+  git commit -m "add a.dat" 2>&1 | tee commit.log
+  git push origin master
+
+  assert_server_object "$reponame" "$contents_oid"
+
+  rm -rf .git/lfs/objects
+  git lfs fetch 2>&1 | tee fetchinterrupted.log
+  refute_local_object "$contents_oid"
+
+  # the server should ignore the Range header as If-Range doesn't match, and
+  # the client should use the whole object it sends instead
+  GIT_TRACE=1 git lfs fetch 2>&1 | tee fetchresumechanged.log
+  grep "xfer: failed to resume download" fetchresumechanged.log
+  grep "expected status code 206, received 200" fetchresumechanged.log
+  assert_local_object "$contents_oid" "${#contents}"
+)
+end_test
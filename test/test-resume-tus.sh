@@ -25,6 +25,8 @@ begin_test "tus-upload-uninterrupted"
   git commit -m "add a.dat" 2>&1 | tee commit.log
   GIT_TRACE=1 git push origin master 2>&1 | tee pushtus.log
   grep "xfer: tus.io uploading" pushtus.log
+  # the server supports sha1 and sha256 checksums, sha256 is preferred
+  grep "xfer: tus.io uploading \"$contents_oid\" with sha256 checksum" pushtus.log
 
   assert_server_object "$reponame" "$contents_oid"
 
@@ -68,3 +70,35 @@ begin_test "tus-upload-interrupted-resume"
 
 )
 end_test
+
+begin_test "tus-upload-checksum-mismatch"
+(
+  set -e
+
+  # this repo name is the indicator to the server to use tus, AND to corrupt
+  # the first upload of each object so that it fails its checksum
+  reponame="test-tus-upload-checksum-mismatch"
+  setup_remote_repo "$reponame"
+
+  clone_repo "$reponame" $reponame
+  git config lfs.tustransfers true
+
+  git lfs track "*.dat" 2>&1 | tee track.log
+  grep "Tracking \*.dat" track.log
+
+  contents="corrupted in transit the first time it is uploaded"
+  contents_oid=$(calc_oid "$contents")
+
+  printf "$contents" > a.dat
+  git add a.dat
+  git add .gitattributes
+  git commit -m "add a.dat" 2>&1 | tee commit.log
+  GIT_TRACE=1 git push origin master 2>&1 | tee pushtus_checksum.log
+  grep "xfer: tus.io uploading \"$contents_oid\" with sha256 checksum" pushtus_checksum.log
+  grep "HTTP: 460" pushtus_checksum.log
+  # the upload is retried, and succeeds the second time
+  grep "HTTP: 204" pushtus_checksum.log
+
+  assert_server_object "$reponame" "$contents_oid"
+)
+end_test
@@ -0,0 +1,142 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "resume: uploads objects from a failed push"
+(
+  set -e
+
+  reponame="resume-upload"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  printf "b" > b.dat
+  git add .gitattributes a.dat b.dat
+  git commit -m "add files"
+
+  contents_a_oid="$(calc_oid "a")"
+  contents_b_oid="$(calc_oid "b")"
+
+  git config lfs.url "http://127.0.0.1:1/broken"
+  set +e
+  git lfs push origin master 2>&1 | tee push.log
+  res=${PIPESTATUS[0]}
+  set -e
+  # the server couldn't be reached
+  [ "$res" = "5" ]
+  [ -f .git/lfs/journal/upload ]
+  git config --unset lfs.url
+
+  git lfs resume --dry-run 2>&1 | tee resume.log
+  grep "upload $contents_a_oid => a.dat" resume.log
+  grep "upload $contents_b_oid => b.dat" resume.log
+  refute_server_object "$reponame" "$contents_a_oid"
+
+  git lfs resume 2>&1 | tee resume.log
+  grep "Resuming upload of 2 object(s) with origin" resume.log
+  assert_server_object "$reponame" "$contents_a_oid"
+  assert_server_object "$reponame" "$contents_b_oid"
+  [ ! -f .git/lfs/journal/upload ]
+
+  git lfs resume 2>&1 | tee resume.log
+  grep "Nothing to resume." resume.log
+)
+end_test
+
+begin_test "resume: downloads objects from a failed fetch"
+(
+  set -e
+
+  reponame="resume-download"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "c" > c.dat
+  git add .gitattributes c.dat
+  git commit -m "add c.dat"
+  git push origin master
+
+  contents_oid="$(calc_oid "c")"
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-clone"
+  refute_local_object "$contents_oid"
+
+  git config lfs.url "http://127.0.0.1:1/broken"
+  set +e
+  git lfs fetch origin master 2>&1 | tee fetch.log
+  set -e
+  git config --unset lfs.url
+  refute_local_object "$contents_oid"
+
+  git lfs resume 2>&1 | tee resume.log
+  grep "Resuming download of 1 object(s) with origin" resume.log
+  assert_local_object "$contents_oid" 1
+  [ ! -f .git/lfs/journal/download ]
+)
+end_test
+
+begin_test "resume: successful push leaves no journal"
+(
+  set -e
+
+  reponame="resume-clean"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "d" > d.dat
+  git add .gitattributes d.dat
+  git commit -m "add d.dat"
+  git push origin master
+
+  [ ! -f .git/lfs/journal/upload ]
+  [ "Nothing to resume." = "$(git lfs resume)" ]
+)
+end_test
+
+begin_test "resume: keeps objects from earlier failed pushes"
+(
+  set -e
+
+  reponame="resume-earlier"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  git add .gitattributes
+  git commit -m "track *.dat"
+  git push origin master
+
+  git checkout -b first
+  printf "e" > e.dat
+  git add e.dat
+  git commit -m "add e.dat"
+
+  git checkout -b second master
+  printf "f" > f.dat
+  git add f.dat
+  git commit -m "add f.dat"
+
+  contents_e_oid="$(calc_oid "e")"
+  contents_f_oid="$(calc_oid "f")"
+
+  git config lfs.url "http://127.0.0.1:1/broken"
+  git lfs push origin first > push.log 2>&1 && exit 1
+  git lfs push origin second > push.log 2>&1 && exit 1
+  git config --unset lfs.url
+
+  git lfs resume --dry-run 2>&1 | tee resume.log
+  grep "upload $contents_e_oid => e.dat" resume.log
+  grep "upload $contents_f_oid => f.dat" resume.log
+
+  git lfs resume 2>&1 | tee resume.log
+  grep "Resuming upload of 2 object(s) with origin" resume.log
+  assert_server_object "$reponame" "$contents_e_oid"
+  assert_server_object "$reponame" "$contents_f_oid"
+  [ ! -f .git/lfs/journal/upload ]
+)
+end_test
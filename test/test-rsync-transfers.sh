@@ -0,0 +1,106 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+if ! command -v rsync > /dev/null 2>&1; then
+  echo "skip: rsync is not installed"
+  exit 0
+fi
+
+# fake_ssh writes an ssh replacement which runs the command it's given locally,
+# as though on the host, logging it to $TRASHDIR/ssh.log, and points Git LFS at
+# it.
+fake_ssh() {
+  cat > "$TRASHDIR/fake-ssh" <<'SSH'
+#!/usr/bin/env bash
+while [ $# -gt 0 ]; do
+  case "$1" in
+    -p|-l) shift 2 ;;
+    -*) shift ;;
+    *) shift; break ;;
+  esac
+done
+echo "$*" >> "$TRASHDIR/ssh.log"
+exec sh -c "$*"
+SSH
+  chmod +x "$TRASHDIR/fake-ssh"
+  export TRASHDIR
+  git config core.sshcommand "$TRASHDIR/fake-ssh"
+  git config lfs.ssh.automultiplex false
+}
+
+begin_test "rsync transfers: push and fetch objects stored on an SSH host"
+(
+  set -e
+
+  reponame="rsync-transfers"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+  fake_ssh
+
+  storage="$TRASHDIR/rsync-storage"
+  git config -f .lfsconfig lfs.url "rsync+ssh://lfs@example.com:2222$storage"
+
+  git lfs track "*.dat"
+  contents="rsync"
+  oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git add .lfsconfig .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  grep "tq: transferring batch of size 1 with rsync" push.log
+  [ "0" = "$(grep -c "api: batch" push.log)" ]
+  [ "$contents" = "$(cat "$storage/${oid:0:2}/${oid:2:2}/$oid")" ]
+  refute_server_object "$reponame" "$oid"
+
+  # objects the host has already aren't sent again
+  GIT_TRACE=1 git lfs push --object-id origin "$oid" 2>&1 | tee push.log
+  grep -- "--ignore-existing" push.log
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-fetch"
+  fake_ssh
+
+  git lfs pull 2>&1 | tee pull.log
+  assert_local_object "$oid" 5
+  [ "$contents" = "$(cat a.dat)" ]
+  grep "rsync --server" "$TRASHDIR/ssh.log"
+)
+end_test
+
+begin_test "rsync transfers: objects missing from the SSH host"
+(
+  set -e
+
+  reponame="rsync-transfers-missing"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+  fake_ssh
+
+  storage="$TRASHDIR/rsync-storage-missing"
+  git config -f .lfsconfig lfs.url "rsync+ssh://lfs@example.com$storage"
+
+  git lfs track "*.dat"
+  contents="missing"
+  oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git add .lfsconfig .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  rm "$storage/${oid:0:2}/${oid:2:2}/$oid"
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-fetch"
+  fake_ssh
+
+  set +e
+  git lfs fetch 2>&1 | tee fetch.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" != "0" ]
+  grep "Object does not exist on the server" fetch.log
+  refute_local_object "$oid"
+)
+end_test
@@ -28,6 +28,43 @@ begin_test "smudge"
 )
 end_test
 
+begin_test "smudge with object modified through a hard link"
+(
+  set -e
+
+  reponame="smudge-hardlink-modified"
+  git init "$reponame"
+  cd "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  oid="$(calc_oid "a")"
+  object=".git/lfs/objects/${oid:0:2}/${oid:2:2}/$oid"
+  ls -l "$object" | grep "^-r--r--r--"
+
+  rm a.dat
+  git config lfs.checkoutmode hardlink
+  git lfs checkout
+
+  chmod u+w a.dat
+  printf "b" > a.dat
+
+  set +e
+  pointer "$oid" 1 | git lfs smudge b.dat > smudge.log 2>&1
+  res=$?
+  set -e
+
+  cat smudge.log
+  [ "0" != "$res" ]
+  git lfs logs last | grep "Object $oid was modified through a hard link to it"
+  [ -f ".git/lfs/bad/$oid" ]
+  [ ! -f "$object" ]
+)
+end_test
+
 begin_test "smudge with temp file"
 (
   set -e
@@ -221,5 +258,41 @@ begin_test "smudge skip download failure"
 
   echo "$pointer" | GIT_LFS_SKIP_DOWNLOAD_ERRORS=1 git lfs smudge a.dat
 
+  # lfs.missingobjectpolicy takes precedence
+  set +e
+  echo "$pointer" | GIT_LFS_SKIP_DOWNLOAD_ERRORS=1 git -c lfs.missingobjectpolicy=fail lfs smudge a.dat; test ${PIPESTATUS[1]} -ne 0
+  set -e
+
+  [ "$pointer" = "$(echo "$pointer" | git -c lfs.missingobjectpolicy=placeholder lfs smudge a.dat)" ]
+)
+end_test
+
+begin_test "smudge while offline"
+(
+  set -e
+
+  reponame="smudge-offline"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  echo "smudge offline" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  oid="$(calc_oid "smudge offline\n")"
+  ptr="$(pointer "$oid" 15)"
+
+  # a local object is still smudged
+  [ "smudge offline" = "$(echo "$ptr" | git -c lfs.offline=true lfs smudge)" ]
+
+  # a missing one is left as a pointer, without trying to download it
+  rm -rf .git/lfs/objects
+  GIT_TRACE=1 git -c lfs.offline=true lfs smudge < <(echo "$ptr") > smudge.out 2> smudge.log
+  cat smudge.log
+  [ "$ptr" = "$(cat smudge.out)" ]
+  [ "0" -eq "$(grep -c "Downloading" smudge.log)" ]
+  refute_local_object "$oid"
 )
 end_test
@@ -132,3 +132,143 @@ begin_test "status shows multiple files with identical contents"
   [ "1" -eq "$(grep -c "b.dat" status.log)" ]
 )
 end_test
+
+begin_test "status --check-server"
+(
+  set -e
+
+  reponame="status-check-server"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  printf "b" > b.dat
+  git add b.dat
+  git commit -m "add b.dat"
+
+  printf "a" > c.dat
+  printf "d" > d.dat
+  git add c.dat d.dat
+
+  git lfs status --check-server 2>&1 | tee status.log
+  grep "b.dat (1 B, to upload)" status.log
+  grep "c.dat (1 B, on the server)" status.log
+  grep "d.dat (1 B, to upload)" status.log
+  grep "2 files to upload (2 B), 1 files already on the server (1 B)" status.log
+
+  # without --check-server, the server isn't asked
+  GIT_TRACE=1 git lfs status 2>&1 | tee status.log
+  grep "c.dat (1 B)" status.log
+  [ "0" -eq "$(grep -c "api: batch" status.log)" ]
+
+  git lfs status --check-server --porcelain 2>&1 | tee status.log
+  grep "\-\-check-server can't be used with \-\-porcelain" status.log
+)
+end_test
+
+begin_test "status with core.fsmonitor"
+(
+  set -e
+
+  reponame="status-fsmonitor"
+  git init "$reponame"
+  cd "$reponame"
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  # a hook which says the files listed in .git/fsmonitor-changes changed
+  cat > .git/fsmonitor-hook <<-\EOH
+	#!/bin/sh
+	printf "token-%s\0" "$(date +%s%N)"
+	tr "\n" "\0" < .git/fsmonitor-changes
+	EOH
+  chmod +x .git/fsmonitor-hook
+  printf "/\n" > .git/fsmonitor-changes
+  git config core.fsmonitor .git/fsmonitor-hook
+
+  GIT_TRACE=1 git lfs status 2>&1 | tee status.log
+  grep "fsmonitor: every file may have changed" status.log
+  [ "0" -eq "$(grep -c "fsmonitor: .gitattributes files unchanged" status.log)" ]
+
+  : > .git/fsmonitor-changes
+  GIT_TRACE=1 git lfs status 2>&1 | tee status.log
+  grep "fsmonitor: 0 path(s) changed" status.log
+  grep "fsmonitor: .gitattributes files unchanged" status.log
+
+  # files which the hook doesn't say changed aren't read again, when every
+  # file is looked at
+  git lfs renormalize --dry-run 2>&1 | tee renormalize.log
+  [ "0" -eq "$(grep -c "a.dat" renormalize.log)" ]
+  git cat-file blob :a.dat > a.dat
+  git lfs renormalize --dry-run 2>&1 | tee renormalize.log
+  [ "0" -eq "$(grep -c "a.dat" renormalize.log)" ]
+
+  printf "a.dat\n" > .git/fsmonitor-changes
+  git lfs renormalize --dry-run 2>&1 | tee renormalize.log
+  grep "Checking out a.dat" renormalize.log
+
+  mkdir dir
+  printf "*.bin filter=lfs diff=lfs merge=lfs -text\n" > dir/.gitattributes
+  printf "dir/.gitattributes\n" > .git/fsmonitor-changes
+  GIT_TRACE=1 git lfs status 2>&1 | tee status.log
+  [ "0" -eq "$(grep -c "fsmonitor: .gitattributes files unchanged" status.log)" ]
+  grep "dir/.gitattributes" .git/lfs/fsmonitor
+
+  git config core.fsmonitor true
+  GIT_TRACE=1 git lfs status 2>&1 | tee status.log
+  grep "fsmonitor: built-in daemon not supported" status.log
+)
+end_test
+
+begin_test "status with lfs.worktreechecksums"
+(
+  set -e
+
+  reponame="status-worktree-checksums"
+  git init "$reponame"
+  cd "$reponame"
+
+  git config lfs.worktreechecksums true
+  git lfs track "*.dat"
+  printf "unchanged" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  # files written by checkouts are recorded
+  oid="$(calc_oid "unchanged")"
+  rm a.dat
+  git lfs checkout a.dat
+  [ "unchanged" = "$(cat a.dat)" ]
+  grep "^$oid 9 [0-9]* [0-9]* a.dat$" .git/lfs/checksums
+
+  # record the file as it is now, with a modification time older than the
+  # record, as it would be once a checked out file is no longer racy
+  TZ=UTC touch -t 200001010000 a.dat
+  printf "%s 9 946684800000000000 %s000000000 a.dat\n" "$oid" "$(date +%s)" >> .git/lfs/checksums
+
+  # reading the tree again leaves the index without stat info, so that Git
+  # reports a.dat as modified without hashing it
+  git read-tree HEAD
+  git diff-index HEAD | grep "M	a.dat"
+
+  git lfs status | tee status.log
+  [ "0" -eq "$(grep -c "	a.dat" status.log)" ]
+  [ "" = "$(git lfs status --porcelain)" ]
+
+  git -c lfs.worktreechecksums=false lfs status | tee status.log
+  grep "	a.dat" status.log
+
+  # a file modified since it was recorded is listed
+  printf "different" > a.dat
+  git lfs status | tee status.log
+  grep "	a.dat" status.log
+)
+end_test
@@ -0,0 +1,159 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "storage compression: objects are stored uncompressed without zstd"
+(
+  set -e
+
+  reponame="storage-compression-no-zstd"
+  git init "$reponame"
+  cd "$reponame"
+
+  git config lfs.storagecompression zstd
+  git lfs track "*.txt"
+
+  for i in $(seq 1 2000); do echo "line $i of a compressible file"; done > a.txt
+  for i in $(seq 1 2000); do echo "line $i of another compressible file"; done > b.txt
+
+  # the PATH without the directories zstd is in
+  nozstd="$(echo "$PATH" | tr ":" "\n" | while read -r dir; do
+    [ -x "$dir/zstd" ] || printf "%s:" "$dir"
+  done)"
+  PATH="$nozstd" git add .gitattributes a.txt b.txt 2>&1 | tee add.log
+  [ "1" -eq "$(grep -c "the zstd program wasn't found" add.log)" ]
+  grep "storing objects uncompressed" add.log
+
+  a_oid="$(calc_oid_file a.txt)"
+  assert_local_object "$a_oid" "$(wc -c < a.txt | tr -d " ")"
+  [ ! -d .git/lfs/compressed ] || [ -z "$(find .git/lfs/compressed -type f)" ]
+)
+end_test
+
+if ! command -v zstd > /dev/null 2>&1; then
+  echo "skip: zstd is not installed"
+  exit 0
+fi
+
+# object_path prints the path of the object with the given oid in the object
+# store, and compressed_path that of its compressed copy.
+object_path() {
+  echo ".git/lfs/objects/${1:0:2}/${1:2:2}/$1"
+}
+
+compressed_path() {
+  echo ".git/lfs/compressed/${1:0:2}/${1:2:2}/$1.zst"
+}
+
+begin_test "storage compression: objects are stored compressed"
+(
+  set -e
+
+  reponame="storage-compression-local"
+  git init "$reponame"
+  cd "$reponame"
+
+  git config lfs.storagecompression zstd
+  git lfs track "*.txt" "*.bin"
+
+  for i in $(seq 1 2000); do echo "line $i of a compressible file"; done > a.txt
+  head -c 102400 /dev/urandom > random.bin
+  cp a.txt "$TRASHDIR/a.txt.orig"
+
+  a_oid="$(calc_oid_file a.txt)"
+  random_oid="$(calc_oid_file random.bin)"
+
+  git add .gitattributes random.bin
+  git add a.txt
+  git commit -m "add files"
+
+  [ ! -e "$(object_path "$a_oid")" ]
+  [ -f "$(compressed_path "$a_oid")" ]
+  [ "$(wc -c < "$(compressed_path "$a_oid")")" -lt "$(wc -c < a.txt)" ]
+
+  # random data doesn't get any smaller
+  [ -f "$(object_path "$random_oid")" ]
+  [ ! -e "$(compressed_path "$random_oid")" ]
+
+  rm a.txt
+  git checkout -- a.txt
+  cmp a.txt "$TRASHDIR/a.txt.orig"
+
+  git lfs fsck | tee fsck.log
+  grep "Git LFS fsck OK" fsck.log
+)
+end_test
+
+begin_test "storage compression: excluded extensions are stored whole"
+(
+  set -e
+
+  reponame="storage-compression-exclude"
+  git init "$reponame"
+  cd "$reponame"
+
+  git config lfs.storagecompression zstd
+  git lfs track "*.zip" "*.dat"
+
+  for i in $(seq 1 2000); do echo "line $i of a compressible file"; done > a.zip
+  for i in $(seq 1 2000); do echo "line $i of another compressible file"; done > b.dat
+  a_oid="$(calc_oid_file a.zip)"
+  b_oid="$(calc_oid_file b.dat)"
+
+  git add .gitattributes a.zip
+  [ -f "$(object_path "$a_oid")" ]
+  [ ! -e "$(compressed_path "$a_oid")" ]
+
+  git config lfs.storagecompression.exclude "dat"
+  git add b.dat
+  [ -f "$(object_path "$b_oid")" ]
+  [ ! -e "$(compressed_path "$b_oid")" ]
+)
+end_test
+
+begin_test "storage compression: push, pull and prune"
+(
+  set -e
+
+  reponame="storage-compression-transfer"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.storagecompression zstd
+  git config lfs.fetchrecentrefsdays 0
+  git config lfs.fetchrecentcommitsdays 0
+  git lfs track "*.txt"
+
+  for i in $(seq 1 2000); do echo "line $i of the first version"; done > a.txt
+  old_oid="$(calc_oid_file a.txt)"
+  git add .gitattributes a.txt
+  git commit -m "add a.txt"
+
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  grep "xfer: decompressing \"$old_oid\" to upload it" push.log
+  assert_server_object "$reponame" "$old_oid"
+  [ ! -e "$(object_path "$old_oid")" ]
+  [ -f "$(compressed_path "$old_oid")" ]
+
+  for i in $(seq 1 2000); do echo "line $i of the second version"; done > a.txt
+  new_oid="$(calc_oid_file a.txt)"
+  git add a.txt
+  git commit -m "update a.txt"
+  git push origin master
+
+  git lfs prune --verify-remote 2>&1 | tee prune.log
+  grep "Pruning 1 files" prune.log
+  [ ! -e "$(compressed_path "$old_oid")" ]
+  [ -f "$(compressed_path "$new_oid")" ]
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 git clone "$GITSERVER/$reponame" "$reponame-clone"
+  cd "$reponame-clone"
+  git config lfs.storagecompression zstd
+
+  git lfs pull
+  [ "$new_oid" = "$(calc_oid_file a.txt)" ]
+  [ ! -e "$(object_path "$new_oid")" ]
+  [ -f "$(compressed_path "$new_oid")" ]
+)
+end_test
@@ -0,0 +1,95 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "storage routes: push and fetch routed objects"
+(
+  set -e
+
+  reponame="storage-routes"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config -f .lfsconfig lfs.storage.cold.pattern "*.mp4"
+  git config -f .lfsconfig lfs.storage.cold.url "$GITSERVER/storage-class-cold.git/info/lfs"
+  git config -f .lfsconfig lfs.storage.cold.class cold
+
+  git lfs track "*.dat" "*.mp4"
+  contents_dat="dat"
+  oid_dat="$(calc_oid "$contents_dat")"
+  contents_mp4="mp4"
+  oid_mp4="$(calc_oid "$contents_mp4")"
+  printf "$contents_dat" > a.dat
+  printf "$contents_mp4" > a.mp4
+  git add .lfsconfig .gitattributes a.dat a.mp4
+  git commit -m "add a.dat and a.mp4"
+
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  grep "api: batch 1 files for storage route cold" push.log
+  assert_server_object "$reponame" "$oid_dat"
+  refute_server_object "$reponame" "$oid_mp4"
+  assert_server_object "storage-class-cold" "$oid_mp4"
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-fetch"
+
+  git lfs fetch 2>&1 | tee fetch.log
+  assert_local_object "$oid_dat" 3
+  assert_local_object "$oid_mp4" 3
+)
+end_test
+
+begin_test "storage routes: route by size"
+(
+  set -e
+
+  reponame="storage-routes-size"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.storage.cold.minsize 1k
+  git config lfs.storage.cold.url "$GITSERVER/storage-class-cold.git/info/lfs"
+  git config lfs.storage.cold.class cold
+
+  git lfs track "*.dat"
+  contents_small="small"
+  oid_small="$(calc_oid "$contents_small")"
+  contents_large="$(printf "%01024d" 1)"
+  oid_large="$(calc_oid "$contents_large")"
+  printf "$contents_small" > small.dat
+  printf "$contents_large" > large.dat
+  git add .gitattributes small.dat large.dat
+  git commit -m "add small.dat and large.dat"
+
+  git push origin master 2>&1 | tee push.log
+  assert_server_object "$reponame" "$oid_small"
+  refute_server_object "$reponame" "$oid_large"
+  assert_server_object "storage-class-cold" "$oid_large"
+)
+end_test
+
+begin_test "storage routes: server requires storage class"
+(
+  set -e
+
+  reponame="storage-routes-class"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config lfs.storage.cold.pattern "*.mp4"
+  git config lfs.storage.cold.url "$GITSERVER/storage-class-cold.git/info/lfs"
+
+  git lfs track "*.mp4"
+  printf "no class" > a.mp4
+  git add .gitattributes a.mp4
+  git commit -m "add a.mp4"
+
+  set +e
+  git push origin master 2>&1 | tee push.log
+  res="${PIPESTATUS[0]}"
+  set -e
+
+  [ "0" -ne "$res" ]
+  refute_server_object "storage-class-cold" "$(calc_oid "no class")"
+)
+end_test
@@ -292,3 +292,203 @@ begin_test "track blocklisted files with glob"
   grep "Pattern .git\* matches forbidden file" track.log
 )
 end_test
+
+begin_test "track --macros"
+(
+  set -e
+
+  repo="track_macros"
+  mkdir "$repo"
+  cd "$repo"
+  git init
+
+  git lfs track "*.jpg"
+  mkdir a
+  echo "*.gif filter=lfs diff=lfs merge=lfs -text lockable" > a/.gitattributes
+  echo "*.txt text" >> a/.gitattributes
+
+  git lfs track --macros 2>&1 | tee track.log
+  grep "Defining attribute macro lfs" track.log
+  grep "Using attribute macro lfs for \*.jpg (.gitattributes)" track.log
+  grep "Using attribute macro lfs-lockable for \*.gif ($(native_path_escaped "a/.gitattributes"))" track.log
+
+  [ "[attr]lfs filter=lfs diff=lfs merge=lfs -text" = "$(head -n 1 .gitattributes)" ]
+  grep "^\[attr\]lfs-lockable lfs lockable$" .gitattributes
+  grep "^\*.jpg lfs$" .gitattributes
+  grep "^\*.gif lfs-lockable$" a/.gitattributes
+  grep "^\*.txt text$" a/.gitattributes
+
+  # new patterns use the macros
+  git lfs track "*.png"
+  git lfs track --lockable "*.psd"
+  grep "^\*.png lfs$" .gitattributes
+  grep "^\*.psd lfs-lockable$" .gitattributes
+
+  [ "filter: lfs" = "$(git check-attr filter -- a.psd | cut -d ' ' -f 2-)" ]
+  [ "lockable: set" = "$(git check-attr lockable -- a.psd | cut -d ' ' -f 2-)" ]
+
+  out=$(git lfs track)
+  echo "$out" | grep "*.png (.gitattributes)"
+  echo "$out" | grep "*.gif ($(native_path_escaped "a/.gitattributes"))"
+  [ "0" -eq "$(echo "$out" | grep -c "\[attr\]")" ]
+
+  git lfs untrack "*.png"
+  [ "0" -eq "$(grep -c "png" .gitattributes)" ]
+  grep "^\[attr\]lfs " .gitattributes
+
+  # running it again changes nothing
+  cp .gitattributes before
+  git lfs track --macros 2>&1 | tee track.log
+  [ "0" -eq "$(grep -c "macro" track.log)" ]
+  diff -u before .gitattributes
+)
+end_test
+
+begin_test "track warns about overlapping patterns"
+(
+  set -e
+
+  repo="track_overlapping_patterns"
+  mkdir "$repo"
+  cd "$repo"
+  git init
+
+  git lfs track "*.dat"
+  git lfs track "data/*.dat" 2>&1 | tee track.log
+  grep "Pattern data/\*.dat is already matched by \*.dat (.gitattributes)" track.log
+  grep "Tracking data/\*.dat" track.log
+
+  git lfs track "*.DAT" 2>&1 | tee track.log
+  grep "Pattern \*.DAT differs only in case from \*.dat (.gitattributes)" track.log
+
+  mkdir sub
+  echo "*.bin -filter" > sub/.gitattributes
+  git lfs track "sub/*.bin" 2>&1 | tee track.log
+  grep "Pattern sub/\*.bin is overridden by \*.bin (sub/.gitattributes:1)" track.log
+)
+end_test
+
+begin_test "track refuses unsupported patterns"
+(
+  set -e
+
+  repo="track_unsupported_patterns"
+  mkdir "$repo"
+  cd "$repo"
+  git init
+
+  git lfs track "!*.dat" 2>&1 | tee track.log
+  grep "Pattern !\*.dat cannot be tracked: negative patterns are ignored in .gitattributes" track.log
+
+  git lfs track "data/" 2>&1 | tee track.log
+  grep "Pattern data/ cannot be tracked: patterns matching directories are ignored in .gitattributes, use data/\*\* to match the files in them" track.log
+
+  [ ! -s .gitattributes ] || [ "0" -eq "$(grep -c "dat" .gitattributes)" ]
+)
+end_test
+
+begin_test "track --lint"
+(
+  set -e
+
+  repo="track_lint"
+  mkdir "$repo"
+  cd "$repo"
+  git init
+
+  git lfs track "*.dat" "*.png"
+  git lfs track --lint
+
+  cat >> .gitattributes <<-EOF2
+*.dat filter=lfs diff=lfs merge=lfs -text
+*.PNG filter=lfs diff=lfs merge=lfs -text
+!*.bin filter=lfs diff=lfs merge=lfs -text
+*.psd lfs
+*.png -filter
+EOF2
+  mkdir sub
+  printf "[attr]mine filter=lfs\n*.dat -filter\n" > sub/.gitattributes
+  touch b.DAT
+  git add b.DAT
+
+  set +e
+  git lfs track --lint > lint.log 2>&1
+  res=$?
+  set -e
+  cat lint.log
+
+  [ "1" -eq "$res" ]
+  grep "^.gitattributes:3: pattern \*.dat is already tracked at .gitattributes:1" lint.log
+  grep "^.gitattributes:4: pattern \*.PNG differs only in case from \*.png at .gitattributes:2" lint.log
+  grep "^.gitattributes:5: negative patterns are ignored in .gitattributes" lint.log
+  grep "^.gitattributes:6: attribute macro lfs is not defined" lint.log
+  grep "^.gitattributes:2: pattern \*.png is overridden by \*.png at .gitattributes:7" lint.log
+  grep "^sub/.gitattributes:1: attribute macros may only be defined in the root .gitattributes" lint.log
+  grep "^b.DAT: tracked by Git LFS only on case-insensitive file systems" lint.log
+)
+end_test
+
+begin_test "track --filename-size-report"
+(
+  set -e
+
+  repo="track_filename_size_report"
+  mkdir "$repo"
+  cd "$repo"
+  git init
+
+  git lfs track "*.dat" "*.psd"
+  mkdir sub
+  printf "*.dat -filter\n" > sub/.gitattributes
+  printf "abc" > a.dat
+  printf "abcdef" > b.dat
+  printf "abcd" > sub/c.dat
+  head -c 2048 /dev/zero > big.iso
+  head -c 100 /dev/zero > small.iso
+  git add a.dat
+  echo "*.log" > .gitignore
+  head -c 4096 /dev/zero > ignored.log
+
+  git lfs track --filename-size-report --above=1k 2>&1 | tee report.log
+  grep "^    \*.dat (.gitattributes): 2 file(s), 9 B" report.log
+  grep "^    \*.psd (.gitattributes): 0 file(s), 0 B" report.log
+  grep "Files of 1.0 KB or more not tracked by any pattern" report.log
+  grep "^    big.iso (2.0 KB)" report.log
+  grep "^    sub/c.dat" report.log && exit 1
+  grep "small.iso" report.log && exit 1
+  grep "ignored.log" report.log && exit 1
+  exit 0
+)
+end_test
+
+begin_test "track --renormalize"
+(
+  set -e
+
+  reponame="track-renormalize"
+  git init "$reponame"
+  cd "$reponame"
+
+  mkdir dir
+  printf "a" > a.dat
+  printf "b" > dir/b.dat
+  git add a.dat dir/b.dat
+  git commit -m "initial commit"
+
+  git lfs track "*.dat" 2>&1 | tee track.log
+  grep "Tracking \*.dat" track.log
+  grep "2 file(s) matching the tracked patterns are staged as their contents" track.log
+  [ "0" -eq "$(git lfs ls-files | wc -l)" ]
+
+  git lfs track --renormalize "*.dat" 2>&1 | tee track.log
+  grep "\*.dat already supported" track.log
+  grep "Renormalizing a.dat" track.log
+  grep "Renormalizing dir/b.dat" track.log
+
+  git cat-file -p :a.dat | grep "version https://git-lfs"
+  git cat-file -p :dir/b.dat | grep "version https://git-lfs"
+
+  git lfs track --renormalize "*.dat" 2>&1 | tee track.log
+  [ "0" -eq "$(grep -c "Renormalizing" track.log)" ]
+)
+end_test
@@ -143,3 +143,105 @@ begin_test "uninstall hooks inside repository"
   [ "git-lfs filter-process" = "$(git config filter.lfs.process)" ]
 )
 end_test
+
+begin_test "uninstall --purge --convert=files"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-purge-files"
+  mkdir "$reponame"
+  cd "$reponame"
+  git init
+  git lfs install
+  git lfs install --local
+
+  git lfs track --macros "*.dat" "*.bin"
+  echo "*.txt text" >> .gitattributes
+  printf "a" > a.dat
+  printf "b" > b.bin
+  printf "c" > c.dat
+  echo "text" > c.txt
+  git add .gitattributes *.dat b.bin c.txt
+  git commit -m "add files"
+
+  printf "changed" > c.dat
+
+  git lfs uninstall --convert=files 2>&1 | tee uninstall.log
+  grep "\-\-convert can only be used with \-\-purge" uninstall.log
+
+  git lfs uninstall --purge --convert=files 2>&1 | tee uninstall.log
+  grep "Local Git LFS configuration has been removed." uninstall.log
+  grep "Removed 5 Git LFS line(s) from .gitattributes" uninstall.log
+  grep "Skipping c.dat, which has uncommitted changes" uninstall.log
+  grep "Converted 2 file(s) to plain files." uninstall.log
+
+  [ "*.txt text" = "$(cat .gitattributes)" ]
+  [ "" = "$(git config --local filter.lfs.process)" ]
+  [ ! -f .git/hooks/pre-push ]
+
+  [ "a" = "$(git cat-file -p :a.dat)" ]
+  [ "b" = "$(git cat-file -p :b.bin)" ]
+  git cat-file -p :c.dat | grep "https://git-lfs.github.com/spec/v1"
+)
+end_test
+
+begin_test "uninstall --purge --convert=files with files not checked out"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-purge-missing"
+  mkdir "$reponame"
+  cd "$reponame"
+  git init
+  git lfs install
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  rm -rf a.dat .git/lfs/objects
+  GIT_LFS_SKIP_SMUDGE=1 git checkout -- a.dat
+  git cat-file -p :a.dat | cmp - a.dat
+
+  git lfs uninstall --purge --convert=files 2>&1 | tee uninstall.log
+  if [ "0" -eq "${PIPESTATUS[0]}" ]; then
+    echo >&2 "fatal: expected uninstall to fail"
+    exit 1
+  fi
+  grep "a.dat hasn't been checked out" uninstall.log
+  grep "Run \`git lfs pull\`" uninstall.log
+
+  grep "filter=lfs" .gitattributes
+  [ "git-lfs filter-process" = "$(git config filter.lfs.process)" ]
+)
+end_test
+
+begin_test "uninstall --purge --convert=pointers"
+(
+  set -e
+
+  reponame="$(basename "$0" ".sh")-purge-pointers"
+  mkdir "$reponame"
+  cd "$reponame"
+  git init
+  git lfs install
+
+  git lfs track "*.dat"
+  printf "a" > a.dat
+  chmod +x a.dat
+  git add .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  pointer="$(git cat-file -p :a.dat)"
+
+  git lfs uninstall --purge --convert=pointers 2>&1 | tee uninstall.log
+  grep "Removed 1 Git LFS line(s) from .gitattributes" uninstall.log
+  grep "Converted 1 file(s) to pointers." uninstall.log
+
+  [ "$pointer" = "$(cat a.dat)" ]
+  [ -x a.dat ]
+  [ "" = "$(git status --porcelain -- a.dat)" ]
+  [ "" = "$(cat .gitattributes)" ]
+)
+end_test
@@ -0,0 +1,73 @@
+#!/usr/bin/env bash
+
+. "test/testlib.sh"
+
+begin_test "webdav transfers: push and fetch objects stored on a WebDAV share"
+(
+  set -e
+
+  reponame="webdav-transfers"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  share="$GITSERVER/webdav/$reponame"
+  git config -f .lfsconfig lfs.url "webdav+$share"
+  git config lfs.webdav.chunksize 4
+
+  git lfs track "*.dat"
+  contents="webdav contents"
+  oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git add .lfsconfig .gitattributes a.dat
+  git commit -m "add a.dat"
+
+  GIT_TRACE=1 git push origin master 2>&1 | tee push.log
+  grep "tq: transferring batch of size 1 with WebDAV" push.log
+  [ "0" = "$(grep -c "api: batch" push.log)" ]
+  [ "$contents" = "$(curl -s "$share/${oid:0:2}/${oid:2:2}/$oid")" ]
+  refute_server_object "$reponame" "$oid"
+
+  # objects the share has already aren't sent again
+  GIT_TRACE=1 git lfs push --object-id origin "$oid" 2>&1 | tee push.log
+  grep "is on the WebDAV share already, skipping" push.log
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-fetch"
+
+  git lfs pull 2>&1 | tee pull.log
+  assert_local_object "$oid" 15
+  [ "$contents" = "$(cat a.dat)" ]
+)
+end_test
+
+begin_test "webdav transfers: objects missing from the WebDAV share"
+(
+  set -e
+
+  reponame="webdav-transfers-missing"
+  setup_remote_repo "$reponame"
+  clone_repo "$reponame" "$reponame"
+
+  git config -f .lfsconfig lfs.url "webdav+$GITSERVER/webdav/$reponame"
+
+  git lfs track "*.dat"
+  contents="missing"
+  oid="$(calc_oid "$contents")"
+  printf "$contents" > a.dat
+  git add .lfsconfig .gitattributes a.dat
+  git commit -m "add a.dat"
+  git push origin master
+
+  cd ..
+  GIT_LFS_SKIP_SMUDGE=1 clone_repo "$reponame" "$reponame-fetch"
+  git config -f .lfsconfig lfs.url "webdav+$GITSERVER/webdav/$reponame-elsewhere"
+
+  set +e
+  git lfs fetch 2>&1 | tee fetch.log
+  res=${PIPESTATUS[0]}
+  set -e
+  [ "$res" != "0" ]
+  grep "$oid" fetch.log
+  refute_local_object "$oid"
+)
+end_test
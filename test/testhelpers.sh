@@ -193,13 +193,18 @@ wait_for_file() {
 #
 #   $ setup_remote_repo "some-name"
 #
+# Any further arguments are given to "git init", e.g.:
+#
+#   $ setup_remote_repo "some-name" --object-format=sha256
+#
 setup_remote_repo() {
   local reponame="$1"
+  shift
   echo "set up remote git repository: $reponame"
   repodir="$REMOTEDIR/$reponame.git"
   mkdir -p "$repodir"
   cd "$repodir"
-  git init --bare
+  git init --bare "$@"
   git config http.receivepack true
   git config receive.denyCurrentBranch ignore
 }
@@ -45,6 +45,9 @@ var (
 
 type RepoCreateSettings struct {
 	RepoType RepoType
+	// ObjectFormat is the object format of the repo, such as
+	// git.ObjectFormatSHA256, or git's default if blank.
+	ObjectFormat string
 }
 
 // Callback interface (testing.T compatible)
@@ -157,6 +160,9 @@ func NewCustomRepo(callback RepoCallback, settings *RepoCreateSettings) *Repo {
 	default:
 		ret.GitDir = filepath.Join(ret.Path, ".git")
 	}
+	if len(settings.ObjectFormat) > 0 {
+		args = append(args, "--object-format="+settings.ObjectFormat)
+	}
 	args = append(args, path)
 	cmd := exec.Command("git", args...)
 	err = cmd.Run()
@@ -388,7 +394,10 @@ func (r *Repo) AddRemote(name string) *Repo {
 	if _, exists := r.Remotes[name]; exists {
 		r.callback.Fatalf("Remote %v already exists", name)
 	}
-	remote := NewCustomRepo(r.callback, &RepoCreateSettings{RepoTypeBare})
+	remote := NewCustomRepo(r.callback, &RepoCreateSettings{
+		RepoType:     RepoTypeBare,
+		ObjectFormat: r.Settings.ObjectFormat,
+	})
 	r.Remotes[name] = remote
 	RunGitCommand(r.callback, true, "remote", "add", name, remote.Path)
 	return remote
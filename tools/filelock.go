@@ -0,0 +1,15 @@
+package tools
+
+import "os"
+
+// SameFile returns whether the file at path is still f, rather than having
+// been removed or replaced since f was opened, such as by another process
+// which held a lock on it.
+func SameFile(path string, f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pathFi, err := os.Stat(path)
+	return err == nil && os.SameFile(fi, pathFi)
+}
@@ -0,0 +1,37 @@
+// +build !windows
+
+package tools
+
+import (
+	"os"
+	"syscall"
+)
+
+// LockFile takes an advisory lock on f, which is released when it's closed or
+// unlocked: an exclusive one, or otherwise one shared with other processes. If
+// wait is false, it returns false rather than waiting when another process
+// holds a conflicting lock. A lock already held on f is converted, though not
+// atomically: it may be released before the new one is taken.
+func LockFile(f *os.File, exclusive, wait bool) (bool, error) {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+
+	err := syscall.Flock(int(f.Fd()), how)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CloseAndRemove removes the file at path before closing f, its open file, so
+// that any lock held on it is kept until no other process can open it.
+func CloseAndRemove(f *os.File, path string) error {
+	err := os.Remove(path)
+	f.Close()
+	return err
+}
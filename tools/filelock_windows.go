@@ -0,0 +1,62 @@
+// +build windows
+
+package tools
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+
+	errorLockViolation syscall.Errno = 33
+)
+
+// LockFile takes a lock on f, which is released when it's closed or unlocked:
+// an exclusive one, or otherwise one shared with other processes. If wait is
+// false, it returns false rather than waiting when another process holds a
+// conflicting lock. A lock already held on f is converted, though not
+// atomically: it is released before the new one is taken.
+//
+// As Windows' locks stop other processes reading and writing what they cover,
+// a byte far past the end of any file is locked, rather than its contents.
+func LockFile(f *os.File, exclusive, wait bool) (bool, error) {
+	procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(lockOverlapped())))
+
+	var flags uintptr
+	if exclusive {
+		flags |= lockfileExclusiveLock
+	}
+	if !wait {
+		flags |= lockfileFailImmediately
+	}
+
+	r1, _, err := procLockFileEx.Call(f.Fd(), flags, 0, 1, 0, uintptr(unsafe.Pointer(lockOverlapped())))
+	if r1 != 0 {
+		return true, nil
+	}
+	if err == errorLockViolation {
+		return false, nil
+	}
+	return false, err
+}
+
+func lockOverlapped() *syscall.Overlapped {
+	return &syscall.Overlapped{OffsetHigh: 0x7fffffff}
+}
+
+// CloseAndRemove closes f before removing the file at path, as Windows doesn't
+// remove files which are open.
+func CloseAndRemove(f *os.File, path string) error {
+	f.Close()
+	return os.Remove(path)
+}
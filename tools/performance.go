@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	performanceTracer     *perfTracer
+	performanceTracerOnce sync.Once
+)
+
+// perfTracer writes the time phases took, as Git writes the time its commands
+// take with GIT_TRACE_PERFORMANCE.
+type perfTracer struct {
+	w io.Writer
+	// bare is whether the time and source of each line are left out, as
+	// GIT_TRACE_BARE does.
+	bare bool
+	mu   sync.Mutex
+}
+
+// newPerfTracer returns a tracer writing where the given value of
+// GIT_TRACE_PERFORMANCE says, as Git reads it: "1", "2" or "true" for stderr,
+// a file descriptor from 3 to 9, or an absolute path of a file to append to.
+// It returns nil if the value turns tracing off, or isn't understood.
+func newPerfTracer(value string, bare bool) *perfTracer {
+	switch strings.ToLower(value) {
+	case "", "0", "false":
+		return nil
+	case "1", "2", "true":
+		return &perfTracer{w: os.Stderr, bare: bare}
+	}
+
+	if fd, err := strconv.Atoi(value); err == nil {
+		if fd < 3 || fd > 9 {
+			return nil
+		}
+		return &perfTracer{w: os.NewFile(uintptr(fd), "GIT_TRACE_PERFORMANCE"), bare: bare}
+	}
+
+	if !filepath.IsAbs(value) {
+		fmt.Fprintf(os.Stderr, "Unknown GIT_TRACE_PERFORMANCE value %q, not tracing performance\n", value)
+		return nil
+	}
+	f, err := os.OpenFile(value, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not open %q for tracing performance: %s\n", value, err)
+		return nil
+	}
+	return &perfTracer{w: f, bare: bare}
+}
+
+// trace writes a line saying the phase given by format and args took d.
+func (t *perfTracer) trace(now time.Time, d time.Duration, format string, args ...interface{}) {
+	var line string
+	if !t.bare {
+		// Git aligns its trace output at column 40, after the time
+		// and the source file and line.
+		line = fmt.Sprintf("%-40s", now.Format("15:04:05.000000")+" git-lfs")
+	}
+	line += fmt.Sprintf("performance: %.9f s:  git-lfs %s\n", d.Seconds(), fmt.Sprintf(format, args...))
+
+	t.mu.Lock()
+	io.WriteString(t.w, line)
+	t.mu.Unlock()
+}
+
+// TracePerformance writes how long the phase of the running command given by
+// format and args took, such as "scan" or "batch", if GIT_TRACE_PERFORMANCE is
+// set, in the format of Git's own performance tracing.
+func TracePerformance(d time.Duration, format string, args ...interface{}) {
+	performanceTracerOnce.Do(func() {
+		bare := strings.ToLower(os.Getenv("GIT_TRACE_BARE"))
+		performanceTracer = newPerfTracer(os.Getenv("GIT_TRACE_PERFORMANCE"), bare == "1" || bare == "true")
+	})
+
+	if performanceTracer != nil {
+		performanceTracer.trace(time.Now(), d, format, args...)
+	}
+}
+
+// TracePerformanceSince is TracePerformance for a phase which began at t and
+// has just finished.
+func TracePerformanceSince(t time.Time, format string, args ...interface{}) {
+	TracePerformance(time.Since(t), format, args...)
+}
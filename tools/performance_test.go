@@ -0,0 +1,56 @@
+package tools
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerfTracerWritesGitsFormat(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2017, 3, 4, 12, 34, 56, 789012000, time.UTC)
+
+	tracer := &perfTracer{w: &buf}
+	tracer.trace(now, 1500*time.Millisecond, "batch: %d object(s)", 3)
+	assert.Equal(t, "12:34:56.789012 git-lfs"+strings.Repeat(" ", 17)+"performance: 1.500000000 s:  git-lfs batch: 3 object(s)\n", buf.String())
+
+	buf.Reset()
+	tracer.bare = true
+	tracer.trace(now, time.Millisecond, "scan")
+	assert.Equal(t, "performance: 0.001000000 s:  git-lfs scan\n", buf.String())
+}
+
+func TestNewPerfTracer(t *testing.T) {
+	for _, value := range []string{"", "0", "false", "10", "relative/path"} {
+		assert.Nil(t, newPerfTracer(value, false), value)
+	}
+	for _, value := range []string{"1", "2", "true", "TRUE"} {
+		if tracer := newPerfTracer(value, true); assert.NotNil(t, tracer, value) {
+			assert.Equal(t, os.Stderr, tracer.w)
+			assert.True(t, tracer.bare)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "perf")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "perf.log")
+	require.Nil(t, ioutil.WriteFile(path, []byte("before\n"), 0644))
+
+	tracer := newPerfTracer(path, true)
+	require.NotNil(t, tracer)
+	tracer.trace(time.Now(), time.Second, "checkout: %d file(s)", 2)
+	tracer.w.(*os.File).Close()
+
+	by, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "before\nperformance: 1.000000000 s:  git-lfs checkout: 2 file(s)\n", string(by))
+}
@@ -0,0 +1,29 @@
+package tools
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDuration(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"8h":  8 * time.Hour,
+		"90m": 90 * time.Minute,
+		"0s":  0,
+		"30d": 30 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+	} {
+		d, err := ParseDuration(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, expected, d, s)
+	}
+}
+
+func TestParseDurationRejectsInvalidDurations(t *testing.T) {
+	for _, s := range []string{"", "d", "1.5d", "-1d", "soon"} {
+		_, err := ParseDuration(s)
+		assert.NotNil(t, err, s)
+	}
+}
@@ -0,0 +1,17 @@
+// +build !linux
+
+package tools
+
+import "errors"
+
+var errXattrUnsupported = errors.New("extended attributes are not supported on this platform")
+
+// SetXattr sets the extended attribute name of the file at path to value.
+func SetXattr(path, name, value string) error {
+	return errXattrUnsupported
+}
+
+// Xattr returns the value of the extended attribute name of the file at path.
+func Xattr(path, name string) (string, error) {
+	return "", errXattrUnsupported
+}
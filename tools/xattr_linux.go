@@ -0,0 +1,26 @@
+// +build linux
+
+package tools
+
+import "syscall"
+
+// SetXattr sets the extended attribute name of the file at path to value.
+func SetXattr(path, name, value string) error {
+	return syscall.Setxattr(path, name, []byte(value), 0)
+}
+
+// Xattr returns the value of the extended attribute name of the file at path.
+func Xattr(path, name string) (string, error) {
+	buf := make([]byte, 256)
+	for {
+		n, err := syscall.Getxattr(path, name, buf)
+		if err == syscall.ERANGE {
+			buf = make([]byte, 2*len(buf))
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	}
+}
@@ -1,9 +1,14 @@
 package tq
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"sync"
 
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/httputil"
+	"github.com/git-lfs/git-lfs/localstorage"
 	"github.com/rubyist/tracerx"
 )
 
@@ -16,12 +21,29 @@ type adapterBase struct {
 	transferImpl transferImplementation
 	jobChan      chan *job
 	cb           ProgressCallback
+	commitCb     CommitCallback
 	// WaitGroup to sync the completion of all workers
 	workerWait sync.WaitGroup
 	// WaitGroup to sync the completion of all in-flight jobs
 	jobWait *sync.WaitGroup
 	// WaitGroup to serialise the first transfer response to perform login if needed
 	authWait sync.WaitGroup
+	// throttle limits how many workers download at once while the disk
+	// can't keep up, or is nil if they aren't limited.
+	throttle *diskThrottle
+	// adaptive tunes how many workers transfer at once by the observed
+	// throughput, or is nil if the number isn't tuned.
+	adaptive *adaptiveConcurrency
+	// budget limits the requests made to each host at once, together with
+	// other queues, or is nil if they aren't limited.
+	budget *ConnectionBudget
+	// manifest is the manifest which created the adapter, whose
+	// configuration and object store it uses, or nil if it was created
+	// directly.
+	manifest *Manifest
+	// ctx cancels the requests of the transfers in flight once it's done,
+	// or is nil if they aren't cancelled.
+	ctx context.Context
 }
 
 // transferImplementation must be implemented to provide the actual upload/download
@@ -60,13 +82,78 @@ func (a *adapterBase) Direction() Direction {
 	return a.direction
 }
 
+// SetConnectionBudget implements ConnectionBudgeter.
+func (a *adapterBase) SetConnectionBudget(b *ConnectionBudget) {
+	a.budget = b
+}
+
+// SetContext implements Cancellable.
+func (a *adapterBase) SetContext(ctx context.Context) {
+	a.ctx = ctx
+}
+
+// context returns the context the adapter's requests are made with.
+func (a *adapterBase) context() context.Context {
+	if a.ctx == nil {
+		return context.Background()
+	}
+	return a.ctx
+}
+
+// newRequest creates a request as httputil.NewHttpRequest does, which is
+// cancelled with the adapter's context.
+func (a *adapterBase) newRequest(method, href string, header map[string]string) (*http.Request, error) {
+	return httputil.NewHttpRequestContext(a.context(), method, href, header)
+}
+
+// setManifest implements manifestAdapter.
+func (a *adapterBase) setManifest(m *Manifest) {
+	a.manifest = m
+}
+
+// config returns the configuration of the manifest which created the adapter.
+func (a *adapterBase) config() *config.Configuration {
+	return a.manifest.Config()
+}
+
+// objects returns the object store of the manifest which created the adapter.
+func (a *adapterBase) objects() ObjectStore {
+	return a.manifest.ObjectStore()
+}
+
+// SetCommitCallback implements CommitReporter, for the implementations which
+// call commit().
+func (a *adapterBase) SetCommitCallback(cb CommitCallback) {
+	a.commitCb = cb
+}
+
 func (a *adapterBase) Begin(cfg AdapterConfig, cb ProgressCallback) error {
 	a.cb = cb
 	a.jobChan = make(chan *job, 100)
 	maxConcurrency := cfg.ConcurrentTransfers()
 
+	// Start a worker for the most transfers which may run at once, and let
+	// as many of them run as the throughput shows helps.
+	a.adaptive = nil
+	if fewest, most := cfg.ConcurrencyBounds(); most > fewest {
+		a.adaptive = newAdaptiveConcurrency(fewest, maxConcurrency, most)
+		maxConcurrency = most
+		a.cb = func(name string, totalSize, readSoFar int64, readSinceLast int) error {
+			a.adaptive.Transferred(readSinceLast)
+			if cb == nil {
+				return nil
+			}
+			return cb(name, totalSize, readSoFar, readSinceLast)
+		}
+	}
+
 	tracerx.Printf("xfer: adapter %q Begin() with %d workers", a.Name(), maxConcurrency)
 
+	a.throttle = nil
+	if a.direction == Download && cfg.DiskBackpressure() {
+		a.throttle = newDiskThrottle(maxConcurrency)
+	}
+
 	a.workerWait.Add(maxConcurrency)
 	a.authWait.Add(1)
 	for i := 0; i < maxConcurrency; i++ {
@@ -122,6 +209,15 @@ func (a *adapterBase) End() {
 }
 
 // worker function, many of these run per adapter
+// transferHost returns the host the transfer is made to, as given by its
+// action in the adapter's direction.
+func (a *adapterBase) transferHost(t *Transfer) string {
+	if act, ok := t.Actions[a.direction.String()]; ok {
+		return hostOf(act.Href)
+	}
+	return ""
+}
+
 func (a *adapterBase) worker(workerNum int, ctx interface{}) {
 
 	tracerx.Printf("xfer: adapter %q worker %d starting", a.Name(), workerNum)
@@ -155,7 +251,23 @@ func (a *adapterBase) worker(workerNum int, ctx interface{}) {
 		if t.Size < 0 {
 			err = fmt.Errorf("Git LFS: object %q has invalid size (got: %d)", t.Oid, t.Size)
 		} else {
+			a.throttle.Acquire()
+			a.adaptive.Acquire()
+			host := a.transferHost(t)
+			a.budget.Acquire(host)
 			err = a.transferImpl.DoTransfer(ctx, t, a.cb, authCallback)
+			a.budget.Release(host)
+			a.adaptive.Release(err)
+			a.throttle.Release()
+		}
+
+		// Compress downloaded objects, and those decompressed to be
+		// uploaded, if lfs.storagecompression is set and they are in
+		// the local storage. The transfer has succeeded either way.
+		if err == nil && isLocalObjectStore(a.objects()) {
+			if cerr := localstorage.CompressObject(a.config(), t.Oid, t.Name); cerr != nil {
+				tracerx.Printf("xfer: unable to compress %q: %v", t.Oid, cerr)
+			}
 		}
 
 		// Mark the job as completed, and alter all listeners
@@ -189,3 +301,11 @@ func advanceCallbackProgress(cb ProgressCallback, t *Transfer, numBytes int64) {
 		}
 	}
 }
+
+// commit reports that the remote has acknowledged storing the first
+// committedSoFar bytes of t's object, if a CommitCallback was set.
+func (a *adapterBase) commit(t *Transfer, committedSoFar int64) {
+	if a.commitCb != nil {
+		a.commitCb(t.Name, t.Oid, t.Size, committedSoFar)
+	}
+}
@@ -0,0 +1,140 @@
+package tq
+
+import (
+	"time"
+
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	// adaptiveWindow is how often an adaptiveConcurrency decides whether
+	// to change how many transfers it lets run at once.
+	adaptiveWindow = 2 * time.Second
+	// adaptiveGain is how much faster, as a share, the transfers must get
+	// after one more is let run at once for it to be kept.
+	adaptiveGain = 0.05
+	// adaptiveProbeWindows is the number of windows without a change after
+	// which one more transfer is let run at once again, to find out if the
+	// network can now take it.
+	adaptiveProbeWindows = 5
+)
+
+// adaptiveConcurrency tunes how many workers of an adapter transfer at once,
+// between a minimum and a maximum, by the throughput and errors it observes,
+// so that the number needn't be tuned by hand for each network. Every
+// adaptiveWindow, it lets one more worker run if the last one it let run made
+// the transfers faster by at least adaptiveGain, one fewer if it didn't, and
+// half as many if any transfer failed, as when the server or network is
+// overloaded.
+//
+// A nil *adaptiveConcurrency lets every worker run. It is safe to use from
+// multiple goroutines.
+type adaptiveConcurrency struct {
+	workerLimit
+
+	min, max int
+
+	// windowStart is when the current window started, and bytes and errors
+	// the bytes transferred and transfers failed during it.
+	windowStart time.Time
+	bytes       int64
+	errors      int
+
+	// lastRate is the throughput of the last window, in bytes per second,
+	// raised is whether the limit was raised after it, and held is the
+	// number of windows since the limit was last changed.
+	lastRate float64
+	raised   bool
+	held     int
+
+	now func() time.Time
+}
+
+// newAdaptiveConcurrency returns an adaptiveConcurrency which lets start
+// workers run at once at first, and between min and max later on.
+func newAdaptiveConcurrency(min, start, max int) *adaptiveConcurrency {
+	c := &adaptiveConcurrency{min: min, max: max, now: time.Now}
+	c.init(start)
+	c.windowStart = c.now()
+	return c
+}
+
+// Acquire waits until another worker may start a transfer.
+func (c *adaptiveConcurrency) Acquire() {
+	if c != nil {
+		c.acquire()
+	}
+}
+
+// Release records that a worker has finished its transfer, which failed with
+// err if it isn't nil.
+func (c *adaptiveConcurrency) Release(err error) {
+	if c == nil {
+		return
+	}
+
+	c.release()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.errors++
+	}
+	c.update()
+}
+
+// Transferred records that another n bytes have been transferred.
+func (c *adaptiveConcurrency) Transferred(n int) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bytes += int64(n)
+	c.update()
+}
+
+// update changes the limit if the current window is over. It must be called
+// with mu held.
+func (c *adaptiveConcurrency) update() {
+	now := c.now()
+	elapsed := now.Sub(c.windowStart)
+	if elapsed < adaptiveWindow {
+		return
+	}
+
+	rate := float64(c.bytes) / elapsed.Seconds()
+	improved := c.raised && rate >= c.lastRate*(1+adaptiveGain)
+
+	switch {
+	case c.errors > 0 && c.limit > c.min:
+		c.setLimit(tools.MaxInt(c.min, c.limit/2), rate, "transfers failed")
+		c.raised = false
+	case c.raised && !improved && c.limit > c.min:
+		c.setLimit(c.limit-1, rate, "throughput didn't improve")
+		c.raised = false
+	case c.errors == 0 && (improved || c.lastRate == 0 || c.held >= adaptiveProbeWindows) && c.limit < c.max:
+		c.setLimit(c.limit+1, rate, "trying more")
+		c.raised = true
+	default:
+		c.raised = false
+		c.held++
+	}
+
+	c.lastRate = rate
+	c.windowStart = now
+	c.bytes = 0
+	c.errors = 0
+}
+
+// setLimit lets n workers run at once, tracing why.
+func (c *adaptiveConcurrency) setLimit(n int, rate float64, why string) {
+	perConnection := rate / float64(tools.MaxInt(c.active, 1))
+	tracerx.Printf("xfer: %s at %.0f B/s (%.0f B/s per connection), transferring %d object(s) at a time", why, rate, perConnection, n)
+
+	c.limit = n
+	c.held = 0
+	c.cond.Broadcast()
+}
@@ -0,0 +1,110 @@
+package tq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAdaptiveConcurrency(min, start, max int, clock *time.Time) *adaptiveConcurrency {
+	c := newAdaptiveConcurrency(min, start, max)
+	c.now = func() time.Time { return *clock }
+	c.windowStart = *clock
+	return c
+}
+
+func TestAdaptiveConcurrencyKeepsMoreWhileThroughputImproves(t *testing.T) {
+	clock := time.Unix(0, 0)
+	c := newTestAdaptiveConcurrency(1, 2, 4, &clock)
+
+	// the first window tries one more
+	clock = clock.Add(adaptiveWindow)
+	c.Transferred(1000)
+	assert.Equal(t, 3, c.limit)
+
+	// which helped, so another is tried
+	clock = clock.Add(adaptiveWindow)
+	c.Transferred(2000)
+	assert.Equal(t, 4, c.limit)
+
+	// never more than the maximum
+	clock = clock.Add(adaptiveWindow)
+	c.Transferred(4000)
+	assert.Equal(t, 4, c.limit)
+}
+
+func TestAdaptiveConcurrencyGoesBackWhenThroughputDoesNotImprove(t *testing.T) {
+	clock := time.Unix(0, 0)
+	c := newTestAdaptiveConcurrency(1, 2, 8, &clock)
+
+	clock = clock.Add(adaptiveWindow)
+	c.Transferred(1000)
+	assert.Equal(t, 3, c.limit)
+
+	clock = clock.Add(adaptiveWindow)
+	c.Transferred(1000)
+	assert.Equal(t, 2, c.limit)
+
+	// held until it's time to probe again
+	for i := 0; i < adaptiveProbeWindows; i++ {
+		clock = clock.Add(adaptiveWindow)
+		c.Transferred(1000)
+		assert.Equal(t, 2, c.limit)
+	}
+
+	clock = clock.Add(adaptiveWindow)
+	c.Transferred(1000)
+	assert.Equal(t, 3, c.limit)
+}
+
+func TestAdaptiveConcurrencyHalvesOnErrors(t *testing.T) {
+	clock := time.Unix(0, 0)
+	c := newTestAdaptiveConcurrency(2, 8, 8, &clock)
+	c.Acquire()
+
+	clock = clock.Add(adaptiveWindow)
+	c.Release(errors.New("overloaded"))
+	assert.Equal(t, 4, c.limit)
+
+	c.Acquire()
+	clock = clock.Add(adaptiveWindow)
+	c.Release(errors.New("overloaded"))
+	assert.Equal(t, 2, c.limit)
+
+	// never fewer than the minimum
+	c.Acquire()
+	clock = clock.Add(adaptiveWindow)
+	c.Release(errors.New("overloaded"))
+	assert.Equal(t, 2, c.limit)
+}
+
+func TestAdaptiveConcurrencyWaitsForTheWindow(t *testing.T) {
+	clock := time.Unix(0, 0)
+	c := newTestAdaptiveConcurrency(1, 2, 4, &clock)
+
+	clock = clock.Add(adaptiveWindow / 2)
+	c.Transferred(1000)
+	assert.Equal(t, 2, c.limit)
+	assert.EqualValues(t, 1000, c.bytes)
+}
+
+func TestNilAdaptiveConcurrencyDoesNotLimit(t *testing.T) {
+	var c *adaptiveConcurrency
+	c.Acquire()
+	c.Transferred(1000)
+	c.Release(errors.New("failed"))
+}
+
+func TestManifestConcurrencyBounds(t *testing.T) {
+	m := &Manifest{concurrentTransfers: 3, minConcurrency: 1, maxConcurrency: 16}
+	min, max := m.ConcurrencyBounds()
+	assert.Equal(t, 3, min)
+	assert.Equal(t, 3, max)
+
+	m.adaptiveConcurrency = true
+	min, max = m.ConcurrencyBounds()
+	assert.Equal(t, 1, min)
+	assert.Equal(t, 16, max)
+}
@@ -4,15 +4,16 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 
-	"github.com/git-lfs/git-lfs/config"
 	"github.com/git-lfs/git-lfs/errors"
 	"github.com/git-lfs/git-lfs/httputil"
-	"github.com/git-lfs/git-lfs/localstorage"
 	"github.com/git-lfs/git-lfs/tools"
 	"github.com/rubyist/tracerx"
 )
@@ -30,11 +31,7 @@ func (a *basicDownloadAdapter) tempDir() string {
 	// Must be dedicated to this adapter as deleted by ClearTempStorage
 	// Also make local to this repo not global, and separate to localstorage temp,
 	// which gets cleared at the end of every invocation
-	d := filepath.Join(localstorage.Objects().RootDir, "incomplete")
-	if err := os.MkdirAll(d, 0755); err != nil {
-		return os.TempDir()
-	}
-	return d
+	return incompleteDir(a.objects(), "incomplete")
 }
 
 func (a *basicDownloadAdapter) WorkerStarting(workerNum int) (interface{}, error) {
@@ -83,6 +80,48 @@ func (a *basicDownloadAdapter) downloadFilename(t *Transfer) string {
 	return filepath.Join(a.tempDir(), t.Oid+".tmp")
 }
 
+// validatorFilename returns the path of the file holding the validator of the
+// response an incomplete download came from, next to the download itself.
+func (a *basicDownloadAdapter) validatorFilename(t *Transfer) string {
+	return filepath.Join(a.tempDir(), t.Oid+".validator")
+}
+
+// readValidator returns the validator saved for the incomplete download of t,
+// or an empty string if there is none.
+func (a *basicDownloadAdapter) readValidator(t *Transfer) string {
+	by, err := ioutil.ReadFile(a.validatorFilename(t))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(by))
+}
+
+// writeValidator saves the validator of res, so that the download of t can be
+// resumed only if the object served hasn't changed since. Servers which don't
+// give one can still be resumed from, as before.
+func (a *basicDownloadAdapter) writeValidator(t *Transfer, res *http.Response) {
+	name := a.validatorFilename(t)
+	validator := responseValidator(res)
+	if len(validator) == 0 {
+		os.Remove(name)
+		return
+	}
+
+	if err := ioutil.WriteFile(name, []byte(validator), 0644); err != nil {
+		tracerx.Printf("xfer: unable to save validator for %q: %s", t.Oid, err)
+	}
+}
+
+// responseValidator returns the strong ETag of res, or its Last-Modified date
+// if it has none, for use in an If-Range header. Weak ETags can't be used
+// there.
+func responseValidator(res *http.Response) string {
+	if etag := res.Header.Get("ETag"); len(etag) > 0 && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return res.Header.Get("Last-Modified")
+}
+
 // download starts or resumes and download. Always closes dlFile if non-nil
 func (a *basicDownloadAdapter) download(t *Transfer, cb ProgressCallback, authOkFunc func(), dlFile *os.File, fromByte int64, hash hash.Hash) error {
 	if dlFile != nil {
@@ -97,7 +136,7 @@ func (a *basicDownloadAdapter) download(t *Transfer, cb ProgressCallback, authOk
 		// return errors.New("Object not found on the server.")
 	}
 
-	req, err := httputil.NewHttpRequest("GET", rel.Href, rel.Header)
+	req, err := a.newRequest("GET", rel.Href, rel.Header)
 	if err != nil {
 		return err
 	}
@@ -108,20 +147,30 @@ func (a *basicDownloadAdapter) download(t *Transfer, cb ProgressCallback, authOk
 		}
 		// We could just use a start byte, but since we know the length be specific
 		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", fromByte, t.Size-1))
+		// Have the server send the whole object instead if it has
+		// changed since the incomplete download was started
+		if validator := a.readValidator(t); len(validator) > 0 {
+			req.Header.Set("If-Range", validator)
+		}
 	}
 
-	res, err := httputil.DoHttpRequest(config.Config, req, !t.Authenticated)
+	res, err := httputil.DoHttpRequest(a.config(), req, !t.Authenticated)
 	if err != nil {
+		if _, ok := errors.IsRetriableLaterError(err); ok {
+			return err
+		}
+
 		// Special-case status code 416 () - fall back
 		if fromByte > 0 && dlFile != nil && res.StatusCode == 416 {
 			tracerx.Printf("xfer: server rejected resume download request for %q from byte %d; re-downloading from start", t.Oid, fromByte)
 			dlFile.Close()
 			os.Remove(dlFile.Name())
+			os.Remove(a.validatorFilename(t))
 			return a.download(t, cb, authOkFunc, nil, 0, nil)
 		}
-		return errors.NewRetriableError(err)
+		return withStatus(errors.NewRetriableError(err), res)
 	}
-	httputil.LogTransfer(config.Config, "lfs.data.download", res)
+	httputil.LogTransfer(a.config(), "lfs.data.download", res)
 	defer res.Body.Close()
 
 	// Range request must return 206 & content range to confirm
@@ -136,10 +185,13 @@ func (a *basicDownloadAdapter) download(t *Transfer, cb ProgressCallback, authOk
 				match := regex.FindStringSubmatch(rangeHdr)
 				if match != nil && len(match) > 1 {
 					contentStart, _ := strconv.ParseInt(match[1], 10, 64)
-					if contentStart == fromByte {
-						rangeRequestOk = true
-					} else {
+					validator, current := req.Header.Get("If-Range"), responseValidator(res)
+					if contentStart != fromByte {
 						failReason = fmt.Sprintf("Content-Range start byte incorrect: %s expected %d", match[1], fromByte)
+					} else if len(validator) > 0 && len(current) > 0 && validator != current {
+						failReason = fmt.Sprintf("object changed since download started: %s expected %s", current, validator)
+					} else {
+						rangeRequestOk = true
 					}
 				} else {
 					failReason = fmt.Sprintf("badly formatted Content-Range header: %q", rangeHdr)
@@ -159,8 +211,9 @@ func (a *basicDownloadAdapter) download(t *Transfer, cb ProgressCallback, authOk
 			dlFile.Close()
 			os.Remove(dlFile.Name())
 			if res.StatusCode == 200 {
-				// If status code was 200 then server just ignored Range header and
-				// sent everything. Don't re-request, use this one from byte 0
+				// If status code was 200 then server just ignored Range header, or
+				// the object changed per If-Range, and sent everything. Don't
+				// re-request, use this one from byte 0
 				dlFile = nil
 				fromByte = 0
 				hash = nil
@@ -177,6 +230,10 @@ func (a *basicDownloadAdapter) download(t *Transfer, cb ProgressCallback, authOk
 		authOkFunc()
 	}
 
+	if fromByte == 0 {
+		a.writeValidator(t, res)
+	}
+
 	var hasher *tools.HashingReader
 	httpReader := tools.NewRetriableReader(res.Body)
 
@@ -203,7 +260,7 @@ func (a *basicDownloadAdapter) download(t *Transfer, cb ProgressCallback, authOk
 		}
 		return nil
 	}
-	written, err := tools.CopyWithCallback(dlFile, hasher, res.ContentLength, ccb)
+	written, err := tools.CopyWithCallback(a.throttle.Writer(dlFile), hasher, res.ContentLength, ccb)
 	if err != nil {
 		return errors.Wrapf(err, "cannot write data to tempfile %q", dlfilename)
 	}
@@ -212,10 +269,31 @@ func (a *basicDownloadAdapter) download(t *Transfer, cb ProgressCallback, authOk
 	}
 
 	if actual := hasher.Hash(); actual != t.Oid {
-		return fmt.Errorf("Expected OID %s, got %s after %d bytes written", t.Oid, actual, written)
+		err := fmt.Errorf("Expected OID %s, got %s after %d bytes written", t.Oid, actual, written)
+		if fromByte+written < t.Size {
+			// An incomplete download is resumed next time.
+			return err
+		}
+
+		// Never resume from a corrupt download: keep it aside for
+		// inspection, and download the object from scratch if the
+		// transfer is retried.
+		os.Remove(a.validatorFilename(t))
+		if name, qerr := quarantineDownload(a.objects(), t, dlfilename, res, fromByte, written, actual); qerr != nil {
+			tracerx.Printf("xfer: unable to quarantine corrupt download of %q: %s", t.Oid, qerr)
+			os.Remove(dlfilename)
+		} else {
+			tracerx.Printf("xfer: quarantined corrupt download of %q in %s", t.Oid, name)
+			err = fmt.Errorf("%s, quarantined in %s", err, name)
+		}
+		return errors.NewCorruptObjectError(err, t.Oid)
 	}
 
-	return tools.RenameFileCopyPermissions(dlfilename, t.Path)
+	if err := tools.RenameFileCopyPermissions(dlfilename, t.Path); err != nil {
+		return err
+	}
+	os.Remove(a.validatorFilename(t))
+	return a.objects().ProtectObject(t.Path)
 }
 
 func configureBasicDownloadAdapter(m *Manifest) {
@@ -0,0 +1,30 @@
+package tq
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseValidatorPrefersStrongETag(t *testing.T) {
+	res := &http.Response{Header: http.Header{}}
+	res.Header.Set("ETag", `"abc"`)
+	res.Header.Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+
+	assert.Equal(t, `"abc"`, responseValidator(res))
+}
+
+func TestResponseValidatorIgnoresWeakETag(t *testing.T) {
+	res := &http.Response{Header: http.Header{}}
+	res.Header.Set("ETag", `W/"abc"`)
+	res.Header.Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+
+	assert.Equal(t, "Mon, 02 Jan 2006 15:04:05 GMT", responseValidator(res))
+}
+
+func TestResponseValidatorWithoutValidators(t *testing.T) {
+	res := &http.Response{Header: http.Header{}}
+
+	assert.Equal(t, "", responseValidator(res))
+}
@@ -3,12 +3,13 @@ package tq
 import (
 	"io"
 	"io/ioutil"
+	"mime"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 
 	"github.com/git-lfs/git-lfs/api"
-	"github.com/git-lfs/git-lfs/config"
 	"github.com/git-lfs/git-lfs/errors"
 	"github.com/git-lfs/git-lfs/httputil"
 	"github.com/git-lfs/git-lfs/progress"
@@ -50,13 +51,29 @@ func (a *basicUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Progres
 		// return fmt.Errorf("No upload action for this object.")
 	}
 
-	req, err := httputil.NewHttpRequest("PUT", rel.Href, rel.Header)
+	req, err := a.newRequest("PUT", rel.Href, rel.Header)
 	if err != nil {
 		return err
 	}
 
+	if err := ensureWholeObject(a.objects(), t); err != nil {
+		return errors.Wrap(err, "basic upload")
+	}
+
+	f, err := os.OpenFile(t.Path, os.O_RDONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "basic upload")
+	}
+	defer f.Close()
+
 	if len(req.Header.Get("Content-Type")) == 0 {
-		req.Header.Set("Content-Type", "application/octet-stream")
+		ctype := "application/octet-stream"
+		if a.config().Git.Bool("lfs.contenttype", true) {
+			if ctype, err = detectContentType(t.Name, f); err != nil {
+				return errors.Wrap(err, "basic upload")
+			}
+		}
+		req.Header.Set("Content-Type", ctype)
 	}
 
 	if req.Header.Get("Transfer-Encoding") == "chunked" {
@@ -67,12 +84,6 @@ func (a *basicUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Progres
 
 	req.ContentLength = t.Size
 
-	f, err := os.OpenFile(t.Path, os.O_RDONLY, 0644)
-	if err != nil {
-		return errors.Wrap(err, "basic upload")
-	}
-	defer f.Close()
-
 	// Ensure progress callbacks made while uploading
 	// Wrap callback to give name context
 	ccb := func(totalSize int64, readSoFar int64, readSinceLast int) error {
@@ -97,11 +108,14 @@ func (a *basicUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Progres
 
 	req.Body = ioutil.NopCloser(reader)
 
-	res, err := httputil.DoHttpRequest(config.Config, req, !t.Authenticated)
+	res, err := httputil.DoHttpRequest(a.config(), req, !t.Authenticated)
 	if err != nil {
-		return errors.NewRetriableError(err)
+		if _, ok := errors.IsRetriableLaterError(err); ok {
+			return err
+		}
+		return withStatus(errors.NewRetriableError(err), res)
 	}
-	httputil.LogTransfer(config.Config, "lfs.data.upload", res)
+	httputil.LogTransfer(a.config(), "lfs.data.upload", res)
 
 	// A status code of 403 likely means that an authentication token for the
 	// upload has expired. This can be safely retried.
@@ -117,7 +131,28 @@ func (a *basicUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb Progres
 	io.Copy(ioutil.Discard, res.Body)
 	res.Body.Close()
 
-	return api.VerifyUpload(config.Config, toApiObject(t))
+	return newVerifyError(api.VerifyUpload(a.config(), toApiObject(t)))
+}
+
+// detectContentType returns the MIME type of the file being uploaded, so that
+// storage which serves objects directly can do so with the right headers. The
+// type is taken from the extension of its name if that is known, otherwise it
+// is sniffed from the start of the file, which is then rewound.
+func detectContentType(name string, f io.ReadSeeker) (string, error) {
+	if ctype := mime.TypeByExtension(filepath.Ext(name)); len(ctype) > 0 {
+		return ctype, nil
+	}
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
 }
 
 // startCallbackReader is a reader wrapper which calls a function as soon as the
@@ -0,0 +1,35 @@
+package tq
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectContentTypeFromExtension(t *testing.T) {
+	ctype, err := detectContentType("images/logo.png", bytes.NewReader([]byte("not really a png")))
+	assert.Nil(t, err)
+	assert.Equal(t, "image/png", ctype)
+}
+
+func TestDetectContentTypeFromContents(t *testing.T) {
+	gif := []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00")
+	r := bytes.NewReader(gif)
+
+	ctype, err := detectContentType("noextension", r)
+	assert.Nil(t, err)
+	assert.Equal(t, "image/gif", ctype)
+
+	rest, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, gif, rest, "expected the file to be rewound")
+}
+
+func TestDetectContentTypeOfEmptyFile(t *testing.T) {
+	ctype, err := detectContentType("empty", strings.NewReader(""))
+	assert.Nil(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", ctype)
+}
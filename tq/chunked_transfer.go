@@ -0,0 +1,329 @@
+package tq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/api"
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/httputil"
+	"github.com/git-lfs/git-lfs/localstorage"
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	ChunkedAdapterName = "chunked"
+	ChunkedMediaType   = "application/vnd.git-lfs.chunks+json"
+)
+
+// chunkedManifest lists the chunks an object is made up of, as sent to and
+// received from servers supporting chunked transfers.
+type chunkedManifest struct {
+	Oid    string               `json:"oid,omitempty"`
+	Size   int64                `json:"size,omitempty"`
+	Chunks []localstorage.Chunk `json:"chunks"`
+}
+
+// chunkedMissing lists the chunks of an object which a server doesn't have yet.
+type chunkedMissing struct {
+	Missing []string `json:"missing"`
+}
+
+// Adapter for transfers of objects as the content-defined chunks of the chunk
+// store, so that only the chunks which the other side doesn't have already are
+// sent. It is offered to servers when lfs.chunkstore is set.
+type chunkedAdapter struct {
+	*adapterBase
+}
+
+func (a *chunkedAdapter) ClearTempStorage() error {
+	// chunks are written straight to the chunk store
+	return nil
+}
+
+func (a *chunkedAdapter) WorkerStarting(workerNum int) (interface{}, error) {
+	return nil, nil
+}
+func (a *chunkedAdapter) WorkerEnding(workerNum int, ctx interface{}) {
+}
+
+func (a *chunkedAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressCallback, authOkFunc func()) error {
+	if a.direction == Upload {
+		return a.upload(t, cb, authOkFunc)
+	}
+	return a.download(t, cb, authOkFunc)
+}
+
+// download fetches the manifest of t's object from the server, then each of
+// its chunks which isn't stored locally, and records the object in the chunk
+// store. The object isn't written to t.Path.
+func (a *chunkedAdapter) download(t *Transfer, cb ProgressCallback, authOkFunc func()) error {
+	rel, err := t.Actions.Get("download")
+	if err != nil {
+		return err
+	}
+
+	var manifest chunkedManifest
+	if _, err := chunkedRequest(a.context(), a.config(), "GET", rel, rel.Href, nil, &manifest); err != nil {
+		return err
+	}
+	if authOkFunc != nil {
+		authOkFunc()
+	}
+
+	var size int64
+	for _, c := range manifest.Chunks {
+		size += c.Size
+	}
+	if size != t.Size {
+		return fmt.Errorf("chunked download of %q lists %d bytes of chunks, expected %d", t.Oid, size, t.Size)
+	}
+
+	store := localstorage.Chunks()
+	var received, fetched int64
+	for _, c := range manifest.Chunks {
+		if !store.HasChunk(c.Oid, c.Size) {
+			if err := a.downloadChunk(rel, c); err != nil {
+				return err
+			}
+			fetched += c.Size
+		}
+
+		received += c.Size
+		if cb != nil {
+			cb(t.Name, t.Size, received, int(c.Size))
+		}
+	}
+	tracerx.Printf("xfer: chunked download of %q fetched %d of %d bytes", t.Oid, fetched, t.Size)
+
+	if err := store.WriteManifest(t.Oid, manifest.Chunks); err != nil {
+		return err
+	}
+
+	// Check that the chunks add up to the object, forgetting it if not.
+	r, err := store.Open(t.Oid)
+	if err == nil {
+		_, err = io.Copy(ioutil.Discard, r)
+		r.Close()
+	}
+	if err != nil {
+		store.Remove(t.Oid)
+		return errors.Wrapf(err, "chunked download of %q", t.Oid)
+	}
+	return nil
+}
+
+// downloadChunk fetches the given chunk from the server and stores it.
+func (a *chunkedAdapter) downloadChunk(rel *Action, c localstorage.Chunk) error {
+	href, err := chunkHref(rel.Href, c.Oid)
+	if err != nil {
+		return err
+	}
+
+	req, err := a.newRequest("GET", href, rel.Header)
+	if err != nil {
+		return err
+	}
+
+	res, err := httputil.DoHttpRequest(a.config(), req, false)
+	if err != nil {
+		return withStatus(errors.NewRetriableError(err), res)
+	}
+	defer res.Body.Close()
+	httputil.LogTransfer(a.config(), "lfs.data.download", res)
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, c.Size+1))
+	if err != nil {
+		return errors.NewRetriableError(err)
+	}
+	if int64(len(data)) != c.Size {
+		return errors.NewRetriableError(fmt.Errorf("chunk %q is %d bytes, expected %d", c.Oid, len(data), c.Size))
+	}
+	return localstorage.Chunks().WriteChunk(c.Oid, data)
+}
+
+// upload sends the server the manifest of t's object, storing the object in
+// the chunk store first if it's only stored whole, then each of its chunks the
+// server says it doesn't have, and then the manifest again to check that the
+// server has them all.
+func (a *chunkedAdapter) upload(t *Transfer, cb ProgressCallback, authOkFunc func()) error {
+	rel, err := t.Actions.Get("upload")
+	if err != nil {
+		return err
+	}
+
+	store := localstorage.Chunks()
+	chunks, err := store.Manifest(t.Oid)
+	if err != nil {
+		if err := ensureWholeObject(a.objects(), t); err != nil {
+			return errors.Wrap(err, "chunked upload")
+		}
+		f, err := os.Open(t.Path)
+		if err != nil {
+			return errors.Wrap(err, "chunked upload")
+		}
+		chunks, err = store.Store(t.Oid, f)
+		f.Close()
+		if err != nil {
+			return errors.Wrap(err, "chunked upload")
+		}
+	}
+
+	manifest := &chunkedManifest{Oid: t.Oid, Size: t.Size, Chunks: chunks}
+	var missing chunkedMissing
+	if _, err := chunkedRequest(a.context(), a.config(), "POST", rel, rel.Href, manifest, &missing); err != nil {
+		return err
+	}
+	if authOkFunc != nil {
+		authOkFunc()
+	}
+
+	wanted := tools.NewStringSetFromSlice(missing.Missing)
+	var sent, uploaded int64
+	for _, c := range chunks {
+		if wanted.Contains(c.Oid) {
+			if err := a.uploadChunk(rel, c); err != nil {
+				return err
+			}
+			wanted.Remove(c.Oid)
+			uploaded += c.Size
+		}
+
+		// The server has each chunk once it has acknowledged it, or
+		// if it said it had it already.
+		sent += c.Size
+		if cb != nil {
+			cb(t.Name, t.Size, sent, int(c.Size))
+		}
+		a.commit(t, sent)
+	}
+	tracerx.Printf("xfer: chunked upload of %q sent %d of %d bytes", t.Oid, uploaded, t.Size)
+
+	missing.Missing = nil
+	if _, err := chunkedRequest(a.context(), a.config(), "POST", rel, rel.Href, manifest, &missing); err != nil {
+		return err
+	}
+	if len(missing.Missing) > 0 {
+		return errors.NewRetriableError(fmt.Errorf("server is still missing %d chunk(s) of %q", len(missing.Missing), t.Oid))
+	}
+
+	return newVerifyError(api.VerifyUpload(a.config(), toApiObject(t)))
+}
+
+// uploadChunk sends the given chunk to the server.
+func (a *chunkedAdapter) uploadChunk(rel *Action, c localstorage.Chunk) error {
+	href, err := chunkHref(rel.Href, c.Oid)
+	if err != nil {
+		return err
+	}
+
+	f, err := localstorage.Chunks().OpenChunk(c.Oid)
+	if err != nil {
+		return errors.Wrap(err, "chunked upload")
+	}
+	defer f.Close()
+
+	req, err := a.newRequest("PUT", href, rel.Header)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Length", strconv.FormatInt(c.Size, 10))
+	req.ContentLength = c.Size
+	req.Body = f
+
+	res, err := httputil.DoHttpRequest(a.config(), req, false)
+	if err != nil {
+		return withStatus(errors.NewRetriableError(err), res)
+	}
+	httputil.LogTransfer(a.config(), "lfs.data.upload", res)
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	return nil
+}
+
+// chunkedRequest makes a request of the given action with a JSON body, if
+// given, and decodes the JSON response into out, as configured by cfg. The
+// request is cancelled once ctx is done.
+func chunkedRequest(ctx context.Context, cfg *config.Configuration, method string, rel *Action, href string, body, out interface{}) (*http.Response, error) {
+	req, err := httputil.NewHttpRequestContext(ctx, method, href, rel.Header)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ChunkedMediaType)
+
+	if body != nil {
+		by, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", ChunkedMediaType)
+		req.Header.Set("Content-Length", strconv.Itoa(len(by)))
+		req.ContentLength = int64(len(by))
+		req.Body = ioutil.NopCloser(bytes.NewReader(by))
+	}
+
+	res, err := httputil.DoHttpRequest(cfg, req, false)
+	if err != nil {
+		return res, withStatus(errors.NewRetriableError(err), res)
+	}
+	defer res.Body.Close()
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return res, errors.Wrapf(err, "invalid chunked transfer response from %s", httputil.TraceHttpReq(req))
+	}
+	return res, nil
+}
+
+// chunkHref returns the URL of the chunk with the given OID for the object at
+// the given action URL: the "chunks/<oid>" path below it.
+func chunkHref(href, oid string) (string, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/chunks/" + oid
+	return u.String(), nil
+}
+
+// ensureWholeObject reassembles the object of t at t.Path from the chunk store,
+// or decompresses it, if it's only stored as chunks or compressed, for the
+// adapters which upload whole files. Only the local storage of the current
+// repository, as the object store s, has those stores.
+func ensureWholeObject(s ObjectStore, t *Transfer) error {
+	if tools.FileExists(t.Path) || !isLocalObjectStore(s) {
+		return nil
+	}
+
+	if chunks := localstorage.Chunks(); chunks != nil && chunks.Has(t.Oid, t.Size) {
+		tracerx.Printf("xfer: reassembling %q from its chunks to upload it", t.Oid)
+		return chunks.Reconstruct(t.Oid, t.Path)
+	}
+	if compressed := localstorage.Compressed(); compressed != nil && compressed.Has(t.Oid, t.Size) {
+		tracerx.Printf("xfer: decompressing %q to upload it", t.Oid)
+		return compressed.Decompress(t.Oid, t.Path)
+	}
+	return nil
+}
+
+func configureChunkedAdapter(m *Manifest) {
+	newfunc := func(name string, dir Direction) Adapter {
+		ca := &chunkedAdapter{newAdapterBase(name, dir, nil)}
+		// self implements impl
+		ca.transferImpl = ca
+		return ca
+	}
+	m.RegisterNewAdapterFunc(ChunkedAdapterName, Upload, newfunc)
+	m.RegisterNewAdapterFunc(ChunkedAdapterName, Download, newfunc)
+}
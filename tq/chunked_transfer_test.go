@@ -0,0 +1,32 @@
+package tq
+
+import (
+	"testing"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkHrefAppendsToPath(t *testing.T) {
+	href, err := chunkHref("https://example.com/chunked/abc?r=repo", "def")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/chunked/abc/chunks/def?r=repo", href)
+}
+
+func TestChunkHrefWithTrailingSlash(t *testing.T) {
+	href, err := chunkHref("https://example.com/objects/abc/", "def")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/objects/abc/chunks/def", href)
+}
+
+func TestChunkedAdapterOnlyWithChunkStore(t *testing.T) {
+	m := NewManifest()
+	assert.Equal(t, BasicAdapterName, m.NewUploadAdapter(ChunkedAdapterName).Name())
+
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{"lfs.chunkstore": "true"},
+	})
+	m = NewManifestWithGitEnv("", cfg.Git)
+	assert.Equal(t, ChunkedAdapterName, m.NewUploadAdapter(ChunkedAdapterName).Name())
+	assert.Equal(t, ChunkedAdapterName, m.NewDownloadAdapter(ChunkedAdapterName).Name())
+}
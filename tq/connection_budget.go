@@ -0,0 +1,76 @@
+package tq
+
+import (
+	"sync"
+
+	"github.com/rubyist/tracerx"
+)
+
+// ConnectionBudget limits how many requests the transfer queues sharing it
+// make to each host at once, counting both their batch API calls and their
+// transfers, so that queues running side by side, such as those which check
+// which objects the server has and those which upload them, neither exceed
+// the connections a server allows nor starve each other. Requests waiting for
+// a connection to a host get one in the order they asked.
+//
+// A nil *ConnectionBudget doesn't limit requests. It is safe to use from
+// multiple goroutines.
+type ConnectionBudget struct {
+	perHost int
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+// NewConnectionBudget returns a budget of the connections per host given by
+// the manifest's ConnectionsPerHost().
+func NewConnectionBudget(m *Manifest) *ConnectionBudget {
+	return &ConnectionBudget{
+		perHost: m.ConnectionsPerHost(),
+		hosts:   make(map[string]chan struct{}),
+	}
+}
+
+// Acquire waits until another request may be made to the given host.
+func (b *ConnectionBudget) Acquire(host string) {
+	if b == nil {
+		return
+	}
+
+	slots := b.slots(host)
+	select {
+	case slots <- struct{}{}:
+	default:
+		tracerx.Printf("tq: waiting for one of %d connection(s) to %s", b.perHost, host)
+		slots <- struct{}{}
+	}
+}
+
+// Release records that a request to the given host has finished.
+func (b *ConnectionBudget) Release(host string) {
+	if b == nil {
+		return
+	}
+	<-b.slots(host)
+}
+
+// slots returns the channel holding a value for each request being made to
+// the given host.
+func (b *ConnectionBudget) slots(host string) chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slots, ok := b.hosts[host]
+	if !ok {
+		slots = make(chan struct{}, b.perHost)
+		b.hosts[host] = slots
+	}
+	return slots
+}
+
+// ConnectionBudgeter is implemented by adapters whose transfers count against
+// a *ConnectionBudget. The TransferQueue sets its budget before calling
+// Begin().
+type ConnectionBudgeter interface {
+	SetConnectionBudget(b *ConnectionBudget)
+}
@@ -0,0 +1,53 @@
+package tq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionBudgetLimitsEachHost(t *testing.T) {
+	b := NewConnectionBudget(&Manifest{concurrentTransfers: 2})
+	b.Acquire("a.example.com")
+	b.Acquire("a.example.com")
+
+	// another host has a budget of its own
+	b.Acquire("b.example.com")
+
+	acquired := make(chan struct{})
+	go func() {
+		b.Acquire("a.example.com")
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("third connection to a.example.com was not limited")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.Release("a.example.com")
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("waiting connection to a.example.com was not let through")
+	}
+}
+
+func TestNilConnectionBudgetDoesNotLimit(t *testing.T) {
+	var b *ConnectionBudget
+	b.Acquire("a.example.com")
+	b.Release("a.example.com")
+}
+
+func TestManifestConnectionsPerHost(t *testing.T) {
+	m := &Manifest{concurrentTransfers: 3, maxConcurrency: 16}
+	assert.Equal(t, 3, m.ConnectionsPerHost())
+
+	m.adaptiveConcurrency = true
+	assert.Equal(t, 16, m.ConnectionsPerHost())
+
+	m.connectionsPerHost = 4
+	assert.Equal(t, 4, m.ConnectionsPerHost())
+}
@@ -6,16 +6,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/git-lfs/git-lfs/errors"
 	"github.com/git-lfs/git-lfs/tools"
 
 	"github.com/git-lfs/git-lfs/api"
-	"github.com/git-lfs/git-lfs/subprocess"
 	"github.com/rubyist/tracerx"
 
 	"github.com/git-lfs/git-lfs/config"
@@ -28,6 +29,58 @@ type customAdapter struct {
 	args                string
 	concurrent          bool
 	originalConcurrency int
+	sandbox             *customAdapterSandbox
+}
+
+// customAdapterSandbox restricts the processes of a custom adapter, so that
+// third-party adapters can be run safely, as configured under
+// "lfs.customtransfer.<name>".
+type customAdapterSandbox struct {
+	// timeout is how long to wait for each message from the process
+	// before taking it to have hung, or 0 to wait indefinitely.
+	timeout time.Duration
+	// restarts is how many times a process which has crashed or hung is
+	// restarted, retrying the transfer it was running.
+	restarts int
+	// cleanEnv restricts the environment of the process to a few
+	// essential variables and those named by passEnv.
+	cleanEnv bool
+	passEnv  []string
+	// workDir is the working directory of the process, or "" for the
+	// current one.
+	workDir string
+	// maxMemory and maxCPUTime limit the virtual memory and CPU time of
+	// the process, where supported, if not 0.
+	maxMemory  int64
+	maxCPUTime time.Duration
+}
+
+// customAdapterEnv are the environment variables custom adapters are run with
+// when their environment is restricted, as well as those they're given.
+var customAdapterEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "LANG", "LC_ALL", "TMPDIR",
+	"TEMP", "TMP", "SYSTEMROOT", "USERPROFILE",
+}
+
+// environ returns the given environment, restricted to the variables the
+// sandbox lets the process see.
+func (s *customAdapterSandbox) environ(env []string) []string {
+	if !s.cleanEnv {
+		return env
+	}
+
+	allowed := tools.NewStringSetFromSlice(customAdapterEnv)
+	for _, name := range s.passEnv {
+		allowed.Add(name)
+	}
+
+	restricted := make([]string, 0, len(allowed))
+	for _, kv := range env {
+		if name := strings.SplitN(kv, "=", 2)[0]; allowed.Contains(name) {
+			restricted = append(restricted, kv)
+		}
+	}
+	return restricted
 }
 
 // Struct to capture stderr and write to trace
@@ -59,6 +112,11 @@ type customAdapterWorkerContext struct {
 	bufferedOut *bufio.Reader
 	stdin       io.WriteCloser
 	errTracer   *traceWriter
+	// failed is set when communicating with the process fails, as when
+	// it has crashed or hung, and restarts counts the times it has been
+	// restarted since.
+	failed   bool
+	restarts int
 }
 
 type customAdapterInitRequest struct {
@@ -103,13 +161,19 @@ type customAdapterResponseMessage struct {
 	Path           string       `json:"path,omitempty"` // always blank for upload
 	BytesSoFar     int64        `json:"bytesSoFar"`
 	BytesSinceLast int          `json:"bytesSinceLast"`
+	// BytesCommitted is how many bytes the remote has acknowledged
+	// storing durably, which adapters may report on progress events.
+	BytesCommitted int64 `json:"bytesCommitted,omitempty"`
 }
 
 func (a *customAdapter) Begin(cfg AdapterConfig, cb ProgressCallback) error {
 	a.originalConcurrency = cfg.ConcurrentTransfers()
 	if a.concurrent {
-		// Use common workers impl, but downgrade workers to number of processes
-		return a.adapterBase.Begin(cfg, cb)
+		// Use common workers impl, but downgrade workers to number of
+		// processes, without tuning the number, so as not to start
+		// more processes than configured
+		newCfg := &Manifest{concurrentTransfers: a.originalConcurrency}
+		return a.adapterBase.Begin(newCfg, cb)
 	}
 
 	// If config says not to launch multiple processes, downgrade incoming value
@@ -126,15 +190,34 @@ func (a *customAdapter) WorkerStarting(workerNum int) (interface{}, error) {
 
 	// Start a process per worker
 	// If concurrent = false we have already dialled back workers to 1
-	tracerx.Printf("xfer: starting up custom transfer process %q for worker %d", a.name, workerNum)
-	cmd := subprocess.ExecCommand(a.path, a.args)
+	ctx := &customAdapterWorkerContext{workerNum: workerNum}
+	if err := a.startWorkerProcess(ctx); err != nil {
+		return nil, err
+	}
+
+	// Save this process context and use in future callbacks
+	return ctx, nil
+}
+
+// startWorkerProcess starts the custom adapter process of the given worker in
+// its sandbox, and initializes it.
+func (a *customAdapter) startWorkerProcess(ctx *customAdapterWorkerContext) error {
+	tracerx.Printf("xfer: starting up custom transfer process %q for worker %d", a.name, ctx.workerNum)
+	cmd := sandboxedCommand(a.path, a.args, a.sandbox)
+	cmd.Env = a.sandbox.environ(cmd.Env)
+	if len(a.sandbox.workDir) > 0 {
+		if err := os.MkdirAll(a.sandbox.workDir, 0755); err != nil {
+			return fmt.Errorf("Failed to create working directory for custom transfer command %q: %v", a.path, err)
+		}
+		cmd.Dir = a.sandbox.workDir
+	}
 	outp, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, fmt.Errorf("Failed to get stdout for custom transfer command %q remote: %v", a.path, err)
+		return fmt.Errorf("Failed to get stdout for custom transfer command %q remote: %v", a.path, err)
 	}
 	inp, err := cmd.StdinPipe()
 	if err != nil {
-		return nil, fmt.Errorf("Failed to get stdin for custom transfer command %q remote: %v", a.path, err)
+		return fmt.Errorf("Failed to get stdin for custom transfer command %q remote: %v", a.path, err)
 	}
 	// Capture stderr to trace
 	tracer := &traceWriter{}
@@ -142,27 +225,44 @@ func (a *customAdapter) WorkerStarting(workerNum int) (interface{}, error) {
 	cmd.Stderr = tracer
 	err = cmd.Start()
 	if err != nil {
-		return nil, fmt.Errorf("Failed to start custom transfer command %q remote: %v", a.path, err)
+		return fmt.Errorf("Failed to start custom transfer command %q remote: %v", a.path, err)
 	}
 	// Set up buffered reader/writer since we operate on lines
-	ctx := &customAdapterWorkerContext{workerNum, cmd, outp, bufio.NewReader(outp), inp, tracer}
+	ctx.cmd, ctx.stdout, ctx.bufferedOut, ctx.stdin, ctx.errTracer = cmd, outp, bufio.NewReader(outp), inp, tracer
+	ctx.failed = false
 
 	// send initiate message
 	initReq := NewCustomAdapterInitRequest(a.getOperationName(), a.concurrent, a.originalConcurrency)
 	resp, err := a.exchangeMessage(ctx, initReq)
 	if err != nil {
 		a.abortWorkerProcess(ctx)
-		return nil, err
+		return err
 	}
 	if resp.Error != nil {
 		a.abortWorkerProcess(ctx)
-		return nil, fmt.Errorf("Error initializing custom adapter %q worker %d: %v", a.name, workerNum, resp.Error)
+		return fmt.Errorf("Error initializing custom adapter %q worker %d: %v", a.name, ctx.workerNum, resp.Error)
 	}
 
-	tracerx.Printf("xfer: started custom adapter process %q for worker %d OK", a.path, workerNum)
+	tracerx.Printf("xfer: started custom adapter process %q for worker %d OK", a.path, ctx.workerNum)
+	return nil
+}
 
-	// Save this process context and use in future callbacks
-	return ctx, nil
+// restartWorkerProcess replaces the custom adapter process of the given
+// worker, which has crashed or hung, returning false if it has been restarted
+// as many times as it may be already, or can't be.
+func (a *customAdapter) restartWorkerProcess(ctx *customAdapterWorkerContext, cause error) bool {
+	if ctx.restarts >= a.sandbox.restarts {
+		return false
+	}
+	ctx.restarts++
+
+	tracerx.Printf("xfer: restarting custom adapter process %q for worker %d (%d of %d) after: %v", a.path, ctx.workerNum, ctx.restarts, a.sandbox.restarts, cause)
+	a.abortWorkerProcess(ctx)
+	if err := a.startWorkerProcess(ctx); err != nil {
+		tracerx.Printf("xfer: unable to restart custom adapter process %q for worker %d: %v", a.path, ctx.workerNum, err)
+		return false
+	}
+	return true
 }
 
 func (a *customAdapter) getOperationName() string {
@@ -181,13 +281,16 @@ func (a *customAdapter) sendMessage(ctx *customAdapterWorkerContext, req interfa
 	tracerx.Printf("xfer: Custom adapter worker %d sending message: %v", ctx.workerNum, string(b))
 	// Line oriented JSON
 	b = append(b, '\n')
-	_, err = ctx.stdin.Write(b)
+	if _, err = ctx.stdin.Write(b); err != nil {
+		ctx.failed = true
+	}
 	return err
 }
 
 func (a *customAdapter) readResponse(ctx *customAdapterWorkerContext) (*customAdapterResponseMessage, error) {
-	line, err := ctx.bufferedOut.ReadString('\n')
+	line, err := a.readLine(ctx)
 	if err != nil {
+		ctx.failed = true
 		return nil, err
 	}
 	tracerx.Printf("xfer: Custom adapter worker %d received response: %v", ctx.workerNum, strings.TrimSpace(line))
@@ -196,6 +299,33 @@ func (a *customAdapter) readResponse(ctx *customAdapterWorkerContext) (*customAd
 	return resp, err
 }
 
+// readLine reads a line from the process, killing it if nothing is read within
+// the sandbox's timeout.
+func (a *customAdapter) readLine(ctx *customAdapterWorkerContext) (string, error) {
+	if a.sandbox.timeout <= 0 {
+		return ctx.bufferedOut.ReadString('\n')
+	}
+
+	type result struct {
+		line string
+		err  error
+	}
+	// buffered, so that the read can finish once the process is killed
+	resultChan := make(chan result, 1)
+	go func(r *bufio.Reader) {
+		line, err := r.ReadString('\n')
+		resultChan <- result{line, err}
+	}(ctx.bufferedOut)
+
+	select {
+	case res := <-resultChan:
+		return res.line, res.err
+	case <-time.After(a.sandbox.timeout):
+		a.abortWorkerProcess(ctx)
+		return "", fmt.Errorf("Custom adapter %q worker %d sent nothing for %v", a.name, ctx.workerNum, a.sandbox.timeout)
+	}
+}
+
 // exchangeMessage sends a message to a process and reads a response if resp != nil
 // Only fatal errors to communicate return an error, errors may be embedded in reply
 func (a *customAdapter) exchangeMessage(ctx *customAdapterWorkerContext, req interface{}) (*customAdapterResponseMessage, error) {
@@ -239,6 +369,7 @@ func (a *customAdapter) abortWorkerProcess(ctx *customAdapterWorkerContext) {
 	ctx.stdin.Close()
 	ctx.stdout.Close()
 	ctx.cmd.Process.Kill()
+	ctx.cmd.Wait()
 }
 func (a *customAdapter) WorkerEnding(workerNum int, ctx interface{}) {
 	customCtx, ok := ctx.(*customAdapterWorkerContext)
@@ -263,6 +394,16 @@ func (a *customAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressCall
 	if !ok {
 		return fmt.Errorf("Context object for custom transfer %q was of the wrong type", a.name)
 	}
+
+	err := a.doTransfer(customCtx, t, cb, authOkFunc)
+	if err != nil && customCtx.failed && a.restartWorkerProcess(customCtx, err) {
+		// the transfer is retried with the new process
+		return errors.NewRetriableError(err)
+	}
+	return err
+}
+
+func (a *customAdapter) doTransfer(customCtx *customAdapterWorkerContext, t *Transfer, cb ProgressCallback, authOkFunc func()) error {
 	var authCalled bool
 
 	rel, err := t.Actions.Get(a.getOperationName())
@@ -272,6 +413,9 @@ func (a *customAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressCall
 	}
 	var req *customAdapterTransferRequest
 	if a.direction == Upload {
+		if err := ensureWholeObject(a.objects(), t); err != nil {
+			return err
+		}
 		req = NewCustomAdapterUploadRequest(t.Oid, t.Size, t.Path, rel)
 	} else {
 		req = NewCustomAdapterDownloadRequest(t.Oid, t.Size, rel)
@@ -297,6 +441,9 @@ func (a *customAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressCall
 			if cb != nil {
 				cb(t.Name, t.Size, resp.BytesSoFar, resp.BytesSinceLast)
 			}
+			if resp.BytesCommitted > 0 {
+				a.commit(t, resp.BytesCommitted)
+			}
 			wasAuthOk = resp.BytesSoFar > 0
 		case "complete":
 			// Download/Upload complete
@@ -315,9 +462,12 @@ func (a *customAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressCall
 				if err = tools.RenameFileCopyPermissions(resp.Path, t.Path); err != nil {
 					return fmt.Errorf("Failed to copy downloaded file: %v", err)
 				}
+				if err = a.objects().ProtectObject(t.Path); err != nil {
+					return fmt.Errorf("Failed to make downloaded file read-only: %v", err)
+				}
 			} else if a.direction == Upload {
-				if err = api.VerifyUpload(config.Config, toApiObject(t)); err != nil {
-					return err
+				if err = api.VerifyUpload(a.config(), toApiObject(t)); err != nil {
+					return newVerifyError(err)
 				}
 			}
 			wasAuthOk = true
@@ -336,8 +486,8 @@ func (a *customAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressCall
 	return nil
 }
 
-func newCustomAdapter(name string, dir Direction, path, args string, concurrent bool) *customAdapter {
-	c := &customAdapter{newAdapterBase(name, dir, nil), path, args, concurrent, 3}
+func newCustomAdapter(name string, dir Direction, path, args string, concurrent bool, sandbox *customAdapterSandbox) *customAdapter {
+	c := &customAdapter{newAdapterBase(name, dir, nil), path, args, concurrent, 3, sandbox}
 	// self implements impl
 	c.transferImpl = c
 	return c
@@ -364,9 +514,11 @@ func configureCustomAdapters(git Env, m *Manifest) {
 			direction = strings.ToLower(direction)
 		}
 
+		sandbox := configureCustomAdapterSandbox(git, name)
+
 		// Separate closure for each since we need to capture vars above
 		newfunc := func(name string, dir Direction) Adapter {
-			return newCustomAdapter(name, dir, path, args, concurrent)
+			return newCustomAdapter(name, dir, path, args, concurrent, sandbox)
 		}
 
 		if direction == "download" || direction == "both" {
@@ -377,3 +529,43 @@ func configureCustomAdapters(git Env, m *Manifest) {
 		}
 	}
 }
+
+// configureCustomAdapterSandbox returns the restrictions on the processes of
+// the named custom adapter, as configured under "lfs.customtransfer.<name>".
+func configureCustomAdapterSandbox(git Env, name string) *customAdapterSandbox {
+	key := func(setting string) string {
+		return fmt.Sprintf("lfs.customtransfer.%s.%s", name, setting)
+	}
+
+	sandbox := &customAdapterSandbox{
+		timeout:    time.Duration(git.Int(key("timeout"), 0)) * time.Second,
+		restarts:   git.Int(key("restarts"), 3),
+		cleanEnv:   git.Bool(key("cleanenv"), false),
+		maxCPUTime: time.Duration(git.Int(key("maxcputime"), 0)) * time.Second,
+	}
+
+	if passEnv, ok := git.Get(key("passenv")); ok {
+		for _, name := range strings.Split(passEnv, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				sandbox.passEnv = append(sandbox.passEnv, name)
+			}
+		}
+	}
+
+	if workDir, ok := git.Get(key("workdir")); ok && len(workDir) > 0 {
+		if !filepath.IsAbs(workDir) {
+			workDir = filepath.Join(config.LocalGitStorageDir, "lfs", workDir)
+		}
+		sandbox.workDir = workDir
+	}
+
+	if maxMemory, ok := git.Get(key("maxmemory")); ok {
+		size, err := config.ParseSize(maxMemory)
+		if err != nil {
+			tracerx.Printf("xfer: ignoring invalid %s %q", key("maxmemory"), maxMemory)
+		}
+		sandbox.maxMemory = size
+	}
+
+	return sandbox
+}
@@ -0,0 +1,33 @@
+// +build !windows
+
+package tq
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/rubyist/tracerx"
+)
+
+// sandboxedCommand returns the command running the custom adapter at the given
+// path, by way of a shell which limits its virtual memory and CPU time with
+// ulimit if the sandbox does.
+func sandboxedCommand(path, args string, sandbox *customAdapterSandbox) *exec.Cmd {
+	var limits []string
+	if sandbox.maxMemory > 0 {
+		// in kilobytes, rounded up
+		limits = append(limits, fmt.Sprintf("ulimit -v %d", (sandbox.maxMemory+1023)/1024))
+	}
+	if sandbox.maxCPUTime > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -t %d", int64(sandbox.maxCPUTime.Seconds()+0.5)))
+	}
+	if len(limits) == 0 {
+		return subprocess.ExecCommand(path, args)
+	}
+
+	script := strings.Join(append(limits, `exec "$@"`), " && ")
+	tracerx.Printf("xfer: limiting the resources of custom adapter %q with %q", path, script)
+	return subprocess.ExecCommand("/bin/sh", "-c", script, "git-lfs-custom-transfer", path, args)
+}
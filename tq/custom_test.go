@@ -2,6 +2,7 @@ package tq
 
 import (
 	"testing"
+	"time"
 
 	"github.com/git-lfs/git-lfs/config"
 	"github.com/stretchr/testify/assert"
@@ -114,3 +115,51 @@ func TestCustomTransferBothConfig(t *testing.T) {
 	assert.Equal(t, cu.args, args, "args should be correct")
 	assert.Equal(t, cu.concurrent, true, "concurrent should be set")
 }
+
+func TestCustomTransferSandboxConfig(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.customtransfer.testsandbox.path":       "/path/to/binary",
+			"lfs.customtransfer.testsandbox.timeout":    "30",
+			"lfs.customtransfer.testsandbox.restarts":   "1",
+			"lfs.customtransfer.testsandbox.cleanenv":   "true",
+			"lfs.customtransfer.testsandbox.passenv":    "AWS_PROFILE, ,HTTPS_PROXY",
+			"lfs.customtransfer.testsandbox.workdir":    "/tmp/adapter",
+			"lfs.customtransfer.testsandbox.maxmemory":  "512m",
+			"lfs.customtransfer.testsandbox.maxcputime": "600",
+		},
+	})
+
+	m := NewManifestWithGitEnv("", cfg.Git)
+	cu, _ := m.NewUploadAdapter("testsandbox").(*customAdapter)
+	if assert.NotNil(t, cu, "Upload adapter should be customAdapter") {
+		assert.Equal(t, &customAdapterSandbox{
+			timeout:    30 * time.Second,
+			restarts:   1,
+			cleanEnv:   true,
+			passEnv:    []string{"AWS_PROFILE", "HTTPS_PROXY"},
+			workDir:    "/tmp/adapter",
+			maxMemory:  512 << 20,
+			maxCPUTime: 600 * time.Second,
+		}, cu.sandbox)
+	}
+
+	cfg = config.NewFrom(config.Values{
+		Git: map[string]string{"lfs.customtransfer.testdefault.path": "/path/to/binary"},
+	})
+	m = NewManifestWithGitEnv("", cfg.Git)
+	cu, _ = m.NewUploadAdapter("testdefault").(*customAdapter)
+	if assert.NotNil(t, cu, "Upload adapter should be customAdapter") {
+		assert.Equal(t, &customAdapterSandbox{restarts: 3}, cu.sandbox)
+	}
+}
+
+func TestCustomAdapterSandboxEnviron(t *testing.T) {
+	env := []string{"PATH=/bin", "HOME=/home/me", "AWS_SECRET=shh", "AWS_PROFILE=ci", "GIT_DIR=.git"}
+
+	s := &customAdapterSandbox{}
+	assert.Equal(t, env, s.environ(env))
+
+	s = &customAdapterSandbox{cleanEnv: true, passEnv: []string{"AWS_PROFILE"}}
+	assert.Equal(t, []string{"PATH=/bin", "HOME=/home/me", "AWS_PROFILE=ci"}, s.environ(env))
+}
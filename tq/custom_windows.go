@@ -0,0 +1,19 @@
+// +build windows
+
+package tq
+
+import (
+	"os/exec"
+
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/rubyist/tracerx"
+)
+
+// sandboxedCommand returns the command running the custom adapter at the given
+// path. Its memory and CPU time can't be limited on Windows.
+func sandboxedCommand(path, args string, sandbox *customAdapterSandbox) *exec.Cmd {
+	if sandbox.maxMemory > 0 || sandbox.maxCPUTime > 0 {
+		tracerx.Printf("xfer: not limiting the resources of custom adapter %q, as this isn't supported on Windows", path)
+	}
+	return subprocess.ExecCommand(path, args)
+}
@@ -0,0 +1,119 @@
+package tq
+
+import (
+	"io"
+	"time"
+
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	// diskThrottleWindow is how often a diskThrottle decides whether to
+	// change how many downloads it lets run at once.
+	diskThrottleWindow = time.Second
+	// diskThrottleBusy is the share of the downloads' time spent waiting
+	// for writes to disk over which the disk is taken to be what holds them
+	// back, and one fewer is let run at once.
+	diskThrottleBusy = 0.5
+	// diskThrottleIdle is the share under which the disk is taken to keep
+	// up, and one more is let run at once, up to the configured number.
+	diskThrottleIdle = 0.1
+)
+
+// diskThrottle limits how many workers of a download adapter transfer at once
+// when writing the objects to disk, rather than downloading them, is what holds
+// the transfers back, as on a slow hard disk. Running fewer then lets the disk
+// catch up, rather than having every worker's writes queue behind each other's.
+// It times the writes made through Writer() and, every diskThrottleWindow,
+// lets one fewer worker run if they spent more than diskThrottleBusy of their
+// time writing, or one more, up to the configured concurrency, if they spent
+// less than diskThrottleIdle.
+//
+// A nil *diskThrottle lets every worker run. It is safe to use from multiple
+// goroutines.
+type diskThrottle struct {
+	workerLimit
+
+	// max is the configured concurrency.
+	max int
+
+	// windowStart is when the current window started, and writing the
+	// time spent writing during it.
+	windowStart time.Time
+	writing     time.Duration
+
+	now func() time.Time
+}
+
+// newDiskThrottle returns a throttle letting up to max workers run at once.
+func newDiskThrottle(max int) *diskThrottle {
+	d := &diskThrottle{max: max, now: time.Now}
+	d.init(max)
+	d.windowStart = d.now()
+	return d
+}
+
+// Acquire waits until another worker may start a transfer.
+func (d *diskThrottle) Acquire() {
+	if d != nil {
+		d.acquire()
+	}
+}
+
+// Release records that a worker has finished its transfer.
+func (d *diskThrottle) Release() {
+	if d != nil {
+		d.release()
+	}
+}
+
+// Writer returns a writer which writes to w, timing each write.
+func (d *diskThrottle) Writer(w io.Writer) io.Writer {
+	if d == nil {
+		return w
+	}
+	return &throttledWriter{w: w, d: d}
+}
+
+// record records that a write took the given time, and changes the limit if
+// the current window is over.
+func (d *diskThrottle) record(took time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.writing += took
+
+	now := d.now()
+	elapsed := now.Sub(d.windowStart)
+	if elapsed < diskThrottleWindow {
+		return
+	}
+
+	busy := float64(d.writing) / (float64(elapsed) * float64(tools.MaxInt(d.active, 1)))
+	switch {
+	case busy > diskThrottleBusy && d.limit > 1:
+		d.limit--
+		tracerx.Printf("xfer: disk is the bottleneck (%.0f%% of the time spent writing), downloading %d object(s) at a time", busy*100, d.limit)
+	case busy < diskThrottleIdle && d.limit < d.max:
+		d.limit++
+		tracerx.Printf("xfer: disk is keeping up (%.0f%% of the time spent writing), downloading %d object(s) at a time", busy*100, d.limit)
+		d.cond.Signal()
+	}
+
+	d.windowStart = now
+	d.writing = 0
+}
+
+// throttledWriter times the writes to w for its diskThrottle.
+type throttledWriter struct {
+	w io.Writer
+	d *diskThrottle
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	start := w.d.now()
+	n, err := w.w.Write(p)
+	w.d.record(w.d.now().Sub(start))
+	return n, err
+}
@@ -0,0 +1,101 @@
+package tq
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowWriter is a writer whose writes take the given time by the clock of a
+// diskThrottle, which it advances.
+type slowWriter struct {
+	bytes.Buffer
+	clock *time.Time
+	took  time.Duration
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	*w.clock = w.clock.Add(w.took)
+	return w.Buffer.Write(p)
+}
+
+func newTestDiskThrottle(max int, clock *time.Time) *diskThrottle {
+	d := newDiskThrottle(max)
+	d.now = func() time.Time { return *clock }
+	d.windowStart = *clock
+	return d
+}
+
+func TestDiskThrottleLimitsWorkersWhileDiskIsBusy(t *testing.T) {
+	clock := time.Unix(0, 0)
+	d := newTestDiskThrottle(3, &clock)
+	d.Acquire()
+	d.Acquire()
+
+	// both workers spend most of the window writing
+	d.record(diskThrottleWindow * 9 / 10)
+	clock = clock.Add(diskThrottleWindow)
+	d.record(diskThrottleWindow * 9 / 10)
+	assert.Equal(t, 2, d.limit)
+
+	clock = clock.Add(diskThrottleWindow)
+	d.record(2 * diskThrottleWindow)
+	assert.Equal(t, 1, d.limit)
+
+	// never fewer than one
+	clock = clock.Add(diskThrottleWindow)
+	d.record(2 * diskThrottleWindow)
+	assert.Equal(t, 1, d.limit)
+}
+
+func TestDiskThrottleTimesWrites(t *testing.T) {
+	clock := time.Unix(0, 0)
+	d := newTestDiskThrottle(3, &clock)
+	d.Acquire()
+
+	w := &slowWriter{clock: &clock, took: diskThrottleWindow}
+	n, err := d.Writer(w).Write([]byte("slow"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, "slow", w.String())
+	assert.Equal(t, 2, d.limit)
+}
+
+func TestDiskThrottleLetsWorkersRunWhileDiskKeepsUp(t *testing.T) {
+	clock := time.Unix(0, 0)
+	d := newTestDiskThrottle(3, &clock)
+	d.limit = 1
+	d.Acquire()
+
+	clock = clock.Add(diskThrottleWindow)
+	d.record(0)
+	assert.Equal(t, 2, d.limit)
+
+	acquired := make(chan struct{})
+	go func() {
+		d.Acquire()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second worker was not let run")
+	}
+
+	clock = clock.Add(diskThrottleWindow)
+	d.record(0)
+	clock = clock.Add(diskThrottleWindow)
+	d.record(0)
+	assert.Equal(t, 3, d.limit)
+}
+
+func TestNilDiskThrottleDoesNotLimit(t *testing.T) {
+	var d *diskThrottle
+	d.Acquire()
+	d.Release()
+
+	var buf bytes.Buffer
+	assert.Equal(t, &buf, d.Writer(&buf))
+}
@@ -0,0 +1,112 @@
+package tq
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/api"
+	"github.com/git-lfs/git-lfs/errors"
+)
+
+// TransferError is an error transferring a single object, with the context
+// needed to report it. The errors of a *TransferQueue which concern an object
+// are *TransferErrors.
+type TransferError struct {
+	Oid string
+	// Name is the name of the file in the repository, and Path is where
+	// it is, or would be, on disk.
+	Name string
+	Path string
+	// Action is "upload" or "download", or "verify" if the object was
+	// uploaded but the server couldn't verify it.
+	Action string
+	// StatusCode is the HTTP status of the response which the transfer
+	// failed with, or 0 if there wasn't one.
+	StatusCode int
+	// Host is the host the transfer failed against, or the empty string
+	// if it isn't known, such as when the batch API call failed.
+	Host string
+	// Retries holds the errors of the earlier attempts to transfer the
+	// object, oldest first.
+	Retries []error
+	// Err is the error of the last attempt.
+	Err error
+}
+
+func (e *TransferError) Error() string {
+	return e.Err.Error()
+}
+
+// Cause returns the error of the last attempt, so that errors.IsFatalError and
+// the like see through the *TransferError.
+func (e *TransferError) Cause() error {
+	return e.Err
+}
+
+// withStatus records the HTTP status of res in the context of err, which must
+// be one of the errors package's, so that the *TransferError it ends up in has
+// it. It returns err.
+func withStatus(err error, res *http.Response) error {
+	if res != nil && res.StatusCode > 0 {
+		errors.SetContext(err, "Status", res.Status)
+	}
+	return err
+}
+
+// verifyError wraps an error verifying an object with the server after it was
+// uploaded.
+type verifyError struct {
+	error
+}
+
+func (e verifyError) Cause() error {
+	return e.error
+}
+
+// newVerifyError returns err, marked as an error verifying an upload, or nil
+// if err is nil.
+func newVerifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return verifyError{err}
+}
+
+// isVerifyError returns whether err, or any error it wraps, is an error
+// verifying an upload.
+func isVerifyError(err error) bool {
+	for err != nil {
+		if _, ok := err.(verifyError); ok {
+			return true
+		}
+		err = causeOf(err)
+	}
+	return false
+}
+
+// statusCodeOf returns the HTTP status code of the response given by err, or
+// any error it wraps, or 0 if none was given.
+func statusCodeOf(err error) int {
+	for err != nil {
+		if e, ok := err.(*api.ObjectError); ok {
+			return e.Code
+		}
+		if status, ok := errors.GetContext(err, "Status").(string); ok && len(status) > 0 {
+			if code, err := strconv.Atoi(strings.Fields(status)[0]); err == nil {
+				return code
+			}
+		}
+		err = causeOf(err)
+	}
+	return 0
+}
+
+func causeOf(err error) error {
+	if c, ok := err.(interface {
+		Cause() error
+	}); ok {
+		return c.Cause()
+	}
+	return nil
+}
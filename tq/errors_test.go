@@ -0,0 +1,51 @@
+package tq
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/api"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusCodeOfBatchObjectError(t *testing.T) {
+	oerr := &api.ObjectError{Code: 404, Message: "Object does not exist"}
+	err := errors.Wrapf(oerr, "[%v] %v", "abc", oerr.Message)
+
+	assert.Equal(t, 404, statusCodeOf(err))
+}
+
+func TestStatusCodeOfResponseError(t *testing.T) {
+	err := errors.Wrap(errors.New("forbidden"), "http")
+	errors.SetContext(err, "Status", "403 Forbidden")
+
+	assert.Equal(t, 403, statusCodeOf(errors.NewRetriableError(err)))
+}
+
+func TestStatusCodeOfErrorWithoutResponse(t *testing.T) {
+	assert.Equal(t, 0, statusCodeOf(errors.New("connection refused")))
+}
+
+func TestVerifyErrorIsFoundThroughWrappers(t *testing.T) {
+	err := errors.NewRetriableError(newVerifyError(errors.New("verify failed")))
+
+	assert.True(t, isVerifyError(err))
+	assert.False(t, isVerifyError(errors.New("upload failed")))
+	assert.Nil(t, newVerifyError(nil))
+}
+
+func TestTransferErrorSeesThroughToItsCause(t *testing.T) {
+	err := &TransferError{Oid: "abc", Err: errors.NewFatalError(errors.New("boom"))}
+
+	assert.Equal(t, err.Err.Error(), err.Error())
+	assert.True(t, errors.IsFatalError(err))
+}
+
+func TestWithStatusIsReadBack(t *testing.T) {
+	res := &http.Response{StatusCode: 422, Status: "422 Unprocessable Entity"}
+	err := withStatus(errors.NewRetriableError(errors.New("client error")), res)
+
+	assert.Equal(t, 422, statusCodeOf(err))
+	assert.True(t, errors.IsRetriableError(err))
+}
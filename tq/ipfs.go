@@ -0,0 +1,369 @@
+package tq
+
+import (
+	"bytes"
+	"context"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/git-lfs/git-lfs/api"
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/httputil"
+	"github.com/git-lfs/git-lfs/progress"
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	IpfsAdapterName = "ipfs"
+)
+
+var (
+	// ipfsCidEncoding encodes the content identifiers of objects in their
+	// canonical form, following the "b" multibase prefix.
+	ipfsCidEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+	// ipfsCids are the content identifiers of the objects whose pointers
+	// have been read, by oid.
+	ipfsCids   = make(map[string]string)
+	ipfsCidsMu sync.Mutex
+)
+
+// RememberIpfsCid records the content identifier which the pointer of the
+// object with the given oid gives, which the object is downloaded from IPFS
+// by, as it can't be derived from the oid.
+func RememberIpfsCid(oid, cid string) {
+	ipfsCidsMu.Lock()
+	defer ipfsCidsMu.Unlock()
+
+	ipfsCids[oid] = cid
+}
+
+func rememberedIpfsCid(oid string) (string, bool) {
+	ipfsCidsMu.Lock()
+	defer ipfsCidsMu.Unlock()
+
+	cid, ok := ipfsCids[oid]
+	return cid, ok
+}
+
+// Adapter for transfers to and from an IPFS node, such as one of a private
+// cluster, through its RPC API, as given by an ipfs+http(s):// URL. Objects
+// are added as files are by "ipfs add", as UnixFS DAGs of raw leaves, so that
+// any IPFS node or gateway can serve them however large they are. Their root
+// content identifiers are recorded in their pointers, which they're
+// downloaded by. There's no batch API to ask, so the transfer queue makes up
+// the batch responses with ipfsBatch, and this adapter is never offered to
+// servers.
+//
+// Downloads are made from the gateway given by lfs.ipfs.gateway, if any, as
+// basic ones, and otherwise from the node. Either way, the content is checked
+// against the oid. Nodes and gateways are asked without Git credentials, which
+// would be prompted for; APIs which need them have them in their URLs.
+type ipfsAdapter struct {
+	*adapterBase
+	download *basicDownloadAdapter
+}
+
+func (a *ipfsAdapter) ClearTempStorage() error {
+	// Downloads from gateways are kept with the basic adapter's, which
+	// clears them; those from the node aren't resumed.
+	return nil
+}
+
+func (a *ipfsAdapter) WorkerStarting(workerNum int) (interface{}, error) {
+	return nil, nil
+}
+func (a *ipfsAdapter) WorkerEnding(workerNum int, ctx interface{}) {
+}
+
+func (a *ipfsAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressCallback, authOkFunc func()) error {
+	rel, err := t.Actions.Get(a.direction.String())
+	if err != nil {
+		return err
+	}
+
+	node, cid, err := ipfsSplitHref(rel.Href)
+	if err != nil {
+		return err
+	}
+
+	if a.direction == Upload {
+		return a.upload(t, node, cid, cb, authOkFunc)
+	}
+
+	if gateway := a.config().IpfsGateway(); len(gateway) > 0 {
+		// Marked as authenticated, so that the basic adapter doesn't
+		// ask for credentials.
+		gt := *t
+		gt.Authenticated = true
+		gt.Actions = ActionSet{"download": &Action{
+			Href: fmt.Sprintf("%s/ipfs/%s", gateway, cid),
+		}}
+		return a.download.DoTransfer(ctx, &gt, cb, authOkFunc)
+	}
+	return a.get(t, node, cid, cb, authOkFunc)
+}
+
+// HasObject tells whether the IPFS node at the given URL stores the object of
+// the given size, without looking for it elsewhere in the network.
+func (a *ipfsAdapter) HasObject(href string, size int64) (bool, error) {
+	node, cid, err := ipfsSplitHref(href)
+	if err != nil || len(cid) == 0 {
+		return false, err
+	}
+
+	stored, err := ipfsStat(a.context(), a.config(), node, cid)
+	return stored == size, err
+}
+
+// upload adds t's object to the node, unless it has it. Objects whose content
+// identifiers aren't known already, as no pointer of theirs has been read, are
+// identified by their contents.
+func (a *ipfsAdapter) upload(t *Transfer, node, cid string, cb ProgressCallback, authOkFunc func()) error {
+	if err := ensureWholeObject(a.objects(), t); err != nil {
+		return errors.Wrap(err, "ipfs upload")
+	}
+	if len(cid) == 0 {
+		var err error
+		if cid, err = IpfsFileCid(t.Path); err != nil {
+			return errors.Wrap(err, "ipfs upload")
+		}
+	}
+
+	stored, err := ipfsStat(a.context(), a.config(), node, cid)
+	if err != nil {
+		return err
+	}
+	if stored == t.Size {
+		tracerx.Printf("xfer: %q is on the IPFS node already as %s, skipping", t.Oid, cid)
+		advanceCallbackProgress(cb, t, t.Size)
+		if authOkFunc != nil {
+			authOkFunc()
+		}
+		return nil
+	}
+
+	f, err := os.OpenFile(t.Path, os.O_RDONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "ipfs upload")
+	}
+	defer f.Close()
+
+	// The object is sent as the one file of a multipart form, streamed
+	// between the headers of its part and the closing boundary.
+	var head bytes.Buffer
+	mw := multipart.NewWriter(&head)
+	if _, err := mw.CreateFormFile("data", t.Oid); err != nil {
+		return errors.Wrap(err, "ipfs upload")
+	}
+	tail := fmt.Sprintf("\r\n--%s--\r\n", mw.Boundary())
+
+	ccb := func(totalSize int64, readSoFar int64, readSinceLast int) error {
+		if cb != nil {
+			return cb(t.Name, totalSize, readSoFar, readSinceLast)
+		}
+		return nil
+	}
+	var reader io.Reader
+	reader = &progress.CallbackReader{
+		C:         ccb,
+		TotalSize: t.Size,
+		Reader:    f,
+	}
+
+	// Signal auth was ok on first read; this frees up other workers to start
+	if authOkFunc != nil {
+		reader = newStartCallbackReader(reader, func(*startCallbackReader) {
+			authOkFunc()
+		})
+	}
+
+	// These are the defaults of "ipfs add --cid-version=1", given in case
+	// the node is configured otherwise, as IpfsDag expects them.
+	query := url.Values{
+		"cid-version": {"1"},
+		"raw-leaves":  {"true"},
+		"chunker":     {fmt.Sprintf("size-%d", ipfsChunkSize)},
+		"hash":        {"sha2-256"},
+		"progress":    {"false"},
+		"pin":         {fmt.Sprintf("%t", a.config().IpfsPin())},
+	}
+	req, err := a.newRequest("POST", node+"/api/v0/add?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.ContentLength = int64(head.Len()) + t.Size + int64(len(tail))
+	req.Body = ioutil.NopCloser(io.MultiReader(&head, reader, strings.NewReader(tail)))
+
+	res, err := httputil.DoHttpRequest(a.config(), req, false)
+	if err != nil {
+		if _, ok := errors.IsRetriableLaterError(err); ok {
+			return err
+		}
+		return withStatus(errors.NewRetriableError(err), res)
+	}
+	httputil.LogTransfer(a.config(), "lfs.data.upload", res)
+	defer res.Body.Close()
+
+	// Each file added is reported on a line of its own, the last one being
+	// the root of the DAG.
+	var added struct {
+		Hash string
+	}
+	dec := json.NewDecoder(res.Body)
+	for dec.More() {
+		if err := dec.Decode(&added); err != nil {
+			return errors.Wrapf(err, "Unable to parse IPFS response for %s", httputil.TraceHttpReq(req))
+		}
+	}
+	if added.Hash != cid {
+		return errors.Errorf("Git LFS: IPFS stored %s as %s, expected %s", t.Oid, added.Hash, cid)
+	}
+	return nil
+}
+
+// get downloads t's object from the node, checks it, and moves it to t.Path.
+func (a *ipfsAdapter) get(t *Transfer, node, cid string, cb ProgressCallback, authOkFunc func()) error {
+	req, err := a.newRequest("POST", node+"/api/v0/cat?arg="+cid, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := httputil.DoHttpRequest(a.config(), req, false)
+	if err != nil {
+		if _, ok := errors.IsRetriableLaterError(err); ok {
+			return err
+		}
+		return withStatus(errors.NewRetriableError(err), res)
+	}
+	httputil.LogTransfer(a.config(), "lfs.data.download", res)
+	defer res.Body.Close()
+
+	if authOkFunc != nil {
+		authOkFunc()
+	}
+
+	f, err := a.objects().TempFile(t.Oid)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	ccb := func(totalSize int64, readSoFar int64, readSinceLast int) error {
+		if cb != nil {
+			return cb(t.Name, totalSize, readSoFar, readSinceLast)
+		}
+		return nil
+	}
+	hash := tools.NewLfsContentHash()
+	_, err = tools.CopyWithCallback(io.MultiWriter(f, hash), res.Body, t.Size, ccb)
+	f.Close()
+	if err != nil {
+		return errors.NewRetriableError(errors.Wrapf(err, "cannot write data to tempfile %q", f.Name()))
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != t.Oid {
+		return errors.NewCorruptObjectError(fmt.Errorf("Expected OID %s, got %s from IPFS file %s", t.Oid, actual, cid), t.Oid)
+	}
+
+	if err := tools.RenameFileCopyPermissions(f.Name(), t.Path); err != nil {
+		return err
+	}
+	return a.objects().ProtectObject(t.Path)
+}
+
+// ipfsStat returns the size of the file with the given content identifier on
+// the node, or -1 if the node doesn't have all of it. Only the node itself is
+// asked, as looking for the file in the network may take as long as
+// downloading it. It is asked as configured by cfg, until ctx is done.
+func ipfsStat(ctx context.Context, cfg *config.Configuration, node, cid string) (int64, error) {
+	query := url.Values{
+		"arg":        {"/ipfs/" + cid},
+		"with-local": {"true"},
+		"offline":    {"true"},
+	}
+	req, err := httputil.NewHttpRequestContext(ctx, "POST", node+"/api/v0/files/stat?"+query.Encode(), nil)
+	if err != nil {
+		return -1, err
+	}
+
+	res, err := httputil.DoHttpRequest(cfg, req, false)
+	if err != nil {
+		if res != nil && res.StatusCode == 500 && strings.Contains(err.Error(), "not found") {
+			return -1, nil
+		}
+		if _, ok := errors.IsRetriableLaterError(err); ok {
+			return -1, err
+		}
+		return -1, withStatus(errors.NewRetriableError(err), res)
+	}
+	defer res.Body.Close()
+
+	var stat struct {
+		Size  int64
+		Local bool
+	}
+	if err := json.NewDecoder(res.Body).Decode(&stat); err != nil {
+		return -1, errors.Wrapf(err, "Unable to parse IPFS response for %s", httputil.TraceHttpReq(req))
+	}
+	if !stat.Local {
+		return -1, nil
+	}
+	return stat.Size, nil
+}
+
+// ipfsSplitHref returns the URL of the RPC API of the node, and the content
+// identifier, if known, from the href ipfsBatch made up for an object.
+func ipfsSplitHref(href string) (node, cid string, err error) {
+	i := strings.LastIndex(href, "/ipfs/")
+	if i < 0 {
+		return "", "", errors.Errorf("Git LFS: invalid IPFS URL %q", href)
+	}
+	return href[:i], href[i+len("/ipfs/"):], nil
+}
+
+// ipfsBatch makes up the response of a batch API request for objects stored
+// at an ipfs+http(s):// endpoint, which has no Git LFS server to send it to:
+// each object is to be transferred by the IPFS adapter, to or from the node
+// the endpoint's API belongs to, by the content identifier its pointer gives.
+// Objects whose pointers give none can't be downloaded, but are identified by
+// their contents when uploaded. Uploads skip objects which the node has
+// already.
+func ipfsBatch(endpoint config.Endpoint, objects []*api.ObjectResource, kind string) []*api.ObjectResource {
+	node := strings.TrimSuffix(endpoint.IpfsUrl(), "/")
+	for _, o := range objects {
+		cid, ok := rememberedIpfsCid(o.Oid)
+		if !ok && kind == "download" {
+			o.Error = &api.ObjectError{Code: 404, Message: "Object has no IPFS content identifier in its pointer"}
+			continue
+		}
+		o.Actions = map[string]*api.LinkRelation{
+			kind: &api.LinkRelation{Href: fmt.Sprintf("%s/ipfs/%s", node, cid)},
+		}
+	}
+	return objects
+}
+
+func configureIpfsAdapter(m *Manifest) {
+	newfunc := func(name string, dir Direction) Adapter {
+		ia := &ipfsAdapter{adapterBase: newAdapterBase(name, dir, nil)}
+		ia.download = &basicDownloadAdapter{ia.adapterBase}
+		// self implements impl
+		ia.transferImpl = ia
+		return ia
+	}
+	m.RegisterNewAdapterFunc(IpfsAdapterName, Upload, newfunc)
+	m.RegisterNewAdapterFunc(IpfsAdapterName, Download, newfunc)
+}
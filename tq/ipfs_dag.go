@@ -0,0 +1,174 @@
+package tq
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+const (
+	// ipfsChunkSize is the size of the chunks which "ipfs add" splits files
+	// into by default.
+	ipfsChunkSize = 256 * 1024
+
+	// ipfsMaxLinks is the most children a node of the balanced DAG which
+	// "ipfs add" builds over the chunks of a file has.
+	ipfsMaxLinks = 174
+
+	// ipfsCodecRaw and ipfsCodecDagPb are the multicodecs of the raw
+	// leaves and of the UnixFS nodes above them.
+	ipfsCodecRaw   = 0x55
+	ipfsCodecDagPb = 0x70
+)
+
+// ipfsNode is a node of the DAG of a file, as its parent links to it.
+type ipfsNode struct {
+	cid []byte
+	// tsize is the size of the node and all those below it.
+	tsize uint64
+	// filesize is the number of bytes of the file below the node.
+	filesize uint64
+}
+
+// IpfsDag builds the UnixFS DAG which "ipfs add --cid-version=1" stores the
+// contents written to it as, with the default chunker and balanced layout, to
+// find its root content identifier without asking a node. The leaves are raw
+// blocks, and only their content identifiers are kept, so that the contents
+// of large files needn't fit in memory.
+type IpfsDag struct {
+	chunk  []byte
+	leaves []*ipfsNode
+}
+
+func NewIpfsDag() *IpfsDag {
+	return &IpfsDag{chunk: make([]byte, 0, ipfsChunkSize)}
+}
+
+func (d *IpfsDag) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		size := ipfsChunkSize - len(d.chunk)
+		if size > len(p) {
+			size = len(p)
+		}
+		d.chunk = append(d.chunk, p[:size]...)
+		p = p[size:]
+
+		if len(d.chunk) == ipfsChunkSize {
+			d.leaves = append(d.leaves, ipfsLeaf(d.chunk))
+			d.chunk = d.chunk[:0]
+		}
+	}
+	return n, nil
+}
+
+// Cid returns the content identifier of the root of the DAG of everything
+// written so far. A file of a single chunk is stored as that raw leaf alone.
+func (d *IpfsDag) Cid() string {
+	nodes := d.leaves
+	if len(d.chunk) > 0 || len(nodes) == 0 {
+		nodes = append(nodes[:len(nodes):len(nodes)], ipfsLeaf(d.chunk))
+	}
+
+	for len(nodes) > 1 {
+		var parents []*ipfsNode
+		for len(nodes) > 0 {
+			n := ipfsMaxLinks
+			if n > len(nodes) {
+				n = len(nodes)
+			}
+			parents = append(parents, ipfsFileNode(nodes[:n]))
+			nodes = nodes[n:]
+		}
+		nodes = parents
+	}
+	return ipfsCidString(nodes[0].cid)
+}
+
+// IpfsFileCid returns the content identifier which "ipfs add" stores the file
+// at the given path as.
+func IpfsFileCid(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	dag := NewIpfsDag()
+	if _, err := io.Copy(dag, f); err != nil {
+		return "", err
+	}
+	return dag.Cid(), nil
+}
+
+// ipfsLeaf returns the raw leaf holding the given chunk.
+func ipfsLeaf(chunk []byte) *ipfsNode {
+	return &ipfsNode{
+		cid:      ipfsBinaryCid(ipfsCodecRaw, chunk),
+		tsize:    uint64(len(chunk)),
+		filesize: uint64(len(chunk)),
+	}
+}
+
+// ipfsFileNode returns the UnixFS file node linking to the given children, as
+// the dag-pb codec encodes it: its links first, each with an empty name, and
+// then its UnixFS data, giving the size of the file below each child.
+func ipfsFileNode(children []*ipfsNode) *ipfsNode {
+	var data, node []byte
+	var filesize, tsize uint64
+
+	for _, child := range children {
+		filesize += child.filesize
+	}
+	data = ipfsAppendVarintField(data, 1, 2) // Type: File
+	data = ipfsAppendVarintField(data, 3, filesize)
+	for _, child := range children {
+		data = ipfsAppendVarintField(data, 4, child.filesize)
+	}
+
+	for _, child := range children {
+		var link []byte
+		link = ipfsAppendBytesField(link, 1, child.cid)
+		link = ipfsAppendBytesField(link, 2, nil)
+		link = ipfsAppendVarintField(link, 3, child.tsize)
+		node = ipfsAppendBytesField(node, 2, link)
+		tsize += child.tsize
+	}
+	node = ipfsAppendBytesField(node, 1, data)
+
+	return &ipfsNode{
+		cid:      ipfsBinaryCid(ipfsCodecDagPb, node),
+		tsize:    tsize + uint64(len(node)),
+		filesize: filesize,
+	}
+}
+
+// ipfsBinaryCid returns the binary form of the version 1 content identifier
+// of the given block, with the given codec and a sha2-256 multihash.
+func ipfsBinaryCid(codec byte, block []byte) []byte {
+	sum := sha256.Sum256(block)
+	return append([]byte{0x01, codec, 0x12, 0x20}, sum[:]...)
+}
+
+// ipfsCidString returns the canonical form of the given binary content
+// identifier, following the "b" multibase prefix.
+func ipfsCidString(cid []byte) string {
+	return "b" + ipfsCidEncoding.EncodeToString(cid)
+}
+
+func ipfsAppendVarintField(buf []byte, field int, v uint64) []byte {
+	buf = ipfsAppendVarint(buf, uint64(field<<3))
+	return ipfsAppendVarint(buf, v)
+}
+
+func ipfsAppendBytesField(buf []byte, field int, v []byte) []byte {
+	buf = ipfsAppendVarint(buf, uint64(field<<3|2))
+	buf = ipfsAppendVarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
+
+func ipfsAppendVarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], v)]...)
+}
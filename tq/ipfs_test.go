@@ -0,0 +1,188 @@
+package tq
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/api"
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIpfsDagCid(t *testing.T) {
+	// a file of one chunk is a raw leaf, whose multihash is its oid
+	dag := NewIpfsDag()
+	assert.Equal(t, "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku", dag.Cid())
+
+	contents := bytes.Repeat([]byte("0123456789abcdef"), ipfsChunkSize/8+1)
+	for _, size := range []int{1, ipfsChunkSize, ipfsChunkSize + 1, len(contents)} {
+		dag = NewIpfsDag()
+		dag.Write(contents[:size])
+		cid := dag.Cid()
+		if size <= ipfsChunkSize {
+			assert.Equal(t, ipfsCidString(ipfsBinaryCid(ipfsCodecRaw, contents[:size])), cid, "size %d", size)
+		} else {
+			assert.True(t, strings.HasPrefix(cid, "bafybei"), "size %d: %s", size, cid)
+		}
+
+		// the same contents written piecemeal give the same DAG
+		dag = NewIpfsDag()
+		for i := 0; i < size; i += 1000 {
+			end := i + 1000
+			if end > size {
+				end = size
+			}
+			dag.Write(contents[i:end])
+		}
+		assert.Equal(t, cid, dag.Cid(), "size %d", size)
+	}
+}
+
+func TestIpfsFileNode(t *testing.T) {
+	a := ipfsLeaf([]byte("a"))
+	b := ipfsLeaf([]byte("bc"))
+	node := ipfsFileNode([]*ipfsNode{a, b})
+
+	var encoded []byte
+	for _, child := range []*ipfsNode{a, b} {
+		encoded = append(encoded, 0x12, 42, 0x0a, 36)
+		encoded = append(encoded, child.cid...)
+		encoded = append(encoded, 0x12, 0, 0x18, byte(child.tsize))
+	}
+	encoded = append(encoded, 0x0a, 8, 0x08, 2, 0x18, 3, 0x20, 1, 0x20, 2)
+
+	assert.Equal(t, ipfsBinaryCid(ipfsCodecDagPb, encoded), node.cid)
+	assert.Equal(t, uint64(3), node.filesize)
+	assert.Equal(t, uint64(len(encoded)+3), node.tsize)
+}
+
+func TestIpfsBatchAddressesObjectsByCid(t *testing.T) {
+	oid := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	RememberIpfsCid(oid, "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku")
+	objs := ipfsBatch(config.NewEndpoint("ipfs+http://127.0.0.1:5001/"), []*api.ObjectResource{{Oid: oid}, {Oid: "abc"}}, "download")
+
+	href := objs[0].Actions["download"].Href
+	assert.Equal(t, "http://127.0.0.1:5001/ipfs/bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku", href)
+	// objects whose pointers give no CID can't be found
+	assert.Equal(t, 404, objs[1].Error.Code)
+
+	node, cid, err := ipfsSplitHref(href)
+	assert.Nil(t, err)
+	assert.Equal(t, "http://127.0.0.1:5001", node)
+	assert.Equal(t, "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku", cid)
+
+	// but can be uploaded, as their CIDs are found from their contents
+	objs = ipfsBatch(config.NewEndpoint("ipfs+http://127.0.0.1:5001/"), []*api.ObjectResource{{Oid: "abc"}}, "upload")
+	assert.Equal(t, "http://127.0.0.1:5001/ipfs/", objs[0].Actions["upload"].Href)
+}
+
+// fakeIpfsNode serves the parts of the RPC API of an IPFS node which the IPFS
+// adapter uses, keeping files in memory by their root CIDs.
+type fakeIpfsNode struct {
+	files map[string][]byte
+	adds  int
+}
+
+func (n *fakeIpfsNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cid := r.URL.Query().Get("arg")
+	switch r.URL.Path {
+	case "/api/v0/add":
+		f, _, err := r.FormFile("data")
+		if err != nil || r.URL.Query().Get("raw-leaves") != "true" {
+			w.WriteHeader(400)
+			return
+		}
+		by, _ := ioutil.ReadAll(f)
+		dag := NewIpfsDag()
+		dag.Write(by)
+		cid = dag.Cid()
+		n.files[cid] = by
+		n.adds++
+		json.NewEncoder(w).Encode(map[string]interface{}{"Name": "data", "Hash": cid, "Size": fmt.Sprintf("%d", len(by))})
+	case "/api/v0/files/stat":
+		by, ok := n.files[strings.TrimPrefix(cid, "/ipfs/")]
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(500)
+			w.Write([]byte(`{"Message":"block was not found locally (offline)","Code":0,"Type":"error"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"Hash": cid, "Size": len(by), "Local": true})
+	case "/api/v0/cat":
+		w.Write(n.files[cid])
+	default:
+		w.WriteHeader(404)
+	}
+}
+
+func TestIpfsUploadAndDownload(t *testing.T) {
+	node := &fakeIpfsNode{files: make(map[string][]byte)}
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "ipfs")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	contents := "ipfs contents"
+	oid := fmt.Sprintf("%x", sha256.Sum256([]byte(contents)))
+	size := int64(len(contents))
+	path := filepath.Join(dir, oid)
+	require.Nil(t, ioutil.WriteFile(path, []byte(contents), 0644))
+
+	m := NewManifest()
+	endpoint := config.NewEndpoint("ipfs+" + srv.URL)
+
+	cid, err := IpfsFileCid(path)
+	require.Nil(t, err)
+	href := srv.URL + "/ipfs/" + cid
+
+	// the CID of an object whose pointer hasn't been read is found from
+	// its contents
+	up := m.NewUploadAdapter(IpfsAdapterName).(*ipfsAdapter)
+	objs := ipfsBatch(endpoint, []*api.ObjectResource{{Oid: oid, Size: size}}, "upload")
+
+	has, err := up.HasObject(href, size)
+	assert.Nil(t, err)
+	assert.False(t, has)
+
+	for i := 0; i < 2; i++ {
+		tr := newTransfer("a.dat", objs[0], path)
+		require.Nil(t, up.DoTransfer(nil, tr, nil, nil))
+	}
+	// the second upload found the file on the node
+	assert.Equal(t, 1, node.adds)
+
+	has, err = up.HasObject(href, size)
+	assert.Nil(t, err)
+	assert.True(t, has)
+
+	RememberIpfsCid(oid, cid)
+
+	down := m.NewDownloadAdapter(IpfsAdapterName).(*ipfsAdapter)
+	objs = ipfsBatch(endpoint, []*api.ObjectResource{{Oid: oid, Size: size}}, "download")
+	tr := newTransfer("a.dat", objs[0], filepath.Join(dir, "downloaded"))
+	require.Nil(t, down.DoTransfer(nil, tr, nil, nil))
+	by, err := ioutil.ReadFile(tr.Path)
+	assert.Nil(t, err)
+	assert.Equal(t, contents, string(by))
+
+	// downloads are checked against the oid
+	node.files[cid] = []byte("other contents")
+	tr = newTransfer("a.dat", objs[0], filepath.Join(dir, "corrupt"))
+	err = down.DoTransfer(nil, tr, nil, nil)
+	assert.True(t, errors.IsCorruptObjectError(err))
+	_, err = os.Stat(tr.Path)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,392 @@
+package tq
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	journalBegin  = "begin"
+	journalAdd    = "add"
+	journalRetry  = "retry"
+	journalCommit = "commit"
+	journalDone   = "done"
+)
+
+// journalRecord is a single line of a journal file.
+type journalRecord struct {
+	Op        string `json:"op"`
+	Direction string `json:"direction,omitempty"`
+	Remote    string `json:"remote,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Oid       string `json:"oid,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	Committed int64  `json:"committed,omitempty"`
+}
+
+// JournalEntry is an object recorded in a journal.
+type JournalEntry struct {
+	Name, Path, Oid string
+	Size            int64
+	// Remote is the remote the object is to be transferred to or from.
+	Remote string
+	// Retries is the number of times the transfer has been retried.
+	Retries int
+	// Committed is how many bytes of the object the remote acknowledged
+	// storing durably, if its adapter reports that.
+	Committed int64
+	// Done is true once the object has been transferred.
+	Done bool
+}
+
+// JournalState is the contents of a journal, as read by ReadJournal.
+type JournalState struct {
+	Direction Direction
+	// Remote is the remote given when the journal was last created. Entries
+	// carried over from before then may have others.
+	Remote string
+	// Entries are the objects added to the queue, in the order they were
+	// first added.
+	Entries []*JournalEntry
+}
+
+// Pending returns the entries which have not been transferred yet.
+func (s *JournalState) Pending() []*JournalEntry {
+	pending := make([]*JournalEntry, 0, len(s.Entries))
+	for _, e := range s.Entries {
+		if !e.Done {
+			pending = append(pending, e)
+		}
+	}
+	return pending
+}
+
+// Journal persists the contents of a *TransferQueue to disk as it runs: each
+// object added, retried or transferred is appended to the journal file as a
+// line of JSON, as is the progress the remote acknowledged committing for
+// adapters which report it. If the process is interrupted, or some transfers
+// fail, the objects which were not transferred can be read back with
+// ReadJournal and queued again.
+//
+// Several processes may append to the same journal file at once, such as a
+// push run while another is running in the background. Each holds a shared
+// lock on it while it does, and it's only compacted or removed by a process
+// holding an exclusive one, so that none of them go on appending to a file
+// which has been replaced.
+//
+// A Journal is safe to use from multiple goroutines.
+type Journal struct {
+	path string
+	// remote is the remote the objects added to the journal are to be
+	// transferred to or from.
+	remote string
+
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+	// pending are the OIDs of the objects in the journal which have not
+	// been transferred yet.
+	pending map[string]bool
+
+	// retries are the retry counts carried over from a previous journal,
+	// keyed by OID.
+	retries map[string]int
+}
+
+// CreateJournal opens the journal at the given path for a queue transferring
+// objects in the given direction to or from the named remote.
+//
+// If no other process has the journal open, the objects still pending in it,
+// left by a queue which was interrupted or had failures, are kept, along with
+// the remote they are to be transferred to or from, their retry counts and
+// their committed progress, so that a queue which is run again before the
+// journal is resumed doesn't lose them, nor retry them any more often than an
+// uninterrupted one would have. The journal is compacted to those objects, and
+// then appended to. Otherwise, it is appended to as it is, once the process
+// which opened it first has compacted it.
+func CreateJournal(path string, dir Direction, remote string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrap(err, "create journal dir")
+	}
+
+	f, exclusive, err := openJournal(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "create journal")
+	}
+
+	j := &Journal{
+		path:    path,
+		remote:  remote,
+		f:       f,
+		enc:     json.NewEncoder(f),
+		pending: make(map[string]bool),
+		retries: make(map[string]int),
+	}
+	if !exclusive {
+		return j, nil
+	}
+
+	var previous []*JournalEntry
+	state, err := readJournal(f)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "read journal")
+	}
+	if state.Direction == dir {
+		previous = state.Pending()
+	}
+
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "create journal")
+	}
+	j.write(&journalRecord{Op: journalBegin, Direction: dir.String(), Remote: remote})
+	for _, e := range previous {
+		j.replay(e)
+	}
+
+	// other processes may append to the journal once it's compacted.
+	if _, err := tools.LockFile(f, false, true); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "create journal")
+	}
+	return j, nil
+}
+
+// openJournal opens the journal file at path to be appended to, with an
+// exclusive lock on it if no other process has it open, returning true, and
+// otherwise with a shared one.
+func openJournal(path string) (*os.File, bool, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, false, err
+		}
+
+		exclusive, err := tools.LockFile(f, true, false)
+		if err == nil && !exclusive {
+			_, err = tools.LockFile(f, false, true)
+		}
+		if err != nil {
+			f.Close()
+			return nil, false, err
+		}
+
+		// the process which held the lock may have removed the
+		// journal since it was opened.
+		if tools.SameFile(path, f) {
+			return f, exclusive, nil
+		}
+		f.Close()
+	}
+}
+
+// replay writes the records of the pending entry e, carried over from a
+// previous journal, to j.
+func (j *Journal) replay(e *JournalEntry) {
+	j.write(&journalRecord{Op: journalAdd, Name: e.Name, Path: e.Path, Oid: e.Oid, Size: e.Size, Remote: e.Remote})
+	j.pending[e.Oid] = true
+
+	for i := 0; i < e.Retries; i++ {
+		j.retry(e.Oid)
+	}
+	j.retries[e.Oid] = e.Retries
+
+	if e.Committed > 0 {
+		j.commit(e.Oid, e.Committed)
+	}
+}
+
+// ReadJournal reads the journal at the given path. It returns an error
+// satisfying os.IsNotExist if there is no journal.
+func ReadJournal(path string) (*JournalState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readJournal(f)
+}
+
+func readJournal(r io.Reader) (*JournalState, error) {
+	state := &JournalState{}
+	// entries are those of each OID, the last one added last; an object
+	// may have several names, such as in the retry file of a fetch.
+	entries := make(map[string][]*JournalEntry)
+	last := func(oid string) *JournalEntry {
+		if es := entries[oid]; len(es) > 0 {
+			return es[len(es)-1]
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		var rec journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// the last line may have been cut short when the
+			// process was killed; anything before it is intact.
+			tracerx.Printf("tq: ignoring invalid journal line %d: %s", line, err)
+			continue
+		}
+
+		switch rec.Op {
+		case journalBegin:
+			dir, err := parseDirection(rec.Direction)
+			if err != nil {
+				return nil, err
+			}
+			state.Direction = dir
+			state.Remote = rec.Remote
+		case journalAdd:
+			remote := rec.Remote
+			if len(remote) == 0 {
+				remote = state.Remote
+			}
+
+			// an object carried over from a previous journal is
+			// added again when it is queued again, keeping its
+			// retries and committed progress.
+			var e *JournalEntry
+			for i, existing := range entries[rec.Oid] {
+				if existing.Name == rec.Name {
+					e = existing
+					es := append(entries[rec.Oid][:i:i], entries[rec.Oid][i+1:]...)
+					entries[rec.Oid] = append(es, e)
+					break
+				}
+			}
+			if e == nil {
+				e = &JournalEntry{Oid: rec.Oid, Name: rec.Name}
+				entries[rec.Oid] = append(entries[rec.Oid], e)
+				state.Entries = append(state.Entries, e)
+			}
+			e.Path, e.Size, e.Remote = rec.Path, rec.Size, remote
+			e.Done = false
+		case journalRetry:
+			if e := last(rec.Oid); e != nil {
+				e.Retries++
+			}
+		case journalCommit:
+			if e := last(rec.Oid); e != nil && rec.Committed > e.Committed {
+				e.Committed = rec.Committed
+			}
+		case journalDone:
+			for _, e := range entries[rec.Oid] {
+				e.Done = true
+			}
+		}
+	}
+
+	return state, scanner.Err()
+}
+
+// Path returns the path of the journal file.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Close closes the journal file, leaving it on disk.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.f.Close()
+}
+
+// Remove closes and deletes the journal file, once there is nothing left in it
+// to resume. It's left on disk if another process still has it open, or if
+// objects another process added to it are still pending.
+func (j *Journal) Remove() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if exclusive, err := tools.LockFile(j.f, true, false); err != nil || !exclusive {
+		j.f.Close()
+		return err
+	}
+	if _, err := j.f.Seek(0, io.SeekStart); err != nil {
+		j.f.Close()
+		return err
+	}
+	if state, err := readJournal(j.f); err != nil || len(state.Pending()) > 0 {
+		j.f.Close()
+		return err
+	}
+	return tools.CloseAndRemove(j.f, j.path)
+}
+
+// Finish closes the journal file, and deletes it if every object in it has
+// been transferred, or leaves it on disk to be resumed otherwise.
+func (j *Journal) Finish() error {
+	j.mu.Lock()
+	pending := len(j.pending)
+	j.mu.Unlock()
+
+	if pending > 0 {
+		return j.Close()
+	}
+	return j.Remove()
+}
+
+// Add records an object as waiting to be transferred without adding it to a
+// *TransferQueue, such as when objects are queued to be pushed while offline.
+func (j *Journal) Add(name, path, oid string, size int64) {
+	j.add(&objectTuple{Name: name, Path: path, Oid: oid, Size: size})
+}
+
+func (j *Journal) add(t *objectTuple) {
+	j.write(&journalRecord{Op: journalAdd, Name: t.Name, Path: t.Path, Oid: t.Oid, Size: t.Size, Remote: j.remote})
+
+	j.mu.Lock()
+	j.pending[t.Oid] = true
+	j.mu.Unlock()
+}
+
+func (j *Journal) retry(oid string) {
+	j.write(&journalRecord{Op: journalRetry, Oid: oid})
+}
+
+func (j *Journal) commit(oid string, committed int64) {
+	j.write(&journalRecord{Op: journalCommit, Oid: oid, Committed: committed})
+}
+
+func (j *Journal) done(oid string) {
+	j.write(&journalRecord{Op: journalDone, Oid: oid})
+
+	j.mu.Lock()
+	delete(j.pending, oid)
+	j.mu.Unlock()
+}
+
+// write appends rec to the journal. Failing to record progress must not stop
+// the transfers themselves, so errors are only traced.
+func (j *Journal) write(rec *journalRecord) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.enc.Encode(rec); err != nil {
+		tracerx.Printf("tq: unable to write journal %s: %s", j.path, err)
+	}
+}
+
+func parseDirection(s string) (Direction, error) {
+	switch s {
+	case "upload":
+		return Upload, nil
+	case "download":
+		return Download, nil
+	}
+	return Upload, fmt.Errorf("tq: unknown journal direction %q", s)
+}
@@ -0,0 +1,193 @@
+package tq
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/progress"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalRecordsPendingObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tq-journal")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "journal", "upload")
+	j, err := CreateJournal(path, Upload, "origin")
+	assert.Nil(t, err)
+
+	j.add(&objectTuple{Name: "a.dat", Path: "/a", Oid: "a", Size: 1})
+	j.add(&objectTuple{Name: "b.dat", Path: "/b", Oid: "b", Size: 2})
+	j.retry("a")
+	j.done("b")
+	assert.Nil(t, j.Close())
+
+	state, err := ReadJournal(path)
+	assert.Nil(t, err)
+	assert.Equal(t, Upload, state.Direction)
+	assert.Equal(t, "origin", state.Remote)
+	assert.Equal(t, []*JournalEntry{
+		{Name: "a.dat", Path: "/a", Oid: "a", Size: 1, Remote: "origin", Retries: 1},
+	}, state.Pending())
+
+	j, err = CreateJournal(path, Upload, "origin")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"a": 1}, j.retries)
+	j.done("a")
+	assert.Nil(t, j.Finish())
+
+	_, err = ReadJournal(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestJournalAddQueuesObjectsWithoutAQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tq-journal")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "queue", "origin")
+	j, err := CreateJournal(path, Upload, "origin")
+	assert.Nil(t, err)
+	j.Add("a.dat", "/a", "a", 1)
+	assert.Nil(t, j.Close())
+
+	state, err := ReadJournal(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []*JournalEntry{
+		{Name: "a.dat", Path: "/a", Oid: "a", Size: 1, Remote: "origin"},
+	}, state.Pending())
+}
+
+func TestReadJournalIgnoresTruncatedLine(t *testing.T) {
+	state, err := readJournal(strings.NewReader(
+		`{"op":"begin","direction":"download","remote":"origin"}` + "\n" +
+			`{"op":"add","name":"a.dat","oid":"a","size":1}` + "\n" +
+			`{"op":"do`))
+
+	assert.Nil(t, err)
+	assert.Equal(t, Download, state.Direction)
+	if assert.Len(t, state.Pending(), 1) {
+		assert.Equal(t, "a", state.Pending()[0].Oid)
+	}
+}
+
+func TestReadJournalRejectsUnknownDirection(t *testing.T) {
+	_, err := readJournal(strings.NewReader(`{"op":"begin","direction":"sideways"}` + "\n"))
+	assert.NotNil(t, err)
+}
+
+func TestJournalRecordsCommittedProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tq-journal")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "journal", "upload")
+	j, err := CreateJournal(path, Upload, "origin")
+	assert.Nil(t, err)
+
+	q := &TransferQueue{
+		trMutex:   &sync.Mutex{},
+		committed: make(map[string]int64),
+		meter:     progress.Noop(),
+		journal:   j,
+	}
+	j.add(&objectTuple{Name: "a.dat", Path: "/a", Oid: "a", Size: 10})
+	q.commit("a.dat", "a", 10, 4)
+	q.commit("a.dat", "a", 10, 2)
+	assert.Nil(t, j.Close())
+
+	state, err := ReadJournal(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []*JournalEntry{
+		{Name: "a.dat", Path: "/a", Oid: "a", Size: 10, Remote: "origin", Committed: 4},
+	}, state.Pending())
+	assert.Equal(t, map[string]int64{"a": 4}, q.committed)
+
+	j, err = CreateJournal(path, Upload, "origin")
+	assert.Nil(t, err)
+	j.add(&objectTuple{Name: "a.dat", Path: "/a", Oid: "a", Size: 10})
+	assert.Nil(t, j.Close())
+
+	state, err = ReadJournal(path)
+	assert.Nil(t, err)
+	if assert.Len(t, state.Pending(), 1) {
+		assert.Equal(t, int64(4), state.Pending()[0].Committed)
+	}
+}
+
+func TestCreateJournalKeepsPendingObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tq-journal")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "journal", "download")
+	j, err := CreateJournal(path, Download, "origin")
+	assert.Nil(t, err)
+	j.add(&objectTuple{Name: "a.dat", Path: "/a", Oid: "a", Size: 1})
+	j.add(&objectTuple{Name: "b.dat", Path: "/b", Oid: "b", Size: 2})
+	j.retry("a")
+	j.done("b")
+	assert.Nil(t, j.Finish())
+
+	j, err = CreateJournal(path, Download, "mirror")
+	assert.Nil(t, err)
+	j.add(&objectTuple{Name: "c.dat", Path: "/c", Oid: "c", Size: 3})
+	j.done("c")
+	assert.Nil(t, j.Finish())
+
+	state, err := ReadJournal(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "mirror", state.Remote)
+	assert.Equal(t, []*JournalEntry{
+		{Name: "a.dat", Path: "/a", Oid: "a", Size: 1, Remote: "origin", Retries: 1},
+	}, state.Pending())
+
+	j, err = CreateJournal(path, Download, "origin")
+	assert.Nil(t, err)
+	j.add(&objectTuple{Name: "a.dat", Path: "/a", Oid: "a", Size: 1})
+	j.done("a")
+	assert.Nil(t, j.Finish())
+
+	_, err = ReadJournal(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestJournalSharedByAnotherQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tq-journal")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "journal", "download")
+	first, err := CreateJournal(path, Download, "origin")
+	assert.Nil(t, err)
+	first.add(&objectTuple{Name: "a.dat", Path: "/a", Oid: "a", Size: 1})
+
+	// a second queue appends to the journal rather than replacing it
+	second, err := CreateJournal(path, Download, "mirror")
+	assert.Nil(t, err)
+	second.add(&objectTuple{Name: "b.dat", Path: "/b", Oid: "b", Size: 2})
+	first.add(&objectTuple{Name: "c.dat", Path: "/c", Oid: "c", Size: 3})
+
+	first.done("a")
+	first.done("c")
+	assert.Nil(t, first.Finish())
+
+	// the journal is still open, with an object pending
+	state, err := ReadJournal(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "origin", state.Remote)
+	assert.Equal(t, []*JournalEntry{
+		{Name: "b.dat", Path: "/b", Oid: "b", Size: 2, Remote: "mirror"},
+	}, state.Pending())
+
+	second.done("b")
+	assert.Nil(t, second.Finish())
+
+	_, err = ReadJournal(path)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -3,75 +3,220 @@ package tq
 import (
 	"sync"
 
+	"github.com/git-lfs/git-lfs/config"
 	"github.com/rubyist/tracerx"
 )
 
 const (
 	defaultMaxRetries          = 1
+	defaultMaxRateLimitRetries = 10
 	defaultConcurrentTransfers = 3
+	defaultMinConcurrency      = 1
+	defaultMaxConcurrency      = 16
 )
 
 type Manifest struct {
 	// MaxRetries is the maximum number of retries a single object can
 	// attempt to make before it will be dropped.
 	maxRetries           int
+	maxRateLimitRetries  int
 	concurrentTransfers  int
+	diskBackpressure     bool
+	adaptiveConcurrency  bool
+	minConcurrency       int
+	maxConcurrency       int
+	connectionsPerHost   int
 	basicTransfersOnly   bool
 	tusTransfersAllowed  bool
+	ntlm                 bool
 	downloadAdapterFuncs map[string]NewAdapterFunc
 	uploadAdapterFuncs   map[string]NewAdapterFunc
-	mu                   sync.Mutex
+	// cfg is the configuration the manifest was built from, which the
+	// transfer queues and adapters using it read, or nil for that of the
+	// current process.
+	cfg *config.Configuration
+	// objects is where downloaded objects are written, or nil for the
+	// local storage of the current repository.
+	objects ObjectStore
+	mu      sync.Mutex
 }
 
 func (m *Manifest) MaxRetries() int {
 	return m.maxRetries
 }
 
+// MaxRateLimitRetries returns the most times an object is retried once the
+// server allows it after rate limiting it, given by
+// lfs.transfer.maxratelimitretries.
+func (m *Manifest) MaxRateLimitRetries() int {
+	return m.maxRateLimitRetries
+}
+
 func (m *Manifest) ConcurrentTransfers() int {
 	return m.concurrentTransfers
 }
 
+// DiskBackpressure returns whether lfs.transfer.diskbackpressure is set, as it
+// is by default.
+func (m *Manifest) DiskBackpressure() bool {
+	return m.diskBackpressure
+}
+
+// ConcurrencyBounds returns the fewest and the most transfers to run at once,
+// between which lfs.transfer.adaptiveconcurrency tunes the number by the
+// observed throughput, starting from ConcurrentTransfers(). Both are
+// ConcurrentTransfers() when the number isn't tuned.
+func (m *Manifest) ConcurrencyBounds() (int, int) {
+	if !m.adaptiveConcurrency {
+		return m.concurrentTransfers, m.concurrentTransfers
+	}
+	return m.minConcurrency, m.maxConcurrency
+}
+
+// ConnectionsPerHost returns the most requests the transfer queues sharing a
+// ConnectionBudget make to each host at once, given by
+// lfs.transfer.maxconnectionsperhost, or by default the most transfers run at
+// once.
+func (m *Manifest) ConnectionsPerHost() int {
+	if m.connectionsPerHost > 0 {
+		return m.connectionsPerHost
+	}
+	_, max := m.ConcurrencyBounds()
+	return max
+}
+
 func NewManifest() *Manifest {
 	return NewManifestWithGitEnv("", nil)
 }
 
+// NewManifestWithConfig builds a Manifest from the given configuration, which
+// the transfer queues and adapters using it read in place of that of the
+// current process, so that a program can transfer the objects of several
+// repositories at once.
+func NewManifestWithConfig(cfg *config.Configuration) *Manifest {
+	m := NewManifestWithGitEnv(cfg.Access("download"), cfg.Git)
+	m.cfg = cfg
+	return m
+}
+
+// Config returns the configuration the manifest was built from by
+// NewManifestWithConfig, or else that of the current process.
+func (m *Manifest) Config() *config.Configuration {
+	if m == nil || m.cfg == nil {
+		return config.Config
+	}
+	return m.cfg
+}
+
+// ObjectStore returns where the adapters the manifest creates write the
+// objects they download: the local storage of the current repository, unless
+// SetObjectStore replaced it.
+func (m *Manifest) ObjectStore() ObjectStore {
+	if m == nil || m.objects == nil {
+		return localObjectStore{}
+	}
+	return m.objects
+}
+
+// SetObjectStore replaces where the adapters the manifest creates from then on
+// write the objects they download.
+func (m *Manifest) SetObjectStore(s ObjectStore) {
+	m.objects = s
+}
+
 func NewManifestWithGitEnv(access string, git Env) *Manifest {
 	m := &Manifest{
 		downloadAdapterFuncs: make(map[string]NewAdapterFunc),
 		uploadAdapterFuncs:   make(map[string]NewAdapterFunc),
+		diskBackpressure:     true,
 	}
 
-	var tusAllowed bool
+	var tusAllowed, chunkedAllowed, metalinkAllowed bool
 	if git != nil {
 		if v := git.Int("lfs.transfer.maxretries", 0); v > 0 {
 			m.maxRetries = v
 		}
+		if v := git.Int("lfs.transfer.maxratelimitretries", 0); v > 0 {
+			m.maxRateLimitRetries = v
+		}
 		if v := git.Int("lfs.concurrenttransfers", 0); v > 0 {
 			m.concurrentTransfers = v
 		}
 		m.basicTransfersOnly = git.Bool("lfs.basictransfersonly", false)
+		m.diskBackpressure = git.Bool("lfs.transfer.diskbackpressure", true)
+		m.adaptiveConcurrency = git.Bool("lfs.transfer.adaptiveconcurrency", false)
+		m.minConcurrency = git.Int("lfs.transfer.minconcurrency", defaultMinConcurrency)
+		m.maxConcurrency = git.Int("lfs.transfer.maxconcurrency", defaultMaxConcurrency)
+		m.connectionsPerHost = git.Int("lfs.transfer.maxconnectionsperhost", 0)
 		tusAllowed = git.Bool("lfs.tustransfers", false)
+		chunkedAllowed = git.Bool("lfs.chunkstore", false)
+		metalinkAllowed = git.Bool("lfs.metalinktransfers", false)
 		configureCustomAdapters(git, m)
 	}
 
 	if m.maxRetries < 1 {
 		m.maxRetries = defaultMaxRetries
 	}
+	if m.maxRateLimitRetries < 1 {
+		m.maxRateLimitRetries = defaultMaxRateLimitRetries
+	}
 
-	if access == "ntlm" {
+	m.ntlm = access == "ntlm"
+	if m.ntlm {
 		m.concurrentTransfers = 1
 	} else if m.concurrentTransfers < 1 {
 		m.concurrentTransfers = defaultConcurrentTransfers
 	}
 
+	// NTLM authentication can't be shared between connections, so the
+	// number of them isn't tuned then.
+	if m.ntlm {
+		m.adaptiveConcurrency = false
+	}
+	if m.minConcurrency < 1 {
+		m.minConcurrency = defaultMinConcurrency
+	}
+	m.boundConcurrency()
+
 	configureBasicDownloadAdapter(m)
 	configureBasicUploadAdapter(m)
+	configureRsyncAdapter(m)
+	configureWebdavAdapter(m)
+	configureIpfsAdapter(m)
 	if tusAllowed {
 		configureTusAdapter(m)
 	}
+	if chunkedAllowed {
+		configureChunkedAdapter(m)
+	}
+	if metalinkAllowed {
+		configureMetalinkAdapter(m)
+	}
 	return m
 }
 
+// SetConcurrentTransfers overrides lfs.concurrenttransfers with n, as the
+// --jobs flag of the commands transferring objects does. Values less than 1
+// are ignored, and NTLM authentication still transfers one object at a time.
+func (m *Manifest) SetConcurrentTransfers(n int) {
+	if n < 1 || m.ntlm {
+		return
+	}
+	m.concurrentTransfers = n
+	m.boundConcurrency()
+}
+
+// boundConcurrency widens the bounds lfs.transfer.adaptiveconcurrency tunes
+// the number of transfers between to include ConcurrentTransfers().
+func (m *Manifest) boundConcurrency() {
+	if m.minConcurrency > m.concurrentTransfers {
+		m.minConcurrency = m.concurrentTransfers
+	}
+	if m.maxConcurrency < m.concurrentTransfers {
+		m.maxConcurrency = m.concurrentTransfers
+	}
+}
+
 // GetAdapterNames returns a list of the names of adapters available to be created
 func (m *Manifest) GetAdapterNames(dir Direction) []string {
 	switch dir {
@@ -93,6 +238,15 @@ func (m *Manifest) GetUploadAdapterNames() []string {
 	return m.getAdapterNames(m.uploadAdapterFuncs)
 }
 
+// directAdapterNames are the names of the adapters used for rsync+ssh://,
+// webdav+http(s):// and ipfs+http(s):// endpoints, which have no server to
+// offer them to.
+var directAdapterNames = map[string]bool{
+	RsyncAdapterName:  true,
+	WebdavAdapterName: true,
+	IpfsAdapterName:   true,
+}
+
 // getAdapterNames returns a list of the names of adapters available to be created
 func (m *Manifest) getAdapterNames(adapters map[string]NewAdapterFunc) []string {
 	if m.basicTransfersOnly {
@@ -104,6 +258,14 @@ func (m *Manifest) getAdapterNames(adapters map[string]NewAdapterFunc) []string
 
 	ret := make([]string, 0, len(adapters))
 	for n, _ := range adapters {
+		if directAdapterNames[n] {
+			continue
+		}
+		// the chunked adapter keeps objects in the chunk store of the
+		// current repository.
+		if n == ChunkedAdapterName && !isLocalObjectStore(m.ObjectStore()) {
+			continue
+		}
 		ret = append(ret, n)
 	}
 	return ret
@@ -141,19 +303,31 @@ func (m *Manifest) NewAdapterOrDefault(name string, dir Direction) Adapter {
 // Create a new adapter by name and direction, or nil if doesn't exist
 func (m *Manifest) NewAdapter(name string, dir Direction) Adapter {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
+	var f NewAdapterFunc
 	switch dir {
 	case Upload:
-		if u, ok := m.uploadAdapterFuncs[name]; ok {
-			return u(name, dir)
-		}
+		f = m.uploadAdapterFuncs[name]
 	case Download:
-		if d, ok := m.downloadAdapterFuncs[name]; ok {
-			return d(name, dir)
-		}
+		f = m.downloadAdapterFuncs[name]
 	}
-	return nil
+	m.mu.Unlock()
+
+	if f == nil {
+		return nil
+	}
+
+	a := f(name, dir)
+	if ma, ok := a.(manifestAdapter); ok {
+		ma.setManifest(m)
+	}
+	return a
+}
+
+// manifestAdapter is implemented by the adapters which read the configuration
+// and object store of the manifest which created them, as those embedding
+// *adapterBase do.
+type manifestAdapter interface {
+	setManifest(m *Manifest)
 }
 
 // Create a new download adapter by name, or BasicAdapterName if doesn't exist
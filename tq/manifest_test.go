@@ -0,0 +1,77 @@
+package tq
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestSetConcurrentTransfers(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.concurrenttransfers":          "5",
+			"lfs.transfer.adaptiveconcurrency": "true",
+			"lfs.transfer.minconcurrency":      "4",
+			"lfs.transfer.maxconcurrency":      "8",
+		},
+	})
+
+	m := NewManifestWithGitEnv("", cfg.Git)
+	m.SetConcurrentTransfers(0)
+	assert.Equal(t, 5, m.ConcurrentTransfers())
+
+	m.SetConcurrentTransfers(2)
+	assert.Equal(t, 2, m.ConcurrentTransfers())
+	min, max := m.ConcurrencyBounds()
+	assert.Equal(t, 2, min)
+	assert.Equal(t, 8, max)
+
+	m.SetConcurrentTransfers(12)
+	assert.Equal(t, 12, m.ConcurrentTransfers())
+	_, max = m.ConcurrencyBounds()
+	assert.Equal(t, 12, max)
+}
+
+func TestManifestSetConcurrentTransfersWithNTLM(t *testing.T) {
+	m := NewManifestWithGitEnv("ntlm", nil)
+	m.SetConcurrentTransfers(4)
+	assert.Equal(t, 1, m.ConcurrentTransfers())
+}
+
+type testObjectStore struct {
+	localObjectStore
+}
+
+func (s *testObjectStore) IncompleteDir() string {
+	return "/objects/incomplete"
+}
+
+func TestManifestWithConfig(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{
+			"lfs.concurrenttransfers": "5",
+			"lfs.chunkstore":          "true",
+		},
+	})
+
+	m := NewManifestWithConfig(cfg)
+	assert.Equal(t, 5, m.ConcurrentTransfers())
+	assert.True(t, m.Config() == cfg)
+	assert.Equal(t, localObjectStore{}, m.ObjectStore())
+	assert.Contains(t, m.GetDownloadAdapterNames(), ChunkedAdapterName)
+
+	store := &testObjectStore{}
+	m.SetObjectStore(store)
+	assert.NotContains(t, m.GetDownloadAdapterNames(), ChunkedAdapterName)
+	assert.Equal(t, filepath.Join("/objects/incomplete", "quarantine"), quarantineDir(store))
+
+	a, ok := m.NewDownloadAdapter(BasicAdapterName).(*basicDownloadAdapter)
+	if assert.True(t, ok) {
+		assert.True(t, a.config() == cfg)
+		assert.True(t, a.objects() == store)
+	}
+
+	assert.True(t, NewManifest().Config() == config.Config)
+}
@@ -0,0 +1,524 @@
+package tq
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/httputil"
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	MetalinkAdapterName = "metalink"
+	MetalinkMediaType   = "application/metalink4+xml"
+
+	// metalinkPieceSize is the size of the ranges objects are downloaded
+	// in when the metalink gives no piece hashes.
+	metalinkPieceSize = 4 * 1024 * 1024
+	// metalinkMaxPieceSize is the largest piece downloaded at once. Piece
+	// hashes of larger pieces are ignored, and the object is downloaded in
+	// pieces of metalinkPieceSize instead.
+	metalinkMaxPieceSize = 64 * 1024 * 1024
+	// metalinkMaxSources is the most mirrors an object is downloaded from
+	// at once.
+	metalinkMaxSources = 4
+)
+
+// metalink is a Metalink 4 document (RFC 5854), listing the mirrors an object
+// can be downloaded from.
+type metalink struct {
+	Files []*metalinkFile `xml:"file"`
+}
+
+type metalinkFile struct {
+	Name     string            `xml:"name,attr"`
+	Size     int64             `xml:"size"`
+	Hashes   []*metalinkHash   `xml:"hash"`
+	Pieces   []*metalinkPieces `xml:"pieces"`
+	URLs     []*metalinkURL    `xml:"url"`
+	MetaURLs []*metalinkURL    `xml:"metaurl"`
+}
+
+type metalinkHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type metalinkPieces struct {
+	Length int64    `xml:"length,attr"`
+	Type   string   `xml:"type,attr"`
+	Hashes []string `xml:"hash"`
+}
+
+type metalinkURL struct {
+	Priority  int    `xml:"priority,attr"`
+	MediaType string `xml:"mediatype,attr"`
+	Href      string `xml:",chardata"`
+}
+
+// hash returns the hash of the given type the file lists, if any.
+func (f *metalinkFile) hash(typ string) string {
+	for _, h := range f.Hashes {
+		if strings.EqualFold(h.Type, typ) {
+			return strings.ToLower(strings.TrimSpace(h.Value))
+		}
+	}
+	return ""
+}
+
+// mirrors returns the HTTP(S) URLs the file can be downloaded from, those with
+// the highest priority, which is the lowest number, first.
+func (f *metalinkFile) mirrors() []string {
+	urls := make([]*metalinkURL, 0, len(f.URLs))
+	for _, u := range f.URLs {
+		href := strings.TrimSpace(u.Href)
+		if strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") {
+			urls = append(urls, &metalinkURL{Priority: u.Priority, Href: href})
+		} else {
+			tracerx.Printf("xfer: metalink: skipping unsupported mirror %q", href)
+		}
+	}
+	for _, u := range f.MetaURLs {
+		tracerx.Printf("xfer: metalink: skipping %s metaurl %q", u.MediaType, strings.TrimSpace(u.Href))
+	}
+
+	sort.Stable(metalinkURLsByPriority(urls))
+
+	mirrors := make([]string, len(urls))
+	for i, u := range urls {
+		mirrors[i] = u.Href
+	}
+	return mirrors
+}
+
+// unsupportedSources describes the sources the file lists which can't be
+// downloaded from, such as "torrent metaurl" or "ftp URL", without repeats.
+func (f *metalinkFile) unsupportedSources() []string {
+	var sources []string
+	seen := make(map[string]bool)
+	add := func(source string) {
+		if !seen[source] {
+			seen[source] = true
+			sources = append(sources, source)
+		}
+	}
+
+	for _, u := range f.URLs {
+		href := strings.TrimSpace(u.Href)
+		if !strings.HasPrefix(href, "http://") && !strings.HasPrefix(href, "https://") {
+			if i := strings.Index(href, ":"); i > 0 {
+				add(href[:i] + " URL")
+			} else {
+				add("relative URL")
+			}
+		}
+	}
+	for _, u := range f.MetaURLs {
+		add(u.MediaType + " metaurl")
+	}
+	return sources
+}
+
+// metalinkURLsByPriority sorts URLs from the highest priority to the lowest,
+// those without a priority last.
+type metalinkURLsByPriority []*metalinkURL
+
+func (u metalinkURLsByPriority) Len() int      { return len(u) }
+func (u metalinkURLsByPriority) Swap(i, j int) { u[i], u[j] = u[j], u[i] }
+func (u metalinkURLsByPriority) Less(i, j int) bool {
+	pi, pj := u[i].Priority, u[j].Priority
+	if pi == 0 || pj == 0 {
+		return pi != 0 && pj == 0
+	}
+	return pi < pj
+}
+
+// metalinkPiece is a range of an object downloaded in one request, with the
+// SHA-256 the metalink gives it, if any.
+type metalinkPiece struct {
+	Offset int64
+	Size   int64
+	Hash   string
+}
+
+// pieces splits an object of the given size into the pieces the file's sha-256
+// piece hashes are of, or into pieces of metalinkPieceSize if it has none
+// usable.
+func (f *metalinkFile) pieces(size int64) []*metalinkPiece {
+	length := int64(metalinkPieceSize)
+	var hashes []string
+	for _, p := range f.Pieces {
+		if !strings.EqualFold(p.Type, "sha-256") || p.Length < 1 || p.Length > metalinkMaxPieceSize {
+			continue
+		}
+		if int64(len(p.Hashes)) == (size+p.Length-1)/p.Length {
+			length, hashes = p.Length, p.Hashes
+			break
+		}
+	}
+
+	var pieces []*metalinkPiece
+	for offset := int64(0); offset < size; offset += length {
+		p := &metalinkPiece{Offset: offset, Size: length}
+		if offset+length > size {
+			p.Size = size - offset
+		}
+		if hashes != nil {
+			p.Hash = strings.ToLower(strings.TrimSpace(hashes[len(pieces)]))
+		}
+		pieces = append(pieces, p)
+	}
+	return pieces
+}
+
+// Adapter for downloads of large, widely distributed objects, such as public
+// datasets, from mirrors. It is offered to servers when lfs.metalinktransfers
+// is set. The download action of each object is a Metalink 4 document listing
+// the mirrors of the object, and the hashes of its pieces, if the server gives
+// them; the adapter downloads the pieces from up to metalinkMaxSources mirrors
+// at once, checking each piece against its hash, and moving it to another
+// mirror if one fails. The whole object is checked against its oid.
+//
+// Mirrors are asked without Git credentials, which would be prompted for.
+// Torrents the metalink lists are not supported: they're skipped if it lists
+// HTTP mirrors too, and the download fails if it doesn't.
+type metalinkAdapter struct {
+	*adapterBase
+}
+
+func (a *metalinkAdapter) ClearTempStorage() error {
+	// downloads aren't resumed, so their temp files are removed as they
+	// end
+	return nil
+}
+
+func (a *metalinkAdapter) WorkerStarting(workerNum int) (interface{}, error) {
+	return nil, nil
+}
+func (a *metalinkAdapter) WorkerEnding(workerNum int, ctx interface{}) {
+}
+
+func (a *metalinkAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressCallback, authOkFunc func()) error {
+	rel, err := t.Actions.Get("download")
+	if err != nil {
+		return err
+	}
+
+	file, err := a.fetchMetalink(t, rel)
+	if err != nil {
+		return err
+	}
+	if authOkFunc != nil {
+		authOkFunc()
+	}
+
+	mirrors := file.mirrors()
+	if len(mirrors) == 0 {
+		if unsupported := file.unsupportedSources(); len(unsupported) > 0 {
+			return errors.Errorf("Git LFS: metalink for %q lists no HTTP mirrors, only sources which are not supported: %s", t.Oid, strings.Join(unsupported, ", "))
+		}
+		return errors.Errorf("Git LFS: metalink for %q lists no HTTP mirrors", t.Oid)
+	}
+
+	f, err := a.objects().TempFile(t.Oid)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	err = newMetalinkDownload(a.context(), a.config(), t, f, mirrors, cb).Run(file.pieces(t.Size))
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := checkDownloadedOid(f.Name(), t.Oid); err != nil {
+		return err
+	}
+	if err := tools.RenameFileCopyPermissions(f.Name(), t.Path); err != nil {
+		return err
+	}
+	return a.objects().ProtectObject(t.Path)
+}
+
+// fetchMetalink returns the file the metalink at the given action describes,
+// checking that it is t's object.
+func (a *metalinkAdapter) fetchMetalink(t *Transfer, rel *Action) (*metalinkFile, error) {
+	req, err := a.newRequest("GET", rel.Href, rel.Header)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", MetalinkMediaType)
+
+	res, err := httputil.DoHttpRequest(a.config(), req, !t.Authenticated)
+	if err != nil {
+		if _, ok := errors.IsRetriableLaterError(err); ok {
+			return nil, err
+		}
+		return nil, withStatus(errors.NewRetriableError(err), res)
+	}
+	defer res.Body.Close()
+
+	var doc metalink
+	if err := xml.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return nil, errors.Wrapf(err, "invalid metalink from %s", httputil.TraceHttpReq(req))
+	}
+
+	var file *metalinkFile
+	for _, f := range doc.Files {
+		if f.Name == t.Oid || len(doc.Files) == 1 {
+			file = f
+			break
+		}
+	}
+	switch {
+	case file == nil:
+		return nil, errors.Errorf("Git LFS: metalink from %s does not list %q", httputil.TraceHttpReq(req), t.Oid)
+	case file.Size != t.Size:
+		return nil, errors.Errorf("Git LFS: metalink lists %q as %d bytes, expected %d", t.Oid, file.Size, t.Size)
+	case len(file.hash("sha-256")) > 0 && file.hash("sha-256") != t.Oid:
+		return nil, errors.Errorf("Git LFS: metalink lists %q with SHA-256 %s", t.Oid, file.hash("sha-256"))
+	}
+	return file, nil
+}
+
+// metalinkDownload downloads the pieces of an object from its mirrors into a
+// file, with a goroutine for each mirror in use.
+type metalinkDownload struct {
+	// ctx cancels the requests for pieces once it's done.
+	ctx     context.Context
+	cfg     *config.Configuration
+	t       *Transfer
+	f       *os.File
+	mirrors []string
+	cb      ProgressCallback
+
+	mu sync.Mutex
+	// failed holds whether each mirror has failed, and so isn't used again.
+	failed []bool
+	// received is the number of bytes of the pieces downloaded so far, and
+	// remaining the number of pieces left to download.
+	received  int64
+	remaining int
+	err       error
+
+	queue chan *metalinkPiece
+	done  chan struct{}
+}
+
+func newMetalinkDownload(ctx context.Context, cfg *config.Configuration, t *Transfer, f *os.File, mirrors []string, cb ProgressCallback) *metalinkDownload {
+	return &metalinkDownload{
+		ctx:     ctx,
+		cfg:     cfg,
+		t:       t,
+		f:       f,
+		mirrors: mirrors,
+		cb:      cb,
+		failed:  make([]bool, len(mirrors)),
+		done:    make(chan struct{}),
+	}
+}
+
+// Run downloads the given pieces, returning the error which made the last of
+// the mirrors fail, if they all did.
+func (d *metalinkDownload) Run(pieces []*metalinkPiece) error {
+	if len(pieces) == 0 {
+		return nil
+	}
+
+	// Pieces which fail are queued again, so there's room for them all.
+	d.queue = make(chan *metalinkPiece, len(pieces))
+	for _, p := range pieces {
+		d.queue <- p
+	}
+	d.remaining = len(pieces)
+
+	var wg sync.WaitGroup
+	for i := 0; i < tools.MinInt(metalinkMaxSources, len(d.mirrors)); i++ {
+		wg.Add(1)
+		go func(mirror int) {
+			defer wg.Done()
+			d.work(mirror)
+		}(i)
+	}
+	wg.Wait()
+
+	return d.err
+}
+
+// work downloads pieces from the given mirror, moving on to the next one
+// which hasn't failed if it fails, until there are no pieces left or every
+// mirror has failed.
+func (d *metalinkDownload) work(mirror int) {
+	for {
+		var p *metalinkPiece
+		select {
+		case p = <-d.queue:
+		case <-d.done:
+			return
+		}
+
+		err := d.fetch(d.mirrors[mirror], p)
+
+		d.mu.Lock()
+		if err == nil {
+			d.received += p.Size
+			d.remaining--
+			if d.cb != nil {
+				d.cb(d.t.Name, d.t.Size, d.received, int(p.Size))
+			}
+			if d.remaining == 0 {
+				close(d.done)
+			}
+			d.mu.Unlock()
+			continue
+		}
+
+		tracerx.Printf("xfer: metalink: mirror %s failed for %q: %s", d.mirrors[mirror], d.t.Oid, err)
+		d.failed[mirror] = true
+		next := d.nextMirror(mirror)
+		if next < 0 {
+			if d.err == nil {
+				d.err = err
+				close(d.done)
+			}
+			d.mu.Unlock()
+			return
+		}
+		d.queue <- p
+		d.mu.Unlock()
+		mirror = next
+	}
+}
+
+// nextMirror returns the first mirror after the given one which hasn't failed,
+// or -1 if they all have. It must be called with mu held.
+func (d *metalinkDownload) nextMirror(mirror int) int {
+	for i := 1; i <= len(d.mirrors); i++ {
+		next := (mirror + i) % len(d.mirrors)
+		if !d.failed[next] {
+			return next
+		}
+	}
+	return -1
+}
+
+// fetch downloads a piece from the mirror at the given URL into the file, as
+// it arrives, and checks it against its hash, if it has one. A piece which
+// fails the check is downloaded again over it, and the whole object is checked
+// once it's downloaded, so a corrupt piece is never kept.
+func (d *metalinkDownload) fetch(href string, p *metalinkPiece) error {
+	req, err := httputil.NewHttpRequestContext(d.ctx, "GET", href, nil)
+	if err != nil {
+		return err
+	}
+	whole := p.Offset == 0 && p.Size == d.t.Size
+	if !whole {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", p.Offset, p.Offset+p.Size-1))
+	}
+
+	res, err := httputil.DoHttpRequest(d.cfg, req, false)
+	if err != nil {
+		if _, ok := errors.IsRetriableLaterError(err); ok {
+			return err
+		}
+		return withStatus(errors.NewRetriableError(err), res)
+	}
+	httputil.LogTransfer(d.cfg, "lfs.data.download", res)
+	defer res.Body.Close()
+
+	if !whole && res.StatusCode != 206 {
+		return errors.NewRetriableError(errors.Errorf("mirror %s does not support range requests", mirrorHost(href)))
+	}
+
+	hash := sha256.New()
+	w := io.MultiWriter(&metalinkPieceWriter{f: d.f, offset: p.Offset}, hash)
+	n, err := io.Copy(w, io.LimitReader(res.Body, p.Size))
+	if err != nil {
+		if _, ok := err.(*metalinkWriteError); ok {
+			return err
+		}
+		return errors.NewRetriableError(errors.Wrapf(err, "read from mirror %s", mirrorHost(href)))
+	}
+	if n != p.Size {
+		return errors.NewRetriableError(errors.Errorf("short read from mirror %s: %d of %d bytes", mirrorHost(href), n, p.Size))
+	}
+
+	if len(p.Hash) > 0 {
+		if actual := hex.EncodeToString(hash.Sum(nil)); actual != p.Hash {
+			return errors.NewRetriableError(errors.Errorf("piece at %d of %q from %s has SHA-256 %s, expected %s", p.Offset, d.t.Oid, mirrorHost(href), actual, p.Hash))
+		}
+	}
+	return nil
+}
+
+// metalinkPieceWriter writes a piece to the file it's downloaded into, from
+// the piece's offset onwards.
+type metalinkPieceWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (w *metalinkPieceWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	if err != nil {
+		return n, &metalinkWriteError{err}
+	}
+	return n, nil
+}
+
+// metalinkWriteError is an error writing a piece to the file, which is the
+// local disk's fault rather than the mirror's.
+type metalinkWriteError struct {
+	error
+}
+
+// mirrorHost returns the host of the mirror at the given URL, for messages
+// which shouldn't reveal any credentials or signatures in it.
+func mirrorHost(href string) string {
+	if u, err := url.Parse(href); err == nil {
+		return u.Host
+	}
+	return href
+}
+
+// checkDownloadedOid returns a corrupt object error if the file at the given
+// path doesn't have the given oid.
+func checkDownloadedOid(path, oid string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := tools.NewLfsContentHash()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != oid {
+		return errors.NewCorruptObjectError(fmt.Errorf("Expected OID %s, got %s after metalink download", oid, actual), oid)
+	}
+	return nil
+}
+
+func configureMetalinkAdapter(m *Manifest) {
+	m.RegisterNewAdapterFunc(MetalinkAdapterName, Download, func(name string, dir Direction) Adapter {
+		ma := &metalinkAdapter{newAdapterBase(name, dir, nil)}
+		// self implements impl
+		ma.transferImpl = ma
+		return ma
+	})
+}
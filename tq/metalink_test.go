@@ -0,0 +1,208 @@
+package tq
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/git-lfs/git-lfs/api"
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetalinkAdapterOnlyWhenEnabled(t *testing.T) {
+	m := NewManifest()
+	assert.Equal(t, BasicAdapterName, m.NewDownloadAdapter(MetalinkAdapterName).Name())
+
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{"lfs.metalinktransfers": "true"},
+	})
+	m = NewManifestWithGitEnv("", cfg.Git)
+	assert.Equal(t, MetalinkAdapterName, m.NewDownloadAdapter(MetalinkAdapterName).Name())
+	assert.Equal(t, BasicAdapterName, m.NewUploadAdapter(MetalinkAdapterName).Name())
+}
+
+func TestMetalinkMirrorsByPriority(t *testing.T) {
+	f := &metalinkFile{
+		URLs: []*metalinkURL{
+			{Href: "https://none.example.com/obj"},
+			{Priority: 2, Href: " https://second.example.com/obj "},
+			{Priority: 1, Href: "https://first.example.com/obj"},
+			{Priority: 1, Href: "ftp://ftp.example.com/obj"},
+		},
+		MetaURLs: []*metalinkURL{{MediaType: "torrent", Href: "https://example.com/obj.torrent"}},
+	}
+
+	assert.Equal(t, []string{
+		"https://first.example.com/obj",
+		"https://second.example.com/obj",
+		"https://none.example.com/obj",
+	}, f.mirrors())
+}
+
+func TestMetalinkUnsupportedSources(t *testing.T) {
+	f := &metalinkFile{
+		URLs: []*metalinkURL{
+			{Href: "ftp://ftp.example.com/obj"},
+			{Href: "ftp://other.example.com/obj"},
+		},
+		MetaURLs: []*metalinkURL{{MediaType: "torrent", Href: "https://example.com/obj.torrent"}},
+	}
+
+	assert.Empty(t, f.mirrors())
+	assert.Equal(t, []string{"ftp URL", "torrent metaurl"}, f.unsupportedSources())
+}
+
+func TestMetalinkPieces(t *testing.T) {
+	f := &metalinkFile{Pieces: []*metalinkPieces{
+		{Type: "sha-1", Length: 4, Hashes: []string{"a", "b", "c"}},
+		{Type: "sha-256", Length: 4, Hashes: []string{"A", "b", "c"}},
+	}}
+
+	pieces := f.pieces(10)
+	if assert.Len(t, pieces, 3) {
+		assert.Equal(t, &metalinkPiece{Offset: 0, Size: 4, Hash: "a"}, pieces[0])
+		assert.Equal(t, &metalinkPiece{Offset: 8, Size: 2, Hash: "c"}, pieces[2])
+	}
+
+	// the hashes don't cover the object, so they're ignored
+	pieces = f.pieces(20)
+	if assert.Len(t, pieces, 1) {
+		assert.Equal(t, &metalinkPiece{Offset: 0, Size: 20}, pieces[0])
+	}
+}
+
+// metalinkTestServer serves a metalink at /metalink listing the given mirrors,
+// with sha-256 hashes of each 4 byte piece of contents.
+func metalinkTestServer(contents string, mirrors ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var doc bytes.Buffer
+		fmt.Fprintf(&doc, `<?xml version="1.0" encoding="UTF-8"?>`)
+		fmt.Fprintf(&doc, `<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="%x">`, sha256.Sum256([]byte(contents)))
+		fmt.Fprintf(&doc, `<size>%d</size><hash type="sha-256">%x</hash>`, len(contents), sha256.Sum256([]byte(contents)))
+		fmt.Fprintf(&doc, `<pieces length="4" type="sha-256">`)
+		for i := 0; i < len(contents); i += 4 {
+			end := i + 4
+			if end > len(contents) {
+				end = len(contents)
+			}
+			fmt.Fprintf(&doc, `<hash>%x</hash>`, sha256.Sum256([]byte(contents[i:end])))
+		}
+		fmt.Fprintf(&doc, `</pieces>`)
+		for i, m := range mirrors {
+			fmt.Fprintf(&doc, `<url priority="%d">%s</url>`, i+1, m)
+		}
+		fmt.Fprintf(&doc, `</file></metalink>`)
+
+		w.Header().Set("Content-Type", MetalinkMediaType)
+		w.Write(doc.Bytes())
+	}))
+}
+
+// metalinkTestMirror serves contents, with support for range requests, and
+// counts the requests it gets.
+func metalinkTestMirror(contents string, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		http.ServeContent(w, r, "object", time.Time{}, strings.NewReader(contents))
+	}))
+}
+
+func TestMetalinkDownloadMovesPiecesOffFailingMirrors(t *testing.T) {
+	contents := "metalink contents"
+	oid := fmt.Sprintf("%x", sha256.Sum256([]byte(contents)))
+
+	var goodRequests, corruptRequests int32
+	good := metalinkTestMirror(contents, &goodRequests)
+	defer good.Close()
+	corrupt := metalinkTestMirror(strings.ToUpper(contents), &corruptRequests)
+	defer corrupt.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	defer down.Close()
+
+	srv := metalinkTestServer(contents, corrupt.URL, down.URL, good.URL)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "metalink")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	m := NewManifest()
+	configureMetalinkAdapter(m)
+	a := m.NewDownloadAdapter(MetalinkAdapterName).(*metalinkAdapter)
+
+	obj := &api.ObjectResource{
+		Oid:           oid,
+		Size:          int64(len(contents)),
+		Authenticated: true,
+		Actions:       map[string]*api.LinkRelation{"download": {Href: srv.URL + "/metalink"}},
+	}
+	tr := newTransfer("a.dat", obj, filepath.Join(dir, "downloaded"))
+
+	var received int64
+	cb := func(name string, total, read int64, current int) error {
+		received = read
+		return nil
+	}
+	require.Nil(t, a.DoTransfer(nil, tr, cb, nil))
+
+	by, err := ioutil.ReadFile(tr.Path)
+	assert.Nil(t, err)
+	assert.Equal(t, contents, string(by))
+	assert.EqualValues(t, len(contents), received)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&corruptRequests))
+	assert.True(t, atomic.LoadInt32(&goodRequests) > 0)
+}
+
+func TestMetalinkDownloadFailsWhenEveryMirrorDoes(t *testing.T) {
+	contents := "metalink contents"
+	oid := fmt.Sprintf("%x", sha256.Sum256([]byte(contents)))
+
+	var requests int32
+	corrupt := metalinkTestMirror(strings.ToUpper(contents), &requests)
+	defer corrupt.Close()
+
+	srv := metalinkTestServer(contents, corrupt.URL)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "metalink")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	m := NewManifest()
+	configureMetalinkAdapter(m)
+	a := m.NewDownloadAdapter(MetalinkAdapterName).(*metalinkAdapter)
+
+	obj := &api.ObjectResource{
+		Oid:           oid,
+		Size:          int64(len(contents)),
+		Authenticated: true,
+		Actions:       map[string]*api.LinkRelation{"download": {Href: srv.URL + "/metalink"}},
+	}
+	tr := newTransfer("a.dat", obj, filepath.Join(dir, "downloaded"))
+
+	err = a.DoTransfer(nil, tr, nil, nil)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "has SHA-256")
+	}
+	_, err = os.Stat(tr.Path)
+	assert.True(t, os.IsNotExist(err))
+
+	// the metalink must describe the object
+	obj.Size++
+	tr = newTransfer("a.dat", obj, filepath.Join(dir, "downloaded"))
+	err = a.DoTransfer(nil, tr, nil, nil)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "expected 18")
+	}
+}
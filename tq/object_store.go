@@ -0,0 +1,59 @@
+package tq
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/git-lfs/git-lfs/localstorage"
+)
+
+// ObjectStore is where transfer adapters write the objects they download, so
+// that programs embedding this package can keep them elsewhere than in the
+// local storage of a repository. Each download is written to the path of its
+// Transfer once complete, and then protected.
+type ObjectStore interface {
+	// IncompleteDir returns the directory under which adapters keep the
+	// downloads they can resume, each in a directory of its own, which
+	// ClearTempStorage removes.
+	IncompleteDir() string
+	// TempFile creates a temporary file, whose name starts with the given
+	// prefix, for a download which can't be resumed.
+	TempFile(prefix string) (*os.File, error)
+	// ProtectObject makes the downloaded object at the given path
+	// read-only, or whatever else keeps it from being changed.
+	ProtectObject(path string) error
+}
+
+// localObjectStore is the ObjectStore of the local storage of the current
+// repository.
+type localObjectStore struct{}
+
+func (localObjectStore) IncompleteDir() string {
+	return localstorage.Objects().RootDir
+}
+
+func (localObjectStore) TempFile(prefix string) (*os.File, error) {
+	return localstorage.TempFile(prefix)
+}
+
+func (localObjectStore) ProtectObject(path string) error {
+	return localstorage.ProtectObject(path)
+}
+
+// isLocalObjectStore returns whether s is the local storage of the current
+// repository, which the chunk and compressed stores of its objects, and the
+// compression of the objects downloaded, are only used with.
+func isLocalObjectStore(s ObjectStore) bool {
+	_, ok := s.(localObjectStore)
+	return ok
+}
+
+// incompleteDir returns the directory under the store's IncompleteDir with the
+// given name, creating it, or the system's temporary directory if it can't be.
+func incompleteDir(s ObjectStore, name string) string {
+	d := filepath.Join(s.IncompleteDir(), name)
+	if err := os.MkdirAll(d, 0755); err != nil {
+		return os.TempDir()
+	}
+	return d
+}
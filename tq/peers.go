@@ -0,0 +1,509 @@
+package tq
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	// peerProtocol starts the discovery probes peers send each other, and
+	// their answers.
+	peerProtocol = "git-lfs-peers/2"
+
+	// peerAuthHeader carries the challenge a peer was given, and its answer
+	// to it, in the requests peers make each other for objects.
+	peerAuthHeader = "Git-Lfs-Peer-Auth"
+
+	// peerChallengeTTL is how long a challenge given to a peer can be
+	// answered, and peerMaxChallenges how many can be waiting at once.
+	peerChallengeTTL  = 30 * time.Second
+	peerMaxChallenges = 1024
+
+	// peerRequestTimeout limits the requests made to peers other than for
+	// the contents of objects, whose bodies are given peerRequestTimeout
+	// and a second for each peerMinRate bytes.
+	peerRequestTimeout = 5 * time.Second
+	peerMinRate        = 1024 * 1024
+)
+
+var (
+	peerOidRE   = regexp.MustCompile(`\A[0-9a-f]{64}\z`)
+	peerNonceRE = regexp.MustCompile(`\A[0-9a-f]{32}\z`)
+
+	errNoPeerSecret = errors.New("lfs.peers.secret must be set to share objects with peers")
+)
+
+// peerNonce returns a random nonce, which peers answer with the MAC of their
+// secret to prove they share it.
+func peerNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// peerMAC returns the MAC of the given fields under the given secret, which
+// only peers sharing it can give, without giving it away to the rest of the
+// network.
+func peerMAC(secret string, fields ...string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// peerMACEqual returns whether the given MAC is that of the given fields under
+// the given secret, in constant time.
+func peerMACEqual(secret, mac string, fields ...string) bool {
+	return hmac.Equal([]byte(mac), []byte(peerMAC(secret, fields...)))
+}
+
+// DiscoverPeers looks for peers serving objects in the local network, by
+// broadcasting a probe to the given UDP port, and sending it to each of the
+// given "host[:port]" addresses. It returns the "host:port" addresses on which
+// the peers sharing the given secret, which answered within the timeout, serve
+// objects. Each probe carries a new nonce, so that only peers which know the
+// secret can answer it.
+func DiscoverPeers(port int, addresses []string, secret string, timeout time.Duration) ([]string, error) {
+	if len(secret) == 0 {
+		return nil, errNoPeerSecret
+	}
+
+	nonce, err := peerNonce()
+	if err != nil {
+		return nil, errors.Wrap(err, "peer discovery")
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, errors.Wrap(err, "peer discovery")
+	}
+	defer conn.Close()
+
+	probe := []byte(fmt.Sprintf("%s %s\n", peerProtocol, nonce))
+
+	targets := append([]string{net.JoinHostPort("255.255.255.255", strconv.Itoa(port))}, addresses...)
+	for _, target := range targets {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			target = net.JoinHostPort(target, strconv.Itoa(port))
+		}
+
+		addr, err := net.ResolveUDPAddr("udp4", target)
+		if err != nil {
+			tracerx.Printf("peers: cannot resolve %s: %s", target, err)
+			continue
+		}
+		if _, err := conn.WriteToUDP(probe, addr); err != nil {
+			tracerx.Printf("peers: cannot probe %s: %s", target, err)
+		}
+	}
+
+	var peers []string
+	seen := make(map[string]bool)
+	buf := make([]byte, 512)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// The deadline has passed.
+			break
+		}
+
+		// "<protocol> <port> <mac>"
+		fields := strings.Fields(string(buf[:n]))
+		if len(fields) != 3 || fields[0] != peerProtocol {
+			continue
+		}
+		if _, err := strconv.ParseUint(fields[1], 10, 16); err != nil {
+			continue
+		}
+		if !peerMACEqual(secret, fields[2], "answer", nonce, fields[1]) {
+			continue
+		}
+
+		peer := net.JoinHostPort(from.IP.String(), fields[1])
+		if !seen[peer] {
+			tracerx.Printf("peers: found %s", peer)
+			seen[peer] = true
+			peers = append(peers, peer)
+		}
+	}
+
+	return peers, nil
+}
+
+// PeerServer serves the objects stored locally to the peers sharing its
+// secret, which find it by the probes it answers. Peers ask for a challenge
+// before each object, and answer it with the MAC of the secret, which is
+// never sent.
+type PeerServer struct {
+	secret string
+	open   func(oid string) (io.ReadCloser, error)
+
+	// challenges holds when each challenge given to peers, and not yet
+	// answered, expires.
+	challenges map[string]time.Time
+	mu         sync.Mutex
+}
+
+// NewPeerServer returns a *PeerServer serving the objects opened by the given
+// function to the peers sharing the given secret, which mustn't be empty.
+func NewPeerServer(secret string, open func(oid string) (io.ReadCloser, error)) (*PeerServer, error) {
+	if len(secret) == 0 {
+		return nil, errNoPeerSecret
+	}
+
+	return &PeerServer{
+		secret:     secret,
+		open:       open,
+		challenges: make(map[string]time.Time),
+	}, nil
+}
+
+// Serve answers the probes received on the given UDP connection, and serves
+// objects on the given listener, until either fails.
+func (s *PeerServer) Serve(probes net.PacketConn, l net.Listener) error {
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:     s,
+		ReadTimeout: peerRequestTimeout,
+		IdleTimeout: peerChallengeTTL,
+	}
+
+	errc := make(chan error, 2)
+	go func() { errc <- s.answer(probes, port) }()
+	go func() { errc <- srv.Serve(l) }()
+	return <-errc
+}
+
+// answer tells the peers probing the given connection on which port objects
+// are served.
+func (s *PeerServer) answer(probes net.PacketConn, port string) error {
+	buf := make([]byte, 512)
+	for {
+		n, from, err := probes.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		// "<protocol> <nonce>"
+		fields := strings.Fields(string(buf[:n]))
+		if len(fields) != 2 || fields[0] != peerProtocol || !peerNonceRE.MatchString(fields[1]) {
+			continue
+		}
+
+		tracerx.Printf("peers: answering probe from %s", from)
+		answer := fmt.Sprintf("%s %s %s\n", peerProtocol, port, peerMAC(s.secret, "answer", fields[1], port))
+		if _, err := probes.WriteTo([]byte(answer), from); err != nil {
+			tracerx.Printf("peers: cannot answer %s: %s", from, err)
+		}
+	}
+}
+
+// ServeHTTP serves "POST /challenge" requests from peers, which are given a
+// challenge to answer, and "GET /objects/<oid>" requests, whose answer to a
+// challenge is given as "<challenge> <mac>" by the Git-Lfs-Peer-Auth header.
+func (s *PeerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" && r.URL.Path == "/challenge" {
+		s.serveChallenge(w, r)
+		return
+	}
+
+	oid := strings.TrimPrefix(r.URL.Path, "/objects/")
+	if r.Method != "GET" || !peerOidRE.MatchString(oid) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !s.authorized(r.Header.Get(peerAuthHeader), r.Method, r.URL.Path) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	f, err := s.open(oid)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	tracerx.Printf("peers: serving %s to %s", oid, r.RemoteAddr)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if _, err := io.Copy(w, bufio.NewReader(f)); err != nil {
+		tracerx.Printf("peers: error serving %s: %s", oid, err)
+	}
+}
+
+// serveChallenge gives the peer a new challenge, which it can answer once,
+// within peerChallengeTTL.
+func (s *PeerServer) serveChallenge(w http.ResponseWriter, r *http.Request) {
+	nonce, err := peerNonce()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	for challenge, expires := range s.challenges {
+		if now.After(expires) {
+			delete(s.challenges, challenge)
+		}
+	}
+	full := len(s.challenges) >= peerMaxChallenges
+	if !full {
+		s.challenges[nonce] = now.Add(peerChallengeTTL)
+	}
+	s.mu.Unlock()
+
+	if full {
+		http.Error(w, "Too many challenges", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprint(w, nonce)
+}
+
+// authorized returns whether the given "<challenge> <mac>" answers a challenge
+// given to a peer, which is then used up, for a request of the given method
+// and path, with the MAC of the secret.
+func (s *PeerServer) authorized(auth, method, path string) bool {
+	fields := strings.Fields(auth)
+	if len(fields) != 2 {
+		return false
+	}
+
+	s.mu.Lock()
+	expires, ok := s.challenges[fields[0]]
+	delete(s.challenges, fields[0])
+	s.mu.Unlock()
+
+	if !ok || time.Now().After(expires) {
+		return false
+	}
+	return peerMACEqual(s.secret, fields[1], "request", fields[0], method, path)
+}
+
+// peerClient downloads objects from the peers found in the local network.
+type peerClient struct {
+	peers  []string
+	secret string
+	client *http.Client
+	// objects is where the objects downloaded are written.
+	objects ObjectStore
+}
+
+// newPeerClient looks for peers as configured, and returns a *peerClient to
+// download objects from them into the given store, or nil if none were found,
+// or no secret is configured.
+func newPeerClient(cfg *config.Configuration, objects ObjectStore) *peerClient {
+	peers, err := DiscoverPeers(cfg.PeerPort(), cfg.PeerAddresses(), cfg.PeerSecret(), cfg.PeerDiscoveryTimeout())
+	if err != nil {
+		tracerx.Printf("peers: %s", err)
+		return nil
+	}
+	if len(peers) == 0 {
+		tracerx.Printf("peers: none found")
+		return nil
+	}
+
+	dialer := &net.Dialer{Timeout: time.Second}
+	return &peerClient{
+		peers:   peers,
+		secret:  cfg.PeerSecret(),
+		objects: objects,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Dial:                  dialer.Dial,
+				ResponseHeaderTimeout: peerRequestTimeout,
+			},
+		},
+	}
+}
+
+// fetch downloads the object with the given oid and size from the first peer
+// which has it, and moves it to the given path once its contents are checked
+// against its oid. It returns whether any peer had it.
+func (c *peerClient) fetch(oid string, size int64, path string) bool {
+	for _, peer := range c.peers {
+		err := c.fetchFrom(peer, oid, size, path)
+		if err == nil {
+			tracerx.Printf("peers: downloaded %s from %s", oid, peer)
+			return true
+		}
+		tracerx.Printf("peers: %s", err)
+	}
+	return false
+}
+
+// challenge asks the given peer for a challenge to answer in its next request.
+func (c *peerClient) challenge(peer string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), peerRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/challenge", peer), nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return "", errors.Errorf("%s gave no challenge: %s", peer, res.Status)
+	}
+
+	by, err := ioutil.ReadAll(io.LimitReader(res.Body, 64))
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot read challenge from %s", peer)
+	}
+	nonce := strings.TrimSpace(string(by))
+	if !peerNonceRE.MatchString(nonce) {
+		return "", errors.Errorf("%s gave an invalid challenge", peer)
+	}
+	return nonce, nil
+}
+
+func (c *peerClient) fetchFrom(peer, oid string, size int64, path string) error {
+	nonce, err := c.challenge(peer)
+	if err != nil {
+		return err
+	}
+
+	// Objects are given as long as they would take at peerMinRate, so that
+	// a slow or stalled peer can't hold up the download from the remote.
+	ctx, cancel := context.WithTimeout(context.Background(), peerRequestTimeout+time.Duration(size/peerMinRate)*time.Second)
+	defer cancel()
+
+	objectPath := "/objects/" + oid
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s%s", peer, objectPath), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(peerAuthHeader, nonce+" "+peerMAC(c.secret, "request", nonce, "GET", objectPath))
+
+	res, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return errors.Errorf("%s doesn't have %s: %s", peer, oid, res.Status)
+	}
+
+	f, err := c.objects.TempFile(oid)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	// Peers aren't trusted any further than their contents can be checked,
+	// so no more than the object's size is read from them.
+	hash := tools.NewLfsContentHash()
+	n, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(res.Body, size+1))
+	f.Close()
+	if err != nil {
+		return errors.Wrapf(err, "cannot download %s from %s", oid, peer)
+	}
+	if n != size {
+		return errors.Errorf("%s sent %d bytes of %s, expected %d", peer, n, oid, size)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != oid {
+		return errors.Errorf("%s sent %s as %s", peer, actual, oid)
+	}
+
+	if err := tools.RenameFileCopyPermissions(f.Name(), path); err != nil {
+		return err
+	}
+	return c.objects.ProtectObject(path)
+}
+
+// fetchFromPeers downloads the objects in the batch which peers in the local
+// network have from them, marking them as transferred, and returns those which
+// are still to be downloaded from the remote. Peers are only looked for once,
+// and each object is only asked for once.
+func (q *TransferQueue) fetchFromPeers(b batch) batch {
+	q.peersOnce.Do(func() {
+		q.peers = newPeerClient(q.manifest.Config(), q.manifest.ObjectStore())
+	})
+	if q.peers == nil {
+		return b
+	}
+
+	var ask batch
+	rest := q.makeBatch()
+	for _, t := range b {
+		if q.askedPeers[t.Oid] {
+			rest = append(rest, t)
+		} else {
+			q.askedPeers[t.Oid] = true
+			ask = append(ask, t)
+		}
+	}
+	if len(ask) == 0 {
+		return rest
+	}
+
+	q.startProgress.Do(q.meter.Start)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	tuples := make(chan *objectTuple, len(ask))
+	for _, t := range ask {
+		tuples <- t
+	}
+	close(tuples)
+
+	for i := 0; i < q.manifest.ConcurrentTransfers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tuples {
+				if !q.peers.fetch(t.Oid, t.Size, t.Path) {
+					mu.Lock()
+					rest = append(rest, t)
+					mu.Unlock()
+					continue
+				}
+
+				q.meter.StartTransfer(t.Name)
+				q.meter.TransferBytes("download", t.Name, t.Size, t.Size, int(t.Size))
+				q.handleTransferResult(TransferResult{
+					Transfer: &Transfer{Name: t.Name, Oid: t.Oid, Size: t.Size, Path: t.Path},
+				}, nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return rest
+}
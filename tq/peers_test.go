@@ -0,0 +1,145 @@
+package tq
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startPeer serves the given objects, keyed by oid, to peers sharing the given
+// secret on the loopback interface, and returns the UDP port it answers probes
+// on.
+func startPeer(t *testing.T, secret string, objects map[string]string) int {
+	probes, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.Nil(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	open := func(oid string) (io.ReadCloser, error) {
+		if contents, ok := objects[oid]; ok {
+			return ioutil.NopCloser(strings.NewReader(contents)), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	s, err := NewPeerServer(secret, open)
+	require.Nil(t, err)
+	go s.Serve(probes, l)
+
+	return probes.LocalAddr().(*net.UDPAddr).Port
+}
+
+func peerOid(contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDiscoverPeersSharingSecret(t *testing.T) {
+	port := startPeer(t, "studio", nil)
+	other := startPeer(t, "elsewhere", nil)
+	addresses := []string{"127.0.0.1:" + strconv.Itoa(port), "127.0.0.1:" + strconv.Itoa(other)}
+
+	peers, err := DiscoverPeers(port, addresses, "studio", 500*time.Millisecond)
+	require.Nil(t, err)
+	require.Len(t, peers, 1)
+	assert.True(t, strings.HasPrefix(peers[0], "127.0.0.1:"))
+}
+
+func TestPeerClientFetchChecksObjects(t *testing.T) {
+	good := "peer contents"
+	bad := "tampered contents"
+	port := startPeer(t, "studio", map[string]string{
+		peerOid(good):   good,
+		peerOid("lies"): bad,
+	})
+
+	dir, err := ioutil.TempDir("", "lfs-peers")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := config.NewFrom(config.Values{Git: map[string]string{
+		"lfs.peers.port":    strconv.Itoa(port),
+		"lfs.peers.address": "127.0.0.1",
+		"lfs.peers.secret":  "studio",
+		"lfs.peers.timeout": "500",
+	}})
+	c := newPeerClient(cfg, localObjectStore{})
+	require.NotNil(t, c)
+
+	path := filepath.Join(dir, "good")
+	require.True(t, c.fetch(peerOid(good), int64(len(good)), path))
+	by, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, good, string(by))
+
+	path = filepath.Join(dir, "bad")
+	assert.False(t, c.fetch(peerOid("lies"), int64(len(bad)), path))
+	assert.False(t, c.fetch(peerOid("lies"), 4, path))
+	assert.False(t, c.fetch(peerOid("missing"), 7, path))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPeerServerRefusesOtherSecrets(t *testing.T) {
+	contents := "secret contents"
+	port := startPeer(t, "studio", map[string]string{peerOid(contents): contents})
+
+	peers, err := DiscoverPeers(port, []string{"127.0.0.1"}, "studio", 500*time.Millisecond)
+	require.Nil(t, err)
+	require.Len(t, peers, 1)
+
+	c := &peerClient{peers: peers, secret: "guess", client: http.DefaultClient}
+
+	err = c.fetchFrom(peers[0], peerOid(contents), int64(len(contents)), filepath.Join(os.TempDir(), "lfs-peers-refused"))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "403")
+}
+
+func TestPeerServerRefusesReplayedChallenges(t *testing.T) {
+	contents := "secret contents"
+	port := startPeer(t, "studio", map[string]string{peerOid(contents): contents})
+
+	peers, err := DiscoverPeers(port, []string{"127.0.0.1"}, "studio", 500*time.Millisecond)
+	require.Nil(t, err)
+	require.Len(t, peers, 1)
+
+	c := &peerClient{peers: peers, secret: "studio", client: http.DefaultClient}
+	nonce, err := c.challenge(peers[0])
+	require.Nil(t, err)
+
+	path := "/objects/" + peerOid(contents)
+	get := func(auth string) int {
+		req, err := http.NewRequest("GET", "http://"+peers[0]+path, nil)
+		require.Nil(t, err)
+		req.Header.Set(peerAuthHeader, auth)
+		res, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	auth := nonce + " " + peerMAC("studio", "request", nonce, "GET", path)
+	assert.Equal(t, 200, get(auth))
+	assert.Equal(t, 403, get(auth))
+	assert.Equal(t, 403, get(""))
+}
+
+func TestPeersNeedSecret(t *testing.T) {
+	_, err := NewPeerServer("", nil)
+	assert.Equal(t, errNoPeerSecret, err)
+
+	_, err = DiscoverPeers(config.DefaultPeerPort, nil, "", time.Millisecond)
+	assert.Equal(t, errNoPeerSecret, err)
+}
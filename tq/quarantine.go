@@ -0,0 +1,87 @@
+package tq
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/git-lfs/git-lfs/config"
+)
+
+// quarantineDir returns the directory in which downloads whose contents don't
+// match their OID are kept for inspection: alongside the "bad" directory of
+// "git lfs fsck" for the local storage of the current repository, or in the
+// incomplete directory of the object store s otherwise.
+func quarantineDir(s ObjectStore) string {
+	if !isLocalObjectStore(s) {
+		return filepath.Join(s.IncompleteDir(), "quarantine")
+	}
+	return filepath.Join(config.LocalGitStorageDir, "lfs", "quarantine")
+}
+
+// quarantineDownload moves the corrupt download of t at the given path to the
+// quarantine directory, next to a text file describing it: the bytes received,
+// from the given byte on if it was resumed, the OID of its contents and the
+// response of the server. It returns the new path of the download.
+func quarantineDownload(s ObjectStore, t *Transfer, path string, res *http.Response, fromByte, received int64, actual string) (string, error) {
+	dir := quarantineDir(s)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	name := filepath.Join(dir, fmt.Sprintf("%s-%s", t.Oid, time.Now().UTC().Format("20060102T150405.000000000")))
+	if err := os.Rename(path, name); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "name: %s\n", t.Name)
+	fmt.Fprintf(&buf, "expected oid: %s\n", t.Oid)
+	fmt.Fprintf(&buf, "actual oid: %s\n", actual)
+	fmt.Fprintf(&buf, "expected size: %d\n", t.Size)
+	fmt.Fprintf(&buf, "bytes received: %d\n", fromByte+received)
+	if fromByte > 0 {
+		fmt.Fprintf(&buf, "resumed from byte: %d\n", fromByte)
+	}
+
+	if res != nil {
+		if res.Request != nil && res.Request.URL != nil {
+			fmt.Fprintf(&buf, "url: %s\n", redactedUrl(res.Request.URL))
+		}
+		fmt.Fprintf(&buf, "status: %s\n", res.Status)
+		fmt.Fprintf(&buf, "response headers:\n")
+
+		keys := make([]string, 0, len(res.Header))
+		for key := range res.Header {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			for _, value := range res.Header[key] {
+				if strings.EqualFold(key, "Set-Cookie") {
+					value = "<redacted>"
+				}
+				fmt.Fprintf(&buf, "  %s: %s\n", key, value)
+			}
+		}
+	}
+
+	return name, ioutil.WriteFile(name+".txt", buf.Bytes(), 0644)
+}
+
+// redactedUrl returns the given URL without any credentials or query, which
+// may hold signatures granting access to the object.
+func redactedUrl(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	redacted.RawQuery = ""
+	return redacted.String()
+}
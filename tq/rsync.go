@@ -0,0 +1,329 @@
+package tq
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/git-lfs/git-lfs/api"
+	"github.com/git-lfs/git-lfs/auth"
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/subprocess"
+	"github.com/git-lfs/git-lfs/tools"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	RsyncAdapterName = "rsync"
+
+	// rsyncPartialDir is where rsync keeps interrupted transfers, relative
+	// to the directory of the object, so that they're resumed rather than
+	// started again, without leaving truncated objects behind.
+	rsyncPartialDir = ".rsync-partial"
+)
+
+// RsyncCommand is the rsync executable objects are transferred with.
+var RsyncCommand = "rsync"
+
+// Adapter for transfers with rsync over SSH to and from a directory on a host
+// which doesn't run a Git LFS server, as given by an rsync+ssh:// URL. Objects
+// are stored there as they are locally, in "ab/cd/abcd..." files. There's no
+// batch API to ask, so the transfer queue makes up the batch responses with
+// rsyncBatch, and this adapter is never offered to servers.
+type rsyncAdapter struct {
+	*adapterBase
+}
+
+func (a *rsyncAdapter) ClearTempStorage() error {
+	return os.RemoveAll(a.tempDir())
+}
+
+func (a *rsyncAdapter) tempDir() string {
+	// Must be dedicated to this adapter as deleted by ClearTempStorage,
+	// and outlive this invocation, so that downloads can be resumed.
+	return incompleteDir(a.objects(), "incomplete-rsync")
+}
+
+func (a *rsyncAdapter) WorkerStarting(workerNum int) (interface{}, error) {
+	return nil, nil
+}
+func (a *rsyncAdapter) WorkerEnding(workerNum int, ctx interface{}) {
+}
+
+func (a *rsyncAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressCallback, authOkFunc func()) error {
+	rel, err := t.Actions.Get(a.direction.String())
+	if err != nil {
+		return err
+	}
+
+	endpoint := config.NewEndpointWithConfig(rel.Href, a.config())
+	if !endpoint.IsRsync() || len(endpoint.SshPath) == 0 {
+		return errors.Errorf("Git LFS: invalid rsync URL %q", rel.Href)
+	}
+	remote := endpoint.SshUserAndHost + ":" + endpoint.SshPath
+
+	if a.direction == Upload {
+		err = a.upload(t, endpoint, remote, cb)
+	} else {
+		err = a.download(t, endpoint, remote, cb)
+	}
+	if err == nil && authOkFunc != nil {
+		authOkFunc()
+	}
+	return err
+}
+
+// upload copies t's object to the host, unless it has it already. The
+// directories the object is stored in are created on the host first.
+func (a *rsyncAdapter) upload(t *Transfer, endpoint config.Endpoint, remote string, cb ProgressCallback) error {
+	if err := ensureWholeObject(a.objects(), t); err != nil {
+		return errors.Wrap(err, "rsync upload")
+	}
+
+	mkdir := fmt.Sprintf("mkdir -p %s && rsync", shellQuote(path.Dir(endpoint.SshPath)))
+	return runRsync(a.config(), t, endpoint, cb, "--ignore-existing", "--rsync-path="+mkdir, "--", t.Path, remote)
+}
+
+// download copies t's object from the host to a file of its own in the
+// adapter's temporary directory, which rsync resumes from if the transfer is
+// interrupted, then checks its contents and moves it to t.Path.
+func (a *rsyncAdapter) download(t *Transfer, endpoint config.Endpoint, remote string, cb ProgressCallback) error {
+	dlfilename := filepath.Join(a.tempDir(), t.Oid)
+	if err := runRsync(a.config(), t, endpoint, cb, "--", remote, dlfilename); err != nil {
+		return err
+	}
+
+	f, err := os.Open(dlfilename)
+	if err != nil {
+		return err
+	}
+	hash := tools.NewLfsContentHash()
+	_, err = io.Copy(hash, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	if actual := fmt.Sprintf("%x", hash.Sum(nil)); actual != t.Oid {
+		os.Remove(dlfilename)
+		return errors.NewCorruptObjectError(fmt.Errorf("Expected OID %s, got %s from %s", t.Oid, actual, remote), t.Oid)
+	}
+
+	if err := tools.RenameFileCopyPermissions(dlfilename, t.Path); err != nil {
+		return err
+	}
+	return a.objects().ProtectObject(t.Path)
+}
+
+// HasObject tells whether the object of the given size is stored at the given
+// rsync+ssh:// URL, by listing it on the host.
+func (a *rsyncAdapter) HasObject(href string, size int64) (bool, error) {
+	endpoint := config.NewEndpointWithConfig(href, a.config())
+	if !endpoint.IsRsync() || len(endpoint.SshPath) == 0 {
+		return false, errors.Errorf("Git LFS: invalid rsync URL %q", href)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := rsyncCommand(a.config(), endpoint, "--list-only", "--", endpoint.SshUserAndHost+":"+endpoint.SshPath)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if rsyncExitCode(err) == 23 && strings.Contains(stderr.String(), "No such file or directory") {
+			return false, nil
+		}
+		return false, rsyncError(&Transfer{Oid: path.Base(endpoint.SshPath)}, err, stderr.String())
+	}
+
+	listed, ok := rsyncListedSize(stdout.String())
+	return ok && listed == size, nil
+}
+
+// rsyncListedSize returns the size of the file rsync --list-only listed, as in
+// "-rw-r--r--         12,345 2017/01/02 03:04:05 abcdef...".
+func rsyncListedSize(listing string) (int64, bool) {
+	fields := strings.Fields(listing)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "-") {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.Replace(fields[1], ",", "", -1), 10, 64)
+	return n, err == nil
+}
+
+// rsyncCommand returns the command which runs rsync over ssh to the endpoint's
+// host with the given arguments, as configured by cfg. The arguments should end
+// rsync's options with "--" before any paths.
+func rsyncCommand(cfg *config.Configuration, endpoint config.Endpoint, args ...string) *exec.Cmd {
+	ssh, sshArgs := auth.SshTransportCommand(cfg, endpoint)
+	rsh := make([]string, 0, 1+len(sshArgs))
+	for _, arg := range append([]string{ssh}, sshArgs...) {
+		rsh = append(rsh, shellQuote(arg))
+	}
+
+	rsyncArgs := append([]string{
+		"--protect-args",
+		"--rsh=" + strings.Join(rsh, " "),
+	}, cfg.RsyncArgs()...)
+	rsyncArgs = append(rsyncArgs, args...)
+
+	tracerx.Printf("xfer: running %s %s", RsyncCommand, strings.Join(rsyncArgs, " "))
+	return subprocess.ExecCommand(RsyncCommand, rsyncArgs...)
+}
+
+// runRsync runs rsync over ssh to the endpoint's host with the given arguments,
+// as configured by cfg, reporting its progress through cb.
+func runRsync(cfg *config.Configuration, t *Transfer, endpoint config.Endpoint, cb ProgressCallback, args ...string) error {
+	args = append([]string{"--progress", "--partial-dir=" + rsyncPartialDir}, args...)
+
+	var stderr bytes.Buffer
+	progress := &rsyncProgress{t: t, cb: cb}
+	cmd := rsyncCommand(cfg, endpoint, args...)
+	cmd.Stdout = progress
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	progress.Flush()
+	if err == nil {
+		// rsync says nothing of uploads skipped as the host has the
+		// object already.
+		progress.advance(t.Size)
+		return nil
+	}
+	return rsyncError(t, err, stderr.String())
+}
+
+// rsyncError describes a failure to run rsync. Failures to connect, and
+// transfers which were interrupted, can be retried, and are resumed when they
+// are; objects missing from the host can't be.
+func rsyncError(t *Transfer, err error, stderr string) error {
+	if _, ok := err.(*exec.Error); ok {
+		return errors.Wrapf(err, "Git LFS: unable to transfer %s: is rsync installed?", t.Oid)
+	}
+
+	code := rsyncExitCode(err)
+	if stderr = strings.TrimSpace(stderr); len(stderr) > 0 {
+		err = fmt.Errorf("%v: %s", err, stderr)
+	}
+	err = errors.Wrapf(err, "rsync %s", t.Oid)
+
+	switch code {
+	case 23:
+		if strings.Contains(stderr, "No such file or directory") {
+			return errors.Errorf("[%v] Object does not exist on the server: %v", t.Oid, err)
+		}
+		return err
+	case 10, 12, 20, 30, 35, 255:
+		// socket and protocol errors, interruptions and timeouts,
+		// and failures of ssh to connect.
+		return errors.NewRetriableError(err)
+	}
+	return err
+}
+
+// rsyncExitCode returns the exit code of the rsync command which failed with
+// err, or -1 if it didn't exit.
+func rsyncExitCode(err error) int {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+	return -1
+}
+
+// rsyncProgressRE matches the progress rsync --progress prints, such as
+// "     32,768  50%   1.23MB/s    0:00:01", capturing the number of bytes
+// transferred so far.
+var rsyncProgressRE = regexp.MustCompile(`^\s*([\d,]+)\s+\d+%`)
+
+// rsyncProgress reports the progress rsync writes to its stdout, as lines
+// which it ends with carriage returns while the transfer goes on.
+type rsyncProgress struct {
+	t    *Transfer
+	cb   ProgressCallback
+	line []byte
+	sent int64
+}
+
+func (p *rsyncProgress) Write(b []byte) (int, error) {
+	for _, c := range b {
+		if c == '\r' || c == '\n' {
+			p.Flush()
+			continue
+		}
+		p.line = append(p.line, c)
+	}
+	return len(b), nil
+}
+
+// Flush reports the progress on the line written so far, if any.
+func (p *rsyncProgress) Flush() {
+	match := rsyncProgressRE.FindSubmatch(p.line)
+	p.line = p.line[:0]
+	if match == nil {
+		return
+	}
+
+	n, err := strconv.ParseInt(strings.Replace(string(match[1]), ",", "", -1), 10, 64)
+	if err == nil {
+		p.advance(n)
+	}
+}
+
+// advance reports that n bytes of the object have been transferred.
+func (p *rsyncProgress) advance(n int64) {
+	if n <= p.sent || p.cb == nil {
+		return
+	}
+	p.cb(p.t.Name, p.t.Size, n, int(n-p.sent))
+	p.sent = n
+}
+
+// rsyncBatch makes up the response of a batch API request for objects stored
+// at an rsync+ssh:// endpoint, which has no Git LFS server to send it to: each
+// object is to be transferred by the rsync adapter, to or from its file under
+// the endpoint's directory. Uploads skip objects which the host has already.
+func rsyncBatch(endpoint config.Endpoint, objects []*api.ObjectResource, kind string) []*api.ObjectResource {
+	base := strings.TrimSuffix(endpoint.Url, "/")
+	for _, o := range objects {
+		if len(o.Oid) < 5 {
+			o.Error = &api.ObjectError{Code: 422, Message: "Invalid object ID"}
+			continue
+		}
+		o.Actions = map[string]*api.LinkRelation{
+			kind: &api.LinkRelation{Href: fmt.Sprintf("%s/%s/%s/%s", base, o.Oid[0:2], o.Oid[2:4], o.Oid)},
+		}
+	}
+	return objects
+}
+
+// shellQuote quotes s for a POSIX shell, if it needs it.
+func shellQuote(s string) string {
+	if len(s) > 0 && strings.IndexFunc(s, func(r rune) bool {
+		return !(r == '/' || r == '.' || r == '-' || r == '_' || r == '=' || r == ':' || r == '@' || r == '%' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func configureRsyncAdapter(m *Manifest) {
+	newfunc := func(name string, dir Direction) Adapter {
+		ra := &rsyncAdapter{newAdapterBase(name, dir, nil)}
+		// self implements impl
+		ra.transferImpl = ra
+		return ra
+	}
+	m.RegisterNewAdapterFunc(RsyncAdapterName, Upload, newfunc)
+	m.RegisterNewAdapterFunc(RsyncAdapterName, Download, newfunc)
+}
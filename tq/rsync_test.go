@@ -0,0 +1,68 @@
+package tq
+
+import (
+	"testing"
+
+	"github.com/git-lfs/git-lfs/api"
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRsyncBatchStoresObjectsUnderEndpoint(t *testing.T) {
+	oid := "abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"
+	endpoint := config.NewEndpoint("rsync+ssh://git@example.com:2222/srv/lfs/")
+
+	objs := rsyncBatch(endpoint, []*api.ObjectResource{{Oid: oid, Size: 4}}, "upload")
+	assert.Len(t, objs, 1)
+	assert.Nil(t, objs[0].Error)
+	assert.Equal(t, "rsync+ssh://git@example.com:2222/srv/lfs/ab/cd/"+oid, objs[0].Actions["upload"].Href)
+
+	object := config.NewEndpoint(objs[0].Actions["upload"].Href)
+	assert.Equal(t, "git@example.com", object.SshUserAndHost)
+	assert.Equal(t, "2222", object.SshPort)
+	assert.Equal(t, "/srv/lfs/ab/cd/"+oid, object.SshPath)
+}
+
+func TestRsyncAdapterIsNotOfferedToServers(t *testing.T) {
+	m := NewManifest()
+	assert.Equal(t, RsyncAdapterName, m.NewUploadAdapter(RsyncAdapterName).Name())
+	assert.Equal(t, RsyncAdapterName, m.NewDownloadAdapter(RsyncAdapterName).Name())
+	assert.NotContains(t, m.GetUploadAdapterNames(), RsyncAdapterName)
+	assert.NotContains(t, m.GetDownloadAdapterNames(), RsyncAdapterName)
+}
+
+func TestRsyncProgress(t *testing.T) {
+	var reported []int64
+	cb := func(name string, totalSize, readSoFar int64, readSinceLast int) error {
+		reported = append(reported, readSoFar)
+		return nil
+	}
+
+	p := &rsyncProgress{t: &Transfer{Name: "a.dat", Size: 65536}, cb: cb}
+	p.Write([]byte("a.dat\n      32,768  50%    1.23MB/s    0:00:01\r"))
+	p.Write([]byte("      65,536 100%    1.23MB/s    0:00:02 (xfr#1, to-chk=0/1)\n"))
+	p.Flush()
+	p.advance(65536)
+
+	assert.Equal(t, []int64{32768, 65536}, reported)
+}
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, "/usr/bin/ssh", shellQuote("/usr/bin/ssh"))
+	assert.Equal(t, "-oControlPath=/tmp/ssh-%C", shellQuote("-oControlPath=/tmp/ssh-%C"))
+	assert.Equal(t, "'my lfs'", shellQuote("my lfs"))
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+	assert.Equal(t, "''", shellQuote(""))
+}
+
+func TestRsyncListedSize(t *testing.T) {
+	n, ok := rsyncListedSize("-rw-r--r--         12,345 2017/01/02 03:04:05 abcdef\n")
+	assert.True(t, ok)
+	assert.Equal(t, int64(12345), n)
+
+	_, ok = rsyncListedSize("drwxr-xr-x          4,096 2017/01/02 03:04:05 abcdef\n")
+	assert.False(t, ok)
+
+	_, ok = rsyncListedSize("")
+	assert.False(t, ok)
+}
@@ -1,8 +1,32 @@
-// Package transfer collects together adapters for uploading and downloading LFS content
-// NOTE: Subject to change, do not rely on this package from outside git-lfs source
+// Package tq collects together adapters for uploading and downloading LFS
+// content, and the queues which ask the server for objects and hand them to
+// the adapters.
+//
+// It may be used by other Go programs, such as CI agents or servers, to
+// transfer objects themselves. Its exported API is kept backwards compatible
+// within a major version of Git LFS. A Manifest built by NewManifestWithConfig
+// reads its settings from the given *config.Configuration, which the queues
+// and adapters using it, and the batch and verify API requests they make, are
+// given, so that a program may transfer the objects of several repositories
+// at once. Downloaded objects are written through the Manifest's ObjectStore,
+// which SetObjectStore replaces, and more adapters may be added with
+// RegisterNewAdapterFunc. A queue built with WithContext stops once its
+// context is done. Errors are returned, or collected by the queue's Errors(),
+// and never exit the process.
+//
+// Some things remain tied to the current repository, as found by the config
+// package: the chunk and compressed stores of its local storage, which the
+// chunked adapter and lfs.storagecompression use, and which are only used
+// while the ObjectStore is the local one; the working directories of custom
+// adapters given relative paths; and the quarantine of corrupt downloads,
+// unless the ObjectStore is replaced.
+//
+// Manifests built by NewManifest and NewManifestWithGitEnv read the
+// configuration of the current process, config.Config.
 package tq
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -17,6 +41,16 @@ const (
 	Download = Direction(iota)
 )
 
+func (d Direction) String() string {
+	switch d {
+	case Upload:
+		return "upload"
+	case Download:
+		return "download"
+	}
+	return "<unknown>"
+}
+
 type Transfer struct {
 	Name          string       `json:"name"`
 	Oid           string       `json:"oid,omitempty"`
@@ -156,8 +190,33 @@ type NewAdapterFunc func(name string, dir Direction) Adapter
 
 type ProgressCallback func(name string, totalSize, readSoFar int64, readSinceLast int) error
 
+// CommitCallback receives how many bytes of an object the remote has
+// acknowledged storing durably so far, such as the parts of a multipart upload
+// it has accepted, as opposed to the bytes written to it which a
+// ProgressCallback receives.
+type CommitCallback func(name, oid string, totalSize, committedSoFar int64)
+
+// CommitReporter is implemented by adapters which can report committed
+// progress. The TransferQueue sets its callback before calling Begin().
+type CommitReporter interface {
+	SetCommitCallback(cb CommitCallback)
+}
+
+// Cancellable is implemented by adapters whose transfers in flight stop once a
+// context is done. The TransferQueue sets its context before calling Begin().
+type Cancellable interface {
+	SetContext(ctx context.Context)
+}
+
 type AdapterConfig interface {
 	ConcurrentTransfers() int
+	// DiskBackpressure returns whether adapters which download to disk
+	// should run fewer transfers at once while the disk can't keep up.
+	DiskBackpressure() bool
+	// ConcurrencyBounds returns the fewest and the most transfers to run
+	// at once, between which adapters may tune the number by the
+	// observed throughput.
+	ConcurrencyBounds() (min, max int)
 }
 
 // Adapter is implemented by types which can upload and/or download LFS
@@ -1,13 +1,17 @@
 package tq
 
 import (
+	"context"
+	"net/url"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/git-lfs/git-lfs/api"
 	"github.com/git-lfs/git-lfs/config"
 	"github.com/git-lfs/git-lfs/errors"
 	"github.com/git-lfs/git-lfs/progress"
+	"github.com/git-lfs/git-lfs/tools"
 	"github.com/rubyist/tracerx"
 )
 
@@ -17,11 +21,16 @@ const (
 
 type retryCounter struct {
 	MaxRetries int `git:"lfs.transfer.maxretries"`
+	// MaxRateLimitRetries is the most times an object is retried because
+	// the server rate limited it.
+	MaxRateLimitRetries int
 
-	// cmu guards count
+	// cmu guards count and rateLimited
 	cmu sync.Mutex
 	// count maps OIDs to number of retry attempts
 	count map[string]int
+	// rateLimited maps OIDs to the number of times they were rate limited
+	rateLimited map[string]int
 }
 
 // newRetryCounter instantiates a new *retryCounter. It parses the gitconfig
@@ -32,8 +41,10 @@ type retryCounter struct {
 // be returned, otherwise nil.
 func newRetryCounter() *retryCounter {
 	return &retryCounter{
-		MaxRetries: defaultMaxRetries,
-		count:      make(map[string]int),
+		MaxRetries:          defaultMaxRetries,
+		MaxRateLimitRetries: defaultMaxRateLimitRetries,
+		count:               make(map[string]int),
+		rateLimited:         make(map[string]int),
 	}
 }
 
@@ -62,6 +73,19 @@ func (r *retryCounter) CanRetry(oid string) (int, bool) {
 	return count, count < r.MaxRetries
 }
 
+// RateLimited counts a rate limited request for the given OID, and returns how
+// many there have been, and whether the OID can be retried again (see:
+// retryCounter.MaxRateLimitRetries). It is safe to call across multiple
+// goroutines.
+func (r *retryCounter) RateLimited(oid string) (int, bool) {
+	r.cmu.Lock()
+	defer r.cmu.Unlock()
+
+	r.rateLimited[oid]++
+	count := r.rateLimited[oid]
+	return count, count <= r.MaxRateLimitRetries
+}
+
 // batch implements the sort.Interface interface and enables sorting on a slice
 // of `*Transfer`s by object size.
 //
@@ -85,6 +109,23 @@ func tupleToApiObject(t *objectTuple) *api.ObjectResource {
 	return &api.ObjectResource{Oid: t.Oid, Size: t.Size}
 }
 
+// readyTime returns the earliest time at which one of the objects in the batch
+// may be sent, if the server rate limited every one of them, or the zero time
+// if any may be sent now.
+func (b batch) readyTime() time.Time {
+	var earliest time.Time
+	now := time.Now()
+	for _, t := range b {
+		if !t.ReadyTime.After(now) {
+			return time.Time{}
+		}
+		if earliest.IsZero() || t.ReadyTime.Before(earliest) {
+			earliest = t.ReadyTime
+		}
+	}
+	return earliest
+}
+
 func (b batch) Len() int           { return len(b) }
 func (b batch) Less(i, j int) bool { return b[i].Size < b[j].Size }
 func (b batch) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
@@ -96,6 +137,7 @@ type TransferQueue struct {
 	direction         Direction
 	adapter           Adapter
 	adapterInProgress bool
+	adapterStarted    time.Time
 	adapterInitMutex  sync.Mutex
 	dryRun            bool
 	meter             progress.Meter
@@ -109,6 +151,9 @@ type TransferQueue struct {
 	watchers      []chan string
 	trMutex       *sync.Mutex
 	startProgress sync.Once
+	// avoidEndpoint switches to a mirror of the server once it has served
+	// a corrupt object.
+	avoidEndpoint sync.Once
 	collectorWait sync.WaitGroup
 	errorwait     sync.WaitGroup
 	// wait is used to keep track of pending transfers. It is incremented
@@ -117,11 +162,45 @@ type TransferQueue struct {
 	wait     sync.WaitGroup
 	manifest *Manifest
 	rc       *retryCounter
+	// attempts holds the errors of the attempts to transfer each object
+	// which were retried, keyed by OID and guarded by trMutex.
+	attempts map[string][]error
+	// committed holds how many bytes of each object the remote has
+	// acknowledged storing durably, for adapters which report it, keyed by
+	// OID and guarded by trMutex.
+	committed map[string]int64
+	journal   *Journal
+	// rateLimits maps hosts which rate limited a request to the time until
+	// which no more requests should be made to them.
+	rateLimits map[string]time.Time
+	rlMutex    sync.Mutex
+	// routes are the storage routes along which objects may be sent to
+	// another LFS server or storage class.
+	routes []*config.StorageRoute
+	// peers downloads objects from peers in the local network, if any
+	// were found, before they're asked for from the remote. askedPeers
+	// holds the objects already asked for, and is only used by the
+	// goroutine collecting batches.
+	peers      *peerClient
+	peersOnce  sync.Once
+	askedPeers map[string]bool
+	// transferWatchers are sent each completed transfer, with the actions
+	// the server gave for it.
+	transferWatchers []chan *Transfer
+	// budget limits the requests made to each host at once, together with
+	// the other queues sharing it, or is nil if they aren't limited.
+	budget *ConnectionBudget
+	// ctx stops the queue asking the server about the objects it hasn't
+	// yet, and cancels the transfers in flight, once it's done.
+	ctx context.Context
 }
 
 type objectTuple struct {
 	Name, Path, Oid string
 	Size            int64
+	// ReadyTime is the time before which the object shouldn't be sent
+	// again, because the server rate limited it.
+	ReadyTime time.Time
 }
 
 type Option func(*TransferQueue)
@@ -146,15 +225,43 @@ func WithBufferDepth(depth int) Option {
 	return func(tq *TransferQueue) { tq.bufferDepth = depth }
 }
 
+// WithJournal records the contents of the queue in the given *Journal as it
+// runs. Once the queue has finished, the journal is removed if every object in
+// it was transferred, or needed no transfer, and kept so that it can be resumed
+// otherwise.
+func WithJournal(j *Journal) Option {
+	return func(tq *TransferQueue) { tq.journal = j }
+}
+
+// WithConnectionBudget counts the queue's batch API calls and transfers against
+// the given *ConnectionBudget, shared with other queues.
+func WithConnectionBudget(b *ConnectionBudget) Option {
+	return func(tq *TransferQueue) { tq.budget = b }
+}
+
+// WithContext stops the queue asking the server about the objects it hasn't
+// yet once the given context is done, failing them with the context's error
+// instead. The transfers already begun are cancelled too, by the adapters
+// which are Cancellable, and carry on until they finish otherwise.
+func WithContext(ctx context.Context) Option {
+	return func(tq *TransferQueue) { tq.ctx = ctx }
+}
+
 // NewTransferQueue builds a TransferQueue, direction and underlying mechanism determined by adapter
 func NewTransferQueue(dir Direction, manifest *Manifest, options ...Option) *TransferQueue {
 	q := &TransferQueue{
-		direction: dir,
-		errorc:    make(chan error),
-		transfers: make(map[string]*objectTuple),
-		trMutex:   &sync.Mutex{},
-		manifest:  manifest,
-		rc:        newRetryCounter(),
+		direction:  dir,
+		errorc:     make(chan error),
+		transfers:  make(map[string]*objectTuple),
+		trMutex:    &sync.Mutex{},
+		attempts:   make(map[string][]error),
+		committed:  make(map[string]int64),
+		manifest:   manifest,
+		rc:         newRetryCounter(),
+		rateLimits: make(map[string]time.Time),
+		routes:     manifest.Config().StorageRoutes(),
+		askedPeers: make(map[string]bool),
+		ctx:        context.Background(),
 	}
 
 	for _, opt := range options {
@@ -162,6 +269,12 @@ func NewTransferQueue(dir Direction, manifest *Manifest, options ...Option) *Tra
 	}
 
 	q.rc.MaxRetries = q.manifest.maxRetries
+	q.rc.MaxRateLimitRetries = q.manifest.maxRateLimitRetries
+	if q.journal != nil {
+		for oid, count := range q.journal.retries {
+			q.rc.count[oid] = count
+		}
+	}
 
 	if q.batchSize <= 0 {
 		q.batchSize = defaultBatchSize
@@ -212,6 +325,9 @@ func (q *TransferQueue) remember(t *objectTuple) bool {
 	if _, ok := q.transfers[t.Oid]; !ok {
 		q.wait.Add(1)
 		q.transfers[t.Oid] = t
+		if q.journal != nil {
+			q.journal.add(t)
+		}
 
 		return true
 	}
@@ -227,8 +343,10 @@ func (q *TransferQueue) remember(t *objectTuple) bool {
 //      a. If the read was a channel close, go to step 4.
 //      b. If the read was a TransferTransferable item, go to step 3.
 //   3. Append the item to the batch.
-//   4. Sort the batch by descending object size, make a batch API call, send
-//      the items to the `*adapterBase`.
+//   4. If the server rate limited every item in the batch, wait until the
+//      first of them may be sent. If the queue's context is done, fail the
+//      items and go to step 6. Sort the batch by descending object size,
+//      make a batch API call, send the items to the `*adapterBase`.
 //   5. Process the worker results, incrementing and appending retries if
 //      possible.
 //   6. If the `q.incoming` channel is open, go to step 2.
@@ -253,6 +371,24 @@ func (q *TransferQueue) collectBatches() {
 			batch = append(batch, t)
 		}
 
+		// If the server rate limited every object in the batch, wait
+		// until the first of them may be sent again.
+		if at := batch.readyTime(); !at.IsZero() {
+			tracerx.Printf("tq: waiting until %s to retry rate limited objects", at.Format(time.RFC3339))
+			q.sleep(at.Sub(time.Now()))
+		}
+
+		// Once the queue's context is done, fail the objects instead
+		// of asking the server about them.
+		if err := q.ctx.Err(); err != nil {
+			q.cancelBatch(batch, err)
+			if closing {
+				break
+			}
+			batch = q.makeBatch()
+			continue
+		}
+
 		// Before enqueuing the next batch, sort by descending object
 		// size.
 		sort.Sort(sort.Reverse(batch))
@@ -270,35 +406,153 @@ func (q *TransferQueue) collectBatches() {
 	}
 }
 
-// enqueueAndCollectRetriesFor makes a Batch API call and returns a "next" batch
-// containing all of the objects that failed from the previous batch and had
-// retries availale to them.
+// enqueueAndCollectRetriesFor makes a Batch API call for the objects sent along
+// each storage route in the batch, and returns a "next" batch containing all of
+// the objects that failed and had retries available to them, along with the
+// last error encountered making an API request, if any. Downloads which peers
+// in the local network can serve are made from them instead, when enabled.
+func (q *TransferQueue) enqueueAndCollectRetriesFor(batch batch) (batch, error) {
+	if q.direction == Download && !q.dryRun && q.manifest.Config().PeersEnabled() {
+		batch = q.fetchFromPeers(batch)
+	}
+
+	routes, routed := q.route(batch)
+
+	next := q.makeBatch()
+	var err error
+	for i, route := range routes {
+		retries, rerr := q.enqueueRouteAndCollectRetriesFor(route, routed[i])
+		next = append(next, retries...)
+		if rerr != nil {
+			err = rerr
+		}
+	}
+
+	return next, err
+}
+
+// route splits the batch by the storage route along which each of its objects
+// is sent, keeping their order. The objects which aren't routed are sent along
+// the nil route.
+func (q *TransferQueue) route(b batch) ([]*config.StorageRoute, []batch) {
+	var routes []*config.StorageRoute
+	var routed []batch
+	indexes := make(map[*config.StorageRoute]int)
+
+	for _, t := range b {
+		var route *config.StorageRoute
+		for _, r := range q.routes {
+			if r.Matches(t.Name, t.Size) {
+				route = r
+				break
+			}
+		}
+
+		i, ok := indexes[route]
+		if !ok {
+			i = len(routes)
+			indexes[route] = i
+			routes = append(routes, route)
+			routed = append(routed, q.makeBatch())
+		}
+		routed[i] = append(routed[i], t)
+	}
+
+	return routes, routed
+}
+
+// enqueueRouteAndCollectRetriesFor makes a Batch API call for objects sent
+// along the given storage route, and returns a "next" batch containing all of
+// the objects that failed from the previous batch and had retries availale to
+// them.
 //
 // If an error was encountered while making the API request, _all_ of the items
 // from the previous batch (that have retries available to them) will be
 // returned immediately, along with the error that was encountered.
 //
-// enqueueAndCollectRetriesFor blocks until the entire Batch "batch" has been
+// Objects which the server rate limited, and objects whose transfers would be
+// made to a host which is rate limiting requests, are returned in the "next"
+// batch until the time the server gave, without counting as retries, until
+// they've been rate limited more than lfs.transfer.maxratelimitretries times.
+//
+// enqueueRouteAndCollectRetriesFor blocks until the entire Batch "batch" has been
 // processed.
-func (q *TransferQueue) enqueueAndCollectRetriesFor(batch batch) (batch, error) {
-	cfg := config.Config
+func (q *TransferQueue) enqueueRouteAndCollectRetriesFor(route *config.StorageRoute, batch batch) (batch, error) {
+	cfg := q.manifest.Config()
 
 	next := q.makeBatch()
 	transferAdapterNames := q.manifest.GetAdapterNames(q.direction)
 
-	tracerx.Printf("tq: sending batch of size %d", len(batch))
+	now := time.Now()
+	ready := q.makeBatch()
+	for _, t := range batch {
+		if t.ReadyTime.After(now) {
+			next = append(next, t)
+		} else {
+			ready = append(ready, t)
+		}
+	}
+	batch = ready
 
-	objs, adapterName, err := api.Batch(
-		cfg, batch.ApiObjects(), q.transferKind(), transferAdapterNames,
-	)
-	if err != nil {
+	apiHost := hostOf(cfg.StorageEndpoint(route, q.transferKind()).Url)
+	if until := q.rateLimitedUntil(apiHost); until.After(now) {
+		tracerx.Printf("tq: waiting until %s for rate limit on %s", until.Format(time.RFC3339), apiHost)
+		q.sleep(until.Sub(now))
+	}
+
+	var objs []*api.ObjectResource
+	var adapterName string
+	var err error
+	if endpoint := cfg.StorageEndpoint(route, q.transferKind()); endpoint.IsRsync() {
+		tracerx.Printf("tq: transferring batch of size %d with rsync", len(batch))
+		objs, adapterName = rsyncBatch(endpoint, batch.ApiObjects(), q.transferKind()), RsyncAdapterName
+	} else if endpoint.IsWebdav() {
+		tracerx.Printf("tq: transferring batch of size %d with WebDAV", len(batch))
+		objs, adapterName = webdavBatch(endpoint, batch.ApiObjects(), q.transferKind()), WebdavAdapterName
+	} else if endpoint.IsIpfs() {
+		tracerx.Printf("tq: transferring batch of size %d with IPFS", len(batch))
+		objs, adapterName = ipfsBatch(endpoint, batch.ApiObjects(), q.transferKind()), IpfsAdapterName
+	} else {
+		tracerx.Printf("tq: sending batch of size %d", len(batch))
+		q.budget.Acquire(apiHost)
+		batchStarted := time.Now()
+		objs, adapterName, err = api.BatchRoute(
+			q.ctx, cfg, route, batch.ApiObjects(), q.transferKind(), transferAdapterNames,
+		)
+		tools.TracePerformanceSince(batchStarted, "batch: %d object(s)", len(batch))
+		q.budget.Release(apiHost)
+	}
+	if readyTime, ok := errors.IsRetriableLaterError(err); ok {
+		// If the server rate limited the batch API call, send all
+		// of its objects again once it allows it, unless it has
+		// rate limited them too many times already.
+		q.rateLimit(apiHost, readyTime)
+		for _, t := range batch {
+			if q.canRetryRateLimited(t.Oid) {
+				t.ReadyTime = readyTime
+				next = append(next, t)
+			} else {
+				q.errorc <- q.objectError(t.Oid, err)
+				q.Skip(t.Size)
+				q.wait.Done()
+			}
+		}
+
+		return next, nil
+	} else if cerr := q.ctx.Err(); err != nil && cerr != nil {
+		// If the batch API call was cancelled, fail its objects
+		// rather than retrying them.
+		q.cancelBatch(batch, cerr)
+		return next, nil
+	} else if err != nil {
 		// If there was an error making the batch API call, mark all of
 		// the objects for retry, and return them along with the error
 		// that was encountered. If any of the objects couldn't be
 		// retried, they will be marked as failed.
 		for _, t := range batch {
 			if q.canRetryObject(t.Oid, err) {
-				q.rc.Increment(t.Oid)
+				q.incrementRetries(t.Oid)
+				q.recordAttempt(t.Oid, err)
 
 				next = append(next, t)
 			} else {
@@ -312,11 +566,17 @@ func (q *TransferQueue) enqueueAndCollectRetriesFor(batch batch) (batch, error)
 	q.useAdapter(adapterName)
 	q.startProgress.Do(q.meter.Start)
 
+	// Queues which only check that objects can be downloaded have to ask
+	// endpoints without a batch API whether they have them.
+	if checker, ok := q.adapter.(objectChecker); ok && q.dryRun && q.direction == Download {
+		checkDirectObjects(checker, objs, q.transferKind())
+	}
+
 	toTransfer := make([]*Transfer, 0, len(objs))
 
 	for _, o := range objs {
 		if o.Error != nil {
-			q.errorc <- errors.Wrapf(o.Error, "[%v] %v", o.Oid, o.Error.Message)
+			q.errorc <- q.objectError(o.Oid, errors.Wrapf(o.Error, "[%v] %v", o.Oid, o.Error.Message))
 			q.Skip(o.Size)
 			q.wait.Done()
 
@@ -331,30 +591,41 @@ func (q *TransferQueue) enqueueAndCollectRetriesFor(batch batch) (batch, error)
 			// Transfer object, then we give up on the
 			// transfer by telling the progress meter to
 			// skip the number of bytes in "o".
-			q.errorc <- errors.Errorf("[%v] The server returned an unknown OID.", o.Oid)
+			q.errorc <- q.objectError(o.Oid, errors.Errorf("[%v] The server returned an unknown OID.", o.Oid))
 
 			q.Skip(o.Size)
 			q.wait.Done()
 		} else {
 			tr := newTransfer(t.Name, o, t.Path)
 
-			if _, err := tr.Actions.Get(q.transferKind()); err != nil {
+			rel, err := tr.Actions.Get(q.transferKind())
+			if err != nil {
 				// XXX(taylor): duplication
 				if q.canRetryObject(tr.Oid, err) {
-					q.rc.Increment(tr.Oid)
+					q.incrementRetries(tr.Oid)
+					q.recordAttempt(tr.Oid, err)
 					count := q.rc.CountFor(tr.Oid)
 
 					tracerx.Printf("tq: enqueue retry #%d for %q (size: %d)", count, tr.Oid, tr.Size)
 					next = append(next, t)
 				} else {
 					if !IsActionMissingError(err) {
-						q.errorc <- errors.Errorf("[%v] %v", tr.Name, err)
+						q.errorc <- q.objectError(tr.Oid, errors.Errorf("[%v] %v", tr.Name, err))
+					} else if q.journal != nil {
+						// The remote needs nothing done with
+						// the object, such as an upload it
+						// already has.
+						q.journal.done(tr.Oid)
 					}
 
 					q.Skip(o.Size)
 					q.wait.Done()
 				}
 
+			} else if until := q.rateLimitedUntil(hostOf(rel.Href)); until.After(time.Now()) {
+				tracerx.Printf("tq: delaying %q until %s for rate limit", tr.Oid, until.Format(time.RFC3339))
+				t.ReadyTime = until
+				next = append(next, t)
 			} else {
 				q.meter.StartTransfer(t.Name)
 				toTransfer = append(toTransfer, tr)
@@ -364,10 +635,14 @@ func (q *TransferQueue) enqueueAndCollectRetriesFor(batch batch) (batch, error)
 
 	retries := q.addToAdapter(toTransfer)
 	for t := range retries {
-		q.rc.Increment(t.Oid)
-		count := q.rc.CountFor(t.Oid)
+		if t.ReadyTime.After(time.Now()) {
+			tracerx.Printf("tq: enqueue rate limited retry for %q (size: %d)", t.Oid, t.Size)
+		} else {
+			q.incrementRetries(t.Oid)
+			count := q.rc.CountFor(t.Oid)
 
-		tracerx.Printf("tq: enqueue retry #%d for %q (size: %d)", count, t.Oid, t.Size)
+			tracerx.Printf("tq: enqueue retry #%d for %q (size: %d)", count, t.Oid, t.Size)
+		}
 
 		next = append(next, t)
 	}
@@ -375,6 +650,30 @@ func (q *TransferQueue) enqueueAndCollectRetriesFor(batch batch) (batch, error)
 	return next, nil
 }
 
+// cancelBatch fails each object in the batch with the given error, without
+// retrying it.
+func (q *TransferQueue) cancelBatch(b batch, err error) {
+	for _, t := range b {
+		q.errorc <- q.objectError(t.Oid, err)
+		q.Skip(t.Size)
+		q.wait.Done()
+	}
+}
+
+// sleep waits for the given duration, or until the queue's context is done.
+func (q *TransferQueue) sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-q.ctx.Done():
+	}
+}
+
 // makeBatch returns a new, empty batch, with a capacity equal to the maximum
 // batch size designated by the `*TransferQueue`.
 func (q *TransferQueue) makeBatch() batch { return make(batch, 0, q.batchSize) }
@@ -442,11 +741,42 @@ func (q *TransferQueue) handleTransferResult(
 		// If there was an error encountered when processing the
 		// transfer (res.Transfer), handle the error as is appropriate:
 
-		if q.canRetryObject(oid, res.Error) {
+		if readyTime, ok := errors.IsRetriableLaterError(res.Error); ok {
+			// If the server rate limited the transfer, pause
+			// transfers to its host, and send the object on the
+			// retries channel to be retried once it allows it,
+			// without counting against its retries, unless it has
+			// been rate limited too many times already.
+			if a, ok := res.Transfer.Actions[q.transferKind()]; ok {
+				q.rateLimit(hostOf(a.Href), readyTime)
+			}
+
+			q.trMutex.Lock()
+			t, ok := q.transfers[oid]
+			q.trMutex.Unlock()
+
+			if ok && q.canRetryRateLimited(oid) {
+				t.ReadyTime = readyTime
+				retries <- t
+			} else {
+				q.errorc <- q.transferError(res.Transfer, res.Error)
+				q.wait.Done()
+			}
+		} else if q.canRetryObject(oid, res.Error) {
 			// If the object can be retried, send it on the retries
 			// channel, where it will be read at the call-site and
 			// its retry count will be incremented.
 			tracerx.Printf("tq: retrying object %s", oid)
+			q.recordAttempt(oid, res.Error)
+
+			// If the object was corrupt, download it again from a
+			// mirror of the server, if there is one, or otherwise
+			// from scratch.
+			if errors.IsCorruptObjectError(res.Error) {
+				q.avoidEndpoint.Do(func() {
+					q.manifest.Config().AvoidEndpoint("download")
+				})
+			}
 
 			q.trMutex.Lock()
 			t, ok := q.transfers[oid]
@@ -455,14 +785,14 @@ func (q *TransferQueue) handleTransferResult(
 			if ok {
 				retries <- t
 			} else {
-				q.errorc <- res.Error
+				q.errorc <- q.transferError(res.Transfer, res.Error)
 			}
 		} else {
 			// If the error wasn't retriable, OR the object has
 			// exceeded its retry budget, it will be NOT be sent to
 			// the retry channel, and the error will be reported
 			// immediately.
-			q.errorc <- res.Error
+			q.errorc <- q.transferError(res.Transfer, res.Error)
 			q.wait.Done()
 		}
 	} else {
@@ -471,6 +801,22 @@ func (q *TransferQueue) handleTransferResult(
 		for _, c := range q.watchers {
 			c <- oid
 		}
+		for _, c := range q.transferWatchers {
+			c <- res.Transfer
+		}
+
+		// An object transferred by an adapter which reports committed
+		// progress is committed in full, whether or not it said so.
+		q.trMutex.Lock()
+		_, reported := q.committed[oid]
+		q.trMutex.Unlock()
+		if reported {
+			q.commit(res.Transfer.Name, oid, res.Transfer.Size, res.Transfer.Size)
+		}
+
+		if q.journal != nil {
+			q.journal.done(oid)
+		}
 
 		q.meter.FinishTransfer(res.Transfer.Name)
 		q.wait.Done()
@@ -498,6 +844,7 @@ func (q *TransferQueue) useAdapter(name string) {
 func (q *TransferQueue) finishAdapter() {
 	if q.adapterInProgress {
 		q.adapter.End()
+		tools.TracePerformanceSince(q.adapterStarted, "transfer: %s adapter", q.adapter.Name())
 		q.adapterInProgress = false
 		q.adapter = nil
 	}
@@ -529,12 +876,26 @@ func (q *TransferQueue) ensureAdapterBegun() error {
 		return nil
 	}
 
+	// Commit callback - receives durable progress, if the adapter reports it
+	if reporter, ok := q.adapter.(CommitReporter); ok {
+		reporter.SetCommitCallback(q.commit)
+	}
+
+	if budgeter, ok := q.adapter.(ConnectionBudgeter); ok {
+		budgeter.SetConnectionBudget(q.budget)
+	}
+
+	if c, ok := q.adapter.(Cancellable); ok {
+		c.SetContext(q.ctx)
+	}
+
 	tracerx.Printf("tq: starting transfer adapter %q", q.adapter.Name())
 	err := q.adapter.Begin(q.manifest, cb)
 	if err != nil {
 		return err
 	}
 	q.adapterInProgress = true
+	q.adapterStarted = time.Now()
 
 	return nil
 }
@@ -554,9 +915,16 @@ func (q *TransferQueue) Wait() {
 	for _, watcher := range q.watchers {
 		close(watcher)
 	}
+	for _, watcher := range q.transferWatchers {
+		close(watcher)
+	}
 
 	q.meter.Finish()
 	q.errorwait.Wait()
+
+	if q.journal != nil {
+		q.journal.Finish()
+	}
 }
 
 // Watch returns a channel where the queue will write the OID of each transfer
@@ -567,6 +935,16 @@ func (q *TransferQueue) Watch() chan string {
 	return c
 }
 
+// WatchTransfers returns a channel where the queue will write each transfer as
+// it completes, along with the actions the server gave for it, which is how
+// queues which only check objects can tell where they'd be transferred. The
+// channel will be closed when the queue finishes processing.
+func (q *TransferQueue) WatchTransfers() chan *Transfer {
+	c := make(chan *Transfer, q.batchSize)
+	q.transferWatchers = append(q.transferWatchers, c)
+	return c
+}
+
 // This goroutine collects errors returned from transfers
 func (q *TransferQueue) errorCollector() {
 	for err := range q.errorc {
@@ -585,6 +963,139 @@ func (q *TransferQueue) run() {
 	go q.collectBatches()
 }
 
+// rateLimit records that the given host rate limited a request, and that no
+// more requests should be made to it until the given time.
+func (q *TransferQueue) rateLimit(host string, until time.Time) {
+	q.rlMutex.Lock()
+	if until.After(q.rateLimits[host]) {
+		q.rateLimits[host] = until
+	}
+	q.rlMutex.Unlock()
+
+	tracerx.Printf("tq: rate limited by %s until %s", host, until.Format(time.RFC3339))
+	q.meter.RateLimited(until)
+}
+
+// rateLimitedUntil returns the time until which no more requests should be made
+// to the given host, which is in the past if it isn't rate limiting requests.
+func (q *TransferQueue) rateLimitedUntil(host string) time.Time {
+	q.rlMutex.Lock()
+	defer q.rlMutex.Unlock()
+
+	return q.rateLimits[host]
+}
+
+// commit records that the remote has acknowledged storing the first
+// committedSoFar bytes of the object given by "oid", in the meter and the
+// journal. Progress is only ever counted once, so that an attempt which
+// resumes from what the remote already has, or a retry which starts over,
+// doesn't count it again.
+func (q *TransferQueue) commit(name, oid string, total, committedSoFar int64) {
+	q.trMutex.Lock()
+	last, reported := q.committed[oid]
+	if reported && committedSoFar <= last {
+		q.trMutex.Unlock()
+		return
+	}
+	q.committed[oid] = committedSoFar
+	q.trMutex.Unlock()
+
+	if committedSoFar == last {
+		return
+	}
+	q.meter.Commit(committedSoFar - last)
+	if q.journal != nil {
+		q.journal.commit(oid, committedSoFar)
+	}
+}
+
+// objectChecker is implemented by the adapters of endpoints without a batch
+// API, to tell whether the object of the given size is stored at the given URL.
+type objectChecker interface {
+	HasObject(href string, size int64) (bool, error)
+}
+
+// checkDirectObjects removes the actions of the objects made up by rsyncBatch,
+// webdavBatch or ipfsBatch which the endpoint doesn't have, as a server would,
+// so that they're skipped.
+func checkDirectObjects(checker objectChecker, objects []*api.ObjectResource, kind string) {
+	for _, o := range objects {
+		rel, ok := o.Actions[kind]
+		if !ok {
+			continue
+		}
+
+		has, err := checker.HasObject(rel.Href, o.Size)
+		if err != nil {
+			o.Error = &api.ObjectError{Code: 500, Message: err.Error()}
+		} else if !has {
+			tracerx.Printf("tq: %s is not stored at %s", o.Oid, rel.Href)
+			delete(o.Actions, kind)
+		}
+	}
+}
+
+// hostOf returns the host of the given URL, or the empty string if it can't be
+// parsed.
+func hostOf(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// recordAttempt records err as the error of an attempt to transfer the object
+// given by "oid" which is to be retried.
+func (q *TransferQueue) recordAttempt(oid string, err error) {
+	q.trMutex.Lock()
+	q.attempts[oid] = append(q.attempts[oid], err)
+	q.trMutex.Unlock()
+}
+
+// objectError returns err as a *TransferError about the object given by "oid",
+// along with the errors of its earlier attempts.
+func (q *TransferQueue) objectError(oid string, err error) *TransferError {
+	q.trMutex.Lock()
+	t := q.transfers[oid]
+	retries := q.attempts[oid]
+	q.trMutex.Unlock()
+
+	e := &TransferError{
+		Oid:        oid,
+		Action:     q.transferKind(),
+		StatusCode: statusCodeOf(err),
+		Retries:    retries,
+		Err:        err,
+	}
+	if t != nil {
+		e.Name, e.Path = t.Name, t.Path
+	}
+	if isVerifyError(err) {
+		e.Action = "verify"
+	}
+	return e
+}
+
+// transferError is objectError for an error transferring t, recording the host
+// of the action it failed on.
+func (q *TransferQueue) transferError(t *Transfer, err error) *TransferError {
+	e := q.objectError(t.Oid, err)
+	if a, ok := t.Actions[q.transferKind()]; ok {
+		e.Host = hostOf(a.Href)
+	}
+	return e
+}
+
+// incrementRetries increments the number of retries for the object given by
+// "oid", recording it in the journal if there is one.
+func (q *TransferQueue) incrementRetries(oid string) {
+	q.rc.Increment(oid)
+	if q.journal != nil {
+		q.journal.retry(oid)
+	}
+}
+
 // canRetry returns whether or not the given error "err" is retriable.
 func (q *TransferQueue) canRetry(err error) bool {
 	return errors.IsRetriableError(err)
@@ -603,7 +1114,19 @@ func (q *TransferQueue) canRetryObject(oid string, err error) bool {
 	return q.canRetry(err)
 }
 
-// Errors returns any errors encountered during transfer.
+// canRetryRateLimited counts a rate limited request for the object given by
+// "oid", and returns whether it can be retried again once the server allows
+// it.
+func (q *TransferQueue) canRetryRateLimited(oid string) bool {
+	if count, ok := q.rc.RateLimited(oid); !ok {
+		tracerx.Printf("tq: refusing to retry %q, rate limited too many times (%d)", oid, count)
+		return false
+	}
+	return true
+}
+
+// Errors returns any errors encountered during transfer. Those which concern a
+// single object are *TransferErrors.
 func (q *TransferQueue) Errors() []error {
 	return q.errors
 }
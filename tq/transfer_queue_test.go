@@ -1,8 +1,11 @@
 package tq
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/git-lfs/git-lfs/config"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,3 +32,80 @@ func TestRetryCounterCanNotRetryAfterExceedingRetryCount(t *testing.T) {
 	assert.Equal(t, 1, count)
 	assert.False(t, canRetry)
 }
+
+func TestManifestDefaultsToBoundedRateLimitRetries(t *testing.T) {
+	assert.Equal(t, 10, NewManifest().MaxRateLimitRetries())
+}
+
+func TestRetryCounterCanNotRetryAfterBeingRateLimitedTooOften(t *testing.T) {
+	rc := newRetryCounter()
+	rc.MaxRateLimitRetries = 2
+
+	for i := 1; i <= 2; i++ {
+		count, canRetry := rc.RateLimited("oid")
+		assert.Equal(t, i, count)
+		assert.True(t, canRetry)
+	}
+
+	count, canRetry := rc.RateLimited("oid")
+	assert.Equal(t, 3, count)
+	assert.False(t, canRetry)
+	assert.Equal(t, 0, rc.CountFor("oid"))
+}
+
+func TestBatchReadyTimeIsZeroIfAnyObjectIsReady(t *testing.T) {
+	b := batch{
+		{Oid: "a", ReadyTime: time.Now().Add(time.Minute)},
+		{Oid: "b"},
+	}
+
+	assert.True(t, b.readyTime().IsZero())
+}
+
+func TestBatchReadyTimeIsEarliestIfAllObjectsAreRateLimited(t *testing.T) {
+	earliest := time.Now().Add(time.Minute)
+	b := batch{
+		{Oid: "a", ReadyTime: earliest.Add(time.Minute)},
+		{Oid: "b", ReadyTime: earliest},
+	}
+
+	assert.Equal(t, earliest, b.readyTime())
+}
+
+func TestTransferQueueWithDoneContextFailsObjects(t *testing.T) {
+	cfg := config.NewFrom(config.Values{
+		Git: map[string]string{"lfs.url": "http://127.0.0.1:0/lfs"},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	q := NewTransferQueue(Download, NewManifestWithConfig(cfg), WithContext(ctx))
+	q.Add("a.dat", "a.dat", "a", 1)
+	q.Add("b.dat", "b.dat", "b", 2)
+	q.Wait()
+
+	errs := q.Errors()
+	if assert.Len(t, errs, 2) {
+		for _, err := range errs {
+			assert.Equal(t, context.Canceled, err.(*TransferError).Err)
+		}
+	}
+}
+
+func TestAdapterRequestsUseQueueContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := newAdapterBase("basic", Download, nil)
+	req, err := a.newRequest("GET", "http://127.0.0.1:0/objects/a", nil)
+	if assert.Nil(t, err) {
+		assert.Equal(t, context.Background(), req.Context())
+	}
+
+	a.SetContext(ctx)
+	req, err = a.newRequest("GET", "http://127.0.0.1:0/objects/a", nil)
+	if assert.Nil(t, err) {
+		assert.Equal(t, ctx, req.Context())
+	}
+}
@@ -1,11 +1,20 @@
 package tq
 
 import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/git-lfs/git-lfs/api"
 	"github.com/git-lfs/git-lfs/config"
@@ -20,9 +29,19 @@ const (
 	TusVersion     = "1.0.0"
 )
 
+// tusChecksumAlgorithms are the algorithms of the tus.io checksum extension
+// which uploads can be checked with, in order of preference.
+var tusChecksumAlgorithms = []string{"sha256", "sha1", "md5"}
+
 // Adapter for tus.io protocol resumaable uploads
 type tusUploadAdapter struct {
 	*adapterBase
+
+	// checksums holds the checksum algorithm to use for each server, by
+	// host, or an empty string if the server doesn't support the
+	// checksum extension.
+	checksums   map[string]string
+	checksumsMu sync.Mutex
 }
 
 func (a *tusUploadAdapter) ClearTempStorage() error {
@@ -49,12 +68,12 @@ func (a *tusUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressC
 	// 1. Send HEAD request to determine upload start point
 	//    Request must include Tus-Resumable header (version)
 	tracerx.Printf("xfer: sending tus.io HEAD request for %q", t.Oid)
-	req, err := httputil.NewHttpRequest("HEAD", rel.Href, rel.Header)
+	req, err := a.newRequest("HEAD", rel.Href, rel.Header)
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Tus-Resumable", TusVersion)
-	res, err := httputil.DoHttpRequest(config.Config, req, false)
+	res, err := httputil.DoHttpRequest(a.config(), req, false)
 	if err != nil {
 		return errors.NewRetriableError(err)
 	}
@@ -73,10 +92,14 @@ func (a *tusUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressC
 	if offset >= t.Size {
 		tracerx.Printf("xfer: tus.io HEAD offset %d indicates %q is already fully uploaded, skipping", offset, t.Oid)
 		advanceCallbackProgress(cb, t, t.Size)
+		a.commit(t, t.Size)
 		return nil
 	}
 
 	// Open file for uploading
+	if err := ensureWholeObject(a.objects(), t); err != nil {
+		return errors.Wrap(err, "tus upload")
+	}
 	f, err := os.OpenFile(t.Path, os.O_RDONLY, 0644)
 	if err != nil {
 		return errors.Wrap(err, "tus upload")
@@ -89,6 +112,7 @@ func (a *tusUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressC
 	} else {
 		tracerx.Printf("xfer: tus.io resuming upload %q from %d", t.Oid, offset)
 		advanceCallbackProgress(cb, t, offset)
+		a.commit(t, offset)
 		_, err := f.Seek(offset, os.SEEK_CUR)
 		if err != nil {
 			return errors.Wrap(err, "tus upload")
@@ -99,9 +123,11 @@ func (a *tusUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressC
 	//    Response status must be 204
 	//    Response Upload-Offset must be request Upload-Offset plus sent bytes
 	//    Response may include Upload-Expires header in which case check not passed
+	//    If the server supports the checksum extension, the bytes sent are
+	//    checked against Upload-Checksum, with status 460 on a mismatch
 
 	tracerx.Printf("xfer: sending tus.io PATCH request for %q", t.Oid)
-	req, err = httputil.NewHttpRequest("PATCH", rel.Href, rel.Header)
+	req, err = a.newRequest("PATCH", rel.Href, rel.Header)
 	if err != nil {
 		return err
 	}
@@ -111,6 +137,15 @@ func (a *tusUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressC
 	req.Header.Set("Content-Length", strconv.FormatInt(t.Size-offset, 10))
 	req.ContentLength = t.Size - offset
 
+	if algorithm := a.checksumAlgorithm(rel); len(algorithm) > 0 {
+		checksum, err := tusChecksum(f, algorithm, offset, t.Size-offset)
+		if err != nil {
+			return errors.Wrap(err, "tus upload")
+		}
+		tracerx.Printf("xfer: tus.io uploading %q with %s checksum", t.Oid, algorithm)
+		req.Header.Set("Upload-Checksum", fmt.Sprintf("%s %s", algorithm, checksum))
+	}
+
 	// Ensure progress callbacks made while uploading
 	// Wrap callback to give name context
 	ccb := func(totalSize int64, readSoFar int64, readSinceLast int) error {
@@ -135,11 +170,16 @@ func (a *tusUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressC
 
 	req.Body = ioutil.NopCloser(reader)
 
-	res, err = httputil.DoHttpRequest(config.Config, req, false)
+	res, err = httputil.DoHttpRequest(a.config(), req, false)
 	if err != nil {
-		return errors.NewRetriableError(err)
+		// Status 460 means the bytes the server received didn't match
+		// Upload-Checksum, and were discarded, so send them again.
+		if res != nil && res.StatusCode == 460 {
+			return errors.NewRetriableError(fmt.Errorf("tus.io checksum mismatch uploading %q from %d, retrying", t.Oid, offset))
+		}
+		return withStatus(errors.NewRetriableError(err), res)
 	}
-	httputil.LogTransfer(config.Config, "lfs.data.upload", res)
+	httputil.LogTransfer(a.config(), "lfs.data.upload", res)
 
 	// A status code of 403 likely means that an authentication token for the
 	// upload has expired. This can be safely retried.
@@ -155,14 +195,128 @@ func (a *tusUploadAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressC
 	io.Copy(ioutil.Discard, res.Body)
 	res.Body.Close()
 
-	return api.VerifyUpload(config.Config, toApiObject(t))
+	// The server must have all of the object now; if not, the next attempt
+	// resumes from wherever it got to.
+	if offHdr := res.Header.Get("Upload-Offset"); len(offHdr) > 0 {
+		offset, err := strconv.ParseInt(offHdr, 10, 64)
+		if err == nil {
+			a.commit(t, offset)
+		}
+		if err != nil || offset != t.Size {
+			return errors.NewRetriableError(fmt.Errorf("tus.io upload of %q ended at offset %q, expected %d", t.Oid, offHdr, t.Size))
+		}
+	}
+
+	return newVerifyError(api.VerifyUpload(a.config(), toApiObject(t)))
+}
+
+// checksumAlgorithm returns the algorithm of the tus.io checksum extension to
+// check uploads to the server of rel with, or an empty string if it doesn't
+// support one we know. Servers are asked once each, with an OPTIONS request.
+func (a *tusUploadAdapter) checksumAlgorithm(rel *Action) string {
+	u, err := url.Parse(rel.Href)
+	if err != nil {
+		return ""
+	}
+
+	a.checksumsMu.Lock()
+	algorithm, ok := a.checksums[u.Host]
+	a.checksumsMu.Unlock()
+	if ok {
+		return algorithm
+	}
+
+	// the lock isn't held while the server is asked, so that the other
+	// workers aren't held up by it, although they may ask it too.
+	algorithm = discoverTusChecksumAlgorithm(a.context(), a.config(), rel)
+
+	a.checksumsMu.Lock()
+	a.checksums[u.Host] = algorithm
+	a.checksumsMu.Unlock()
+	return algorithm
+}
+
+// discoverTusChecksumAlgorithm asks the server of rel which tus.io extensions
+// it supports, returning the preferred checksum algorithm if it supports the
+// checksum extension, as configured by cfg. The request is cancelled once ctx
+// is done.
+func discoverTusChecksumAlgorithm(ctx context.Context, cfg *config.Configuration, rel *Action) string {
+	tracerx.Printf("xfer: sending tus.io OPTIONS request to %q", rel.Href)
+	req, err := httputil.NewHttpRequestContext(ctx, "OPTIONS", rel.Href, rel.Header)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Tus-Resumable", TusVersion)
+
+	res, err := httputil.DoHttpRequest(cfg, req, false)
+	if err != nil {
+		tracerx.Printf("xfer: tus.io OPTIONS request failed, not using checksums: %s", err)
+		return ""
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	if !tusHeaderContains(res.Header.Get("Tus-Extension"), "checksum") {
+		return ""
+	}
+	return chooseTusChecksumAlgorithm(res.Header.Get("Tus-Checksum-Algorithm"), cfg.FipsMode())
+}
+
+// chooseTusChecksumAlgorithm returns the preferred algorithm among those in the
+// given Tus-Checksum-Algorithm header, or an empty string if there's none we
+// know. In FIPS mode, only sha256 is used, since sha1 and md5 aren't approved.
+func chooseTusChecksumAlgorithm(header string, fips bool) string {
+	for _, algorithm := range tusChecksumAlgorithms {
+		if fips && algorithm != "sha256" {
+			continue
+		}
+		if tusHeaderContains(header, algorithm) {
+			return algorithm
+		}
+	}
+	return ""
+}
+
+// tusHeaderContains returns whether the comma-separated list in a tus.io
+// header contains the given value.
+func tusHeaderContains(header, value string) bool {
+	for _, v := range strings.Split(header, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// tusChecksum returns the base64 encoded checksum with the given algorithm of
+// the size bytes of f from offset on, as sent in an Upload-Checksum header.
+func tusChecksum(f io.ReaderAt, algorithm string, offset, size int64) (string, error) {
+	var h hash.Hash
+	switch algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha1":
+		h = sha1.New()
+	case "md5":
+		h = md5.New()
+	default:
+		return "", fmt.Errorf("unsupported tus.io checksum algorithm %q", algorithm)
+	}
+
+	if _, err := io.Copy(h, io.NewSectionReader(f, offset, size)); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
 }
 
 func configureTusAdapter(m *Manifest) {
 	m.RegisterNewAdapterFunc(TusAdapterName, Upload, func(name string, dir Direction) Adapter {
 		switch dir {
 		case Upload:
-			bu := &tusUploadAdapter{newAdapterBase(name, dir, nil)}
+			bu := &tusUploadAdapter{
+				adapterBase: newAdapterBase(name, dir, nil),
+				checksums:   make(map[string]string),
+			}
 			// self implements impl
 			bu.transferImpl = bu
 			return bu
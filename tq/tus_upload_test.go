@@ -0,0 +1,44 @@
+package tq
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTusChecksum(t *testing.T) {
+	r := strings.NewReader("hello world")
+
+	sum, err := tusChecksum(r, "sha1", 6, 5)
+	assert.Nil(t, err)
+	// sha1("world")
+	assert.Equal(t, "fCEUM/AgcVl3Qeb/Wo6jR4mrv0M=", sum)
+
+	sum, err = tusChecksum(r, "md5", 0, 11)
+	assert.Nil(t, err)
+	// md5("hello world")
+	assert.Equal(t, "XrY7u+Ae7tCTyyK7j1rNww==", sum)
+}
+
+func TestTusChecksumUnsupportedAlgorithm(t *testing.T) {
+	_, err := tusChecksum(strings.NewReader("hello"), "crc32", 0, 5)
+	assert.NotNil(t, err)
+}
+
+func TestTusHeaderContains(t *testing.T) {
+	assert.True(t, tusHeaderContains("creation, checksum", "checksum"))
+	assert.True(t, tusHeaderContains("SHA1,sha256", "sha1"))
+	assert.False(t, tusHeaderContains("checksum-trailer", "checksum"))
+	assert.False(t, tusHeaderContains("", "checksum"))
+}
+
+func TestChooseTusChecksumAlgorithm(t *testing.T) {
+	assert.Equal(t, "sha256", chooseTusChecksumAlgorithm("md5,sha1,sha256", false))
+	assert.Equal(t, "sha1", chooseTusChecksumAlgorithm("md5, SHA1", false))
+	assert.Equal(t, "", chooseTusChecksumAlgorithm("crc32", false))
+
+	// sha1 and md5 aren't FIPS-approved
+	assert.Equal(t, "sha256", chooseTusChecksumAlgorithm("md5,sha1,sha256", true))
+	assert.Equal(t, "", chooseTusChecksumAlgorithm("md5,sha1", true))
+}
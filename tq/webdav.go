@@ -0,0 +1,443 @@
+package tq
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/api"
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/git-lfs/git-lfs/errors"
+	"github.com/git-lfs/git-lfs/httputil"
+	"github.com/git-lfs/git-lfs/progress"
+	"github.com/rubyist/tracerx"
+)
+
+const (
+	WebdavAdapterName = "webdav"
+
+	// webdavLockTimeout is how long the lock taken on an object while it's
+	// uploaded lasts if it isn't released, as when Git LFS is killed.
+	webdavLockTimeout = "Second-600"
+
+	// webdavPartSuffix ends the names of the files which chunked uploads
+	// are written to, next to the objects they're moved to once whole.
+	webdavPartSuffix = ".part"
+)
+
+// webdavLockInfo is the body of the LOCK requests taking an exclusive write
+// lock on an object.
+const webdavLockInfo = `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:">
+  <D:lockscope><D:exclusive/></D:lockscope>
+  <D:locktype><D:write/></D:locktype>
+  <D:owner>git-lfs</D:owner>
+</D:lockinfo>`
+
+// Adapter for transfers to and from a collection on a WebDAV share, such as
+// those of Nextcloud or ownCloud, as given by a webdav+http(s):// URL. Objects
+// are stored there as they are locally, in "ab/cd/abcd..." files. There's no
+// batch API to ask, so the transfer queue makes up the batch responses with
+// webdavBatch, and this adapter is never offered to servers.
+//
+// Downloads are made as basic ones, resuming with HTTP Range requests. Uploads
+// take a WebDAV lock on the object, unless lfs.webdav.locking is false, and
+// are sent in parts of lfs.webdav.chunksize bytes, if it's set, with ranged
+// PUTs which later attempts resume.
+type webdavAdapter struct {
+	*adapterBase
+	download *basicDownloadAdapter
+}
+
+func (a *webdavAdapter) ClearTempStorage() error {
+	// Downloads are kept with the basic adapter's, which clears them;
+	// incomplete uploads are on the share.
+	return nil
+}
+
+func (a *webdavAdapter) WorkerStarting(workerNum int) (interface{}, error) {
+	return nil, nil
+}
+func (a *webdavAdapter) WorkerEnding(workerNum int, ctx interface{}) {
+}
+
+func (a *webdavAdapter) DoTransfer(ctx interface{}, t *Transfer, cb ProgressCallback, authOkFunc func()) error {
+	if a.direction == Download {
+		return a.download.DoTransfer(ctx, t, cb, authOkFunc)
+	}
+
+	rel, err := t.Actions.Get("upload")
+	if err != nil {
+		return err
+	}
+
+	size, err := a.size(t, rel.Href)
+	if err != nil {
+		return err
+	}
+	if size == t.Size {
+		tracerx.Printf("xfer: %q is on the WebDAV share already, skipping", t.Oid)
+		advanceCallbackProgress(cb, t, t.Size)
+		if authOkFunc != nil {
+			authOkFunc()
+		}
+		return nil
+	}
+
+	if err := ensureWholeObject(a.objects(), t); err != nil {
+		return errors.Wrap(err, "webdav upload")
+	}
+	if err := a.makeCollections(t, rel.Href); err != nil {
+		return err
+	}
+
+	token, err := a.lock(t, rel.Href)
+	if err != nil {
+		return err
+	}
+	defer a.unlock(t, rel.Href, token)
+
+	if chunkSize := a.config().WebdavChunkSize(); chunkSize > 0 && t.Size > chunkSize {
+		err = a.uploadChunked(t, rel.Href, token, chunkSize, cb, authOkFunc)
+	} else {
+		err = a.uploadWhole(t, rel.Href, token, cb, authOkFunc)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Servers which don't support ranged PUTs write each part over the
+	// last, so check that they have the whole object.
+	if size, err = a.size(t, rel.Href); err != nil {
+		return err
+	} else if size != t.Size {
+		return errors.Errorf("Git LFS: %s is %d bytes on the WebDAV share, expected %d; unset lfs.webdav.chunksize if it doesn't support partial uploads", t.Oid, size, t.Size)
+	}
+	return nil
+}
+
+// HasObject tells whether the object of the given size is stored at the given
+// URL on the WebDAV share.
+func (a *webdavAdapter) HasObject(href string, size int64) (bool, error) {
+	stored, err := a.size(&Transfer{}, href)
+	return stored == size, err
+}
+
+// uploadWhole uploads t's object to href with a single PUT.
+func (a *webdavAdapter) uploadWhole(t *Transfer, href, token string, cb ProgressCallback, authOkFunc func()) error {
+	f, err := os.OpenFile(t.Path, os.O_RDONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "webdav upload")
+	}
+	defer f.Close()
+
+	header := webdavIfHeader(token, "")
+	return a.put(t, href, header, f, 0, t.Size, cb, authOkFunc)
+}
+
+// uploadChunked uploads t's object to a file next to href in parts of
+// chunkSize bytes, carrying on from whatever an earlier attempt left there,
+// then moves the file to href.
+func (a *webdavAdapter) uploadChunked(t *Transfer, href, token string, chunkSize int64, cb ProgressCallback, authOkFunc func()) error {
+	part := href + webdavPartSuffix
+	offset, err := a.size(t, part)
+	if err != nil {
+		return err
+	}
+	if offset < 0 || offset > t.Size {
+		offset = 0
+	}
+
+	f, err := os.OpenFile(t.Path, os.O_RDONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "webdav upload")
+	}
+	defer f.Close()
+
+	if offset > 0 {
+		tracerx.Printf("xfer: resuming WebDAV upload of %q from byte %d", t.Oid, offset)
+		advanceCallbackProgress(cb, t, offset)
+	}
+
+	for offset < t.Size {
+		n := chunkSize
+		if offset+n > t.Size {
+			n = t.Size - offset
+		}
+
+		if _, err := f.Seek(offset, os.SEEK_SET); err != nil {
+			return errors.Wrap(err, "webdav upload")
+		}
+
+		header := map[string]string{
+			"Content-Range": fmt.Sprintf("bytes %d-%d/%d", offset, offset+n-1, t.Size),
+		}
+		if err := a.put(t, part, header, io.LimitReader(f, n), offset, n, cb, authOkFunc); err != nil {
+			return err
+		}
+		offset += n
+		authOkFunc = nil
+	}
+
+	dest, err := url.Parse(href)
+	if err != nil {
+		return err
+	}
+	dest.User = nil
+
+	header := webdavIfHeader(token, dest.String())
+	header["Destination"] = dest.String()
+	header["Overwrite"] = "T"
+	res, err := a.request(t, "MOVE", part, header, nil)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != 201 && res.StatusCode != 204 {
+		return webdavError(res, errors.Errorf("Git LFS: unable to move %s to %s", part, href))
+	}
+	return nil
+}
+
+// put sends n bytes of t's object from r to href, starting at offset.
+func (a *webdavAdapter) put(t *Transfer, href string, header map[string]string, r io.Reader, offset, n int64, cb ProgressCallback, authOkFunc func()) error {
+	req, err := a.newRequest("PUT", href, header)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Length", strconv.FormatInt(n, 10))
+	req.ContentLength = n
+
+	ccb := func(totalSize int64, readSoFar int64, readSinceLast int) error {
+		if cb != nil {
+			return cb(t.Name, totalSize, readSoFar, readSinceLast)
+		}
+		return nil
+	}
+	var reader io.Reader
+	reader = &progress.CallbackReader{
+		C:         ccb,
+		TotalSize: t.Size,
+		ReadSize:  offset,
+		Reader:    r,
+	}
+
+	// Signal auth was ok on first read; this frees up other workers to start
+	if authOkFunc != nil {
+		reader = newStartCallbackReader(reader, func(*startCallbackReader) {
+			authOkFunc()
+		})
+	}
+	req.Body = ioutil.NopCloser(reader)
+
+	res, err := httputil.DoHttpRequest(a.config(), req, !t.Authenticated)
+	if err != nil {
+		if _, ok := errors.IsRetriableLaterError(err); ok {
+			return err
+		}
+		return webdavError(res, err)
+	}
+	httputil.LogTransfer(a.config(), "lfs.data.upload", res)
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	if res.StatusCode > 299 {
+		return webdavError(res, errors.Errorf("Invalid status for %s: %d", httputil.TraceHttpReq(req), res.StatusCode))
+	}
+	return nil
+}
+
+// size returns the size of the file at href on the WebDAV share, or -1
+// if there is none.
+func (a *webdavAdapter) size(t *Transfer, href string) (int64, error) {
+	res, err := a.request(t, "HEAD", href, nil, nil)
+	if err != nil {
+		return -1, err
+	}
+
+	switch res.StatusCode {
+	case 200:
+		if res.ContentLength < 0 {
+			return -1, nil
+		}
+		return res.ContentLength, nil
+	case 404:
+		return -1, nil
+	}
+	return -1, webdavError(res, errors.Errorf("Git LFS: unable to find the size of %s", href))
+}
+
+// makeCollections creates the "ab" and "ab/cd" collections which the
+// object at href is stored in, unless they exist already.
+func (a *webdavAdapter) makeCollections(t *Transfer, href string) error {
+	parent := href[:strings.LastIndex(href, "/")]
+	for _, collection := range []string{parent[:strings.LastIndex(parent, "/")], parent} {
+		res, err := a.request(t, "MKCOL", collection+"/", nil, nil)
+		if err != nil {
+			return err
+		}
+
+		switch res.StatusCode {
+		case 201, 405:
+			// 405 Method Not Allowed means it exists already.
+			continue
+		case 409:
+			return errors.Errorf("Git LFS: the WebDAV collection above %s does not exist", collection)
+		}
+		return webdavError(res, errors.Errorf("Git LFS: unable to create WebDAV collection %s", collection))
+	}
+	return nil
+}
+
+// lock takes an exclusive write lock on href for the upload of t's
+// object, returning its token, or an empty string if locking is disabled or
+// the share doesn't support it. A lock held by another client, uploading the
+// same object, is waited for by retrying.
+func (a *webdavAdapter) lock(t *Transfer, href string) (string, error) {
+	if !a.config().WebdavLocking() {
+		return "", nil
+	}
+
+	header := map[string]string{
+		"Content-Type": "application/xml; charset=utf-8",
+		"Depth":        "0",
+		"Timeout":      webdavLockTimeout,
+	}
+	res, err := a.request(t, "LOCK", href, header, strings.NewReader(webdavLockInfo))
+	if err != nil {
+		return "", err
+	}
+
+	switch res.StatusCode {
+	case 200, 201:
+		token := res.Header.Get("Lock-Token")
+		tracerx.Printf("xfer: locked %s with %s", href, token)
+		return token, nil
+	case 405, 501:
+		tracerx.Printf("xfer: WebDAV share does not support locking %s", href)
+		return "", nil
+	case 423:
+		return "", errors.NewRetriableError(errors.Errorf("Git LFS: %s is locked by another upload", href))
+	}
+	return "", webdavError(res, errors.Errorf("Git LFS: unable to lock %s", href))
+}
+
+// unlock releases the lock on href with the given token, if there's one.
+// Failures are only traced, as the lock times out anyway.
+func (a *webdavAdapter) unlock(t *Transfer, href, token string) {
+	if len(token) == 0 {
+		return
+	}
+
+	res, err := a.request(t, "UNLOCK", href, map[string]string{"Lock-Token": token}, nil)
+	if err != nil {
+		tracerx.Printf("xfer: unable to unlock %s: %s", href, err)
+	} else if res.StatusCode > 299 {
+		tracerx.Printf("xfer: unable to unlock %s: status %d", href, res.StatusCode)
+	}
+}
+
+// webdavIfHeader returns the headers submitting the lock token to the share,
+// for the resource the request is made to, or for tag if it's another one. No
+// headers are needed without a token.
+func webdavIfHeader(token, tag string) map[string]string {
+	header := make(map[string]string)
+	if len(token) == 0 {
+		return header
+	}
+
+	if len(tag) > 0 {
+		header["If"] = fmt.Sprintf("<%s> (%s)", tag, token)
+	} else {
+		header["If"] = fmt.Sprintf("(%s)", token)
+	}
+	return header
+}
+
+// request sends the WebDAV request with the given method, headers and
+// body to href. The response is returned whatever its status, with its body
+// read and closed, unless the request couldn't be made.
+func (a *webdavAdapter) request(t *Transfer, method, href string, header map[string]string, body io.Reader) (*http.Response, error) {
+	req, err := a.newRequest(method, href, header)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		by, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(by))
+		req.ContentLength = int64(len(by))
+	}
+
+	res, err := httputil.DoHttpRequest(a.config(), req, !t.Authenticated)
+	if err != nil {
+		if _, ok := errors.IsRetriableLaterError(err); ok {
+			return res, err
+		}
+		if res == nil || res.StatusCode == 0 || res.StatusCode == 401 {
+			return res, withStatus(errors.NewRetriableError(err), res)
+		}
+		// Other statuses are handled by the callers.
+		return res, nil
+	}
+
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	return res, nil
+}
+
+// webdavError returns err with the status of res recorded, and marked as
+// retriable if the share may succeed when asked again.
+func webdavError(res *http.Response, err error) error {
+	if res == nil {
+		return errors.NewRetriableError(err)
+	}
+
+	switch res.StatusCode {
+	case 0, 403, 408, 423, 500, 502, 503, 504:
+		// 403 likely means that credentials, or a session, expired.
+		err = errors.NewRetriableError(err)
+	default:
+		err = errors.Wrap(err, "webdav")
+	}
+	return withStatus(err, res)
+}
+
+// webdavBatch makes up the response of a batch API request for objects stored
+// at a webdav+http(s):// endpoint, which has no Git LFS server to send it to:
+// each object is to be transferred by the WebDAV adapter, to or from its file
+// under the endpoint's collection. Uploads skip objects which the share has
+// already.
+func webdavBatch(endpoint config.Endpoint, objects []*api.ObjectResource, kind string) []*api.ObjectResource {
+	base := strings.TrimSuffix(endpoint.WebdavUrl(), "/")
+	for _, o := range objects {
+		if len(o.Oid) < 5 {
+			o.Error = &api.ObjectError{Code: 422, Message: "Invalid object ID"}
+			continue
+		}
+		o.Actions = map[string]*api.LinkRelation{
+			kind: &api.LinkRelation{Href: fmt.Sprintf("%s/%s/%s/%s", base, o.Oid[0:2], o.Oid[2:4], o.Oid)},
+		}
+	}
+	return objects
+}
+
+func configureWebdavAdapter(m *Manifest) {
+	newfunc := func(name string, dir Direction) Adapter {
+		wa := &webdavAdapter{adapterBase: newAdapterBase(name, dir, nil)}
+		wa.download = &basicDownloadAdapter{wa.adapterBase}
+		// self implements impl
+		wa.transferImpl = wa
+		return wa
+	}
+	m.RegisterNewAdapterFunc(WebdavAdapterName, Upload, newfunc)
+	m.RegisterNewAdapterFunc(WebdavAdapterName, Download, newfunc)
+}
@@ -0,0 +1,156 @@
+package tq
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/git-lfs/git-lfs/api"
+	"github.com/git-lfs/git-lfs/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWebdavShare is a WebDAV share keeping files in memory, supporting just
+// what the WebDAV adapter asks of one.
+type fakeWebdavShare struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	requests []string
+	lock     string
+}
+
+func (s *fakeWebdavShare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, pass, _ := r.BasicAuth(); user != "user" || pass != "pass" {
+		w.WriteHeader(401)
+		return
+	}
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	body, _ := ioutil.ReadAll(r.Body)
+	data, exists := s.files[r.URL.Path]
+
+	switch r.Method {
+	case "HEAD", "GET":
+		if !exists {
+			w.WriteHeader(404)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+		w.Write(data)
+	case "MKCOL":
+		w.WriteHeader(201)
+	case "LOCK":
+		s.lock = "<opaquelocktoken:1>"
+		w.Header().Set("Lock-Token", s.lock)
+		w.WriteHeader(200)
+	case "UNLOCK":
+		if r.Header.Get("Lock-Token") == s.lock {
+			s.lock = ""
+		}
+		w.WriteHeader(204)
+	case "PUT":
+		var start int
+		fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-", &start)
+		s.files[r.URL.Path] = append(data[:start], body...)
+		w.WriteHeader(201)
+	case "MOVE":
+		dest := strings.TrimPrefix(r.Header.Get("Destination"), "http://"+r.Host)
+		if len(s.lock) > 0 && !strings.Contains(r.Header.Get("If"), s.lock) {
+			w.WriteHeader(423)
+			return
+		}
+		s.files[dest] = data
+		delete(s.files, r.URL.Path)
+		w.WriteHeader(201)
+	}
+}
+
+func TestWebdavUploadChunkedResumesAndLocks(t *testing.T) {
+	share := &fakeWebdavShare{files: make(map[string][]byte)}
+	srv := httptest.NewServer(share)
+	defer srv.Close()
+
+	oldConfig := config.Config
+	defer func() { config.Config = oldConfig }()
+	endpoint := "webdav+http://user:pass@" + strings.TrimPrefix(srv.URL, "http://") + "/lfs/"
+	config.Config = config.NewFrom(config.Values{Git: map[string]string{
+		"lfs.url":              endpoint,
+		"lfs.webdav.chunksize": "4",
+	}})
+
+	dir, err := ioutil.TempDir("", "webdav")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	contents := []byte("0123456789")
+	oid := "abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"
+	path := filepath.Join(dir, oid)
+	require.Nil(t, ioutil.WriteFile(path, contents, 0644))
+
+	objectPath := "/lfs/ab/cd/" + oid
+	share.files[objectPath+webdavPartSuffix] = contents[:4]
+
+	objs := webdavBatch(config.Config.Endpoint("upload"), []*api.ObjectResource{{Oid: oid, Size: 10}}, "upload")
+	href := objs[0].Actions["upload"].Href
+	assert.Equal(t, strings.TrimPrefix(endpoint, "webdav+")+"ab/cd/"+oid, href)
+
+	m := NewManifest()
+	a := m.NewUploadAdapter(WebdavAdapterName).(*webdavAdapter)
+	tr := newTransfer("a.dat", objs[0], path)
+
+	var progress []int64
+	cb := func(name string, totalSize, readSoFar int64, readSinceLast int) error {
+		progress = append(progress, readSoFar)
+		return nil
+	}
+	require.Nil(t, a.DoTransfer(nil, tr, cb, nil))
+
+	assert.Equal(t, contents, share.files[objectPath])
+	assert.NotContains(t, share.files, objectPath+webdavPartSuffix)
+	assert.Empty(t, share.lock)
+	assert.Equal(t, int64(10), progress[len(progress)-1])
+	assert.Equal(t, []string{
+		"HEAD " + objectPath,
+		"MKCOL /lfs/ab/",
+		"MKCOL /lfs/ab/cd/",
+		"LOCK " + objectPath,
+		"HEAD " + objectPath + webdavPartSuffix,
+		"PUT " + objectPath + webdavPartSuffix,
+		"PUT " + objectPath + webdavPartSuffix,
+		"MOVE " + objectPath + webdavPartSuffix,
+		"HEAD " + objectPath,
+		"UNLOCK " + objectPath,
+	}, share.requests)
+
+	has, err := a.HasObject(href, 10)
+	assert.Nil(t, err)
+	assert.True(t, has)
+
+	has, err = a.HasObject(href+"-missing", 10)
+	assert.Nil(t, err)
+	assert.False(t, has)
+}
+
+func TestWebdavAdapterIsNotOfferedToServers(t *testing.T) {
+	m := NewManifest()
+	assert.Equal(t, WebdavAdapterName, m.NewUploadAdapter(WebdavAdapterName).Name())
+	assert.Equal(t, WebdavAdapterName, m.NewDownloadAdapter(WebdavAdapterName).Name())
+	assert.NotContains(t, m.GetUploadAdapterNames(), WebdavAdapterName)
+	assert.NotContains(t, m.GetDownloadAdapterNames(), WebdavAdapterName)
+}
+
+func TestWebdavIfHeader(t *testing.T) {
+	assert.Empty(t, webdavIfHeader("", "http://example.com/lfs/a"))
+	assert.Equal(t, "(<urn:uuid:1>)", webdavIfHeader("<urn:uuid:1>", "")["If"])
+	assert.Equal(t, "<http://example.com/lfs/a> (<urn:uuid:1>)", webdavIfHeader("<urn:uuid:1>", "http://example.com/lfs/a")["If"])
+}
@@ -0,0 +1,38 @@
+package tq
+
+import "sync"
+
+// workerLimit lets up to a number of workers, which may change, transfer at
+// once. It is embedded by the types which decide that number, which change it
+// with mu held.
+type workerLimit struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// limit is the number of workers let run at once now, and active the
+	// number running.
+	limit, active int
+}
+
+func (l *workerLimit) init(limit int) {
+	l.limit = limit
+	l.cond = sync.NewCond(&l.mu)
+}
+
+// acquire waits until another worker may start a transfer.
+func (l *workerLimit) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+}
+
+// release records that a worker has finished its transfer.
+func (l *workerLimit) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.cond.Signal()
+}
@@ -0,0 +1,45 @@
+package tr
+
+func init() {
+	Register("de", map[string]string{
+		// git lfs push, and uploads
+		"%s does not exist in .git/lfs/objects. Tried %s, which matches %s.": "%s existiert nicht in .git/lfs/objects. Versucht wurde %s, passend zu %s.",
+		"Error getting local refs.":                                                            "Fehler beim Lesen der lokalen Refs.",
+		"Error scanning for Git LFS files in the %q ref":                                       "Fehler beim Durchsuchen der Ref %q nach Git-LFS-Dateien",
+		"Error scanning for Git LFS files in %q":                                               "Fehler beim Durchsuchen von %q nach Git-LFS-Dateien",
+		"Invalid object ID %q: %s":                                                             "Ungültige Objekt-ID %q: %s",
+		"Could not read object IDs: %s":                                                        "Objekt-IDs konnten nicht gelesen werden: %s",
+		"Size %d given for %s, but the local object is %d bytes":                               "Größe %d für %s angegeben, aber das lokale Objekt hat %d Bytes",
+		"%s is not stored locally, so its size is unknown; give it as <oid>:<size>":            "%s ist nicht lokal gespeichert, daher ist seine Größe unbekannt; bitte als <oid>:<größe> angeben",
+		"Specify a remote and a remote branch name (`git lfs push origin master`)":             "Bitte ein Remote und den Namen eines Remote-Branches angeben (`git lfs push origin master`)",
+		"Invalid remote name %q":                                                               "Ungültiger Remote-Name %q",
+		"This should be run through Git's pre-push hook.  Run `git lfs update` to install it.": "Dies sollte über Gits pre-push-Hook ausgeführt werden.  Zum Einrichten `git lfs update` ausführen.",
+		"Dry run: %d files to upload (%v)":                                                     "Probelauf: %d Dateien hochzuladen (%v)",
+		"Uploaded %d files (%v), skipped %d files already on the server (%v saved)":            "%d Dateien hochgeladen (%v), %d bereits auf dem Server vorhandene Dateien übersprungen (%v gespart)",
+		"Could not read the push queue for %q: %s":                                             "Die Push-Warteschlange für %q konnte nicht gelesen werden: %s",
+		"Could not queue objects to push to %q: %s":                                            "Objekte für den Push nach %q konnten nicht vorgemerkt werden: %s",
+		"Git LFS is offline: queued %d files to push later with 'git lfs push --queued %s'":    "Git LFS ist offline: %d Dateien vorgemerkt, um sie später mit 'git lfs push --queued %s' hochzuladen",
+		"Queued %d files to push later with 'git lfs push --flush-queue'":                      "%d Dateien vorgemerkt, um sie später mit 'git lfs push --flush-queue' hochzuladen",
+		"Warning: until then, commits pushed to %s refer to Git LFS objects it doesn't have":   "Warnung: Bis dahin verweisen nach %s gepushte Commits auf Git-LFS-Objekte, die dort fehlen",
+		"%s: %d errors":               "%s: %d Fehler",
+		"  ...and %d more":            "  ...und %d weitere",
+		"Upload errors written to %s": "Fehler beim Hochladen wurden in %s gespeichert",
+
+		// --timeout, and interrupts
+		"Timed out after %s.":           "Zeitlimit von %s überschritten.",
+		"Interrupted before finishing.": "Vor dem Abschluss unterbrochen.",
+
+		// Progress
+		"(%d of %d files": "(%d von %d Dateien",
+		", %d skipped":    ", %d übersprungen",
+		", %s committed":  ", %s gespeichert",
+		", %s skipped":    ", %s übersprungen",
+		", rate limited by server, resuming at %s": ", vom Server gedrosselt, weiter um %s",
+		", total %s":        ", insgesamt %s",
+		"total %s":          "insgesamt %s",
+		"  ... and %d more": "  ... und %d weitere",
+
+		// Help
+		"Sorry, no usage text found for %q": "Leider wurde keine Hilfe zu %q gefunden",
+	})
+}
@@ -0,0 +1,162 @@
+// Package tr translates the messages Git LFS shows to its users
+// NOTE: Subject to change, do not rely on this package from outside git-lfs source
+package tr
+
+// Messages are looked up by their English text, as gettext does, so that any
+// message without a translation is shown in English as before. Each catalog
+// is registered by an init function in a catalog_<locale>.go file of this
+// package, with the messages of one locale, such as "de" or "pt_BR".
+//
+// A message with arguments is translated as its format string, which the
+// translation must keep the verbs of, in the same order:
+//
+//	tr.Sprintf("Uploaded %d files (%v)", n, size)
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	catalogs = make(map[string]map[string]string)
+
+	// locales are the locales which messages are looked up in, most
+	// specific first, as detected by detectLocales.
+	locales     []string
+	localesOnce sync.Once
+)
+
+// Register adds the given translations of messages, keyed by their English
+// text, to the catalog of the named locale.
+func Register(locale string, messages map[string]string) {
+	catalog, ok := catalogs[locale]
+	if !ok {
+		catalog = make(map[string]string, len(messages))
+		catalogs[locale] = catalog
+	}
+
+	for msg, translation := range messages {
+		catalog[msg] = translation
+	}
+}
+
+// Locales returns the locales which messages are translated into, most
+// specific first, such as "pt_BR" and "pt", or none if messages are shown in
+// English.
+func Locales() []string {
+	localesOnce.Do(func() {
+		locales = detectLocales(os.Getenv)
+	})
+	return locales
+}
+
+// Get returns the translation of the given message, or the message itself if
+// it has none.
+func Get(msg string) string {
+	if translation, ok := lookup(Locales(), msg); ok {
+		return translation
+	}
+	return msg
+}
+
+// Sprintf formats the translation of the given format string with args, as
+// fmt.Sprintf does.
+func Sprintf(format string, args ...interface{}) string {
+	return fmt.Sprintf(Get(format), args...)
+}
+
+// lookup returns the translation of msg in the first of the given locales
+// which has one, and whether there was one.
+func lookup(locales []string, msg string) (string, bool) {
+	for _, locale := range locales {
+		if translation, ok := catalogs[locale][msg]; ok && len(translation) > 0 {
+			return translation, true
+		}
+	}
+	return "", false
+}
+
+// detectLocales returns the locales given by the first of the LC_ALL,
+// LC_MESSAGES and LANG environment variables which is set, as getenv returns
+// them, in the order which messages are looked up in. As with gettext, the
+// LANGUAGE environment variable, a list of locales separated by colons in the
+// order they're preferred, takes precedence over them, unless they give the
+// "C" or "POSIX" locale, or none.
+func detectLocales(getenv func(string) string) []string {
+	var locale string
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := getenv(name); len(value) > 0 {
+			locale = value
+			break
+		}
+	}
+	if len(locale) == 0 || isCLocale(locale) {
+		return nil
+	}
+
+	language := getenv("LANGUAGE")
+	if len(language) == 0 {
+		return parseLocale(locale)
+	}
+
+	var locales []string
+	seen := make(map[string]bool)
+	for _, value := range strings.Split(language, ":") {
+		if len(value) == 0 {
+			continue
+		}
+
+		parsed := parseLocale(value)
+		if len(parsed) == 0 {
+			// English is preferred over the locales after it,
+			// since messages are written in English.
+			break
+		}
+		for _, l := range parsed {
+			if !seen[l] {
+				seen[l] = true
+				locales = append(locales, l)
+			}
+		}
+	}
+	return locales
+}
+
+// isCLocale returns whether the given locale is the "C" or "POSIX" locale, in
+// which messages aren't translated.
+func isCLocale(value string) bool {
+	if idx := strings.IndexAny(value, ".@"); idx >= 0 {
+		value = value[:idx]
+	}
+	return value == "C" || value == "POSIX"
+}
+
+// parseLocale returns the locales which messages are looked up in for a
+// locale given as "language[_territory][.codeset][@modifier]": the language
+// and territory, and then the language alone. The "C" and "POSIX" locales,
+// and English, have none, since messages are written in English.
+func parseLocale(value string) []string {
+	if isCLocale(value) {
+		return nil
+	}
+	if idx := strings.IndexAny(value, ".@"); idx >= 0 {
+		value = value[:idx]
+	}
+
+	value = strings.Replace(value, "-", "_", 1)
+	language := strings.ToLower(value)
+	if idx := strings.Index(value, "_"); idx >= 0 {
+		language = strings.ToLower(value[:idx])
+		value = language + "_" + strings.ToUpper(value[idx+1:])
+	}
+
+	if len(language) == 0 || language == "en" {
+		return nil
+	}
+	if value == language {
+		return []string{language}
+	}
+	return []string{value, language}
+}
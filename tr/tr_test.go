@@ -0,0 +1,92 @@
+package tr
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLocale(t *testing.T) {
+	assert.Equal(t, []string{"de_DE", "de"}, parseLocale("de_DE.UTF-8"))
+	assert.Equal(t, []string{"de_AT", "de"}, parseLocale("de_AT@euro"))
+	assert.Equal(t, []string{"pt_BR", "pt"}, parseLocale("pt-br"))
+	assert.Equal(t, []string{"fr"}, parseLocale("fr"))
+	assert.Nil(t, parseLocale("en_US.UTF-8"))
+	assert.Nil(t, parseLocale("C.UTF-8"))
+	assert.Nil(t, parseLocale("POSIX"))
+	assert.Nil(t, parseLocale(""))
+}
+
+func TestDetectLocalesPrefersLCAll(t *testing.T) {
+	env := map[string]string{
+		"LC_ALL":      "fr_FR.UTF-8",
+		"LC_MESSAGES": "de_DE.UTF-8",
+		"LANG":        "pt_BR.UTF-8",
+	}
+
+	assert.Equal(t, []string{"fr_FR", "fr"}, detectLocales(func(name string) string { return env[name] }))
+
+	delete(env, "LC_ALL")
+	assert.Equal(t, []string{"de_DE", "de"}, detectLocales(func(name string) string { return env[name] }))
+
+	delete(env, "LC_MESSAGES")
+	assert.Equal(t, []string{"pt_BR", "pt"}, detectLocales(func(name string) string { return env[name] }))
+
+	delete(env, "LANG")
+	assert.Nil(t, detectLocales(func(name string) string { return env[name] }))
+}
+
+func TestDetectLocalesPrefersLanguage(t *testing.T) {
+	env := map[string]string{
+		"LANGUAGE": "pt_BR:fr::de",
+		"LANG":     "de_DE.UTF-8",
+	}
+
+	assert.Equal(t, []string{"pt_BR", "pt", "fr", "de"}, detectLocales(func(name string) string { return env[name] }))
+
+	// English is preferred over the locales listed after it
+	env["LANGUAGE"] = "fr:en:de"
+	assert.Equal(t, []string{"fr"}, detectLocales(func(name string) string { return env[name] }))
+
+	// LANGUAGE is ignored in the C locale, or without a locale
+	env["LANGUAGE"] = "fr"
+	env["LC_ALL"] = "C.UTF-8"
+	assert.Nil(t, detectLocales(func(name string) string { return env[name] }))
+
+	delete(env, "LC_ALL")
+	delete(env, "LANG")
+	assert.Nil(t, detectLocales(func(name string) string { return env[name] }))
+}
+
+func TestLookupFallsBackToLanguage(t *testing.T) {
+	Register("xx", map[string]string{"Uploaded %d files": "xx %d", "Empty": ""})
+	Register("xx_YY", map[string]string{"Uploaded %d files": "xx_YY %d"})
+	defer delete(catalogs, "xx")
+	defer delete(catalogs, "xx_YY")
+
+	translation, ok := lookup([]string{"xx_YY", "xx"}, "Uploaded %d files")
+	assert.True(t, ok)
+	assert.Equal(t, "xx_YY %d", translation)
+
+	translation, ok = lookup([]string{"xx_ZZ", "xx"}, "Uploaded %d files")
+	assert.True(t, ok)
+	assert.Equal(t, "xx %d", translation)
+
+	_, ok = lookup([]string{"xx_YY", "xx"}, "Empty")
+	assert.False(t, ok)
+
+	_, ok = lookup(nil, "Uploaded %d files")
+	assert.False(t, ok)
+}
+
+var verbPattern = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestCatalogsKeepVerbs(t *testing.T) {
+	for locale, catalog := range catalogs {
+		for msg, translation := range catalog {
+			assert.Equal(t, verbPattern.FindAllString(msg, -1), verbPattern.FindAllString(translation, -1),
+				"the %s translation of %q", locale, msg)
+		}
+	}
+}